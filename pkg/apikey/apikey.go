@@ -0,0 +1,93 @@
+// Package apikey is the format of the API keys partners use instead of a
+// user's access token, for integrations that can not log in interactively.
+//
+// A key looks like "rk_<key_id>_<secret>". The key id names the key, so the
+// auth service can find it without scanning; only a hash of the secret is
+// stored. Keys are sent in the X-API-Key header and act for the user owning
+// them, limited to the scopes of the key.
+package apikey
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Header carries an API key in place of the X-Auth access token.
+const Header = "X-API-Key"
+
+const prefix = "rk_"
+
+var ErrInvalidKey = errors.New("invalid api key")
+
+// InsufficientScope rejects a valid key that lacks the scope of an endpoint.
+type InsufficientScope struct {
+	Scope string
+}
+
+func (c *InsufficientScope) Error() string {
+	return "api key lacks scope " + c.Scope
+}
+
+// Info is what the auth service says about a valid key.
+type Info struct {
+	KeyID    string   `json:"key_id"`
+	UserID   uint64   `json:"user_id"`
+	Username string   `json:"username"`
+	Scopes   []string `json:"scopes"`
+	// RateLimit is the limit of the key in ratelimit.ParseLimit form.
+	RateLimit string `json:"rate_limit"`
+}
+
+// HasScope reports whether the key grants scope.
+func (c Info) HasScope(scope string) bool {
+	for _, granted := range c.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// New returns a random key with its id and secret.
+func New() (string, string, string, error) {
+	buf := make([]byte, 8+32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", "", "", err
+	}
+	keyID := hex.EncodeToString(buf[:8])
+	secret := hex.EncodeToString(buf[8:])
+	return prefix + keyID + "_" + secret, keyID, secret, nil
+}
+
+// Parse splits key into its id and secret.
+func Parse(key string) (string, string, error) {
+	rest, ok := strings.CutPrefix(key, prefix)
+	if !ok {
+		return "", "", ErrInvalidKey
+	}
+	keyID, secret, ok := strings.Cut(rest, "_")
+	if !ok || keyID == "" || secret == "" {
+		return "", "", ErrInvalidKey
+	}
+	return keyID, secret, nil
+}
+
+// IsKey reports whether s has the form of an API key rather than an access
+// token.
+func IsKey(s string) bool {
+	_, _, err := Parse(s)
+	return err == nil
+}
+
+// Status is the HTTP status for an error of a key check: 403 for a missing
+// scope and 401 for the rest.
+func Status(err error) int {
+	if _, ok := err.(*InsufficientScope); ok {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
@@ -0,0 +1,59 @@
+package apikey
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	key, keyID, secret, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "rk_"+keyID+"_"+secret || len(keyID) != 16 || len(secret) != 64 {
+		t.Fatalf("got key %q, id %q, secret %q", key, keyID, secret)
+	}
+	parsedID, parsedSecret, err := Parse(key)
+	if err != nil || parsedID != keyID || parsedSecret != secret {
+		t.Fatalf("got %q %q %v", parsedID, parsedSecret, err)
+	}
+	other, otherID, _, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key || otherID == keyID {
+		t.Fatal("two keys are the same")
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, key := range []string{"", "rk_", "rk_abc", "rk_abc_", "rk__secret", "xx_abc_secret", "eyJhbGciOiJIUzI1NiJ9.e30.sig"} {
+		_, _, err := Parse(key)
+		if err != ErrInvalidKey {
+			t.Errorf("%q: got %v, want %v", key, err, ErrInvalidKey)
+		}
+		if IsKey(key) {
+			t.Errorf("%q: taken for a key", key)
+		}
+	}
+	// The secret is everything after the id.
+	keyID, secret, err := Parse("rk_abc_def_ghi")
+	if err != nil || keyID != "abc" || secret != "def_ghi" {
+		t.Fatalf("got %q %q %v", keyID, secret, err)
+	}
+}
+
+func TestScope(t *testing.T) {
+	info := Info{Scopes: []string{"booking:read", "lease:read"}}
+	if !info.HasScope("booking:read") || info.HasScope("booking:write") || info.HasScope("booking") {
+		t.Fatalf("got wrong scopes for %v", info.Scopes)
+	}
+	err := &InsufficientScope{Scope: "booking:write"}
+	if Status(err) != http.StatusForbidden || !strings.Contains(err.Error(), "booking:write") {
+		t.Fatalf("got %d %v", Status(err), err)
+	}
+	if Status(ErrInvalidKey) != http.StatusUnauthorized {
+		t.Fatalf("got %d for an invalid key", Status(ErrInvalidKey))
+	}
+}
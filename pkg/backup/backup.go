@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"distributed-rental/pkg/encryption"
+	"encoding/hex"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// maxPendingWrites bounds the memory db.Load uses while restoring.
+const maxPendingWrites = 256
+
+// Take pulls a backup from the admin address of a running service into dir and
+// records it in the manifest. It is incremental unless full is set or dir has
+// no backups yet.
+func Take(addr string, adminToken []byte, service string, dir string, full bool) (Entry, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return Entry{}, err
+	}
+	if manifest.Service != "" && manifest.Service != service {
+		return Entry{}, fmt.Errorf("%s holds backups of %s, not %s", dir, manifest.Service, service)
+	}
+	manifest.Service = service
+
+	since := manifest.next()
+	if full {
+		since = 0
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/backup?since=%d", addr, since), nil)
+	if err != nil {
+		return Entry{}, err
+	}
+	req.Header.Set(TokenHeader, string(adminToken))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return Entry{}, fmt.Errorf("backup: %s: %s", resp.Status, body)
+	}
+
+	createdAt := time.Now().UTC()
+	kind := "incr"
+	if since == 0 {
+		kind = "full"
+	}
+	entry := Entry{
+		File:      fmt.Sprintf("%s-%04d-%s-%s.bak", service, len(manifest.Entries), createdAt.Format("20060102T150405Z"), kind),
+		Since:     since,
+		CreatedAt: createdAt,
+	}
+
+	path := filepath.Join(dir, entry.File)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return Entry{}, err
+	}
+	hash := sha256.New()
+	entry.Size, err = io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		entry.Version, err = strconv.ParseUint(resp.Trailer.Get(VersionTrailer), 10, 64)
+		if err != nil {
+			err = fmt.Errorf("backup stream incomplete: %w", err)
+		}
+	}
+	if err != nil {
+		os.Remove(path)
+		return Entry{}, err
+	}
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	// An empty incremental backup reports no version; keep the chain contiguous.
+	if entry.Version < since {
+		entry.Version = since
+	}
+
+	manifest.Entries = append(manifest.Entries, entry)
+	err = writeManifest(dir, manifest)
+	if err != nil {
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+// Verify checks the checksum of every backup and loads the chain ending at
+// at into an in-memory database, so a truncated or corrupt stream is found
+// before it is needed.
+func Verify(dir string, at time.Time) ([]Entry, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range manifest.Entries {
+		err = checksum(dir, entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chain, err := manifest.Chain(at)
+	if err != nil {
+		return nil, err
+	}
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return chain, load(db, dir, chain)
+}
+
+// Restore loads the chain ending at at into target, which must not contain a
+// database yet, encrypting it with key unless key is nil. Point the service at
+// target once it finishes.
+func Restore(dir string, target string, at time.Time, key []byte) ([]Entry, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := manifest.Chain(at)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range chain {
+		err = checksum(dir, entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := ioutil.ReadDir(target)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(files) > 0 {
+		return nil, fmt.Errorf("restore target %s is not empty", target)
+	}
+
+	db, err := badger.Open(encryption.Options(badger.DefaultOptions(target), key).WithLogger(nil))
+	if err != nil {
+		return nil, err
+	}
+	err = load(db, dir, chain)
+	closeErr := db.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return chain, err
+}
+
+func load(db *badger.DB, dir string, chain []Entry) error {
+	for _, entry := range chain {
+		file, err := os.Open(filepath.Join(dir, entry.File))
+		if err != nil {
+			return err
+		}
+		err = db.Load(file, maxPendingWrites)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("load %s: %w", entry.File, err)
+		}
+	}
+	return nil
+}
+
+func checksum(dir string, entry Entry) error {
+	file, err := os.Open(filepath.Join(dir, entry.File))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	if size != entry.Size || hex.EncodeToString(hash.Sum(nil)) != entry.SHA256 {
+		return fmt.Errorf("backup %s is corrupt: checksum mismatch", entry.File)
+	}
+	return nil
+}
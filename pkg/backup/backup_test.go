@@ -0,0 +1,335 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSource returns an in-memory database served by Handler with the admin
+// token "admin", and the address of the handler.
+func newSource(t *testing.T) (*badger.DB, string) {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	server := httptest.NewServer(Handler(db, []byte("admin"), zap.NewNop().Sugar()))
+	t.Cleanup(server.Close)
+	return db, strings.TrimPrefix(server.URL, "http://")
+}
+
+// update sets the keys with a value and deletes those without.
+func update(t *testing.T, db *badger.DB, values map[string]string) {
+	t.Helper()
+	err := db.Update(func(tx *badger.Txn) error {
+		for key, value := range values {
+			var err error
+			if value == "" {
+				err = tx.Delete([]byte(key))
+			} else {
+				err = tx.Set([]byte(key), []byte(value))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// contents returns every key of db with its value.
+func contents(t *testing.T, db *badger.DB) map[string]string {
+	t.Helper()
+	values := map[string]string{}
+	err := db.View(func(tx *badger.Txn) error {
+		it := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			values[string(it.Item().Key())] = string(value)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func expectContents(t *testing.T, got map[string]string, want map[string]string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+// restored restores the chain of dir ending at at into a fresh directory and
+// returns what it holds.
+func restored(t *testing.T, dir string, at time.Time) map[string]string {
+	t.Helper()
+	target := filepath.Join(t.TempDir(), "db")
+	_, err := Restore(dir, target, at, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := badger.Open(badger.DefaultOptions(target).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	return contents(t, db)
+}
+
+func TestRoundTrip(t *testing.T) {
+	db, addr := newSource(t)
+	dir := t.TempDir()
+	update(t, db, map[string]string{"a": "1", "b": "2"})
+	full, err := Take(addr, []byte("admin"), "booking", dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !full.Full() || full.Version == 0 || !strings.HasSuffix(full.File, "-full.bak") {
+		t.Fatalf("got %+v", full)
+	}
+
+	update(t, db, map[string]string{"a": "", "b": "3", "c": "4"})
+	incremental, err := Take(addr, []byte("admin"), "booking", dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if incremental.Full() || incremental.Since != full.Version || incremental.Version <= full.Version || !strings.HasSuffix(incremental.File, "-incr.bak") {
+		t.Fatalf("got %+v after %+v", incremental, full)
+	}
+
+	chain, err := Verify(dir, time.Now())
+	if err != nil || len(chain) != 2 {
+		t.Fatalf("verify: got %v, %v", chain, err)
+	}
+	expectContents(t, restored(t, dir, time.Now()), map[string]string{"b": "3", "c": "4"})
+	// A restore to the time of the full backup leaves the incremental out.
+	expectContents(t, restored(t, dir, full.CreatedAt), map[string]string{"a": "1", "b": "2"})
+
+	// Backups of another service do not go into the same chain.
+	_, err = Take(addr, []byte("admin"), "lease", dir, false)
+	if err == nil {
+		t.Fatal("took a lease backup into the booking directory")
+	}
+	_, err = Take(addr, []byte("guess"), "booking", dir, false)
+	if err == nil {
+		t.Fatal("took a backup with a wrong admin token")
+	}
+
+	// A restore never writes over an existing database.
+	target := t.TempDir()
+	err = ioutil.WriteFile(filepath.Join(target, "MANIFEST"), nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Restore(dir, target, time.Now(), nil)
+	if err == nil {
+		t.Fatal("restored into a directory with a database")
+	}
+
+	// A corrupt backup fails the checksum before it is loaded.
+	path := filepath.Join(dir, incremental.File)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	err = ioutil.WriteFile(path, data, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Verify(dir, time.Now())
+	if err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Fatalf("verify of a corrupt backup: got %v", err)
+	}
+	_, err = Restore(dir, filepath.Join(t.TempDir(), "db"), time.Now(), nil)
+	if err == nil {
+		t.Fatal("restored a corrupt backup")
+	}
+}
+
+// backup fetches the stream since a version from the handler and returns it
+// with the version it reports.
+func backup(t *testing.T, addr string, since uint64) ([]byte, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/backup?since=%d", addr, since), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(TokenHeader, "admin")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %s %s, %v", resp.Status, body, err)
+	}
+	return body, resp.Trailer.Get(VersionTrailer)
+}
+
+// TestIncrementalSince checks that a backup since a version holds exactly the
+// writes after it.
+func TestIncrementalSince(t *testing.T) {
+	db, addr := newSource(t)
+	update(t, db, map[string]string{"a": "1"})
+	_, version := backup(t, addr, 0)
+	update(t, db, map[string]string{"b": "2"})
+	update(t, db, map[string]string{"c": "3"})
+
+	since, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, next := backup(t, addr, since)
+	target, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	err = target.Load(bytes.NewReader(stream), maxPendingWrites)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectContents(t, contents(t, target), map[string]string{"b": "2", "c": "3"})
+	if next != fmt.Sprint(since+2) {
+		t.Fatalf("got version %s after %d and two writes", next, since)
+	}
+
+	// Nothing was written since the last backup: Take keeps the chain
+	// contiguous with an empty backup.
+	dir := t.TempDir()
+	full, err := Take(addr, []byte("admin"), "booking", dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := Take(addr, []byte("admin"), "booking", dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Since != full.Version || empty.Version != full.Version {
+		t.Fatalf("got %+v after %+v", empty, full)
+	}
+	expectContents(t, restored(t, dir, time.Now()), map[string]string{"a": "1", "b": "2", "c": "3"})
+
+	// full ignores the chain.
+	again, err := Take(addr, []byte("admin"), "booking", dir, true)
+	if err != nil || !again.Full() {
+		t.Fatalf("got %+v, %v", again, err)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	_, addr := newSource(t)
+	for target, status := range map[string]int{
+		"/backup?since=x": http.StatusBadRequest,
+		"/backup":         http.StatusOK,
+	} {
+		req, err := http.NewRequest(http.MethodGet, "http://"+addr+target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(TokenHeader, "admin")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("%s: got %d, want %d", target, resp.StatusCode, status)
+		}
+	}
+	resp, err := http.Get("http://" + addr + "/backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("no token: got %d", resp.StatusCode)
+	}
+}
+
+func TestChain(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(file string, hours int, since, version uint64) Entry {
+		return Entry{File: file, CreatedAt: at.Add(time.Duration(hours) * time.Hour), Since: since, Version: version}
+	}
+	manifest := Manifest{Entries: []Entry{
+		entry("full1", 0, 0, 10),
+		entry("incr1", 1, 10, 20),
+		entry("full2", 2, 0, 25),
+		entry("incr2", 3, 25, 30),
+		entry("incr3", 4, 30, 40),
+	}}
+	for hours, want := range map[int]string{
+		0: "full1",
+		1: "full1 incr1",
+		2: "full2",
+		4: "full2 incr2 incr3",
+		9: "full2 incr2 incr3",
+	} {
+		chain, err := manifest.Chain(at.Add(time.Duration(hours)*time.Hour + time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var files []string
+		for _, entry := range chain {
+			files = append(files, entry.File)
+		}
+		if strings.Join(files, " ") != want {
+			t.Errorf("at %dh: got %v, want %s", hours, files, want)
+		}
+	}
+
+	_, err := manifest.Chain(at.Add(-time.Minute))
+	if err != ErrNoBackup {
+		t.Fatalf("before the first backup: got %v, want %v", err, ErrNoBackup)
+	}
+	manifest.Entries[4].Since = 35
+	_, err = manifest.Chain(at.Add(5 * time.Hour))
+	if err == nil || !strings.Contains(err.Error(), "incr3") {
+		t.Fatalf("broken chain: got %v", err)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifest, err := ReadManifest(dir)
+	if err != nil || manifest.Service != "" || len(manifest.Entries) != 0 {
+		t.Fatalf("no manifest: got %+v, %v", manifest, err)
+	}
+	want := Manifest{Service: "auth", Entries: []Entry{{File: "auth-0000.bak", Version: 3, CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Size: 10, SHA256: "00"}}}
+	err = writeManifest(dir, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err = ReadManifest(dir)
+	if err != nil || fmt.Sprint(manifest) != fmt.Sprint(want) {
+		t.Fatalf("got %+v, %v", manifest, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, manifestFile+".tmp")); !os.IsNotExist(err) {
+		t.Fatalf("temporary manifest left: %v", err)
+	}
+}
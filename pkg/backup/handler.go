@@ -0,0 +1,87 @@
+// Package backup takes full and incremental badger backups from running
+// services and restores them.
+//
+// A service serves Handler on its admin address. rentalctl pulls the backup
+// stream over HTTP, so the database directory stays locked by the service and
+// writes continue while the backup runs. Each backup covers the versions after
+// Since up to and including Version; a chain starts with a full backup (Since 0)
+// and every incremental one continues from the previous Version. Despite the
+// DB.Backup doc, badger skips entries at exactly the since version.
+package backup
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// VersionTrailer carries the last version included in the backup. It is sent
+// as a trailer because it is only known once the stream is written.
+const VersionTrailer = "X-Backup-Version"
+
+// TokenHeader carries the admin token.
+const TokenHeader = "X-Admin-Token"
+
+// Handler streams db.Backup for GET /backup?since=<version>.
+func Handler(db *badger.DB, adminToken []byte, logger *zap.SugaredLogger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/backup", func(rw http.ResponseWriter, r *http.Request) {
+		logger.Infof("got request for backup")
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(TokenHeader)), adminToken) != 1 {
+			http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+			return
+		}
+
+		var since uint64
+		if s := r.URL.Query().Get("since"); s != "" {
+			var err error
+			since, err = strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				http.Error(rw, "bad since", 400)
+				return
+			}
+		}
+
+		rw.Header().Set("Trailer", VersionTrailer)
+		rw.Header().Set("Content-Type", "application/octet-stream")
+		version, err := db.Backup(rw, since)
+		if err != nil {
+			// The status is already sent; a missing trailer tells the client the stream is broken.
+			logger.Errorf("backup error: %v", err)
+			return
+		}
+		rw.Header().Set(VersionTrailer, fmt.Sprint(version))
+		logger.Infof("backup since %d done at version %d", since, version)
+	})
+	return mux
+}
+
+// Serve starts Handler on addr in the background. The admin token is read from
+// tokenPath; surrounding whitespace is ignored.
+func Serve(addr string, db *badger.DB, tokenPath string, logger *zap.SugaredLogger) (*http.Server, error) {
+	token, err := ioutil.ReadFile(tokenPath)
+	if err != nil {
+		return nil, err
+	}
+	token = bytes.TrimSpace(token)
+	if len(token) == 0 {
+		return nil, fmt.Errorf("admin token in %s is empty", tokenPath)
+	}
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: Handler(db, token, logger),
+	}
+	go func() {
+		err := srv.ListenAndServe()
+		if err != http.ErrServerClosed {
+			logger.Errorf("admin server error: %v", err)
+		}
+	}()
+	return srv, nil
+}
@@ -0,0 +1,96 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const manifestFile = "manifest.json"
+
+// Entry describes one backup file of a chain.
+type Entry struct {
+	File      string    `json:"file"`
+	Since     uint64    `json:"since"`
+	Version   uint64    `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+}
+
+func (c Entry) Full() bool {
+	return c.Since == 0
+}
+
+// Manifest lists the backups in a directory in the order they were taken.
+type Manifest struct {
+	Service string  `json:"service"`
+	Entries []Entry `json:"entries"`
+}
+
+var ErrNoBackup = errors.New("no backup at or before the requested time")
+
+func ReadManifest(dir string) (Manifest, error) {
+	manifest := Manifest{}
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(data, &manifest)
+	return manifest, err
+}
+
+// writeManifest replaces the manifest atomically so an interrupted backup
+// never leaves a half written one.
+func writeManifest(dir string, manifest Manifest) error {
+	data, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, manifestFile+".tmp")
+	err = ioutil.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, manifestFile))
+}
+
+// next returns the version the next incremental backup continues from.
+func (c Manifest) next() uint64 {
+	if len(c.Entries) == 0 {
+		return 0
+	}
+	return c.Entries[len(c.Entries)-1].Version
+}
+
+// Chain returns the backups to load to restore the state at the given time:
+// the last full backup taken at or before at and the incrementals after it.
+func (c Manifest) Chain(at time.Time) ([]Entry, error) {
+	start, end := -1, -1
+	for i, entry := range c.Entries {
+		if entry.CreatedAt.After(at) {
+			break
+		}
+		if entry.Full() {
+			start = i
+		}
+		end = i
+	}
+	if start == -1 {
+		return nil, ErrNoBackup
+	}
+	chain := c.Entries[start : end+1]
+	for i := 1; i < len(chain); i++ {
+		if chain[i].Since != chain[i-1].Version {
+			return nil, fmt.Errorf("backup chain broken at %s: since %d does not continue version %d", chain[i].File, chain[i].Since, chain[i-1].Version)
+		}
+	}
+	return chain, nil
+}
@@ -0,0 +1,304 @@
+// Package config loads service configuration from defaults, a YAML file,
+// environment variables and command line flags, in increasing precedence.
+//
+// A service describes its configuration as a struct whose initial value holds
+// the defaults. Every leaf field is reachable three ways, derived from its yaml
+// path: the file key (badger: {path: ...}), the environment variable
+// <SERVICE>_BADGER_PATH and the flag -badger-path. A `flag` tag overrides the
+// flag name, a `usage` tag documents the flag and fields tagged `secret:"true"`
+// are redacted by Redacted. Fields with yaml:"-" are flag only. A leading "~"
+// in fields whose key is path or ends in _path is expanded to the home
+// directory, whichever source set them.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const redacted = "[redacted]"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Validator is implemented by configs that check themselves after loading.
+type Validator interface {
+	Validate() error
+}
+
+type field struct {
+	value  reflect.Value
+	key    string
+	flag   string
+	env    string
+	usage  string
+	secret bool
+}
+
+// Load fills cfg, a pointer to a struct holding the defaults, and validates it.
+// The file comes from -config or <SERVICE>_CONFIG.
+func Load(cfg interface{}, service string, args []string) error {
+	root := reflect.ValueOf(cfg)
+	if root.Kind() != reflect.Ptr || root.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: %T is not a pointer to a struct", cfg)
+	}
+	envPrefix := strings.ToUpper(service) + "_"
+	fields := collect(root.Elem(), nil, envPrefix)
+
+	flags := flag.NewFlagSet(service, flag.ExitOnError)
+	configPath := flags.String("config", os.Getenv(envPrefix+"CONFIG"), "path to a YAML config file")
+	raw := map[string]*string{}
+	for _, f := range fields {
+		r := new(string)
+		raw[f.flag] = r
+		flags.Var(&flagValue{raw: r, def: format(f.value), isBool: f.value.Kind() == reflect.Bool}, f.flag, f.usage)
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *configPath != "" {
+		err = loadFile(cfg, *configPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		s, ok := os.LookupEnv(f.env)
+		if !ok {
+			continue
+		}
+		err = set(f.value, s)
+		if err != nil {
+			return fmt.Errorf("config: %s: %w", f.env, err)
+		}
+	}
+
+	for _, f := range fields {
+		if !isSet(flags, f.flag) {
+			continue
+		}
+		err = set(f.value, *raw[f.flag])
+		if err != nil {
+			return fmt.Errorf("config: -%s: %w", f.flag, err)
+		}
+	}
+
+	for _, f := range fields {
+		if f.value.Kind() == reflect.String && isPath(f.key) {
+			f.value.SetString(ExpandPath(f.value.String()))
+		}
+	}
+
+	if v, ok := cfg.(Validator); ok {
+		err = v.Validate()
+		if err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+	return nil
+}
+
+func loadFile(cfg interface{}, path string) error {
+	data, err := ioutil.ReadFile(ExpandPath(path))
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(cfg)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+func isPath(key string) bool {
+	parts := strings.Split(key, ".")
+	name := parts[len(parts)-1]
+	return name == "path" || strings.HasSuffix(name, "_path")
+}
+
+func isSet(flags *flag.FlagSet, name string) bool {
+	found := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// Redacted returns the effective configuration keyed like the YAML file, with
+// secrets replaced, for logging at startup.
+func Redacted(cfg interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, f := range collect(reflect.ValueOf(cfg).Elem(), nil, "") {
+		value := f.value.Interface()
+		if f.value.Type() == durationType {
+			value = format(f.value)
+		}
+		if f.secret && !f.value.IsZero() {
+			value = redacted
+		}
+		m := out
+		parts := strings.Split(f.key, ".")
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := m[part].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				m[part] = next
+			}
+			m = next
+		}
+		m[parts[len(parts)-1]] = value
+	}
+	return out
+}
+
+// ExpandPath replaces a leading "~" or "~/" with the home directory.
+func ExpandPath(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// ReadSecret returns value if set and the contents of path otherwise, so a
+// secret can come from the environment instead of a file.
+func ReadSecret(value string, path string) ([]byte, error) {
+	if value != "" {
+		return []byte(value), nil
+	}
+	return ioutil.ReadFile(ExpandPath(path))
+}
+
+func collect(v reflect.Value, path []string, envPrefix string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		fv := v.Field(i)
+
+		if name != "-" && fv.Kind() == reflect.Struct && fv.Type() != durationType {
+			fields = append(fields, collect(fv, append(append([]string{}, path...), name), envPrefix)...)
+			continue
+		}
+
+		f := field{
+			value:  fv,
+			flag:   sf.Tag.Get("flag"),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret") == "true",
+		}
+		if name == "-" {
+			if f.flag == "" {
+				continue
+			}
+			f.key = f.flag
+		} else {
+			keyPath := append(append([]string{}, path...), name)
+			f.key = strings.Join(keyPath, ".")
+			if f.flag == "" {
+				f.flag = strings.ReplaceAll(strings.Join(keyPath, "-"), "_", "-")
+			}
+			if envPrefix != "" {
+				f.env = envPrefix + strings.ToUpper(strings.Join(keyPath, "_"))
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func set(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	default:
+		return errors.New("unsupported config type " + v.Type().String())
+	}
+	return nil
+}
+
+func format(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// flagValue keeps the raw flag so it can be applied after the file and env.
+type flagValue struct {
+	raw    *string
+	def    string
+	isBool bool
+}
+
+func (c *flagValue) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.def
+}
+
+func (c *flagValue) Set(s string) error {
+	*c.raw = s
+	return nil
+}
+
+func (c *flagValue) IsBoolFlag() bool {
+	return c.isBool
+}
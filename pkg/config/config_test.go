@@ -0,0 +1,238 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	HTTP      HTTP    `yaml:"http"`
+	Storage   Storage `yaml:"storage"`
+	Badger    Badger  `yaml:"badger"`
+	Admin     Admin   `yaml:"admin"`
+	TLS       TLS     `yaml:"tls"`
+	Secret    string  `yaml:"secret" secret:"true"`
+	Name      string  `yaml:"name"`
+	DryRun    bool    `yaml:"-" flag:"dry-run"`
+	invalid   error
+	validated bool
+}
+
+func (c *testConfig) Validate() error {
+	c.validated = true
+	if c.invalid != nil {
+		return c.invalid
+	}
+	for _, v := range []Validator{c.HTTP, c.Storage, c.Badger, c.TLS} {
+		err := v.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func defaultTestConfig() *testConfig {
+	return &testConfig{
+		HTTP:    DefaultHTTP("localhost:3000"),
+		Storage: Storage{Backend: "badger", SQLitePath: "/var/test.sqlite"},
+		Badger:  DefaultBadger("/var/test_db"),
+		Admin:   DefaultAdmin(),
+		Name:    "default",
+	}
+}
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(data), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, "name: file\nhttp:\n  addr: file:1\n  read_timeout: 1s\n  write_timeout: 2s\nstorage:\n  backend: memory\n")
+	t.Setenv("TEST_CONFIG", path)
+	t.Setenv("TEST_HTTP_ADDR", "env:1")
+	t.Setenv("TEST_HTTP_READ_TIMEOUT", "3s")
+
+	cfg := defaultTestConfig()
+	err := Load(cfg, "test", []string{"-addr", "flag:1", "-dry-run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"default", cfg.HTTP.ShutdownTimeout, 10 * time.Second},
+		{"file over default", cfg.Name, "file"},
+		{"file over default", cfg.Storage.Backend, "memory"},
+		{"file over default", cfg.HTTP.WriteTimeout, 2 * time.Second},
+		{"env over file", cfg.HTTP.ReadTimeout, 3 * time.Second},
+		{"flag over env", cfg.HTTP.Addr, "flag:1"},
+		{"flag only", cfg.DryRun, true},
+	} {
+		if test.got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+	if !cfg.validated {
+		t.Fatal("the config was not validated")
+	}
+
+	// -config takes precedence over <SERVICE>_CONFIG.
+	other := writeConfig(t, "name: other\n")
+	cfg = defaultTestConfig()
+	err = Load(cfg, "test", []string{"-config", other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "other" || cfg.HTTP.Addr != "env:1" {
+		t.Fatalf("got name %q and addr %q", cfg.Name, cfg.HTTP.Addr)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	invalid := errors.New("invalid")
+	for name, test := range map[string]struct {
+		file string
+		env  map[string]string
+		args []string
+		cfg  func(*testConfig)
+		want string
+	}{
+		"unknown file key":    {file: "nmae: typo\n", want: "field nmae not found"},
+		"bad file value":      {file: "http:\n  read_timeout: soon\n", want: "config.yaml"},
+		"bad env value":       {env: map[string]string{"TEST_HTTP_READ_TIMEOUT": "soon"}, want: "TEST_HTTP_READ_TIMEOUT"},
+		"bad flag value":      {args: []string{"-http-read-timeout", "soon"}, want: "-http-read-timeout"},
+		"missing file":        {args: []string{"-config", "/nonexistent/config.yaml"}, want: "no such file"},
+		"validator":           {cfg: func(c *testConfig) { c.invalid = invalid }, want: "invalid"},
+		"empty addr":          {args: []string{"-addr", ""}, want: "http.addr is required"},
+		"negative timeout":    {args: []string{"-http-write-timeout", "-1s"}, want: "must not be negative"},
+		"unknown storage":     {args: []string{"-storage", "tape"}, want: `unknown storage "tape"`},
+		"sqlite without path": {args: []string{"-storage", "sqlite", "-sqlite-path", ""}, want: "storage.sqlite_path is required"},
+		"badger without path": {args: []string{"-badger-path", ""}, want: "badger.path is required"},
+		"bad badger key":      {env: map[string]string{"TEST_BADGER_ENCRYPTION_KEY": "abc"}, want: "badger encryption key"},
+		"no versions":         {args: []string{"-badger-num-versions-to-keep", "0"}, want: "num_versions_to_keep"},
+		"tls without key":     {args: []string{"-tls-cert-path", "/etc/cert.pem"}, want: "tls.key_path is required"},
+		"ca without cert":     {args: []string{"-tls-ca-path", "/etc/ca.pem"}, want: "tls.ca_path needs tls.cert_path"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			args := test.args
+			if test.file != "" {
+				args = append([]string{"-config", writeConfig(t, test.file)}, args...)
+			}
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			cfg := defaultTestConfig()
+			if test.cfg != nil {
+				test.cfg(cfg)
+			}
+			err := Load(cfg, "test", args)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadExpandsPaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("TEST_ADMIN_TOKEN_PATH", "~/admin-token")
+	path := writeConfig(t, "storage:\n  sqlite_path: ~/test.sqlite\nbadger:\n  path: \"~\"\nname: ~/name\n")
+
+	cfg := defaultTestConfig()
+	err := Load(cfg, "test", []string{"-config", path, "-tls-cert-path", "~/cert.pem", "-tls-key-path", "~/key.pem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		got  string
+		want string
+	}{
+		{cfg.Storage.SQLitePath, filepath.Join(home, "test.sqlite")},
+		{cfg.Badger.Path, home},
+		{cfg.Admin.TokenPath, filepath.Join(home, "admin-token")},
+		{cfg.TLS.CertPath, filepath.Join(home, "cert.pem")},
+		{cfg.TLS.KeyPath, filepath.Join(home, "key.pem")},
+		// Only paths are expanded.
+		{cfg.Name, "~/name"},
+	} {
+		if test.got != test.want {
+			t.Errorf("got %q, want %q", test.got, test.want)
+		}
+	}
+
+	for path, want := range map[string]string{
+		"~":          home,
+		"~/a/b":      filepath.Join(home, "a/b"),
+		"~other/a":   "~other/a",
+		"/var/a":     "/var/a",
+		"relative/~": "relative/~",
+		"":           "",
+	} {
+		if got := ExpandPath(path); got != want {
+			t.Errorf("ExpandPath(%q): got %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.Secret = "hunter2"
+	cfg.Badger.EncryptionKey = strings.Repeat("ab", 16)
+	out := Redacted(cfg)
+
+	if out["secret"] != redacted {
+		t.Errorf("got secret %v", out["secret"])
+	}
+	badger := out["badger"].(map[string]interface{})
+	if badger["encryption_key"] != redacted {
+		t.Errorf("got badger.encryption_key %v", badger["encryption_key"])
+	}
+	if badger["path"] != "/var/test_db" {
+		t.Errorf("got badger.path %v", badger["path"])
+	}
+	http := out["http"].(map[string]interface{})
+	if http["read_timeout"] != "10s" {
+		t.Errorf("got http.read_timeout %v, want 10s", http["read_timeout"])
+	}
+	if out["dry-run"] != false {
+		t.Errorf("got dry-run %v", out["dry-run"])
+	}
+
+	// An unset secret is shown as empty rather than hiding that it is unset.
+	cfg.Secret = ""
+	if got := Redacted(cfg)["secret"]; got != "" {
+		t.Errorf("got unset secret %v", got)
+	}
+	for _, value := range []string{"hunter2", cfg.Badger.EncryptionKey} {
+		if strings.Contains(strings.Join(flatten(Redacted(cfg)), " "), value) {
+			t.Errorf("%s leaked into the redacted config", value)
+		}
+	}
+}
+
+func flatten(m map[string]interface{}) []string {
+	var values []string
+	for _, value := range m {
+		if nested, ok := value.(map[string]interface{}); ok {
+			values = append(values, flatten(nested)...)
+			continue
+		}
+		if s, ok := value.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
@@ -0,0 +1,334 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"distributed-rental/pkg/encryption"
+	"distributed-rental/pkg/ratelimit"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io/ioutil"
+	"time"
+)
+
+// HTTP configures a service's listener.
+type HTTP struct {
+	Addr            string        `yaml:"addr" flag:"addr" usage:"addr to listen on"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" usage:"max time to read a request"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" usage:"max time to write a response"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" usage:"max time to keep an idle connection"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" usage:"max time to finish requests on shutdown"`
+}
+
+func DefaultHTTP(addr string) HTTP {
+	return HTTP{
+		Addr:            addr,
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		IdleTimeout:     2 * time.Minute,
+		ShutdownTimeout: 10 * time.Second,
+	}
+}
+
+func (c HTTP) Validate() error {
+	if c.Addr == "" {
+		return errors.New("http.addr is required")
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.ShutdownTimeout < 0 {
+		return errors.New("http timeouts must not be negative")
+	}
+	return nil
+}
+
+// GRPC configures the gRPC listener a service runs next to its HTTP one. It
+// shares the TLS settings and rate limits of the HTTP listener.
+type GRPC struct {
+	Addr          string        `yaml:"addr" flag:"grpc-addr" usage:"addr to serve the gRPC API on, empty disables it"`
+	WatchInterval time.Duration `yaml:"watch_interval" usage:"how often availability streams check a car for changes made through other instances"`
+}
+
+func DefaultGRPC(addr string) GRPC {
+	return GRPC{
+		Addr:          addr,
+		WatchInterval: 30 * time.Second,
+	}
+}
+
+func (c GRPC) Validate() error {
+	if c.Addr != "" && c.WatchInterval <= 0 {
+		return errors.New("grpc.watch_interval must be positive")
+	}
+	return nil
+}
+
+// Badger configures the badger database.
+type Badger struct {
+	Path              string `yaml:"path" usage:"badger directory"`
+	InMemory          bool   `yaml:"in_memory" usage:"keep the badger database in memory only"`
+	SyncWrites        bool   `yaml:"sync_writes" usage:"fsync every badger write"`
+	NumVersionsToKeep int    `yaml:"num_versions_to_keep" usage:"badger versions kept per key"`
+	ValueLogFileSize  int64  `yaml:"value_log_file_size" usage:"badger value log file size in bytes"`
+	// EncryptionKey is a hex AES key, meant for the environment; it takes
+	// precedence over EncryptionKeyPath. Without either the data is stored in
+	// plaintext.
+	EncryptionKey         string        `yaml:"encryption_key" secret:"true" usage:"hex AES-128/192/256 key encrypting the badger database"`
+	EncryptionKeyPath     string        `yaml:"encryption_key_path" usage:"file with the hex AES key encrypting the badger database, or raw: and the raw key"`
+	EncryptionKeyRotation time.Duration `yaml:"encryption_key_rotation" usage:"how often badger rotates the data keys under the encryption key"`
+	// SequenceBandwidth is how many ids a badger sequence leases at once.
+	// The unused rest of a lease is lost if the process dies.
+	SequenceBandwidth uint64 `yaml:"sequence_bandwidth" usage:"ids leased at once by badger id sequences"`
+}
+
+func DefaultBadger(path string) Badger {
+	options := badger.DefaultOptions(path)
+	return Badger{
+		Path:                  path,
+		SyncWrites:            options.SyncWrites,
+		NumVersionsToKeep:     options.NumVersionsToKeep,
+		ValueLogFileSize:      options.ValueLogFileSize,
+		EncryptionKeyRotation: options.EncryptionKeyRotationDuration,
+		SequenceBandwidth:     100_000,
+	}
+}
+
+func (c Badger) Validate() error {
+	if c.Path == "" && !c.InMemory {
+		return errors.New("badger.path is required unless badger.in_memory is set")
+	}
+	if c.NumVersionsToKeep < 1 {
+		return errors.New("badger.num_versions_to_keep must be at least 1")
+	}
+	if c.ValueLogFileSize < 1<<20 || c.ValueLogFileSize >= 2<<30 {
+		return errors.New("badger.value_log_file_size must be at least 1MB and below 2GB")
+	}
+	if c.EncryptionKeyRotation <= 0 {
+		return errors.New("badger.encryption_key_rotation must be positive")
+	}
+	_, err := c.key()
+	if err != nil {
+		return fmt.Errorf("badger encryption key: %w", err)
+	}
+	if c.SequenceBandwidth == 0 {
+		return errors.New("badger.sequence_bandwidth must be positive")
+	}
+	return nil
+}
+
+func (c Badger) key() ([]byte, error) {
+	return encryption.LoadKey(c.EncryptionKey, ExpandPath(c.EncryptionKeyPath))
+}
+
+func (c Badger) Options() (badger.Options, error) {
+	key, err := c.key()
+	if err != nil {
+		return badger.Options{}, err
+	}
+	path := ExpandPath(c.Path)
+	if c.InMemory {
+		path = ""
+	}
+	options := badger.DefaultOptions(path).
+		WithInMemory(c.InMemory).
+		WithSyncWrites(c.SyncWrites).
+		WithNumVersionsToKeep(c.NumVersionsToKeep).
+		WithValueLogFileSize(c.ValueLogFileSize).
+		WithEncryptionKeyRotationDuration(c.EncryptionKeyRotation)
+	return encryption.Options(options, key), nil
+}
+
+func (c Badger) Open() (*badger.DB, error) {
+	options, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+	return badger.Open(options)
+}
+
+// Log configures the service logger.
+type Log struct {
+	Level string `yaml:"level" usage:"log level: debug, info, warn or error"`
+}
+
+func DefaultLog() Log {
+	return Log{Level: "info"}
+}
+
+func (c Log) level() (zapcore.Level, error) {
+	var level zapcore.Level
+	err := level.UnmarshalText([]byte(c.Level))
+	return level, err
+}
+
+func (c Log) Validate() error {
+	_, err := c.level()
+	if err != nil {
+		return fmt.Errorf("log.level: %w", err)
+	}
+	return nil
+}
+
+func (c Log) Logger() (*zap.Logger, error) {
+	level, err := c.level()
+	if err != nil {
+		return nil, err
+	}
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Level = zap.NewAtomicLevelAt(level)
+	return zapConfig.Build()
+}
+
+// Admin configures the backup address used by rentalctl.
+type Admin struct {
+	Addr      string `yaml:"addr" usage:"addr for backups with rentalctl, empty disables it"`
+	TokenPath string `yaml:"token_path" usage:"path to the admin token required by the admin addr"`
+}
+
+func DefaultAdmin() Admin {
+	return Admin{TokenPath: "/etc/admin-token"}
+}
+
+// TLS serves a service over HTTPS and makes its calls to other services with
+// its certificate. With CAPath set peers must present certificates signed by
+// that CA: servers ask callers for one (mutual TLS) and internal endpoints
+// require it. rentalctl gen-ca and gen-cert create a local CA and the service
+// certificates.
+type TLS struct {
+	CertPath string `yaml:"cert_path" usage:"certificate of the service, used as server and client certificate, empty disables TLS"`
+	KeyPath  string `yaml:"key_path" usage:"private key of the certificate"`
+	CAPath   string `yaml:"ca_path" usage:"CA that certificates of other services must be signed by, enables mutual TLS"`
+}
+
+func (c TLS) Validate() error {
+	if c.CertPath != "" && c.KeyPath == "" {
+		return errors.New("tls.key_path is required with tls.cert_path")
+	}
+	if c.CAPath != "" && c.CertPath == "" {
+		return errors.New("tls.ca_path needs tls.cert_path")
+	}
+	return nil
+}
+
+// Mutual reports whether peers must present certificates signed by the CA.
+func (c TLS) Mutual() bool {
+	return c.CAPath != ""
+}
+
+func (c TLS) certificate() (tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(ExpandPath(c.CertPath), ExpandPath(c.KeyPath))
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	if c.CAPath == "" {
+		return cert, nil, nil
+	}
+	caPEM, err := ioutil.ReadFile(ExpandPath(c.CAPath))
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return tls.Certificate{}, nil, fmt.Errorf("no certificates in %s", c.CAPath)
+	}
+	return cert, pool, nil
+}
+
+// ServerConfig is nil when TLS is disabled. Client certificates are verified
+// when given, so that users without one can still call the public endpoints.
+func (c TLS) ServerConfig() (*tls.Config, error) {
+	if c.CertPath == "" {
+		return nil, nil
+	}
+	cert, pool, err := c.certificate()
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if pool != nil {
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// ClientConfig is nil when TLS is disabled. Servers are verified against the
+// CA, or the system roots without one.
+func (c TLS) ClientConfig() (*tls.Config, error) {
+	if c.CertPath == "" {
+		return nil, nil
+	}
+	cert, pool, err := c.certificate()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool, MinVersion: tls.VersionTLS12}, nil
+}
+
+// Storage selects the repository backend of a service.
+type Storage struct {
+	Backend    string `yaml:"backend" flag:"storage" usage:"storage backend: badger, sqlite or memory"`
+	SQLitePath string `yaml:"sqlite_path" flag:"sqlite-path" usage:"database file for the sqlite storage"`
+}
+
+func (c Storage) Validate() error {
+	switch c.Backend {
+	case "badger", "memory":
+	case "sqlite":
+		if c.SQLitePath == "" {
+			return errors.New("storage.sqlite_path is required for the sqlite storage")
+		}
+	default:
+		return fmt.Errorf("unknown storage %q", c.Backend)
+	}
+	return nil
+}
+
+// CheckBadger fails if b sets an encryption key while the storage is not
+// badger, where the key would be silently ignored.
+func (c Storage) CheckBadger(b Badger) error {
+	if c.Backend != "badger" && (b.EncryptionKey != "" || b.EncryptionKeyPath != "") {
+		return fmt.Errorf("badger encryption key is set but storage.backend is %q; only badger storage is encrypted", c.Backend)
+	}
+	return nil
+}
+
+// RateLimit configures the per route request limits of a service.
+type RateLimit struct {
+	Routes     string `yaml:"routes" usage:"comma separated <route>=<count>/<s|m|h|d>[:<burst>] limits, * for other routes"`
+	Store      string `yaml:"store" usage:"rate limit store: memory or sqlite, shared by instances opening the same file"`
+	SQLitePath string `yaml:"sqlite_path" usage:"database file of the sqlite rate limit store"`
+}
+
+func (c RateLimit) Validate() error {
+	_, err := ratelimit.ParseRules(c.Routes)
+	if err != nil {
+		return fmt.Errorf("rate_limit.routes: %w", err)
+	}
+	switch c.Store {
+	case "memory":
+	case "sqlite":
+		if c.SQLitePath == "" {
+			return errors.New("rate_limit.sqlite_path is required for the sqlite store")
+		}
+	default:
+		return fmt.Errorf("unknown rate limit store %q", c.Store)
+	}
+	return nil
+}
+
+func (c RateLimit) Limiter(logger *zap.SugaredLogger) (*ratelimit.Limiter, error) {
+	rules, err := ratelimit.ParseRules(c.Routes)
+	if err != nil {
+		return nil, err
+	}
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if c.Store == "sqlite" {
+		store, err = ratelimit.NewSQLStore(ExpandPath(c.SQLitePath))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ratelimit.New(rules, store, logger), nil
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStorageCheckBadger(t *testing.T) {
+	key := strings.Repeat("ab", 16)
+	for name, test := range map[string]struct {
+		storage Storage
+		badger  Badger
+		valid   bool
+	}{
+		"badger with key":      {Storage{Backend: "badger"}, Badger{EncryptionKey: key}, true},
+		"badger with key path": {Storage{Backend: "badger"}, Badger{EncryptionKeyPath: "/etc/key"}, true},
+		"sqlite without key":   {Storage{Backend: "sqlite"}, Badger{}, true},
+		"sqlite with key":      {Storage{Backend: "sqlite"}, Badger{EncryptionKey: key}, false},
+		"sqlite with key path": {Storage{Backend: "sqlite"}, Badger{EncryptionKeyPath: "/etc/key"}, false},
+		"memory with key":      {Storage{Backend: "memory"}, Badger{EncryptionKey: key}, false},
+	} {
+		err := test.storage.CheckBadger(test.badger)
+		if test.valid != (err == nil) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package eligibility decides whether a renter may drive a car of a given
+// class, as required by the insurer.
+//
+// Rules map car classes to what they ask of a driver and are written as
+// "<class>=<min age>[:verified]":
+//
+//	*=21,premium=25:verified
+//
+// where "*" applies to every class without its own rule. Every rule wants a
+// driver's license that is not rejected and does not expire before the rental
+// ends; ":verified" also wants the license checked by staff. Ages are counted
+// on the day the rental starts, and all dates are UTC days like the rental
+// minutes.
+package eligibility
+
+import (
+	"distributed-rental/pkg/interval"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AnyClass is the rule for car classes without a rule of their own.
+const AnyClass = "*"
+
+// DateLayout is how dates of birth and license expiry dates are written.
+const DateLayout = "2006-01-02"
+
+// License verification statuses.
+const (
+	StatusUnverified = "unverified"
+	StatusVerified   = "verified"
+	StatusRejected   = "rejected"
+)
+
+var ErrInvalidRule = errors.New("invalid eligibility rule")
+
+// Rule is what a car class asks of its drivers.
+type Rule struct {
+	MinAge   int
+	Verified bool
+}
+
+// Rules maps car classes to their rules.
+type Rules map[string]Rule
+
+// ParseRules parses comma separated "<class>=<min age>[:verified]" pairs. An
+// empty string means no rules.
+func ParseRules(s string) (Rules, error) {
+	rules := Rules{}
+	for _, rule := range strings.Split(s, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		class, spec, ok := strings.Cut(rule, "=")
+		class = strings.TrimSpace(class)
+		if !ok || class == "" {
+			return nil, fmt.Errorf("%w %q: want <class>=<min age>[:verified]", ErrInvalidRule, rule)
+		}
+		ageSpec, option, hasOption := strings.Cut(strings.TrimSpace(spec), ":")
+		minAge, err := strconv.ParseUint(ageSpec, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: min age must be a number of years", ErrInvalidRule, rule)
+		}
+		if hasOption && option != "verified" {
+			return nil, fmt.Errorf("%w %q: the only option is verified", ErrInvalidRule, rule)
+		}
+		rules[class] = Rule{MinAge: int(minAge), Verified: hasOption}
+	}
+	return rules, nil
+}
+
+// License is a driver's license as recorded by the auth service.
+type License struct {
+	Number    string `json:"number"`
+	Country   string `json:"country"`
+	ExpiresOn string `json:"expires_on"`
+	Status    string `json:"status"`
+}
+
+// Driver is what the rules look at.
+type Driver struct {
+	DateOfBirth string  `json:"date_of_birth"`
+	License     License `json:"license"`
+}
+
+// Ineligible explains why a driver may not rent a car.
+type Ineligible struct {
+	Reason string
+}
+
+func (c *Ineligible) Error() string {
+	return "driver is not eligible: " + c.Reason
+}
+
+// Check returns *Ineligible if driver may not rent a car of class for span.
+// Classes without a rule, and without a "*" rule, accept every driver.
+func (c Rules) Check(class string, driver Driver, span interval.Interval) error {
+	rule, ok := c[class]
+	if !ok {
+		rule, ok = c[AnyClass]
+	}
+	if !ok {
+		return nil
+	}
+
+	start := dayTime(span.FromDay())
+	dateOfBirth, err := time.Parse(DateLayout, driver.DateOfBirth)
+	if err != nil {
+		return &Ineligible{"date of birth is not on record"}
+	}
+	if age(dateOfBirth, start) < rule.MinAge {
+		return &Ineligible{fmt.Sprintf("drivers of %s cars must be at least %d years old", class, rule.MinAge)}
+	}
+
+	license := driver.License
+	if license.Number == "" {
+		return &Ineligible{"driver's license is not on record"}
+	}
+	if license.Status == StatusRejected {
+		return &Ineligible{"driver's license was rejected"}
+	}
+	if rule.Verified && license.Status != StatusVerified {
+		return &Ineligible{fmt.Sprintf("%s cars require a verified driver's license", class)}
+	}
+	expiresOn, err := time.Parse(DateLayout, license.ExpiresOn)
+	if err != nil {
+		return &Ineligible{"driver's license expiry date is not on record"}
+	}
+	if expiresOn.Before(dayTime(span.ToDay())) {
+		return &Ineligible{"driver's license expires before the rental ends"}
+	}
+	return nil
+}
+
+func dayTime(day uint64) time.Time {
+	return time.Unix(int64(day)*24*60*60, 0).UTC()
+}
+
+// age returns the full years between dateOfBirth and day.
+func age(dateOfBirth time.Time, day time.Time) int {
+	years := day.Year() - dateOfBirth.Year()
+	if day.Month() < dateOfBirth.Month() || day.Month() == dateOfBirth.Month() && day.Day() < dateOfBirth.Day() {
+		years--
+	}
+	return years
+}
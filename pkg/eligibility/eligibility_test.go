@@ -0,0 +1,117 @@
+package eligibility
+
+import (
+	"distributed-rental/pkg/interval"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(" *=21 , premium=25:verified,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[AnyClass] != (Rule{MinAge: 21}) || rules["premium"] != (Rule{MinAge: 25, Verified: true}) {
+		t.Fatalf("got %+v", rules)
+	}
+	rules, err = ParseRules("")
+	if err != nil || len(rules) != 0 {
+		t.Fatalf("empty rules: got %+v, %v", rules, err)
+	}
+	for _, s := range []string{"premium", "=21", "premium=old", "premium=-1", "premium=300", "premium=25:checked"} {
+		_, err := ParseRules(s)
+		if !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("%q: got %v, want %v", s, err, ErrInvalidRule)
+		}
+	}
+}
+
+// rental is the span from the start of the day of from to the end of the day
+// of to, both YYYY-MM-DD.
+func rental(t *testing.T, from string, to string) interval.Interval {
+	t.Helper()
+	start, err := time.Parse(DateLayout, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := time.Parse(DateLayout, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return interval.Interval{From: uint64(start.Unix() / 60), To: uint64(end.Unix()/60) + 24*60 - 1}
+}
+
+func TestCheck(t *testing.T) {
+	rules := Rules{AnyClass: {MinAge: 21}, "premium": {MinAge: 25, Verified: true}}
+	license := License{Number: "77 12 345678", Country: "RU", ExpiresOn: "2026-06-10", Status: StatusUnverified}
+	driver := Driver{DateOfBirth: "2005-06-01", License: license}
+	span := rental(t, "2026-06-01", "2026-06-10")
+
+	for _, test := range []struct {
+		name   string
+		class  string
+		change func(driver *Driver)
+		valid  bool
+	}{
+		{name: "eligible", class: "economy", valid: true},
+		{name: "21st birthday on the first day", class: "economy", valid: true},
+		{name: "21st birthday on the second day", class: "economy", change: func(driver *Driver) { driver.DateOfBirth = "2005-06-02" }},
+		{name: "no date of birth", class: "economy", change: func(driver *Driver) { driver.DateOfBirth = "" }},
+		{name: "no license", class: "economy", change: func(driver *Driver) { driver.License = License{} }},
+		{name: "rejected license", class: "economy", change: func(driver *Driver) { driver.License.Status = StatusRejected }},
+		{name: "license expiring on the last day", class: "economy", valid: true},
+		{name: "license expiring before the last day", class: "economy", change: func(driver *Driver) { driver.License.ExpiresOn = "2026-06-09" }},
+		{name: "license expired before the rental", class: "economy", change: func(driver *Driver) { driver.License.ExpiresOn = "2025-01-01" }},
+		{name: "no license expiry", class: "economy", change: func(driver *Driver) { driver.License.ExpiresOn = "" }},
+		{name: "premium too young", class: "premium", change: func(driver *Driver) { driver.License.Status = StatusVerified }},
+		{name: "premium unverified", class: "premium", change: func(driver *Driver) { driver.DateOfBirth = "1990-01-01" }},
+		{name: "premium", class: "premium", change: func(driver *Driver) { driver.DateOfBirth = "1990-01-01"; driver.License.Status = StatusVerified }, valid: true},
+	} {
+		driver := driver
+		if test.change != nil {
+			test.change(&driver)
+		}
+		err := rules.Check(test.class, driver, span)
+		if test.valid != (err == nil) {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+		if _, ok := err.(*Ineligible); err != nil && !ok {
+			t.Errorf("%s: got %T, want *Ineligible", test.name, err)
+		}
+	}
+
+	// Without a rule for the class nor a "*" rule every driver is eligible.
+	err := Rules{"premium": {MinAge: 25}}.Check("economy", Driver{}, span)
+	if err != nil {
+		t.Fatalf("class without a rule: got %v", err)
+	}
+	err = Rules{}.Check("premium", Driver{}, span)
+	if err != nil {
+		t.Fatalf("no rules: got %v", err)
+	}
+}
+
+func TestAge(t *testing.T) {
+	day := func(s string) time.Time {
+		date, err := time.Parse(DateLayout, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return date
+	}
+	for _, test := range []struct {
+		dateOfBirth, day string
+		age              int
+	}{
+		{"2000-03-15", "2021-03-14", 20},
+		{"2000-03-15", "2021-03-15", 21},
+		{"2000-03-15", "2021-02-20", 20},
+		{"2000-02-29", "2021-02-28", 20},
+		{"2000-02-29", "2021-03-01", 21},
+	} {
+		if got := age(day(test.dateOfBirth), day(test.day)); got != test.age {
+			t.Errorf("age(%s, %s) = %d, want %d", test.dateOfBirth, test.day, got, test.age)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package encryption manages the AES master keys of encrypted badger databases.
+//
+// Badger encrypts data with data keys that it rotates by itself every
+// EncryptionKeyRotationDuration. The data keys live in the key registry, which
+// is encrypted with the master key configured by the service. Rotating the
+// master key therefore only rewrites the key registry; Reencrypt rewrites the
+// whole database, which is how an unencrypted database gets encrypted.
+package encryption
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// IndexCacheSize is used for encrypted databases that set no index cache,
+// since without one badger decrypts table indexes on every read.
+const IndexCacheSize = 100 << 20
+
+// RawPrefix starts a key given as raw bytes instead of hex.
+const RawPrefix = "raw:"
+
+var ErrInvalidKey = errors.New(`encryption key must be 32, 48 or 64 hex characters, or "raw:" followed by 16, 24 or 32 bytes`)
+
+// ParseKey accepts the hex encoding of an AES-128/192/256 key, ignoring
+// surrounding whitespace, or RawPrefix followed by the raw key. There is no
+// guessing between the two, so raw bytes that happen to be hex digits are not
+// taken for a shorter hex key.
+func ParseKey(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, []byte(RawPrefix)) {
+		key := append([]byte{}, data[len(RawPrefix):]...)
+		if !validLength(len(key)) {
+			return nil, ErrInvalidKey
+		}
+		return key, nil
+	}
+	trimmed := bytes.TrimSpace(data)
+	key := make([]byte, hex.DecodedLen(len(trimmed)))
+	_, err := hex.Decode(key, trimmed)
+	if err != nil || !validLength(len(key)) {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// LoadKey returns the key in value if set, the key in the file at path
+// otherwise, or nil if neither is set and the database is unencrypted.
+func LoadKey(value string, path string) ([]byte, error) {
+	if value != "" {
+		return ParseKey([]byte(value))
+	}
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// RotateKey re-encrypts the key registry of the database in dir with newKey.
+// The service must be stopped. Either key may be nil for an unencrypted
+// registry, but data written without a key stays unencrypted; use Reencrypt
+// for that.
+func RotateKey(dir string, oldKey, newKey []byte) error {
+	registry, err := badger.OpenKeyRegistry(badger.KeyRegistryOptions{
+		Dir:           dir,
+		ReadOnly:      true,
+		EncryptionKey: oldKey,
+	})
+	if err != nil {
+		return fmt.Errorf("open key registry: %w", err)
+	}
+	defer registry.Close()
+
+	return badger.WriteKeyRegistry(registry, badger.KeyRegistryOptions{
+		Dir:           dir,
+		EncryptionKey: newKey,
+	})
+}
+
+// Reencrypt copies the database in src into the empty directory dst,
+// decrypting with srcKey and encrypting with dstKey. Either may be nil. The
+// service using src must be stopped.
+func Reencrypt(src, dst string, srcKey, dstKey []byte) error {
+	files, err := ioutil.ReadDir(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(files) > 0 {
+		return fmt.Errorf("target %s is not empty", dst)
+	}
+
+	from, err := badger.Open(Options(badger.DefaultOptions(src), srcKey).WithLogger(nil))
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+	to, err := badger.Open(Options(badger.DefaultOptions(dst), dstKey).WithLogger(nil))
+	if err != nil {
+		return err
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		_, err := from.Backup(w, 0)
+		w.CloseWithError(err)
+	}()
+	err = to.Load(r, 256)
+	r.CloseWithError(err)
+	closeErr := to.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Options sets key on opt, together with an index cache if opt has none.
+func Options(opt badger.Options, key []byte) badger.Options {
+	if len(key) == 0 {
+		return opt
+	}
+	opt = opt.WithEncryptionKey(key)
+	if opt.IndexCacheSize == 0 {
+		opt = opt.WithIndexCacheSize(IndexCacheSize)
+	}
+	return opt
+}
+
+func validLength(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
@@ -0,0 +1,191 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"github.com/dgraph-io/badger/v3"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	// A raw 32 byte key made of hex digits only, which used to be read as a
+	// 16 byte hex key.
+	hexDigits := "0123456789abcdef0123456789abcdef"
+
+	for name, test := range map[string]struct {
+		data string
+		key  string
+	}{
+		"hex 16":             {data: hexDigits, key: "\x01\x23\x45\x67\x89\xab\xcd\xef\x01\x23\x45\x67\x89\xab\xcd\xef"},
+		"hex 24":             {data: strings.Repeat("ab", 24), key: strings.Repeat("\xab", 24)},
+		"hex 32 newline":     {data: strings.Repeat("AB", 32) + "\n", key: strings.Repeat("\xab", 32)},
+		"raw 16":             {data: RawPrefix + "sixteen byte key", key: "sixteen byte key"},
+		"raw 32 hex chars":   {data: RawPrefix + hexDigits, key: hexDigits},
+		"raw keeps spaces":   {data: RawPrefix + " twenty four byte key   ", key: " twenty four byte key   "},
+		"hex 8":              {data: "0123456789abcdef"},
+		"hex 20":             {data: strings.Repeat("ab", 20)},
+		"odd hex":            {data: hexDigits + "a"},
+		"raw without prefix": {data: "sixteen byte key"},
+		"raw 15":             {data: RawPrefix + "fifteen byte ke"},
+		"raw newline":        {data: RawPrefix + "sixteen byte key\n"},
+		"empty":              {data: ""},
+	} {
+		key, err := ParseKey([]byte(test.data))
+		if test.key == "" {
+			if err != ErrInvalidKey {
+				t.Errorf("%s: got %x, %v, want %v", name, key, err, ErrInvalidKey)
+			}
+			continue
+		}
+		if err != nil || string(key) != test.key {
+			t.Errorf("%s: got %x, %v, want %x", name, key, err, test.key)
+		}
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	err := os.WriteFile(path, []byte(RawPrefix+"key from file 16"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := LoadKey("", "")
+	if key != nil || err != nil {
+		t.Fatalf("no key: got %x, %v", key, err)
+	}
+	key, err = LoadKey("", path)
+	if err != nil || string(key) != "key from file 16" {
+		t.Fatalf("file: got %q, %v", key, err)
+	}
+	// The value takes precedence over the file.
+	key, err = LoadKey(strings.Repeat("ab", 16), path)
+	if err != nil || !bytes.Equal(key, bytes.Repeat([]byte{0xab}, 16)) {
+		t.Fatalf("value: got %x, %v", key, err)
+	}
+
+	_, err = LoadKey("", filepath.Join(t.TempDir(), "missing"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing file: got %v", err)
+	}
+	err = os.WriteFile(path, []byte("not a key"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadKey("", path)
+	if !errors.Is(err, ErrInvalidKey) || !strings.Contains(err.Error(), path) {
+		t.Fatalf("invalid file: got %v", err)
+	}
+}
+
+func open(dir string, key []byte) (*badger.DB, error) {
+	return badger.Open(Options(badger.DefaultOptions(dir), key).WithLogger(nil))
+}
+
+func write(t *testing.T, dir string, key []byte, records map[string]string) {
+	t.Helper()
+	db, err := open(dir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *badger.Txn) error {
+		for k, v := range records {
+			err := tx.Set([]byte(k), []byte(v))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read returns the records of the database in dir opened with key.
+func read(dir string, key []byte) (map[string]string, error) {
+	db, err := open(dir, key)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	records := map[string]string{}
+	err = db.View(func(tx *badger.Txn) error {
+		it := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			records[string(it.Item().Key())] = string(value)
+		}
+		return nil
+	})
+	return records, err
+}
+
+func expectRecords(t *testing.T, dir string, key []byte, want map[string]string) {
+	t.Helper()
+	got, err := read(dir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+// TestReencryptAndRotate encrypts a plaintext database, rotates its key and
+// checks that only the current key opens it.
+func TestReencryptAndRotate(t *testing.T) {
+	plain := filepath.Join(t.TempDir(), "plain")
+	encrypted := filepath.Join(t.TempDir(), "encrypted")
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 16)
+	records := map[string]string{"user_1": "alice", "user_2": "bob", "car_1": "Niva"}
+	write(t, plain, nil, records)
+
+	err := Reencrypt(plain, encrypted, nil, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRecords(t, encrypted, oldKey, records)
+	_, err = read(encrypted, nil)
+	if err == nil {
+		t.Fatal("an encrypted database opened without a key")
+	}
+	// The target must be empty.
+	err = Reencrypt(plain, encrypted, nil, oldKey)
+	if err == nil {
+		t.Fatal("reencrypted into a database that is not empty")
+	}
+
+	err = RotateKey(encrypted, newKey, newKey)
+	if err == nil {
+		t.Fatal("rotated with the wrong old key")
+	}
+	err = RotateKey(encrypted, oldKey, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRecords(t, encrypted, newKey, records)
+	_, err = read(encrypted, oldKey)
+	if err == nil {
+		t.Fatal("the database still opens with the old key")
+	}
+
+	// Data written after the rotation stays readable with the new key.
+	write(t, encrypted, newKey, map[string]string{"user_3": "carol"})
+	records["user_3"] = "carol"
+	expectRecords(t, encrypted, newKey, records)
+}
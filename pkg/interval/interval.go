@@ -0,0 +1,150 @@
+// Package interval implements the rental time ranges shared by the booking
+// and lease services.
+//
+// An Interval is half-open: it contains every minute m with From <= m < To.
+// Two rentals where one ends exactly when the other starts therefore do not
+// overlap. Legacy requests address whole days with an inclusive range, which
+// FromDays converts into the equivalent half-open minute interval.
+package interval
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// MinutesPerDay is the number of minutes in a day number.
+const MinutesPerDay = 24 * 60
+
+var ErrInvalid = errors.New("interval end must be after its start")
+
+// Interval is the half-open range [From, To) measured in minutes since the Unix epoch.
+type Interval struct {
+	From uint64
+	To   uint64
+}
+
+// New returns [from, to) or ErrInvalid if the interval would be empty.
+func New(from, to uint64) (Interval, error) {
+	i := Interval{From: from, To: to}
+	if !i.Valid() {
+		return Interval{}, ErrInvalid
+	}
+	return i, nil
+}
+
+// FromDays converts the inclusive day range [fromDay, toDay] into minutes.
+// An inverted range, or days whose minutes do not fit into a uint64, give an
+// empty interval.
+func FromDays(fromDay, toDay uint64) Interval {
+	if fromDay > toDay || toDay >= math.MaxUint64/MinutesPerDay {
+		return Interval{}
+	}
+	return Interval{From: fromDay * MinutesPerDay, To: (toDay + 1) * MinutesPerDay}
+}
+
+// FromTimes returns the whole minutes covering [from, to): from is rounded
+// down and to up to a minute. Times before the epoch count as the epoch.
+func FromTimes(from, to time.Time) Interval {
+	return Interval{From: FloorMinute(from), To: CeilMinute(to)}
+}
+
+// FloorMinute returns the minute t falls in. Times before the epoch count as
+// the epoch.
+func FloorMinute(t time.Time) uint64 {
+	if t.Unix() < 0 {
+		return 0
+	}
+	return uint64(t.Unix() / 60)
+}
+
+// CeilMinute returns the first minute that starts at or after t.
+func CeilMinute(t time.Time) uint64 {
+	minute := FloorMinute(t)
+	if t.After(time.Unix(int64(minute)*60, 0)) {
+		minute++
+	}
+	return minute
+}
+
+// Valid reports whether the interval contains at least one minute.
+func (i Interval) Valid() bool {
+	return i.From < i.To
+}
+
+// Overlaps reports whether the two intervals share at least one minute.
+// Empty intervals overlap nothing.
+func (i Interval) Overlaps(o Interval) bool {
+	return i.Valid() && o.Valid() && i.From < o.To && o.From < i.To
+}
+
+// Contains reports whether every minute of o is also in i.
+func (i Interval) Contains(o Interval) bool {
+	return o.Valid() && i.From <= o.From && o.To <= i.To
+}
+
+// Pad extends the end of the interval by buffer minutes, saturating instead
+// of overflowing. It is used to reserve turnaround time after a rental.
+func (i Interval) Pad(buffer uint64) Interval {
+	if i.To > math.MaxUint64-buffer {
+		return Interval{From: i.From, To: math.MaxUint64}
+	}
+	return Interval{From: i.From, To: i.To + buffer}
+}
+
+// FromDay returns the day number the interval starts on.
+func (i Interval) FromDay() uint64 {
+	return i.From / MinutesPerDay
+}
+
+// ToDay returns the last day number the interval covers, or 0 if it ends at
+// the epoch.
+func (i Interval) ToDay() uint64 {
+	if i.To == 0 {
+		return 0
+	}
+	return (i.To - 1) / MinutesPerDay
+}
+
+// Recurring is First repeated every Period minutes. Occurrences starting at or
+// after Until are dropped; a zero Until repeats forever and a zero Period
+// means First is the only occurrence.
+type Recurring struct {
+	First  Interval
+	Period uint64
+	Until  uint64
+}
+
+// Overlaps reports whether any occurrence shares at least one minute with span.
+func (r Recurring) Overlaps(span Interval) bool {
+	if !r.First.Valid() || !span.Valid() {
+		return false
+	}
+
+	// The earliest occurrence ending after span starts is the only candidate:
+	// every later one starts even later.
+	occurrence := r.First
+	if r.First.To <= span.From {
+		if r.Period == 0 {
+			return false
+		}
+		k := (span.From-r.First.To)/r.Period + 1
+		// An occurrence starting past the last minute overlaps nothing, and
+		// one ending past it is cut there like Pad does.
+		high, shift := bits.Mul64(k, r.Period)
+		from, carry := bits.Add64(r.First.From, shift, 0)
+		if high != 0 || carry != 0 {
+			return false
+		}
+		to, carry := bits.Add64(r.First.To, shift, 0)
+		if carry != 0 {
+			to = math.MaxUint64
+		}
+		occurrence = Interval{From: from, To: to}
+	}
+	if r.Until != 0 && occurrence.From >= r.Until {
+		return false
+	}
+	return occurrence.Overlaps(span)
+}
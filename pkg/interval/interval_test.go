@@ -0,0 +1,168 @@
+package interval
+
+import (
+	"math"
+	"testing"
+)
+
+// overlapsOracle compares minute by minute.
+func overlapsOracle(a, b Interval) bool {
+	for m := a.From; m < a.To; m++ {
+		if b.From <= m && m < b.To {
+			return true
+		}
+	}
+	return false
+}
+
+// recurringOracle lists every occurrence of r that starts before span ends.
+func recurringOracle(r Recurring, span Interval) bool {
+	if !r.First.Valid() {
+		return false
+	}
+	for k := uint64(0); ; k++ {
+		occurrence := Interval{From: r.First.From + k*r.Period, To: r.First.To + k*r.Period}
+		if occurrence.From >= span.To || (r.Until != 0 && occurrence.From >= r.Until) {
+			return false
+		}
+		if overlapsOracle(occurrence, span) {
+			return true
+		}
+		if r.Period == 0 {
+			return false
+		}
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	for name, test := range map[string]struct {
+		a, b Interval
+		want bool
+	}{
+		"adjacent":       {Interval{10, 20}, Interval{20, 30}, false},
+		"adjacent after": {Interval{20, 30}, Interval{10, 20}, false},
+		"one minute":     {Interval{10, 21}, Interval{20, 30}, true},
+		"nested":         {Interval{12, 18}, Interval{10, 20}, true},
+		"containing":     {Interval{10, 20}, Interval{12, 18}, true},
+		"same":           {Interval{10, 20}, Interval{10, 20}, true},
+		"disjoint":       {Interval{10, 20}, Interval{30, 40}, false},
+		"zero length":    {Interval{15, 15}, Interval{10, 20}, false},
+		"both empty":     {Interval{15, 15}, Interval{15, 15}, false},
+		"inverted":       {Interval{20, 10}, Interval{0, 30}, false},
+		"last minute":    {Interval{math.MaxUint64 - 1, math.MaxUint64}, Interval{0, math.MaxUint64}, true},
+	} {
+		if got := test.a.Overlaps(test.b); got != test.want {
+			t.Errorf("%s: %v.Overlaps(%v) = %v, want %v", name, test.a, test.b, got, test.want)
+		}
+		if test.a.To-test.a.From < 100 && test.b.To-test.b.From < 100 && overlapsOracle(test.a, test.b) != test.want {
+			t.Errorf("%s: oracle disagrees", name)
+		}
+	}
+}
+
+func FuzzOverlaps(f *testing.F) {
+	f.Add(uint64(10), uint64(20), uint64(20), uint64(30))
+	f.Add(uint64(12), uint64(18), uint64(10), uint64(20))
+	f.Add(uint64(15), uint64(15), uint64(10), uint64(20))
+	f.Add(uint64(math.MaxUint64-1), uint64(math.MaxUint64), uint64(0), uint64(math.MaxUint64))
+	f.Fuzz(func(t *testing.T, aFrom, aTo, bFrom, bTo uint64) {
+		a, b := Interval{aFrom, aTo}, Interval{bFrom, bTo}
+		if a.Overlaps(b) != b.Overlaps(a) {
+			t.Fatalf("%v and %v: Overlaps is not symmetric", a, b)
+		}
+		if a.Contains(b) && !a.Overlaps(b) {
+			t.Fatalf("%v contains %v without overlapping it", a, b)
+		}
+		if a.Overlaps(b) && !a.Pad(10).Overlaps(b) {
+			t.Fatalf("padded %v stopped overlapping %v", a, b)
+		}
+
+		// Small intervals are checked minute by minute.
+		small := func(from, to uint64) Interval { return Interval{from % 64, to % 64} }
+		a, b = small(aFrom, aTo), small(bFrom, bTo)
+		if got, want := a.Overlaps(b), overlapsOracle(a, b); got != want {
+			t.Fatalf("%v.Overlaps(%v) = %v, want %v", a, b, got, want)
+		}
+	})
+}
+
+func TestDays(t *testing.T) {
+	for _, test := range []struct {
+		span     Interval
+		from, to uint64
+	}{
+		{Interval{0, 0}, 0, 0},
+		{Interval{0, 1}, 0, 0},
+		{Interval{0, MinutesPerDay}, 0, 0},
+		{Interval{0, MinutesPerDay + 1}, 0, 1},
+		{Interval{MinutesPerDay, 3 * MinutesPerDay}, 1, 2},
+		{Interval{0, math.MaxUint64}, 0, (math.MaxUint64 - 1) / MinutesPerDay},
+	} {
+		if test.span.FromDay() != test.from || test.span.ToDay() != test.to {
+			t.Errorf("%v: got days %d to %d, want %d to %d", test.span, test.span.FromDay(), test.span.ToDay(), test.from, test.to)
+		}
+	}
+
+	if got := FromDays(1, 2); got != (Interval{MinutesPerDay, 3 * MinutesPerDay}) {
+		t.Errorf("FromDays(1, 2) = %v", got)
+	}
+	lastDay := uint64(math.MaxUint64/MinutesPerDay - 1)
+	if got := FromDays(lastDay, lastDay); !got.Valid() || got.FromDay() != lastDay || got.ToDay() != lastDay {
+		t.Errorf("FromDays of the last day = %v", got)
+	}
+	for _, days := range [][2]uint64{{2, 1}, {0, lastDay + 1}, {lastDay + 2, 5}, {math.MaxUint64, math.MaxUint64}} {
+		if got := FromDays(days[0], days[1]); got.Valid() {
+			t.Errorf("FromDays(%d, %d) = %v, want an empty interval", days[0], days[1], got)
+		}
+	}
+}
+
+func TestRecurringOverlaps(t *testing.T) {
+	const half = uint64(1) << 63
+	for name, test := range map[string]struct {
+		r    Recurring
+		span Interval
+		want bool
+	}{
+		"first":                {Recurring{Interval{10, 20}, 100, 0}, Interval{15, 16}, true},
+		"adjacent occurrences": {Recurring{Interval{10, 20}, 100, 0}, Interval{20, 110}, false},
+		"later occurrence":     {Recurring{Interval{10, 20}, 100, 0}, Interval{515, 516}, true},
+		"between occurrences":  {Recurring{Interval{10, 20}, 100, 0}, Interval{520, 610}, false},
+		"containing":           {Recurring{Interval{10, 20}, 100, 0}, Interval{0, 1000}, true},
+		"before first":         {Recurring{Interval{10, 20}, 100, 0}, Interval{0, 10}, false},
+		"until":                {Recurring{Interval{10, 20}, 100, 510}, Interval{515, 516}, false},
+		"before until":         {Recurring{Interval{10, 20}, 100, 511}, Interval{515, 516}, true},
+		"no period":            {Recurring{Interval{10, 20}, 0, 0}, Interval{110, 120}, false},
+		"empty first":          {Recurring{Interval{10, 10}, 100, 0}, Interval{0, 1000}, false},
+		"empty span":           {Recurring{Interval{10, 20}, 100, 0}, Interval{15, 15}, false},
+		"longer than period":   {Recurring{Interval{0, 150}, 100, 0}, Interval{240, 245}, true},
+		// The next occurrence starts past the last minute.
+		"start overflows": {Recurring{Interval{0, 10}, half + 1, 0}, Interval{math.MaxUint64 - 5, math.MaxUint64}, false},
+		// The next occurrence starts in range and ends past the last minute.
+		"end overflows": {Recurring{Interval{0, half / 2}, half + half/2, 0}, Interval{math.MaxUint64 - 10, math.MaxUint64}, true},
+		"huge period":   {Recurring{Interval{0, 10}, math.MaxUint64, 0}, Interval{20, math.MaxUint64}, false},
+	} {
+		if got := test.r.Overlaps(test.span); got != test.want {
+			t.Errorf("%s: %+v.Overlaps(%v) = %v, want %v", name, test.r, test.span, got, test.want)
+		}
+		if test.span.To < 10000 && recurringOracle(test.r, test.span) != test.want {
+			t.Errorf("%s: oracle disagrees", name)
+		}
+	}
+}
+
+func FuzzRecurringOverlaps(f *testing.F) {
+	f.Add(uint64(10), uint64(20), uint64(100), uint64(0), uint64(515), uint64(516))
+	f.Add(uint64(0), uint64(150), uint64(100), uint64(0), uint64(240), uint64(245))
+	f.Add(uint64(10), uint64(20), uint64(100), uint64(510), uint64(515), uint64(516))
+	f.Fuzz(func(t *testing.T, firstFrom, firstTo, period, until, spanFrom, spanTo uint64) {
+		// Huge values must not panic; small ones are checked against the oracle.
+		Recurring{Interval{firstFrom, firstTo}, period, until}.Overlaps(Interval{spanFrom, spanTo})
+
+		r := Recurring{Interval{firstFrom % 256, firstTo % 256}, period % 64, until % 1024}
+		span := Interval{spanFrom % 1024, spanTo % 1024}
+		if got, want := r.Overlaps(span), recurringOracle(r, span); got != want {
+			t.Fatalf("%+v.Overlaps(%v) = %v, want %v", r, span, got, want)
+		}
+	})
+}
@@ -0,0 +1,289 @@
+// Package migrate runs versioned rewrites of badger key layouts and records.
+//
+// Applied versions and the progress of the running migration live in a single
+// reserved key. Records are rewritten in batches with badger's WriteBatch and
+// the progress cursor is saved after every batch, so a crashed run resumes
+// after the last flushed key. A batch can still be replayed after a crash, so
+// Rewrite functions must be idempotent: an already migrated record has to come
+// back unchanged.
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"go.uber.org/zap"
+	"sort"
+)
+
+// StateKey is the reserved key holding the migration state. Service keys must not start with '!'.
+var StateKey = []byte("!migrations")
+
+const defaultBatchSize = 1000
+
+var ErrUnknownVersion = errors.New("database schema is newer than this binary")
+
+// Migration rewrites every record under Prefix. Rewrite returns changed=false
+// to leave the record alone. Otherwise the record is stored under newKey
+// (the old key is deleted if it differs), or deleted if newValue is nil.
+//
+// Derive, if set, returns records to store next to each record, such as index
+// entries; it sees the record after Rewrite. Either function may be nil.
+type Migration struct {
+	Version uint64
+	Name    string
+	Prefix  []byte
+	Rewrite func(key, value []byte) (newKey, newValue []byte, changed bool, err error)
+	Derive  func(key, value []byte) ([]Record, error)
+}
+
+// Record is a key and value written by Derive.
+type Record struct {
+	Key   []byte
+	Value []byte
+}
+
+type Options struct {
+	// DryRun counts the records that would change without writing anything.
+	DryRun bool
+	// BatchSize is the number of changed records per WriteBatch; 0 means 1000.
+	BatchSize int
+	Logger    *zap.SugaredLogger
+}
+
+// State is what the reserved key stores.
+type State struct {
+	Version    uint64   `json:"version"`
+	Applied    []uint64 `json:"applied"`
+	InProgress uint64   `json:"in_progress,omitempty"`
+	LastKey    []byte   `json:"last_key,omitempty"`
+}
+
+// Report lists how many records each migration changed (or would change on a dry run).
+type Report struct {
+	Changed map[uint64]int
+}
+
+// ReadState returns the stored state; an empty database is at version 0.
+func ReadState(db *badger.DB) (State, error) {
+	state := State{}
+	err := db.View(func(tx *badger.Txn) error {
+		item, err := tx.Get(StateKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(value, &state)
+	})
+	return state, err
+}
+
+// Check fails with ErrUnknownVersion if the database was migrated by a newer
+// binary that knows migrations this one does not.
+func Check(db *badger.DB, migrations []Migration) (State, error) {
+	state, err := ReadState(db)
+	if err != nil {
+		return State{}, err
+	}
+	latest := latestVersion(migrations)
+	if state.Version > latest || state.InProgress > latest {
+		return state, fmt.Errorf("%w: database is at version %d, latest known is %d", ErrUnknownVersion, state.Version, latest)
+	}
+	return state, nil
+}
+
+// Run applies every migration newer than the stored version in order.
+func Run(db *badger.DB, migrations []Migration, opts Options) (Report, error) {
+	migrations = append([]Migration{}, migrations...)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop().Sugar()
+	}
+
+	state, err := Check(db, migrations)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Changed: map[uint64]int{}}
+	for _, m := range migrations {
+		if m.Version <= state.Version {
+			continue
+		}
+
+		var resumeFrom []byte
+		if state.InProgress == m.Version {
+			resumeFrom = state.LastKey
+			opts.Logger.Infof("resuming migration %d %s after key %q", m.Version, m.Name, resumeFrom)
+		} else {
+			opts.Logger.Infof("running migration %d %s", m.Version, m.Name)
+		}
+
+		changed, err := run(db, m, &state, resumeFrom, opts)
+		report.Changed[m.Version] = changed
+		if err != nil {
+			return report, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		if opts.DryRun {
+			opts.Logger.Infof("migration %d %s would change %d records", m.Version, m.Name, changed)
+			continue
+		}
+
+		state.Version = m.Version
+		state.Applied = append(state.Applied, m.Version)
+		state.InProgress = 0
+		state.LastKey = nil
+		err = writeState(db, state)
+		if err != nil {
+			return report, err
+		}
+		opts.Logger.Infof("migration %d %s changed %d records", m.Version, m.Name, changed)
+	}
+	return report, nil
+}
+
+func run(db *badger.DB, m Migration, state *State, resumeFrom []byte, opts Options) (int, error) {
+	tx := db.NewTransaction(false)
+	defer tx.Discard()
+
+	iteratorOptions := badger.DefaultIteratorOptions
+	iteratorOptions.Prefix = m.Prefix
+	it := tx.NewIterator(iteratorOptions)
+	defer it.Close()
+
+	changed := 0
+	var batch *badger.WriteBatch
+	pending := 0
+	var lastKey []byte
+	// A batch left after an error is dropped, as if the process had crashed.
+	defer func() {
+		if batch != nil {
+			batch.Cancel()
+		}
+	}()
+
+	flush := func() error {
+		if batch == nil {
+			return nil
+		}
+		err := batch.Flush()
+		batch = nil
+		pending = 0
+		if err != nil {
+			return err
+		}
+		state.InProgress = m.Version
+		state.LastKey = lastKey
+		return writeState(db, *state)
+	}
+
+	it.Rewind()
+	if resumeFrom != nil {
+		it.Seek(resumeFrom)
+		if it.Valid() && bytes.Equal(it.Item().Key(), resumeFrom) {
+			it.Next()
+		}
+	}
+	for ; it.Valid(); it.Next() {
+		item := it.Item()
+		key := item.KeyCopy(nil)
+		if bytes.Equal(key, StateKey) {
+			continue
+		}
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return changed, err
+		}
+
+		newKey, newValue, ok := key, value, false
+		if m.Rewrite != nil {
+			newKey, newValue, ok, err = m.Rewrite(key, value)
+			if err != nil {
+				return changed, fmt.Errorf("key %q: %w", key, err)
+			}
+			if !ok {
+				newKey, newValue = key, value
+			}
+		}
+		var derived []Record
+		if m.Derive != nil && newValue != nil {
+			derived, err = m.Derive(newKey, newValue)
+			if err != nil {
+				return changed, fmt.Errorf("key %q: %w", key, err)
+			}
+		}
+		if !ok && len(derived) == 0 {
+			continue
+		}
+		changed++
+		if opts.DryRun {
+			continue
+		}
+
+		if batch == nil {
+			batch = db.NewWriteBatch()
+		}
+		if ok && (newValue == nil || !bytes.Equal(newKey, key)) {
+			err = batch.Delete(key)
+			if err != nil {
+				return changed, err
+			}
+		}
+		if ok && newValue != nil {
+			err = batch.Set(newKey, newValue)
+			if err != nil {
+				return changed, err
+			}
+		}
+		for _, record := range derived {
+			err = batch.Set(record.Key, record.Value)
+			if err != nil {
+				return changed, err
+			}
+		}
+		lastKey = key
+		pending++
+		if pending >= opts.BatchSize {
+			err = flush()
+			if err != nil {
+				return changed, err
+			}
+		}
+	}
+
+	if opts.DryRun {
+		return changed, nil
+	}
+	return changed, flush()
+}
+
+func writeState(db *badger.DB, state State) error {
+	value, err := json.Marshal(&state)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *badger.Txn) error {
+		return tx.Set(StateKey, value)
+	})
+}
+
+func latestVersion(migrations []Migration) uint64 {
+	var latest uint64
+	for _, m := range migrations {
+		if m.Version > latest {
+			latest = m.Version
+		}
+	}
+	return latest
+}
@@ -0,0 +1,221 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"reflect"
+	"testing"
+)
+
+func openDB(t *testing.T) *badger.DB {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// fill stores user_00 to user_09, all "v1".
+func fill(t *testing.T, db *badger.DB) {
+	err := db.Update(func(tx *badger.Txn) error {
+		for i := 0; i < 10; i++ {
+			err := tx.Set([]byte(fmt.Sprintf("user_%02d", i)), []byte("v1"))
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Set([]byte("car_1"), []byte("v1"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// values returns the stored values by key, leaving out the state key.
+func values(t *testing.T, db *badger.DB) map[string]string {
+	values := map[string]string{}
+	err := db.View(func(tx *badger.Txn) error {
+		it := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if string(it.Item().Key()) == string(StateKey) {
+				continue
+			}
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			values[string(it.Item().Key())] = string(value)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+// upgrade is migration 1: "v1" records of users become "v2", and "v2" ones
+// are left alone. seen collects the keys it is called with; it fails on fail.
+func upgrade(seen *[]string, fail string) Migration {
+	return Migration{
+		Version: 1,
+		Name:    "upgrade users",
+		Prefix:  []byte("user_"),
+		Rewrite: func(key, value []byte) ([]byte, []byte, bool, error) {
+			*seen = append(*seen, string(key))
+			if string(key) == fail {
+				return nil, nil, false, errors.New("crash")
+			}
+			if string(value) == "v2" {
+				return key, value, false, nil
+			}
+			return key, []byte("v2"), true, nil
+		},
+	}
+}
+
+func expectValues(t *testing.T, db *badger.DB, v2 int) {
+	t.Helper()
+	want := map[string]string{"car_1": "v1"}
+	for i := 0; i < 10; i++ {
+		want[fmt.Sprintf("user_%02d", i)] = "v1"
+		if i < v2 {
+			want[fmt.Sprintf("user_%02d", i)] = "v2"
+		}
+	}
+	if got := values(t, db); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	db := openDB(t)
+	fill(t, db)
+	seen := []string{}
+
+	report, err := Run(db, []Migration{upgrade(&seen, "")}, Options{DryRun: true, BatchSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Changed[1] != 10 {
+		t.Fatalf("got report %v, want 10 changes", report.Changed)
+	}
+	expectValues(t, db, 0)
+	state, err := ReadState(db)
+	if err != nil || !reflect.DeepEqual(state, State{}) {
+		t.Fatalf("a dry run wrote state %+v, %v", state, err)
+	}
+}
+
+func TestResume(t *testing.T) {
+	db := openDB(t)
+	fill(t, db)
+
+	// Batches of three are flushed after user_02 and user_05; user_06 is in
+	// the batch that is lost when the run stops at user_07.
+	seen := []string{}
+	_, err := Run(db, []Migration{upgrade(&seen, "user_07")}, Options{BatchSize: 3})
+	if err == nil {
+		t.Fatal("the interrupted run succeeded")
+	}
+	expectValues(t, db, 6)
+	state, err := ReadState(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Version != 0 || state.InProgress != 1 || string(state.LastKey) != "user_05" {
+		t.Fatalf("got state %+v after the interrupted run", state)
+	}
+
+	seen = []string{}
+	report, err := Run(db, []Migration{upgrade(&seen, "")}, Options{BatchSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"user_06", "user_07", "user_08", "user_09"}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("the resumed run rewrote %v, want %v", seen, want)
+	}
+	if report.Changed[1] != 4 {
+		t.Fatalf("got report %v, want 4 changes", report.Changed)
+	}
+	expectValues(t, db, 10)
+	state, err = ReadState(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (State{Version: 1, Applied: []uint64{1}}); !reflect.DeepEqual(state, want) {
+		t.Fatalf("got state %+v, want %+v", state, want)
+	}
+
+	// Running again is a no-op.
+	seen = []string{}
+	report, err = Run(db, []Migration{upgrade(&seen, "")}, Options{BatchSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 0 || len(report.Changed) != 0 {
+		t.Fatalf("the second run rewrote %v, report %v", seen, report.Changed)
+	}
+	expectValues(t, db, 10)
+}
+
+// TestReplay replays a batch whose progress was not saved: the rewrite is
+// idempotent, so already migrated records are not counted or written again.
+func TestReplay(t *testing.T) {
+	db := openDB(t)
+	fill(t, db)
+	seen := []string{}
+	_, err := Run(db, []Migration{upgrade(&seen, "user_04")}, Options{BatchSize: 3})
+	if err == nil {
+		t.Fatal("the interrupted run succeeded")
+	}
+	// user_00 to user_02 were flushed; pretend only user_00 was saved.
+	err = writeState(db, State{InProgress: 1, LastKey: []byte("user_00")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(db, []Migration{upgrade(&seen, "")}, Options{BatchSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Changed[1] != 7 {
+		t.Fatalf("got report %v, want 7 changes", report.Changed)
+	}
+	expectValues(t, db, 10)
+}
+
+func TestUnknownVersion(t *testing.T) {
+	for _, state := range []State{{Version: 2, Applied: []uint64{1, 2}}, {Version: 1, Applied: []uint64{1}, InProgress: 2}} {
+		db := openDB(t)
+		fill(t, db)
+		err := writeState(db, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen := []string{}
+		migrations := []Migration{upgrade(&seen, "")}
+		_, err = Check(db, migrations)
+		if !errors.Is(err, ErrUnknownVersion) {
+			t.Fatalf("Check of %+v: got %v, want %v", state, err, ErrUnknownVersion)
+		}
+		_, err = Run(db, migrations, Options{})
+		if !errors.Is(err, ErrUnknownVersion) {
+			t.Fatalf("Run on %+v: got %v, want %v", state, err, ErrUnknownVersion)
+		}
+		if len(seen) != 0 {
+			t.Fatalf("Run on %+v rewrote %v", state, seen)
+		}
+		expectValues(t, db, 0)
+	}
+
+	db := openDB(t)
+	_, err := Check(db, nil)
+	if err != nil {
+		t.Fatalf("empty database: %v", err)
+	}
+}
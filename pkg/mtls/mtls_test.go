@@ -0,0 +1,141 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"distributed-rental/pkg/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a certificate and its key into dir and returns the TLS
+// section of a service using them with the CA at caPath.
+func writeCert(t *testing.T, dir string, name string, certPEM, keyPEM []byte, caPath string) config.TLS {
+	t.Helper()
+	section := config.TLS{CertPath: filepath.Join(dir, name+".crt"), KeyPath: filepath.Join(dir, name+".key"), CAPath: caPath}
+	for path, data := range map[string][]byte{section.CertPath: certPEM, section.KeyPath: keyPEM} {
+		err := ioutil.WriteFile(path, data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return section
+}
+
+// newService returns the TLS section of service name with a certificate
+// signed by the CA.
+func newService(t *testing.T, dir string, caCert, caKey []byte, name string) config.TLS {
+	t.Helper()
+	caPath := filepath.Join(dir, "ca.crt")
+	err := ioutil.WriteFile(caPath, caCert, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, key, err := NewCert(caCert, caKey, name, []string{"127.0.0.1", "localhost"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeCert(t, dir, name, cert, key, caPath)
+}
+
+// TestMutualTLS serves the common name of the verified client certificate, as
+// the services check it against service tokens, and calls it with the
+// certificates of several clients.
+func TestMutualTLS(t *testing.T) {
+	caCert, caKey, err := NewCA("rental", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	serverConfig, err := newService(t, dir, caCert, caKey, "booking").ServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) == 0 {
+			rw.Write([]byte("anonymous"))
+			return
+		}
+		rw.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	otherCACert, otherCAKey, err := NewCA("other", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strangerConfig := newService(t, t.TempDir(), otherCACert, otherCAKey, "fleet")
+	// The stranger trusts our CA, so only its own certificate is at fault.
+	strangerConfig.CAPath = filepath.Join(dir, "ca.crt")
+
+	get := func(clientConfig *tls.Config) (string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		response, err := client.Get(server.URL)
+		if err != nil {
+			return "", err
+		}
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		return string(body), err
+	}
+	call := func(section config.TLS) (string, error) {
+		t.Helper()
+		clientConfig, err := section.ClientConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return get(clientConfig)
+	}
+
+	name, err := call(newService(t, dir, caCert, caKey, "fleet"))
+	if err != nil || name != "fleet" {
+		t.Fatalf("client of the CA: got %q, %v", name, err)
+	}
+
+	// Certificates are optional so that users can call public endpoints.
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caCert)
+	name, err = get(&tls.Config{RootCAs: pool})
+	if err != nil || name != "anonymous" {
+		t.Fatalf("client without a certificate: got %q, %v", name, err)
+	}
+
+	// A client does not offer a certificate the server's CA did not sign, and
+	// the server refuses one offered anyway.
+	name, err = call(strangerConfig)
+	if err != nil || name != "anonymous" {
+		t.Fatalf("client of another CA: got %q, %v", name, err)
+	}
+	clientConfig, err := strangerConfig.ClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return &clientConfig.Certificates[0], nil
+	}
+	name, err = get(clientConfig)
+	if err == nil {
+		t.Fatalf("a certificate of another CA was accepted as %q", name)
+	}
+}
+
+func TestNewCertNotCA(t *testing.T) {
+	caCert, caKey, err := NewCA("rental", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, key, err := NewCert(caCert, caKey, "booking", nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = NewCert(cert, key, "fleet", nil, time.Hour)
+	if err != ErrNotCA {
+		t.Fatalf("got %v, want %v", err, ErrNotCA)
+	}
+}
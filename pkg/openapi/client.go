@@ -0,0 +1,255 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+)
+
+// initialisms are the words Go names spell in capitals.
+var initialisms = map[string]string{
+	"api":  "API",
+	"id":   "ID",
+	"ids":  "IDs",
+	"ip":   "IP",
+	"json": "JSON",
+	"jwt":  "JWT",
+	"oidc": "OIDC",
+	"totp": "TOTP",
+	"ttl":  "TTL",
+	"uri":  "URI",
+	"uris": "URIs",
+	"url":  "URL",
+	"utc":  "UTC",
+}
+
+var methodOrder = map[string]int{"get": 0, "head": 1, "post": 2, "put": 3, "patch": 4, "delete": 5}
+
+// GenerateClient returns the Go source of a client of document in package
+// pkg, built on pkg/sdk. source names the document in the header of the file.
+func GenerateClient(document *Document, pkg string, source string) ([]byte, error) {
+	g := &generator{imports: map[string]bool{"distributed-rental/pkg/sdk": true}}
+
+	var names []string
+	for name := range document.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	types := map[string]bool{}
+	for _, name := range names {
+		types[name] = true
+		g.typeDecl(name, document.Components.Schemas[name])
+	}
+
+	var paths []string
+	for path := range document.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		var methods []string
+		for method := range document.Paths[path] {
+			methods = append(methods, method)
+		}
+		sort.Slice(methods, func(i, j int) bool { return methodOrder[methods[i]] < methodOrder[methods[j]] })
+		for _, method := range methods {
+			err := g.operation(strings.ToUpper(method), path, document.Paths[path][method], types)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by rentalctl gen-client from %s; DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	var imports []string
+	for path := range g.imports {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+	out.WriteString("import (\n")
+	for _, path := range imports {
+		fmt.Fprintf(&out, "\t%q\n", path)
+	}
+	out.WriteString(")\n\n")
+	fmt.Fprintf(&out, "// Client calls the %s service.\n", document.Info.Title)
+	out.WriteString("type Client struct {\n\t*sdk.Client\n}\n\n")
+	fmt.Fprintf(&out, "// New creates a client for the %s service listening on addr (host:port).\n", document.Info.Title)
+	out.WriteString("func New(addr string) *Client {\n\treturn &Client{Client: sdk.New(addr)}\n}\n\n")
+	out.Write(g.types.Bytes())
+	out.Write(g.methods.Bytes())
+
+	formatted, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("openapi: generated client does not parse: %w", err)
+	}
+	return formatted, nil
+}
+
+type generator struct {
+	imports map[string]bool
+	types   bytes.Buffer
+	methods bytes.Buffer
+}
+
+func (c *generator) typeDecl(name string, schema *Schema) {
+	fmt.Fprintf(&c.types, "type %s %s\n\n", name, c.goType(schema))
+}
+
+func (c *generator) operation(method string, path string, operation *OperationObject, types map[string]bool) error {
+	name := exported(operation.OperationID)
+
+	requestType := ""
+	var fields []string
+	for _, parameter := range operation.Parameters {
+		if parameter.In == "path" {
+			fields = append(fields, fmt.Sprintf("%s %s `json:\"-\" path:\"%s\"`", goName(parameter.Name), c.goType(parameter.Schema), parameter.Name))
+		} else {
+			fields = append(fields, c.field(parameter.Name, parameter.Schema, parameter.Required))
+		}
+	}
+	if operation.RequestBody != nil {
+		body := operation.RequestBody.Content["application/json"].Schema
+		for _, property := range body.Properties {
+			fields = append(fields, c.field(property.Name, property.Schema, contains(body.Required, property.Name)))
+		}
+	}
+	if len(fields) > 0 {
+		requestType = name + "Request"
+		if types[requestType] {
+			return fmt.Errorf("openapi: %s of %s %s is also a schema", requestType, method, path)
+		}
+		types[requestType] = true
+		fmt.Fprintf(&c.methods, "type %s struct {\n%s\n}\n\n", requestType, strings.Join(fields, "\n"))
+	}
+
+	responseType := ""
+	for status, response := range operation.Responses {
+		if status == "default" || response.Content["application/json"].Schema == nil {
+			continue
+		}
+		schema := response.Content["application/json"].Schema
+		if schema.Ref != "" {
+			responseType = refName(schema.Ref)
+			break
+		}
+		responseType = name + "Response"
+		if types[responseType] {
+			return fmt.Errorf("openapi: %s of %s %s is also a schema", responseType, method, path)
+		}
+		types[responseType] = true
+		fmt.Fprintf(&c.methods, "type %s %s\n\n", responseType, c.goType(schema))
+	}
+
+	fmt.Fprintf(&c.methods, "// %s calls %s %s.\n", name, method, path)
+	if operation.Summary != "" {
+		fmt.Fprintf(&c.methods, "//\n// %s.\n", strings.TrimSuffix(operation.Summary, "."))
+	}
+	params, request := "", "nil"
+	if requestType != "" {
+		params, request = "request "+requestType, "&request"
+	}
+	if responseType == "" {
+		fmt.Fprintf(&c.methods, "func (c *Client) %s(%s) error {\n", name, params)
+		fmt.Fprintf(&c.methods, "\treturn c.Do(%q, %q, %s, nil)\n}\n\n", method, path, request)
+		return nil
+	}
+	fmt.Fprintf(&c.methods, "func (c *Client) %s(%s) (%s, error) {\n", name, params, responseType)
+	fmt.Fprintf(&c.methods, "\tvar response %s\n", responseType)
+	fmt.Fprintf(&c.methods, "\terr := c.Do(%q, %q, %s, &response)\n", method, path, request)
+	c.methods.WriteString("\treturn response, err\n}\n\n")
+	return nil
+}
+
+// field is a struct field of a property; optional ones are omitempty.
+func (c *generator) field(name string, schema *Schema, required bool) string {
+	tag := name
+	if !required {
+		tag += ",omitempty"
+	}
+	return fmt.Sprintf("%s %s `json:\"%s\"`", goName(name), c.goType(schema), tag)
+}
+
+func (c *generator) goType(schema *Schema) string {
+	t := c.baseType(schema)
+	if schema.Nullable && !strings.HasPrefix(t, "[]") && !strings.HasPrefix(t, "map[") && t != "json.RawMessage" {
+		return "*" + t
+	}
+	return t
+}
+
+func (c *generator) baseType(schema *Schema) string {
+	if schema.Ref != "" {
+		return refName(schema.Ref)
+	}
+	minimum := schema.Minimum != nil && *schema.Minimum >= 0
+	switch schema.Type {
+	case "boolean":
+		return "bool"
+	case "string":
+		switch schema.Format {
+		case "date-time":
+			c.imports["time"] = true
+			return "time.Time"
+		case "byte":
+			return "[]byte"
+		}
+		return "string"
+	case "integer":
+		t := "int"
+		switch schema.Format {
+		case "int32":
+			t = "int32"
+		case "int64":
+			t = "int64"
+		}
+		if minimum {
+			t = "u" + t
+		}
+		return t
+	case "number":
+		return "float64"
+	case "array":
+		return "[]" + c.goType(schema.Items)
+	case "object":
+		if schema.AdditionalProperties != nil {
+			return "map[string]" + c.goType(schema.AdditionalProperties)
+		}
+		var fields []string
+		for _, property := range schema.Properties {
+			fields = append(fields, c.field(property.Name, property.Schema, contains(schema.Required, property.Name)))
+		}
+		return "struct {\n" + strings.Join(fields, "\n") + "\n}"
+	}
+	c.imports["encoding/json"] = true
+	return "json.RawMessage"
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// goName spells a json name like Go does: "redirect_uris" is RedirectURIs.
+func goName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.Split(name, "_") {
+		if initialism, ok := initialisms[strings.ToLower(word)]; ok {
+			b.WriteString(initialism)
+			continue
+		}
+		b.WriteString(exported(word))
+	}
+	return b.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
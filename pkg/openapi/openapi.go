@@ -0,0 +1,507 @@
+// Package openapi describes the v1 REST routes of a service as an OpenAPI 3
+// document and generates typed Go clients from such documents.
+//
+// A service lists its routes as Operations, each with its handler and the Go
+// types the handler reads and writes. The same list registers the routes and
+// builds the document served at /openapi.json, so the two can not disagree.
+// The document is also committed next to the service and the clients in
+// pkg/sdk are generated from it with `go generate ./pkg/sdk/...`. The tests of
+// each service compare the committed document with the routes using
+// openapitest, so they fail when a handler changed without its document and
+// clients.
+package openapi
+
+import (
+	"bytes"
+	"distributed-rental/pkg/rest"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Version is the OpenAPI version of the documents.
+const Version = "3.0.3"
+
+// Security schemes of the services. An operation lists the ones it accepts;
+// any one of them is enough.
+const (
+	// SecurityUser is a user access token in X-Auth.
+	SecurityUser = "user"
+	// SecurityAPIKey is an API key in X-API-Key.
+	SecurityAPIKey = "apiKey"
+	// SecurityAdmin is the admin token in X-Admin-Token.
+	SecurityAdmin = "admin"
+	// SecurityService is a service token in Authorization: Bearer.
+	SecurityService = "service"
+)
+
+var securitySchemes = map[string]SecurityScheme{
+	SecurityUser:    {Type: "apiKey", In: "header", Name: "X-Auth", Description: "access token from POST /v1/sessions"},
+	SecurityAPIKey:  {Type: "apiKey", In: "header", Name: "X-API-Key", Description: "API key from POST /v1/api_keys"},
+	SecurityAdmin:   {Type: "apiKey", In: "header", Name: "X-Admin-Token", Description: "admin token of the deployment"},
+	SecurityService: {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "service token from POST /oauth/token"},
+}
+
+// Operation is a route of a service.
+type Operation struct {
+	Method string
+	// Path is a ServeMux path whose wildcards are named after json fields of
+	// Request, such as "/v1/cars/{car_id}".
+	Path    string
+	ID      string
+	Summary string
+	// Security lists the accepted schemes; none means the route is public.
+	Security []string
+	// Request is a zero value of the struct the handler decodes with
+	// rest.Decode, or nil if it reads nothing.
+	Request interface{}
+	// Response is a zero value of what the handler writes as JSON, or nil if
+	// it writes no body.
+	Response interface{}
+	// Status is the status of success, 200 if zero. Handlers of 201 routes
+	// answer 200 and are wrapped in rest.Created.
+	Status  int
+	Handler http.HandlerFunc
+}
+
+func (c Operation) status() int {
+	if c.Status == 0 {
+		return http.StatusOK
+	}
+	return c.Status
+}
+
+// Register registers the operations on mux.
+func Register(mux *http.ServeMux, operations []Operation) {
+	for _, operation := range operations {
+		handler := operation.Handler
+		if operation.status() == http.StatusCreated {
+			handler = rest.Created(handler)
+		}
+		mux.HandleFunc(operation.Method+" "+operation.Path, handler)
+	}
+}
+
+// Document is an OpenAPI document, limited to what the services use.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem maps lower case methods to operations.
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Content map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Schema is a JSON schema. An empty schema allows any value.
+type Schema struct {
+	Ref                  string     `json:"$ref,omitempty"`
+	Type                 string     `json:"type,omitempty"`
+	Format               string     `json:"format,omitempty"`
+	Minimum              *int64     `json:"minimum,omitempty"`
+	Nullable             bool       `json:"nullable,omitempty"`
+	Items                *Schema    `json:"items,omitempty"`
+	Properties           Properties `json:"properties,omitempty"`
+	Required             []string   `json:"required,omitempty"`
+	AdditionalProperties *Schema    `json:"additionalProperties,omitempty"`
+}
+
+// Property is a named property of an object schema.
+type Property struct {
+	Name   string
+	Schema *Schema
+}
+
+// Properties keep the order of the fields of their Go struct, in the
+// document and in generated clients.
+type Properties []Property
+
+func (c Properties) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, property := range c {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(property.Name)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := json.Marshal(property.Schema)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(schema)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (c *Properties) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != json.Delim('{') {
+		return fmt.Errorf("openapi: properties must be an object")
+	}
+	*c = nil
+	for decoder.More() {
+		token, err = decoder.Token()
+		if err != nil {
+			return err
+		}
+		property := Property{Name: token.(string)}
+		err = decoder.Decode(&property.Schema)
+		if err != nil {
+			return err
+		}
+		*c = append(*c, property)
+	}
+	return nil
+}
+
+// JSON is the document as committed and served.
+func (c *Document) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Handler serves the document.
+func Handler(document *Document) http.HandlerFunc {
+	data, err := document.JSON()
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			rw.WriteHeader(500)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(200)
+		rw.Write(data)
+	}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Build describes operations as a document. Like ServeMux it panics on what
+// can only be a mistake in the table: a path wildcard without its field.
+func Build(info Info, operations []Operation) *Document {
+	b := &builder{
+		document: &Document{
+			OpenAPI: Version,
+			Info:    info,
+			Paths:   map[string]PathItem{},
+			Components: Components{
+				Schemas:         map[string]*Schema{},
+				SecuritySchemes: map[string]SecurityScheme{},
+			},
+		},
+		names: map[string]reflect.Type{},
+	}
+	for _, operation := range operations {
+		b.operation(operation)
+	}
+	return b.document
+}
+
+type builder struct {
+	document *Document
+	names    map[string]reflect.Type
+}
+
+func (c *builder) operation(operation Operation) {
+	object := &OperationObject{
+		OperationID: operation.ID,
+		Summary:     operation.Summary,
+		Responses:   map[string]Response{},
+	}
+
+	if operation.Request != nil {
+		fields := c.fields(reflect.TypeOf(operation.Request))
+		inPath := map[string]bool{}
+		for _, name := range pathWildcards(operation.Path) {
+			field, ok := fields.get(name)
+			if !ok {
+				panic(fmt.Sprintf("openapi: %s %s: wildcard {%s} is not a json field of %T", operation.Method, operation.Path, name, operation.Request))
+			}
+			inPath[name] = true
+			// Handlers take pointers to tell a missing id from 0; in the
+			// path it is never missing.
+			schema := *field.Schema
+			schema.Nullable = false
+			object.Parameters = append(object.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: &schema})
+		}
+
+		body := &Schema{Type: "object"}
+		for _, field := range fields.properties {
+			if inPath[field.Name] {
+				continue
+			}
+			switch operation.Method {
+			case http.MethodGet, http.MethodHead, http.MethodDelete:
+				object.Parameters = append(object.Parameters, Parameter{Name: field.Name, In: "query", Schema: field.Schema})
+			default:
+				// Handlers treat a missing field like its zero value, so
+				// none is required.
+				body.Properties = append(body.Properties, field)
+			}
+		}
+		if len(body.Properties) > 0 {
+			object.RequestBody = &RequestBody{Content: map[string]MediaType{"application/json": {Schema: body}}}
+		}
+	} else if len(pathWildcards(operation.Path)) > 0 {
+		panic(fmt.Sprintf("openapi: %s %s: wildcards without a request type", operation.Method, operation.Path))
+	}
+
+	status := operation.status()
+	response := Response{Description: http.StatusText(status)}
+	if operation.Response != nil {
+		response.Content = map[string]MediaType{"application/json": {Schema: c.schema(reflect.TypeOf(operation.Response))}}
+	}
+	object.Responses[strconv.Itoa(status)] = response
+	object.Responses["default"] = Response{
+		Description: "error",
+		Content:     map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}},
+	}
+
+	for _, scheme := range operation.Security {
+		object.Security = append(object.Security, map[string][]string{scheme: {}})
+		c.document.Components.SecuritySchemes[scheme] = securitySchemes[scheme]
+	}
+
+	item := c.document.Paths[operation.Path]
+	if item == nil {
+		item = PathItem{}
+		c.document.Paths[operation.Path] = item
+	}
+	item[strings.ToLower(operation.Method)] = object
+}
+
+func pathWildcards(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.TrimSuffix(strings.Trim(segment, "{}"), "..."))
+		}
+	}
+	return names
+}
+
+type structFields struct {
+	properties Properties
+	required   map[string]bool
+}
+
+func (c structFields) get(name string) (Property, bool) {
+	for _, property := range c.properties {
+		if property.Name == name {
+			return property, true
+		}
+	}
+	return Property{}, false
+}
+
+// fields lists the json fields of a struct like encoding/json does, with the
+// fields of embedded structs in place. Fields are required unless they are
+// pointers or omitempty.
+func (c *builder) fields(t reflect.Type) structFields {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	fields := structFields{required: map[string]bool{}}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			embedded := c.fields(sf.Type)
+			fields.properties = append(fields.properties, embedded.properties...)
+			for name := range embedded.required {
+				fields.required[name] = true
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields.properties = append(fields.properties, Property{Name: name, Schema: c.schema(sf.Type)})
+		if sf.Type.Kind() != reflect.Ptr && !strings.Contains(","+options+",", ",omitempty,") {
+			fields.required[name] = true
+		}
+	}
+	return fields
+}
+
+func (c *builder) schema(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		schema := c.schema(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32", Minimum: new(int64)}
+	case reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64", Minimum: new(int64)}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: c.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: c.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return c.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + c.component(t)}
+	}
+	return &Schema{}
+}
+
+func (c *builder) object(t reflect.Type) *Schema {
+	fields := c.fields(t)
+	schema := &Schema{Type: "object", Properties: fields.properties}
+	for _, property := range fields.properties {
+		if fields.required[property.Name] {
+			schema.Required = append(schema.Required, property.Name)
+		}
+	}
+	return schema
+}
+
+// component adds a named struct to the components once and returns its name:
+// the Go name, exported, or prefixed with its package if two packages use it.
+func (c *builder) component(t reflect.Type) string {
+	name := typeName(t.Name())
+	if other, ok := c.names[name]; ok && other != t {
+		pkg := t.PkgPath()
+		name = exported(pkg[strings.LastIndex(pkg, "/")+1:]) + name
+	}
+	if _, ok := c.names[name]; ok {
+		return name
+	}
+	c.names[name] = t
+	// Placeholder first, so that recursive types end.
+	c.document.Components.Schemas[name] = &Schema{}
+	*c.document.Components.Schemas[name] = *c.object(t)
+	return name
+}
+
+// typeName exports the name of a Go type, spelling a leading initialism in
+// capitals: apiKeyInfo is APIKeyInfo.
+func typeName(name string) string {
+	word := strings.IndexFunc(name, unicode.IsUpper)
+	if word < 0 {
+		word = len(name)
+	}
+	if initialism, ok := initialisms[name[:word]]; ok {
+		return initialism + name[word:]
+	}
+	return exported(name)
+}
+
+func exported(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// WriteFile writes document to path, for the -openapi flag of the services.
+func WriteFile(path string, document *Document) error {
+	data, err := document.JSON()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,68 @@
+// Package openapitest checks a service against its committed OpenAPI
+// document, so that a handler can not change without its document and the
+// clients generated from it.
+package openapitest
+
+import (
+	"bytes"
+	"distributed-rental/pkg/openapi"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// methods are the methods a route may be registered with.
+var methods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+var wildcard = regexp.MustCompile(`\{[^}]*\}`)
+
+// CheckFile fails t if the file at path differs from document.
+func CheckFile(t testing.TB, path string, document *openapi.Document) {
+	t.Helper()
+	want, err := document.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s is out of date, run go generate ./pkg/sdk/...", path)
+	}
+}
+
+// CheckRoutes fails t unless mux sends every documented method of every path
+// of document to the route registered for it, and the other methods of the
+// path to the 405 of the mux or to another documented route, as DELETE
+// /v1/api_keys/verify goes to DELETE /v1/api_keys/{key_id}. Wildcards of a
+// path are filled with 1.
+func CheckRoutes(t testing.TB, mux *http.ServeMux, document *openapi.Document) {
+	t.Helper()
+	paths := []string{}
+	routes := map[string]bool{}
+	for path, item := range document.Paths {
+		paths = append(paths, path)
+		for method := range item {
+			routes[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		target := wildcard.ReplaceAllString(path, "1")
+		for _, method := range methods {
+			_, pattern := mux.Handler(httptest.NewRequest(method, target, nil))
+			_, documented := document.Paths[path][strings.ToLower(method)]
+			if documented && pattern != method+" "+path {
+				t.Errorf("%s %s is documented but routed to %q", method, target, pattern)
+			}
+			if !documented && pattern != "" && !routes[pattern] {
+				t.Errorf("%s %s is not documented but routed to %q", method, target, pattern)
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package ratelimit limits requests per route with token buckets keyed by the
+// caller: the JWT user_id when the request carries a valid token and the client
+// IP otherwise.
+//
+// Limits are written as "<count>/<unit>[:<burst>]" with the units s, m, h and d,
+// so "10/s:20" refills ten tokens a second into a bucket of twenty and
+// "1000/d" is a daily quota. Rules map routes to limits:
+//
+//	/check_car=10/s:20,/create_booking=1/s:5,*=100/s
+//
+// where "*" applies to every route without its own rule. Routes with path
+// wildcards are named by their pattern, as in
+// "GET /v1/cars/{car_id}/availability=10/s:20", and gRPC calls by their full
+// method name, as in "/booking.v1.BookingService/CheckCar=10/s:20". Buckets
+// live in a Store; instances sharing a store share their limits.
+package ratelimit
+
+import (
+	"distributed-rental/pkg/usertoken"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AnyRoute is the rule for routes without a rule of their own.
+const AnyRoute = "*"
+
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+var units = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+}
+
+// Limit is a token bucket: Rate tokens a second up to Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst float64
+}
+
+// ParseLimit parses "<count>/<unit>[:<burst>]". The burst defaults to count.
+func ParseLimit(s string) (Limit, error) {
+	spec, burstSpec, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+	countSpec, unitSpec, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%w %q: want <count>/<unit>[:<burst>]", ErrInvalidLimit, s)
+	}
+	count, err := strconv.ParseUint(countSpec, 10, 32)
+	if err != nil || count == 0 {
+		return Limit{}, fmt.Errorf("%w %q: count must be a positive integer", ErrInvalidLimit, s)
+	}
+	unit, ok := units[unitSpec]
+	if !ok {
+		return Limit{}, fmt.Errorf("%w %q: unit must be s, m, h or d", ErrInvalidLimit, s)
+	}
+	burst := count
+	if hasBurst {
+		burst, err = strconv.ParseUint(burstSpec, 10, 32)
+		if err != nil || burst == 0 {
+			return Limit{}, fmt.Errorf("%w %q: burst must be a positive integer", ErrInvalidLimit, s)
+		}
+	}
+	return Limit{Rate: float64(count) / unit.Seconds(), Burst: float64(burst)}, nil
+}
+
+// Rules maps routes to their limits.
+type Rules map[string]Limit
+
+// ParseRules parses comma separated "<route>=<limit>" pairs. An empty string
+// means no limits.
+func ParseRules(s string) (Rules, error) {
+	rules := Rules{}
+	for _, rule := range strings.Split(s, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		route, spec, ok := strings.Cut(rule, "=")
+		route = strings.TrimSpace(route)
+		if !ok || route == "" {
+			return nil, fmt.Errorf("%w %q: want <route>=<limit>", ErrInvalidLimit, rule)
+		}
+		limit, err := ParseLimit(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules[route] = limit
+	}
+	return rules, nil
+}
+
+func (c Rules) limit(route string) (Limit, bool) {
+	limit, ok := c[route]
+	if !ok {
+		limit, ok = c[AnyRoute]
+	}
+	return limit, ok
+}
+
+// KeyFunc names the caller a request is counted against.
+type KeyFunc func(r *http.Request) string
+
+// Limiter applies Rules to the requests of a handler.
+type Limiter struct {
+	rules  Rules
+	store  Store
+	logger *zap.SugaredLogger
+	now    func() time.Time
+}
+
+func New(rules Rules, store Store, logger *zap.SugaredLogger) *Limiter {
+	return &Limiter{
+		rules:  rules,
+		store:  store,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Handler limits requests to next. Requests over the limit get 429 with
+// Retry-After in seconds. If the store fails the request is let through.
+func (c *Limiter) Handler(next http.Handler, key KeyFunc) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if wait := c.Allow(Route(next, r), r, key); wait > 0 {
+			Reject(rw, wait)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// Allow counts r against the rule of route and returns how long its caller,
+// named by key, has to wait if it is over the limit. Transports other than
+// HTTP name their own routes, such as the full method of a gRPC call. If the
+// store fails the request is let through.
+func (c *Limiter) Allow(route string, r *http.Request, key KeyFunc) time.Duration {
+	limit, ok := c.rules.limit(route)
+	if !ok {
+		return 0
+	}
+	caller := key(r)
+	wait, err := c.store.Take(route+" "+caller, limit, c.now())
+	if err != nil {
+		c.logger.Errorf("rate limit error: %v", err)
+		return 0
+	}
+	if wait > 0 {
+		c.logger.Infof("rate limited %s for %s", route, caller)
+	}
+	return wait
+}
+
+// Route is the route r is limited by: the pattern it matches when next is a
+// ServeMux, such as "GET /v1/cars/{car_id}/availability", so that one rule
+// and one bucket cover every car, and its path otherwise.
+func Route(next http.Handler, r *http.Request) string {
+	if mux, ok := next.(*http.ServeMux); ok {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			return pattern
+		}
+	}
+	return r.URL.Path
+}
+
+// Take counts a request of caller against limit, apart from the route rules,
+// and returns how long the caller has to wait if it is over the limit. If the
+// store fails the request is let through.
+func (c *Limiter) Take(caller string, limit Limit) time.Duration {
+	wait, err := c.store.Take(caller, limit, c.now())
+	if err != nil {
+		c.logger.Errorf("rate limit error: %v", err)
+		return 0
+	}
+	if wait > 0 {
+		c.logger.Infof("rate limited %s", caller)
+	}
+	return wait
+}
+
+// Exceeded is the error of a request over its limit, for code that checks
+// the limit before it can answer the request.
+type Exceeded struct {
+	Wait time.Duration
+}
+
+func (c *Exceeded) Error() string {
+	return "rate limit exceeded"
+}
+
+// RetryAfter is wait in whole seconds, rounded up, as Retry-After has it.
+func RetryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+// Reject answers a request over its limit with 429 and Retry-After in seconds.
+func Reject(rw http.ResponseWriter, wait time.Duration) {
+	rw.Header().Set("Retry-After", RetryAfter(wait))
+	http.Error(rw, "rate limit exceeded", http.StatusTooManyRequests)
+}
+
+func (c *Limiter) Close() error {
+	return c.store.Close()
+}
+
+// ClientIP returns the address of the client. X-Real-IP is trusted only from a
+// loopback peer, which is the nginx in front of the services.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return realIP
+		}
+	}
+	return host
+}
+
+// UserOrIP keys requests with a valid X-Auth token by its user_id and the rest
+// by ClientIP. The signature is checked so a forged token can not claim a fresh
+// bucket.
+func UserOrIP(jwtSecret []byte) KeyFunc {
+	return func(r *http.Request) string {
+		token := r.Header.Get("X-Auth")
+		if token != "" {
+			tokenObj, err := jwt.Parse(token, usertoken.Keyfunc(jwtSecret))
+			if err == nil {
+				claims, ok := tokenObj.Claims.(jwt.MapClaims)
+				if userID, isNumber := claims["user_id"].(float64); ok && isNumber {
+					return "user:" + strconv.FormatUint(uint64(userID), 10)
+				}
+			}
+		}
+		return "ip:" + ClientIP(r)
+	}
+}
@@ -0,0 +1,377 @@
+package ratelimit
+
+import (
+	"distributed-rental/pkg/usertoken"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newClock() *testClock {
+	return &testClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+var stores = map[string]func(t *testing.T) Store{
+	"memory": func(t *testing.T) Store {
+		return NewMemoryStore()
+	},
+	"sqlite": func(t *testing.T) Store {
+		store, err := NewSQLStore(filepath.Join(t.TempDir(), "ratelimit.sqlite"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	},
+}
+
+// forEachStore runs test against every store, so that they count alike.
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			test(t, open(t))
+		})
+	}
+}
+
+func mustParse(t *testing.T, s string) Limit {
+	t.Helper()
+	limit, err := ParseLimit(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return limit
+}
+
+// expectTake fails t unless taking from key waits for wait.
+func expectTake(t *testing.T, store Store, key string, limit Limit, now time.Time, wait time.Duration) {
+	t.Helper()
+	got, err := store.Take(key, limit, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stores compute in float seconds.
+	if diff := got - wait; diff < -time.Microsecond || diff > time.Microsecond {
+		t.Fatalf("%s: got wait %v, want %v", key, got, wait)
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	for spec, want := range map[string]Limit{
+		"10/s:20": {Rate: 10, Burst: 20},
+		"2/m":     {Rate: 2.0 / 60, Burst: 2},
+		" 1/h:3 ": {Rate: 1.0 / 3600, Burst: 3},
+		"1000/d":  {Rate: 1000.0 / 86400, Burst: 1000},
+	} {
+		got, err := ParseLimit(spec)
+		if err != nil || got != want {
+			t.Errorf("%q: got %+v, %v, want %+v", spec, got, err, want)
+		}
+	}
+	for _, spec := range []string{"", "10", "0/s", "-1/s", "10/w", "10/s:0", "10/s:x", "1.5/s"} {
+		_, err := ParseLimit(spec)
+		if !errors.Is(err, ErrInvalidLimit) {
+			t.Errorf("%q: got %v, want %v", spec, err, ErrInvalidLimit)
+		}
+	}
+
+	rules, err := ParseRules("/check_car=10/s:20, GET /v1/cars/{car_id}/availability=1/m,,*=100/s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 || rules["GET /v1/cars/{car_id}/availability"] != (Limit{Rate: 1.0 / 60, Burst: 1}) {
+		t.Fatalf("got rules %+v", rules)
+	}
+	if limit, ok := rules.limit("/other"); !ok || limit != rules[AnyRoute] {
+		t.Fatalf("other route: got %+v, %v", limit, ok)
+	}
+	_, err = ParseRules("/check_car")
+	if !errors.Is(err, ErrInvalidLimit) {
+		t.Fatalf("rule without a limit: got %v", err)
+	}
+}
+
+func TestStoreRefill(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		clock := newClock()
+		limit := mustParse(t, "2/s:4")
+
+		// A new bucket is full.
+		for i := 0; i < 4; i++ {
+			expectTake(t, store, "alice", limit, clock.Now(), 0)
+		}
+		expectTake(t, store, "alice", limit, clock.Now(), 500*time.Millisecond)
+		// Waiting takes nothing, so the wait shrinks with the time passed.
+		clock.advance(250 * time.Millisecond)
+		expectTake(t, store, "alice", limit, clock.Now(), 250*time.Millisecond)
+		clock.advance(250 * time.Millisecond)
+		expectTake(t, store, "alice", limit, clock.Now(), 0)
+		expectTake(t, store, "alice", limit, clock.Now(), 500*time.Millisecond)
+
+		// Other keys have buckets of their own.
+		expectTake(t, store, "bob", limit, clock.Now(), 0)
+
+		// A bucket refills up to the burst only.
+		clock.advance(time.Hour)
+		for i := 0; i < 4; i++ {
+			expectTake(t, store, "alice", limit, clock.Now(), 0)
+		}
+		expectTake(t, store, "alice", limit, clock.Now(), 500*time.Millisecond)
+
+		// A clock going back refills nothing.
+		clock.advance(-time.Second)
+		expectTake(t, store, "alice", limit, clock.Now(), 500*time.Millisecond)
+	})
+}
+
+func TestStoreQuota(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		clock := newClock()
+		limit := mustParse(t, "2/d")
+
+		expectTake(t, store, "alice", limit, clock.Now(), 0)
+		expectTake(t, store, "alice", limit, clock.Now(), 0)
+		expectTake(t, store, "alice", limit, clock.Now(), 12*time.Hour)
+		clock.advance(6 * time.Hour)
+		expectTake(t, store, "alice", limit, clock.Now(), 6*time.Hour)
+		clock.advance(6 * time.Hour)
+		expectTake(t, store, "alice", limit, clock.Now(), 0)
+	})
+}
+
+func TestSQLStoreShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.sqlite")
+	first, err := NewSQLStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := NewSQLStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	clock := newClock()
+	limit := mustParse(t, "1/s:2")
+	expectTake(t, first, "alice", limit, clock.Now(), 0)
+	expectTake(t, second, "alice", limit, clock.Now(), 0)
+	expectTake(t, first, "alice", limit, clock.Now(), time.Second)
+	expectTake(t, second, "alice", limit, clock.Now(), time.Second)
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	clock := newClock()
+	store := NewMemoryStore()
+	limit := mustParse(t, "1/s:2")
+	slow := mustParse(t, "1/h")
+
+	expectTake(t, store, "refilled", limit, clock.Now(), 0)
+	expectTake(t, store, "empty", slow, clock.Now(), 0)
+	clock.advance(time.Minute)
+	// Every sweepEvery-th take sweeps.
+	for store.takes < sweepEvery-1 {
+		expectTake(t, store, "other", limit, clock.Now(), 0)
+		clock.advance(time.Second)
+	}
+	if len(store.buckets) != 3 {
+		t.Fatalf("got %d buckets before the sweep, want 3", len(store.buckets))
+	}
+	// The sweep forgets the buckets that refilled, including "other" from a
+	// second ago, and keeps the one still waiting for a token.
+	expectTake(t, store, "new", limit, clock.Now(), 0)
+	if len(store.buckets) != 2 || store.buckets["empty"] == nil || store.buckets["new"] == nil {
+		t.Fatalf("got buckets %v after the sweep, want empty and new", store.buckets)
+	}
+	expectTake(t, store, "empty", slow, clock.Now(), time.Hour-clock.Now().Sub(newClock().Now()))
+}
+
+func TestSQLStoreSweep(t *testing.T) {
+	clock := newClock()
+	store := stores["sqlite"](t).(*SQLStore)
+	limit := mustParse(t, "1/s:2")
+	slow := mustParse(t, "1/h")
+
+	expectTake(t, store, "refilled", limit, clock.Now(), 0)
+	expectTake(t, store, "empty", slow, clock.Now(), 0)
+	clock.advance(time.Minute)
+	for store.takes < sweepEvery-1 {
+		expectTake(t, store, "other", limit, clock.Now(), 0)
+		clock.advance(time.Second)
+	}
+	// Rows are deleted once they would have refilled.
+	expectTake(t, store, "new", limit, clock.Now(), 0)
+
+	keys := map[string]bool{}
+	rows, err := store.db.Query(`SELECT key FROM rate_limits`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[key] = true
+	}
+	if len(keys) != 2 || !keys["empty"] || !keys["new"] {
+		t.Fatalf("got keys %v after the sweep, want empty and new", keys)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(key string, limit Limit, now time.Time) (time.Duration, error) {
+	return 0, errors.New("database is locked")
+}
+
+func (failingStore) Close() error {
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	rules, err := ParseRules("GET /cars/{car_id}=1/m:2,*=1/s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := newClock()
+	limiter := New(rules, NewMemoryStore(), zap.NewNop().Sugar())
+	limiter.now = clock.Now
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /cars/{car_id}", func(rw http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/other", func(rw http.ResponseWriter, r *http.Request) {})
+	handler := limiter.Handler(mux, func(r *http.Request) string { return ClientIP(r) })
+
+	get := func(target string, remoteAddr string, retryAfter string) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.RemoteAddr = remoteAddr
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, r)
+		if retryAfter == "" && rw.Code != 200 {
+			t.Fatalf("%s from %s: got %d, want 200", target, remoteAddr, rw.Code)
+		}
+		if retryAfter != "" && (rw.Code != http.StatusTooManyRequests || rw.Header().Get("Retry-After") != retryAfter) {
+			t.Fatalf("%s from %s: got %d Retry-After %q, want 429 Retry-After %s", target, remoteAddr, rw.Code, rw.Header().Get("Retry-After"), retryAfter)
+		}
+	}
+
+	// Every car shares the bucket of the pattern.
+	get("/cars/1", "10.0.0.1:1000", "")
+	get("/cars/2", "10.0.0.1:1000", "")
+	get("/cars/3", "10.0.0.1:1000", "60")
+	get("/cars/3", "10.0.0.2:1000", "")
+	// Retry-After is rounded up to whole seconds.
+	clock.advance(59*time.Second + 500*time.Millisecond)
+	get("/cars/1", "10.0.0.1:1000", "1")
+	clock.advance(500 * time.Millisecond)
+	get("/cars/1", "10.0.0.1:1000", "")
+
+	// Routes without a rule of their own get "*".
+	get("/other", "10.0.0.1:1000", "")
+	get("/other", "10.0.0.1:1000", "1")
+
+	// A failing store lets requests through.
+	limiter.store = failingStore{}
+	get("/other", "10.0.0.1:1000", "")
+	if wait := limiter.Take("apikey:1", mustParse(t, "1/d")); wait != 0 {
+		t.Fatalf("failing store: got wait %v", wait)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for wait, want := range map[time.Duration]string{
+		time.Nanosecond:         "1",
+		time.Second:             "1",
+		1500 * time.Millisecond: "2",
+		time.Hour:               "3600",
+	} {
+		if got := RetryAfter(wait); got != want {
+			t.Errorf("RetryAfter(%v) = %s, want %s", wait, got, want)
+		}
+	}
+	rw := httptest.NewRecorder()
+	Reject(rw, 2500*time.Millisecond)
+	if rw.Code != http.StatusTooManyRequests || rw.Header().Get("Retry-After") != "3" {
+		t.Fatalf("got %d Retry-After %q", rw.Code, rw.Header().Get("Retry-After"))
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	for name, test := range map[string]struct {
+		remoteAddr string
+		realIP     string
+		want       string
+	}{
+		"direct":               {remoteAddr: "10.0.0.1:1000", want: "10.0.0.1"},
+		"spoofed header":       {remoteAddr: "10.0.0.1:1000", realIP: "192.168.1.1", want: "10.0.0.1"},
+		"proxy":                {remoteAddr: "127.0.0.1:1000", realIP: "192.168.1.1", want: "192.168.1.1"},
+		"ipv6 proxy":           {remoteAddr: "[::1]:1000", realIP: "192.168.1.1", want: "192.168.1.1"},
+		"proxy without header": {remoteAddr: "127.0.0.1:1000", want: "127.0.0.1"},
+		"ipv6":                 {remoteAddr: "[2001:db8::1]:1000", realIP: "192.168.1.1", want: "2001:db8::1"},
+		"no port":              {remoteAddr: "10.0.0.1", realIP: "192.168.1.1", want: "10.0.0.1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.realIP != "" {
+			r.Header.Set("X-Real-IP", test.realIP)
+		}
+		if got := ClientIP(r); got != test.want {
+			t.Errorf("%s: got %s, want %s", name, got, test.want)
+		}
+	}
+}
+
+func TestUserOrIP(t *testing.T) {
+	secret := []byte("secret")
+	sign := func(key []byte, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	key := UserOrIP(secret)
+	for name, test := range map[string]struct {
+		token string
+		want  string
+	}{
+		"no token":       {want: "ip:10.0.0.1"},
+		"session":        {token: sign(secret, jwt.MapClaims{"username": "alice", "user_id": 7}), want: "user:7"},
+		"oidc":           {token: sign(usertoken.OIDCKey(secret), jwt.MapClaims{"username": "alice", "user_id": 7, "scope": "openid"}), want: "user:7"},
+		"forged":         {token: sign([]byte("guess"), jwt.MapClaims{"username": "alice", "user_id": 8}), want: "ip:10.0.0.1"},
+		"scope dropped":  {token: sign(usertoken.OIDCKey(secret), jwt.MapClaims{"username": "alice", "user_id": 8}), want: "ip:10.0.0.1"},
+		"no user_id":     {token: sign(secret, jwt.MapClaims{"username": "alice"}), want: "ip:10.0.0.1"},
+		"user_id string": {token: sign(secret, jwt.MapClaims{"username": "alice", "user_id": "7"}), want: "ip:10.0.0.1"},
+		"expired":        {token: sign(secret, jwt.MapClaims{"user_id": 7, "exp": 1}), want: "ip:10.0.0.1"},
+		"not a jwt":      {token: "token", want: "ip:10.0.0.1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:1000"
+		if test.token != "" {
+			r.Header.Set("X-Auth", test.token)
+		}
+		if got := key(r); got != test.want {
+			t.Errorf("%s: got %s, want %s", name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"math"
+	_ "modernc.org/sqlite"
+	"sync"
+	"time"
+)
+
+// Store keeps the token buckets. Take refills the bucket of key for the time
+// since its last use and takes a token; if there is none it returns how long
+// until there will be, taking nothing.
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (time.Duration, error)
+	Close() error
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take applies Take to a bucket, a missing one being full.
+func (c Limit) take(b *bucket, found bool, now time.Time) time.Duration {
+	if !found {
+		b.tokens = c.Burst
+	} else if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(c.Burst, b.tokens+elapsed*c.Rate)
+	}
+	b.updated = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / c.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// full reports whether the bucket has refilled, so forgetting it changes nothing.
+func (c Limit) full(b bucket, now time.Time) bool {
+	return b.tokens+now.Sub(b.updated).Seconds()*c.Rate >= c.Burst
+}
+
+// sweepEvery is how many takes pass between sweeps of full buckets.
+const sweepEvery = 1024
+
+type memoryBucket struct {
+	bucket
+	limit Limit
+}
+
+// MemoryStore keeps the buckets of a single instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	takes   int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*memoryBucket{}}
+}
+
+func (c *MemoryStore) Take(key string, limit Limit, now time.Time) (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.takes++
+	if c.takes%sweepEvery == 0 {
+		for k, b := range c.buckets {
+			if b.limit.full(b.bucket, now) {
+				delete(c.buckets, k)
+			}
+		}
+	}
+
+	b, found := c.buckets[key]
+	if !found {
+		b = &memoryBucket{}
+		c.buckets[key] = b
+	}
+	b.limit = limit
+	return limit.take(&b.bucket, found, now), nil
+}
+
+func (c *MemoryStore) Close() error {
+	return nil
+}
+
+const rateLimitSchema = `
+CREATE TABLE IF NOT EXISTS rate_limits (
+	key     TEXT PRIMARY KEY,
+	tokens  REAL NOT NULL,
+	updated INTEGER NOT NULL,
+	expires INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS rate_limits_expires ON rate_limits (expires);
+`
+
+// SQLStore keeps the buckets in a SQLite database, so every instance opening
+// the same file shares the limits.
+type SQLStore struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	takes int
+}
+
+// NewSQLStore opens (and if needed creates) the database at path.
+func NewSQLStore(path string) (*SQLStore, error) {
+	// Transactions take the write lock up front and wait for other instances
+	// holding it instead of failing with SQLITE_BUSY.
+	db, err := sql.Open("sqlite", "file:"+path+"?_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(rateLimitSchema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (c *SQLStore) Take(key string, limit Limit, now time.Time) (time.Duration, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var b bucket
+	var updated int64
+	found := true
+	err = tx.QueryRow(`SELECT tokens, updated FROM rate_limits WHERE key = ?`, key).Scan(&b.tokens, &updated)
+	if err == sql.ErrNoRows {
+		found = false
+	} else if err != nil {
+		return 0, err
+	} else {
+		b.updated = time.Unix(0, updated)
+	}
+
+	wait := limit.take(&b, found, now)
+	expires := now.Add(time.Duration((limit.Burst - b.tokens) / limit.Rate * float64(time.Second)))
+	_, err = tx.Exec(`INSERT INTO rate_limits (key, tokens, updated, expires) VALUES (?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET tokens = excluded.tokens, updated = excluded.updated, expires = excluded.expires`,
+		key, b.tokens, b.updated.UnixNano(), expires.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+
+	if c.sweep() {
+		_, err = tx.Exec(`DELETE FROM rate_limits WHERE expires <= ?`, now.UnixNano())
+		if err != nil {
+			return 0, err
+		}
+	}
+	return wait, tx.Commit()
+}
+
+func (c *SQLStore) sweep() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.takes++
+	return c.takes%sweepEvery == 0
+}
+
+func (c *SQLStore) Close() error {
+	return c.db.Close()
+}
@@ -0,0 +1,149 @@
+// Package record implements the versioned envelope for records stored in the
+// service databases.
+//
+// An envelope is a marker byte followed by a protobuf message with the schema
+// version in field 1 and the encoded record in field 2. Records are encoded
+// with protobuf wire types as well, but every field is always written: unlike
+// JSON with omitempty, a zero day or id survives a round trip.
+//
+// Data written before envelopes existed is JSON and always starts with '{', so
+// Open reports it as version 0 and callers upgrade it on read.
+package record
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// marker starts every envelope. It can not start a JSON document.
+const marker = 0xB7
+
+const (
+	versionField = 1
+	payloadField = 2
+)
+
+var ErrMalformed = errors.New("malformed record")
+
+// Seal wraps an encoded record of the given schema version.
+func Seal(version uint64, payload []byte) []byte {
+	data := make([]byte, 0, len(payload)+12)
+	data = append(data, marker)
+	data = protowire.AppendTag(data, versionField, protowire.VarintType)
+	data = protowire.AppendVarint(data, version)
+	data = protowire.AppendTag(data, payloadField, protowire.BytesType)
+	return protowire.AppendBytes(data, payload)
+}
+
+// Open returns the schema version and payload of a stored value. Legacy JSON
+// values are returned unchanged with version 0.
+func Open(data []byte) (uint64, []byte, error) {
+	if len(data) > 0 && data[0] == '{' {
+		return 0, data, nil
+	}
+	if len(data) == 0 || data[0] != marker {
+		return 0, nil, ErrMalformed
+	}
+
+	var version uint64
+	var payload []byte
+	err := Walk(data[1:], func(f Field) error {
+		switch f.Number {
+		case versionField:
+			version = f.Varint
+		case payloadField:
+			payload = f.Bytes
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return version, payload, nil
+}
+
+// Field is one decoded protobuf field. Varint is set for varint fields and
+// Bytes for length-delimited ones.
+type Field struct {
+	Number protowire.Number
+	Varint uint64
+	Bytes  []byte
+}
+
+func (f Field) String() string {
+	return string(f.Bytes)
+}
+
+// Int64 decodes a field written by Encoder.Int64.
+func (f Field) Int64() int64 {
+	return protowire.DecodeZigZag(f.Varint)
+}
+
+// Bool decodes a field written by Encoder.Bool.
+func (f Field) Bool() bool {
+	return protowire.DecodeBool(f.Varint)
+}
+
+// Walk calls fn for every field of an encoded message. Fields of other wire
+// types are skipped, so old readers tolerate fields added later.
+func Walk(data []byte, fn func(f Field) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrMalformed, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		field := Field{Number: num}
+		switch typ {
+		case protowire.VarintType:
+			field.Varint, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			field.Bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n >= 0 {
+				data = data[n:]
+				continue
+			}
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrMalformed, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		err := fn(field)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encoder appends fields of a record. Every field is written, zero values included.
+type Encoder struct {
+	buf []byte
+}
+
+func (e *Encoder) Uint64(num protowire.Number, v uint64) {
+	e.buf = protowire.AppendTag(e.buf, num, protowire.VarintType)
+	e.buf = protowire.AppendVarint(e.buf, v)
+}
+
+func (e *Encoder) Int64(num protowire.Number, v int64) {
+	e.Uint64(num, protowire.EncodeZigZag(v))
+}
+
+func (e *Encoder) Bool(num protowire.Number, v bool) {
+	e.Uint64(num, protowire.EncodeBool(v))
+}
+
+func (e *Encoder) String(num protowire.Number, v string) {
+	e.buf = protowire.AppendTag(e.buf, num, protowire.BytesType)
+	e.buf = protowire.AppendString(e.buf, v)
+}
+
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
@@ -0,0 +1,68 @@
+package record
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	e := Encoder{}
+	e.Uint64(1, 0)
+	e.Int64(2, -5)
+	e.Bool(3, true)
+	e.String(4, "")
+	e.String(5, "airport")
+
+	version, payload, err := Open(Seal(3, e.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 3 || !bytes.Equal(payload, e.Bytes()) {
+		t.Fatalf("got version %d payload %x", version, payload)
+	}
+
+	fields := map[int]Field{}
+	err = Walk(payload, func(f Field) error {
+		fields[int(f.Number)] = f
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Zero values are written too.
+	if len(fields) != 5 || fields[1].Varint != 0 || fields[2].Int64() != -5 || !fields[3].Bool() || fields[4].String() != "" || fields[5].String() != "airport" {
+		t.Fatalf("got %+v", fields)
+	}
+
+	version, payload, err = Open([]byte(`{"car_id":1}`))
+	if err != nil || version != 0 || string(payload) != `{"car_id":1}` {
+		t.Fatalf("legacy JSON: got %d %q %v", version, payload, err)
+	}
+	for _, data := range [][]byte{nil, []byte("x"), Seal(1, e.Bytes())[:5]} {
+		_, _, err := Open(data)
+		if !errors.Is(err, ErrMalformed) {
+			t.Errorf("Open(%x): got %v, want %v", data, err, ErrMalformed)
+		}
+	}
+}
+
+func BenchmarkSeal(b *testing.B) {
+	payload := bytes.Repeat([]byte{1}, 64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Seal(1, payload)
+	}
+}
+
+func BenchmarkOpen(b *testing.B) {
+	data := Seal(1, bytes.Repeat([]byte{1}, 64))
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _, err := Open(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Package rest holds what the v1 REST routes of the services share with the
+// legacy routes they replace.
+//
+// Legacy routes take any method and read their whole request from a JSON
+// body, which proxies and clients drop from GET requests. v1 routes are
+// registered with their method, so other methods get 405, and name resources
+// in the path: "GET /v1/cars/{car_id}/availability?from=...". Both kinds of
+// route share their handlers, which read the request with Decode.
+package rest
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// InvalidParameter rejects a path or query parameter that does not parse
+// into its field.
+type InvalidParameter struct {
+	Name string
+	Err  error
+}
+
+func (c *InvalidParameter) Error() string {
+	return "invalid " + c.Name + ": " + c.Err.Error()
+}
+
+// Decode reads r into request, a pointer to a struct. A JSON body is decoded
+// first; then query parameters and path wildcards override the fields whose
+// json names they share, in that order, so an id in the path always wins.
+// Query parameters are only read for GET, HEAD and DELETE on routes
+// registered with their method, the v1 routes, whose secrets all travel in
+// bodies of other methods. Legacy routes take any method, so a password or
+// token would otherwise be read from the URL of a GET, and end up in access
+// logs. An empty request leaves request untouched.
+func Decode(r *http.Request, request interface{}) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		err = json.Unmarshal(body, request)
+		if err != nil {
+			return err
+		}
+	}
+
+	v := reflect.ValueOf(request)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("rest: request must be a pointer to a struct")
+	}
+	var query map[string][]string
+	_, _, withMethod := strings.Cut(r.Pattern, " ")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		if withMethod {
+			query = r.URL.Query()
+		}
+	}
+	return decodeParameters(r, query, v.Elem())
+}
+
+func decodeParameters(r *http.Request, query map[string][]string, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			err := decodeParameters(r, query, v.Field(i))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+
+		values := query[name]
+		if value := r.PathValue(name); value != "" {
+			values = []string{value}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		err := set(v.Field(i), values)
+		if err != nil {
+			return &InvalidParameter{Name: name, Err: err}
+		}
+	}
+	return nil
+}
+
+// set parses values into v. Only slices take more than one value; other
+// fields take the last one.
+func set(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Ptr {
+		target := reflect.New(v.Type().Elem())
+		err := set(target.Elem(), values)
+		if err != nil {
+			return err
+		}
+		v.Set(target)
+		return nil
+	}
+	s := values[len(values)-1]
+	if unmarshaler, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Slice:
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			err := set(slice.Index(i), []string{value})
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return errors.New("unsupported parameter type " + v.Type().String())
+	}
+	return nil
+}
+
+// Created answers 201 Created where handler answers 200 OK, for the v1 routes
+// that create a resource with a handler shared with a legacy route.
+func Created(handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		handler(&createdWriter{ResponseWriter: rw}, r)
+	}
+}
+
+type createdWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (c *createdWriter) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	if status == http.StatusOK {
+		status = http.StatusCreated
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *createdWriter) Write(b []byte) (int, error) {
+	c.WriteHeader(http.StatusOK)
+	return c.ResponseWriter.Write(b)
+}
@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testRequest struct {
+	CarID    uint64   `json:"car_id"`
+	Password string   `json:"password"`
+	Limit    *int     `json:"limit,omitempty"`
+	Tags     []string `json:"tags"`
+}
+
+// decode serves method target with body on a mux that has handler pattern,
+// and returns what Decode read.
+func decode(t *testing.T, pattern string, method string, target string, body string) (testRequest, error) {
+	t.Helper()
+	var request testRequest
+	var err error
+	mux := http.NewServeMux()
+	mux.HandleFunc(pattern, func(rw http.ResponseWriter, r *http.Request) {
+		err = Decode(r, &request)
+	})
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, target, strings.NewReader(body)))
+	return request, err
+}
+
+func TestDecode(t *testing.T) {
+	request, err := decode(t, "GET /v1/cars/{car_id}", http.MethodGet, "/v1/cars/42?limit=5&tags=a&tags=b", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.CarID != 42 || request.Limit == nil || *request.Limit != 5 || len(request.Tags) != 2 {
+		t.Fatalf("v1 GET: got %+v", request)
+	}
+
+	request, err = decode(t, "POST /v1/cars/{car_id}", http.MethodPost, "/v1/cars/42?car_id=7", `{"car_id":1,"password":"pw"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.CarID != 42 || request.Password != "pw" {
+		t.Fatalf("path over body: got %+v", request)
+	}
+
+	_, err = decode(t, "GET /v1/cars/{car_id}", http.MethodGet, "/v1/cars/x", "")
+	if _, ok := err.(*InvalidParameter); !ok {
+		t.Fatalf("invalid path parameter: got %v", err)
+	}
+	_, err = decode(t, "/auth_user", http.MethodPost, "/auth_user", `{"password":`)
+	if err == nil {
+		t.Fatal("malformed body accepted")
+	}
+}
+
+// TestDecodeQuerySecrets checks that a password in the URL is never read:
+// legacy routes take any method and read only their body, and v1 routes read
+// the query of GET, HEAD and DELETE only.
+func TestDecodeQuerySecrets(t *testing.T) {
+	for _, route := range []struct {
+		pattern string
+		method  string
+	}{
+		{"/auth_user", http.MethodGet},
+		{"/auth_user", http.MethodPost},
+		{"/auth_user", http.MethodDelete},
+		{"POST /v1/sessions", http.MethodPost},
+		{"PUT /v1/me/password", http.MethodPut},
+	} {
+		path := strings.TrimPrefix(route.pattern, route.method+" ")
+		request, err := decode(t, route.pattern, route.method, path+"?password=secret&car_id=1", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if request.Password != "" || request.CarID != 0 {
+			t.Errorf("%s %s read the query: %+v", route.method, route.pattern, request)
+		}
+	}
+}
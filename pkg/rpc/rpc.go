@@ -0,0 +1,181 @@
+// Package rpc holds what the gRPC APIs of the services share: the interceptors
+// that authenticate and rate limit calls and recover from panics, and the
+// mapping of errors to status codes.
+//
+// Calls are checked by the same code as HTTP requests. Request turns the
+// metadata and peer of a call into an *http.Request carrying the metadata as
+// headers, so x-auth, x-api-key, x-admin-token and a bearer service token in
+// authorization are read where the HTTP routes read them, and a client
+// certificate verified by mutual TLS is found in its TLS state.
+package rpc
+
+import (
+	"context"
+	"distributed-rental/pkg/ratelimit"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+)
+
+// Authenticator checks the credentials of a call to the full method name
+// method, read from r, and returns the context the call runs with, which
+// carries the caller. Its errors should be made by Error.
+type Authenticator func(ctx context.Context, method string, r *http.Request) (context.Context, error)
+
+// Guard checks every call to a gRPC server before its handler runs.
+type Guard struct {
+	Authenticate Authenticator
+	// Limiter counts calls under rules named by the full method name, as in
+	// "/booking.v1.BookingService/CheckCar=10/s:20". nil disables limits.
+	Limiter *ratelimit.Limiter
+	// Key names the caller a call is counted against.
+	Key    ratelimit.KeyFunc
+	Logger *zap.SugaredLogger
+}
+
+// Unary is the interceptor of the unary RPCs.
+func (c *Guard) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer c.recover(info.FullMethod, &err)
+		ctx, err = c.check(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream is the interceptor of the streaming RPCs.
+func (c *Guard) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer c.recover(info.FullMethod, &err)
+		ctx, err := c.check(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// recover fails a call that panicked with Internal, like net/http drops the
+// connection of a request that panicked, instead of taking the server down.
+func (c *Guard) recover(method string, err *error) {
+	if r := recover(); r != nil {
+		c.Logger.Errorf("panic: %s: %v\n%s", method, r, debug.Stack())
+		*err = status.Error(codes.Internal, "internal error")
+	}
+}
+
+func (c *Guard) check(ctx context.Context, method string) (context.Context, error) {
+	r := Request(ctx, method)
+	if c.Limiter != nil {
+		if wait := c.Limiter.Allow(method, r, c.Key); wait > 0 {
+			return nil, Error(http.StatusTooManyRequests, &ratelimit.Exceeded{Wait: wait})
+		}
+	}
+	ctx, err := c.Authenticate(ctx, method, r)
+	if err != nil {
+		c.Logger.Errorf("auth error: %s: %v", method, err)
+		if _, ok := status.FromError(err); !ok {
+			err = Error(http.StatusUnauthorized, err)
+		}
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// serverStream runs a stream with the context of its authenticated caller.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (c *serverStream) Context() context.Context {
+	return c.ctx
+}
+
+// Request is the call to the full method name method in ctx as an HTTP
+// request: metadata become headers, and the peer gives the remote address and
+// the TLS state.
+func Request(ctx context.Context, method string) *http.Request {
+	r := &http.Request{
+		Method:     http.MethodPost,
+		URL:        &url.URL{Path: method},
+		RequestURI: method,
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for name, values := range md {
+		if strings.HasPrefix(name, ":") || strings.HasSuffix(name, "-bin") {
+			continue
+		}
+		for _, value := range values {
+			r.Header.Add(name, value)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+	return r.WithContext(ctx)
+}
+
+// Code is the status code of a call an HTTP route would answer with
+// httpStatus.
+func Code(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusOK, http.StatusCreated:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+// Error is the status of a call that failed with err, which an HTTP route
+// would answer with httpStatus. Internal errors are not shown to the caller;
+// the handler logs them. A *ratelimit.Exceeded gets ResourceExhausted with
+// the wait as RetryInfo.
+func Error(httpStatus int, err error) error {
+	var exceeded *ratelimit.Exceeded
+	if errors.As(err, &exceeded) {
+		st, detailErr := status.New(codes.ResourceExhausted, err.Error()).WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(exceeded.Wait)})
+		if detailErr != nil {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return st.Err()
+	}
+	code := Code(httpStatus)
+	if code == codes.Internal {
+		return status.Error(code, "internal error")
+	}
+	return status.Error(code, err.Error())
+}
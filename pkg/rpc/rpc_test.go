@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"testing"
+)
+
+func testGuard() *Guard {
+	return &Guard{
+		Authenticate: func(ctx context.Context, method string, r *http.Request) (context.Context, error) {
+			return ctx, nil
+		},
+		Logger: zap.NewNop().Sugar(),
+	}
+}
+
+type testStream struct {
+	grpc.ServerStream
+}
+
+func (c testStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestUnaryRecover(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.v1.Test/Panic"}
+	resp, err := testGuard().Unary()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		var claims map[string]interface{}
+		return claims["user_id"].(float64), nil
+	})
+	if resp != nil || status.Code(err) != codes.Internal {
+		t.Fatalf("got %v, %v, want Internal", resp, err)
+	}
+
+	resp, err = testGuard().Unary()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	if resp != "ok" || err != nil {
+		t.Fatalf("got %v, %v", resp, err)
+	}
+}
+
+func TestStreamRecover(t *testing.T) {
+	info := &grpc.StreamServerInfo{FullMethod: "/test.v1.Test/Watch"}
+	err := testGuard().Stream()(nil, testStream{}, info, func(srv interface{}, stream grpc.ServerStream) error {
+		panic("boom")
+	})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("got %v, want Internal", err)
+	}
+}
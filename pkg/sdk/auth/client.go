@@ -0,0 +1,589 @@
+// Code generated by rentalctl gen-client from projects/auth/openapi.json; DO NOT EDIT.
+
+package auth
+
+import (
+	"distributed-rental/pkg/sdk"
+	"encoding/json"
+	"time"
+)
+
+// Client calls the auth service.
+type Client struct {
+	*sdk.Client
+}
+
+// New creates a client for the auth service listening on addr (host:port).
+func New(addr string) *Client {
+	return &Client{Client: sdk.New(addr)}
+}
+
+type APIKey struct {
+	KeyID      string     `json:"key_id"`
+	UserID     uint64     `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	RateLimit  string     `json:"rate_limit"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type APIKeyInfo struct {
+	KeyID     string   `json:"key_id"`
+	UserID    uint64   `json:"user_id"`
+	Username  string   `json:"username"`
+	Scopes    []string `json:"scopes"`
+	RateLimit string   `json:"rate_limit"`
+}
+
+type AuditEvent struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Username string    `json:"username,omitempty"`
+	IP       string    `json:"ip,omitempty"`
+}
+
+type AuditLogResponse struct {
+	Events []AuditEvent `json:"events"`
+}
+
+type AuthUserResponse struct {
+	Token        string `json:"token,omitempty"`
+	TOTPRequired bool   `json:"totp_required,omitempty"`
+	Challenge    string `json:"challenge,omitempty"`
+}
+
+type CheckTokenResponse struct {
+	UserID   uint64 `json:"user_id"`
+	Username string `json:"username"`
+}
+
+type CreateAPIKeyResponse struct {
+	KeyID      string     `json:"key_id"`
+	UserID     uint64     `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	RateLimit  string     `json:"rate_limit"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	APIKey     string     `json:"api_key"`
+}
+
+type CreateServiceClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	Scopes       []string  `json:"scopes"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientSecret string    `json:"client_secret"`
+}
+
+type CreateUserResponse struct {
+	UserID   uint64 `json:"user_id"`
+	Username string `json:"username,omitempty"`
+}
+
+type DataJob struct {
+	JobID     string                     `json:"job_id"`
+	Kind      string                     `json:"kind"`
+	UserID    uint64                     `json:"user_id"`
+	Status    string                     `json:"status"`
+	Steps     []string                   `json:"steps"`
+	Results   map[string]json.RawMessage `json:"results"`
+	Attempts  int64                      `json:"attempts"`
+	Error     string                     `json:"error,omitempty"`
+	CreatedAt time.Time                  `json:"created_at"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+}
+
+type ListAPIKeysResponse struct {
+	APIKeys []APIKey `json:"api_keys"`
+}
+
+type ListDataJobsResponse struct {
+	Jobs []DataJob `json:"jobs"`
+}
+
+type ListOIDCClientsResponse struct {
+	Clients []OIDCClient `json:"clients"`
+}
+
+type ListServiceClientsResponse struct {
+	Clients []ServiceClient `json:"clients"`
+}
+
+type ListUsersResponse struct {
+	Users []UserProfile `json:"users"`
+}
+
+type OIDCClient struct {
+	ClientID                string    `json:"client_id"`
+	ClientName              string    `json:"client_name"`
+	RedirectURIs            []string  `json:"redirect_uris"`
+	TokenEndpointAuthMethod string    `json:"token_endpoint_auth_method"`
+	CreatedAt               time.Time `json:"created_at"`
+}
+
+type RegisterOIDCClientResponse struct {
+	ClientID                string    `json:"client_id"`
+	ClientName              string    `json:"client_name"`
+	RedirectURIs            []string  `json:"redirect_uris"`
+	TokenEndpointAuthMethod string    `json:"token_endpoint_auth_method"`
+	CreatedAt               time.Time `json:"created_at"`
+	ClientSecret            string    `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64     `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64    `json:"client_secret_expires_at,omitempty"`
+}
+
+type ServiceClient struct {
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TOTPEnrollment struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type UserProfile struct {
+	UserID                 uint64 `json:"user_id"`
+	Username               string `json:"username"`
+	FullName               string `json:"full_name"`
+	Email                  string `json:"email"`
+	Phone                  string `json:"phone"`
+	DateOfBirth            string `json:"date_of_birth"`
+	DriverLicense          string `json:"driver_license"`
+	DriverLicenseCountry   string `json:"driver_license_country"`
+	DriverLicenseExpiresOn string `json:"driver_license_expires_on"`
+	DriverLicenseStatus    string `json:"driver_license_status"`
+	Disabled               bool   `json:"disabled"`
+}
+
+type AuditLogRequest struct {
+	Limit int64 `json:"limit,omitempty"`
+}
+
+// AuditLog calls GET /v1/admin/audit_log.
+//
+// List the latest security events.
+func (c *Client) AuditLog(request AuditLogRequest) (AuditLogResponse, error) {
+	var response AuditLogResponse
+	err := c.Do("GET", "/v1/admin/audit_log", &request, &response)
+	return response, err
+}
+
+type GetDataJobRequest struct {
+	JobID string `json:"-" path:"job_id"`
+}
+
+// GetDataJob calls GET /v1/admin/data_jobs/{job_id}.
+//
+// Get an export or erasure job.
+func (c *Client) GetDataJob(request GetDataJobRequest) (DataJob, error) {
+	var response DataJob
+	err := c.Do("GET", "/v1/admin/data_jobs/{job_id}", &request, &response)
+	return response, err
+}
+
+type RetryDataJobRequest struct {
+	JobID string `json:"-" path:"job_id"`
+}
+
+// RetryDataJob calls POST /v1/admin/data_jobs/{job_id}/retry.
+//
+// Retry a failed job.
+func (c *Client) RetryDataJob(request RetryDataJobRequest) (DataJob, error) {
+	var response DataJob
+	err := c.Do("POST", "/v1/admin/data_jobs/{job_id}/retry", &request, &response)
+	return response, err
+}
+
+// ListOIDCClients calls GET /v1/admin/oidc_clients.
+//
+// List the OpenID Connect clients.
+func (c *Client) ListOIDCClients() (ListOIDCClientsResponse, error) {
+	var response ListOIDCClientsResponse
+	err := c.Do("GET", "/v1/admin/oidc_clients", nil, &response)
+	return response, err
+}
+
+type RegisterOIDCClientRequest struct {
+	ClientName              string   `json:"client_name,omitempty"`
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+}
+
+// RegisterOIDCClient calls POST /v1/admin/oidc_clients.
+//
+// Register an OpenID Connect client; the secret is only shown once.
+func (c *Client) RegisterOIDCClient(request RegisterOIDCClientRequest) (RegisterOIDCClientResponse, error) {
+	var response RegisterOIDCClientResponse
+	err := c.Do("POST", "/v1/admin/oidc_clients", &request, &response)
+	return response, err
+}
+
+type DeleteOIDCClientRequest struct {
+	ClientID string `json:"-" path:"client_id"`
+}
+
+// DeleteOIDCClient calls DELETE /v1/admin/oidc_clients/{client_id}.
+//
+// Delete an OpenID Connect client.
+func (c *Client) DeleteOIDCClient(request DeleteOIDCClientRequest) error {
+	return c.Do("DELETE", "/v1/admin/oidc_clients/{client_id}", &request, nil)
+}
+
+// ListServiceClients calls GET /v1/admin/service_clients.
+//
+// List the service clients.
+func (c *Client) ListServiceClients() (ListServiceClientsResponse, error) {
+	var response ListServiceClientsResponse
+	err := c.Do("GET", "/v1/admin/service_clients", nil, &response)
+	return response, err
+}
+
+type CreateServiceClientRequest struct {
+	ClientID string   `json:"client_id,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+}
+
+// CreateServiceClient calls POST /v1/admin/service_clients.
+//
+// Create a service client; the secret is only shown once.
+func (c *Client) CreateServiceClient(request CreateServiceClientRequest) (CreateServiceClientResponse, error) {
+	var response CreateServiceClientResponse
+	err := c.Do("POST", "/v1/admin/service_clients", &request, &response)
+	return response, err
+}
+
+type DeleteServiceClientRequest struct {
+	ClientID string `json:"-" path:"client_id"`
+}
+
+// DeleteServiceClient calls DELETE /v1/admin/service_clients/{client_id}.
+//
+// Delete a service client.
+func (c *Client) DeleteServiceClient(request DeleteServiceClientRequest) error {
+	return c.Do("DELETE", "/v1/admin/service_clients/{client_id}", &request, nil)
+}
+
+type UnlockRequest struct {
+	Username string `json:"username,omitempty"`
+	IP       string `json:"ip,omitempty"`
+}
+
+// Unlock calls POST /v1/admin/unlock.
+//
+// Clear the failed login attempts of a user or an address.
+func (c *Client) Unlock(request UnlockRequest) error {
+	return c.Do("POST", "/v1/admin/unlock", &request, nil)
+}
+
+type ListUsersRequest struct {
+	After *uint64 `json:"after,omitempty"`
+	Limit int64   `json:"limit,omitempty"`
+	Query string  `json:"query,omitempty"`
+}
+
+// ListUsers calls GET /v1/admin/users.
+//
+// List users by id, optionally matching a query.
+func (c *Client) ListUsers(request ListUsersRequest) (ListUsersResponse, error) {
+	var response ListUsersResponse
+	err := c.Do("GET", "/v1/admin/users", &request, &response)
+	return response, err
+}
+
+type GetUserRequest struct {
+	UserID uint64 `json:"-" path:"user_id"`
+}
+
+// GetUser calls GET /v1/admin/users/{user_id}.
+//
+// Get the profile of a user.
+func (c *Client) GetUser(request GetUserRequest) (UserProfile, error) {
+	var response UserProfile
+	err := c.Do("GET", "/v1/admin/users/{user_id}", &request, &response)
+	return response, err
+}
+
+type ListDataJobsRequest struct {
+	UserID uint64 `json:"-" path:"user_id"`
+}
+
+// ListDataJobs calls GET /v1/admin/users/{user_id}/data_jobs.
+//
+// List the export and erasure jobs of a user.
+func (c *Client) ListDataJobs(request ListDataJobsRequest) (ListDataJobsResponse, error) {
+	var response ListDataJobsResponse
+	err := c.Do("GET", "/v1/admin/users/{user_id}/data_jobs", &request, &response)
+	return response, err
+}
+
+type DisableUserRequest struct {
+	UserID uint64 `json:"-" path:"user_id"`
+}
+
+// DisableUser calls POST /v1/admin/users/{user_id}/disable.
+//
+// Disable a user and revoke their tokens.
+func (c *Client) DisableUser(request DisableUserRequest) (UserProfile, error) {
+	var response UserProfile
+	err := c.Do("POST", "/v1/admin/users/{user_id}/disable", &request, &response)
+	return response, err
+}
+
+type EnableUserRequest struct {
+	UserID uint64 `json:"-" path:"user_id"`
+}
+
+// EnableUser calls POST /v1/admin/users/{user_id}/enable.
+//
+// Enable a disabled user.
+func (c *Client) EnableUser(request EnableUserRequest) (UserProfile, error) {
+	var response UserProfile
+	err := c.Do("POST", "/v1/admin/users/{user_id}/enable", &request, &response)
+	return response, err
+}
+
+type EraseUserRequest struct {
+	UserID uint64 `json:"-" path:"user_id"`
+}
+
+// EraseUser calls POST /v1/admin/users/{user_id}/erase.
+//
+// Start erasing the personal data of a user in all services.
+func (c *Client) EraseUser(request EraseUserRequest) (DataJob, error) {
+	var response DataJob
+	err := c.Do("POST", "/v1/admin/users/{user_id}/erase", &request, &response)
+	return response, err
+}
+
+type ExportUserRequest struct {
+	UserID uint64 `json:"-" path:"user_id"`
+}
+
+// ExportUser calls POST /v1/admin/users/{user_id}/export.
+//
+// Start exporting the data of a user from all services.
+func (c *Client) ExportUser(request ExportUserRequest) (DataJob, error) {
+	var response DataJob
+	err := c.Do("POST", "/v1/admin/users/{user_id}/export", &request, &response)
+	return response, err
+}
+
+type VerifyLicenseRequest struct {
+	UserID uint64 `json:"-" path:"user_id"`
+	Status string `json:"status,omitempty"`
+}
+
+// VerifyLicense calls PUT /v1/admin/users/{user_id}/license.
+//
+// Set the status of the driving license of a user.
+func (c *Client) VerifyLicense(request VerifyLicenseRequest) (UserProfile, error) {
+	var response UserProfile
+	err := c.Do("PUT", "/v1/admin/users/{user_id}/license", &request, &response)
+	return response, err
+}
+
+// ListAPIKeys calls GET /v1/api_keys.
+//
+// List the API keys of the caller.
+func (c *Client) ListAPIKeys() (ListAPIKeysResponse, error) {
+	var response ListAPIKeysResponse
+	err := c.Do("GET", "/v1/api_keys", nil, &response)
+	return response, err
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name,omitempty"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	RateLimit string     `json:"rate_limit,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateAPIKey calls POST /v1/api_keys.
+//
+// Create an API key; the key is only shown once.
+func (c *Client) CreateAPIKey(request CreateAPIKeyRequest) (CreateAPIKeyResponse, error) {
+	var response CreateAPIKeyResponse
+	err := c.Do("POST", "/v1/api_keys", &request, &response)
+	return response, err
+}
+
+type VerifyAPIKeyRequest struct {
+	APIKey string `json:"api_key,omitempty"`
+}
+
+// VerifyAPIKey calls POST /v1/api_keys/verify.
+//
+// Check an API key.
+func (c *Client) VerifyAPIKey(request VerifyAPIKeyRequest) (APIKeyInfo, error) {
+	var response APIKeyInfo
+	err := c.Do("POST", "/v1/api_keys/verify", &request, &response)
+	return response, err
+}
+
+type RevokeAPIKeyRequest struct {
+	KeyID string `json:"-" path:"key_id"`
+}
+
+// RevokeAPIKey calls DELETE /v1/api_keys/{key_id}.
+//
+// Revoke an API key of the caller.
+func (c *Client) RevokeAPIKey(request RevokeAPIKeyRequest) error {
+	return c.Do("DELETE", "/v1/api_keys/{key_id}", &request, nil)
+}
+
+// GetMe calls GET /v1/me.
+//
+// Get the profile of the caller.
+func (c *Client) GetMe() (UserProfile, error) {
+	var response UserProfile
+	err := c.Do("GET", "/v1/me", nil, &response)
+	return response, err
+}
+
+type UpdateMeRequest struct {
+	FullName               *string `json:"full_name,omitempty"`
+	Email                  *string `json:"email,omitempty"`
+	Phone                  *string `json:"phone,omitempty"`
+	DateOfBirth            *string `json:"date_of_birth,omitempty"`
+	DriverLicense          *string `json:"driver_license,omitempty"`
+	DriverLicenseCountry   *string `json:"driver_license_country,omitempty"`
+	DriverLicenseExpiresOn *string `json:"driver_license_expires_on,omitempty"`
+}
+
+// UpdateMe calls PATCH /v1/me.
+//
+// Update the profile of the caller; fields left out are kept and an empty string clears one.
+func (c *Client) UpdateMe(request UpdateMeRequest) (UserProfile, error) {
+	var response UserProfile
+	err := c.Do("PATCH", "/v1/me", &request, &response)
+	return response, err
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password,omitempty"`
+	NewPassword string `json:"new_password,omitempty"`
+}
+
+// ChangePassword calls PUT /v1/me/password.
+//
+// Change the password and get a new token.
+func (c *Client) ChangePassword(request ChangePasswordRequest) (AuthUserResponse, error) {
+	var response AuthUserResponse
+	err := c.Do("PUT", "/v1/me/password", &request, &response)
+	return response, err
+}
+
+// EnrollTOTP calls POST /v1/me/totp.
+//
+// Start enrolling a TOTP authenticator.
+func (c *Client) EnrollTOTP() (TOTPEnrollment, error) {
+	var response TOTPEnrollment
+	err := c.Do("POST", "/v1/me/totp", nil, &response)
+	return response, err
+}
+
+type ConfirmTOTPRequest struct {
+	Code string `json:"code,omitempty"`
+}
+
+// ConfirmTOTP calls POST /v1/me/totp/confirm.
+//
+// Enable TOTP with a first code.
+func (c *Client) ConfirmTOTP(request ConfirmTOTPRequest) error {
+	return c.Do("POST", "/v1/me/totp/confirm", &request, nil)
+}
+
+type DisableTOTPRequest struct {
+	Code string `json:"code,omitempty"`
+}
+
+// DisableTOTP calls POST /v1/me/totp/disable.
+//
+// Disable TOTP with a current code.
+func (c *Client) DisableTOTP(request DisableTOTPRequest) error {
+	return c.Do("POST", "/v1/me/totp/disable", &request, nil)
+}
+
+type RequestPasswordResetRequest struct {
+	Username string `json:"username,omitempty"`
+}
+
+// RequestPasswordReset calls POST /v1/password_resets.
+//
+// Send a password reset token; the answer is the same for unknown users.
+func (c *Client) RequestPasswordReset(request RequestPasswordResetRequest) error {
+	return c.Do("POST", "/v1/password_resets", &request, nil)
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token,omitempty"`
+	NewPassword string `json:"new_password,omitempty"`
+}
+
+// ResetPassword calls POST /v1/password_resets/confirm.
+//
+// Set a new password with a reset token.
+func (c *Client) ResetPassword(request ResetPasswordRequest) error {
+	return c.Do("POST", "/v1/password_resets/confirm", &request, nil)
+}
+
+type CreateSessionRequest struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// CreateSession calls POST /v1/sessions.
+//
+// Log in with a password; users with TOTP get a challenge instead of a token.
+func (c *Client) CreateSession(request CreateSessionRequest) (AuthUserResponse, error) {
+	var response AuthUserResponse
+	err := c.Do("POST", "/v1/sessions", &request, &response)
+	return response, err
+}
+
+type CreateTOTPSessionRequest struct {
+	Challenge string `json:"challenge,omitempty"`
+	Code      string `json:"code,omitempty"`
+}
+
+// CreateTOTPSession calls POST /v1/sessions/totp.
+//
+// Finish a login with the challenge and a TOTP code.
+func (c *Client) CreateTOTPSession(request CreateTOTPSessionRequest) (AuthUserResponse, error) {
+	var response AuthUserResponse
+	err := c.Do("POST", "/v1/sessions/totp", &request, &response)
+	return response, err
+}
+
+type VerifyTokenRequest struct {
+	Token string `json:"token,omitempty"`
+}
+
+// VerifyToken calls POST /v1/tokens/verify.
+//
+// Check an access token.
+func (c *Client) VerifyToken(request VerifyTokenRequest) (CheckTokenResponse, error) {
+	var response CheckTokenResponse
+	err := c.Do("POST", "/v1/tokens/verify", &request, &response)
+	return response, err
+}
+
+type CreateUserRequest struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// CreateUser calls POST /v1/users.
+//
+// Create a user.
+func (c *Client) CreateUser(request CreateUserRequest) (CreateUserResponse, error) {
+	var response CreateUserResponse
+	err := c.Do("POST", "/v1/users", &request, &response)
+	return response, err
+}
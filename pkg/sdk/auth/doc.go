@@ -0,0 +1,6 @@
+// Package auth is the client of the auth REST API v1, generated from
+// projects/auth/openapi.json.
+package auth
+
+//go:generate go run ../../../projects/auth/cmd -openapi ../../../projects/auth/openapi.json
+//go:generate go run ../../../projects/rentalctl/cmd gen-client -spec ../../../projects/auth/openapi.json -package auth
@@ -0,0 +1,6 @@
+// Package booking is the client of the booking REST API v1, generated from
+// projects/booking/openapi.json.
+package booking
+
+//go:generate go run ../../../projects/booking/cmd -openapi ../../../projects/booking/openapi.json
+//go:generate go run ../../../projects/rentalctl/cmd gen-client -spec ../../../projects/booking/openapi.json -package booking
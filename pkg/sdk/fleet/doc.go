@@ -0,0 +1,6 @@
+// Package fleet is the client of the fleet REST API v1, generated from
+// projects/fleet/openapi.json.
+package fleet
+
+//go:generate go run ../../../projects/fleet/cmd -openapi ../../../projects/fleet/openapi.json
+//go:generate go run ../../../projects/rentalctl/cmd gen-client -spec ../../../projects/fleet/openapi.json -package fleet
@@ -0,0 +1,6 @@
+// Package lease is the client of the lease REST API v1, generated from
+// projects/lease/openapi.json.
+package lease
+
+//go:generate go run ../../../projects/lease/cmd -openapi ../../../projects/lease/openapi.json
+//go:generate go run ../../../projects/rentalctl/cmd gen-client -spec ../../../projects/lease/openapi.json -package lease
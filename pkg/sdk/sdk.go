@@ -0,0 +1,202 @@
+// Package sdk is the runtime of the clients of the REST API v1 generated in
+// its subpackages, one per service, from the OpenAPI documents the services
+// serve at /openapi.json. See pkg/openapi for how they are kept in step.
+package sdk
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Error is an answer of the service other than 2xx.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (c *Error) Error() string {
+	return fmt.Sprintf("status %d: %s", c.StatusCode, c.Message)
+}
+
+// Client sends requests with the credentials set on it. Generated clients
+// embed it.
+type Client struct {
+	addr       string
+	scheme     string
+	httpClient *http.Client
+	header     http.Header
+}
+
+// New creates a client for the service listening on addr (host:port).
+func New(addr string) *Client {
+	return &Client{
+		addr:       addr,
+		scheme:     "http",
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		header:     http.Header{},
+	}
+}
+
+// SetTimeout limits how long a single call may take.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.httpClient.Timeout = timeout
+}
+
+// SetTLS makes calls over HTTPS with config, which also holds the client
+// certificate for mutual TLS. A nil config keeps plain HTTP.
+func (c *Client) SetTLS(config *tls.Config) {
+	if config == nil {
+		return
+	}
+	c.scheme = "https"
+	c.httpClient.Transport = &http.Transport{TLSClientConfig: config}
+}
+
+// SetToken sends a user access token in X-Auth.
+func (c *Client) SetToken(token string) {
+	c.set("X-Auth", token)
+}
+
+// SetAPIKey sends an API key in X-API-Key.
+func (c *Client) SetAPIKey(key string) {
+	c.set("X-API-Key", key)
+}
+
+// SetAdminToken sends the admin token in X-Admin-Token.
+func (c *Client) SetAdminToken(token string) {
+	c.set("X-Admin-Token", token)
+}
+
+// SetServiceToken sends a service token as a bearer token.
+func (c *Client) SetServiceToken(token string) {
+	if token == "" {
+		c.set("Authorization", "")
+		return
+	}
+	c.set("Authorization", "Bearer "+token)
+}
+
+func (c *Client) set(header string, value string) {
+	if value == "" {
+		c.header.Del(header)
+		return
+	}
+	c.header.Set(header, value)
+}
+
+// Do sends request to method and path and decodes the answer into response.
+// Fields of request tagged path fill the wildcards of path; the others are
+// sent as query parameters for GET, HEAD and DELETE and as a JSON body
+// otherwise. request and response may be nil.
+func (c *Client) Do(method string, path string, request interface{}, response interface{}) error {
+	var query url.Values
+	var body []byte
+	if request != nil {
+		var err error
+		path, err = expandPath(path, request)
+		if err != nil {
+			return err
+		}
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodDelete:
+			query, err = queryValues(request)
+		default:
+			body, err = json.Marshal(request)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	u := c.scheme + "://" + c.addr + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for header, values := range c.header {
+		req.Header[header] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("request %s %s: error reading body: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &Error{StatusCode: resp.StatusCode, Message: string(bytes.TrimSpace(respBody))}
+	}
+	if response == nil || len(bytes.TrimSpace(respBody)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, response)
+}
+
+// expandPath replaces the wildcards of path with the fields of request
+// tagged path.
+func expandPath(path string, request interface{}) (string, error) {
+	v := reflect.Indirect(reflect.ValueOf(request))
+	if v.Kind() != reflect.Struct {
+		return path, nil
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("path")
+		if name == "" {
+			continue
+		}
+		value := url.PathEscape(fmt.Sprint(v.Field(i).Interface()))
+		path = strings.ReplaceAll(path, "{"+name+"}", value)
+	}
+	if strings.Contains(path, "{") {
+		return "", fmt.Errorf("sdk: path %s has a wildcard without a field", path)
+	}
+	return path, nil
+}
+
+// queryValues encodes request as query parameters named like its json
+// fields, so that times and omitempty work as they do in bodies.
+func queryValues(request interface{}) (url.Values, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	err = decoder.Decode(&fields)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	for name, value := range fields {
+		if values, ok := value.([]interface{}); ok {
+			for _, value := range values {
+				query.Add(name, fmt.Sprint(value))
+			}
+			continue
+		}
+		if value != nil {
+			query.Set(name, fmt.Sprint(value))
+		}
+	}
+	return query, nil
+}
@@ -0,0 +1,160 @@
+// Package servicetoken issues and checks the tokens services present when they
+// call each other. The auth service hands them out to registered service
+// clients for the OAuth2 client credentials grant; the other services check
+// them offline with the shared JWT secret.
+//
+// A token names its client and carries scopes like "booking:read": the
+// service, then read or write. Tokens are signed with a key derived from the
+// JWT secret, so a service token is never taken for a user's access token and
+// the other way round.
+package servicetoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Scopes of the internal endpoints.
+const (
+	ScopeBookingRead  = "booking:read"
+	ScopeBookingWrite = "booking:write"
+	ScopeLeaseRead    = "lease:read"
+	ScopeLeaseWrite   = "lease:write"
+	ScopeFleetWrite   = "fleet:write"
+)
+
+// Scopes lists every scope a client may be granted.
+var Scopes = []string{ScopeBookingRead, ScopeBookingWrite, ScopeLeaseRead, ScopeLeaseWrite, ScopeFleetWrite}
+
+var ErrMissingToken = errors.New("service token is required")
+var ErrInvalidToken = errors.New("invalid service token")
+
+// InsufficientScope rejects a valid token that lacks the scope of an endpoint.
+type InsufficientScope struct {
+	Scope string
+}
+
+func (c *InsufficientScope) Error() string {
+	return "service token lacks scope " + c.Scope
+}
+
+// Claims is what a service token says about its holder.
+type Claims struct {
+	ClientID  string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// HasScope reports whether the token grants scope.
+func (c Claims) HasScope(scope string) bool {
+	for _, granted := range c.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidScope reports whether scope is one of Scopes.
+func ValidScope(scope string) bool {
+	for _, known := range Scopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Key derives the signing key of service tokens from the JWT secret.
+func Key(jwtSecret []byte) []byte {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("service token"))
+	return mac.Sum(nil)
+}
+
+// Issue signs a token for clientID granting scopes until expiresAt.
+func Issue(key []byte, clientID string, scopes []string, expiresAt time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"client_id": clientID,
+		"scope":     strings.Join(scopes, " "),
+		"exp":       expiresAt.Unix(),
+	})
+	return token.SignedString(key)
+}
+
+// Parse checks the signature and expiry of token.
+func Parse(key []byte, token string) (Claims, error) {
+	tokenObj, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return key, nil
+	})
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	claims, ok := tokenObj.Claims.(jwt.MapClaims)
+	if !ok {
+		return Claims{}, ErrInvalidToken
+	}
+	clientID, _ := claims["client_id"].(string)
+	scope, _ := claims["scope"].(string)
+	expiresAt, hasExpiry := claims["exp"].(float64)
+	if clientID == "" || !hasExpiry {
+		return Claims{}, fmt.Errorf("%w: client_id and exp are required", ErrInvalidToken)
+	}
+	return Claims{
+		ClientID:  clientID,
+		Scopes:    strings.Fields(scope),
+		ExpiresAt: time.Unix(int64(expiresAt), 0),
+	}, nil
+}
+
+// Bearer returns the token of an "Authorization: Bearer <token>" header.
+func Bearer(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Check returns the claims of the bearer token of r if it grants scope. With
+// requireCert the request must also come with a client certificate verified
+// by the server, issued to the client the token names.
+func Check(key []byte, r *http.Request, scope string, requireCert bool) (Claims, error) {
+	token := Bearer(r)
+	if token == "" {
+		return Claims{}, ErrMissingToken
+	}
+	claims, err := Parse(key, token)
+	if err != nil {
+		return Claims{}, err
+	}
+	if requireCert {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			return Claims{}, fmt.Errorf("%w: a client certificate is required", ErrInvalidToken)
+		}
+		if name := r.TLS.VerifiedChains[0][0].Subject.CommonName; name != claims.ClientID {
+			return Claims{}, fmt.Errorf("%w: issued to %s but presented by %s", ErrInvalidToken, claims.ClientID, name)
+		}
+	}
+	if !claims.HasScope(scope) {
+		return Claims{}, &InsufficientScope{Scope: scope}
+	}
+	return claims, nil
+}
+
+// Status is the HTTP status answering a request that failed Check.
+func Status(err error) int {
+	if _, ok := err.(*InsufficientScope); ok {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
@@ -0,0 +1,168 @@
+package servicetoken
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var jwtSecret = []byte("secret")
+
+func issue(t *testing.T, key []byte, clientID string, expiresAt time.Time, scopes ...string) string {
+	t.Helper()
+	token, err := Issue(key, clientID, scopes, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// userToken signs an access token the way the auth service does for users.
+func userToken(t *testing.T) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username":  "alice",
+		"user_id":   7,
+		"client_id": "alice",
+		"scope":     ScopeBookingRead,
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestParse(t *testing.T) {
+	key := Key(jwtSecret)
+	expiresAt := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	claims, err := Parse(key, issue(t, key, "fleet", expiresAt, ScopeBookingRead, ScopeLeaseRead))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ClientID != "fleet" || !claims.ExpiresAt.Equal(expiresAt) || len(claims.Scopes) != 2 ||
+		!claims.HasScope(ScopeBookingRead) || !claims.HasScope(ScopeLeaseRead) || claims.HasScope(ScopeBookingWrite) {
+		t.Fatalf("got %+v", claims)
+	}
+
+	for name, token := range map[string]string{
+		"expired":        issue(t, key, "fleet", time.Now().Add(-time.Minute), ScopeBookingRead),
+		"other secret":   issue(t, Key([]byte("other")), "fleet", expiresAt, ScopeBookingRead),
+		"no client_id":   issue(t, key, "", expiresAt, ScopeBookingRead),
+		"user token":     userToken(t),
+		"not a token":    "fleet",
+		"signed by none": mustSign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType),
+	} {
+		_, err := Parse(key, token)
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalidToken)
+		}
+	}
+}
+
+func mustSign(t *testing.T, method jwt.SigningMethod, key interface{}) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, jwt.MapClaims{"client_id": "fleet", "scope": ScopeBookingRead, "exp": time.Now().Add(time.Hour).Unix()}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// TestKeySeparation checks that user access tokens and service tokens, both
+// derived from the JWT secret, are never taken for each other.
+func TestKeySeparation(t *testing.T) {
+	if string(Key(jwtSecret)) == string(jwtSecret) {
+		t.Fatal("the service token key is the JWT secret")
+	}
+	r := httptest.NewRequest(http.MethodPost, "/car_bookings", nil)
+	r.Header.Set("Authorization", "Bearer "+userToken(t))
+	_, err := Check(Key(jwtSecret), r, ScopeBookingRead, false)
+	if !errors.Is(err, ErrInvalidToken) || Status(err) != http.StatusUnauthorized {
+		t.Fatalf("user token as a service token: got %v", err)
+	}
+
+	token := issue(t, Key(jwtSecret), "fleet", time.Now().Add(time.Hour), ScopeBookingRead)
+	_, err = jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	})
+	if err == nil {
+		t.Fatal("a service token verifies with the JWT secret")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	key := Key(jwtSecret)
+	expiresAt := time.Now().Add(time.Hour)
+	for _, test := range []struct {
+		name   string
+		header string
+		scope  string
+		status int
+	}{
+		{"no header", "", ScopeBookingRead, http.StatusUnauthorized},
+		{"not bearer", "Basic " + issue(t, key, "fleet", expiresAt, ScopeBookingRead), ScopeBookingRead, http.StatusUnauthorized},
+		{"granted", "Bearer " + issue(t, key, "fleet", expiresAt, ScopeBookingRead), ScopeBookingRead, http.StatusOK},
+		{"lower case scheme", "bearer " + issue(t, key, "fleet", expiresAt, ScopeBookingRead), ScopeBookingRead, http.StatusOK},
+		{"one of several", "Bearer " + issue(t, key, "fleet", expiresAt, ScopeLeaseRead, ScopeBookingWrite), ScopeBookingWrite, http.StatusOK},
+		{"read for write", "Bearer " + issue(t, key, "fleet", expiresAt, ScopeBookingRead), ScopeBookingWrite, http.StatusForbidden},
+		// Scopes name the service, so a token for booking is no good for lease.
+		{"other service", "Bearer " + issue(t, key, "fleet", expiresAt, ScopeBookingRead, ScopeBookingWrite), ScopeLeaseRead, http.StatusForbidden},
+		{"no scopes", "Bearer " + issue(t, key, "fleet", expiresAt), ScopeBookingRead, http.StatusForbidden},
+		{"expired", "Bearer " + issue(t, key, "fleet", time.Now().Add(-time.Minute), ScopeBookingRead), ScopeBookingRead, http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/car_bookings", nil)
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+		claims, err := Check(key, r, test.scope, false)
+		status := http.StatusOK
+		if err != nil {
+			status = Status(err)
+		}
+		if status != test.status {
+			t.Errorf("%s: got %d (%v), want %d", test.name, status, err, test.status)
+		}
+		if err == nil && claims.ClientID != "fleet" {
+			t.Errorf("%s: got client %q", test.name, claims.ClientID)
+		}
+	}
+}
+
+func TestCheckCertificate(t *testing.T) {
+	key := Key(jwtSecret)
+	token := issue(t, key, "fleet", time.Now().Add(time.Hour), ScopeBookingRead)
+	chain := func(name string) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: name}}}}}
+	}
+
+	for _, test := range []struct {
+		name        string
+		state       *tls.ConnectionState
+		requireCert bool
+		valid       bool
+	}{
+		{"plain without mutual TLS", nil, false, true},
+		{"plain", nil, true, false},
+		{"no client certificate", &tls.ConnectionState{}, true, false},
+		{"certificate of the client", chain("fleet"), true, true},
+		{"certificate of another client", chain("booking"), true, false},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/car_bookings", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.TLS = test.state
+		_, err := Check(key, r, ScopeBookingRead, test.requireCert)
+		if test.valid != (err == nil) {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+		if err != nil && Status(err) != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d, want 401", test.name, Status(err))
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Package usertoken checks the signature of the access tokens users present in
+// X-Auth. Session tokens of /auth_user are signed with the JWT secret itself.
+// Access tokens of the OpenID Connect provider carry a scope claim and are
+// signed with a key derived from the secret, so a token granted to a client
+// can not be passed off as a session token by dropping its scope: the auth
+// service keeps account management to session tokens, while the other
+// services accept both.
+package usertoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+)
+
+// OIDCKey derives the signing key of OpenID Connect access tokens from the
+// JWT secret.
+func OIDCKey(jwtSecret []byte) []byte {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("oidc access token"))
+	return mac.Sum(nil)
+}
+
+// Scoped reports whether claims are those of an OpenID Connect access token.
+func Scoped(claims jwt.MapClaims) bool {
+	_, ok := claims["scope"]
+	return ok
+}
+
+// Keyfunc verifies session tokens with jwtSecret and OpenID Connect access
+// tokens with OIDCKey.
+func Keyfunc(jwtSecret []byte) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if ok && Scoped(claims) {
+			return OIDCKey(jwtSecret), nil
+		}
+		return jwtSecret, nil
+	}
+}
@@ -0,0 +1,218 @@
+// Package client is the HTTP client other services use to find out whether an
+// access token was revoked in the auth service or an API key is valid, to
+// look up the driver behind either and to get service tokens for their own
+// calls.
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"distributed-rental/pkg/apikey"
+	"distributed-rental/pkg/eligibility"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+var ErrKeyRejected = errors.New("api key is unknown, revoked or expired")
+
+type Client struct {
+	addr       string
+	scheme     string
+	httpClient *http.Client
+	cacheTTL   time.Duration
+
+	mu    sync.Mutex
+	valid map[string]time.Time
+	keys  map[string]cachedKey
+}
+
+type cachedKey struct {
+	info    apikey.Info
+	expires time.Time
+}
+
+// New creates a client for the auth service listening on addr (host:port).
+func New(addr string) *Client {
+	return &Client{
+		addr:       addr,
+		scheme:     "http",
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		valid:      map[string]time.Time{},
+		keys:       map[string]cachedKey{},
+	}
+}
+
+// SetTimeout limits how long a single call may take.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.httpClient.Timeout = timeout
+}
+
+// SetTLS makes calls over HTTPS with config, which also holds the client
+// certificate for mutual TLS. A nil config keeps plain HTTP.
+func (c *Client) SetTLS(config *tls.Config) {
+	if config == nil {
+		return
+	}
+	c.scheme = "https"
+	c.httpClient.Transport = &http.Transport{TLSClientConfig: config}
+}
+
+// SetCacheTTL makes a token or API key found valid skip the auth service for
+// ttl, so a revocation takes up to ttl to reach this client.
+func (c *Client) SetCacheTTL(ttl time.Duration) {
+	c.cacheTTL = ttl
+}
+
+// VerifyToken returns ErrTokenRevoked if the auth service no longer accepts
+// token. Signature checks are left to the caller.
+func (c *Client) VerifyToken(token string) error {
+	now := time.Now()
+	c.mu.Lock()
+	expires, ok := c.valid[token]
+	c.mu.Unlock()
+	if ok && now.Before(expires) {
+		return nil
+	}
+
+	requestBytes, err := json.Marshal(map[string]string{"token": token})
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Post(c.scheme+"://"+c.addr+"/check_token", "application/json", bytes.NewReader(requestBytes))
+	if err != nil {
+		return fmt.Errorf("auth request /check_token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("auth request /check_token: error reading body: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrTokenRevoked
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("auth request /check_token: status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	if c.cacheTTL > 0 {
+		c.mu.Lock()
+		for cached, expires := range c.valid {
+			if !now.Before(expires) {
+				delete(c.valid, cached)
+			}
+		}
+		c.valid[token] = now.Add(c.cacheTTL)
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// CheckAPIKey returns what the auth service knows about key, or
+// ErrKeyRejected if it does not accept it.
+func (c *Client) CheckAPIKey(key string) (apikey.Info, error) {
+	now := time.Now()
+	c.mu.Lock()
+	cached, ok := c.keys[key]
+	c.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.info, nil
+	}
+
+	requestBytes, err := json.Marshal(map[string]string{"api_key": key})
+	if err != nil {
+		return apikey.Info{}, err
+	}
+	resp, err := c.httpClient.Post(c.scheme+"://"+c.addr+"/check_api_key", "application/json", bytes.NewReader(requestBytes))
+	if err != nil {
+		return apikey.Info{}, fmt.Errorf("auth request /check_api_key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return apikey.Info{}, fmt.Errorf("auth request /check_api_key: error reading body: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return apikey.Info{}, ErrKeyRejected
+	}
+	if resp.StatusCode != http.StatusOK {
+		return apikey.Info{}, fmt.Errorf("auth request /check_api_key: status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	var info apikey.Info
+	err = json.Unmarshal(body, &info)
+	if err != nil {
+		return apikey.Info{}, err
+	}
+
+	if c.cacheTTL > 0 {
+		c.mu.Lock()
+		for cached, entry := range c.keys {
+			if !now.Before(entry.expires) {
+				delete(c.keys, cached)
+			}
+		}
+		c.keys[key] = cachedKey{info: info, expires: now.Add(c.cacheTTL)}
+		c.mu.Unlock()
+	}
+	return info, nil
+}
+
+// Driver returns the date of birth and driver's license of the user holding
+// token, which is an access token or an API key, for the eligibility rules of
+// the rental services.
+func (c *Client) Driver(token string) (eligibility.Driver, error) {
+	req, err := http.NewRequest(http.MethodGet, c.scheme+"://"+c.addr+"/me", nil)
+	if err != nil {
+		return eligibility.Driver{}, err
+	}
+	if apikey.IsKey(token) {
+		req.Header.Set(apikey.Header, token)
+	} else {
+		req.Header.Set("X-Auth", token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return eligibility.Driver{}, fmt.Errorf("auth request /me: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return eligibility.Driver{}, fmt.Errorf("auth request /me: error reading body: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return eligibility.Driver{}, ErrTokenRevoked
+	}
+	if resp.StatusCode != http.StatusOK {
+		return eligibility.Driver{}, fmt.Errorf("auth request /me: status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	var profile struct {
+		DateOfBirth            string `json:"date_of_birth"`
+		DriverLicense          string `json:"driver_license"`
+		DriverLicenseCountry   string `json:"driver_license_country"`
+		DriverLicenseExpiresOn string `json:"driver_license_expires_on"`
+		DriverLicenseStatus    string `json:"driver_license_status"`
+	}
+	err = json.Unmarshal(body, &profile)
+	if err != nil {
+		return eligibility.Driver{}, err
+	}
+	return eligibility.Driver{
+		DateOfBirth: profile.DateOfBirth,
+		License: eligibility.License{
+			Number:    profile.DriverLicense,
+			Country:   profile.DriverLicenseCountry,
+			ExpiresOn: profile.DriverLicenseExpiresOn,
+			Status:    profile.DriverLicenseStatus,
+		},
+	}, nil
+}
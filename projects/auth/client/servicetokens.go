@@ -0,0 +1,86 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceTokens gets service tokens from the auth service with the OAuth2
+// client credentials grant and reuses each until most of its lifetime is
+// over, so that a token is never used right at its expiry.
+type ServiceTokens struct {
+	client       *Client
+	clientID     string
+	clientSecret string
+	scopes       []string
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+}
+
+// ServiceTokens returns a token source for the service client clientID. With
+// no scopes the tokens carry every scope of the client.
+func (c *Client) ServiceTokens(clientID string, clientSecret string, scopes ...string) *ServiceTokens {
+	return &ServiceTokens{
+		client:       c,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+	}
+}
+
+// Token returns a valid service token, getting a new one if needed.
+func (c *ServiceTokens) Token() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.token != "" && now.Before(c.refreshAt) {
+		return c.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.scopes) > 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+	req, err := http.NewRequest(http.MethodPost, c.client.scheme+"://"+c.client.addr+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+
+	resp, err := c.client.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("auth request /oauth/token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("auth request /oauth/token: error reading body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("auth request /oauth/token: status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return "", err
+	}
+	c.token = response.AccessToken
+	c.refreshAt = now.Add(time.Duration(response.ExpiresIn) * time.Second * 9 / 10)
+	return c.token, nil
+}
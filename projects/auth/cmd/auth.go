@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"distributed-rental/pkg/backup"
+	"distributed-rental/pkg/config"
+	"distributed-rental/pkg/migrate"
+	"distributed-rental/pkg/openapi"
 	"distributed-rental/projects/auth/internal"
-	"flag"
-	"github.com/dgraph-io/badger/v3"
-	"go.uber.org/zap"
+	booking "distributed-rental/projects/booking/client"
+	lease "distributed-rental/projects/lease/client"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -14,35 +19,120 @@ import (
 )
 
 func main() {
-	addrF := flag.String("addr", "localhost:3000", "addr to listen on")
-	jwtSecretPath := flag.String("jwt-secret-path", "/etc/jwt-secret", "path to jwt secret")
-
-	flag.Parse()
-
-	jwtSecret, err := ioutil.ReadFile(*jwtSecretPath)
+	cfg := defaultConfig()
+	err := config.Load(&cfg, "auth", os.Args[1:])
 	if err != nil {
 		log.Fatal(err)
 	}
+	if cfg.OpenAPI != "" {
+		err = openapi.WriteFile(cfg.OpenAPI, internal.OpenAPI())
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	db, err := badger.Open(badger.DefaultOptions("/var/auth_db"))
+	logger, err := cfg.Log.Logger()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	logger.Sugar().Infow("effective config", "config", config.Redacted(&cfg))
+
+	var repository internal.UserRepository
+	switch cfg.Storage.Backend {
+	case "badger":
+		db, err := cfg.Badger.Open()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+
+		_, err = migrate.Run(db, internal.BadgerMigrations, migrate.Options{DryRun: cfg.MigrateDryRun, Logger: logger.Sugar()})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if cfg.MigrateDryRun {
+			return
+		}
+
+		if cfg.Admin.Addr != "" {
+			adminServer, err := backup.Serve(cfg.Admin.Addr, db, cfg.Admin.TokenPath, logger.Sugar())
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer adminServer.Close()
+		}
+
+		repository, err = internal.NewBadgerUserRepository(db, cfg.Badger.SequenceBandwidth)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "sqlite":
+		sqliteRepository, err := internal.NewSQLiteUserRepository(cfg.Storage.SQLitePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		repository = sqliteRepository
+	case "memory":
+		repository = internal.NewMemoryUserRepository()
+	}
+	defer repository.Close()
 
-	logger, err := zap.NewProduction()
+	jwtSecret, err := config.ReadSecret(cfg.JWTSecret, cfg.JWTSecretPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	userIDSequence, err := db.GetSequence([]byte("user_id_sequence"), 100_000)
+	adminToken, err := ioutil.ReadFile(cfg.Admin.TokenPath)
+	if os.IsNotExist(err) {
+		logger.Sugar().Warnf("no admin token at %s, admin endpoints are disabled", cfg.Admin.TokenPath)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	notifier := internal.NewFileNotifier(cfg.PasswordReset.NotifyPath)
+	userService := internal.NewUserService(repository, logger.Sugar(), cfg.BcryptCost, cfg.Lockout.User, cfg.Lockout.IP, cfg.TOTP, cfg.PasswordReset, notifier, internal.SystemClock)
+
+	serverTLS, err := cfg.TLS.ServerConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	clientTLS, err := cfg.TLS.ClientConfig()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	userService := internal.NewUserService(db, userIDSequence)
+	dataServices := map[string]internal.UserDataService{}
+	if cfg.BookingAddr != "" {
+		bookingClient := booking.New(cfg.BookingAddr)
+		bookingClient.SetTimeout(cfg.ClientTimeout)
+		bookingClient.SetTLS(clientTLS)
+		dataServices["booking"] = bookingClient
+	}
+	if cfg.LeaseAddr != "" {
+		leaseClient := lease.New(cfg.LeaseAddr)
+		leaseClient.SetTimeout(cfg.ClientTimeout)
+		leaseClient.SetTLS(clientTLS)
+		dataServices["lease"] = leaseClient
+	}
+	userService.SetServiceTokenTTL(cfg.ServiceTokenTTL)
+	userService.SetAPIKeyOptions(cfg.APIKeys)
+	userService.SetOIDCOptions(cfg.OIDC)
+	userService.SetDataServices(bytes.TrimSpace(adminToken), dataServices, cfg.DataJobs)
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go userService.RunDataJobs(jobsCtx)
 
-	httpServer := internal.NewHttpServer(*addrF, userService, jwtSecret, logger.Sugar())
+	httpServer := internal.NewHttpServer(cfg.HTTP.Addr, userService, jwtSecret, bytes.TrimSpace(adminToken), logger.Sugar())
+	httpServer.SetTimeouts(cfg.HTTP.ReadTimeout, cfg.HTTP.WriteTimeout, cfg.HTTP.IdleTimeout)
+	httpServer.SetTLS(serverTLS)
+
+	limiter, err := cfg.RateLimit.Limiter(logger.Sugar())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer limiter.Close()
+	httpServer.SetRateLimit(limiter)
 
 	go func() {
 		err := httpServer.ListenAndServe()
@@ -51,9 +141,14 @@ func main() {
 		}
 	}()
 
-	signals := make(chan os.Signal)
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGTERM, syscall.SIGSTOP)
 
 	<-signals
-	httpServer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	err = httpServer.Shutdown(ctx)
+	if err != nil {
+		logger.Sugar().Errorf("error shutting down server: %v", err)
+	}
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"distributed-rental/pkg/config"
+	"distributed-rental/pkg/ratelimit"
+	"distributed-rental/projects/auth/internal"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	HTTP            config.HTTP                   `yaml:"http"`
+	TLS             config.TLS                    `yaml:"tls"`
+	JWTSecretPath   string                        `yaml:"jwt_secret_path" usage:"path to jwt secret"`
+	JWTSecret       string                        `yaml:"jwt_secret" secret:"true" usage:"jwt secret, takes precedence over jwt_secret_path"`
+	BcryptCost      int                           `yaml:"bcrypt_cost" usage:"bcrypt cost of new password hashes"`
+	Lockout         Lockout                       `yaml:"lockout"`
+	TOTP            internal.TOTPOptions          `yaml:"totp"`
+	PasswordReset   internal.PasswordResetOptions `yaml:"password_reset"`
+	BookingAddr     string                        `yaml:"booking_addr" usage:"booking service addr that user data is exported from and erased in, empty leaves bookings out"`
+	LeaseAddr       string                        `yaml:"lease_addr" usage:"lease service addr that user data is exported from and erased in, empty leaves leases out"`
+	ClientTimeout   time.Duration                 `yaml:"client_timeout" usage:"timeout of calls to other services"`
+	DataJobs        internal.DataJobOptions       `yaml:"data_jobs"`
+	ServiceTokenTTL time.Duration                 `yaml:"service_token_ttl" usage:"how long service tokens of the client credentials grant are valid"`
+	APIKeys         internal.APIKeyOptions        `yaml:"api_keys"`
+	OIDC            internal.OIDCOptions          `yaml:"oidc"`
+	Storage         config.Storage                `yaml:"storage"`
+	Badger          config.Badger                 `yaml:"badger"`
+	Admin           config.Admin                  `yaml:"admin"`
+	RateLimit       config.RateLimit              `yaml:"rate_limit"`
+	Log             config.Log                    `yaml:"log"`
+	MigrateDryRun   bool                          `yaml:"-" flag:"migrate-dry-run" usage:"report what pending badger migrations would change and exit"`
+	OpenAPI         string                        `yaml:"-" flag:"openapi" usage:"write the OpenAPI document of the REST API v1 to this file and exit"`
+}
+
+// Lockout throttles failed logins per username and per client address.
+type Lockout struct {
+	User internal.LockoutPolicy `yaml:"user"`
+	IP   internal.LockoutPolicy `yaml:"ip"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		HTTP:          config.DefaultHTTP("localhost:3000"),
+		JWTSecretPath: "/etc/jwt-secret",
+		BcryptCost:    14,
+		Lockout: Lockout{
+			User: internal.LockoutPolicy{
+				FreeAttempts: 3,
+				BaseDelay:    time.Second,
+				MaxDelay:     30 * time.Second,
+				LockAfter:    10,
+				LockDuration: 15 * time.Minute,
+				Window:       15 * time.Minute,
+			},
+			IP: internal.LockoutPolicy{
+				FreeAttempts: 20,
+				BaseDelay:    time.Second,
+				MaxDelay:     30 * time.Second,
+				LockAfter:    100,
+				LockDuration: 15 * time.Minute,
+				Window:       15 * time.Minute,
+			},
+		},
+		TOTP: internal.TOTPOptions{
+			Issuer:       "distributed-rental",
+			ChallengeTTL: 5 * time.Minute,
+		},
+		PasswordReset:   internal.PasswordResetOptions{TokenTTL: time.Hour},
+		BookingAddr:     "localhost:3002",
+		LeaseAddr:       "localhost:3001",
+		ClientTimeout:   30 * time.Second,
+		DataJobs:        internal.DataJobOptions{RetryInterval: time.Minute, MaxAttempts: 10},
+		ServiceTokenTTL: time.Hour,
+		APIKeys:         internal.APIKeyOptions{DefaultTTL: 365 * 24 * time.Hour, DefaultRateLimit: "5/s:10", MaxRateLimit: "50/s:100"},
+		OIDC:            internal.OIDCOptions{Issuer: "http://localhost:3000", CodeTTL: time.Minute, TokenTTL: time.Hour},
+		Storage:         config.Storage{Backend: "badger", SQLitePath: "/var/auth_db.sqlite"},
+		Badger:          config.DefaultBadger("/var/auth_db"),
+		Admin:           config.DefaultAdmin(),
+		RateLimit:       config.RateLimit{Routes: "/create_user=10/m:10,/auth_user=10/s:20,/auth_totp=10/s:20,/request_password_reset=5/m:5,/oauth/token=10/s:20,/oauth/authorize=10/s:20,POST /v1/users=10/m:10,POST /v1/sessions=10/s:20,POST /v1/sessions/totp=10/s:20,POST /v1/password_resets=5/m:5", Store: "memory", SQLitePath: "/var/auth_ratelimit.sqlite"},
+		Log:             config.DefaultLog(),
+	}
+}
+
+func (c *Config) Validate() error {
+	for _, section := range []config.Validator{c.HTTP, c.TLS, c.Storage, c.Badger, c.RateLimit, c.Log} {
+		err := section.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	err := c.Storage.CheckBadger(c.Badger)
+	if err != nil {
+		return err
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	for name, policy := range map[string]internal.LockoutPolicy{"lockout.user": c.Lockout.User, "lockout.ip": c.Lockout.IP} {
+		if policy.BaseDelay < 0 || policy.MaxDelay < policy.BaseDelay || policy.LockDuration < 0 || policy.Window <= 0 {
+			return fmt.Errorf("%s: delays must not be negative, max_delay must be at least base_delay and window positive", name)
+		}
+	}
+	if c.TOTP.Issuer == "" || strings.Contains(c.TOTP.Issuer, ":") {
+		return errors.New("totp.issuer must be set and must not contain ':'")
+	}
+	if c.TOTP.ChallengeTTL <= 0 {
+		return errors.New("totp.challenge_ttl must be positive")
+	}
+	if c.PasswordReset.TokenTTL <= 0 {
+		return errors.New("password_reset.token_ttl must be positive")
+	}
+	if c.DataJobs.RetryInterval <= 0 || c.DataJobs.MaxAttempts <= 0 {
+		return errors.New("data_jobs.retry_interval and data_jobs.max_attempts must be positive")
+	}
+	if c.ServiceTokenTTL <= 0 {
+		return errors.New("service_token_ttl must be positive")
+	}
+	if c.APIKeys.DefaultTTL <= 0 {
+		return errors.New("api_keys.default_ttl must be positive")
+	}
+	defaultLimit, err := ratelimit.ParseLimit(c.APIKeys.DefaultRateLimit)
+	if err != nil {
+		return fmt.Errorf("api_keys.default_rate_limit: %w", err)
+	}
+	maxLimit, err := ratelimit.ParseLimit(c.APIKeys.MaxRateLimit)
+	if err != nil {
+		return fmt.Errorf("api_keys.max_rate_limit: %w", err)
+	}
+	if defaultLimit.Rate > maxLimit.Rate || defaultLimit.Burst > maxLimit.Burst {
+		return errors.New("api_keys.default_rate_limit must not be over api_keys.max_rate_limit")
+	}
+	issuer, err := url.Parse(c.OIDC.Issuer)
+	if err != nil || (issuer.Scheme != "https" && issuer.Scheme != "http") || issuer.Host == "" || issuer.RawQuery != "" || issuer.Fragment != "" || strings.HasSuffix(c.OIDC.Issuer, "/") {
+		return errors.New("oidc.issuer must be an http(s) URL without query, fragment or trailing slash")
+	}
+	if c.OIDC.CodeTTL <= 0 || c.OIDC.TokenTTL <= 0 {
+		return errors.New("oidc.code_ttl and oidc.token_ttl must be positive")
+	}
+	_, err = internal.ParseAppSchemes(c.OIDC.AppSchemes)
+	if err != nil {
+		return fmt.Errorf("oidc.app_schemes: %w", err)
+	}
+	return nil
+}
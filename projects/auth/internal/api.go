@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"distributed-rental/pkg/apikey"
+	"distributed-rental/pkg/openapi"
+	"net/http"
+)
+
+var apiInfo = openapi.Info{
+	Title:       "auth",
+	Description: "Users, sessions, API keys and the administration of accounts.",
+	Version:     "1",
+}
+
+// dataJobIDRequest is the part of dataJobRequest the routes of a single job
+// read.
+type dataJobIDRequest struct {
+	JobID string `json:"job_id"`
+}
+
+// apiKeyInfo names apikey.Info in the document, where Info alone would say
+// little.
+type apiKeyInfo apikey.Info
+
+var (
+	securityUser      = []string{openapi.SecurityUser}
+	securityUserOrKey = []string{openapi.SecurityUser, openapi.SecurityAPIKey}
+	securityAdmin     = []string{openapi.SecurityAdmin}
+)
+
+// operations are the v1 routes of the auth API, registered by NewHttpServer
+// and described at /openapi.json.
+func (c *HttpServer) operations() []openapi.Operation {
+	return []openapi.Operation{
+		{Method: http.MethodPost, Path: "/v1/users", ID: "createUser", Summary: "Create a user",
+			Request: createUserRequest{}, Response: createUserResponse{}, Status: http.StatusCreated, Handler: c.createUser},
+		{Method: http.MethodPost, Path: "/v1/sessions", ID: "createSession", Summary: "Log in with a password; users with TOTP get a challenge instead of a token",
+			Request: authUserRequest{}, Response: authUserResponse{}, Status: http.StatusCreated, Handler: c.authUser},
+		{Method: http.MethodPost, Path: "/v1/sessions/totp", ID: "createTOTPSession", Summary: "Finish a login with the challenge and a TOTP code",
+			Request: authTOTPRequest{}, Response: authUserResponse{}, Status: http.StatusCreated, Handler: c.authTOTP},
+		{Method: http.MethodPost, Path: "/v1/tokens/verify", ID: "verifyToken", Summary: "Check an access token",
+			Request: checkTokenRequest{}, Response: checkTokenResponse{}, Handler: c.checkToken},
+		{Method: http.MethodGet, Path: "/v1/me", ID: "getMe", Summary: "Get the profile of the caller",
+			Security: securityUserOrKey, Response: UserProfile{}, Handler: c.me},
+		{Method: http.MethodPatch, Path: "/v1/me", ID: "updateMe", Summary: "Update the profile of the caller; fields left out are kept and an empty string clears one",
+			Security: securityUser, Request: ProfilePatch{}, Response: UserProfile{}, Handler: c.me},
+		{Method: http.MethodPut, Path: "/v1/me/password", ID: "changePassword", Summary: "Change the password and get a new token",
+			Security: securityUser, Request: changePasswordRequest{}, Response: authUserResponse{}, Handler: c.changePassword},
+		{Method: http.MethodPost, Path: "/v1/me/totp", ID: "enrollTOTP", Summary: "Start enrolling a TOTP authenticator",
+			Security: securityUser, Response: TOTPEnrollment{}, Status: http.StatusCreated, Handler: c.enrollTOTP},
+		{Method: http.MethodPost, Path: "/v1/me/totp/confirm", ID: "confirmTOTP", Summary: "Enable TOTP with a first code",
+			Security: securityUser, Request: totpCodeRequest{}, Handler: c.confirmTOTP},
+		{Method: http.MethodPost, Path: "/v1/me/totp/disable", ID: "disableTOTP", Summary: "Disable TOTP with a current code",
+			Security: securityUser, Request: totpCodeRequest{}, Handler: c.disableTOTP},
+		{Method: http.MethodPost, Path: "/v1/password_resets", ID: "requestPasswordReset", Summary: "Send a password reset token; the answer is the same for unknown users",
+			Request: requestPasswordResetRequest{}, Handler: c.requestPasswordReset},
+		{Method: http.MethodPost, Path: "/v1/password_resets/confirm", ID: "resetPassword", Summary: "Set a new password with a reset token",
+			Request: resetPasswordRequest{}, Handler: c.resetPassword},
+		{Method: http.MethodPost, Path: "/v1/api_keys", ID: "createAPIKey", Summary: "Create an API key; the key is only shown once",
+			Security: securityUser, Request: createAPIKeyRequest{}, Response: createAPIKeyResponse{}, Status: http.StatusCreated, Handler: c.createAPIKey},
+		{Method: http.MethodGet, Path: "/v1/api_keys", ID: "listAPIKeys", Summary: "List the API keys of the caller",
+			Security: securityUser, Response: listAPIKeysResponse{}, Handler: c.listAPIKeys},
+		{Method: http.MethodDelete, Path: "/v1/api_keys/{key_id}", ID: "revokeAPIKey", Summary: "Revoke an API key of the caller",
+			Security: securityUser, Request: revokeAPIKeyRequest{}, Handler: c.revokeAPIKey},
+		{Method: http.MethodPost, Path: "/v1/api_keys/verify", ID: "verifyAPIKey", Summary: "Check an API key",
+			Request: checkAPIKeyRequest{}, Response: apiKeyInfo{}, Handler: c.checkAPIKey},
+		{Method: http.MethodPost, Path: "/v1/admin/unlock", ID: "unlock", Summary: "Clear the failed login attempts of a user or an address",
+			Security: securityAdmin, Request: unlockRequest{}, Handler: c.unlock},
+		{Method: http.MethodGet, Path: "/v1/admin/audit_log", ID: "auditLog", Summary: "List the latest security events",
+			Security: securityAdmin, Request: auditLogRequest{}, Response: auditLogResponse{}, Handler: c.auditLog},
+		{Method: http.MethodGet, Path: "/v1/admin/users", ID: "listUsers", Summary: "List users by id, optionally matching a query",
+			Security: securityAdmin, Request: listUsersRequest{}, Response: listUsersResponse{}, Handler: c.listUsers},
+		{Method: http.MethodGet, Path: "/v1/admin/users/{user_id}", ID: "getUser", Summary: "Get the profile of a user",
+			Security: securityAdmin, Request: userIDRequest{}, Response: UserProfile{}, Handler: c.getUser},
+		{Method: http.MethodPost, Path: "/v1/admin/users/{user_id}/disable", ID: "disableUser", Summary: "Disable a user and revoke their tokens",
+			Security: securityAdmin, Request: userIDRequest{}, Response: UserProfile{}, Handler: c.disableUser},
+		{Method: http.MethodPost, Path: "/v1/admin/users/{user_id}/enable", ID: "enableUser", Summary: "Enable a disabled user",
+			Security: securityAdmin, Request: userIDRequest{}, Response: UserProfile{}, Handler: c.enableUser},
+		{Method: http.MethodPut, Path: "/v1/admin/users/{user_id}/license", ID: "verifyLicense", Summary: "Set the status of the driving license of a user",
+			Security: securityAdmin, Request: verifyLicenseRequest{}, Response: UserProfile{}, Handler: c.verifyLicense},
+		{Method: http.MethodPost, Path: "/v1/admin/users/{user_id}/export", ID: "exportUser", Summary: "Start exporting the data of a user from all services",
+			Security: securityAdmin, Request: userIDRequest{}, Response: DataJob{}, Status: http.StatusCreated, Handler: c.exportUser},
+		{Method: http.MethodPost, Path: "/v1/admin/users/{user_id}/erase", ID: "eraseUser", Summary: "Start erasing the personal data of a user in all services",
+			Security: securityAdmin, Request: userIDRequest{}, Response: DataJob{}, Status: http.StatusCreated, Handler: c.eraseUser},
+		{Method: http.MethodGet, Path: "/v1/admin/users/{user_id}/data_jobs", ID: "listDataJobs", Summary: "List the export and erasure jobs of a user",
+			Security: securityAdmin, Request: userIDRequest{}, Response: listDataJobsResponse{}, Handler: c.listDataJobs},
+		{Method: http.MethodGet, Path: "/v1/admin/data_jobs/{job_id}", ID: "getDataJob", Summary: "Get an export or erasure job",
+			Security: securityAdmin, Request: dataJobIDRequest{}, Response: DataJob{}, Handler: c.getDataJob},
+		{Method: http.MethodPost, Path: "/v1/admin/data_jobs/{job_id}/retry", ID: "retryDataJob", Summary: "Retry a failed job",
+			Security: securityAdmin, Request: dataJobIDRequest{}, Response: DataJob{}, Handler: c.retryDataJob},
+		{Method: http.MethodPost, Path: "/v1/admin/service_clients", ID: "createServiceClient", Summary: "Create a service client; the secret is only shown once",
+			Security: securityAdmin, Request: createServiceClientRequest{}, Response: createServiceClientResponse{}, Status: http.StatusCreated, Handler: c.createServiceClient},
+		{Method: http.MethodGet, Path: "/v1/admin/service_clients", ID: "listServiceClients", Summary: "List the service clients",
+			Security: securityAdmin, Response: listServiceClientsResponse{}, Handler: c.listServiceClients},
+		{Method: http.MethodDelete, Path: "/v1/admin/service_clients/{client_id}", ID: "deleteServiceClient", Summary: "Delete a service client",
+			Security: securityAdmin, Request: serviceClientRequest{}, Handler: c.deleteServiceClient},
+		{Method: http.MethodPost, Path: "/v1/admin/oidc_clients", ID: "registerOIDCClient", Summary: "Register an OpenID Connect client; the secret is only shown once",
+			Security: securityAdmin, Request: registerOIDCClientRequest{}, Response: registerOIDCClientResponse{}, Status: http.StatusCreated, Handler: c.registerOIDCClient},
+		{Method: http.MethodGet, Path: "/v1/admin/oidc_clients", ID: "listOIDCClients", Summary: "List the OpenID Connect clients",
+			Security: securityAdmin, Response: listOIDCClientsResponse{}, Handler: c.listOIDCClients},
+		{Method: http.MethodDelete, Path: "/v1/admin/oidc_clients/{client_id}", ID: "deleteOIDCClient", Summary: "Delete an OpenID Connect client",
+			Security: securityAdmin, Request: oidcClientRequest{}, Handler: c.deleteOIDCClient},
+	}
+}
+
+// OpenAPI describes the v1 routes of the auth API.
+func OpenAPI() *openapi.Document {
+	return openapi.Build(apiInfo, (&HttpServer{}).operations())
+}
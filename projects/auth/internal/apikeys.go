@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"distributed-rental/pkg/apikey"
+	"distributed-rental/pkg/ratelimit"
+	"distributed-rental/pkg/servicetoken"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var apiKeyNotFound = errors.New("api key not found")
+var wrongAPIKey = errors.New("unknown, revoked or expired api key")
+var invalidAPIKeyName = errors.New("name must not be longer than 100 characters")
+var invalidAPIKeyExpiry = errors.New("expires_at must be in the future")
+
+// invalidAPIKeyRateLimit rejects a rate limit that does not parse or is over
+// the maximum.
+type invalidAPIKeyRateLimit struct {
+	err error
+}
+
+func (c *invalidAPIKeyRateLimit) Error() string {
+	return "invalid rate_limit: " + c.err.Error()
+}
+
+// apiKeyTouchInterval is how often last_used_at is written for a key in use.
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyOptions configures the API keys of users.
+type APIKeyOptions struct {
+	DefaultTTL       time.Duration `yaml:"default_ttl" usage:"how long an api key is valid if it is created without expires_at"`
+	DefaultRateLimit string        `yaml:"default_rate_limit" usage:"<count>/<s|m|h|d>[:<burst>] limit of an api key created without one"`
+	MaxRateLimit     string        `yaml:"max_rate_limit" usage:"highest <count>/<s|m|h|d>[:<burst>] limit a user may give an api key"`
+}
+
+// APIKey lets a partner integration act for the user owning it, within the
+// scopes of the key. Only the SHA-256 of its secret is stored; the secret is
+// random and long, so a slow hash would add nothing.
+type APIKey struct {
+	KeyID      string     `json:"key_id"`
+	UserID     uint64     `json:"user_id"`
+	Name       string     `json:"name"`
+	SecretHash string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	RateLimit  string     `json:"rate_limit"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetAPIKeyOptions sets the defaults and limits of new API keys.
+func (c *UserService) SetAPIKeyOptions(options APIKeyOptions) {
+	c.apiKeys = options
+}
+
+// createAPIKey creates a key of userID and returns it with the full key,
+// which is not kept and can not be shown again. A zero expiresAt means the
+// default lifetime and an empty rateLimit the default limit.
+func (c *UserService) createAPIKey(userID uint64, name string, scopes []string, rateLimit string, expiresAt time.Time) (APIKey, string, error) {
+	if len([]rune(name)) > 100 {
+		return APIKey{}, "", invalidAPIKeyName
+	}
+	if len(scopes) == 0 {
+		return APIKey{}, "", invalidScope("")
+	}
+	for _, scope := range scopes {
+		if !servicetoken.ValidScope(scope) {
+			return APIKey{}, "", invalidScope(scope)
+		}
+	}
+	if rateLimit == "" {
+		rateLimit = c.apiKeys.DefaultRateLimit
+	}
+	err := c.checkAPIKeyRateLimit(rateLimit)
+	if err != nil {
+		return APIKey{}, "", &invalidAPIKeyRateLimit{err}
+	}
+	now := c.clock.Now()
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(c.apiKeys.DefaultTTL)
+	}
+	if !expiresAt.After(now) {
+		return APIKey{}, "", invalidAPIKeyExpiry
+	}
+
+	user, err := c.repository.GetUserByID(userID)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	key, keyID, secret, err := apikey.New()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	scopes = append([]string{}, scopes...)
+	sort.Strings(scopes)
+	apiKey := APIKey{
+		KeyID:      keyID,
+		UserID:     userID,
+		Name:       name,
+		SecretHash: hashAPIKeySecret(secret),
+		Scopes:     scopes,
+		RateLimit:  rateLimit,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  now,
+	}
+	err = c.repository.CreateAPIKey(apiKey)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	c.audit(AuditEvent{Time: now, Kind: auditAPIKeyCreated, Username: user.UserName})
+	return apiKey, key, nil
+}
+
+// checkAPIKeyRateLimit accepts limits that are neither faster nor burstier
+// than the maximum.
+func (c *UserService) checkAPIKeyRateLimit(rateLimit string) error {
+	limit, err := ratelimit.ParseLimit(rateLimit)
+	if err != nil {
+		return err
+	}
+	if c.apiKeys.MaxRateLimit == "" {
+		return nil
+	}
+	maxLimit, err := ratelimit.ParseLimit(c.apiKeys.MaxRateLimit)
+	if err != nil {
+		return err
+	}
+	if limit.Rate > maxLimit.Rate || limit.Burst > maxLimit.Burst {
+		return fmt.Errorf("%q is over the maximum %q", rateLimit, c.apiKeys.MaxRateLimit)
+	}
+	return nil
+}
+
+func (c *UserService) listAPIKeys(userID uint64) ([]APIKey, error) {
+	return c.repository.UserAPIKeys(userID)
+}
+
+// revokeAPIKey deletes a key of userID. Keys of other users are reported as
+// not found.
+func (c *UserService) revokeAPIKey(userID uint64, keyID string) error {
+	apiKey, err := c.repository.GetAPIKey(keyID)
+	if err != nil {
+		return err
+	}
+	if apiKey.UserID != userID {
+		return apiKeyNotFound
+	}
+	user, err := c.repository.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	err = c.repository.DeleteAPIKey(keyID)
+	if err != nil {
+		return err
+	}
+	c.audit(AuditEvent{Time: c.clock.Now(), Kind: auditAPIKeyRevoked, Username: user.UserName})
+	return nil
+}
+
+// checkAPIKey returns the key and its user if key is valid: known, not
+// expired and owned by a user who is not disabled. It records when the key
+// was last used, at most once per apiKeyTouchInterval.
+func (c *UserService) checkAPIKey(key string) (APIKey, User, error) {
+	keyID, secret, err := apikey.Parse(key)
+	if err != nil {
+		return APIKey{}, User{}, wrongAPIKey
+	}
+	apiKey, err := c.repository.GetAPIKey(keyID)
+	if err == apiKeyNotFound {
+		return APIKey{}, User{}, wrongAPIKey
+	}
+	if err != nil {
+		return APIKey{}, User{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKeySecret(secret)), []byte(apiKey.SecretHash)) != 1 {
+		return APIKey{}, User{}, wrongAPIKey
+	}
+	now := c.clock.Now()
+	if !now.Before(apiKey.ExpiresAt) {
+		return APIKey{}, User{}, wrongAPIKey
+	}
+	userDBModel, err := c.repository.GetUserByID(apiKey.UserID)
+	if err == userNotFound {
+		return APIKey{}, User{}, wrongAPIKey
+	}
+	if err != nil {
+		return APIKey{}, User{}, err
+	}
+	if userDBModel.Disabled {
+		return APIKey{}, User{}, wrongAPIKey
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		touched, err := c.repository.UpdateAPIKey(keyID, func(apiKey APIKey) (APIKey, error) {
+			apiKey.LastUsedAt = &now
+			return apiKey, nil
+		})
+		if err != nil {
+			c.logger.Errorf("api key last used error: %v", err)
+		} else {
+			apiKey = touched
+		}
+	}
+
+	return apiKey, User{
+		UserID:       userDBModel.UserID,
+		UserName:     userDBModel.UserName,
+		TokenVersion: userDBModel.TokenVersion,
+	}, nil
+}
@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"distributed-rental/pkg/apikey"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAPIKeyTest returns a server with the users alice and bob and a function
+// calling it as one of them. Keys are valid for a day and limited to 50/s.
+func newAPIKeyTest(t *testing.T) (*testClock, *UserService, func(user string, method string, target string, body string) *httptest.ResponseRecorder) {
+	t.Helper()
+	clock, _, userService, server := newResetTest(t)
+	userService.SetAPIKeyOptions(APIKeyOptions{DefaultTTL: 24 * time.Hour, DefaultRateLimit: "5/s:10", MaxRateLimit: "50/s:100"})
+	_, err := userService.createUser("bob", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := map[string]string{}
+	for _, username := range []string{"alice", "bob"} {
+		user, err := userService.authUser(username, "correct horse", "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[username], err = server.accessToken(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return clock, userService, func(user string, method string, target string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if user != "" {
+			r.Header.Set("X-Auth", tokens[user])
+		}
+		rw := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rw, r)
+		return rw
+	}
+}
+
+// createKey creates a key of user through the handler.
+func createKey(t *testing.T, call func(string, string, string, string) *httptest.ResponseRecorder, user string, body string) createAPIKeyResponse {
+	t.Helper()
+	rw := call(user, http.MethodPost, "/api_keys/create", body)
+	var response createAPIKeyResponse
+	err := json.Unmarshal(rw.Body.Bytes(), &response)
+	if rw.Code != 200 || err != nil || response.Key == "" {
+		t.Fatalf("create: got %d %s", rw.Code, rw.Body)
+	}
+	return response
+}
+
+// checkKey returns the status of /check_api_key and the key info on success.
+func checkKey(t *testing.T, call func(string, string, string, string) *httptest.ResponseRecorder, key string) (int, apikey.Info) {
+	t.Helper()
+	rw := call("", http.MethodPost, "/check_api_key", `{"api_key": "`+key+`"}`)
+	var info apikey.Info
+	if rw.Code == 200 {
+		err := json.Unmarshal(rw.Body.Bytes(), &info)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rw.Code, info
+}
+
+func TestAPIKeyCreate(t *testing.T) {
+	clock, userService, call := newAPIKeyTest(t)
+	created := createKey(t, call, "alice", `{"name": "partner", "scopes": ["lease:read", "booking:read"]}`)
+	if created.Name != "partner" || strings.Join(created.Scopes, " ") != "booking:read lease:read" ||
+		created.RateLimit != "5/s:10" || !created.ExpiresAt.Equal(clock.Now().Add(24*time.Hour)) {
+		t.Fatalf("got %+v", created.APIKey)
+	}
+
+	// Only the hash of the secret is stored, and it is never shown.
+	keyID, secret, err := apikey.Parse(created.Key)
+	if err != nil || keyID != created.KeyID {
+		t.Fatalf("got key %q for id %q: %v", created.Key, created.KeyID, err)
+	}
+	stored, err := userService.repository.GetAPIKey(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SecretHash != hashAPIKeySecret(secret) || strings.Contains(stored.SecretHash, secret) {
+		t.Fatalf("got stored hash %q", stored.SecretHash)
+	}
+	rw := call("alice", http.MethodPost, "/api_keys/list", ``)
+	if rw.Code != 200 || !strings.Contains(rw.Body.String(), keyID) || strings.Contains(rw.Body.String(), secret) || strings.Contains(rw.Body.String(), stored.SecretHash) {
+		t.Fatalf("list: got %d %s", rw.Code, rw.Body)
+	}
+	rw = call("bob", http.MethodPost, "/api_keys/list", ``)
+	if rw.Code != 200 || strings.Contains(rw.Body.String(), keyID) {
+		t.Fatalf("list of bob: got %d %s", rw.Code, rw.Body)
+	}
+
+	for name, body := range map[string]string{
+		"no scopes":          `{"name": "partner"}`,
+		"unknown scope":      `{"scopes": ["booking:admin"]}`,
+		"bad rate limit":     `{"scopes": ["booking:read"], "rate_limit": "fast"}`,
+		"over the max limit": `{"scopes": ["booking:read"], "rate_limit": "100/s"}`,
+		"over the max burst": `{"scopes": ["booking:read"], "rate_limit": "1/s:1000"}`,
+		"expired":            `{"scopes": ["booking:read"], "expires_at": "2025-01-01T00:00:00Z"}`,
+		"long name":          `{"scopes": ["booking:read"], "name": "` + strings.Repeat("x", 101) + `"}`,
+	} {
+		if rw := call("alice", http.MethodPost, "/api_keys/create", body); rw.Code != 400 {
+			t.Errorf("%s: got %d %s, want 400", name, rw.Code, rw.Body)
+		}
+	}
+	if rw := call("", http.MethodPost, "/api_keys/create", `{"scopes": ["booking:read"]}`); rw.Code != http.StatusUnauthorized {
+		t.Errorf("no token: got %d, want 401", rw.Code)
+	}
+}
+
+func TestAPIKeyCheck(t *testing.T) {
+	clock, userService, call := newAPIKeyTest(t)
+	created := createKey(t, call, "alice", `{"scopes": ["booking:read"], "rate_limit": "1/s"}`)
+
+	status, info := checkKey(t, call, created.Key)
+	if status != 200 || info.KeyID != created.KeyID || info.UserID != created.UserID || info.Username != "alice" ||
+		!info.HasScope("booking:read") || info.HasScope("booking:write") || info.RateLimit != "1/s" {
+		t.Fatalf("got %d %+v", status, info)
+	}
+	stored, err := userService.repository.GetAPIKey(created.KeyID)
+	if err != nil || stored.LastUsedAt == nil || !stored.LastUsedAt.Equal(clock.Now()) {
+		t.Fatalf("got last used %v, %v", stored.LastUsedAt, err)
+	}
+
+	keyID, secret, _ := apikey.Parse(created.Key)
+	for name, key := range map[string]string{
+		"wrong secret":  "rk_" + keyID + "_" + strings.Repeat("0", len(secret)),
+		"unknown id":    "rk_0000000000000000_" + secret,
+		"not a key":     "alice",
+		"secret as key": secret,
+	} {
+		if status, _ := checkKey(t, call, key); status != http.StatusUnauthorized {
+			t.Errorf("%s: got %d, want 401", name, status)
+		}
+	}
+
+	// Keys of disabled users stop working.
+	_, err = userService.setDisabled(created.UserID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := checkKey(t, call, created.Key); status != http.StatusUnauthorized {
+		t.Fatalf("disabled user: got %d, want 401", status)
+	}
+	_, err = userService.setDisabled(created.UserID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(24*time.Hour - time.Second)
+	if status, _ := checkKey(t, call, created.Key); status != 200 {
+		t.Fatalf("before expiry: got %d", status)
+	}
+	clock.advance(time.Second)
+	if status, _ := checkKey(t, call, created.Key); status != http.StatusUnauthorized {
+		t.Fatalf("expired: got %d, want 401", status)
+	}
+}
+
+func TestAPIKeyRevoke(t *testing.T) {
+	_, userService, call := newAPIKeyTest(t)
+	created := createKey(t, call, "alice", `{"scopes": ["booking:read"]}`)
+	revoke := `{"key_id": "` + created.KeyID + `"}`
+
+	// Keys of other users look like unknown ones.
+	if rw := call("bob", http.MethodPost, "/api_keys/revoke", revoke); rw.Code != http.StatusNotFound {
+		t.Fatalf("revoke by bob: got %d, want 404", rw.Code)
+	}
+	if status, _ := checkKey(t, call, created.Key); status != 200 {
+		t.Fatalf("after bob's revoke: got %d", status)
+	}
+
+	if rw := call("alice", http.MethodPost, "/api_keys/revoke", revoke); rw.Code != 200 {
+		t.Fatalf("revoke: got %d %s", rw.Code, rw.Body)
+	}
+	if status, _ := checkKey(t, call, created.Key); status != http.StatusUnauthorized {
+		t.Fatalf("revoked: got %d, want 401", status)
+	}
+	if rw := call("alice", http.MethodPost, "/api_keys/revoke", revoke); rw.Code != http.StatusNotFound {
+		t.Fatalf("revoke again: got %d, want 404", rw.Code)
+	}
+	if rw := call("alice", http.MethodPost, "/api_keys/revoke", `{}`); rw.Code != 400 {
+		t.Fatalf("no key_id: got %d, want 400", rw.Code)
+	}
+
+	events, err := userService.auditLog(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]int{}
+	for _, event := range events {
+		kinds[event.Kind]++
+	}
+	if kinds[auditAPIKeyCreated] != 1 || kinds[auditAPIKeyRevoked] != 1 {
+		t.Fatalf("got audit events %v", kinds)
+	}
+}
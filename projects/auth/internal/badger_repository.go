@@ -0,0 +1,876 @@
+package internal
+
+import (
+	"fmt"
+	badger "github.com/dgraph-io/badger/v3"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// BadgerUserRepository keeps users keyed by username, with an index from
+// user_id to username. Everything else lives under keys starting with '!',
+// which usernames may not.
+type BadgerUserRepository struct {
+	db             *badger.DB
+	userIDSequence *badger.Sequence
+	auditSeq       uint64
+}
+
+// NewBadgerUserRepository leases user ids from the sequence sequenceBandwidth at a time.
+func NewBadgerUserRepository(db *badger.DB, sequenceBandwidth uint64) (*BadgerUserRepository, error) {
+	userIDSequence, err := db.GetSequence(userIDSequenceKey, sequenceBandwidth)
+	if err != nil {
+		return nil, err
+	}
+	return &BadgerUserRepository{
+		db:             db,
+		userIDSequence: userIDSequence,
+	}, nil
+}
+
+func (c *BadgerUserRepository) NextUserID() (uint64, error) {
+	return c.userIDSequence.Next()
+}
+
+func (c *BadgerUserRepository) CreateUser(user UserDBModel) error {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	userNameBts := []byte(user.UserName)
+	_, err := tx.Get(userNameBts)
+	if err == nil {
+		return userAlreadyExists
+	}
+	if err != badger.ErrKeyNotFound {
+		return err
+	}
+
+	err = tx.Set(userNameBts, encodeUser(user))
+	if err != nil {
+		return err
+	}
+	err = tx.Set(userIDKey(user.UserID), userNameBts)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+var userIDPrefix = []byte("!uid/")
+
+// userIDKey sorts like the id, so that the index iterates in id order.
+func userIDKey(userID uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", userIDPrefix, userID))
+}
+
+func (c *BadgerUserRepository) GetUser(username string) (UserDBModel, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	return getUser(tx, username)
+}
+
+func getUser(tx *badger.Txn, username string) (UserDBModel, error) {
+	item, err := tx.Get([]byte(username))
+	if err == badger.ErrKeyNotFound {
+		return UserDBModel{}, userNotFound
+	}
+	if err != nil {
+		return UserDBModel{}, err
+	}
+
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return UserDBModel{}, err
+	}
+
+	return decodeUser(val)
+}
+
+func (c *BadgerUserRepository) UpdateUser(username string, update func(user UserDBModel) (UserDBModel, error)) (UserDBModel, error) {
+	for {
+		user, err := c.updateUser(username, update)
+		if err == badger.ErrConflict {
+			continue
+		}
+		return user, err
+	}
+}
+
+func (c *BadgerUserRepository) updateUser(username string, update func(user UserDBModel) (UserDBModel, error)) (UserDBModel, error) {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	user, err := getUser(tx, username)
+	if err != nil {
+		return UserDBModel{}, err
+	}
+
+	user, err = update(user)
+	if err != nil {
+		return UserDBModel{}, err
+	}
+	if user.UserName != username {
+		_, err = tx.Get([]byte(user.UserName))
+		if err == nil {
+			return UserDBModel{}, userAlreadyExists
+		}
+		if err != badger.ErrKeyNotFound {
+			return UserDBModel{}, err
+		}
+		err = tx.Delete([]byte(username))
+		if err != nil {
+			return UserDBModel{}, err
+		}
+		err = tx.Set(userIDKey(user.UserID), []byte(user.UserName))
+		if err != nil {
+			return UserDBModel{}, err
+		}
+	}
+	err = tx.Set([]byte(user.UserName), encodeUser(user))
+	if err != nil {
+		return UserDBModel{}, err
+	}
+	return user, tx.Commit()
+}
+
+func (c *BadgerUserRepository) GetUserByID(userID uint64) (UserDBModel, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	item, err := tx.Get(userIDKey(userID))
+	if err == badger.ErrKeyNotFound {
+		return UserDBModel{}, userNotFound
+	}
+	if err != nil {
+		return UserDBModel{}, err
+	}
+	username, err := item.ValueCopy(nil)
+	if err != nil {
+		return UserDBModel{}, err
+	}
+	return getUser(tx, string(username))
+}
+
+func (c *BadgerUserRepository) ListUsers(from uint64, limit int, query string) ([]UserDBModel, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.Prefix = userIDPrefix
+	it := tx.NewIterator(options)
+	defer it.Close()
+
+	users := []UserDBModel{}
+	for it.Seek(userIDKey(from)); it.Valid() && len(users) < limit; it.Next() {
+		username, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		user, err := getUser(tx, string(username))
+		if err != nil {
+			return nil, err
+		}
+		if matchesQuery(user, query) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// Close releases the unused part of the id sequence. The DB itself belongs to the caller.
+func (c *BadgerUserRepository) Close() error {
+	return c.userIDSequence.Release()
+}
+
+func attemptsKey(key string) []byte {
+	return []byte("!attempts/" + key)
+}
+
+var auditPrefix = []byte("!audit/")
+
+func (c *BadgerUserRepository) Attempts(key string) (Attempts, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	return getAttempts(tx, key)
+}
+
+func getAttempts(tx *badger.Txn, key string) (Attempts, error) {
+	item, err := tx.Get(attemptsKey(key))
+	if err == badger.ErrKeyNotFound {
+		return Attempts{}, nil
+	}
+	if err != nil {
+		return Attempts{}, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return Attempts{}, err
+	}
+	return decodeAttempts(val)
+}
+
+func (c *BadgerUserRepository) UpdateAttempts(key string, update func(Attempts) Attempts) (Attempts, error) {
+	for {
+		attempts, err := c.updateAttempts(key, update)
+		if err == badger.ErrConflict {
+			continue
+		}
+		return attempts, err
+	}
+}
+
+func (c *BadgerUserRepository) updateAttempts(key string, update func(Attempts) Attempts) (Attempts, error) {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	attempts, err := getAttempts(tx, key)
+	if err != nil {
+		return Attempts{}, err
+	}
+	attempts = update(attempts)
+	err = tx.Set(attemptsKey(key), encodeAttempts(attempts))
+	if err != nil {
+		return Attempts{}, err
+	}
+	return attempts, tx.Commit()
+}
+
+func (c *BadgerUserRepository) DeleteAttempts(key string) error {
+	return c.db.Update(func(tx *badger.Txn) error {
+		return tx.Delete(attemptsKey(key))
+	})
+}
+
+// AppendAudit keys events by time and a sequence number so that they sort in
+// the order they happened.
+func (c *BadgerUserRepository) AppendAudit(event AuditEvent) error {
+	seq := atomic.AddUint64(&c.auditSeq, 1)
+	key := []byte(fmt.Sprintf("%s%020d_%020d", auditPrefix, unixNano(event.Time), seq))
+	return c.db.Update(func(tx *badger.Txn) error {
+		return tx.Set(key, encodeAuditEvent(event))
+	})
+}
+
+func (c *BadgerUserRepository) AuditLog(limit int) ([]AuditEvent, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.Reverse = true
+	options.Prefix = auditPrefix
+	it := tx.NewIterator(options)
+	defer it.Close()
+
+	events := []AuditEvent{}
+	for it.Seek(append(append([]byte{}, auditPrefix...), 0xff)); it.Valid() && len(events) < limit; it.Next() {
+		val, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		event, err := decodeAuditEvent(val)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// eachAudit calls fn with every audit event, oldest first.
+func (c *BadgerUserRepository) eachAudit(fn func(key []byte, event AuditEvent) error) error {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.Prefix = auditPrefix
+	it := tx.NewIterator(options)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		val, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		event, err := decodeAuditEvent(val)
+		if err != nil {
+			return err
+		}
+		err = fn(it.Item().KeyCopy(nil), event)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *BadgerUserRepository) UserAuditLog(username string) ([]AuditEvent, error) {
+	events := []AuditEvent{}
+	err := c.eachAudit(func(key []byte, event AuditEvent) error {
+		if event.Username == username {
+			events = append(events, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// AnonymizeAudit rewrites the events in a write batch, as there may be more
+// of them than fit into one transaction. Events are never changed otherwise,
+// so nothing is lost to a concurrent write.
+func (c *BadgerUserRepository) AnonymizeAudit(username string, replacement string) error {
+	wb := c.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := c.eachAudit(func(key []byte, event AuditEvent) error {
+		if event.Username != username {
+			return nil
+		}
+		event.Username = replacement
+		event.IP = ""
+		return wb.Set(key, encodeAuditEvent(event))
+	})
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+func totpKey(username string) []byte {
+	return []byte("!totp/" + username)
+}
+
+func (c *BadgerUserRepository) GetTOTP(username string) (TOTP, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	totp, found, err := getTOTP(tx, username)
+	if err != nil {
+		return TOTP{}, err
+	}
+	if !found {
+		return TOTP{}, totpNotEnrolled
+	}
+	return totp, nil
+}
+
+func getTOTP(tx *badger.Txn, username string) (TOTP, bool, error) {
+	item, err := tx.Get(totpKey(username))
+	if err == badger.ErrKeyNotFound {
+		return TOTP{}, false, nil
+	}
+	if err != nil {
+		return TOTP{}, false, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return TOTP{}, false, err
+	}
+	totp, err := decodeTOTP(val)
+	return totp, true, err
+}
+
+func (c *BadgerUserRepository) UpdateTOTP(username string, update func(totp TOTP, found bool) (TOTP, error)) (TOTP, error) {
+	for {
+		totp, err := c.updateTOTP(username, update)
+		if err == badger.ErrConflict {
+			continue
+		}
+		return totp, err
+	}
+}
+
+func (c *BadgerUserRepository) updateTOTP(username string, update func(totp TOTP, found bool) (TOTP, error)) (TOTP, error) {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	totp, found, err := getTOTP(tx, username)
+	if err != nil {
+		return TOTP{}, err
+	}
+	totp, err = update(totp, found)
+	if err != nil {
+		return TOTP{}, err
+	}
+	err = tx.Set(totpKey(username), encodeTOTP(totp))
+	if err != nil {
+		return TOTP{}, err
+	}
+	return totp, tx.Commit()
+}
+
+func (c *BadgerUserRepository) DeleteTOTP(username string) error {
+	return c.db.Update(func(tx *badger.Txn) error {
+		return tx.Delete(totpKey(username))
+	})
+}
+
+func resetTokenKey(hash string) []byte {
+	return []byte("!reset/" + hash)
+}
+
+// CreateResetToken stores the token with a TTL, so badger drops it once it
+// expires.
+func (c *BadgerUserRepository) CreateResetToken(hash string, token ResetToken) error {
+	entry := badger.NewEntry(resetTokenKey(hash), encodeResetToken(token)).WithTTL(time.Until(token.ExpiresAt))
+	return c.db.Update(func(tx *badger.Txn) error {
+		return tx.SetEntry(entry)
+	})
+}
+
+func (c *BadgerUserRepository) TakeResetToken(hash string) (ResetToken, error) {
+	for {
+		token, err := c.takeResetToken(hash)
+		if err == badger.ErrConflict {
+			continue
+		}
+		return token, err
+	}
+}
+
+func (c *BadgerUserRepository) takeResetToken(hash string) (ResetToken, error) {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	item, err := tx.Get(resetTokenKey(hash))
+	if err == badger.ErrKeyNotFound {
+		return ResetToken{}, resetTokenNotFound
+	}
+	if err != nil {
+		return ResetToken{}, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return ResetToken{}, err
+	}
+	token, err := decodeResetToken(val)
+	if err != nil {
+		return ResetToken{}, err
+	}
+	err = tx.Delete(resetTokenKey(hash))
+	if err != nil {
+		return ResetToken{}, err
+	}
+	return token, tx.Commit()
+}
+
+var dataJobPrefix = []byte("!datajob/")
+
+func dataJobKey(jobID string) []byte {
+	return append(append([]byte{}, dataJobPrefix...), jobID...)
+}
+
+func (c *BadgerUserRepository) CreateDataJob(job DataJob) error {
+	return c.db.Update(func(tx *badger.Txn) error {
+		return tx.Set(dataJobKey(job.JobID), encodeDataJob(job))
+	})
+}
+
+func (c *BadgerUserRepository) GetDataJob(jobID string) (DataJob, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	return getDataJob(tx, jobID)
+}
+
+func getDataJob(tx *badger.Txn, jobID string) (DataJob, error) {
+	item, err := tx.Get(dataJobKey(jobID))
+	if err == badger.ErrKeyNotFound {
+		return DataJob{}, dataJobNotFound
+	}
+	if err != nil {
+		return DataJob{}, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return DataJob{}, err
+	}
+	return decodeDataJob(val)
+}
+
+func (c *BadgerUserRepository) UpdateDataJob(jobID string, update func(job DataJob) (DataJob, error)) (DataJob, error) {
+	for {
+		job, err := c.updateDataJob(jobID, update)
+		if err == badger.ErrConflict {
+			continue
+		}
+		return job, err
+	}
+}
+
+func (c *BadgerUserRepository) updateDataJob(jobID string, update func(job DataJob) (DataJob, error)) (DataJob, error) {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	job, err := getDataJob(tx, jobID)
+	if err != nil {
+		return DataJob{}, err
+	}
+	job, err = update(job)
+	if err != nil {
+		return DataJob{}, err
+	}
+	err = tx.Set(dataJobKey(jobID), encodeDataJob(job))
+	if err != nil {
+		return DataJob{}, err
+	}
+	return job, tx.Commit()
+}
+
+// PendingDataJobs scans all jobs; there are few of them next to users.
+func (c *BadgerUserRepository) PendingDataJobs() ([]DataJob, error) {
+	return c.filterDataJobs(func(job DataJob) bool { return job.Status == dataJobPending })
+}
+
+func (c *BadgerUserRepository) UserDataJobs(userID uint64) ([]DataJob, error) {
+	return c.filterDataJobs(func(job DataJob) bool { return job.UserID == userID })
+}
+
+func (c *BadgerUserRepository) filterDataJobs(match func(job DataJob) bool) ([]DataJob, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.Prefix = dataJobPrefix
+	it := tx.NewIterator(options)
+	defer it.Close()
+
+	jobs := []DataJob{}
+	for it.Rewind(); it.Valid(); it.Next() {
+		val, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		job, err := decodeDataJob(val)
+		if err != nil {
+			return nil, err
+		}
+		if match(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+func (c *BadgerUserRepository) DeleteDataJob(jobID string) error {
+	return c.db.Update(func(tx *badger.Txn) error {
+		return tx.Delete(dataJobKey(jobID))
+	})
+}
+
+var serviceClientPrefix = []byte("!client/")
+
+func serviceClientKey(clientID string) []byte {
+	return append(append([]byte{}, serviceClientPrefix...), clientID...)
+}
+
+func (c *BadgerUserRepository) CreateServiceClient(client ServiceClient) error {
+	for {
+		err := c.createServiceClient(client)
+		if err == badger.ErrConflict {
+			continue
+		}
+		return err
+	}
+}
+
+func (c *BadgerUserRepository) createServiceClient(client ServiceClient) error {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	_, err := tx.Get(serviceClientKey(client.ClientID))
+	if err == nil {
+		return serviceClientAlreadyExists
+	}
+	if err != badger.ErrKeyNotFound {
+		return err
+	}
+	err = tx.Set(serviceClientKey(client.ClientID), encodeServiceClient(client))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *BadgerUserRepository) GetServiceClient(clientID string) (ServiceClient, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	item, err := tx.Get(serviceClientKey(clientID))
+	if err == badger.ErrKeyNotFound {
+		return ServiceClient{}, serviceClientNotFound
+	}
+	if err != nil {
+		return ServiceClient{}, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return ServiceClient{}, err
+	}
+	return decodeServiceClient(val)
+}
+
+func (c *BadgerUserRepository) ListServiceClients() ([]ServiceClient, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.Prefix = serviceClientPrefix
+	it := tx.NewIterator(options)
+	defer it.Close()
+
+	clients := []ServiceClient{}
+	for it.Rewind(); it.Valid(); it.Next() {
+		val, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		client, err := decodeServiceClient(val)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+func (c *BadgerUserRepository) DeleteServiceClient(clientID string) error {
+	return c.db.Update(func(tx *badger.Txn) error {
+		_, err := tx.Get(serviceClientKey(clientID))
+		if err == badger.ErrKeyNotFound {
+			return serviceClientNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Delete(serviceClientKey(clientID))
+	})
+}
+
+var apiKeyPrefix = []byte("!apikey/")
+
+func apiKeyKey(keyID string) []byte {
+	return append(append([]byte{}, apiKeyPrefix...), keyID...)
+}
+
+func (c *BadgerUserRepository) CreateAPIKey(key APIKey) error {
+	return c.db.Update(func(tx *badger.Txn) error {
+		return tx.Set(apiKeyKey(key.KeyID), encodeAPIKey(key))
+	})
+}
+
+func (c *BadgerUserRepository) GetAPIKey(keyID string) (APIKey, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	return getAPIKey(tx, keyID)
+}
+
+func getAPIKey(tx *badger.Txn, keyID string) (APIKey, error) {
+	item, err := tx.Get(apiKeyKey(keyID))
+	if err == badger.ErrKeyNotFound {
+		return APIKey{}, apiKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return APIKey{}, err
+	}
+	return decodeAPIKey(val)
+}
+
+func (c *BadgerUserRepository) UpdateAPIKey(keyID string, update func(key APIKey) (APIKey, error)) (APIKey, error) {
+	for {
+		key, err := c.updateAPIKey(keyID, update)
+		if err == badger.ErrConflict {
+			continue
+		}
+		return key, err
+	}
+}
+
+func (c *BadgerUserRepository) updateAPIKey(keyID string, update func(key APIKey) (APIKey, error)) (APIKey, error) {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	key, err := getAPIKey(tx, keyID)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key, err = update(key)
+	if err != nil {
+		return APIKey{}, err
+	}
+	err = tx.Set(apiKeyKey(keyID), encodeAPIKey(key))
+	if err != nil {
+		return APIKey{}, err
+	}
+	return key, tx.Commit()
+}
+
+// UserAPIKeys scans all keys; a user has few and partners are few next to
+// users.
+func (c *BadgerUserRepository) UserAPIKeys(userID uint64) ([]APIKey, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.Prefix = apiKeyPrefix
+	it := tx.NewIterator(options)
+	defer it.Close()
+
+	keys := []APIKey{}
+	for it.Rewind(); it.Valid(); it.Next() {
+		val, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		key, err := decodeAPIKey(val)
+		if err != nil {
+			return nil, err
+		}
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (c *BadgerUserRepository) DeleteAPIKey(keyID string) error {
+	return c.db.Update(func(tx *badger.Txn) error {
+		_, err := tx.Get(apiKeyKey(keyID))
+		if err == badger.ErrKeyNotFound {
+			return apiKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Delete(apiKeyKey(keyID))
+	})
+}
+
+var oidcClientPrefix = []byte("!oidcclient/")
+
+func oidcClientKey(clientID string) []byte {
+	return append(append([]byte{}, oidcClientPrefix...), clientID...)
+}
+
+func (c *BadgerUserRepository) CreateOIDCClient(client OIDCClient) error {
+	return c.db.Update(func(tx *badger.Txn) error {
+		return tx.Set(oidcClientKey(client.ClientID), encodeOIDCClient(client))
+	})
+}
+
+func (c *BadgerUserRepository) GetOIDCClient(clientID string) (OIDCClient, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	item, err := tx.Get(oidcClientKey(clientID))
+	if err == badger.ErrKeyNotFound {
+		return OIDCClient{}, oidcClientNotFound
+	}
+	if err != nil {
+		return OIDCClient{}, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return OIDCClient{}, err
+	}
+	return decodeOIDCClient(val)
+}
+
+func (c *BadgerUserRepository) ListOIDCClients() ([]OIDCClient, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.Prefix = oidcClientPrefix
+	it := tx.NewIterator(options)
+	defer it.Close()
+
+	clients := []OIDCClient{}
+	for it.Rewind(); it.Valid(); it.Next() {
+		val, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		client, err := decodeOIDCClient(val)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+func (c *BadgerUserRepository) DeleteOIDCClient(clientID string) error {
+	return c.db.Update(func(tx *badger.Txn) error {
+		_, err := tx.Get(oidcClientKey(clientID))
+		if err == badger.ErrKeyNotFound {
+			return oidcClientNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Delete(oidcClientKey(clientID))
+	})
+}
+
+func authCodeKey(hash string) []byte {
+	return []byte("!authcode/" + hash)
+}
+
+// CreateAuthCode stores the code with a TTL, so badger drops it once it
+// expires.
+func (c *BadgerUserRepository) CreateAuthCode(hash string, code AuthCode) error {
+	entry := badger.NewEntry(authCodeKey(hash), encodeAuthCode(code)).WithTTL(time.Until(code.ExpiresAt))
+	return c.db.Update(func(tx *badger.Txn) error {
+		return tx.SetEntry(entry)
+	})
+}
+
+func (c *BadgerUserRepository) TakeAuthCode(hash string) (AuthCode, error) {
+	for {
+		code, err := c.takeAuthCode(hash)
+		if err == badger.ErrConflict {
+			continue
+		}
+		return code, err
+	}
+}
+
+func (c *BadgerUserRepository) takeAuthCode(hash string) (AuthCode, error) {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	item, err := tx.Get(authCodeKey(hash))
+	if err == badger.ErrKeyNotFound {
+		return AuthCode{}, authCodeNotFound
+	}
+	if err != nil {
+		return AuthCode{}, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return AuthCode{}, err
+	}
+	code, err := decodeAuthCode(val)
+	if err != nil {
+		return AuthCode{}, err
+	}
+	err = tx.Delete(authCodeKey(hash))
+	if err != nil {
+		return AuthCode{}, err
+	}
+	return code, tx.Commit()
+}
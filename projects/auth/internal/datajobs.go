@@ -0,0 +1,359 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var dataJobNotFound = errors.New("data job not found")
+var dataJobNotFailed = errors.New("only failed data jobs can be retried")
+
+const (
+	dataJobExport = "export"
+	dataJobErase  = "erase"
+
+	dataJobPending = "pending"
+	dataJobDone    = "done"
+	dataJobFailed  = "failed"
+
+	// authStep is the part of a data job done by the auth service itself.
+	authStep = "auth"
+	// erasedUsernamePrefix starts the username an erased user is renamed to.
+	// New users may not take it.
+	erasedUsernamePrefix = "erased-"
+)
+
+// DataJobOptions configures exports and erasures of user data.
+type DataJobOptions struct {
+	RetryInterval time.Duration `yaml:"retry_interval" usage:"wait before a failed step of a data export or erasure is tried again"`
+	MaxAttempts   int           `yaml:"max_attempts" usage:"failed tries of a step after which a data export or erasure fails"`
+}
+
+// UserDataService is another service keeping data of users, such as the
+// booking and lease clients. Both calls must be safe to repeat.
+type UserDataService interface {
+	ExportUser(adminToken []byte, userID uint64) (json.RawMessage, error)
+	EraseUser(adminToken []byte, userID uint64) (int, error)
+}
+
+// DataJob exports or erases everything stored about a user, one service (a
+// step) at a time. It is stored before it runs and after every step, so that
+// a restart resumes it where it stopped. Results holds what each finished step
+// returned: its part of the archive for exports and what was erased for
+// erasures. Attempts counts the failed tries of the current step.
+type DataJob struct {
+	JobID     string                     `json:"job_id"`
+	Kind      string                     `json:"kind"`
+	UserID    uint64                     `json:"user_id"`
+	Status    string                     `json:"status"`
+	Steps     []string                   `json:"steps"`
+	Results   map[string]json.RawMessage `json:"results"`
+	Attempts  int                        `json:"attempts"`
+	Error     string                     `json:"error,omitempty"`
+	NextRunAt time.Time                  `json:"-"`
+	CreatedAt time.Time                  `json:"created_at"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+}
+
+// userExport is the auth part of a data export.
+type userExport struct {
+	Profile          UserProfile  `json:"profile"`
+	TwoFactorEnabled bool         `json:"two_factor_enabled"`
+	AuditEvents      []AuditEvent `json:"audit_events"`
+	APIKeys          []APIKey     `json:"api_keys"`
+}
+
+func erasedUsername(userID uint64) string {
+	return fmt.Sprintf("%s%d", erasedUsernamePrefix, userID)
+}
+
+// SetDataServices names the other services that data jobs export from and
+// erase in. adminToken is passed on to them.
+func (c *UserService) SetDataServices(adminToken []byte, services map[string]UserDataService, options DataJobOptions) {
+	c.adminToken = adminToken
+	c.dataServices = services
+	c.dataJobs = options
+}
+
+// createDataJob stores a job of kind for an existing user and wakes the
+// runner. Exports start with auth; erasures end with it, so that the user
+// stays known until the other services let go of them.
+func (c *UserService) createDataJob(kind string, userID uint64) (DataJob, error) {
+	user, err := c.repository.GetUserByID(userID)
+	if err != nil {
+		return DataJob{}, err
+	}
+
+	var names []string
+	for name := range c.dataServices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	steps := append([]string{authStep}, names...)
+	auditKind := auditDataExportRequested
+	if kind == dataJobErase {
+		steps = append(names, authStep)
+		auditKind = auditErasureRequested
+	}
+
+	buf := make([]byte, 16)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return DataJob{}, err
+	}
+	now := c.clock.Now()
+	job := DataJob{
+		JobID:     hex.EncodeToString(buf),
+		Kind:      kind,
+		UserID:    userID,
+		Status:    dataJobPending,
+		Steps:     steps,
+		Results:   map[string]json.RawMessage{},
+		NextRunAt: now,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = c.repository.CreateDataJob(job)
+	if err != nil {
+		return DataJob{}, err
+	}
+	c.audit(AuditEvent{Time: now, Kind: auditKind, Username: user.UserName})
+	c.wakeDataJobs()
+	return job, nil
+}
+
+func (c *UserService) dataJob(jobID string) (DataJob, error) {
+	return c.repository.GetDataJob(jobID)
+}
+
+func (c *UserService) userDataJobs(userID uint64) ([]DataJob, error) {
+	return c.repository.UserDataJobs(userID)
+}
+
+// retryDataJob runs a failed job again from the step it failed at.
+func (c *UserService) retryDataJob(jobID string) (DataJob, error) {
+	job, err := c.repository.UpdateDataJob(jobID, func(job DataJob) (DataJob, error) {
+		if job.Status != dataJobFailed {
+			return DataJob{}, dataJobNotFailed
+		}
+		now := c.clock.Now()
+		job.Status = dataJobPending
+		job.Attempts = 0
+		job.NextRunAt = now
+		job.UpdatedAt = now
+		return job, nil
+	})
+	if err != nil {
+		return DataJob{}, err
+	}
+	c.wakeDataJobs()
+	return job, nil
+}
+
+func (c *UserService) wakeDataJobs() {
+	select {
+	case c.dataJobWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunDataJobs runs data jobs until ctx is done: the ones left pending by a
+// previous run at once, new ones as they are created and failed steps again
+// after the retry interval. Jobs run one at a time.
+func (c *UserService) RunDataJobs(ctx context.Context) {
+	ticker := time.NewTicker(c.dataJobs.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		c.runDataJobs()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.dataJobWake:
+		}
+	}
+}
+
+func (c *UserService) runDataJobs() {
+	jobs, err := c.repository.PendingDataJobs()
+	if err != nil {
+		c.logger.Errorf("data jobs error: %v", err)
+		return
+	}
+	now := c.clock.Now()
+	for _, job := range jobs {
+		if job.NextRunAt.After(now) {
+			continue
+		}
+		c.runDataJob(job)
+	}
+}
+
+// runDataJob runs the steps of job that have not finished yet, in order, and
+// stops at the first one that fails.
+func (c *UserService) runDataJob(job DataJob) {
+	for _, step := range job.Steps {
+		if _, done := job.Results[step]; done {
+			continue
+		}
+		result, stepErr := c.runDataStep(job, step)
+		var err error
+		job, err = c.repository.UpdateDataJob(job.JobID, func(job DataJob) (DataJob, error) {
+			now := c.clock.Now()
+			job.UpdatedAt = now
+			if stepErr != nil {
+				job.Attempts++
+				job.Error = fmt.Sprintf("%s: %v", step, stepErr)
+				job.NextRunAt = now.Add(c.dataJobs.RetryInterval)
+				if job.Attempts >= c.dataJobs.MaxAttempts {
+					job.Status = dataJobFailed
+				}
+				return job, nil
+			}
+			job.Results[step] = result
+			job.Attempts = 0
+			job.Error = ""
+			return job, nil
+		})
+		if err != nil {
+			c.logger.Errorf("data job %s error: %v", job.JobID, err)
+			return
+		}
+		if stepErr != nil {
+			c.logger.Errorf("data job %s error: %s", job.JobID, job.Error)
+			return
+		}
+	}
+
+	job, err := c.repository.UpdateDataJob(job.JobID, func(job DataJob) (DataJob, error) {
+		job.Status = dataJobDone
+		job.UpdatedAt = c.clock.Now()
+		return job, nil
+	})
+	if err != nil {
+		c.logger.Errorf("data job %s error: %v", job.JobID, err)
+		return
+	}
+	if job.Kind == dataJobErase {
+		c.audit(AuditEvent{Time: job.UpdatedAt, Kind: auditUserErased, Username: erasedUsername(job.UserID)})
+	}
+}
+
+func (c *UserService) runDataStep(job DataJob, step string) (json.RawMessage, error) {
+	if step == authStep {
+		if job.Kind == dataJobExport {
+			return c.exportUser(job.UserID)
+		}
+		return c.eraseUser(job.UserID)
+	}
+
+	service, ok := c.dataServices[step]
+	if !ok {
+		return nil, fmt.Errorf("service %s is not configured", step)
+	}
+	if job.Kind == dataJobExport {
+		return service.ExportUser(c.adminToken, job.UserID)
+	}
+	erased, err := service.EraseUser(c.adminToken, job.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]int{"erased": erased})
+}
+
+// exportUser collects what auth knows about a user: the profile, whether
+// two-factor authentication is on, the user's audit events and API keys.
+func (c *UserService) exportUser(userID uint64) (json.RawMessage, error) {
+	user, err := c.repository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	twoFactorEnabled, err := c.totpRequired(user.UserName)
+	if err != nil {
+		return nil, err
+	}
+	events, err := c.repository.UserAuditLog(user.UserName)
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := c.repository.UserAPIKeys(userID)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(userExport{
+		Profile:          userProfile(user),
+		TwoFactorEnabled: twoFactorEnabled,
+		AuditEvents:      events,
+		APIKeys:          apiKeys,
+	})
+}
+
+// eraseUser forgets the personal data of a user but keeps the user_id, which
+// bookings and leases still refer to. The user is renamed to erased-<user_id>
+// with an empty profile and no password, its second factor, failed logins,
+// API keys and earlier exports are deleted and its audit events are rewritten to the new
+// name without client addresses. Running it again after it finished changes
+// nothing.
+func (c *UserService) eraseUser(userID uint64) (json.RawMessage, error) {
+	user, err := c.repository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	username := erasedUsername(userID)
+	if user.UserName != username {
+		err = c.repository.DeleteTOTP(user.UserName)
+		if err != nil {
+			return nil, err
+		}
+		err = c.repository.DeleteAttempts(userAttemptsKey(userID))
+		if err != nil {
+			return nil, err
+		}
+		err = c.repository.AnonymizeAudit(user.UserName, username)
+		if err != nil {
+			return nil, err
+		}
+		apiKeys, err := c.repository.UserAPIKeys(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, apiKey := range apiKeys {
+			err = c.repository.DeleteAPIKey(apiKey.KeyID)
+			if err != nil && err != apiKeyNotFound {
+				return nil, err
+			}
+		}
+		jobs, err := c.repository.UserDataJobs(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range jobs {
+			if job.Kind != dataJobExport {
+				continue
+			}
+			err = c.repository.DeleteDataJob(job.JobID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		_, err = c.repository.UpdateUser(user.UserName, func(user UserDBModel) (UserDBModel, error) {
+			return UserDBModel{
+				UserID:       user.UserID,
+				UserName:     username,
+				TokenVersion: user.TokenVersion + 1,
+				Disabled:     true,
+			}, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(map[string]string{"username": username})
+}
@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDataService records the calls of data jobs and fails the next failures
+// of them.
+type testDataService struct {
+	name     string
+	calls    *[]string
+	erased   map[uint64]int
+	failures int
+}
+
+func (c *testDataService) ExportUser(adminToken []byte, userID uint64) (json.RawMessage, error) {
+	return c.call("export", adminToken, userID, json.RawMessage(fmt.Sprintf(`{"service":%q}`, c.name)))
+}
+
+func (c *testDataService) EraseUser(adminToken []byte, userID uint64) (int, error) {
+	_, err := c.call("erase", adminToken, userID, nil)
+	if err != nil {
+		return 0, err
+	}
+	// Erasing twice finds nothing the second time.
+	erased := c.erased[userID]
+	delete(c.erased, userID)
+	return erased, nil
+}
+
+func (c *testDataService) call(kind string, adminToken []byte, userID uint64, result json.RawMessage) (json.RawMessage, error) {
+	*c.calls = append(*c.calls, fmt.Sprintf("%s %s %d", kind, c.name, userID))
+	if string(adminToken) != "admin" {
+		return nil, errors.New("wrong admin token")
+	}
+	if c.failures > 0 {
+		c.failures--
+		return nil, fmt.Errorf("%s is down", c.name)
+	}
+	return result, nil
+}
+
+// newDataJobTest returns a server whose user alice, with the access token
+// returned, has a second factor, an API key, a failed login and bookings and
+// leases in the other services.
+func newDataJobTest(t *testing.T) (*testClock, *UserService, *HttpServer, *[]string, map[string]*testDataService, string) {
+	t.Helper()
+	userService, server, token := newProfileTest(t)
+	clock := userService.clock.(*testClock)
+	calls := &[]string{}
+	alice, err := userService.repository.GetUser("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := map[string]*testDataService{
+		"booking": {name: "booking", calls: calls, erased: map[uint64]int{alice.UserID: 3}},
+		"lease":   {name: "lease", calls: calls, erased: map[uint64]int{alice.UserID: 1}},
+	}
+	userService.SetDataServices([]byte("admin"), map[string]UserDataService{"booking": services["booking"], "lease": services["lease"]},
+		DataJobOptions{RetryInterval: time.Minute, MaxAttempts: 2})
+
+	fullName := "Alice Liddell"
+	_, err = userService.updateProfile("alice", ProfilePatch{FullName: &fullName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enableTOTP(t, userService, "alice")
+	userService.SetAPIKeyOptions(APIKeyOptions{DefaultTTL: time.Hour, DefaultRateLimit: "1/s"})
+	_, _, err = userService.createAPIKey(alice.UserID, "partner", []string{"booking:read"}, "", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = userService.authUser("alice", "wrong", "10.0.0.1")
+	if err != wrongPassword {
+		t.Fatal(err)
+	}
+	return clock, userService, server, calls, services, token
+}
+
+// startJob starts a data job through the handler and returns it.
+func startJob(t *testing.T, server *HttpServer, route string, userID uint64) DataJob {
+	t.Helper()
+	rw := call(server, http.MethodPost, route, map[string]string{"X-Admin-Token": "admin"}, fmt.Sprintf(`{"user_id": %d}`, userID))
+	var job DataJob
+	err := json.Unmarshal(rw.Body.Bytes(), &job)
+	if rw.Code != 200 || err != nil {
+		t.Fatalf("%s: got %d %s", route, rw.Code, rw.Body)
+	}
+	return job
+}
+
+func TestExportUser(t *testing.T) {
+	_, userService, server, calls, _, _ := newDataJobTest(t)
+	alice, err := userService.profile("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := startJob(t, server, "/admin/export_user", alice.UserID)
+	if strings.Join(job.Steps, " ") != "auth booking lease" || job.Status != dataJobPending {
+		t.Fatalf("got %+v", job)
+	}
+	userService.runDataJobs()
+
+	job, err = userService.dataJob(job.JobID)
+	if err != nil || job.Status != dataJobDone {
+		t.Fatalf("got %+v, %v", job, err)
+	}
+	if strings.Join(*calls, ", ") != fmt.Sprintf("export booking %d, export lease %d", alice.UserID, alice.UserID) {
+		t.Fatalf("got calls %v", *calls)
+	}
+	var export userExport
+	err = json.Unmarshal(job.Results[authStep], &export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.Profile.FullName != "Alice Liddell" || !export.TwoFactorEnabled || len(export.APIKeys) != 1 || len(export.AuditEvents) == 0 {
+		t.Fatalf("got export %+v", export)
+	}
+	if string(job.Results["lease"]) != `{"service":"lease"}` {
+		t.Fatalf("got lease part %s", job.Results["lease"])
+	}
+}
+
+// TestEraseUser erases alice in the other services first and then in auth,
+// where only the user id is kept.
+func TestEraseUser(t *testing.T) {
+	_, userService, server, calls, _, token := newDataJobTest(t)
+	alice, err := userService.repository.GetUser("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	export := startJob(t, server, "/admin/export_user", alice.UserID)
+	userService.runDataJobs()
+	*calls = nil
+
+	job := startJob(t, server, "/admin/erase_user", alice.UserID)
+	if strings.Join(job.Steps, " ") != "booking lease auth" {
+		t.Fatalf("got steps %v", job.Steps)
+	}
+	userService.runDataJobs()
+	job, err = userService.dataJob(job.JobID)
+	if err != nil || job.Status != dataJobDone {
+		t.Fatalf("got %+v, %v", job, err)
+	}
+	if strings.Join(*calls, ", ") != fmt.Sprintf("erase booking %d, erase lease %d", alice.UserID, alice.UserID) {
+		t.Fatalf("got calls %v", *calls)
+	}
+	if string(job.Results["booking"]) != `{"erased":3}` || string(job.Results["lease"]) != `{"erased":1}` {
+		t.Fatalf("got results %s %s", job.Results["booking"], job.Results["lease"])
+	}
+
+	erased, err := userService.repository.GetUserByID(alice.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if erased.UserName != erasedUsername(alice.UserID) || erased.Profile != (Profile{}) || erased.PasswordHash != "" || !erased.Disabled {
+		t.Fatalf("got %+v", erased)
+	}
+	if _, err := userService.repository.GetUser("alice"); err != userNotFound {
+		t.Fatalf("alice: got %v, want %v", err, userNotFound)
+	}
+	if _, err := userService.repository.GetTOTP("alice"); err != totpNotEnrolled {
+		t.Fatalf("second factor: got %v, want %v", err, totpNotEnrolled)
+	}
+	if apiKeys, err := userService.repository.UserAPIKeys(alice.UserID); err != nil || len(apiKeys) != 0 {
+		t.Fatalf("api keys: got %+v, %v", apiKeys, err)
+	}
+	if attempts, err := userService.repository.Attempts(userAttemptsKey(alice.UserID)); err != nil || attempts.Failures != 0 {
+		t.Fatalf("failed logins: got %+v, %v", attempts, err)
+	}
+	if _, err := userService.dataJob(export.JobID); err != dataJobNotFound {
+		t.Fatalf("export: got %v, want %v", err, dataJobNotFound)
+	}
+	if _, err := server.checkAuth(token); err == nil {
+		t.Fatal("the token of the erased user works")
+	}
+
+	events, err := userService.repository.UserAuditLog("alice")
+	if err != nil || len(events) != 0 {
+		t.Fatalf("audit events of alice: got %+v, %v", events, err)
+	}
+	events, err = userService.repository.UserAuditLog(erased.UserName)
+	if err != nil || len(events) == 0 {
+		t.Fatalf("audit events of %s: got %+v, %v", erased.UserName, events, err)
+	}
+	for _, event := range events {
+		if event.IP != "" {
+			t.Fatalf("got address in %+v", event)
+		}
+	}
+
+	if _, err := userService.authUser("alice", "correct horse", "10.0.0.1"); err != wrongPassword {
+		t.Fatalf("login: got %v, want %v", err, wrongPassword)
+	}
+
+	// The name of an erased user is not for the taking.
+	if _, err := userService.createUser(erased.UserName, "correct horse"); err == nil {
+		t.Fatalf("created %s", erased.UserName)
+	}
+	// A second erasure finds nothing left.
+	*calls = nil
+	job = startJob(t, server, "/admin/erase_user", alice.UserID)
+	userService.runDataJobs()
+	job, err = userService.dataJob(job.JobID)
+	if err != nil || job.Status != dataJobDone || string(job.Results["booking"]) != `{"erased":0}` {
+		t.Fatalf("second erasure: got %+v, %v", job, err)
+	}
+}
+
+// TestEraseUserRetry lets the lease service fail, so that auth keeps the user
+// until the erasure is retried.
+func TestEraseUserRetry(t *testing.T) {
+	clock, userService, server, calls, services, _ := newDataJobTest(t)
+	alice, err := userService.profile("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	services["lease"].failures = 3
+
+	job := startJob(t, server, "/admin/erase_user", alice.UserID)
+	userService.runDataJobs()
+	job, err = userService.dataJob(job.JobID)
+	if err != nil || job.Status != dataJobPending || job.Attempts != 1 || !strings.Contains(job.Error, "lease is down") {
+		t.Fatalf("got %+v, %v", job, err)
+	}
+	if _, err := userService.profile("alice"); err != nil {
+		t.Fatalf("alice was erased in auth before lease: %v", err)
+	}
+
+	// The step waits for the retry interval, and fails for good after
+	// max_attempts.
+	userService.runDataJobs()
+	clock.advance(time.Minute)
+	userService.runDataJobs()
+	job, err = userService.dataJob(job.JobID)
+	if err != nil || job.Status != dataJobFailed || job.Attempts != 2 {
+		t.Fatalf("got %+v, %v", job, err)
+	}
+	if strings.Count(strings.Join(*calls, ","), "erase booking") != 1 {
+		t.Fatalf("a finished step ran again: %v", *calls)
+	}
+
+	rw := call(server, http.MethodPost, "/admin/retry_data_job", map[string]string{"X-Admin-Token": "admin"}, `{"job_id": "`+job.JobID+`"}`)
+	if rw.Code != 200 {
+		t.Fatalf("retry: got %d %s", rw.Code, rw.Body)
+	}
+	userService.runDataJobs()
+	clock.advance(time.Minute)
+	userService.runDataJobs()
+	job, err = userService.dataJob(job.JobID)
+	if err != nil || job.Status != dataJobDone {
+		t.Fatalf("got %+v, %v", job, err)
+	}
+	if _, err := userService.profile("alice"); err != userNotFound {
+		t.Fatalf("alice after the erasure: got %v", err)
+	}
+	rw = call(server, http.MethodPost, "/admin/retry_data_job", map[string]string{"X-Admin-Token": "admin"}, `{"job_id": "`+job.JobID+`"}`)
+	if rw.Code != 400 {
+		t.Fatalf("retry of a finished job: got %d, want 400", rw.Code)
+	}
+}
@@ -1,122 +1,285 @@
 package internal
 
 import (
-	"encoding/json"
 	"errors"
-	badger "github.com/dgraph-io/badger/v3"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"time"
 )
 
 var userAlreadyExists = errors.New("user already exists")
+var userNotFound = errors.New("user not found")
 var wrongPassword = errors.New("wrong password")
+var invalidUsername = errors.New("username must not be empty or start with '!' or 'erased-'")
 
 type UserService struct {
-	db             *badger.DB
-	userIDSequence *badger.Sequence
-	logger         *zap.SugaredLogger
+	repository UserRepository
+	logger     *zap.SugaredLogger
+	bcryptCost int
+	userPolicy LockoutPolicy
+	ipPolicy   LockoutPolicy
+	// unknown counts the failed logins of usernames that do not exist.
+	unknown *unknownAttempts
+	totp    TOTPOptions
+	// passwordReset and notifier drive the password reset flow.
+	passwordReset PasswordResetOptions
+	notifier      Notifier
+	clock         Clock
+	// adminToken, dataServices and dataJobs drive exports and erasures of
+	// user data, see SetDataServices.
+	adminToken   []byte
+	dataServices map[string]UserDataService
+	dataJobs     DataJobOptions
+	dataJobWake  chan struct{}
+	// serviceTokenTTL is how long tokens of service clients are valid.
+	serviceTokenTTL time.Duration
+	// apiKeys holds the defaults and limits of new API keys.
+	apiKeys APIKeyOptions
+	// oidc configures the OpenID Connect provider.
+	oidc OIDCOptions
 }
 
-func NewUserService(db *badger.DB, userIDSequence *badger.Sequence) *UserService {
+// NewUserService creates a user service hashing passwords with the given
+// bcrypt cost. Failed logins are throttled per username by userPolicy and per
+// client address by ipPolicy. totp configures the optional second factor and
+// notifier delivers password reset tokens.
+func NewUserService(repository UserRepository, logger *zap.SugaredLogger, bcryptCost int, userPolicy, ipPolicy LockoutPolicy, totp TOTPOptions, passwordReset PasswordResetOptions, notifier Notifier, clock Clock) *UserService {
 	return &UserService{
-		db:             db,
-		userIDSequence: userIDSequence,
+		repository:    repository,
+		logger:        logger,
+		bcryptCost:    bcryptCost,
+		userPolicy:    userPolicy,
+		ipPolicy:      ipPolicy,
+		unknown:       newUnknownAttempts(),
+		totp:          totp,
+		passwordReset: passwordReset,
+		notifier:      notifier,
+		clock:         clock,
+		dataJobWake:   make(chan struct{}, 1),
 	}
 }
 
 type User struct {
-	UserID   uint64 `json:"user_id,omitempty"`
-	UserName string `json:"user_name,omitempty"`
+	UserID       uint64 `json:"user_id,omitempty"`
+	UserName     string `json:"user_name,omitempty"`
+	TokenVersion uint64 `json:"token_version,omitempty"`
 }
 
+// UserDBModel is a stored user. TokenVersion changes with the password; access
+// tokens carry the version they were issued for. Disabled users can not log in.
+// An empty LicenseStatus means the driver's license is unverified.
 type UserDBModel struct {
 	UserID       uint64 `json:"user_id,omitempty"`
 	UserName     string `json:"user_name,omitempty"`
 	PasswordHash string `json:"password_hash,omitempty"`
+	TokenVersion uint64 `json:"token_version,omitempty"`
+	Profile
+	Disabled      bool   `json:"disabled,omitempty"`
+	LicenseStatus string `json:"license_status,omitempty"`
 }
 
 func (c *UserService) createUser(username string, password string) (User, error) {
-	tx := c.db.NewTransaction(true)
-	defer tx.Discard()
+	if username == "" || strings.HasPrefix(username, "!") || strings.HasPrefix(username, erasedUsernamePrefix) {
+		return User{}, invalidUsername
+	}
 
-	userID, err := c.userIDSequence.Next()
+	userID, err := c.repository.NextUserID()
 	if err != nil {
 		return User{}, err
 	}
 
-	passwordHash, err := HashPassword(password)
+	passwordHash, err := HashPassword(password, c.bcryptCost)
 	if err != nil {
 		return User{}, err
 	}
 
-	user := User{
-		UserID:   userID,
-		UserName: username,
-	}
-
 	userDBModel := UserDBModel{
 		UserID:       userID,
 		UserName:     username,
 		PasswordHash: passwordHash,
 	}
 
-	userNameBts := []byte(username)
-	_, err = tx.Get(userNameBts)
-	if err == badger.ErrKeyNotFound {
-		userBts, err := json.Marshal(&userDBModel)
-		if err != nil {
-			return User{}, err
-		}
-		err = tx.Set(userNameBts, userBts)
-		if err != nil {
-			return User{}, err
-		}
+	err = c.repository.CreateUser(userDBModel)
+	if err != nil {
+		return User{}, err
+	}
 
-		err = tx.Commit()
-		if err != nil {
-			return User{}, err
-		}
+	return User{
+		UserID:   userID,
+		UserName: username,
+	}, nil
+}
+
+// authUser checks the password unless the username or the client address is
+// throttled, in which case it returns *tooManyAttempts without looking at the
+// password. Unknown usernames are throttled like known ones.
+func (c *UserService) authUser(username string, password string, ip string) (User, error) {
+	now := c.clock.Now()
+	ipKey := ipAttemptsKey(ip)
 
-		return user, nil
+	userDBModel, err := c.findUser(username)
+	if err != nil {
+		return User{}, err
 	}
+	err = c.checkUserAttempts(userDBModel, username, now)
 	if err == nil {
-		return User{}, userAlreadyExists
+		err = c.checkAttempts(ipKey, c.ipPolicy, now)
+	}
+	if err != nil {
+		if _, ok := err.(*tooManyAttempts); ok {
+			c.audit(AuditEvent{Time: now, Kind: auditLoginThrottled, Username: username, IP: ip})
+		}
+		return User{}, err
 	}
-	// err != nil and err != ErrKeyNotFound
-	return User{}, err
-}
-
-func (c *UserService) authUser(username string, password string) (User, error) {
-	tx := c.db.NewTransaction(false)
-	defer tx.Discard()
-
-	userNameBts := []byte(username)
-	userDBObject, err := tx.Get(userNameBts)
 
-	val, err := userDBObject.ValueCopy(nil)
+	user, err := checkPassword(userDBModel, password)
+	if err == wrongPassword {
+		c.audit(AuditEvent{Time: now, Kind: auditLoginFailed, Username: username, IP: ip})
+		failErr := c.recordUserFailure(userDBModel, username, now)
+		if failErr == nil {
+			failErr = c.recordFailure(ipKey, c.ipPolicy, now, AuditEvent{Time: now, Kind: auditLocked, IP: ip})
+		}
+		if failErr != nil {
+			return User{}, failErr
+		}
+		return User{}, wrongPassword
+	}
 	if err != nil {
 		return User{}, err
 	}
 
-	userDBModel := UserDBModel{}
-	err = json.Unmarshal(val, &userDBModel)
+	err = c.repository.DeleteAttempts(userAttemptsKey(user.UserID))
 	if err != nil {
 		return User{}, err
 	}
+	return user, nil
+}
+
+// findUser returns the user named username, or nil if there is none.
+func (c *UserService) findUser(username string) (*UserDBModel, error) {
+	userDBModel, err := c.repository.GetUser(username)
+	if err == userNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &userDBModel, nil
+}
+
+// checkPassword checks password against userDBModel, which is nil for an
+// unknown username.
+func checkPassword(userDBModel *UserDBModel, password string) (User, error) {
+	if userDBModel == nil {
+		// Unknown usernames look the same as wrong passwords to the caller.
+		return User{}, wrongPassword
+	}
 
 	ok := CheckPasswordHash(password, userDBModel.PasswordHash)
 	if !ok {
 		return User{}, wrongPassword
 	}
+	if userDBModel.Disabled {
+		return User{}, userDisabled
+	}
 
 	return User{
-		UserID:   userDBModel.UserID,
-		UserName: userDBModel.UserName,
+		UserID:       userDBModel.UserID,
+		UserName:     userDBModel.UserName,
+		TokenVersion: userDBModel.TokenVersion,
 	}, nil
 }
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+func (c *UserService) checkAttempts(key string, policy LockoutPolicy, now time.Time) error {
+	attempts, err := c.repository.Attempts(key)
+	if err != nil {
+		return err
+	}
+	return policy.check(attempts, now)
+}
+
+// checkUserAttempts throttles the logins of a user, or of username if
+// userDBModel is nil because no user has that name.
+func (c *UserService) checkUserAttempts(userDBModel *UserDBModel, username string, now time.Time) error {
+	if userDBModel == nil {
+		return c.userPolicy.check(c.unknown.get(username), now)
+	}
+	return c.checkAttempts(userAttemptsKey(userDBModel.UserID), c.userPolicy, now)
+}
+
+func (c *UserService) recordFailure(key string, policy LockoutPolicy, now time.Time, lockEvent AuditEvent) error {
+	var locked bool
+	_, err := c.repository.UpdateAttempts(key, func(attempts Attempts) Attempts {
+		attempts, locked = policy.fail(attempts, now)
+		return attempts
+	})
+	if err != nil {
+		return err
+	}
+	if locked {
+		c.audit(lockEvent)
+	}
+	return nil
+}
+
+// recordUserFailure counts a failed login of a user, or of username if
+// userDBModel is nil.
+func (c *UserService) recordUserFailure(userDBModel *UserDBModel, username string, now time.Time) error {
+	lockEvent := AuditEvent{Time: now, Kind: auditLocked, Username: username}
+	if userDBModel == nil {
+		if c.unknown.fail(username, c.userPolicy, now) {
+			c.audit(lockEvent)
+		}
+		return nil
+	}
+	return c.recordFailure(userAttemptsKey(userDBModel.UserID), c.userPolicy, now, lockEvent)
+}
+
+// unlock lifts the lock and forgets the failures of a username or a client
+// address, whichever is set.
+func (c *UserService) unlock(username string, ip string) error {
+	event := AuditEvent{Time: c.clock.Now(), Kind: auditUnlocked, Username: username, IP: ip}
+	if username != "" {
+		userDBModel, err := c.findUser(username)
+		if err != nil {
+			return err
+		}
+		if userDBModel == nil {
+			c.unknown.delete(username)
+		} else {
+			err = c.repository.DeleteAttempts(userAttemptsKey(userDBModel.UserID))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if ip != "" {
+		err := c.repository.DeleteAttempts(ipAttemptsKey(ip))
+		if err != nil {
+			return err
+		}
+	}
+	c.audit(event)
+	return nil
+}
+
+func (c *UserService) auditLog(limit int) ([]AuditEvent, error) {
+	return c.repository.AuditLog(limit)
+}
+
+// audit writes event to the audit log in the database and to the service log.
+// A failure to store it is logged but does not fail the request.
+func (c *UserService) audit(event AuditEvent) {
+	c.logger.Infow("audit", "kind", event.Kind, "username", event.Username, "ip", event.IP, "time", event.Time)
+	err := c.repository.AppendAudit(event)
+	if err != nil {
+		c.logger.Errorf("audit error: %v", err)
+	}
+}
+
+func HashPassword(password string, cost int) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	return string(bytes), err
 }
 
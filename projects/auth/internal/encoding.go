@@ -0,0 +1,628 @@
+package internal
+
+import (
+	"distributed-rental/pkg/record"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// userSchemaVersion is what encodeUser writes. Version 0 is the original JSON layout.
+const userSchemaVersion = 1
+
+// Field numbers of the version 1 user record. Never reuse a number.
+const (
+	userIDField               = 1
+	userNameField             = 2
+	userPasswordHashField     = 3
+	userTokenVersionField     = 4
+	userFullNameField         = 5
+	userEmailField            = 6
+	userPhoneField            = 7
+	userDateOfBirthField      = 8
+	userDriverLicenseField    = 9
+	userDisabledField         = 10
+	userLicenseCountryField   = 11
+	userLicenseExpiresOnField = 12
+	userLicenseStatusField    = 13
+)
+
+func encodeUser(user UserDBModel) []byte {
+	e := record.Encoder{}
+	e.Uint64(userIDField, user.UserID)
+	e.String(userNameField, user.UserName)
+	e.String(userPasswordHashField, user.PasswordHash)
+	e.Uint64(userTokenVersionField, user.TokenVersion)
+	e.String(userFullNameField, user.FullName)
+	e.String(userEmailField, user.Email)
+	e.String(userPhoneField, user.Phone)
+	e.String(userDateOfBirthField, user.DateOfBirth)
+	e.String(userDriverLicenseField, user.DriverLicense)
+	e.Bool(userDisabledField, user.Disabled)
+	e.String(userLicenseCountryField, user.DriverLicenseCountry)
+	e.String(userLicenseExpiresOnField, user.DriverLicenseExpiresOn)
+	e.String(userLicenseStatusField, user.LicenseStatus)
+	return record.Seal(userSchemaVersion, e.Bytes())
+}
+
+// decodeUser reads a stored user of any known schema version.
+func decodeUser(data []byte) (UserDBModel, error) {
+	version, payload, err := record.Open(data)
+	if err != nil {
+		return UserDBModel{}, err
+	}
+
+	user := UserDBModel{}
+	switch version {
+	case 0:
+		err = json.Unmarshal(payload, &user)
+		if err != nil {
+			return UserDBModel{}, err
+		}
+	case 1:
+		err = record.Walk(payload, func(f record.Field) error {
+			switch f.Number {
+			case userIDField:
+				user.UserID = f.Varint
+			case userNameField:
+				user.UserName = f.String()
+			case userPasswordHashField:
+				user.PasswordHash = f.String()
+			case userTokenVersionField:
+				user.TokenVersion = f.Varint
+			case userFullNameField:
+				user.FullName = f.String()
+			case userEmailField:
+				user.Email = f.String()
+			case userPhoneField:
+				user.Phone = f.String()
+			case userDateOfBirthField:
+				user.DateOfBirth = f.String()
+			case userDriverLicenseField:
+				user.DriverLicense = f.String()
+			case userDisabledField:
+				user.Disabled = f.Bool()
+			case userLicenseCountryField:
+				user.DriverLicenseCountry = f.String()
+			case userLicenseExpiresOnField:
+				user.DriverLicenseExpiresOn = f.String()
+			case userLicenseStatusField:
+				user.LicenseStatus = f.String()
+			}
+			return nil
+		})
+		if err != nil {
+			return UserDBModel{}, err
+		}
+	default:
+		return UserDBModel{}, fmt.Errorf("user record has unknown schema version %d", version)
+	}
+	return user, nil
+}
+
+// Field numbers of the failed login record. Times are Unix nanoseconds.
+const (
+	attemptsFailuresField    = 1
+	attemptsLastFailureField = 2
+	attemptsLockedUntilField = 3
+)
+
+const attemptsSchemaVersion = 1
+
+func encodeAttempts(attempts Attempts) []byte {
+	e := record.Encoder{}
+	e.Uint64(attemptsFailuresField, uint64(attempts.Failures))
+	e.Int64(attemptsLastFailureField, unixNano(attempts.LastFailure))
+	e.Int64(attemptsLockedUntilField, unixNano(attempts.LockedUntil))
+	return record.Seal(attemptsSchemaVersion, e.Bytes())
+}
+
+func decodeAttempts(data []byte) (Attempts, error) {
+	version, payload, err := record.Open(data)
+	if err != nil {
+		return Attempts{}, err
+	}
+	if version != attemptsSchemaVersion {
+		return Attempts{}, fmt.Errorf("attempts record has unknown schema version %d", version)
+	}
+
+	attempts := Attempts{}
+	err = record.Walk(payload, func(f record.Field) error {
+		switch f.Number {
+		case attemptsFailuresField:
+			attempts.Failures = uint32(f.Varint)
+		case attemptsLastFailureField:
+			attempts.LastFailure = fromUnixNano(f.Int64())
+		case attemptsLockedUntilField:
+			attempts.LockedUntil = fromUnixNano(f.Int64())
+		}
+		return nil
+	})
+	return attempts, err
+}
+
+// Field numbers of the audit event record.
+const (
+	auditTimeField     = 1
+	auditKindField     = 2
+	auditUsernameField = 3
+	auditIPField       = 4
+)
+
+const auditSchemaVersion = 1
+
+func encodeAuditEvent(event AuditEvent) []byte {
+	e := record.Encoder{}
+	e.Int64(auditTimeField, unixNano(event.Time))
+	e.String(auditKindField, event.Kind)
+	e.String(auditUsernameField, event.Username)
+	e.String(auditIPField, event.IP)
+	return record.Seal(auditSchemaVersion, e.Bytes())
+}
+
+func decodeAuditEvent(data []byte) (AuditEvent, error) {
+	version, payload, err := record.Open(data)
+	if err != nil {
+		return AuditEvent{}, err
+	}
+	if version != auditSchemaVersion {
+		return AuditEvent{}, fmt.Errorf("audit record has unknown schema version %d", version)
+	}
+
+	event := AuditEvent{}
+	err = record.Walk(payload, func(f record.Field) error {
+		switch f.Number {
+		case auditTimeField:
+			event.Time = fromUnixNano(f.Int64())
+		case auditKindField:
+			event.Kind = f.String()
+		case auditUsernameField:
+			event.Username = f.String()
+		case auditIPField:
+			event.IP = f.String()
+		}
+		return nil
+	})
+	return event, err
+}
+
+// Field numbers of the two-factor record. Field 4 repeats, once per unused
+// recovery code hash.
+const (
+	totpSecretField       = 1
+	totpConfirmedField    = 2
+	totpLastStepField     = 3
+	totpRecoveryCodeField = 4
+)
+
+const totpSchemaVersion = 1
+
+func encodeTOTP(totp TOTP) []byte {
+	e := record.Encoder{}
+	e.String(totpSecretField, string(totp.Secret))
+	e.Bool(totpConfirmedField, totp.Confirmed)
+	e.Uint64(totpLastStepField, totp.LastStep)
+	for _, code := range totp.RecoveryCodes {
+		e.String(totpRecoveryCodeField, code)
+	}
+	return record.Seal(totpSchemaVersion, e.Bytes())
+}
+
+func decodeTOTP(data []byte) (TOTP, error) {
+	version, payload, err := record.Open(data)
+	if err != nil {
+		return TOTP{}, err
+	}
+	if version != totpSchemaVersion {
+		return TOTP{}, fmt.Errorf("totp record has unknown schema version %d", version)
+	}
+
+	totp := TOTP{}
+	err = record.Walk(payload, func(f record.Field) error {
+		switch f.Number {
+		case totpSecretField:
+			totp.Secret = append([]byte{}, f.Bytes...)
+		case totpConfirmedField:
+			totp.Confirmed = f.Bool()
+		case totpLastStepField:
+			totp.LastStep = f.Varint
+		case totpRecoveryCodeField:
+			totp.RecoveryCodes = append(totp.RecoveryCodes, f.String())
+		}
+		return nil
+	})
+	return totp, err
+}
+
+// Field numbers of the password reset token record.
+const (
+	resetTokenUsernameField  = 1
+	resetTokenExpiresAtField = 2
+)
+
+const resetTokenSchemaVersion = 1
+
+func encodeResetToken(token ResetToken) []byte {
+	e := record.Encoder{}
+	e.String(resetTokenUsernameField, token.Username)
+	e.Int64(resetTokenExpiresAtField, unixNano(token.ExpiresAt))
+	return record.Seal(resetTokenSchemaVersion, e.Bytes())
+}
+
+func decodeResetToken(data []byte) (ResetToken, error) {
+	version, payload, err := record.Open(data)
+	if err != nil {
+		return ResetToken{}, err
+	}
+	if version != resetTokenSchemaVersion {
+		return ResetToken{}, fmt.Errorf("reset token record has unknown schema version %d", version)
+	}
+
+	token := ResetToken{}
+	err = record.Walk(payload, func(f record.Field) error {
+		switch f.Number {
+		case resetTokenUsernameField:
+			token.Username = f.String()
+		case resetTokenExpiresAtField:
+			token.ExpiresAt = fromUnixNano(f.Int64())
+		}
+		return nil
+	})
+	return token, err
+}
+
+// Field numbers of the data job record. Fields 5 and 6 repeat, once per step
+// and once per finished step; a result is a nested record of its step name
+// and JSON.
+const (
+	dataJobIDField        = 1
+	dataJobKindField      = 2
+	dataJobUserIDField    = 3
+	dataJobStatusField    = 4
+	dataJobStepField      = 5
+	dataJobResultField    = 6
+	dataJobAttemptsField  = 7
+	dataJobErrorField     = 8
+	dataJobNextRunAtField = 9
+	dataJobCreatedAtField = 10
+	dataJobUpdatedAtField = 11
+
+	dataJobResultStepField = 1
+	dataJobResultDataField = 2
+)
+
+const dataJobSchemaVersion = 1
+
+func encodeDataJob(job DataJob) []byte {
+	e := record.Encoder{}
+	e.String(dataJobIDField, job.JobID)
+	e.String(dataJobKindField, job.Kind)
+	e.Uint64(dataJobUserIDField, job.UserID)
+	e.String(dataJobStatusField, job.Status)
+	for _, step := range job.Steps {
+		e.String(dataJobStepField, step)
+	}
+	for _, step := range job.Steps {
+		result, ok := job.Results[step]
+		if !ok {
+			continue
+		}
+		r := record.Encoder{}
+		r.String(dataJobResultStepField, step)
+		r.String(dataJobResultDataField, string(result))
+		e.String(dataJobResultField, string(r.Bytes()))
+	}
+	e.Uint64(dataJobAttemptsField, uint64(job.Attempts))
+	e.String(dataJobErrorField, job.Error)
+	e.Int64(dataJobNextRunAtField, unixNano(job.NextRunAt))
+	e.Int64(dataJobCreatedAtField, unixNano(job.CreatedAt))
+	e.Int64(dataJobUpdatedAtField, unixNano(job.UpdatedAt))
+	return record.Seal(dataJobSchemaVersion, e.Bytes())
+}
+
+func decodeDataJob(data []byte) (DataJob, error) {
+	version, payload, err := record.Open(data)
+	if err != nil {
+		return DataJob{}, err
+	}
+	if version != dataJobSchemaVersion {
+		return DataJob{}, fmt.Errorf("data job record has unknown schema version %d", version)
+	}
+
+	job := DataJob{Results: map[string]json.RawMessage{}}
+	err = record.Walk(payload, func(f record.Field) error {
+		switch f.Number {
+		case dataJobIDField:
+			job.JobID = f.String()
+		case dataJobKindField:
+			job.Kind = f.String()
+		case dataJobUserIDField:
+			job.UserID = f.Varint
+		case dataJobStatusField:
+			job.Status = f.String()
+		case dataJobStepField:
+			job.Steps = append(job.Steps, f.String())
+		case dataJobResultField:
+			var step string
+			var result json.RawMessage
+			err := record.Walk(f.Bytes, func(f record.Field) error {
+				switch f.Number {
+				case dataJobResultStepField:
+					step = f.String()
+				case dataJobResultDataField:
+					result = append(json.RawMessage{}, f.Bytes...)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			job.Results[step] = result
+		case dataJobAttemptsField:
+			job.Attempts = int(f.Varint)
+		case dataJobErrorField:
+			job.Error = f.String()
+		case dataJobNextRunAtField:
+			job.NextRunAt = fromUnixNano(f.Int64())
+		case dataJobCreatedAtField:
+			job.CreatedAt = fromUnixNano(f.Int64())
+		case dataJobUpdatedAtField:
+			job.UpdatedAt = fromUnixNano(f.Int64())
+		}
+		return nil
+	})
+	return job, err
+}
+
+// Field numbers of the service client record. Field 3 repeats, once per scope.
+const (
+	serviceClientIDField         = 1
+	serviceClientSecretHashField = 2
+	serviceClientScopeField      = 3
+	serviceClientCreatedAtField  = 4
+)
+
+const serviceClientSchemaVersion = 1
+
+func encodeServiceClient(client ServiceClient) []byte {
+	e := record.Encoder{}
+	e.String(serviceClientIDField, client.ClientID)
+	e.String(serviceClientSecretHashField, client.SecretHash)
+	for _, scope := range client.Scopes {
+		e.String(serviceClientScopeField, scope)
+	}
+	e.Int64(serviceClientCreatedAtField, unixNano(client.CreatedAt))
+	return record.Seal(serviceClientSchemaVersion, e.Bytes())
+}
+
+func decodeServiceClient(data []byte) (ServiceClient, error) {
+	version, payload, err := record.Open(data)
+	if err != nil {
+		return ServiceClient{}, err
+	}
+	if version != serviceClientSchemaVersion {
+		return ServiceClient{}, fmt.Errorf("service client record has unknown schema version %d", version)
+	}
+
+	client := ServiceClient{}
+	err = record.Walk(payload, func(f record.Field) error {
+		switch f.Number {
+		case serviceClientIDField:
+			client.ClientID = f.String()
+		case serviceClientSecretHashField:
+			client.SecretHash = f.String()
+		case serviceClientScopeField:
+			client.Scopes = append(client.Scopes, f.String())
+		case serviceClientCreatedAtField:
+			client.CreatedAt = fromUnixNano(f.Int64())
+		}
+		return nil
+	})
+	return client, err
+}
+
+// Field numbers of the API key record. Field 5 repeats, once per scope, and
+// field 8 is left out for a key never used.
+const (
+	apiKeyIDField         = 1
+	apiKeyUserIDField     = 2
+	apiKeyNameField       = 3
+	apiKeySecretHashField = 4
+	apiKeyScopeField      = 5
+	apiKeyRateLimitField  = 6
+	apiKeyExpiresAtField  = 7
+	apiKeyLastUsedAtField = 8
+	apiKeyCreatedAtField  = 9
+)
+
+const apiKeySchemaVersion = 1
+
+func encodeAPIKey(key APIKey) []byte {
+	e := record.Encoder{}
+	e.String(apiKeyIDField, key.KeyID)
+	e.Uint64(apiKeyUserIDField, key.UserID)
+	e.String(apiKeyNameField, key.Name)
+	e.String(apiKeySecretHashField, key.SecretHash)
+	for _, scope := range key.Scopes {
+		e.String(apiKeyScopeField, scope)
+	}
+	e.String(apiKeyRateLimitField, key.RateLimit)
+	e.Int64(apiKeyExpiresAtField, unixNano(key.ExpiresAt))
+	if key.LastUsedAt != nil {
+		e.Int64(apiKeyLastUsedAtField, unixNano(*key.LastUsedAt))
+	}
+	e.Int64(apiKeyCreatedAtField, unixNano(key.CreatedAt))
+	return record.Seal(apiKeySchemaVersion, e.Bytes())
+}
+
+func decodeAPIKey(data []byte) (APIKey, error) {
+	version, payload, err := record.Open(data)
+	if err != nil {
+		return APIKey{}, err
+	}
+	if version != apiKeySchemaVersion {
+		return APIKey{}, fmt.Errorf("api key record has unknown schema version %d", version)
+	}
+
+	key := APIKey{}
+	err = record.Walk(payload, func(f record.Field) error {
+		switch f.Number {
+		case apiKeyIDField:
+			key.KeyID = f.String()
+		case apiKeyUserIDField:
+			key.UserID = f.Varint
+		case apiKeyNameField:
+			key.Name = f.String()
+		case apiKeySecretHashField:
+			key.SecretHash = f.String()
+		case apiKeyScopeField:
+			key.Scopes = append(key.Scopes, f.String())
+		case apiKeyRateLimitField:
+			key.RateLimit = f.String()
+		case apiKeyExpiresAtField:
+			key.ExpiresAt = fromUnixNano(f.Int64())
+		case apiKeyLastUsedAtField:
+			lastUsedAt := fromUnixNano(f.Int64())
+			key.LastUsedAt = &lastUsedAt
+		case apiKeyCreatedAtField:
+			key.CreatedAt = fromUnixNano(f.Int64())
+		}
+		return nil
+	})
+	return key, err
+}
+
+// Field numbers of the OpenID Connect client record. Field 4 repeats, once
+// per redirect URI.
+const (
+	oidcClientIDField          = 1
+	oidcClientNameField        = 2
+	oidcClientSecretHashField  = 3
+	oidcClientRedirectURIField = 4
+	oidcClientAuthMethodField  = 5
+	oidcClientCreatedAtField   = 6
+)
+
+const oidcClientSchemaVersion = 1
+
+func encodeOIDCClient(client OIDCClient) []byte {
+	e := record.Encoder{}
+	e.String(oidcClientIDField, client.ClientID)
+	e.String(oidcClientNameField, client.Name)
+	e.String(oidcClientSecretHashField, client.SecretHash)
+	for _, uri := range client.RedirectURIs {
+		e.String(oidcClientRedirectURIField, uri)
+	}
+	e.String(oidcClientAuthMethodField, client.TokenEndpointAuthMethod)
+	e.Int64(oidcClientCreatedAtField, unixNano(client.CreatedAt))
+	return record.Seal(oidcClientSchemaVersion, e.Bytes())
+}
+
+func decodeOIDCClient(data []byte) (OIDCClient, error) {
+	version, payload, err := record.Open(data)
+	if err != nil {
+		return OIDCClient{}, err
+	}
+	if version != oidcClientSchemaVersion {
+		return OIDCClient{}, fmt.Errorf("oidc client record has unknown schema version %d", version)
+	}
+
+	client := OIDCClient{}
+	err = record.Walk(payload, func(f record.Field) error {
+		switch f.Number {
+		case oidcClientIDField:
+			client.ClientID = f.String()
+		case oidcClientNameField:
+			client.Name = f.String()
+		case oidcClientSecretHashField:
+			client.SecretHash = f.String()
+		case oidcClientRedirectURIField:
+			client.RedirectURIs = append(client.RedirectURIs, f.String())
+		case oidcClientAuthMethodField:
+			client.TokenEndpointAuthMethod = f.String()
+		case oidcClientCreatedAtField:
+			client.CreatedAt = fromUnixNano(f.Int64())
+		}
+		return nil
+	})
+	return client, err
+}
+
+// Field numbers of the authorization code record. Field 4 repeats, once per
+// scope.
+const (
+	authCodeClientIDField      = 1
+	authCodeRedirectURIField   = 2
+	authCodeUsernameField      = 3
+	authCodeScopeField         = 4
+	authCodeNonceField         = 5
+	authCodeCodeChallengeField = 6
+	authCodeAuthTimeField      = 7
+	authCodeExpiresAtField     = 8
+)
+
+const authCodeSchemaVersion = 1
+
+func encodeAuthCode(code AuthCode) []byte {
+	e := record.Encoder{}
+	e.String(authCodeClientIDField, code.ClientID)
+	e.String(authCodeRedirectURIField, code.RedirectURI)
+	e.String(authCodeUsernameField, code.Username)
+	for _, scope := range code.Scopes {
+		e.String(authCodeScopeField, scope)
+	}
+	e.String(authCodeNonceField, code.Nonce)
+	e.String(authCodeCodeChallengeField, code.CodeChallenge)
+	e.Int64(authCodeAuthTimeField, unixNano(code.AuthTime))
+	e.Int64(authCodeExpiresAtField, unixNano(code.ExpiresAt))
+	return record.Seal(authCodeSchemaVersion, e.Bytes())
+}
+
+func decodeAuthCode(data []byte) (AuthCode, error) {
+	version, payload, err := record.Open(data)
+	if err != nil {
+		return AuthCode{}, err
+	}
+	if version != authCodeSchemaVersion {
+		return AuthCode{}, fmt.Errorf("authorization code record has unknown schema version %d", version)
+	}
+
+	code := AuthCode{}
+	err = record.Walk(payload, func(f record.Field) error {
+		switch f.Number {
+		case authCodeClientIDField:
+			code.ClientID = f.String()
+		case authCodeRedirectURIField:
+			code.RedirectURI = f.String()
+		case authCodeUsernameField:
+			code.Username = f.String()
+		case authCodeScopeField:
+			code.Scopes = append(code.Scopes, f.String())
+		case authCodeNonceField:
+			code.Nonce = f.String()
+		case authCodeCodeChallengeField:
+			code.CodeChallenge = f.String()
+		case authCodeAuthTimeField:
+			code.AuthTime = fromUnixNano(f.Int64())
+		case authCodeExpiresAtField:
+			code.ExpiresAt = fromUnixNano(f.Int64())
+		}
+		return nil
+	})
+	return code, err
+}
+
+// unixNano maps the zero time to 0 so that unset times round-trip.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
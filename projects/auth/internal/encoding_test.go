@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var testUserRecord = UserDBModel{
+	UserID:       7,
+	UserName:     "alice",
+	PasswordHash: "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+	TokenVersion: 3,
+	Profile: Profile{
+		FullName:               "Alice A",
+		Email:                  "alice@example.com",
+		Phone:                  "+15550100",
+		DateOfBirth:            "1990-01-01",
+		DriverLicense:          "D1234567",
+		DriverLicenseCountry:   "US",
+		DriverLicenseExpiresOn: "2030-01-01",
+	},
+	LicenseStatus: "verified",
+}
+
+func TestEncodeUser(t *testing.T) {
+	for _, user := range []UserDBModel{testUserRecord, {}} {
+		got, err := decodeUser(encodeUser(user))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != user {
+			t.Fatalf("got %+v, want %+v", got, user)
+		}
+	}
+}
+
+// BenchmarkEncode compares the record envelope with the JSON it replaced.
+func BenchmarkEncode(b *testing.B) {
+	b.Run("record", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			encodeUser(testUserRecord)
+		}
+	})
+	b.Run("json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, err := json.Marshal(testUserRecord)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDecode(b *testing.B) {
+	b.Run("record", func(b *testing.B) {
+		data := encodeUser(testUserRecord)
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, err := decodeUser(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("json", func(b *testing.B) {
+		data, err := json.Marshal(testUserRecord)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var user UserDBModel
+			err := json.Unmarshal(data, &user)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Clock tells the lockout logic what time it is; tests substitute their own.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
+
+// LockoutPolicy throttles failed logins for one key, a username or a client IP.
+// The first FreeAttempts failures cost nothing; each further one doubles the
+// wait before the next attempt, starting at BaseDelay and capped at MaxDelay.
+// LockAfter failures lock the key for LockDuration. Failures older than Window
+// are forgotten.
+type LockoutPolicy struct {
+	FreeAttempts uint32        `yaml:"free_attempts" usage:"failed logins allowed without delay"`
+	BaseDelay    time.Duration `yaml:"base_delay" usage:"wait after the first failure past free_attempts, doubled on each further one"`
+	MaxDelay     time.Duration `yaml:"max_delay" usage:"longest wait between failed logins"`
+	LockAfter    uint32        `yaml:"lock_after" usage:"failed logins that lock the account or address, 0 disables locking"`
+	LockDuration time.Duration `yaml:"lock_duration" usage:"how long a lock lasts"`
+	Window       time.Duration `yaml:"window" usage:"failures older than this are forgotten"`
+}
+
+// Attempts is the failed login record of one key.
+type Attempts struct {
+	Failures    uint32
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+const (
+	auditLoginFailed            = "login_failed"
+	auditLoginThrottled         = "login_throttled"
+	auditLocked                 = "locked"
+	auditUnlocked               = "unlocked"
+	auditTOTPEnabled            = "totp_enabled"
+	auditTOTPDisabled           = "totp_disabled"
+	auditTOTPFailed             = "totp_failed"
+	auditRecoveryCodeUsed       = "recovery_code_used"
+	auditPasswordChanged        = "password_changed"
+	auditPasswordResetRequested = "password_reset_requested"
+	auditPasswordReset          = "password_reset"
+	auditUserDisabled           = "user_disabled"
+	auditUserEnabled            = "user_enabled"
+	auditLicenseVerified        = "license_verified"
+	auditLicenseRejected        = "license_rejected"
+	auditDataExportRequested    = "data_export_requested"
+	auditErasureRequested       = "erasure_requested"
+	auditUserErased             = "user_erased"
+	auditServiceClientCreated   = "service_client_created"
+	auditServiceClientDeleted   = "service_client_deleted"
+	auditAPIKeyCreated          = "api_key_created"
+	auditAPIKeyRevoked          = "api_key_revoked"
+	auditOIDCClientCreated      = "oidc_client_created"
+	auditOIDCClientDeleted      = "oidc_client_deleted"
+)
+
+// AuditEvent records a failed login or a change of lock, two-factor, password
+// or account state.
+type AuditEvent struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Username string    `json:"username,omitempty"`
+	IP       string    `json:"ip,omitempty"`
+}
+
+// tooManyAttempts rejects a login before the password is checked.
+type tooManyAttempts struct {
+	retryAfter time.Duration
+	locked     bool
+}
+
+func (c *tooManyAttempts) Error() string {
+	if c.locked {
+		return fmt.Sprintf("temporarily locked, retry in %v", c.retryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed attempts, retry in %v", c.retryAfter.Round(time.Second))
+}
+
+// userAttemptsKey counts the failed logins of a user by id, so that only
+// existing users have records in the repository.
+func userAttemptsKey(userID uint64) string {
+	return "user_id:" + strconv.FormatUint(userID, 10)
+}
+
+func ipAttemptsKey(ip string) string {
+	return "ip:" + ip
+}
+
+// check returns *tooManyAttempts if the key has to wait before the next attempt.
+func (c LockoutPolicy) check(attempts Attempts, now time.Time) error {
+	wait, locked := c.wait(attempts, now)
+	if wait > 0 {
+		return &tooManyAttempts{retryAfter: wait, locked: locked}
+	}
+	return nil
+}
+
+// wait returns how long the key has to wait before the next attempt.
+func (c LockoutPolicy) wait(attempts Attempts, now time.Time) (time.Duration, bool) {
+	if now.Before(attempts.LockedUntil) {
+		return attempts.LockedUntil.Sub(now), true
+	}
+	if c.stale(attempts, now) || attempts.Failures <= c.FreeAttempts {
+		return 0, false
+	}
+	next := attempts.LastFailure.Add(c.delay(attempts.Failures))
+	if now.Before(next) {
+		return next.Sub(now), false
+	}
+	return 0, false
+}
+
+func (c LockoutPolicy) delay(failures uint32) time.Duration {
+	delay := c.BaseDelay
+	for i := c.FreeAttempts; i < failures-1 && delay < c.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.MaxDelay {
+		return c.MaxDelay
+	}
+	return delay
+}
+
+func (c LockoutPolicy) stale(attempts Attempts, now time.Time) bool {
+	return now.Sub(attempts.LastFailure) > c.Window
+}
+
+// fail records a failure at now and reports whether it locked the key. The
+// failure count starts over once the lock is set.
+func (c LockoutPolicy) fail(attempts Attempts, now time.Time) (Attempts, bool) {
+	if c.stale(attempts, now) {
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.LastFailure = now
+	if c.LockAfter > 0 && attempts.Failures >= c.LockAfter {
+		attempts.Failures = 0
+		attempts.LockedUntil = now.Add(c.LockDuration)
+		return attempts, true
+	}
+	return attempts, false
+}
+
+// maxUnknownAttempts caps the records of unknownAttempts.
+const maxUnknownAttempts = 10_000
+
+// unknownAttempts counts the failed logins of usernames that do not exist, so
+// that they are throttled like those of users and a 429 does not tell which
+// names exist. Guessed names must not grow the repository, so the records
+// live in memory, are dropped once stale and are capped at maxUnknownAttempts;
+// when every record is current, failures of further names are not counted.
+type unknownAttempts struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+}
+
+func newUnknownAttempts() *unknownAttempts {
+	return &unknownAttempts{attempts: map[string]Attempts{}}
+}
+
+func (c *unknownAttempts) get(username string) Attempts {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.attempts[username]
+}
+
+// fail records a failure of username at now and reports whether it locked
+// the name.
+func (c *unknownAttempts) fail(username string, policy LockoutPolicy, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	attempts, found := c.attempts[username]
+	if !found && len(c.attempts) >= maxUnknownAttempts {
+		for name, other := range c.attempts {
+			if policy.stale(other, now) && !now.Before(other.LockedUntil) {
+				delete(c.attempts, name)
+			}
+		}
+		if len(c.attempts) >= maxUnknownAttempts {
+			return false
+		}
+	}
+	attempts, locked := policy.fail(attempts, now)
+	c.attempts[username] = attempts
+	return locked
+}
+
+func (c *unknownAttempts) delete(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.attempts, username)
+}
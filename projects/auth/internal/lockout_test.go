@@ -0,0 +1,332 @@
+package internal
+
+import (
+	"distributed-rental/pkg/migrate"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// newLockoutTest returns a service that throttles usernames with policy and
+// never throttles addresses, and a login function for alice.
+func newLockoutTest(t *testing.T, policy LockoutPolicy) (*testClock, *UserService, func(password string) error) {
+	t.Helper()
+	clock := &testClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	userService := NewUserService(NewMemoryUserRepository(), zap.NewNop().Sugar(), bcrypt.MinCost, policy, LockoutPolicy{Window: time.Hour},
+		TOTPOptions{Issuer: "rental", ChallengeTTL: time.Minute}, PasswordResetOptions{TokenTTL: time.Hour}, nil, clock)
+	_, err := userService.createUser("alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clock, userService, func(password string) error {
+		_, err := userService.authUser("alice", password, "10.0.0.1")
+		return err
+	}
+}
+
+// expectWait fails t unless err throttles the login for wait.
+func expectWait(t *testing.T, err error, wait time.Duration, locked bool) {
+	t.Helper()
+	throttled, ok := err.(*tooManyAttempts)
+	if !ok {
+		t.Fatalf("got %v, want to wait %v", err, wait)
+	}
+	if throttled.retryAfter != wait || throttled.locked != locked {
+		t.Fatalf("got to wait %v locked %v, want %v locked %v", throttled.retryAfter, throttled.locked, wait, locked)
+	}
+}
+
+func TestLockoutProgressiveDelay(t *testing.T) {
+	clock, _, login := newLockoutTest(t, LockoutPolicy{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 4 * time.Second, Window: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		if err := login("wrong"); err != wrongPassword {
+			t.Fatalf("free attempt %d: got %v", i+1, err)
+		}
+	}
+	for _, wait := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if err := login("wrong"); err != wrongPassword {
+			t.Fatalf("before waiting %v: got %v", wait, err)
+		}
+		// Throttled attempts are rejected before the password is checked and
+		// do not count as failures.
+		expectWait(t, login("correct horse"), wait, false)
+		clock.advance(wait - time.Millisecond)
+		expectWait(t, login("wrong"), time.Millisecond, false)
+		clock.advance(time.Millisecond)
+	}
+	if err := login("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockoutLock(t *testing.T) {
+	clock, userService, login := newLockoutTest(t, LockoutPolicy{FreeAttempts: 10, LockAfter: 3, LockDuration: time.Hour, Window: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		if err := login("wrong"); err != wrongPassword {
+			t.Fatalf("attempt %d: got %v", i+1, err)
+		}
+	}
+	expectWait(t, login("correct horse"), time.Hour, true)
+	clock.advance(time.Hour - time.Second)
+	expectWait(t, login("correct horse"), time.Second, true)
+	clock.advance(time.Second)
+	if err := login("correct horse"); err != nil {
+		t.Fatalf("after the lock: got %v", err)
+	}
+
+	events, err := userService.auditLog(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]int{}
+	for _, event := range events {
+		kinds[event.Kind]++
+	}
+	if kinds[auditLoginFailed] != 3 || kinds[auditLocked] != 1 || kinds[auditLoginThrottled] != 2 {
+		t.Fatalf("got audit events %v", kinds)
+	}
+}
+
+func TestLockoutWindow(t *testing.T) {
+	clock, _, login := newLockoutTest(t, LockoutPolicy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, LockAfter: 3, LockDuration: time.Hour, Window: 10 * time.Minute})
+
+	for i := 0; i < 2; i++ {
+		if err := login("wrong"); err != wrongPassword {
+			t.Fatalf("attempt %d: got %v", i+1, err)
+		}
+		clock.advance(time.Minute)
+	}
+	// Two failures older than the window are forgotten, so two more neither
+	// lock the account nor wait for more than the base delay.
+	clock.advance(10 * time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := login("wrong"); err != wrongPassword {
+			t.Fatalf("attempt %d after the window: got %v", i+1, err)
+		}
+	}
+	expectWait(t, login("correct horse"), time.Minute, false)
+
+	// Three failures in a row lock nothing when the first two are stale.
+	clock.advance(10*time.Minute + time.Second)
+	if err := login("wrong"); err != wrongPassword {
+		t.Fatalf("attempt after the second window: got %v", err)
+	}
+	if err := login("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockoutResetOnSuccess(t *testing.T) {
+	clock, _, login := newLockoutTest(t, LockoutPolicy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, LockAfter: 3, LockDuration: time.Hour, Window: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		if err := login("wrong"); err != wrongPassword {
+			t.Fatalf("attempt %d: got %v", i+1, err)
+		}
+	}
+	clock.advance(time.Minute)
+	if err := login("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	// Without the reset the next failure would be the third and lock.
+	for i := 0; i < 2; i++ {
+		if err := login("wrong"); err != wrongPassword {
+			t.Fatalf("attempt %d after success: got %v", i+1, err)
+		}
+	}
+	expectWait(t, login("correct horse"), time.Minute, false)
+}
+
+func TestLockoutDelay(t *testing.T) {
+	policy := LockoutPolicy{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for failures, want := range map[uint32]time.Duration{3: time.Second, 4: 2 * time.Second, 5: 4 * time.Second, 6: 8 * time.Second, 7: 10 * time.Second, 1000: 10 * time.Second} {
+		if got := policy.delay(failures); got != want {
+			t.Errorf("delay(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
+
+func TestLockoutUserID(t *testing.T) {
+	_, userService, login := newLockoutTest(t, LockoutPolicy{FreeAttempts: 10, Window: time.Hour})
+	user, err := userService.repository.GetUser("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := login("wrong"); err != wrongPassword {
+		t.Fatal(err)
+	}
+	attempts, err := userService.repository.Attempts(userAttemptsKey(user.UserID))
+	if err != nil || attempts.Failures != 1 {
+		t.Fatalf("got %+v, %v, want one failure", attempts, err)
+	}
+	attempts, err = userService.repository.Attempts(legacyUserAttemptsPrefix + "alice")
+	if err != nil || attempts.Failures != 0 {
+		t.Fatalf("failures counted by username: got %+v, %v", attempts, err)
+	}
+}
+
+// TestLockoutUnknownUser checks that guessed usernames are throttled like
+// alice but never reach the repository.
+func TestLockoutUnknownUser(t *testing.T) {
+	clock, userService, login := newLockoutTest(t, LockoutPolicy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour})
+	mallory := func(password string) error {
+		_, err := userService.authUser("mallory", password, "10.0.0.1")
+		return err
+	}
+
+	for _, login := range []func(string) error{login, mallory} {
+		for i := 0; i < 2; i++ {
+			if err := login("wrong"); err != wrongPassword {
+				t.Fatalf("attempt %d: got %v", i+1, err)
+			}
+		}
+		expectWait(t, login("wrong"), time.Minute, false)
+	}
+	attempts, err := userService.repository.Attempts(legacyUserAttemptsPrefix + "mallory")
+	if err != nil || attempts.Failures != 0 {
+		t.Fatalf("unknown username stored: got %+v, %v", attempts, err)
+	}
+	if got := userService.unknown.get("mallory").Failures; got != 2 {
+		t.Fatalf("got %d failures of mallory, want 2", got)
+	}
+
+	err = userService.unlock("mallory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mallory("wrong"); err != wrongPassword {
+		t.Fatalf("after unlock: got %v", err)
+	}
+	clock.advance(time.Minute)
+	if err := login("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnknownAttemptsCap(t *testing.T) {
+	policy := LockoutPolicy{FreeAttempts: 10, LockAfter: 3, LockDuration: 2 * time.Hour, Window: time.Hour}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	unknown := newUnknownAttempts()
+	for i := 0; i < maxUnknownAttempts; i++ {
+		unknown.fail(fmt.Sprint("guess", i), policy, now)
+	}
+	// guess0 is locked and outlives the window.
+	unknown.fail("guess0", policy, now)
+	if !unknown.fail("guess0", policy, now) {
+		t.Fatal("third failure did not lock")
+	}
+
+	// While every record is current further names are not counted, but the
+	// names already there are.
+	unknown.fail("extra", policy, now)
+	if got := unknown.get("extra").Failures; got != 0 {
+		t.Fatalf("got %d failures of a name over the cap", got)
+	}
+	unknown.fail("guess1", policy, now)
+	if got := unknown.get("guess1").Failures; got != 2 {
+		t.Fatalf("got %d failures of guess1, want 2", got)
+	}
+
+	// Stale records make room, locked ones stay until the lock ends.
+	now = now.Add(time.Hour + time.Second)
+	unknown.fail("extra", policy, now)
+	if got := unknown.get("extra").Failures; got != 1 {
+		t.Fatalf("got %d failures of extra after the window, want 1", got)
+	}
+	if len(unknown.attempts) != 2 || unknown.get("guess0").LockedUntil.IsZero() {
+		t.Fatalf("got %d records, guess0 %+v", len(unknown.attempts), unknown.get("guess0"))
+	}
+}
+
+// TestLegacyUserAttemptsDropped checks that failures counted by username
+// before user ids are dropped on upgrade.
+func TestLegacyUserAttemptsDropped(t *testing.T) {
+	kept := []string{userAttemptsKey(1), ipAttemptsKey("10.0.0.1")}
+	update := func(attempts Attempts) Attempts {
+		attempts.Failures++
+		return attempts
+	}
+	check := func(t *testing.T, repository UserRepository) {
+		t.Helper()
+		attempts, err := repository.Attempts(legacyUserAttemptsPrefix + "mallory")
+		if err != nil || attempts.Failures != 0 {
+			t.Fatalf("legacy record: got %+v, %v", attempts, err)
+		}
+		for _, key := range kept {
+			attempts, err := repository.Attempts(key)
+			if err != nil || attempts.Failures != 1 {
+				t.Fatalf("%s: got %+v, %v", key, attempts, err)
+			}
+		}
+	}
+
+	t.Run("sqlite", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "auth.sqlite")
+		repository, err := NewSQLiteUserRepository(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range append(kept, legacyUserAttemptsPrefix+"mallory") {
+			_, err = repository.UpdateAttempts(key, update)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		repository.Close()
+
+		repository, err = NewSQLiteUserRepository(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer repository.Close()
+		check(t, repository)
+	})
+
+	t.Run("badger", func(t *testing.T) {
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		err = db.Update(func(tx *badger.Txn) error {
+			for _, key := range append(kept, legacyUserAttemptsPrefix+"mallory") {
+				err := tx.Set(attemptsKey(key), encodeAttempts(Attempts{Failures: 1}))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = migrate.Run(db, BadgerMigrations, migrate.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		repository, err := NewBadgerUserRepository(db, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer repository.Close()
+		check(t, repository)
+	})
+}
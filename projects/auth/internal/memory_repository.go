@@ -0,0 +1,531 @@
+package internal
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryUserRepository keeps users in process memory. It is meant for tests
+// and local runs; everything is lost on restart.
+type MemoryUserRepository struct {
+	mu          sync.Mutex
+	lastUserID  uint64
+	users       map[string]UserDBModel
+	usernames   map[uint64]string
+	attempts    map[string]Attempts
+	audit       []AuditEvent
+	totp        map[string]TOTP
+	resetTokens map[string]ResetToken
+	dataJobs    map[string]DataJob
+	clients     map[string]ServiceClient
+	apiKeys     map[string]APIKey
+	oidcClients map[string]OIDCClient
+	authCodes   map[string]AuthCode
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:       map[string]UserDBModel{},
+		usernames:   map[uint64]string{},
+		attempts:    map[string]Attempts{},
+		totp:        map[string]TOTP{},
+		resetTokens: map[string]ResetToken{},
+		dataJobs:    map[string]DataJob{},
+		clients:     map[string]ServiceClient{},
+		apiKeys:     map[string]APIKey{},
+		oidcClients: map[string]OIDCClient{},
+		authCodes:   map[string]AuthCode{},
+	}
+}
+
+func (c *MemoryUserRepository) NextUserID() (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastUserID++
+	return c.lastUserID, nil
+}
+
+func (c *MemoryUserRepository) CreateUser(user UserDBModel) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.users[user.UserName]
+	if ok {
+		return userAlreadyExists
+	}
+	c.users[user.UserName] = user
+	c.usernames[user.UserID] = user.UserName
+	return nil
+}
+
+func (c *MemoryUserRepository) GetUser(username string) (UserDBModel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	user, ok := c.users[username]
+	if !ok {
+		return UserDBModel{}, userNotFound
+	}
+	return user, nil
+}
+
+func (c *MemoryUserRepository) GetUserByID(userID uint64) (UserDBModel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	username, ok := c.usernames[userID]
+	if !ok {
+		return UserDBModel{}, userNotFound
+	}
+	return c.users[username], nil
+}
+
+func (c *MemoryUserRepository) ListUsers(from uint64, limit int, query string) ([]UserDBModel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	users := []UserDBModel{}
+	for _, user := range c.users {
+		if user.UserID >= from && matchesQuery(user, query) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (c *MemoryUserRepository) UpdateUser(username string, update func(user UserDBModel) (UserDBModel, error)) (UserDBModel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	user, ok := c.users[username]
+	if !ok {
+		return UserDBModel{}, userNotFound
+	}
+	user, err := update(user)
+	if err != nil {
+		return UserDBModel{}, err
+	}
+	if user.UserName != username {
+		_, taken := c.users[user.UserName]
+		if taken {
+			return UserDBModel{}, userAlreadyExists
+		}
+		delete(c.users, username)
+		c.usernames[user.UserID] = user.UserName
+	}
+	c.users[user.UserName] = user
+	return user, nil
+}
+
+// CreateResetToken also drops expired tokens, which are never taken.
+func (c *MemoryUserRepository) CreateResetToken(hash string, token ResetToken) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for h, t := range c.resetTokens {
+		if !now.Before(t.ExpiresAt) {
+			delete(c.resetTokens, h)
+		}
+	}
+	c.resetTokens[hash] = token
+	return nil
+}
+
+func (c *MemoryUserRepository) TakeResetToken(hash string) (ResetToken, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, ok := c.resetTokens[hash]
+	if !ok {
+		return ResetToken{}, resetTokenNotFound
+	}
+	delete(c.resetTokens, hash)
+	return token, nil
+}
+
+func (c *MemoryUserRepository) Close() error {
+	return nil
+}
+
+func (c *MemoryUserRepository) Attempts(key string) (Attempts, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.attempts[key], nil
+}
+
+func (c *MemoryUserRepository) UpdateAttempts(key string, update func(Attempts) Attempts) (Attempts, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	attempts := update(c.attempts[key])
+	c.attempts[key] = attempts
+	return attempts, nil
+}
+
+func (c *MemoryUserRepository) DeleteAttempts(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.attempts, key)
+	return nil
+}
+
+func (c *MemoryUserRepository) AppendAudit(event AuditEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.audit = append(c.audit, event)
+	return nil
+}
+
+func (c *MemoryUserRepository) AuditLog(limit int) ([]AuditEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	events := []AuditEvent{}
+	for i := len(c.audit) - 1; i >= 0 && len(events) < limit; i-- {
+		events = append(events, c.audit[i])
+	}
+	return events, nil
+}
+
+func (c *MemoryUserRepository) UserAuditLog(username string) ([]AuditEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	events := []AuditEvent{}
+	for _, event := range c.audit {
+		if event.Username == username {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (c *MemoryUserRepository) AnonymizeAudit(username string, replacement string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, event := range c.audit {
+		if event.Username == username {
+			c.audit[i].Username = replacement
+			c.audit[i].IP = ""
+		}
+	}
+	return nil
+}
+
+func (c *MemoryUserRepository) GetTOTP(username string) (TOTP, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	totp, ok := c.totp[username]
+	if !ok {
+		return TOTP{}, totpNotEnrolled
+	}
+	return totp, nil
+}
+
+func (c *MemoryUserRepository) UpdateTOTP(username string, update func(totp TOTP, found bool) (TOTP, error)) (TOTP, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	totp, found := c.totp[username]
+	totp.RecoveryCodes = append([]string{}, totp.RecoveryCodes...)
+	totp, err := update(totp, found)
+	if err != nil {
+		return TOTP{}, err
+	}
+	c.totp[username] = totp
+	return totp, nil
+}
+
+func (c *MemoryUserRepository) DeleteTOTP(username string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.totp, username)
+	return nil
+}
+
+// copyDataJob keeps the stored job apart from the one handed out, which
+// callers may change.
+func copyDataJob(job DataJob) DataJob {
+	job.Steps = append([]string{}, job.Steps...)
+	results := map[string]json.RawMessage{}
+	for step, result := range job.Results {
+		results[step] = result
+	}
+	job.Results = results
+	return job
+}
+
+func (c *MemoryUserRepository) CreateDataJob(job DataJob) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dataJobs[job.JobID] = copyDataJob(job)
+	return nil
+}
+
+func (c *MemoryUserRepository) GetDataJob(jobID string) (DataJob, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	job, ok := c.dataJobs[jobID]
+	if !ok {
+		return DataJob{}, dataJobNotFound
+	}
+	return copyDataJob(job), nil
+}
+
+func (c *MemoryUserRepository) UpdateDataJob(jobID string, update func(job DataJob) (DataJob, error)) (DataJob, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	job, ok := c.dataJobs[jobID]
+	if !ok {
+		return DataJob{}, dataJobNotFound
+	}
+	job, err := update(copyDataJob(job))
+	if err != nil {
+		return DataJob{}, err
+	}
+	c.dataJobs[jobID] = copyDataJob(job)
+	return job, nil
+}
+
+func (c *MemoryUserRepository) PendingDataJobs() ([]DataJob, error) {
+	return c.filterDataJobs(func(job DataJob) bool { return job.Status == dataJobPending })
+}
+
+func (c *MemoryUserRepository) UserDataJobs(userID uint64) ([]DataJob, error) {
+	return c.filterDataJobs(func(job DataJob) bool { return job.UserID == userID })
+}
+
+func (c *MemoryUserRepository) filterDataJobs(match func(job DataJob) bool) ([]DataJob, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	jobs := []DataJob{}
+	for _, job := range c.dataJobs {
+		if match(job) {
+			jobs = append(jobs, copyDataJob(job))
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+func (c *MemoryUserRepository) DeleteDataJob(jobID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.dataJobs, jobID)
+	return nil
+}
+
+func (c *MemoryUserRepository) CreateServiceClient(client ServiceClient) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.clients[client.ClientID]
+	if ok {
+		return serviceClientAlreadyExists
+	}
+	client.Scopes = append([]string{}, client.Scopes...)
+	c.clients[client.ClientID] = client
+	return nil
+}
+
+func (c *MemoryUserRepository) GetServiceClient(clientID string) (ServiceClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	client, ok := c.clients[clientID]
+	if !ok {
+		return ServiceClient{}, serviceClientNotFound
+	}
+	client.Scopes = append([]string{}, client.Scopes...)
+	return client, nil
+}
+
+func (c *MemoryUserRepository) ListServiceClients() ([]ServiceClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clients := []ServiceClient{}
+	for _, client := range c.clients {
+		client.Scopes = append([]string{}, client.Scopes...)
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ClientID < clients[j].ClientID })
+	return clients, nil
+}
+
+func (c *MemoryUserRepository) DeleteServiceClient(clientID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.clients[clientID]
+	if !ok {
+		return serviceClientNotFound
+	}
+	delete(c.clients, clientID)
+	return nil
+}
+
+// copyAPIKey keeps the stored key apart from the one handed out, which
+// callers may change.
+func copyAPIKey(key APIKey) APIKey {
+	key.Scopes = append([]string{}, key.Scopes...)
+	if key.LastUsedAt != nil {
+		lastUsedAt := *key.LastUsedAt
+		key.LastUsedAt = &lastUsedAt
+	}
+	return key
+}
+
+func (c *MemoryUserRepository) CreateAPIKey(key APIKey) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.apiKeys[key.KeyID] = copyAPIKey(key)
+	return nil
+}
+
+func (c *MemoryUserRepository) GetAPIKey(keyID string) (APIKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.apiKeys[keyID]
+	if !ok {
+		return APIKey{}, apiKeyNotFound
+	}
+	return copyAPIKey(key), nil
+}
+
+func (c *MemoryUserRepository) UpdateAPIKey(keyID string, update func(key APIKey) (APIKey, error)) (APIKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.apiKeys[keyID]
+	if !ok {
+		return APIKey{}, apiKeyNotFound
+	}
+	key, err := update(copyAPIKey(key))
+	if err != nil {
+		return APIKey{}, err
+	}
+	c.apiKeys[keyID] = copyAPIKey(key)
+	return key, nil
+}
+
+func (c *MemoryUserRepository) UserAPIKeys(userID uint64) ([]APIKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := []APIKey{}
+	for _, key := range c.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (c *MemoryUserRepository) DeleteAPIKey(keyID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.apiKeys[keyID]
+	if !ok {
+		return apiKeyNotFound
+	}
+	delete(c.apiKeys, keyID)
+	return nil
+}
+
+func (c *MemoryUserRepository) CreateOIDCClient(client OIDCClient) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	client.RedirectURIs = append([]string{}, client.RedirectURIs...)
+	c.oidcClients[client.ClientID] = client
+	return nil
+}
+
+func (c *MemoryUserRepository) GetOIDCClient(clientID string) (OIDCClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	client, ok := c.oidcClients[clientID]
+	if !ok {
+		return OIDCClient{}, oidcClientNotFound
+	}
+	client.RedirectURIs = append([]string{}, client.RedirectURIs...)
+	return client, nil
+}
+
+func (c *MemoryUserRepository) ListOIDCClients() ([]OIDCClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clients := []OIDCClient{}
+	for _, client := range c.oidcClients {
+		client.RedirectURIs = append([]string{}, client.RedirectURIs...)
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ClientID < clients[j].ClientID })
+	return clients, nil
+}
+
+func (c *MemoryUserRepository) DeleteOIDCClient(clientID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.oidcClients[clientID]
+	if !ok {
+		return oidcClientNotFound
+	}
+	delete(c.oidcClients, clientID)
+	return nil
+}
+
+// CreateAuthCode also drops expired codes, which are never taken.
+func (c *MemoryUserRepository) CreateAuthCode(hash string, code AuthCode) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for h, stored := range c.authCodes {
+		if !now.Before(stored.ExpiresAt) {
+			delete(c.authCodes, h)
+		}
+	}
+	code.Scopes = append([]string{}, code.Scopes...)
+	c.authCodes[hash] = code
+	return nil
+}
+
+func (c *MemoryUserRepository) TakeAuthCode(hash string) (AuthCode, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	code, ok := c.authCodes[hash]
+	if !ok {
+		return AuthCode{}, authCodeNotFound
+	}
+	delete(c.authCodes, hash)
+	return code, nil
+}
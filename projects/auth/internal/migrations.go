@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"bytes"
+	"distributed-rental/pkg/migrate"
+)
+
+var userIDSequenceKey = []byte("user_id_sequence")
+
+// BadgerMigrations upgrade the badger records in order. Append new migrations
+// with the next version; never change or reorder old ones.
+var BadgerMigrations = []migrate.Migration{
+	{
+		Version: 1,
+		Name:    "encode users as binary records",
+		Rewrite: func(key, value []byte) ([]byte, []byte, bool, error) {
+			if bytes.Equal(key, userIDSequenceKey) || len(value) == 0 || value[0] != '{' {
+				return nil, nil, false, nil
+			}
+			user, err := decodeUser(value)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			return key, encodeUser(user), true, nil
+		},
+	},
+	{
+		Version: 2,
+		Name:    "index users by user_id",
+		Derive: func(key, value []byte) ([]migrate.Record, error) {
+			if bytes.Equal(key, userIDSequenceKey) || bytes.HasPrefix(key, []byte("!")) {
+				return nil, nil
+			}
+			user, err := decodeUser(value)
+			if err != nil {
+				return nil, err
+			}
+			return []migrate.Record{{Key: userIDKey(user.UserID), Value: key}}, nil
+		},
+	},
+	{
+		Version: 3,
+		Name:    "drop failed logins counted by username",
+		Prefix:  attemptsKey(legacyUserAttemptsPrefix),
+		Rewrite: func(key, value []byte) ([]byte, []byte, bool, error) {
+			return key, nil, true, nil
+		},
+	},
+}
+
+// legacyUserAttemptsPrefix started the failed login records of usernames,
+// known or not, before they were counted by user id.
+const legacyUserAttemptsPrefix = "user:"
@@ -0,0 +1,370 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var oidcClientNotFound = errors.New("oidc client not found")
+var authCodeNotFound = errors.New("authorization code is invalid, expired or used")
+var invalidRedirectURI = errors.New("redirect_uris must be absolute URIs without a fragment, over https unless they are loopback or use a configured app scheme")
+var invalidAuthMethod = errors.New("token_endpoint_auth_method must be none, client_secret_basic or client_secret_post")
+var wrongCodeVerifier = errors.New("code_verifier does not match the code_challenge")
+
+// Scopes of the OpenID Connect flow.
+const (
+	scopeOpenID  = "openid"
+	scopeProfile = "profile"
+	scopeEmail   = "email"
+)
+
+var oidcScopes = []string{scopeOpenID, scopeProfile, scopeEmail}
+
+// Token endpoint authentication methods of OpenID Connect Core, section 9.
+const (
+	authMethodNone  = "none"
+	authMethodBasic = "client_secret_basic"
+	authMethodPost  = "client_secret_post"
+)
+
+// OIDCOptions configures the OpenID Connect provider.
+type OIDCOptions struct {
+	Issuer     string        `yaml:"issuer" usage:"public URL of the auth service, the iss of its tokens"`
+	CodeTTL    time.Duration `yaml:"code_ttl" usage:"how long an authorization code may be redeemed"`
+	TokenTTL   time.Duration `yaml:"token_ttl" usage:"how long access and ID tokens of the authorization code flow are valid"`
+	AppSchemes string        `yaml:"app_schemes" usage:"comma separated custom URI schemes of native apps allowed in redirect_uris"`
+}
+
+// OIDCClient is an application that signs users in with the authorization
+// code flow. Public clients, such as the mobile app, have no secret and rely
+// on PKCE alone; confidential clients also authenticate at the token endpoint.
+type OIDCClient struct {
+	ClientID                string    `json:"client_id"`
+	Name                    string    `json:"client_name"`
+	SecretHash              string    `json:"-"`
+	RedirectURIs            []string  `json:"redirect_uris"`
+	TokenEndpointAuthMethod string    `json:"token_endpoint_auth_method"`
+	CreatedAt               time.Time `json:"created_at"`
+}
+
+// AuthCode is what an authorization code stands for until it is redeemed.
+// Only the SHA-256 of the code is stored.
+type AuthCode struct {
+	ClientID      string
+	RedirectURI   string
+	Username      string
+	Scopes        []string
+	Nonce         string
+	CodeChallenge string
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+}
+
+// AuthRequest is a checked request of the authorization endpoint.
+type AuthRequest struct {
+	ClientID      string
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	Nonce         string
+	CodeChallenge string
+}
+
+func hashAuthCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetOIDCOptions configures the OpenID Connect provider.
+func (c *UserService) SetOIDCOptions(options OIDCOptions) {
+	c.oidc = options
+}
+
+// forbiddenSchemes run script or read local data in the browser. They are
+// never app schemes.
+var forbiddenSchemes = []string{"javascript", "data", "file", "vbscript", "blob", "about"}
+
+// ParseAppSchemes splits the comma separated app_schemes option. A scheme is
+// a letter followed by letters, digits, "+", "-" and ".", compared without
+// case (RFC 3986, section 3.1).
+func ParseAppSchemes(option string) ([]string, error) {
+	schemes := []string{}
+	for _, scheme := range strings.Split(option, ",") {
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		if scheme == "" {
+			continue
+		}
+		for i, r := range scheme {
+			letter := r >= 'a' && r <= 'z'
+			if !letter && (i == 0 || !(r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.')) {
+				return nil, fmt.Errorf("invalid app scheme %q", scheme)
+			}
+		}
+		for _, forbidden := range forbiddenSchemes {
+			if scheme == forbidden {
+				return nil, fmt.Errorf("%q can not be an app scheme", scheme)
+			}
+		}
+		schemes = append(schemes, scheme)
+	}
+	return schemes, nil
+}
+
+// validRedirectURI accepts absolute URIs without a fragment over https, over
+// plain http to loopback addresses, for native apps and local development, or
+// with one of the app schemes of the options.
+func (c *UserService) validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || strings.Contains(uri, "#") {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	// The options were checked at startup.
+	appSchemes, _ := ParseAppSchemes(c.oidc.AppSchemes)
+	for _, scheme := range appSchemes {
+		if u.Scheme == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// createOIDCClient registers a client and returns it with its secret, which
+// is empty for public clients and can not be shown again.
+func (c *UserService) createOIDCClient(name string, redirectURIs []string, authMethod string) (OIDCClient, string, error) {
+	if len(redirectURIs) == 0 {
+		return OIDCClient{}, "", invalidRedirectURI
+	}
+	for _, uri := range redirectURIs {
+		if !c.validRedirectURI(uri) {
+			return OIDCClient{}, "", invalidRedirectURI
+		}
+	}
+	if authMethod == "" {
+		authMethod = authMethodBasic
+	}
+	if authMethod != authMethodNone && authMethod != authMethodBasic && authMethod != authMethodPost {
+		return OIDCClient{}, "", invalidAuthMethod
+	}
+
+	buf := make([]byte, 8+32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return OIDCClient{}, "", err
+	}
+	client := OIDCClient{
+		ClientID:                hex.EncodeToString(buf[:8]),
+		Name:                    name,
+		RedirectURIs:            append([]string{}, redirectURIs...),
+		TokenEndpointAuthMethod: authMethod,
+		CreatedAt:               c.clock.Now(),
+	}
+	secret := ""
+	if authMethod != authMethodNone {
+		secret = hex.EncodeToString(buf[8:])
+		client.SecretHash = hashClientSecret(secret)
+	}
+	err = c.repository.CreateOIDCClient(client)
+	if err != nil {
+		return OIDCClient{}, "", err
+	}
+	c.audit(AuditEvent{Time: client.CreatedAt, Kind: auditOIDCClientCreated, Username: client.ClientID})
+	return client, secret, nil
+}
+
+func (c *UserService) listOIDCClients() ([]OIDCClient, error) {
+	return c.repository.ListOIDCClients()
+}
+
+// deleteOIDCClient stops a client from getting new codes and tokens. Tokens
+// it already has stay valid until they expire.
+func (c *UserService) deleteOIDCClient(clientID string) error {
+	err := c.repository.DeleteOIDCClient(clientID)
+	if err != nil {
+		return err
+	}
+	c.audit(AuditEvent{Time: c.clock.Now(), Kind: auditOIDCClientDeleted, Username: clientID})
+	return nil
+}
+
+// oidcRedirectClient returns the client of an authorization request if
+// redirectURI is registered for it. Until this holds errors can not be sent
+// to the client and are shown to the user instead.
+func (c *UserService) oidcRedirectClient(clientID string, redirectURI string) (OIDCClient, error) {
+	client, err := c.repository.GetOIDCClient(clientID)
+	if err != nil {
+		return OIDCClient{}, err
+	}
+	for _, uri := range client.RedirectURIs {
+		// A URI registered before its scheme was dropped from the options is
+		// not redirected to.
+		if uri == redirectURI && c.validRedirectURI(uri) {
+			return client, nil
+		}
+	}
+	return OIDCClient{}, invalidRedirectURI
+}
+
+// checkOIDCScopes splits scope and rejects scopes the provider does not know.
+func checkOIDCScopes(scope string) ([]string, error) {
+	scopes := strings.Fields(scope)
+	for _, requested := range scopes {
+		known := false
+		for _, scope := range oidcScopes {
+			if scope == requested {
+				known = true
+			}
+		}
+		if !known {
+			return nil, invalidScope(requested)
+		}
+	}
+	return scopes, nil
+}
+
+// issueAuthCode returns a code for user that the client of request can
+// redeem once within the code TTL.
+func (c *UserService) issueAuthCode(request AuthRequest, user User) (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	code := base64.RawURLEncoding.EncodeToString(buf)
+	now := c.clock.Now()
+	err = c.repository.CreateAuthCode(hashAuthCode(code), AuthCode{
+		ClientID:      request.ClientID,
+		RedirectURI:   request.RedirectURI,
+		Username:      user.UserName,
+		Scopes:        request.Scopes,
+		Nonce:         request.Nonce,
+		CodeChallenge: request.CodeChallenge,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(c.oidc.CodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// authOIDCClient checks the credentials a client presents at the token
+// endpoint. Public clients present none.
+func (c *UserService) authOIDCClient(clientID string, secret string) (OIDCClient, error) {
+	client, err := c.repository.GetOIDCClient(clientID)
+	if err == oidcClientNotFound {
+		return OIDCClient{}, wrongClientSecret
+	}
+	if err != nil {
+		return OIDCClient{}, err
+	}
+	if client.TokenEndpointAuthMethod == authMethodNone {
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashClientSecret(secret)), []byte(client.SecretHash)) != 1 {
+		return OIDCClient{}, wrongClientSecret
+	}
+	return client, nil
+}
+
+// redeemAuthCode exchanges a code for the code's grant and its user. The code
+// is gone after the first try, right or wrong, so it can not be guessed at.
+func (c *UserService) redeemAuthCode(client OIDCClient, code string, redirectURI string, codeVerifier string) (AuthCode, User, error) {
+	authCode, err := c.repository.TakeAuthCode(hashAuthCode(code))
+	if err != nil {
+		return AuthCode{}, User{}, err
+	}
+	if !c.clock.Now().Before(authCode.ExpiresAt) || authCode.ClientID != client.ClientID || authCode.RedirectURI != redirectURI {
+		return AuthCode{}, User{}, authCodeNotFound
+	}
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(authCode.CodeChallenge)) != 1 {
+		return AuthCode{}, User{}, wrongCodeVerifier
+	}
+	userDBModel, err := c.repository.GetUser(authCode.Username)
+	if err == userNotFound {
+		return AuthCode{}, User{}, authCodeNotFound
+	}
+	if err != nil {
+		return AuthCode{}, User{}, err
+	}
+	if userDBModel.Disabled {
+		return AuthCode{}, User{}, userDisabled
+	}
+	return authCode, User{
+		UserID:       userDBModel.UserID,
+		UserName:     userDBModel.UserName,
+		TokenVersion: userDBModel.TokenVersion,
+	}, nil
+}
+
+// idTokenKey derives the ES256 key of ID tokens from the JWT secret, so that
+// every instance signs with the same key and the key survives restarts.
+// Clients verify ID tokens with the public half published at the JWKS
+// endpoint; they never learn the secret.
+func idTokenKey(jwtSecret []byte) (*ecdsa.PrivateKey, error) {
+	var err error
+	for counter := uint32(0); counter < 16; counter++ {
+		mac := hmac.New(sha256.New, jwtSecret)
+		mac.Write([]byte("oidc id token"))
+		mac.Write(binary.BigEndian.AppendUint32(nil, counter))
+		// A scalar of zero or above the curve order, with a chance of about
+		// 2^-32, is rejected; the next counter gives another one.
+		var key *ecdsa.PrivateKey
+		key, err = ecdsa.ParseRawPrivateKey(elliptic.P256(), mac.Sum(nil))
+		if err == nil {
+			return key, nil
+		}
+	}
+	return nil, err
+}
+
+// jwk is a public key of the JWKS endpoint (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// publicJWK returns the public half of key with its RFC 7638 thumbprint as
+// the key id.
+func publicJWK(key *ecdsa.PrivateKey) (jwk, error) {
+	point, err := key.PublicKey.Bytes()
+	if err != nil {
+		return jwk{}, err
+	}
+	x := base64.RawURLEncoding.EncodeToString(point[1:33])
+	y := base64.RawURLEncoding.EncodeToString(point[33:])
+	thumbprint := sha256.Sum256([]byte(`{"crv":"P-256","kty":"EC","x":"` + x + `","y":"` + y + `"}`))
+	return jwk{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   x,
+		Y:   y,
+		Use: "sig",
+		Alg: "ES256",
+		Kid: base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	}, nil
+}
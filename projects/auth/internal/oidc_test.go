@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"distributed-rental/pkg/usertoken"
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+	"time"
+)
+
+func newTestUserService(clock Clock) *UserService {
+	return NewUserService(NewMemoryUserRepository(), zap.NewNop().Sugar(), bcrypt.MinCost, LockoutPolicy{Window: time.Hour}, LockoutPolicy{Window: time.Hour},
+		TOTPOptions{Issuer: "rental", ChallengeTTL: time.Minute}, PasswordResetOptions{TokenTTL: time.Hour}, nil, clock)
+}
+
+func TestParseAppSchemes(t *testing.T) {
+	schemes, err := ParseAppSchemes(" rental, com.example.App+x ,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemes) != 2 || schemes[0] != "rental" || schemes[1] != "com.example.app+x" {
+		t.Fatalf("got %q", schemes)
+	}
+	for _, option := range []string{"javascript", "rental,Data", "file", "1app", "my app", "app:"} {
+		_, err := ParseAppSchemes(option)
+		if err == nil {
+			t.Errorf("%q accepted", option)
+		}
+	}
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	userService := newTestUserService(systemClock{})
+	userService.SetOIDCOptions(OIDCOptions{AppSchemes: "rental"})
+	for uri, valid := range map[string]bool{
+		"https://app.example/callback":      true,
+		"https://app.example/cb?x=1":        true,
+		"http://127.0.0.1:8080/callback":    true,
+		"http://localhost/callback":         true,
+		"http://[::1]:8080/callback":        true,
+		"rental://oauth/callback":           true,
+		"RENTAL://oauth/callback":           true,
+		"https:///callback":                 false,
+		"https://app.example/callback#x":    false,
+		"http://app.example/callback":       false,
+		"other://oauth/callback":            false,
+		"javascript:alert(1)":               false,
+		"data:text/html,<script></script>":  false,
+		"file:///etc/passwd":                false,
+		"/callback":                         false,
+		"vbscript:msgbox(1)":                false,
+		"JavaScript://%0aalert(1)":          false,
+		"http://localhost.app.example/cb":   false,
+		"http://127.0.0.1.app.example/cb":   false,
+		"https://app.example/\ncallback":    false,
+		"rental://oauth/callback#fragment":  false,
+		"http://localhost@app.example/cb":   false,
+		"http://app.example@localhost/cb":   true,
+		"https://app.example:443/callback":  true,
+		"ftp://app.example/callback":        false,
+		"blob:https://app.example/callback": false,
+	} {
+		if got := userService.validRedirectURI(uri); got != valid {
+			t.Errorf("validRedirectURI(%q) = %v, want %v", uri, got, valid)
+		}
+	}
+}
+
+// TestOIDCAccessToken checks that an access token of an OpenID Connect client
+// is a user token everywhere but at the account endpoints, and that neither
+// kind of token can be turned into the other.
+func TestOIDCAccessToken(t *testing.T) {
+	userService := newTestUserService(systemClock{})
+	userService.SetOIDCOptions(OIDCOptions{Issuer: "https://auth.example", TokenTTL: time.Hour})
+	user, err := userService.createUser("alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtSecret := []byte("secret")
+	server := NewHttpServer("", userService, jwtSecret, nil, zap.NewNop().Sugar())
+
+	session, err := server.accessToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = server.checkAuth(session)
+	if err != nil {
+		t.Fatalf("session token at the account endpoints: %v", err)
+	}
+
+	oidcToken, err := server.oidcAccessToken(user, OIDCClient{ClientID: "app"}, []string{scopeOpenID}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	userAuth, claims, err := server.checkUserToken(oidcToken)
+	if err != nil {
+		t.Fatalf("oidc access token: %v", err)
+	}
+	if userAuth.UserID != user.UserID || !usertoken.Scoped(claims) {
+		t.Fatalf("got %+v, %v", userAuth, claims)
+	}
+	_, err = server.checkAuth(oidcToken)
+	if err == nil {
+		t.Fatal("oidc access token accepted at the account endpoints")
+	}
+
+	forged := map[string]struct {
+		claims jwt.MapClaims
+		key    []byte
+	}{
+		"scope dropped": {jwt.MapClaims{"username": "alice", "user_id": user.UserID}, usertoken.OIDCKey(jwtSecret)},
+		"scope added":   {jwt.MapClaims{"username": "alice", "user_id": user.UserID, "scope": "openid"}, jwtSecret},
+	}
+	for name, forged := range forged {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, forged.claims).SignedString(forged.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = server.checkUserToken(token)
+		if err == nil {
+			t.Errorf("%s: forged token accepted", name)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var resetTokenNotFound = errors.New("reset token is invalid or expired")
+var tokenRevoked = errors.New("token has been revoked")
+
+const resetTokenSize = 32
+
+// ResetToken lets the holder set a new password for Username until ExpiresAt.
+// Only the sha256 of the token is stored.
+type ResetToken struct {
+	Username  string
+	ExpiresAt time.Time
+}
+
+// Notifier delivers messages to users.
+type Notifier interface {
+	Notify(username string, subject string, body string) error
+}
+
+// FileNotifier appends messages to a file, or writes them to stdout. It is
+// meant for local runs; production deployments plug in mail or SMS delivery.
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileNotifier writes to path, or to stdout if path is empty or "-".
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (c *FileNotifier) Notify(username string, subject string, body string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var w io.Writer = os.Stdout
+	if c.path != "" && c.path != "-" {
+		f, err := os.OpenFile(c.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err := fmt.Fprintf(w, "To: %s\nSubject: %s\n\n%s\n\n", username, subject, body)
+	return err
+}
+
+// PasswordResetOptions configures the reset flow.
+type PasswordResetOptions struct {
+	TokenTTL   time.Duration `yaml:"token_ttl" usage:"how long a password reset token is valid"`
+	NotifyPath string        `yaml:"notify_path" usage:"file the local notifier appends reset messages to, empty for stdout"`
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// setPassword stores a new hash and bumps the token version, which revokes the
+// access tokens issued before.
+func (c *UserService) setPassword(username string, password string) (User, error) {
+	passwordHash, err := HashPassword(password, c.bcryptCost)
+	if err != nil {
+		return User{}, err
+	}
+	userDBModel, err := c.repository.UpdateUser(username, func(user UserDBModel) (UserDBModel, error) {
+		user.PasswordHash = passwordHash
+		user.TokenVersion++
+		return user, nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return User{
+		UserID:       userDBModel.UserID,
+		UserName:     userDBModel.UserName,
+		TokenVersion: userDBModel.TokenVersion,
+	}, nil
+}
+
+// changePassword replaces the password of a logged in user. The old password
+// is checked like a login, throttling included.
+func (c *UserService) changePassword(username string, oldPassword string, newPassword string, ip string) (User, error) {
+	_, err := c.authUser(username, oldPassword, ip)
+	if err != nil {
+		return User{}, err
+	}
+	user, err := c.setPassword(username, newPassword)
+	if err != nil {
+		return User{}, err
+	}
+	c.audit(AuditEvent{Time: c.clock.Now(), Kind: auditPasswordChanged, Username: username, IP: ip})
+	return user, nil
+}
+
+// requestPasswordReset sends a reset token to username. Unknown usernames are
+// ignored so that the caller can not tell which exist.
+func (c *UserService) requestPasswordReset(username string, ip string) error {
+	now := c.clock.Now()
+	_, err := c.repository.GetUser(username)
+	if err == userNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, resetTokenSize)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return err
+	}
+	token := hex.EncodeToString(buf)
+	err = c.repository.CreateResetToken(hashResetToken(token), ResetToken{
+		Username:  username,
+		ExpiresAt: now.Add(c.passwordReset.TokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+	c.audit(AuditEvent{Time: now, Kind: auditPasswordResetRequested, Username: username, IP: ip})
+
+	body := fmt.Sprintf("Use this token to set a new password within %v:\n\n%s", c.passwordReset.TokenTTL, token)
+	return c.notifier.Notify(username, "Password reset", body)
+}
+
+// resetPassword uses up token and sets the new password. The failed logins of
+// the user are forgotten along with the old password.
+func (c *UserService) resetPassword(token string, password string, ip string) error {
+	now := c.clock.Now()
+	resetToken, err := c.repository.TakeResetToken(hashResetToken(token))
+	if err != nil {
+		return err
+	}
+	if !now.Before(resetToken.ExpiresAt) {
+		return resetTokenNotFound
+	}
+
+	user, err := c.setPassword(resetToken.Username, password)
+	if err != nil {
+		return err
+	}
+	err = c.repository.DeleteAttempts(userAttemptsKey(user.UserID))
+	if err != nil {
+		return err
+	}
+	c.audit(AuditEvent{Time: now, Kind: auditPasswordReset, Username: resetToken.Username, IP: ip})
+	return nil
+}
+
+// checkTokenVersion returns tokenRevoked if the password of username changed
+// after a token of the given version was issued.
+func (c *UserService) checkTokenVersion(username string, version uint64) (User, error) {
+	userDBModel, err := c.repository.GetUser(username)
+	if err == userNotFound {
+		return User{}, tokenRevoked
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if userDBModel.TokenVersion != version || userDBModel.Disabled {
+		return User{}, tokenRevoked
+	}
+	return User{
+		UserID:       userDBModel.UserID,
+		UserName:     userDBModel.UserName,
+		TokenVersion: userDBModel.TokenVersion,
+	}, nil
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type message struct {
+	username string
+	body     string
+}
+
+type testNotifier struct {
+	messages []message
+}
+
+func (c *testNotifier) Notify(username string, subject string, body string) error {
+	c.messages = append(c.messages, message{username, body})
+	return nil
+}
+
+// token returns the reset token of the last message, which ends with it.
+func (c *testNotifier) token(t *testing.T) string {
+	t.Helper()
+	if len(c.messages) == 0 {
+		t.Fatal("no message was sent")
+	}
+	lines := strings.Split(c.messages[len(c.messages)-1].body, "\n")
+	return lines[len(lines)-1]
+}
+
+// newResetTest returns a server whose user alice has the password "correct
+// horse" and whose reset tokens are valid for an hour.
+func newResetTest(t *testing.T) (*testClock, *testNotifier, *UserService, *HttpServer) {
+	t.Helper()
+	clock := &testClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	notifier := &testNotifier{}
+	userService := NewUserService(NewMemoryUserRepository(), zap.NewNop().Sugar(), bcrypt.MinCost, LockoutPolicy{Window: time.Hour}, LockoutPolicy{Window: time.Hour},
+		TOTPOptions{Issuer: "rental", ChallengeTTL: time.Minute}, PasswordResetOptions{TokenTTL: time.Hour}, notifier, clock)
+	server := NewHttpServer("", userService, []byte("secret"), nil, zap.NewNop().Sugar())
+	_, err := userService.createUser("alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clock, notifier, userService, server
+}
+
+func TestPasswordReset(t *testing.T) {
+	_, notifier, userService, server := newResetTest(t)
+	user, err := userService.authUser("alice", "correct horse", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := server.accessToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rw := serve(server.server.Handler, http.MethodPost, "/request_password_reset", `{"username": "alice"}`)
+	if rw.Code != 200 || len(notifier.messages) != 1 || notifier.messages[0].username != "alice" {
+		t.Fatalf("got %d %s, messages %+v", rw.Code, rw.Body, notifier.messages)
+	}
+	token := notifier.token(t)
+
+	rw = serve(server.server.Handler, http.MethodPost, "/reset_password", `{"token": "`+token+`", "new_password": "battery staple"}`)
+	if rw.Code != 200 {
+		t.Fatalf("reset: got %d %s", rw.Code, rw.Body)
+	}
+	// The token is taken by the first reset.
+	rw = serve(server.server.Handler, http.MethodPost, "/reset_password", `{"token": "`+token+`", "new_password": "stolen"}`)
+	if rw.Code != 400 {
+		t.Fatalf("second reset: got %d %s, want 400", rw.Code, rw.Body)
+	}
+
+	_, err = userService.authUser("alice", "correct horse", "10.0.0.1")
+	if err != wrongPassword {
+		t.Fatalf("old password: got %v, want %v", err, wrongPassword)
+	}
+	user, err = userService.authUser("alice", "battery staple", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("new password: got %v", err)
+	}
+
+	// The reset bumped the token version, revoking the session from before.
+	_, err = userService.checkTokenVersion("alice", user.TokenVersion-1)
+	if err != tokenRevoked {
+		t.Fatalf("old token version: got %v, want %v", err, tokenRevoked)
+	}
+	_, err = server.checkAuth(session)
+	if err != tokenRevoked {
+		t.Fatalf("old session: got %v, want %v", err, tokenRevoked)
+	}
+	rw = serve(server.server.Handler, http.MethodPost, "/check_token", `{"token": "`+session+`"}`)
+	if rw.Code != http.StatusUnauthorized {
+		t.Fatalf("check old session: got %d, want 401", rw.Code)
+	}
+	session, err = server.accessToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = server.checkAuth(session)
+	if err != nil {
+		t.Fatalf("new session: got %v", err)
+	}
+}
+
+func TestPasswordResetExpired(t *testing.T) {
+	clock, notifier, userService, server := newResetTest(t)
+	err := userService.requestPasswordReset("alice", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(time.Hour)
+
+	rw := serve(server.server.Handler, http.MethodPost, "/reset_password", `{"token": "`+notifier.token(t)+`", "new_password": "battery staple"}`)
+	if rw.Code != 400 {
+		t.Fatalf("got %d %s, want 400", rw.Code, rw.Body)
+	}
+	_, err = userService.authUser("alice", "correct horse", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("the password changed: %v", err)
+	}
+
+	// A token just before its expiry works.
+	err = userService.requestPasswordReset("alice", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(time.Hour - time.Second)
+	err = userService.resetPassword(notifier.token(t), "battery staple", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasswordResetUnknownUser(t *testing.T) {
+	_, notifier, userService, server := newResetTest(t)
+	known := serve(server.server.Handler, http.MethodPost, "/request_password_reset", `{"username": "alice"}`)
+	unknown := serve(server.server.Handler, http.MethodPost, "/request_password_reset", `{"username": "mallory"}`)
+	if unknown.Code != known.Code || unknown.Body.String() != known.Body.String() {
+		t.Fatalf("got %d %q for an unknown user, %d %q for a known one", unknown.Code, unknown.Body, known.Code, known.Body)
+	}
+	if len(notifier.messages) != 1 || notifier.messages[0].username != "alice" {
+		t.Fatalf("got messages %+v", notifier.messages)
+	}
+
+	events, err := userService.auditLog(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		if event.Username == "mallory" {
+			t.Fatalf("got audit event %+v for an unknown user", event)
+		}
+	}
+
+	rw := serve(server.server.Handler, http.MethodPost, "/reset_password", `{"token": "0123", "new_password": "battery staple"}`)
+	if rw.Code != 400 {
+		t.Fatalf("made up token: got %d, want 400", rw.Code)
+	}
+}
@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"distributed-rental/pkg/eligibility"
+	"errors"
+	"math"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var userDisabled = errors.New("user is disabled")
+var noDriverLicense = errors.New("user has no driver's license on record")
+var invalidLicenseStatus = errors.New("status must be verified or rejected")
+
+// Profile is what a user tells about themselves. DriverLicense is the license
+// number, DriverLicenseCountry its ISO 3166 country code; dates are
+// YYYY-MM-DD.
+type Profile struct {
+	FullName               string `json:"full_name"`
+	Email                  string `json:"email"`
+	Phone                  string `json:"phone"`
+	DateOfBirth            string `json:"date_of_birth"`
+	DriverLicense          string `json:"driver_license"`
+	DriverLicenseCountry   string `json:"driver_license_country"`
+	DriverLicenseExpiresOn string `json:"driver_license_expires_on"`
+}
+
+// ProfilePatch changes the fields that are set; an empty string clears one.
+type ProfilePatch struct {
+	FullName               *string `json:"full_name"`
+	Email                  *string `json:"email"`
+	Phone                  *string `json:"phone"`
+	DateOfBirth            *string `json:"date_of_birth"`
+	DriverLicense          *string `json:"driver_license"`
+	DriverLicenseCountry   *string `json:"driver_license_country"`
+	DriverLicenseExpiresOn *string `json:"driver_license_expires_on"`
+}
+
+// UserProfile is a user as shown to the user and to admins.
+type UserProfile struct {
+	UserID   uint64 `json:"user_id"`
+	Username string `json:"username"`
+	Profile
+	DriverLicenseStatus string `json:"driver_license_status"`
+	Disabled            bool   `json:"disabled"`
+}
+
+// invalidProfile is returned for a patch that would store a malformed field.
+type invalidProfile struct {
+	field  string
+	reason string
+}
+
+func (c *invalidProfile) Error() string {
+	return c.field + " " + c.reason
+}
+
+func (c ProfilePatch) apply(profile Profile) Profile {
+	for _, field := range []struct {
+		value  *string
+		target *string
+	}{
+		{c.FullName, &profile.FullName},
+		{c.Email, &profile.Email},
+		{c.Phone, &profile.Phone},
+		{c.DateOfBirth, &profile.DateOfBirth},
+		{c.DriverLicense, &profile.DriverLicense},
+		{c.DriverLicenseCountry, &profile.DriverLicenseCountry},
+		{c.DriverLicenseExpiresOn, &profile.DriverLicenseExpiresOn},
+	} {
+		if field.value != nil {
+			*field.target = strings.TrimSpace(*field.value)
+		}
+	}
+	return profile
+}
+
+func (c Profile) validate(now time.Time) error {
+	if c.Email != "" {
+		address, err := mail.ParseAddress(c.Email)
+		if err != nil || address.Address != c.Email {
+			return &invalidProfile{"email", "is not a valid address"}
+		}
+	}
+	if c.Phone != "" {
+		digits := 0
+		for i, r := range c.Phone {
+			switch {
+			case unicode.IsDigit(r):
+				digits++
+			case r == '+' && i == 0, r == ' ', r == '-', r == '(', r == ')':
+			default:
+				return &invalidProfile{"phone", "may only contain digits, spaces, dashes, parentheses and a leading +"}
+			}
+		}
+		if digits < 7 || digits > 15 {
+			return &invalidProfile{"phone", "must have 7 to 15 digits"}
+		}
+	}
+	if c.DateOfBirth != "" {
+		dateOfBirth, err := time.Parse(eligibility.DateLayout, c.DateOfBirth)
+		if err != nil {
+			return &invalidProfile{"date_of_birth", "must be YYYY-MM-DD"}
+		}
+		if !dateOfBirth.Before(now) {
+			return &invalidProfile{"date_of_birth", "must be in the past"}
+		}
+	}
+	if c.DriverLicenseCountry != "" {
+		if len(c.DriverLicenseCountry) != 2 || strings.Trim(c.DriverLicenseCountry, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return &invalidProfile{"driver_license_country", "must be a two letter upper case country code"}
+		}
+	}
+	if c.DriverLicenseExpiresOn != "" {
+		_, err := time.Parse(eligibility.DateLayout, c.DriverLicenseExpiresOn)
+		if err != nil {
+			return &invalidProfile{"driver_license_expires_on", "must be YYYY-MM-DD"}
+		}
+	}
+	return nil
+}
+
+// license is the driver's license part of the profile.
+func (c Profile) license() [3]string {
+	return [3]string{c.DriverLicense, c.DriverLicenseCountry, c.DriverLicenseExpiresOn}
+}
+
+func userProfile(user UserDBModel) UserProfile {
+	status := user.LicenseStatus
+	if status == "" {
+		status = eligibility.StatusUnverified
+	}
+	return UserProfile{
+		UserID:              user.UserID,
+		Username:            user.UserName,
+		Profile:             user.Profile,
+		DriverLicenseStatus: status,
+		Disabled:            user.Disabled,
+	}
+}
+
+// matchesQuery reports whether query is a case-insensitive substring of the
+// username, full name or email. An empty query matches everyone.
+func matchesQuery(user UserDBModel, query string) bool {
+	query = strings.ToLower(query)
+	for _, field := range []string{user.UserName, user.FullName, user.Email} {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *UserService) profile(username string) (UserProfile, error) {
+	user, err := c.repository.GetUser(username)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	return userProfile(user), nil
+}
+
+// updateProfile applies patch. Changing the driver's license makes it
+// unverified again.
+func (c *UserService) updateProfile(username string, patch ProfilePatch) (UserProfile, error) {
+	now := c.clock.Now()
+	user, err := c.repository.UpdateUser(username, func(user UserDBModel) (UserDBModel, error) {
+		profile := patch.apply(user.Profile)
+		err := profile.validate(now)
+		if err != nil {
+			return UserDBModel{}, err
+		}
+		if profile.license() != user.license() {
+			user.LicenseStatus = ""
+		}
+		user.Profile = profile
+		return user, nil
+	})
+	if err != nil {
+		return UserProfile{}, err
+	}
+	return userProfile(user), nil
+}
+
+func (c *UserService) userByID(userID uint64) (UserProfile, error) {
+	user, err := c.repository.GetUserByID(userID)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	return userProfile(user), nil
+}
+
+// listUsers returns up to limit users that match query, ordered by id. With
+// after set only users with greater ids are returned.
+func (c *UserService) listUsers(after *uint64, limit int, query string) ([]UserProfile, error) {
+	var from uint64
+	if after != nil {
+		if *after == math.MaxUint64 {
+			return []UserProfile{}, nil
+		}
+		from = *after + 1
+	}
+	users, err := c.repository.ListUsers(from, limit, query)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]UserProfile, 0, len(users))
+	for _, user := range users {
+		profiles = append(profiles, userProfile(user))
+	}
+	return profiles, nil
+}
+
+// setDisabled disables or enables a user. Disabling revokes the user's tokens,
+// which stay revoked after enabling again.
+func (c *UserService) setDisabled(userID uint64, disabled bool) (UserProfile, error) {
+	user, err := c.repository.GetUserByID(userID)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	user, err = c.repository.UpdateUser(user.UserName, func(user UserDBModel) (UserDBModel, error) {
+		if disabled && !user.Disabled {
+			user.TokenVersion++
+		}
+		user.Disabled = disabled
+		return user, nil
+	})
+	if err != nil {
+		return UserProfile{}, err
+	}
+	kind := auditUserEnabled
+	if disabled {
+		kind = auditUserDisabled
+	}
+	c.audit(AuditEvent{Time: c.clock.Now(), Kind: kind, Username: user.UserName})
+	return userProfile(user), nil
+}
+
+// setLicenseStatus records whether staff accepted the driver's license of a
+// user. status is eligibility.StatusVerified or eligibility.StatusRejected.
+func (c *UserService) setLicenseStatus(userID uint64, status string) (UserProfile, error) {
+	if status != eligibility.StatusVerified && status != eligibility.StatusRejected {
+		return UserProfile{}, invalidLicenseStatus
+	}
+	user, err := c.repository.GetUserByID(userID)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	user, err = c.repository.UpdateUser(user.UserName, func(user UserDBModel) (UserDBModel, error) {
+		if user.DriverLicense == "" {
+			return UserDBModel{}, noDriverLicense
+		}
+		user.LicenseStatus = status
+		return user, nil
+	})
+	if err != nil {
+		return UserProfile{}, err
+	}
+	kind := auditLicenseVerified
+	if status == eligibility.StatusRejected {
+		kind = auditLicenseRejected
+	}
+	c.audit(AuditEvent{Time: c.clock.Now(), Kind: kind, Username: user.UserName})
+	return userProfile(user), nil
+}
@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"distributed-rental/pkg/eligibility"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newProfileTest returns a server with the admin token "admin" and the users
+// alice, bob and carol, and the access token of alice.
+func newProfileTest(t *testing.T) (*UserService, *HttpServer, string) {
+	t.Helper()
+	clock := &testClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	userService := newTestUserService(clock)
+	server := NewHttpServer("", userService, []byte("secret"), []byte("admin"), zap.NewNop().Sugar())
+	var token string
+	for _, username := range []string{"alice", "bob", "carol"} {
+		user, err := userService.createUser(username, "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if username == "alice" {
+			token, err = server.accessToken(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return userService, server, token
+}
+
+func call(server *HttpServer, method string, target string, headers map[string]string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+	rw := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rw, r)
+	return rw
+}
+
+func decodeProfile(t *testing.T, rw *httptest.ResponseRecorder) UserProfile {
+	t.Helper()
+	var profile UserProfile
+	err := json.Unmarshal(rw.Body.Bytes(), &profile)
+	if rw.Code != 200 || err != nil {
+		t.Fatalf("got %d %s", rw.Code, rw.Body)
+	}
+	return profile
+}
+
+func TestProfileValidate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	valid := Profile{
+		FullName:               "Alice Liddell",
+		Email:                  "alice@example.com",
+		Phone:                  "+7 (999) 123-45-67",
+		DateOfBirth:            "1990-05-04",
+		DriverLicense:          "77 12 345678",
+		DriverLicenseCountry:   "RU",
+		DriverLicenseExpiresOn: "2030-01-01",
+	}
+	if err := valid.validate(now); err != nil {
+		t.Fatal(err)
+	}
+	if err := (Profile{}).validate(now); err != nil {
+		t.Fatalf("empty profile: %v", err)
+	}
+	for field, invalid := range map[string]func(profile *Profile){
+		"email":                     func(profile *Profile) { profile.Email = "Alice <alice@example.com>" },
+		"phone":                     func(profile *Profile) { profile.Phone = "call me" },
+		"date_of_birth":             func(profile *Profile) { profile.DateOfBirth = "04.05.1990" },
+		"driver_license_country":    func(profile *Profile) { profile.DriverLicenseCountry = "ru" },
+		"driver_license_expires_on": func(profile *Profile) { profile.DriverLicenseExpiresOn = "2030-13-01" },
+	} {
+		profile := valid
+		invalid(&profile)
+		err := profile.validate(now)
+		if err, ok := err.(*invalidProfile); !ok || err.field != field {
+			t.Errorf("%s: got %v", field, err)
+		}
+	}
+	for _, phone := range []string{"123456", "1234567890123456", "12+3456789"} {
+		profile := valid
+		profile.Phone = phone
+		if profile.validate(now) == nil {
+			t.Errorf("phone %q accepted", phone)
+		}
+	}
+	profile := valid
+	profile.DateOfBirth = "2026-01-02"
+	if profile.validate(now) == nil {
+		t.Error("date of birth in the future accepted")
+	}
+}
+
+func TestMe(t *testing.T) {
+	userService, server, token := newProfileTest(t)
+	auth := map[string]string{"X-Auth": token}
+
+	profile := decodeProfile(t, call(server, http.MethodGet, "/me", auth, ``))
+	if profile.Username != "alice" || profile.Profile != (Profile{}) || profile.DriverLicenseStatus != eligibility.StatusUnverified {
+		t.Fatalf("got %+v", profile)
+	}
+
+	profile = decodeProfile(t, call(server, http.MethodPatch, "/me", auth,
+		`{"full_name": " Alice Liddell ", "email": "alice@example.com", "driver_license": "77 12 345678", "driver_license_country": "RU", "driver_license_expires_on": "2030-01-01"}`))
+	if profile.FullName != "Alice Liddell" || profile.Email != "alice@example.com" || profile.DriverLicense != "77 12 345678" {
+		t.Fatalf("got %+v", profile)
+	}
+	_, err := userService.setLicenseStatus(profile.UserID, eligibility.StatusVerified)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fields that are not in the patch stay, an empty string clears one, and
+	// the license stays verified while it does not change.
+	profile = decodeProfile(t, call(server, http.MethodPatch, "/me", auth, `{"email": "", "phone": "+7 999 123 45 67"}`))
+	if profile.FullName != "Alice Liddell" || profile.Email != "" || profile.Phone != "+7 999 123 45 67" || profile.DriverLicenseStatus != eligibility.StatusVerified {
+		t.Fatalf("got %+v", profile)
+	}
+	profile = decodeProfile(t, call(server, http.MethodPatch, "/me", auth, `{"driver_license_expires_on": "2035-01-01"}`))
+	if profile.DriverLicenseStatus != eligibility.StatusUnverified {
+		t.Fatalf("a changed license stayed %s", profile.DriverLicenseStatus)
+	}
+
+	rw := call(server, http.MethodPatch, "/me", auth, `{"email": "alice", "full_name": "Mallory"}`)
+	if rw.Code != 400 || !strings.Contains(rw.Body.String(), "email") {
+		t.Fatalf("invalid email: got %d %s", rw.Code, rw.Body)
+	}
+	if profile := decodeProfile(t, call(server, http.MethodGet, "/me", auth, ``)); profile.FullName != "Alice Liddell" {
+		t.Fatalf("a rejected patch changed the profile: %+v", profile)
+	}
+	if rw := call(server, http.MethodPut, "/me", auth, `{}`); rw.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("PUT: got %d", rw.Code)
+	}
+	if rw := call(server, http.MethodGet, "/me", nil, ``); rw.Code != http.StatusUnauthorized {
+		t.Fatalf("no token: got %d", rw.Code)
+	}
+}
+
+func TestAdminUsers(t *testing.T) {
+	userService, server, token := newProfileTest(t)
+	admin := map[string]string{"X-Admin-Token": "admin"}
+	email := "Bob@Example.com"
+	_, err := userService.updateProfile("bob", ProfilePatch{Email: &email})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(body string) []string {
+		t.Helper()
+		rw := call(server, http.MethodPost, "/admin/list_users", admin, body)
+		var response listUsersResponse
+		err := json.Unmarshal(rw.Body.Bytes(), &response)
+		if rw.Code != 200 || err != nil {
+			t.Fatalf("list %s: got %d %s", body, rw.Code, rw.Body)
+		}
+		usernames := []string{}
+		for _, user := range response.Users {
+			usernames = append(usernames, user.Username)
+		}
+		return usernames
+	}
+	alice, err := userService.profile("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for body, want := range map[string]string{
+		`{}`:                   "alice bob carol",
+		`{"limit": 2}`:         "alice bob",
+		`{"query": "EXAMPLE"}`: "bob",
+		`{"query": "o"}`:       "bob carol",
+		fmt.Sprintf(`{"after": %d, "limit": 1}`, alice.UserID): "bob",
+		`{"after": 18446744073709551615}`:                      "",
+	} {
+		if got := strings.Join(list(body), " "); got != want {
+			t.Errorf("list %s: got %q, want %q", body, got, want)
+		}
+	}
+
+	profile := decodeProfile(t, call(server, http.MethodPost, "/admin/get_user", admin, fmt.Sprintf(`{"user_id": %d}`, alice.UserID)))
+	if profile.Username != "alice" {
+		t.Fatalf("get user: got %+v", profile)
+	}
+	if rw := call(server, http.MethodPost, "/admin/get_user", admin, `{"user_id": 1000}`); rw.Code != http.StatusNotFound {
+		t.Fatalf("unknown user: got %d", rw.Code)
+	}
+	if rw := call(server, http.MethodPost, "/admin/get_user", admin, `{}`); rw.Code != 400 {
+		t.Fatalf("no user_id: got %d", rw.Code)
+	}
+	for _, route := range []string{"/admin/list_users", "/admin/get_user", "/admin/disable_user"} {
+		if rw := call(server, http.MethodPost, route, map[string]string{"X-Admin-Token": "guess", "X-Auth": token}, fmt.Sprintf(`{"user_id": %d}`, alice.UserID)); rw.Code != http.StatusUnauthorized {
+			t.Errorf("%s with a wrong admin token: got %d", route, rw.Code)
+		}
+	}
+
+	// Disabling revokes the tokens of the user and stops logins, enabling
+	// lets the user log in again but keeps the old tokens revoked.
+	profile = decodeProfile(t, call(server, http.MethodPost, "/admin/disable_user", admin, fmt.Sprintf(`{"user_id": %d}`, alice.UserID)))
+	if !profile.Disabled {
+		t.Fatalf("disable: got %+v", profile)
+	}
+	if _, err := server.checkAuth(token); err != tokenRevoked {
+		t.Fatalf("token of a disabled user: got %v, want %v", err, tokenRevoked)
+	}
+	if _, err := userService.authUser("alice", "correct horse", "10.0.0.1"); err != userDisabled {
+		t.Fatalf("login of a disabled user: got %v, want %v", err, userDisabled)
+	}
+	profile = decodeProfile(t, call(server, http.MethodPost, "/admin/enable_user", admin, fmt.Sprintf(`{"user_id": %d}`, alice.UserID)))
+	if profile.Disabled {
+		t.Fatalf("enable: got %+v", profile)
+	}
+	if _, err := server.checkAuth(token); err != tokenRevoked {
+		t.Fatalf("old token after enable: got %v, want %v", err, tokenRevoked)
+	}
+	if _, err := userService.authUser("alice", "correct horse", "10.0.0.1"); err != nil {
+		t.Fatalf("login after enable: got %v", err)
+	}
+}
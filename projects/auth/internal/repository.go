@@ -0,0 +1,100 @@
+package internal
+
+// UserRepository is the storage behind UserService.
+type UserRepository interface {
+	// NextUserID returns a user id that has not been issued before.
+	NextUserID() (uint64, error)
+	// CreateUser stores user, or returns userAlreadyExists if the username is taken.
+	CreateUser(user UserDBModel) error
+	// GetUser returns userNotFound for unknown usernames.
+	GetUser(username string) (UserDBModel, error)
+	// GetUserByID returns userNotFound for unknown ids.
+	GetUserByID(userID uint64) (UserDBModel, error)
+	// ListUsers returns up to limit users with ids from from on, ordered by id,
+	// whose username, full name or email contains query (ignoring case).
+	ListUsers(from uint64, limit int, query string) ([]UserDBModel, error)
+	// UpdateUser replaces a user with what update returns, atomically. It
+	// returns userNotFound for unknown usernames and errors from update
+	// without writing. update may rename the user, to a username that is not
+	// taken or userAlreadyExists is returned.
+	UpdateUser(username string, update func(user UserDBModel) (UserDBModel, error)) (UserDBModel, error)
+	// CreateResetToken stores a password reset token under the hash of the token.
+	CreateResetToken(hash string, token ResetToken) error
+	// TakeResetToken deletes and returns the token stored under hash, so that
+	// it works once, or returns resetTokenNotFound.
+	TakeResetToken(hash string) (ResetToken, error)
+	// Attempts returns the failed login record of key, zero if there is none.
+	Attempts(key string) (Attempts, error)
+	// UpdateAttempts replaces the record of key with what update returns,
+	// atomically with respect to other updates of the same key.
+	UpdateAttempts(key string, update func(Attempts) Attempts) (Attempts, error)
+	// DeleteAttempts forgets the failed logins of key.
+	DeleteAttempts(key string) error
+	// AppendAudit adds event to the audit log.
+	AppendAudit(event AuditEvent) error
+	// AuditLog returns up to limit events, newest first.
+	AuditLog(limit int) ([]AuditEvent, error)
+	// UserAuditLog returns the events of username, oldest first.
+	UserAuditLog(username string) ([]AuditEvent, error)
+	// AnonymizeAudit renames username to replacement in the audit log and
+	// drops the client addresses of those events.
+	AnonymizeAudit(username string, replacement string) error
+	// GetTOTP returns totpNotEnrolled if username has no second factor.
+	GetTOTP(username string) (TOTP, error)
+	// UpdateTOTP replaces the second factor of username with what update
+	// returns, atomically. found is false if there is none yet. An error from
+	// update is returned and nothing is written.
+	UpdateTOTP(username string, update func(totp TOTP, found bool) (TOTP, error)) (TOTP, error)
+	// DeleteTOTP removes the second factor of username.
+	DeleteTOTP(username string) error
+	// CreateDataJob stores a new data export or erasure job.
+	CreateDataJob(job DataJob) error
+	// GetDataJob returns dataJobNotFound for unknown ids.
+	GetDataJob(jobID string) (DataJob, error)
+	// UpdateDataJob replaces a job with what update returns, atomically. It
+	// returns dataJobNotFound for unknown ids and errors from update without
+	// writing.
+	UpdateDataJob(jobID string, update func(job DataJob) (DataJob, error)) (DataJob, error)
+	// PendingDataJobs returns the jobs that are neither done nor failed,
+	// oldest first.
+	PendingDataJobs() ([]DataJob, error)
+	// UserDataJobs returns the jobs of a user, oldest first.
+	UserDataJobs(userID uint64) ([]DataJob, error)
+	// DeleteDataJob forgets a job.
+	DeleteDataJob(jobID string) error
+	// CreateServiceClient stores client, or returns serviceClientAlreadyExists
+	// if the client_id is taken.
+	CreateServiceClient(client ServiceClient) error
+	// GetServiceClient returns serviceClientNotFound for unknown client ids.
+	GetServiceClient(clientID string) (ServiceClient, error)
+	// ListServiceClients returns all clients ordered by client_id.
+	ListServiceClients() ([]ServiceClient, error)
+	// DeleteServiceClient returns serviceClientNotFound for unknown client ids.
+	DeleteServiceClient(clientID string) error
+	// CreateAPIKey stores a new API key.
+	CreateAPIKey(key APIKey) error
+	// GetAPIKey returns apiKeyNotFound for unknown key ids.
+	GetAPIKey(keyID string) (APIKey, error)
+	// UpdateAPIKey replaces a key with what update returns, atomically. It
+	// returns apiKeyNotFound for unknown key ids and errors from update
+	// without writing.
+	UpdateAPIKey(keyID string, update func(key APIKey) (APIKey, error)) (APIKey, error)
+	// UserAPIKeys returns the keys of a user, oldest first.
+	UserAPIKeys(userID uint64) ([]APIKey, error)
+	// DeleteAPIKey returns apiKeyNotFound for unknown key ids.
+	DeleteAPIKey(keyID string) error
+	// CreateOIDCClient stores a new OpenID Connect client.
+	CreateOIDCClient(client OIDCClient) error
+	// GetOIDCClient returns oidcClientNotFound for unknown client ids.
+	GetOIDCClient(clientID string) (OIDCClient, error)
+	// ListOIDCClients returns all clients ordered by client_id.
+	ListOIDCClients() ([]OIDCClient, error)
+	// DeleteOIDCClient returns oidcClientNotFound for unknown client ids.
+	DeleteOIDCClient(clientID string) error
+	// CreateAuthCode stores an authorization code under the hash of the code.
+	CreateAuthCode(hash string, code AuthCode) error
+	// TakeAuthCode deletes and returns the code stored under hash, so that it
+	// works once, or returns authCodeNotFound.
+	TakeAuthCode(hash string) (AuthCode, error)
+	Close() error
+}
@@ -0,0 +1,470 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dgraph-io/badger/v3"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// repositories opens an empty repository of every backend.
+var repositories = map[string]func(t *testing.T) UserRepository{
+	"memory": func(t *testing.T) UserRepository {
+		return NewMemoryUserRepository()
+	},
+	"sqlite": func(t *testing.T) UserRepository {
+		repository, err := NewSQLiteUserRepository(filepath.Join(t.TempDir(), "auth.sqlite"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { repository.Close() })
+		return repository
+	},
+	"badger": func(t *testing.T) UserRepository {
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		repository, err := NewBadgerUserRepository(db, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			repository.Close()
+			db.Close()
+		})
+		return repository
+	},
+}
+
+// forEachRepository runs test against every backend, so that they all keep
+// the UserRepository contract.
+func forEachRepository(t *testing.T, test func(t *testing.T, repository UserRepository)) {
+	for name, open := range repositories {
+		t.Run(name, func(t *testing.T) {
+			test(t, open(t))
+		})
+	}
+}
+
+// at is a time every backend stores exactly, in the future so that entries
+// with a TTL do not expire during the test.
+func at(hours int) time.Time {
+	return time.Unix(time.Now().Add(time.Duration(hours)*time.Hour).Unix(), 0)
+}
+
+var errUpdate = errors.New("update refused")
+
+func expect(t *testing.T, what string, got interface{}, want interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s: got %+v, want %+v", what, got, want)
+	}
+}
+
+func expectErr(t *testing.T, what string, err error, want error) {
+	t.Helper()
+	if err != want {
+		t.Fatalf("%s: got error %v, want %v", what, err, want)
+	}
+}
+
+func TestRepositoryUsers(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository UserRepository) {
+		first, err := repository.NextUserID()
+		expectErr(t, "next user id", err, nil)
+		second, err := repository.NextUserID()
+		expectErr(t, "next user id", err, nil)
+		if second <= first {
+			t.Fatalf("user ids %d then %d", first, second)
+		}
+
+		alice := UserDBModel{UserID: 1, UserName: "alice", PasswordHash: "hash", TokenVersion: 1, Profile: Profile{FullName: "Alice Liddell", Email: "alice@example.com", DriverLicense: "77 01"}, LicenseStatus: "verified"}
+		bob := UserDBModel{UserID: 2, UserName: "bob", PasswordHash: "hash", Profile: Profile{FullName: "Robert", Email: "bob@example.org"}, Disabled: true}
+		carol := UserDBModel{UserID: 3, UserName: "carol", PasswordHash: "hash", Profile: Profile{Email: "carol@example.com"}}
+		for _, user := range []UserDBModel{alice, bob, carol} {
+			expectErr(t, "create "+user.UserName, repository.CreateUser(user), nil)
+		}
+		expectErr(t, "create a taken username", repository.CreateUser(UserDBModel{UserID: 4, UserName: "alice"}), userAlreadyExists)
+
+		got, err := repository.GetUser("bob")
+		expectErr(t, "get bob", err, nil)
+		expect(t, "get bob", got, bob)
+		got, err = repository.GetUserByID(1)
+		expectErr(t, "get user 1", err, nil)
+		expect(t, "get user 1", got, alice)
+		_, err = repository.GetUser("dave")
+		expectErr(t, "get unknown username", err, userNotFound)
+		_, err = repository.GetUserByID(4)
+		expectErr(t, "get unknown id", err, userNotFound)
+
+		for _, test := range []struct {
+			from  uint64
+			limit int
+			query string
+			want  []UserDBModel
+		}{
+			{0, 10, "", []UserDBModel{alice, bob, carol}},
+			{2, 10, "", []UserDBModel{bob, carol}},
+			{0, 2, "", []UserDBModel{alice, bob}},
+			{0, 10, "EXAMPLE.COM", []UserDBModel{alice, carol}},
+			{0, 10, "liddell", []UserDBModel{alice}},
+			{0, 10, "rob", []UserDBModel{bob}},
+			{0, 10, "nobody", []UserDBModel{}},
+		} {
+			users, err := repository.ListUsers(test.from, test.limit, test.query)
+			expectErr(t, "list users", err, nil)
+			expect(t, "list users", users, test.want)
+		}
+
+		// Token versions only go up through UpdateUser.
+		bumped, err := repository.UpdateUser("alice", func(user UserDBModel) (UserDBModel, error) {
+			user.TokenVersion++
+			return user, nil
+		})
+		expectErr(t, "bump token version", err, nil)
+		got, _ = repository.GetUser("alice")
+		if bumped.TokenVersion != 2 || got.TokenVersion != 2 {
+			t.Fatalf("token version: returned %d, stored %d, want 2", bumped.TokenVersion, got.TokenVersion)
+		}
+
+		_, err = repository.UpdateUser("alice", func(user UserDBModel) (UserDBModel, error) {
+			user.Disabled = true
+			return user, errUpdate
+		})
+		expectErr(t, "refused update", err, errUpdate)
+		got, _ = repository.GetUser("alice")
+		if got.Disabled {
+			t.Fatal("a refused update was written")
+		}
+		_, err = repository.UpdateUser("dave", func(user UserDBModel) (UserDBModel, error) { return user, nil })
+		expectErr(t, "update unknown username", err, userNotFound)
+
+		_, err = repository.UpdateUser("alice", func(user UserDBModel) (UserDBModel, error) {
+			user.UserName = "bob"
+			return user, nil
+		})
+		expectErr(t, "rename to a taken username", err, userAlreadyExists)
+		renamed, err := repository.UpdateUser("alice", func(user UserDBModel) (UserDBModel, error) {
+			user.UserName = "alicia"
+			return user, nil
+		})
+		expectErr(t, "rename", err, nil)
+		_, err = repository.GetUser("alice")
+		expectErr(t, "get the old username", err, userNotFound)
+		got, err = repository.GetUserByID(1)
+		expectErr(t, "get the renamed user by id", err, nil)
+		expect(t, "renamed user", got, renamed)
+		expectErr(t, "reuse the old username", repository.CreateUser(UserDBModel{UserID: 4, UserName: "alice"}), nil)
+	})
+}
+
+func TestRepositoryResetTokens(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository UserRepository) {
+		token := ResetToken{Username: "alice", ExpiresAt: at(1)}
+		expectErr(t, "create", repository.CreateResetToken("hash1", token), nil)
+		expectErr(t, "create", repository.CreateResetToken("hash2", ResetToken{Username: "bob", ExpiresAt: at(1)}), nil)
+
+		got, err := repository.TakeResetToken("hash1")
+		expectErr(t, "take", err, nil)
+		expect(t, "take", got, token)
+		_, err = repository.TakeResetToken("hash1")
+		expectErr(t, "take twice", err, resetTokenNotFound)
+		_, err = repository.TakeResetToken("unknown")
+		expectErr(t, "take unknown", err, resetTokenNotFound)
+		got, err = repository.TakeResetToken("hash2")
+		expectErr(t, "take the other token", err, nil)
+		if got.Username != "bob" {
+			t.Fatalf("took %+v", got)
+		}
+	})
+}
+
+func TestRepositoryAttempts(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository UserRepository) {
+		got, err := repository.Attempts("user:alice")
+		expectErr(t, "attempts of an unknown key", err, nil)
+		expect(t, "attempts of an unknown key", got, Attempts{})
+
+		fail := func(attempts Attempts) Attempts {
+			attempts.Failures++
+			attempts.LastFailure = at(int(attempts.Failures))
+			return attempts
+		}
+		for i := 0; i < 2; i++ {
+			_, err = repository.UpdateAttempts("user:alice", fail)
+			expectErr(t, "update", err, nil)
+		}
+		locked, err := repository.UpdateAttempts("user:alice", func(attempts Attempts) Attempts {
+			attempts.LockedUntil = at(5)
+			return attempts
+		})
+		expectErr(t, "lock", err, nil)
+		want := Attempts{Failures: 2, LastFailure: at(2), LockedUntil: at(5)}
+		expect(t, "update", locked, want)
+		got, err = repository.Attempts("user:alice")
+		expectErr(t, "attempts", err, nil)
+		expect(t, "attempts", got, want)
+
+		_, err = repository.UpdateAttempts("ip:10.0.0.1", fail)
+		expectErr(t, "update another key", err, nil)
+		expectErr(t, "delete", repository.DeleteAttempts("user:alice"), nil)
+		expectErr(t, "delete an unknown key", repository.DeleteAttempts("user:bob"), nil)
+		got, _ = repository.Attempts("user:alice")
+		expect(t, "deleted attempts", got, Attempts{})
+		got, _ = repository.Attempts("ip:10.0.0.1")
+		expect(t, "attempts of another key", got, Attempts{Failures: 1, LastFailure: at(1)})
+	})
+}
+
+func TestRepositoryAudit(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository UserRepository) {
+		events := []AuditEvent{
+			{Time: at(1), Kind: auditLoginFailed, Username: "alice", IP: "10.0.0.1"},
+			{Time: at(2), Kind: auditLocked, IP: "10.0.0.1"},
+			{Time: at(3), Kind: auditLoginFailed, Username: "bob", IP: "10.0.0.2"},
+			{Time: at(4), Kind: auditPasswordChanged, Username: "alice"},
+		}
+		for _, event := range events {
+			expectErr(t, "append", repository.AppendAudit(event), nil)
+		}
+
+		got, err := repository.AuditLog(3)
+		expectErr(t, "audit log", err, nil)
+		expect(t, "audit log", got, []AuditEvent{events[3], events[2], events[1]})
+		got, err = repository.UserAuditLog("alice")
+		expectErr(t, "alice's audit log", err, nil)
+		expect(t, "alice's audit log", got, []AuditEvent{events[0], events[3]})
+
+		expectErr(t, "anonymize", repository.AnonymizeAudit("alice", "erased-1"), nil)
+		got, _ = repository.UserAuditLog("alice")
+		expect(t, "alice's audit log after anonymizing", got, []AuditEvent{})
+		got, _ = repository.UserAuditLog("erased-1")
+		expect(t, "anonymized audit log", got, []AuditEvent{
+			{Time: at(1), Kind: auditLoginFailed, Username: "erased-1"},
+			{Time: at(4), Kind: auditPasswordChanged, Username: "erased-1"},
+		})
+		got, _ = repository.AuditLog(10)
+		expect(t, "other events", got[1], events[2])
+	})
+}
+
+func TestRepositoryTOTP(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository UserRepository) {
+		_, err := repository.GetTOTP("alice")
+		expectErr(t, "get before enrolling", err, totpNotEnrolled)
+
+		enrolled := TOTP{Secret: []byte("0123456789"), RecoveryCodes: []string{"a", "b"}}
+		got, err := repository.UpdateTOTP("alice", func(totp TOTP, found bool) (TOTP, error) {
+			if found {
+				t.Error("found a second factor before enrolling")
+			}
+			return enrolled, nil
+		})
+		expectErr(t, "enroll", err, nil)
+		expect(t, "enroll", got, enrolled)
+
+		_, err = repository.UpdateTOTP("alice", func(totp TOTP, found bool) (TOTP, error) {
+			totp.Confirmed = true
+			return totp, errUpdate
+		})
+		expectErr(t, "refused update", err, errUpdate)
+		got, err = repository.GetTOTP("alice")
+		expectErr(t, "get", err, nil)
+		expect(t, "get after a refused update", got, enrolled)
+
+		want := TOTP{Secret: []byte("0123456789"), Confirmed: true, LastStep: 1234, RecoveryCodes: []string{"b"}}
+		_, err = repository.UpdateTOTP("alice", func(totp TOTP, found bool) (TOTP, error) {
+			if !found {
+				t.Error("did not find the second factor")
+			}
+			totp.Confirmed = true
+			totp.LastStep = 1234
+			totp.RecoveryCodes = totp.RecoveryCodes[1:]
+			return totp, nil
+		})
+		expectErr(t, "confirm", err, nil)
+		got, _ = repository.GetTOTP("alice")
+		expect(t, "get", got, want)
+		_, err = repository.GetTOTP("bob")
+		expectErr(t, "get another user's", err, totpNotEnrolled)
+
+		expectErr(t, "delete", repository.DeleteTOTP("alice"), nil)
+		_, err = repository.GetTOTP("alice")
+		expectErr(t, "get after deleting", err, totpNotEnrolled)
+	})
+}
+
+func TestRepositoryDataJobs(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository UserRepository) {
+		job := func(jobID string, userID uint64, status string, created int) DataJob {
+			return DataJob{
+				JobID:     jobID,
+				Kind:      dataJobExport,
+				UserID:    userID,
+				Status:    status,
+				Steps:     []string{"auth", "booking"},
+				Results:   map[string]json.RawMessage{"auth": json.RawMessage(`{"n":1}`)},
+				NextRunAt: at(created),
+				CreatedAt: at(created),
+				UpdatedAt: at(created),
+			}
+		}
+		// Created out of order: jobs are listed by creation time.
+		jobs := []DataJob{job("c", 1, dataJobPending, 3), job("a", 1, dataJobDone, 1), job("b", 2, dataJobPending, 2)}
+		for _, j := range jobs {
+			expectErr(t, "create", repository.CreateDataJob(j), nil)
+		}
+
+		got, err := repository.GetDataJob("a")
+		expectErr(t, "get", err, nil)
+		expect(t, "get", got, jobs[1])
+		_, err = repository.GetDataJob("d")
+		expectErr(t, "get unknown", err, dataJobNotFound)
+
+		pending, err := repository.PendingDataJobs()
+		expectErr(t, "pending", err, nil)
+		expect(t, "pending", pending, []DataJob{jobs[2], jobs[0]})
+		mine, err := repository.UserDataJobs(1)
+		expectErr(t, "user's jobs", err, nil)
+		expect(t, "user's jobs", mine, []DataJob{jobs[1], jobs[0]})
+
+		updated, err := repository.UpdateDataJob("c", func(job DataJob) (DataJob, error) {
+			job.Status = dataJobFailed
+			job.Attempts = 3
+			job.Error = "booking is down"
+			job.Results["booking"] = json.RawMessage(`[]`)
+			job.UpdatedAt = at(4)
+			return job, nil
+		})
+		expectErr(t, "update", err, nil)
+		got, _ = repository.GetDataJob("c")
+		expect(t, "updated job", got, updated)
+		if got.Status != dataJobFailed || len(got.Results) != 2 {
+			t.Fatalf("updated job %+v", got)
+		}
+		_, err = repository.UpdateDataJob("c", func(job DataJob) (DataJob, error) {
+			job.Status = dataJobPending
+			return job, errUpdate
+		})
+		expectErr(t, "refused update", err, errUpdate)
+		got, _ = repository.GetDataJob("c")
+		expect(t, "job after a refused update", got, updated)
+		_, err = repository.UpdateDataJob("d", func(job DataJob) (DataJob, error) { return job, nil })
+		expectErr(t, "update unknown", err, dataJobNotFound)
+		pending, _ = repository.PendingDataJobs()
+		expect(t, "pending", pending, []DataJob{jobs[2]})
+
+		expectErr(t, "delete", repository.DeleteDataJob("a"), nil)
+		_, err = repository.GetDataJob("a")
+		expectErr(t, "get deleted", err, dataJobNotFound)
+		mine, _ = repository.UserDataJobs(1)
+		expect(t, "user's jobs", mine, []DataJob{updated})
+	})
+}
+
+func TestRepositoryServiceClients(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository UserRepository) {
+		fleet := ServiceClient{ClientID: "fleet", SecretHash: "hash", Scopes: []string{"booking:read", "lease:read"}, CreatedAt: at(1)}
+		booking := ServiceClient{ClientID: "booking", SecretHash: "hash", Scopes: []string{"fleet:read"}, CreatedAt: at(2)}
+		expectErr(t, "create", repository.CreateServiceClient(fleet), nil)
+		expectErr(t, "create", repository.CreateServiceClient(booking), nil)
+		expectErr(t, "create a taken client_id", repository.CreateServiceClient(ServiceClient{ClientID: "fleet", Scopes: []string{"x"}}), serviceClientAlreadyExists)
+
+		got, err := repository.GetServiceClient("fleet")
+		expectErr(t, "get", err, nil)
+		expect(t, "get", got, fleet)
+		_, err = repository.GetServiceClient("lease")
+		expectErr(t, "get unknown", err, serviceClientNotFound)
+		clients, err := repository.ListServiceClients()
+		expectErr(t, "list", err, nil)
+		expect(t, "list", clients, []ServiceClient{booking, fleet})
+
+		expectErr(t, "delete", repository.DeleteServiceClient("fleet"), nil)
+		expectErr(t, "delete twice", repository.DeleteServiceClient("fleet"), serviceClientNotFound)
+		clients, _ = repository.ListServiceClients()
+		expect(t, "list", clients, []ServiceClient{booking})
+	})
+}
+
+func TestRepositoryAPIKeys(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository UserRepository) {
+		key := func(keyID string, userID uint64, created int) APIKey {
+			return APIKey{KeyID: keyID, UserID: userID, Name: "ci " + keyID, SecretHash: "hash " + keyID, Scopes: []string{"bookings:read"}, RateLimit: "60/m", ExpiresAt: at(100), CreatedAt: at(created)}
+		}
+		keys := []APIKey{key("b", 1, 2), key("a", 1, 1), key("c", 2, 3)}
+		for _, k := range keys {
+			expectErr(t, "create", repository.CreateAPIKey(k), nil)
+		}
+
+		got, err := repository.GetAPIKey("b")
+		expectErr(t, "get", err, nil)
+		expect(t, "get", got, keys[0])
+		_, err = repository.GetAPIKey("d")
+		expectErr(t, "get unknown", err, apiKeyNotFound)
+		mine, err := repository.UserAPIKeys(1)
+		expectErr(t, "user's keys", err, nil)
+		expect(t, "user's keys", mine, []APIKey{keys[1], keys[0]})
+
+		lastUsedAt := at(5)
+		updated, err := repository.UpdateAPIKey("b", func(key APIKey) (APIKey, error) {
+			key.LastUsedAt = &lastUsedAt
+			return key, nil
+		})
+		expectErr(t, "update", err, nil)
+		got, _ = repository.GetAPIKey("b")
+		expect(t, "updated key", got, updated)
+		if got.LastUsedAt == nil || !got.LastUsedAt.Equal(lastUsedAt) {
+			t.Fatalf("last used at %v", got.LastUsedAt)
+		}
+		_, err = repository.UpdateAPIKey("b", func(key APIKey) (APIKey, error) {
+			key.Scopes = nil
+			return key, errUpdate
+		})
+		expectErr(t, "refused update", err, errUpdate)
+		got, _ = repository.GetAPIKey("b")
+		expect(t, "key after a refused update", got, updated)
+		_, err = repository.UpdateAPIKey("d", func(key APIKey) (APIKey, error) { return key, nil })
+		expectErr(t, "update unknown", err, apiKeyNotFound)
+
+		expectErr(t, "delete", repository.DeleteAPIKey("a"), nil)
+		expectErr(t, "delete twice", repository.DeleteAPIKey("a"), apiKeyNotFound)
+		mine, _ = repository.UserAPIKeys(1)
+		expect(t, "user's keys", mine, []APIKey{updated})
+	})
+}
+
+func TestRepositoryOIDC(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository UserRepository) {
+		web := OIDCClient{ClientID: "web", Name: "Web", SecretHash: "hash", RedirectURIs: []string{"https://app.example/cb"}, TokenEndpointAuthMethod: "client_secret_basic", CreatedAt: at(1)}
+		app := OIDCClient{ClientID: "app", Name: "App", RedirectURIs: []string{"rental:/cb", "http://127.0.0.1/cb"}, TokenEndpointAuthMethod: "none", CreatedAt: at(2)}
+		expectErr(t, "create", repository.CreateOIDCClient(web), nil)
+		expectErr(t, "create", repository.CreateOIDCClient(app), nil)
+
+		got, err := repository.GetOIDCClient("app")
+		expectErr(t, "get", err, nil)
+		expect(t, "get", got, app)
+		_, err = repository.GetOIDCClient("cli")
+		expectErr(t, "get unknown", err, oidcClientNotFound)
+		clients, err := repository.ListOIDCClients()
+		expectErr(t, "list", err, nil)
+		expect(t, "list", clients, []OIDCClient{app, web})
+		expectErr(t, "delete", repository.DeleteOIDCClient("web"), nil)
+		expectErr(t, "delete twice", repository.DeleteOIDCClient("web"), oidcClientNotFound)
+		clients, _ = repository.ListOIDCClients()
+		expect(t, "list", clients, []OIDCClient{app})
+
+		code := AuthCode{ClientID: "app", RedirectURI: "rental:/cb", Username: "alice", Scopes: []string{scopeOpenID, "profile"}, Nonce: "n", CodeChallenge: "c", AuthTime: at(0), ExpiresAt: at(1)}
+		expectErr(t, "create code", repository.CreateAuthCode("hash", code), nil)
+		gotCode, err := repository.TakeAuthCode("hash")
+		expectErr(t, "take code", err, nil)
+		expect(t, "take code", gotCode, code)
+		_, err = repository.TakeAuthCode("hash")
+		expectErr(t, "take code twice", err, authCodeNotFound)
+		_, err = repository.TakeAuthCode("unknown")
+		expectErr(t, "take unknown code", err, authCodeNotFound)
+	})
+}
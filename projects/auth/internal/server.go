@@ -1,22 +1,44 @@
 package internal
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"distributed-rental/pkg/apikey"
+	"distributed-rental/pkg/openapi"
+	"distributed-rental/pkg/ratelimit"
+	"distributed-rental/pkg/rest"
+	"distributed-rental/pkg/servicetoken"
+	"distributed-rental/pkg/usertoken"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt"
 	"go.uber.org/zap"
-	"io/ioutil"
+	"html/template"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type HttpServer struct {
-	server        http.Server
+	server        *http.Server
 	userService   *UserService
 	logger        *zap.SugaredLogger
 	jwtSigningKey []byte
+	adminToken    []byte
 }
 
-func NewHttpServer(addr string, userService *UserService, jwtSigningKey []byte, logger *zap.SugaredLogger) *HttpServer {
-	srv := http.Server{
+// NewHttpServer creates the auth API. The /admin endpoints require adminToken
+// in the X-Admin-Token header; an empty adminToken disables them.
+func NewHttpServer(addr string, userService *UserService, jwtSigningKey []byte, adminToken []byte, logger *zap.SugaredLogger) *HttpServer {
+	srv := &http.Server{
 		Addr: addr,
 	}
 
@@ -25,11 +47,51 @@ func NewHttpServer(addr string, userService *UserService, jwtSigningKey []byte,
 		userService:   userService,
 		logger:        logger,
 		jwtSigningKey: jwtSigningKey,
+		adminToken:    adminToken,
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/create_user", httpServer.createUser)
 	mux.HandleFunc("/auth_user", httpServer.authUser)
+	mux.HandleFunc("/auth_totp", httpServer.authTOTP)
+	mux.HandleFunc("/totp/enroll", httpServer.enrollTOTP)
+	mux.HandleFunc("/totp/confirm", httpServer.confirmTOTP)
+	mux.HandleFunc("/totp/disable", httpServer.disableTOTP)
+	mux.HandleFunc("/change_password", httpServer.changePassword)
+	mux.HandleFunc("/request_password_reset", httpServer.requestPasswordReset)
+	mux.HandleFunc("/reset_password", httpServer.resetPassword)
+	mux.HandleFunc("/check_token", httpServer.checkToken)
+	mux.HandleFunc("/me", httpServer.me)
+	mux.HandleFunc("/admin/unlock", httpServer.unlock)
+	mux.HandleFunc("/admin/audit_log", httpServer.auditLog)
+	mux.HandleFunc("/admin/list_users", httpServer.listUsers)
+	mux.HandleFunc("/admin/get_user", httpServer.getUser)
+	mux.HandleFunc("/admin/disable_user", httpServer.disableUser)
+	mux.HandleFunc("/admin/enable_user", httpServer.enableUser)
+	mux.HandleFunc("/admin/verify_license", httpServer.verifyLicense)
+	mux.HandleFunc("/admin/export_user", httpServer.exportUser)
+	mux.HandleFunc("/admin/erase_user", httpServer.eraseUser)
+	mux.HandleFunc("/admin/get_data_job", httpServer.getDataJob)
+	mux.HandleFunc("/admin/list_data_jobs", httpServer.listDataJobs)
+	mux.HandleFunc("/admin/retry_data_job", httpServer.retryDataJob)
+	mux.HandleFunc("/admin/create_service_client", httpServer.createServiceClient)
+	mux.HandleFunc("/admin/list_service_clients", httpServer.listServiceClients)
+	mux.HandleFunc("/admin/delete_service_client", httpServer.deleteServiceClient)
+	mux.HandleFunc("/oauth/token", httpServer.token)
+	mux.HandleFunc("/oauth/authorize", httpServer.authorize)
+	mux.HandleFunc("/oauth/userinfo", httpServer.userinfo)
+	mux.HandleFunc("GET /oauth/jwks", httpServer.jwks)
+	mux.HandleFunc("/oauth/register", httpServer.registerOIDCClient)
+	mux.HandleFunc("GET /.well-known/openid-configuration", httpServer.openIDConfiguration)
+	mux.HandleFunc("/admin/list_oidc_clients", httpServer.listOIDCClients)
+	mux.HandleFunc("/admin/delete_oidc_client", httpServer.deleteOIDCClient)
+	mux.HandleFunc("/api_keys/create", httpServer.createAPIKey)
+	mux.HandleFunc("/api_keys/list", httpServer.listAPIKeys)
+	mux.HandleFunc("/api_keys/revoke", httpServer.revokeAPIKey)
+	mux.HandleFunc("/check_api_key", httpServer.checkAPIKey)
+
+	openapi.Register(mux, httpServer.operations())
+	mux.HandleFunc("GET /openapi.json", openapi.Handler(OpenAPI()))
 	httpServer.server.Handler = mux
 
 	return &httpServer
@@ -45,7 +107,11 @@ type createUserResponse struct {
 	Username string `json:"username,omitempty"`
 }
 
+// ListenAndServe serves HTTPS if SetTLS was given a config, HTTP otherwise.
 func (c *HttpServer) ListenAndServe() error {
+	if c.server.TLSConfig != nil {
+		return c.server.ListenAndServeTLS("", "")
+	}
 	return c.server.ListenAndServe()
 }
 
@@ -53,20 +119,35 @@ func (c *HttpServer) Close() error {
 	return c.server.Close()
 }
 
+// Shutdown stops accepting connections and waits for running requests until ctx is done.
+func (c *HttpServer) Shutdown(ctx context.Context) error {
+	return c.server.Shutdown(ctx)
+}
+
+func (c *HttpServer) SetTimeouts(read, write, idle time.Duration) {
+	c.server.ReadTimeout = read
+	c.server.WriteTimeout = write
+	c.server.IdleTimeout = idle
+}
+
+// SetTLS serves HTTPS with config. A nil config keeps plain HTTP.
+func (c *HttpServer) SetTLS(config *tls.Config) {
+	c.server.TLSConfig = config
+}
+
+// SetRateLimit puts the limiter in front of every route, counting requests per
+// user_id or client IP.
+func (c *HttpServer) SetRateLimit(limiter *ratelimit.Limiter) {
+	c.server.Handler = limiter.Handler(c.server.Handler, ratelimit.UserOrIP(c.jwtSigningKey))
+}
+
 func (c *HttpServer) createUser(rw http.ResponseWriter, r *http.Request) {
 	c.logger.Infof("got request for create user")
 
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		rw.WriteHeader(500)
-		c.logger.Errorf("create user error: error reading user body %v", err)
-		return
-	}
-
 	var createUserRequest createUserRequest
-	err = json.Unmarshal(body, &createUserRequest)
+	err := rest.Decode(r, &createUserRequest)
 	if err != nil {
-		rw.WriteHeader(500)
+		rw.WriteHeader(400)
 		c.logger.Errorf("create user error: error unmarshalling request body %v", err)
 		return
 	}
@@ -78,6 +159,10 @@ func (c *HttpServer) createUser(rw http.ResponseWriter, r *http.Request) {
 			http.Error(rw, "user already exists", 400)
 			return
 		}
+		if err == invalidUsername {
+			http.Error(rw, err.Error(), 400)
+			return
+		}
 
 		rw.WriteHeader(500)
 		return
@@ -105,56 +190,419 @@ type authUserRequest struct {
 	Password string `json:"password,omitempty"`
 }
 
+// authUserResponse carries either the access token or, for users with a
+// second factor, the challenge to complete at /auth_totp.
 type authUserResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token,omitempty"`
+	TOTPRequired bool   `json:"totp_required,omitempty"`
+	Challenge    string `json:"challenge,omitempty"`
 }
 
 func (c *HttpServer) authUser(rw http.ResponseWriter, r *http.Request) {
 	c.logger.Infof("got request for auth user")
 
-	body, err := ioutil.ReadAll(r.Body)
+	var authUserRequest authUserRequest
+	err := rest.Decode(r, &authUserRequest)
+	if err != nil {
+		rw.WriteHeader(400)
+		c.logger.Errorf("auth user error: error unmarshalling request body %v", err)
+		return
+	}
+
+	user, err := c.userService.authUser(authUserRequest.Username, authUserRequest.Password, ratelimit.ClientIP(r))
 	if err != nil {
+		c.logger.Errorf("auth user error: %v", err)
+		if err == wrongPassword {
+			http.Error(rw, "wrong password", 400)
+			return
+		}
+		if err == userDisabled {
+			http.Error(rw, err.Error(), http.StatusForbidden)
+			return
+		}
+		if throttled, ok := err.(*tooManyAttempts); ok {
+			rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.retryAfter.Seconds()))))
+			http.Error(rw, throttled.Error(), http.StatusTooManyRequests)
+			return
+		}
 		rw.WriteHeader(500)
-		c.logger.Errorf("auth user error: error reading user body %v", err)
 		return
 	}
 
-	var authUserRequest authUserRequest
-	err = json.Unmarshal(body, &authUserRequest)
+	totpRequired, err := c.userService.totpRequired(user.UserName)
 	if err != nil {
+		c.logger.Errorf("auth user error: %v", err)
 		rw.WriteHeader(500)
-		c.logger.Errorf("auth user error: error unmarshalling request body %v", err)
 		return
 	}
 
-	user, err := c.userService.authUser(authUserRequest.Username, authUserRequest.Password)
+	authUserResponse := authUserResponse{}
+	if totpRequired {
+		authUserResponse.TOTPRequired = true
+		authUserResponse.Challenge, err = c.challengeToken(user)
+	} else {
+		authUserResponse.Token, err = c.accessToken(user)
+	}
 	if err != nil {
 		c.logger.Errorf("auth user error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&authUserResponse)
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("auth user error: error writing response %v", err)
+	}
+}
+
+// accessToken carries the token version of user, so that it stops working
+// once the password changes.
+func (c *HttpServer) accessToken(user User) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username":      user.UserName,
+		"user_id":       user.UserID,
+		"token_version": user.TokenVersion,
+	})
+	return token.SignedString(c.jwtSigningKey)
+}
+
+// challengeKey signs challenge tokens. It is derived from the JWT secret so
+// that the other services, which know only the secret, reject a challenge as
+// an access token.
+func (c *HttpServer) challengeKey() []byte {
+	mac := hmac.New(sha256.New, c.jwtSigningKey)
+	mac.Write([]byte("totp challenge"))
+	return mac.Sum(nil)
+}
+
+// challengeToken proves the password of user was right for the TTL of the
+// challenge. It carries the token version, so that a password change or reset
+// while the code is being typed invalidates the challenge.
+func (c *HttpServer) challengeToken(user User) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username":      user.UserName,
+		"token_version": user.TokenVersion,
+		"exp":           c.userService.clock.Now().Add(c.userService.totp.ChallengeTTL).Unix(),
+	})
+	return token.SignedString(c.challengeKey())
+}
+
+// checkChallenge returns the username of a challenge that has not expired and
+// whose token version is still current.
+func (c *HttpServer) checkChallenge(challenge string) (string, error) {
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	tokenObj, err := parser.Parse(challenge, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return c.challengeKey(), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	claims, ok := tokenObj.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", errors.New("error casting claims to map claims")
+	}
+	if !claims.VerifyExpiresAt(c.userService.clock.Now().Unix(), true) {
+		return "", errors.New("challenge expired")
+	}
+	username, ok := claims["username"].(string)
+	if !ok {
+		return "", errors.New("challenge has no username")
+	}
+	tokenVersion, ok := claims["token_version"].(float64)
+	if !ok {
+		return "", errors.New("challenge has no token_version")
+	}
+	_, err = c.userService.checkTokenVersion(username, uint64(tokenVersion))
+	if err != nil {
+		return "", err
+	}
+	return username, nil
+}
+
+type authTOTPRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+func (c *HttpServer) authTOTP(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for auth totp")
+
+	var authTOTPRequest authTOTPRequest
+	err := rest.Decode(r, &authTOTPRequest)
+	if err != nil {
+		http.Error(rw, "challenge and code are required", 400)
+		return
+	}
+
+	username, err := c.checkChallenge(authTOTPRequest.Challenge)
+	if err != nil {
+		c.logger.Errorf("auth totp error: %v", err)
+		http.Error(rw, "invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := c.userService.completeTOTP(username, authTOTPRequest.Code, ratelimit.ClientIP(r))
+	if err != nil {
+		c.logger.Errorf("auth totp error: %v", err)
+		if err == wrongCode || err == totpNotEnrolled {
+			http.Error(rw, err.Error(), 400)
+			return
+		}
+		if err == userDisabled {
+			http.Error(rw, err.Error(), http.StatusForbidden)
+			return
+		}
+		if throttled, ok := err.(*tooManyAttempts); ok {
+			rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.retryAfter.Seconds()))))
+			http.Error(rw, throttled.Error(), http.StatusTooManyRequests)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+
+	token, err := c.accessToken(user)
+	if err != nil {
+		c.logger.Errorf("auth totp error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&authUserResponse{Token: token})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("auth totp error: error writing response %v", err)
+	}
+}
+
+func (c *HttpServer) enrollTOTP(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for enroll totp")
+	userAuth, err := c.checkAuth(r.Header.Get("X-Auth"))
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := c.userService.enrollTOTP(userAuth.Username)
+	if err != nil {
+		c.logger.Errorf("enroll totp error: %v", err)
+		if err == totpAlreadyEnabled {
+			http.Error(rw, err.Error(), 400)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&enrollment)
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("enroll totp error: error writing response %v", err)
+	}
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+func (c *HttpServer) confirmTOTP(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for confirm totp")
+	c.handleTOTPCode(rw, r, "confirm totp", c.userService.confirmTOTP)
+}
+
+func (c *HttpServer) disableTOTP(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for disable totp")
+	c.handleTOTPCode(rw, r, "disable totp", c.userService.disableTOTP)
+}
+
+// handleTOTPCode passes the code of an authenticated request to action.
+func (c *HttpServer) handleTOTPCode(rw http.ResponseWriter, r *http.Request, name string, action func(username string, code string) error) {
+	userAuth, err := c.checkAuth(r.Header.Get("X-Auth"))
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var totpCodeRequest totpCodeRequest
+	err = rest.Decode(r, &totpCodeRequest)
+	if err != nil {
+		http.Error(rw, "code is required", 400)
+		return
+	}
+
+	err = action(userAuth.Username, totpCodeRequest.Code)
+	if err != nil {
+		c.logger.Errorf("%s error: %v", name, err)
+		if err == wrongCode || err == totpNotEnrolled || err == totpAlreadyEnabled {
+			http.Error(rw, err.Error(), 400)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// changePassword revokes the tokens issued before and responds with a new one.
+func (c *HttpServer) changePassword(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for change password")
+	userAuth, err := c.checkAuth(r.Header.Get("X-Auth"))
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var changePasswordRequest changePasswordRequest
+	err = rest.Decode(r, &changePasswordRequest)
+	if err != nil || changePasswordRequest.NewPassword == "" {
+		http.Error(rw, "old_password and new_password are required", 400)
+		return
+	}
+
+	user, err := c.userService.changePassword(userAuth.Username, changePasswordRequest.OldPassword, changePasswordRequest.NewPassword, ratelimit.ClientIP(r))
+	if err != nil {
+		c.logger.Errorf("change password error: %v", err)
 		if err == wrongPassword {
 			http.Error(rw, "wrong password", 400)
 			return
 		}
+		if err == userDisabled {
+			http.Error(rw, err.Error(), http.StatusForbidden)
+			return
+		}
+		if throttled, ok := err.(*tooManyAttempts); ok {
+			rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.retryAfter.Seconds()))))
+			http.Error(rw, throttled.Error(), http.StatusTooManyRequests)
+			return
+		}
 		rw.WriteHeader(500)
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": user.UserName,
-		"user_id":  user.UserID,
-	})
+	token, err := c.accessToken(user)
+	if err != nil {
+		c.logger.Errorf("change password error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
 
-	tokenString, err := token.SignedString(c.jwtSigningKey)
+	responseBytes, err := json.Marshal(&authUserResponse{Token: token})
 	if err != nil {
-		c.logger.Errorf("auth user error: %v", err)
 		rw.WriteHeader(500)
 		return
 	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("change password error: error writing response %v", err)
+	}
+}
+
+type requestPasswordResetRequest struct {
+	Username string `json:"username"`
+}
+
+// requestPasswordReset answers the same whether or not the user exists.
+func (c *HttpServer) requestPasswordReset(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for request password reset")
 
-	authUserResponse := authUserResponse{
-		Token: tokenString,
+	var requestPasswordResetRequest requestPasswordResetRequest
+	err := rest.Decode(r, &requestPasswordResetRequest)
+	if err != nil || requestPasswordResetRequest.Username == "" {
+		http.Error(rw, "username is required", 400)
+		return
 	}
 
-	responseBytes, err := json.Marshal(&authUserResponse)
+	err = c.userService.requestPasswordReset(requestPasswordResetRequest.Username, ratelimit.ClientIP(r))
+	if err != nil {
+		c.logger.Errorf("request password reset error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+func (c *HttpServer) resetPassword(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for reset password")
+
+	var resetPasswordRequest resetPasswordRequest
+	err := rest.Decode(r, &resetPasswordRequest)
+	if err != nil || resetPasswordRequest.Token == "" || resetPasswordRequest.NewPassword == "" {
+		http.Error(rw, "token and new_password are required", 400)
+		return
+	}
+
+	err = c.userService.resetPassword(resetPasswordRequest.Token, resetPasswordRequest.NewPassword, ratelimit.ClientIP(r))
+	if err != nil {
+		c.logger.Errorf("reset password error: %v", err)
+		if err == resetTokenNotFound {
+			http.Error(rw, err.Error(), 400)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+}
+
+type checkTokenRequest struct {
+	Token string `json:"token"`
+}
+
+type checkTokenResponse struct {
+	UserID   uint64 `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// checkToken lets the other services find out whether an access token was
+// revoked by a password change.
+func (c *HttpServer) checkToken(rw http.ResponseWriter, r *http.Request) {
+	var checkTokenRequest checkTokenRequest
+	err := rest.Decode(r, &checkTokenRequest)
+	if err != nil {
+		http.Error(rw, "token is required", 400)
+		return
+	}
+
+	userAuth, _, err := c.checkUserToken(checkTokenRequest.Token)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&checkTokenResponse{UserID: userAuth.UserID, Username: userAuth.Username})
 	if err != nil {
 		rw.WriteHeader(500)
 		return
@@ -162,6 +610,1494 @@ func (c *HttpServer) authUser(rw http.ResponseWriter, r *http.Request) {
 	rw.WriteHeader(200)
 	_, err = rw.Write(responseBytes)
 	if err != nil {
-		c.logger.Errorf("auth user error: error writing response %v", err)
+		c.logger.Errorf("check token error: error writing response %v", err)
+	}
+}
+
+type UserAuthObject struct {
+	Username string
+	UserID   uint64
+}
+
+// checkAuth accepts session tokens only. The endpoints behind it manage the
+// account, which OpenID Connect clients are never granted.
+func (c *HttpServer) checkAuth(token string) (UserAuthObject, error) {
+	userAuth, claims, err := c.checkUserToken(token)
+	if err != nil {
+		return UserAuthObject{}, err
+	}
+	if usertoken.Scoped(claims) {
+		return UserAuthObject{}, errors.New("access tokens of OpenID Connect clients can not manage the account")
+	}
+	return userAuth, nil
+}
+
+// checkUserToken accepts session tokens and OpenID Connect access tokens and
+// returns the claims of the token.
+func (c *HttpServer) checkUserToken(token string) (UserAuthObject, jwt.MapClaims, error) {
+	tokenObj, err := jwt.Parse(token, usertoken.Keyfunc(c.jwtSigningKey))
+	if err != nil {
+		return UserAuthObject{}, nil, fmt.Errorf("error casting user id from token: %w", err)
+	}
+
+	claims, ok := tokenObj.Claims.(jwt.MapClaims)
+	if !ok {
+		return UserAuthObject{}, nil, fmt.Errorf("token %s verification error: error casting claims to map claims", token)
+	}
+	username, ok := claims["username"].(string)
+	if !ok {
+		return UserAuthObject{}, nil, errors.New("token has no username")
+	}
+	// Tokens issued before versions existed have none and match version 0.
+	tokenVersion, _ := claims["token_version"].(float64)
+	user, err := c.userService.checkTokenVersion(username, uint64(tokenVersion))
+	if err != nil {
+		return UserAuthObject{}, nil, err
+	}
+
+	return UserAuthObject{
+		user.UserName,
+		user.UserID,
+	}, claims, nil
+}
+
+func (c *HttpServer) checkAdmin(r *http.Request) bool {
+	if len(c.adminToken) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), c.adminToken) == 1
+}
+
+type unlockRequest struct {
+	Username string `json:"username,omitempty"`
+	IP       string `json:"ip,omitempty"`
+}
+
+func (c *HttpServer) unlock(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for unlock")
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return
+	}
+
+	var unlockRequest unlockRequest
+	err := rest.Decode(r, &unlockRequest)
+	if err != nil || (unlockRequest.Username == "" && unlockRequest.IP == "") {
+		http.Error(rw, "username or ip is required", 400)
+		return
+	}
+
+	err = c.userService.unlock(unlockRequest.Username, unlockRequest.IP)
+	if err != nil {
+		c.logger.Errorf("unlock error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+}
+
+type auditLogRequest struct {
+	Limit int `json:"limit"`
+}
+
+type auditLogResponse struct {
+	Events []AuditEvent `json:"events"`
+}
+
+const defaultAuditLogLimit = 100
+
+func (c *HttpServer) auditLog(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for audit log")
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return
+	}
+
+	auditLogRequest := auditLogRequest{Limit: defaultAuditLogLimit}
+	err := rest.Decode(r, &auditLogRequest)
+	if err != nil {
+		rw.WriteHeader(400)
+		return
+	}
+
+	events, err := c.userService.auditLog(auditLogRequest.Limit)
+	if err != nil {
+		c.logger.Errorf("audit log error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&auditLogResponse{Events: events})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("audit log error: error writing response %v", err)
+	}
+}
+
+// me shows the profile of the authenticated user on GET and changes it on
+// PATCH. GET also takes an API key, which the rental services use to check
+// the driver behind a key.
+func (c *HttpServer) me(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for me")
+	var userAuth UserAuthObject
+	var err error
+	if key := r.Header.Get(apikey.Header); key != "" && r.Method == http.MethodGet {
+		var user User
+		_, user, err = c.userService.checkAPIKey(key)
+		userAuth = UserAuthObject{user.UserName, user.UserID}
+	} else {
+		userAuth, err = c.checkAuth(r.Header.Get("X-Auth"))
+	}
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var profile UserProfile
+	switch r.Method {
+	case http.MethodGet:
+		profile, err = c.userService.profile(userAuth.Username)
+	case http.MethodPatch:
+		var profilePatch ProfilePatch
+		err = rest.Decode(r, &profilePatch)
+		if err != nil {
+			http.Error(rw, "invalid profile", 400)
+			return
+		}
+		profile, err = c.userService.updateProfile(userAuth.Username, profilePatch)
+	default:
+		rw.Header().Set("Allow", "GET, PATCH")
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		c.logger.Errorf("me error: %v", err)
+		if _, ok := err.(*invalidProfile); ok {
+			http.Error(rw, err.Error(), 400)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+
+	c.writeUserProfile(rw, "me", profile)
+}
+
+func (c *HttpServer) writeUserProfile(rw http.ResponseWriter, name string, profile UserProfile) {
+	responseBytes, err := json.Marshal(&profile)
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("%s error: error writing response %v", name, err)
+	}
+}
+
+// listUsersRequest pages through the users by id: the next page starts after
+// the last user_id of the previous one, the first has none. Query searches
+// username, full name and email.
+type listUsersRequest struct {
+	After *uint64 `json:"after"`
+	Limit int     `json:"limit"`
+	Query string  `json:"query"`
+}
+
+type listUsersResponse struct {
+	Users []UserProfile `json:"users"`
+}
+
+const defaultListUsersLimit = 100
+
+func (c *HttpServer) listUsers(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for list users")
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return
+	}
+
+	listUsersRequest := listUsersRequest{Limit: defaultListUsersLimit}
+	err := rest.Decode(r, &listUsersRequest)
+	if err != nil {
+		rw.WriteHeader(400)
+		return
+	}
+	if listUsersRequest.Limit <= 0 || listUsersRequest.Limit > defaultListUsersLimit {
+		listUsersRequest.Limit = defaultListUsersLimit
+	}
+
+	users, err := c.userService.listUsers(listUsersRequest.After, listUsersRequest.Limit, listUsersRequest.Query)
+	if err != nil {
+		c.logger.Errorf("list users error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&listUsersResponse{Users: users})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("list users error: error writing response %v", err)
+	}
+}
+
+type userIDRequest struct {
+	UserID *uint64 `json:"user_id"`
+}
+
+func (c *HttpServer) getUser(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for get user")
+	c.handleUserID(rw, r, "get user", c.userService.userByID)
+}
+
+func (c *HttpServer) disableUser(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for disable user")
+	c.handleUserID(rw, r, "disable user", func(userID uint64) (UserProfile, error) {
+		return c.userService.setDisabled(userID, true)
+	})
+}
+
+func (c *HttpServer) enableUser(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for enable user")
+	c.handleUserID(rw, r, "enable user", func(userID uint64) (UserProfile, error) {
+		return c.userService.setDisabled(userID, false)
+	})
+}
+
+// handleUserID passes the user_id of an admin request to action and responds
+// with the resulting profile.
+func (c *HttpServer) handleUserID(rw http.ResponseWriter, r *http.Request, name string, action func(userID uint64) (UserProfile, error)) {
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return
+	}
+
+	var userIDRequest userIDRequest
+	err := rest.Decode(r, &userIDRequest)
+	if err != nil || userIDRequest.UserID == nil {
+		http.Error(rw, "user_id is required", 400)
+		return
+	}
+
+	profile, err := action(*userIDRequest.UserID)
+	if err != nil {
+		c.logger.Errorf("%s error: %v", name, err)
+		if err == userNotFound {
+			http.Error(rw, err.Error(), http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+
+	c.writeUserProfile(rw, name, profile)
+}
+
+type verifyLicenseRequest struct {
+	UserID *uint64 `json:"user_id"`
+	Status string  `json:"status"`
+}
+
+// verifyLicense records whether staff accepted the driver's license of a user.
+func (c *HttpServer) verifyLicense(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for verify license")
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return
+	}
+
+	var verifyLicenseRequest verifyLicenseRequest
+	err := rest.Decode(r, &verifyLicenseRequest)
+	if err != nil || verifyLicenseRequest.UserID == nil {
+		http.Error(rw, "user_id and status are required", 400)
+		return
+	}
+
+	profile, err := c.userService.setLicenseStatus(*verifyLicenseRequest.UserID, verifyLicenseRequest.Status)
+	if err != nil {
+		c.logger.Errorf("verify license error: %v", err)
+		if err == userNotFound {
+			http.Error(rw, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err == invalidLicenseStatus || err == noDriverLicense {
+			http.Error(rw, err.Error(), 400)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+
+	c.writeUserProfile(rw, "verify license", profile)
+}
+
+// dataJobRequest names a user for new and listed jobs and a job otherwise.
+type dataJobRequest struct {
+	UserID *uint64 `json:"user_id"`
+	JobID  string  `json:"job_id"`
+}
+
+type listDataJobsResponse struct {
+	Jobs []DataJob `json:"jobs"`
+}
+
+// exportUser starts collecting the data of a user from all services. The
+// archive is in the results of the job once it is done.
+func (c *HttpServer) exportUser(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for export user")
+	c.handleDataJob(rw, r, "export user", func(request dataJobRequest) (interface{}, error) {
+		if request.UserID == nil {
+			return nil, missingField("user_id")
+		}
+		return c.userService.createDataJob(dataJobExport, *request.UserID)
+	})
+}
+
+// eraseUser starts erasing the personal data of a user in all services.
+func (c *HttpServer) eraseUser(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for erase user")
+	c.handleDataJob(rw, r, "erase user", func(request dataJobRequest) (interface{}, error) {
+		if request.UserID == nil {
+			return nil, missingField("user_id")
+		}
+		return c.userService.createDataJob(dataJobErase, *request.UserID)
+	})
+}
+
+func (c *HttpServer) getDataJob(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for get data job")
+	c.handleDataJob(rw, r, "get data job", func(request dataJobRequest) (interface{}, error) {
+		if request.JobID == "" {
+			return nil, missingField("job_id")
+		}
+		return c.userService.dataJob(request.JobID)
+	})
+}
+
+func (c *HttpServer) listDataJobs(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for list data jobs")
+	c.handleDataJob(rw, r, "list data jobs", func(request dataJobRequest) (interface{}, error) {
+		if request.UserID == nil {
+			return nil, missingField("user_id")
+		}
+		jobs, err := c.userService.userDataJobs(*request.UserID)
+		if err != nil {
+			return nil, err
+		}
+		return listDataJobsResponse{Jobs: jobs}, nil
+	})
+}
+
+func (c *HttpServer) retryDataJob(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for retry data job")
+	c.handleDataJob(rw, r, "retry data job", func(request dataJobRequest) (interface{}, error) {
+		if request.JobID == "" {
+			return nil, missingField("job_id")
+		}
+		return c.userService.retryDataJob(request.JobID)
+	})
+}
+
+// missingField rejects a data job request without a required field.
+type missingField string
+
+func (c missingField) Error() string {
+	return string(c) + " is required"
+}
+
+// handleDataJob passes an admin data job request to action and responds with
+// what it returns.
+func (c *HttpServer) handleDataJob(rw http.ResponseWriter, r *http.Request, name string, action func(request dataJobRequest) (interface{}, error)) {
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return
+	}
+
+	var dataJobRequest dataJobRequest
+	err := rest.Decode(r, &dataJobRequest)
+	if err != nil {
+		http.Error(rw, "invalid request", 400)
+		return
+	}
+
+	response, err := action(dataJobRequest)
+	if err != nil {
+		c.logger.Errorf("%s error: %v", name, err)
+		if _, ok := err.(missingField); ok || err == dataJobNotFailed {
+			http.Error(rw, err.Error(), 400)
+			return
+		}
+		if err == userNotFound || err == dataJobNotFound {
+			http.Error(rw, err.Error(), http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("%s error: error writing response %v", name, err)
+	}
+}
+
+type createServiceClientRequest struct {
+	ClientID string   `json:"client_id"`
+	Scopes   []string `json:"scopes"`
+}
+
+// createServiceClientResponse is the only place the client secret is shown.
+type createServiceClientResponse struct {
+	ServiceClient
+	ClientSecret string `json:"client_secret"`
+}
+
+type serviceClientRequest struct {
+	ClientID string `json:"client_id"`
+}
+
+type listServiceClientsResponse struct {
+	Clients []ServiceClient `json:"clients"`
+}
+
+// createServiceClient registers a service that may get service tokens.
+func (c *HttpServer) createServiceClient(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for create service client")
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return
+	}
+
+	var createServiceClientRequest createServiceClientRequest
+	err := rest.Decode(r, &createServiceClientRequest)
+	if err != nil {
+		http.Error(rw, "invalid request", 400)
+		return
+	}
+
+	client, secret, err := c.userService.createServiceClient(createServiceClientRequest.ClientID, createServiceClientRequest.Scopes)
+	if err != nil {
+		c.logger.Errorf("create service client error: %v", err)
+		if _, ok := err.(invalidScope); ok || err == invalidClientID || err == serviceClientAlreadyExists {
+			http.Error(rw, err.Error(), 400)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&createServiceClientResponse{ServiceClient: client, ClientSecret: secret})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("create service client error: error writing response %v", err)
+	}
+}
+
+func (c *HttpServer) listServiceClients(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for list service clients")
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return
+	}
+
+	clients, err := c.userService.listServiceClients()
+	if err != nil {
+		c.logger.Errorf("list service clients error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&listServiceClientsResponse{Clients: clients})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("list service clients error: error writing response %v", err)
+	}
+}
+
+func (c *HttpServer) deleteServiceClient(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for delete service client")
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return
+	}
+
+	var serviceClientRequest serviceClientRequest
+	err := rest.Decode(r, &serviceClientRequest)
+	if err != nil || serviceClientRequest.ClientID == "" {
+		http.Error(rw, "client_id is required", 400)
+		return
+	}
+
+	err = c.userService.deleteServiceClient(serviceClientRequest.ClientID)
+	if err != nil {
+		c.logger.Errorf("delete service client error: %v", err)
+		if err == serviceClientNotFound {
+			http.Error(rw, err.Error(), http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+}
+
+// tokenResponse is the access token response of RFC 6749, section 5.1, with
+// the ID token of OpenID Connect Core, section 3.1.3.3.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// oauthError is the error response of RFC 6749, section 5.2.
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// token is the OAuth2 token endpoint. It serves the client credentials grant
+// of service clients and the authorization code grant of OpenID Connect
+// clients.
+func (c *HttpServer) token(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for token")
+	if r.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		c.writeOAuthError(rw, 400, "invalid_request", "request body must be form encoded")
+		return
+	}
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+		c.serviceToken(rw, r)
+	case "authorization_code":
+		c.authorizationCodeToken(rw, r)
+	default:
+		c.writeOAuthError(rw, 400, "unsupported_grant_type", "grant_type must be authorization_code or client_credentials")
+	}
+}
+
+// clientCredentials returns the client_id and client_secret of HTTP Basic or,
+// without it, of the form.
+func clientCredentials(r *http.Request) (string, string, error) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), nil
+	}
+	// RFC 6749, section 2.3.1: both are form encoded before Basic encoding.
+	clientID, err := url.QueryUnescape(clientID)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err = url.QueryUnescape(secret)
+	if err != nil {
+		return "", "", err
+	}
+	return clientID, secret, nil
+}
+
+// serviceToken is the client credentials grant (RFC 6749, section 4.4).
+// Clients authenticate with HTTP Basic or with client_id and client_secret in
+// the form and may ask for a subset of their scopes. Tokens are signed with
+// servicetoken.Key, which booking and lease derive from the same JWT secret.
+func (c *HttpServer) serviceToken(rw http.ResponseWriter, r *http.Request) {
+	clientID, secret, err := clientCredentials(r)
+	if err != nil {
+		c.writeOAuthError(rw, 400, "invalid_request", "malformed client credentials")
+		return
+	}
+	if clientID == "" || secret == "" {
+		rw.Header().Set("WWW-Authenticate", `Basic realm="auth"`)
+		c.writeOAuthError(rw, http.StatusUnauthorized, "invalid_client", "client credentials are required")
+		return
+	}
+
+	// With mutual TLS a client may only get tokens over its own certificate,
+	// so a leaked secret alone is not enough.
+	if c.server.TLSConfig != nil && c.server.TLSConfig.ClientCAs != nil {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || r.TLS.VerifiedChains[0][0].Subject.CommonName != clientID {
+			c.writeOAuthError(rw, http.StatusUnauthorized, "invalid_client", "a client certificate issued to the client is required")
+			return
+		}
+	}
+
+	client, err := c.userService.authServiceClient(clientID, secret, strings.Fields(r.PostForm.Get("scope")))
+	if err != nil {
+		c.logger.Errorf("service token error: %v", err)
+		if err == wrongClientSecret {
+			rw.Header().Set("WWW-Authenticate", `Basic realm="auth"`)
+			c.writeOAuthError(rw, http.StatusUnauthorized, "invalid_client", err.Error())
+			return
+		}
+		if _, ok := err.(invalidScope); ok {
+			c.writeOAuthError(rw, 400, "invalid_scope", err.Error())
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+
+	ttl := c.userService.serviceTokenTTL
+	token, err := servicetoken.Issue(servicetoken.Key(c.jwtSigningKey), client.ClientID, client.Scopes, time.Now().Add(ttl))
+	if err != nil {
+		c.logger.Errorf("service token error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	c.writeTokenResponse(rw, tokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttl / time.Second),
+		Scope:       strings.Join(client.Scopes, " "),
+	})
+}
+
+func (c *HttpServer) writeTokenResponse(rw http.ResponseWriter, response tokenResponse) {
+	responseBytes, err := json.Marshal(&response)
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("token error: error writing response %v", err)
+	}
+}
+
+func (c *HttpServer) writeOAuthError(rw http.ResponseWriter, status int, code string, description string) {
+	responseBytes, err := json.Marshal(&oauthError{Error: code, ErrorDescription: description})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(status)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("oauth error: error writing response %v", err)
+	}
+}
+
+// createAPIKeyRequest asks for a key with scopes. Without expires_at the key
+// gets the default lifetime and without rate_limit the default limit.
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	RateLimit string     `json:"rate_limit"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// createAPIKeyResponse is the only place the full key is shown.
+type createAPIKeyResponse struct {
+	APIKey
+	Key string `json:"api_key"`
+}
+
+type listAPIKeysResponse struct {
+	APIKeys []APIKey `json:"api_keys"`
+}
+
+type revokeAPIKeyRequest struct {
+	KeyID string `json:"key_id"`
+}
+
+type checkAPIKeyRequest struct {
+	Key string `json:"api_key"`
+}
+
+// createAPIKey gives the authenticated user a key for a partner integration.
+func (c *HttpServer) createAPIKey(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for create api key")
+	userAuth, err := c.checkAuth(r.Header.Get("X-Auth"))
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var createAPIKeyRequest createAPIKeyRequest
+	err = rest.Decode(r, &createAPIKeyRequest)
+	if err != nil {
+		http.Error(rw, "invalid request", 400)
+		return
+	}
+	var expiresAt time.Time
+	if createAPIKeyRequest.ExpiresAt != nil {
+		expiresAt = *createAPIKeyRequest.ExpiresAt
+	}
+
+	apiKey, key, err := c.userService.createAPIKey(userAuth.UserID, createAPIKeyRequest.Name, createAPIKeyRequest.Scopes, createAPIKeyRequest.RateLimit, expiresAt)
+	if err != nil {
+		c.logger.Errorf("create api key error: %v", err)
+		_, isScope := err.(invalidScope)
+		_, isRateLimit := err.(*invalidAPIKeyRateLimit)
+		if isScope || isRateLimit || err == invalidAPIKeyName || err == invalidAPIKeyExpiry {
+			http.Error(rw, err.Error(), 400)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&createAPIKeyResponse{APIKey: apiKey, Key: key})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("create api key error: error writing response %v", err)
+	}
+}
+
+func (c *HttpServer) listAPIKeys(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for list api keys")
+	userAuth, err := c.checkAuth(r.Header.Get("X-Auth"))
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	apiKeys, err := c.userService.listAPIKeys(userAuth.UserID)
+	if err != nil {
+		c.logger.Errorf("list api keys error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&listAPIKeysResponse{APIKeys: apiKeys})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("list api keys error: error writing response %v", err)
+	}
+}
+
+// revokeAPIKey deletes a key of the authenticated user. The rental services
+// may accept it for up to their token cache TTL.
+func (c *HttpServer) revokeAPIKey(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for revoke api key")
+	userAuth, err := c.checkAuth(r.Header.Get("X-Auth"))
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var revokeAPIKeyRequest revokeAPIKeyRequest
+	err = rest.Decode(r, &revokeAPIKeyRequest)
+	if err != nil || revokeAPIKeyRequest.KeyID == "" {
+		http.Error(rw, "key_id is required", 400)
+		return
+	}
+
+	err = c.userService.revokeAPIKey(userAuth.UserID, revokeAPIKeyRequest.KeyID)
+	if err != nil {
+		c.logger.Errorf("revoke api key error: %v", err)
+		if err == apiKeyNotFound {
+			http.Error(rw, err.Error(), http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+}
+
+// checkAPIKey lets the other services find out whether an API key is valid
+// and whom it acts for.
+func (c *HttpServer) checkAPIKey(rw http.ResponseWriter, r *http.Request) {
+	var checkAPIKeyRequest checkAPIKeyRequest
+	err := rest.Decode(r, &checkAPIKeyRequest)
+	if err != nil {
+		http.Error(rw, "api_key is required", 400)
+		return
+	}
+
+	apiKey, user, err := c.userService.checkAPIKey(checkAPIKeyRequest.Key)
+	if err == wrongAPIKey {
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		c.logger.Errorf("check api key error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&apikey.Info{
+		KeyID:     apiKey.KeyID,
+		UserID:    user.UserID,
+		Username:  user.UserName,
+		Scopes:    apiKey.Scopes,
+		RateLimit: apiKey.RateLimit,
+	})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("check api key error: error writing response %v", err)
+	}
+}
+
+// registerOIDCClientRequest is the client metadata of RFC 7591, section 2,
+// that the provider uses.
+type registerOIDCClientRequest struct {
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+}
+
+// registerOIDCClientResponse is the only place the client secret is shown.
+type registerOIDCClientResponse struct {
+	OIDCClient
+	ClientSecret          string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt      int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt *int64 `json:"client_secret_expires_at,omitempty"`
+}
+
+type listOIDCClientsResponse struct {
+	Clients []OIDCClient `json:"clients"`
+}
+
+type oidcClientRequest struct {
+	ClientID string `json:"client_id"`
+}
+
+// registerOIDCClient is the client registration endpoint of RFC 7591.
+// Registration is open to admins only; clients are first party apps.
+func (c *HttpServer) registerOIDCClient(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for register oidc client")
+	if r.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return
+	}
+
+	var registerOIDCClientRequest registerOIDCClientRequest
+	err := rest.Decode(r, &registerOIDCClientRequest)
+	if err != nil {
+		c.writeOAuthError(rw, 400, "invalid_client_metadata", "invalid request")
+		return
+	}
+
+	client, secret, err := c.userService.createOIDCClient(registerOIDCClientRequest.ClientName, registerOIDCClientRequest.RedirectURIs, registerOIDCClientRequest.TokenEndpointAuthMethod)
+	if err != nil {
+		c.logger.Errorf("register oidc client error: %v", err)
+		if err == invalidRedirectURI {
+			c.writeOAuthError(rw, 400, "invalid_redirect_uri", err.Error())
+			return
+		}
+		if err == invalidAuthMethod {
+			c.writeOAuthError(rw, 400, "invalid_client_metadata", err.Error())
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+
+	response := registerOIDCClientResponse{OIDCClient: client, ClientSecret: secret, ClientIDIssuedAt: client.CreatedAt.Unix()}
+	if secret != "" {
+		// Secrets do not expire.
+		var never int64
+		response.ClientSecretExpiresAt = &never
+	}
+	responseBytes, err := json.Marshal(&response)
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusCreated)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("register oidc client error: error writing response %v", err)
+	}
+}
+
+func (c *HttpServer) listOIDCClients(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for list oidc clients")
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return
+	}
+
+	clients, err := c.userService.listOIDCClients()
+	if err != nil {
+		c.logger.Errorf("list oidc clients error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&listOIDCClientsResponse{Clients: clients})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("list oidc clients error: error writing response %v", err)
+	}
+}
+
+func (c *HttpServer) deleteOIDCClient(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for delete oidc client")
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return
+	}
+
+	var oidcClientRequest oidcClientRequest
+	err := rest.Decode(r, &oidcClientRequest)
+	if err != nil || oidcClientRequest.ClientID == "" {
+		http.Error(rw, "client_id is required", 400)
+		return
+	}
+
+	err = c.userService.deleteOIDCClient(oidcClientRequest.ClientID)
+	if err != nil {
+		c.logger.Errorf("delete oidc client error: %v", err)
+		if err == oidcClientNotFound {
+			http.Error(rw, err.Error(), http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+}
+
+// authorizeParams are the parameters of an authorization request. The login
+// form carries them along, so that its POST needs no session.
+var authorizeParams = []string{"client_id", "redirect_uri", "response_type", "scope", "state", "nonce", "code_challenge", "code_challenge_method"}
+
+// authorizeView is what the login page of the authorization endpoint shows.
+// Without Form it is an error page. With Challenge the password was right
+// and the form asks for a TOTP code.
+type authorizeView struct {
+	ClientName string
+	Error      string
+	Form       bool
+	Params     map[string]string
+	Challenge  string
+}
+
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<h1>{{if .ClientName}}Sign in to {{.ClientName}}{{else}}Sign in{{end}}</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>
+{{end}}{{if .Form}}<form method="post" action="/oauth/authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}{{if .Challenge}}<input type="hidden" name="challenge" value="{{.Challenge}}">
+<p><label>Authenticator or recovery code <input name="code" autocomplete="one-time-code" required autofocus></label></p>
+{{else}}<p><label>Username <input name="username" autocomplete="username" required autofocus></label></p>
+<p><label>Password <input name="password" type="password" autocomplete="current-password" required></label></p>
+{{end}}<p><button type="submit">Sign in</button></p>
+</form>
+{{end}}</body>
+</html>
+`))
+
+// writeAuthorizePage renders the login page. It must not be framed, so that
+// other sites can not trick users into signing in through it.
+func (c *HttpServer) writeAuthorizePage(rw http.ResponseWriter, status int, view authorizeView) {
+	var page bytes.Buffer
+	err := authorizePage.Execute(&page, view)
+	if err != nil {
+		c.logger.Errorf("authorize error: error rendering page %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("X-Frame-Options", "DENY")
+	rw.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	rw.WriteHeader(status)
+	_, err = rw.Write(page.Bytes())
+	if err != nil {
+		c.logger.Errorf("authorize error: error writing response %v", err)
+	}
+}
+
+// redirectAuthorize sends the result of an authorization request back to the
+// client: a code or an error of RFC 6749, section 4.1.2.1, with the state of
+// the request and the issuer of RFC 9207.
+func (c *HttpServer) redirectAuthorize(rw http.ResponseWriter, r *http.Request, request AuthRequest, values url.Values) {
+	redirectURI, err := url.Parse(request.RedirectURI)
+	if err != nil {
+		c.logger.Errorf("authorize error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+	query := redirectURI.Query()
+	for name := range values {
+		query.Set(name, values.Get(name))
+	}
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+	query.Set("iss", c.userService.oidc.Issuer)
+	redirectURI.RawQuery = query.Encode()
+	rw.Header().Set("Cache-Control", "no-store")
+	http.Redirect(rw, r, redirectURI.String(), http.StatusSeeOther)
+}
+
+func (c *HttpServer) redirectAuthorizeError(rw http.ResponseWriter, r *http.Request, request AuthRequest, code string, description string) {
+	c.redirectAuthorize(rw, r, request, url.Values{"error": {code}, "error_description": {description}})
+}
+
+// authorize is the authorization endpoint of the authorization code flow
+// (OpenID Connect Core, section 3.1.2). GET shows a login page; its POST
+// checks the password, and the TOTP code if the user has one, with the same
+// lockout as /auth_user, then redirects to the client with a code. PKCE with
+// S256 is required of every client.
+func (c *HttpServer) authorize(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for authorize")
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		rw.Header().Set("Allow", "GET, POST")
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		c.writeAuthorizePage(rw, 400, authorizeView{Error: "Malformed request."})
+		return
+	}
+	params := map[string]string{}
+	for _, name := range authorizeParams {
+		params[name] = r.Form.Get(name)
+	}
+
+	// Until the redirect URI is known to belong to the client, errors go to
+	// the user, not to the redirect URI.
+	client, err := c.userService.oidcRedirectClient(params["client_id"], params["redirect_uri"])
+	if err != nil {
+		c.logger.Errorf("authorize error: %v", err)
+		if err == oidcClientNotFound || err == invalidRedirectURI {
+			c.writeAuthorizePage(rw, 400, authorizeView{Error: "Unknown client_id or redirect_uri."})
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+	request := AuthRequest{
+		ClientID:      client.ClientID,
+		RedirectURI:   params["redirect_uri"],
+		State:         params["state"],
+		Nonce:         params["nonce"],
+		CodeChallenge: params["code_challenge"],
+	}
+	if params["response_type"] != "code" {
+		c.redirectAuthorizeError(rw, r, request, "unsupported_response_type", "response_type must be code")
+		return
+	}
+	request.Scopes, err = checkOIDCScopes(params["scope"])
+	if err != nil {
+		c.redirectAuthorizeError(rw, r, request, "invalid_scope", err.Error())
+		return
+	}
+	// An S256 challenge is the base64url of a SHA-256, 43 characters long.
+	if params["code_challenge_method"] != "S256" || len(request.CodeChallenge) != 43 {
+		c.redirectAuthorizeError(rw, r, request, "invalid_request", "code_challenge with code_challenge_method S256 is required")
+		return
+	}
+
+	view := authorizeView{ClientName: client.Name, Form: true, Params: params}
+	if r.Method == http.MethodGet {
+		c.writeAuthorizePage(rw, 200, view)
+		return
+	}
+
+	var user User
+	ip := ratelimit.ClientIP(r)
+	if challenge := r.PostForm.Get("challenge"); challenge != "" {
+		var username string
+		username, err = c.checkChallenge(challenge)
+		if err != nil {
+			c.logger.Errorf("authorize error: %v", err)
+			view.Error = "The sign in took too long, please sign in again."
+			c.writeAuthorizePage(rw, 400, view)
+			return
+		}
+		view.Challenge = challenge
+		user, err = c.userService.completeTOTP(username, r.PostForm.Get("code"), ip)
+	} else {
+		user, err = c.userService.authUser(r.PostForm.Get("username"), r.PostForm.Get("password"), ip)
+		if err == nil {
+			var totpRequired bool
+			totpRequired, err = c.userService.totpRequired(user.UserName)
+			if err == nil && totpRequired {
+				view.Challenge, err = c.challengeToken(user)
+				if err == nil {
+					c.writeAuthorizePage(rw, 200, view)
+					return
+				}
+			}
+		}
+	}
+	if err != nil {
+		c.logger.Errorf("authorize error: %v", err)
+		status := 400
+		switch err {
+		case wrongPassword:
+			view.Error = "Wrong username or password."
+		case wrongCode:
+			view.Error = "Wrong code."
+		case totpNotEnrolled:
+			view.Challenge = ""
+			view.Error = "Two-factor authentication was turned off, please sign in again."
+		case userDisabled:
+			status = http.StatusForbidden
+			view.Form = false
+			view.Error = "This account is disabled."
+		default:
+			throttled, ok := err.(*tooManyAttempts)
+			if !ok {
+				rw.WriteHeader(500)
+				return
+			}
+			status = http.StatusTooManyRequests
+			rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.retryAfter.Seconds()))))
+			view.Error = "Too many attempts, please try again later."
+		}
+		c.writeAuthorizePage(rw, status, view)
+		return
+	}
+
+	code, err := c.userService.issueAuthCode(request, user)
+	if err != nil {
+		c.logger.Errorf("authorize error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+	c.redirectAuthorize(rw, r, request, url.Values{"code": {code}})
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, granted := range scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizationCodeToken is the authorization code grant (RFC 6749, section
+// 4.1.3, with PKCE of RFC 7636). Confidential clients authenticate like
+// service clients; public clients only send their client_id.
+func (c *HttpServer) authorizationCodeToken(rw http.ResponseWriter, r *http.Request) {
+	clientID, secret, err := clientCredentials(r)
+	if err != nil {
+		c.writeOAuthError(rw, 400, "invalid_request", "malformed client credentials")
+		return
+	}
+	if clientID == "" {
+		rw.Header().Set("WWW-Authenticate", `Basic realm="auth"`)
+		c.writeOAuthError(rw, http.StatusUnauthorized, "invalid_client", "client_id is required")
+		return
+	}
+	client, err := c.userService.authOIDCClient(clientID, secret)
+	if err != nil {
+		c.logger.Errorf("authorization code error: %v", err)
+		if err == wrongClientSecret {
+			rw.Header().Set("WWW-Authenticate", `Basic realm="auth"`)
+			c.writeOAuthError(rw, http.StatusUnauthorized, "invalid_client", err.Error())
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+
+	code, codeVerifier := r.PostForm.Get("code"), r.PostForm.Get("code_verifier")
+	if code == "" || codeVerifier == "" {
+		c.writeOAuthError(rw, 400, "invalid_request", "code and code_verifier are required")
+		return
+	}
+	authCode, user, err := c.userService.redeemAuthCode(client, code, r.PostForm.Get("redirect_uri"), codeVerifier)
+	if err != nil {
+		c.logger.Errorf("authorization code error: %v", err)
+		if err == authCodeNotFound || err == wrongCodeVerifier || err == userDisabled {
+			c.writeOAuthError(rw, 400, "invalid_grant", err.Error())
+			return
+		}
+		rw.WriteHeader(500)
+		return
+	}
+
+	now := time.Now()
+	ttl := c.userService.oidc.TokenTTL
+	response := tokenResponse{
+		TokenType: "Bearer",
+		ExpiresIn: int64(ttl / time.Second),
+		Scope:     strings.Join(authCode.Scopes, " "),
+	}
+	response.AccessToken, err = c.oidcAccessToken(user, client, authCode.Scopes, now)
+	if err == nil && containsScope(authCode.Scopes, scopeOpenID) {
+		response.IDToken, err = c.idToken(user, client, authCode, now)
+	}
+	if err != nil {
+		c.logger.Errorf("authorization code error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+	c.writeTokenResponse(rw, response)
+}
+
+// oidcAccessToken has the claims of the tokens of /auth_user, so booking and
+// lease accept it like those, plus the claims of RFC 9068. Unlike those it
+// expires, and it is signed with usertoken.OIDCKey, so it can not stand in for
+// a session token at the account endpoints.
+func (c *HttpServer) oidcAccessToken(user User, client OIDCClient, scopes []string, now time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username":      user.UserName,
+		"user_id":       user.UserID,
+		"token_version": user.TokenVersion,
+		"iss":           c.userService.oidc.Issuer,
+		"sub":           strconv.FormatUint(user.UserID, 10),
+		"aud":           client.ClientID,
+		"client_id":     client.ClientID,
+		"scope":         strings.Join(scopes, " "),
+		"iat":           now.Unix(),
+		"exp":           now.Add(c.userService.oidc.TokenTTL).Unix(),
+	})
+	return token.SignedString(usertoken.OIDCKey(c.jwtSigningKey))
+}
+
+// idToken tells the client who signed in (OpenID Connect Core, section 2).
+// It is signed with ES256, so clients can verify it with the published key
+// and without the JWT secret, and booking and lease never accept it.
+func (c *HttpServer) idToken(user User, client OIDCClient, authCode AuthCode, now time.Time) (string, error) {
+	key, err := idTokenKey(c.jwtSigningKey)
+	if err != nil {
+		return "", err
+	}
+	publicKey, err := publicJWK(key)
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{
+		"iss":       c.userService.oidc.Issuer,
+		"sub":       strconv.FormatUint(user.UserID, 10),
+		"aud":       client.ClientID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(c.userService.oidc.TokenTTL).Unix(),
+		"auth_time": authCode.AuthTime.Unix(),
+	}
+	if authCode.Nonce != "" {
+		claims["nonce"] = authCode.Nonce
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = publicKey.Kid
+	return token.SignedString(key)
+}
+
+// userinfoResponse holds the standard claims of OpenID Connect Core, section
+// 5.1, that the granted scopes allow.
+type userinfoResponse struct {
+	Sub               string `json:"sub"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Name              string `json:"name,omitempty"`
+	Email             string `json:"email,omitempty"`
+}
+
+// userinfo is the UserInfo endpoint (OpenID Connect Core, section 5.3). It
+// takes the access token as a Bearer token. Tokens of /auth_user have no
+// scope claim and see every claim, like /me shows the whole profile.
+func (c *HttpServer) userinfo(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for userinfo")
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		rw.Header().Set("Allow", "GET, POST")
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		rw.Header().Set("WWW-Authenticate", `Bearer realm="auth"`)
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userAuth, claims, err := c.checkUserToken(token)
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		rw.Header().Set("WWW-Authenticate", `Bearer realm="auth", error="invalid_token"`)
+		c.writeOAuthError(rw, http.StatusUnauthorized, "invalid_token", err.Error())
+		return
+	}
+	scoped := usertoken.Scoped(claims)
+	scope, _ := claims["scope"].(string)
+	scopes := strings.Fields(scope)
+	if scoped && !containsScope(scopes, scopeOpenID) {
+		rw.Header().Set("WWW-Authenticate", `Bearer realm="auth", error="insufficient_scope", scope="openid"`)
+		c.writeOAuthError(rw, http.StatusForbidden, "insufficient_scope", "the token was not granted the openid scope")
+		return
+	}
+
+	profile, err := c.userService.profile(userAuth.Username)
+	if err != nil {
+		c.logger.Errorf("userinfo error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+	response := userinfoResponse{Sub: strconv.FormatUint(profile.UserID, 10)}
+	if !scoped || containsScope(scopes, scopeProfile) {
+		response.PreferredUsername = profile.Username
+		response.Name = profile.FullName
+	}
+	if !scoped || containsScope(scopes, scopeEmail) {
+		response.Email = profile.Email
+	}
+
+	responseBytes, err := json.Marshal(&response)
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("userinfo error: error writing response %v", err)
+	}
+}
+
+// openIDConfigurationResponse is the provider metadata of OpenID Connect
+// Discovery, section 3.
+type openIDConfigurationResponse struct {
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	UserinfoEndpoint                           string   `json:"userinfo_endpoint"`
+	JWKSURI                                    string   `json:"jwks_uri"`
+	RegistrationEndpoint                       string   `json:"registration_endpoint"`
+	ScopesSupported                            []string `json:"scopes_supported"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                            []string `json:"claims_supported"`
+	AuthorizationResponseISSParameterSupported bool     `json:"authorization_response_iss_parameter_supported"`
+}
+
+// openIDConfiguration is the discovery document. Endpoints are under the
+// configured issuer, which is the public URL of the service.
+func (c *HttpServer) openIDConfiguration(rw http.ResponseWriter, r *http.Request) {
+	issuer := c.userService.oidc.Issuer
+	c.writePublicJSON(rw, "openid configuration", &openIDConfigurationResponse{
+		Issuer:                                     issuer,
+		AuthorizationEndpoint:                      issuer + "/oauth/authorize",
+		TokenEndpoint:                              issuer + "/oauth/token",
+		UserinfoEndpoint:                           issuer + "/oauth/userinfo",
+		JWKSURI:                                    issuer + "/oauth/jwks",
+		RegistrationEndpoint:                       issuer + "/oauth/register",
+		ScopesSupported:                            oidcScopes,
+		ResponseTypesSupported:                     []string{"code"},
+		GrantTypesSupported:                        []string{"authorization_code", "client_credentials"},
+		SubjectTypesSupported:                      []string{"public"},
+		IDTokenSigningAlgValuesSupported:           []string{"ES256"},
+		TokenEndpointAuthMethodsSupported:          []string{authMethodBasic, authMethodPost, authMethodNone},
+		CodeChallengeMethodsSupported:              []string{"S256"},
+		ClaimsSupported:                            []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "preferred_username", "name", "email"},
+		AuthorizationResponseISSParameterSupported: true,
+	})
+}
+
+type jwksResponse struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwks publishes the key that verifies ID tokens (RFC 7517).
+func (c *HttpServer) jwks(rw http.ResponseWriter, r *http.Request) {
+	key, err := idTokenKey(c.jwtSigningKey)
+	if err != nil {
+		c.logger.Errorf("jwks error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+	publicKey, err := publicJWK(key)
+	if err != nil {
+		c.logger.Errorf("jwks error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+	c.writePublicJSON(rw, "jwks", &jwksResponse{Keys: []jwk{publicKey}})
+}
+
+// writePublicJSON writes a document every client may fetch and cache.
+func (c *HttpServer) writePublicJSON(rw http.ResponseWriter, name string, document interface{}) {
+	responseBytes, err := json.Marshal(document)
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "public, max-age=3600")
+	rw.Header().Set("Access-Control-Allow-Origin", "*")
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("%s error: error writing response %v", name, err)
 	}
 }
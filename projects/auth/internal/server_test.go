@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"distributed-rental/pkg/openapi/openapitest"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serve(handler http.Handler, method string, target string, body string) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rw
+}
+
+func TestMalformedBody(t *testing.T) {
+	server := NewHttpServer("", newTestUserService(systemClock{}), []byte("secret"), nil, zap.NewNop().Sugar())
+	for _, route := range []string{"/create_user", "/auth_user", "/v1/users", "/v1/sessions"} {
+		rw := serve(server.server.Handler, http.MethodPost, route, `{"username":`)
+		if rw.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", route, rw.Code)
+		}
+	}
+}
+
+func TestLegacyQueryCredentials(t *testing.T) {
+	server := NewHttpServer("", newTestUserService(systemClock{}), []byte("secret"), nil, zap.NewNop().Sugar())
+	rw := serve(server.server.Handler, http.MethodPost, "/create_user", `{"username":"alice","password":"correct horse"}`)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("create user: got %d %s", rw.Code, rw.Body)
+	}
+	rw = serve(server.server.Handler, http.MethodGet, "/auth_user", `{"username":"alice","password":"correct horse"}`)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("auth user with a body: got %d %s", rw.Code, rw.Body)
+	}
+	rw = serve(server.server.Handler, http.MethodGet, "/auth_user?username=alice&password=correct+horse", "")
+	if rw.Code == http.StatusOK {
+		t.Fatalf("auth user read the password from the URL: %s", rw.Body)
+	}
+}
+
+// TestOpenAPI fails when openapi.json was not regenerated after a change of
+// the v1 routes, or when the router does not serve them as documented.
+func TestOpenAPI(t *testing.T) {
+	openapitest.CheckFile(t, "../openapi.json", OpenAPI())
+	server := NewHttpServer("", newTestUserService(systemClock{}), []byte("secret"), nil, zap.NewNop().Sugar())
+	openapitest.CheckRoutes(t, server.server.Handler.(*http.ServeMux), OpenAPI())
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"distributed-rental/pkg/servicetoken"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+var serviceClientNotFound = errors.New("service client not found")
+var serviceClientAlreadyExists = errors.New("service client already exists")
+var invalidClientID = errors.New("client_id must not be empty or contain whitespace or ':'")
+var wrongClientSecret = errors.New("unknown client or wrong client secret")
+
+// invalidScope rejects a scope that is unknown or not granted to a client.
+type invalidScope string
+
+func (c invalidScope) Error() string {
+	return "invalid scope " + string(c)
+}
+
+// ServiceClient is a service allowed to get service tokens with the client
+// credentials grant. Only the SHA-256 of its secret is stored; the secret is
+// random and long, so a slow hash would add nothing.
+type ServiceClient struct {
+	ClientID   string    `json:"client_id"`
+	SecretHash string    `json:"-"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func hashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetServiceTokenTTL sets how long service tokens are valid.
+func (c *UserService) SetServiceTokenTTL(ttl time.Duration) {
+	c.serviceTokenTTL = ttl
+}
+
+// createServiceClient registers a client with the given scopes and returns it
+// with its secret, which is not kept and can not be shown again.
+func (c *UserService) createServiceClient(clientID string, scopes []string) (ServiceClient, string, error) {
+	if clientID == "" || strings.ContainsAny(clientID, ": \t\r\n") {
+		return ServiceClient{}, "", invalidClientID
+	}
+	if len(scopes) == 0 {
+		return ServiceClient{}, "", invalidScope("")
+	}
+	for _, scope := range scopes {
+		if !servicetoken.ValidScope(scope) {
+			return ServiceClient{}, "", invalidScope(scope)
+		}
+	}
+
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return ServiceClient{}, "", err
+	}
+	secret := hex.EncodeToString(buf)
+
+	scopes = append([]string{}, scopes...)
+	sort.Strings(scopes)
+	now := c.clock.Now()
+	client := ServiceClient{
+		ClientID:   clientID,
+		SecretHash: hashClientSecret(secret),
+		Scopes:     scopes,
+		CreatedAt:  now,
+	}
+	err = c.repository.CreateServiceClient(client)
+	if err != nil {
+		return ServiceClient{}, "", err
+	}
+	c.audit(AuditEvent{Time: now, Kind: auditServiceClientCreated, Username: clientID})
+	return client, secret, nil
+}
+
+func (c *UserService) listServiceClients() ([]ServiceClient, error) {
+	return c.repository.ListServiceClients()
+}
+
+// deleteServiceClient stops a client from getting new tokens. Tokens it
+// already has stay valid until they expire.
+func (c *UserService) deleteServiceClient(clientID string) error {
+	err := c.repository.DeleteServiceClient(clientID)
+	if err != nil {
+		return err
+	}
+	c.audit(AuditEvent{Time: c.clock.Now(), Kind: auditServiceClientDeleted, Username: clientID})
+	return nil
+}
+
+// authServiceClient checks the credentials of a client and narrows its
+// scopes to the requested ones, or grants all of them if none are requested.
+func (c *UserService) authServiceClient(clientID string, secret string, requested []string) (ServiceClient, error) {
+	client, err := c.repository.GetServiceClient(clientID)
+	if err == serviceClientNotFound {
+		return ServiceClient{}, wrongClientSecret
+	}
+	if err != nil {
+		return ServiceClient{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashClientSecret(secret)), []byte(client.SecretHash)) != 1 {
+		return ServiceClient{}, wrongClientSecret
+	}
+	if len(requested) == 0 {
+		return client, nil
+	}
+
+	granted := map[string]bool{}
+	for _, scope := range client.Scopes {
+		granted[scope] = true
+	}
+	scopes := []string{}
+	for _, scope := range requested {
+		if !granted[scope] {
+			return ServiceClient{}, invalidScope(scope)
+		}
+		scopes = append(scopes, scope)
+	}
+	client.Scopes = scopes
+	return client, nil
+}
@@ -0,0 +1,867 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	_ "modernc.org/sqlite"
+	"strings"
+	"time"
+)
+
+const userSchema = `
+CREATE TABLE IF NOT EXISTS users (
+	user_id                   INTEGER PRIMARY KEY,
+	user_name                 TEXT NOT NULL UNIQUE,
+	password_hash             TEXT NOT NULL,
+	token_version             INTEGER NOT NULL DEFAULT 0,
+	full_name                 TEXT NOT NULL DEFAULT '',
+	email                     TEXT NOT NULL DEFAULT '',
+	phone                     TEXT NOT NULL DEFAULT '',
+	date_of_birth             TEXT NOT NULL DEFAULT '',
+	driver_license            TEXT NOT NULL DEFAULT '',
+	disabled                  INTEGER NOT NULL DEFAULT 0,
+	driver_license_country    TEXT NOT NULL DEFAULT '',
+	driver_license_expires_on TEXT NOT NULL DEFAULT '',
+	license_status            TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS sequences (
+	name  TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS login_attempts (
+	key          TEXT PRIMARY KEY,
+	failures     INTEGER NOT NULL,
+	last_failure INTEGER NOT NULL,
+	locked_until INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS audit_log (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	time      INTEGER NOT NULL,
+	kind      TEXT NOT NULL,
+	user_name TEXT NOT NULL,
+	ip        TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS totp (
+	user_name      TEXT PRIMARY KEY,
+	secret         BLOB NOT NULL,
+	confirmed      INTEGER NOT NULL,
+	last_step      INTEGER NOT NULL,
+	recovery_codes TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS reset_tokens (
+	hash       TEXT PRIMARY KEY,
+	user_name  TEXT NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS data_jobs (
+	job_id      TEXT PRIMARY KEY,
+	kind        TEXT NOT NULL,
+	user_id     INTEGER NOT NULL,
+	status      TEXT NOT NULL,
+	steps       TEXT NOT NULL,
+	results     TEXT NOT NULL,
+	attempts    INTEGER NOT NULL,
+	error       TEXT NOT NULL,
+	next_run_at INTEGER NOT NULL,
+	created_at  INTEGER NOT NULL,
+	updated_at  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS data_jobs_user_id ON data_jobs (user_id);
+CREATE INDEX IF NOT EXISTS data_jobs_status ON data_jobs (status);
+CREATE TABLE IF NOT EXISTS service_clients (
+	client_id   TEXT PRIMARY KEY,
+	secret_hash TEXT NOT NULL,
+	scopes      TEXT NOT NULL,
+	created_at  INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS api_keys (
+	key_id       TEXT PRIMARY KEY,
+	user_id      INTEGER NOT NULL,
+	name         TEXT NOT NULL,
+	secret_hash  TEXT NOT NULL,
+	scopes       TEXT NOT NULL,
+	rate_limit   TEXT NOT NULL,
+	expires_at   INTEGER NOT NULL,
+	last_used_at INTEGER NOT NULL,
+	created_at   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS api_keys_user_id ON api_keys (user_id);
+CREATE TABLE IF NOT EXISTS oidc_clients (
+	client_id     TEXT PRIMARY KEY,
+	name          TEXT NOT NULL,
+	secret_hash   TEXT NOT NULL,
+	redirect_uris TEXT NOT NULL,
+	auth_method   TEXT NOT NULL,
+	created_at    INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS auth_codes (
+	hash           TEXT PRIMARY KEY,
+	client_id      TEXT NOT NULL,
+	redirect_uri   TEXT NOT NULL,
+	user_name      TEXT NOT NULL,
+	scopes         TEXT NOT NULL,
+	nonce          TEXT NOT NULL,
+	code_challenge TEXT NOT NULL,
+	auth_time      INTEGER NOT NULL,
+	expires_at     INTEGER NOT NULL
+);
+`
+
+// SQLiteUserRepository stores users in an embedded SQLite database.
+type SQLiteUserRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteUserRepository opens (and if needed creates) the database at path.
+func NewSQLiteUserRepository(path string) (*SQLiteUserRepository, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(userSchema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, column := range []struct{ name, definition string }{
+		{"token_version", "INTEGER NOT NULL DEFAULT 0"},
+		{"full_name", "TEXT NOT NULL DEFAULT ''"},
+		{"email", "TEXT NOT NULL DEFAULT ''"},
+		{"phone", "TEXT NOT NULL DEFAULT ''"},
+		{"date_of_birth", "TEXT NOT NULL DEFAULT ''"},
+		{"driver_license", "TEXT NOT NULL DEFAULT ''"},
+		{"disabled", "INTEGER NOT NULL DEFAULT 0"},
+		{"driver_license_country", "TEXT NOT NULL DEFAULT ''"},
+		{"driver_license_expires_on", "TEXT NOT NULL DEFAULT ''"},
+		{"license_status", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		err = addColumn(db, "users", column.name, column.definition)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	_, err = db.Exec(`DELETE FROM login_attempts WHERE key LIKE ?`, legacyUserAttemptsPrefix+"%")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteUserRepository{db: db}, nil
+}
+
+// addColumn adds a column to a table created before the column existed.
+func addColumn(db *sql.DB, table string, column string, definition string) error {
+	var found int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&found)
+	if err != nil || found > 0 {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
+func (c *SQLiteUserRepository) NextUserID() (uint64, error) {
+	var userID uint64
+	err := c.db.QueryRow(`INSERT INTO sequences (name, value) VALUES ('user_id', 1)
+		ON CONFLICT (name) DO UPDATE SET value = value + 1
+		RETURNING value`).Scan(&userID)
+	return userID, err
+}
+
+func (c *SQLiteUserRepository) CreateUser(user UserDBModel) error {
+	result, err := c.db.Exec(`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_name) DO NOTHING`,
+		user.UserID, user.UserName, user.PasswordHash, user.TokenVersion,
+		user.FullName, user.Email, user.Phone, user.DateOfBirth, user.DriverLicense, user.Disabled,
+		user.DriverLicenseCountry, user.DriverLicenseExpiresOn, user.LicenseStatus)
+	if err != nil {
+		return err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return userAlreadyExists
+	}
+	return nil
+}
+
+func (c *SQLiteUserRepository) GetUser(username string) (UserDBModel, error) {
+	return userSQL(c.db, username)
+}
+
+const userColumns = `user_id, user_name, password_hash, token_version,
+	full_name, email, phone, date_of_birth, driver_license, disabled,
+	driver_license_country, driver_license_expires_on, license_status`
+
+type sqlScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row sqlScanner) (UserDBModel, error) {
+	user := UserDBModel{}
+	err := row.Scan(&user.UserID, &user.UserName, &user.PasswordHash, &user.TokenVersion,
+		&user.FullName, &user.Email, &user.Phone, &user.DateOfBirth, &user.DriverLicense, &user.Disabled,
+		&user.DriverLicenseCountry, &user.DriverLicenseExpiresOn, &user.LicenseStatus)
+	return user, err
+}
+
+func userSQL(q sqlQuerier, username string) (UserDBModel, error) {
+	user, err := scanUser(q.QueryRow(`SELECT `+userColumns+` FROM users WHERE user_name = ?`, username))
+	if err == sql.ErrNoRows {
+		return UserDBModel{}, userNotFound
+	}
+	if err != nil {
+		return UserDBModel{}, err
+	}
+	return user, nil
+}
+
+func (c *SQLiteUserRepository) GetUserByID(userID uint64) (UserDBModel, error) {
+	user, err := scanUser(c.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE user_id = ?`, userID))
+	if err == sql.ErrNoRows {
+		return UserDBModel{}, userNotFound
+	}
+	if err != nil {
+		return UserDBModel{}, err
+	}
+	return user, nil
+}
+
+func (c *SQLiteUserRepository) ListUsers(from uint64, limit int, query string) ([]UserDBModel, error) {
+	rows, err := c.db.Query(`SELECT `+userColumns+` FROM users
+		WHERE user_id >= ?1 AND (instr(lower(user_name), lower(?2)) > 0 OR instr(lower(full_name), lower(?2)) > 0 OR instr(lower(email), lower(?2)) > 0)
+		ORDER BY user_id LIMIT ?3`, from, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []UserDBModel{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (c *SQLiteUserRepository) UpdateUser(username string, update func(user UserDBModel) (UserDBModel, error)) (UserDBModel, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return UserDBModel{}, err
+	}
+	defer tx.Rollback()
+
+	user, err := userSQL(tx, username)
+	if err != nil {
+		return UserDBModel{}, err
+	}
+	user, err = update(user)
+	if err != nil {
+		return UserDBModel{}, err
+	}
+	if user.UserName != username {
+		_, err = userSQL(tx, user.UserName)
+		if err == nil {
+			return UserDBModel{}, userAlreadyExists
+		}
+		if err != userNotFound {
+			return UserDBModel{}, err
+		}
+	}
+	_, err = tx.Exec(`UPDATE users SET user_name = ?, password_hash = ?, token_version = ?, full_name = ?, email = ?, phone = ?,
+		date_of_birth = ?, driver_license = ?, disabled = ?, driver_license_country = ?, driver_license_expires_on = ?,
+		license_status = ? WHERE user_name = ?`,
+		user.UserName, user.PasswordHash, user.TokenVersion, user.FullName, user.Email, user.Phone,
+		user.DateOfBirth, user.DriverLicense, user.Disabled, user.DriverLicenseCountry, user.DriverLicenseExpiresOn,
+		user.LicenseStatus, username)
+	if err != nil {
+		return UserDBModel{}, err
+	}
+	return user, tx.Commit()
+}
+
+func (c *SQLiteUserRepository) Close() error {
+	return c.db.Close()
+}
+
+func (c *SQLiteUserRepository) Attempts(key string) (Attempts, error) {
+	return attemptsSQL(c.db, key)
+}
+
+type sqlQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func attemptsSQL(q sqlQuerier, key string) (Attempts, error) {
+	var failures uint32
+	var lastFailure, lockedUntil int64
+	err := q.QueryRow(`SELECT failures, last_failure, locked_until FROM login_attempts WHERE key = ?`, key).
+		Scan(&failures, &lastFailure, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return Attempts{}, nil
+	}
+	if err != nil {
+		return Attempts{}, err
+	}
+	return Attempts{
+		Failures:    failures,
+		LastFailure: fromUnixNano(lastFailure),
+		LockedUntil: fromUnixNano(lockedUntil),
+	}, nil
+}
+
+func (c *SQLiteUserRepository) UpdateAttempts(key string, update func(Attempts) Attempts) (Attempts, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return Attempts{}, err
+	}
+	defer tx.Rollback()
+
+	attempts, err := attemptsSQL(tx, key)
+	if err != nil {
+		return Attempts{}, err
+	}
+	attempts = update(attempts)
+	_, err = tx.Exec(`INSERT INTO login_attempts (key, failures, last_failure, locked_until) VALUES (?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET failures = excluded.failures, last_failure = excluded.last_failure, locked_until = excluded.locked_until`,
+		key, attempts.Failures, unixNano(attempts.LastFailure), unixNano(attempts.LockedUntil))
+	if err != nil {
+		return Attempts{}, err
+	}
+	return attempts, tx.Commit()
+}
+
+func (c *SQLiteUserRepository) DeleteAttempts(key string) error {
+	_, err := c.db.Exec(`DELETE FROM login_attempts WHERE key = ?`, key)
+	return err
+}
+
+func (c *SQLiteUserRepository) AppendAudit(event AuditEvent) error {
+	_, err := c.db.Exec(`INSERT INTO audit_log (time, kind, user_name, ip) VALUES (?, ?, ?, ?)`,
+		unixNano(event.Time), event.Kind, event.Username, event.IP)
+	return err
+}
+
+func (c *SQLiteUserRepository) AuditLog(limit int) ([]AuditEvent, error) {
+	return auditSQL(c.db.Query(`SELECT time, kind, user_name, ip FROM audit_log ORDER BY id DESC LIMIT ?`, limit))
+}
+
+func (c *SQLiteUserRepository) UserAuditLog(username string) ([]AuditEvent, error) {
+	return auditSQL(c.db.Query(`SELECT time, kind, user_name, ip FROM audit_log WHERE user_name = ? ORDER BY id`, username))
+}
+
+func auditSQL(rows *sql.Rows, err error) ([]AuditEvent, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var eventTime int64
+		event := AuditEvent{}
+		err = rows.Scan(&eventTime, &event.Kind, &event.Username, &event.IP)
+		if err != nil {
+			return nil, err
+		}
+		event.Time = fromUnixNano(eventTime)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (c *SQLiteUserRepository) AnonymizeAudit(username string, replacement string) error {
+	_, err := c.db.Exec(`UPDATE audit_log SET user_name = ?, ip = '' WHERE user_name = ?`, replacement, username)
+	return err
+}
+
+func (c *SQLiteUserRepository) GetTOTP(username string) (TOTP, error) {
+	totp, found, err := totpSQL(c.db, username)
+	if err != nil {
+		return TOTP{}, err
+	}
+	if !found {
+		return TOTP{}, totpNotEnrolled
+	}
+	return totp, nil
+}
+
+// totpSQL reads a second factor. Recovery code hashes are stored comma separated.
+func totpSQL(q sqlQuerier, username string) (TOTP, bool, error) {
+	totp := TOTP{}
+	var recoveryCodes string
+	err := q.QueryRow(`SELECT secret, confirmed, last_step, recovery_codes FROM totp WHERE user_name = ?`, username).
+		Scan(&totp.Secret, &totp.Confirmed, &totp.LastStep, &recoveryCodes)
+	if err == sql.ErrNoRows {
+		return TOTP{}, false, nil
+	}
+	if err != nil {
+		return TOTP{}, false, err
+	}
+	if recoveryCodes != "" {
+		totp.RecoveryCodes = strings.Split(recoveryCodes, ",")
+	}
+	return totp, true, nil
+}
+
+func (c *SQLiteUserRepository) UpdateTOTP(username string, update func(totp TOTP, found bool) (TOTP, error)) (TOTP, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return TOTP{}, err
+	}
+	defer tx.Rollback()
+
+	totp, found, err := totpSQL(tx, username)
+	if err != nil {
+		return TOTP{}, err
+	}
+	totp, err = update(totp, found)
+	if err != nil {
+		return TOTP{}, err
+	}
+	_, err = tx.Exec(`INSERT INTO totp (user_name, secret, confirmed, last_step, recovery_codes) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_name) DO UPDATE SET secret = excluded.secret, confirmed = excluded.confirmed,
+			last_step = excluded.last_step, recovery_codes = excluded.recovery_codes`,
+		username, totp.Secret, totp.Confirmed, totp.LastStep, strings.Join(totp.RecoveryCodes, ","))
+	if err != nil {
+		return TOTP{}, err
+	}
+	return totp, tx.Commit()
+}
+
+func (c *SQLiteUserRepository) DeleteTOTP(username string) error {
+	_, err := c.db.Exec(`DELETE FROM totp WHERE user_name = ?`, username)
+	return err
+}
+
+// CreateResetToken also drops expired tokens, which are never taken.
+func (c *SQLiteUserRepository) CreateResetToken(hash string, token ResetToken) error {
+	_, err := c.db.Exec(`DELETE FROM reset_tokens WHERE expires_at <= ?`, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`INSERT INTO reset_tokens (hash, user_name, expires_at) VALUES (?, ?, ?)`,
+		hash, token.Username, unixNano(token.ExpiresAt))
+	return err
+}
+
+func (c *SQLiteUserRepository) TakeResetToken(hash string) (ResetToken, error) {
+	token := ResetToken{}
+	var expiresAt int64
+	err := c.db.QueryRow(`DELETE FROM reset_tokens WHERE hash = ? RETURNING user_name, expires_at`, hash).
+		Scan(&token.Username, &expiresAt)
+	if err == sql.ErrNoRows {
+		return ResetToken{}, resetTokenNotFound
+	}
+	if err != nil {
+		return ResetToken{}, err
+	}
+	token.ExpiresAt = fromUnixNano(expiresAt)
+	return token, nil
+}
+
+const dataJobColumns = `job_id, kind, user_id, status, steps, results, attempts, error, next_run_at, created_at, updated_at`
+
+// scanDataJob reads a job. Steps are stored comma separated and results as a
+// JSON object.
+func scanDataJob(row sqlScanner) (DataJob, error) {
+	job := DataJob{}
+	var steps, results string
+	var nextRunAt, createdAt, updatedAt int64
+	err := row.Scan(&job.JobID, &job.Kind, &job.UserID, &job.Status, &steps, &results, &job.Attempts, &job.Error,
+		&nextRunAt, &createdAt, &updatedAt)
+	if err != nil {
+		return DataJob{}, err
+	}
+	if steps != "" {
+		job.Steps = strings.Split(steps, ",")
+	}
+	err = json.Unmarshal([]byte(results), &job.Results)
+	if err != nil {
+		return DataJob{}, err
+	}
+	job.NextRunAt = fromUnixNano(nextRunAt)
+	job.CreatedAt = fromUnixNano(createdAt)
+	job.UpdatedAt = fromUnixNano(updatedAt)
+	return job, nil
+}
+
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func putDataJobSQL(q sqlExecer, job DataJob) error {
+	results, err := json.Marshal(job.Results)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT INTO data_jobs (`+dataJobColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (job_id) DO UPDATE SET status = excluded.status, results = excluded.results, attempts = excluded.attempts,
+			error = excluded.error, next_run_at = excluded.next_run_at, updated_at = excluded.updated_at`,
+		job.JobID, job.Kind, job.UserID, job.Status, strings.Join(job.Steps, ","), string(results), job.Attempts, job.Error,
+		unixNano(job.NextRunAt), unixNano(job.CreatedAt), unixNano(job.UpdatedAt))
+	return err
+}
+
+func dataJobSQL(q sqlQuerier, jobID string) (DataJob, error) {
+	job, err := scanDataJob(q.QueryRow(`SELECT `+dataJobColumns+` FROM data_jobs WHERE job_id = ?`, jobID))
+	if err == sql.ErrNoRows {
+		return DataJob{}, dataJobNotFound
+	}
+	if err != nil {
+		return DataJob{}, err
+	}
+	return job, nil
+}
+
+func (c *SQLiteUserRepository) CreateDataJob(job DataJob) error {
+	return putDataJobSQL(c.db, job)
+}
+
+func (c *SQLiteUserRepository) GetDataJob(jobID string) (DataJob, error) {
+	return dataJobSQL(c.db, jobID)
+}
+
+func (c *SQLiteUserRepository) UpdateDataJob(jobID string, update func(job DataJob) (DataJob, error)) (DataJob, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return DataJob{}, err
+	}
+	defer tx.Rollback()
+
+	job, err := dataJobSQL(tx, jobID)
+	if err != nil {
+		return DataJob{}, err
+	}
+	job, err = update(job)
+	if err != nil {
+		return DataJob{}, err
+	}
+	err = putDataJobSQL(tx, job)
+	if err != nil {
+		return DataJob{}, err
+	}
+	return job, tx.Commit()
+}
+
+func (c *SQLiteUserRepository) PendingDataJobs() ([]DataJob, error) {
+	return dataJobsSQL(c.db.Query(`SELECT `+dataJobColumns+` FROM data_jobs WHERE status = ? ORDER BY created_at`, dataJobPending))
+}
+
+func (c *SQLiteUserRepository) UserDataJobs(userID uint64) ([]DataJob, error) {
+	return dataJobsSQL(c.db.Query(`SELECT `+dataJobColumns+` FROM data_jobs WHERE user_id = ? ORDER BY created_at`, userID))
+}
+
+func dataJobsSQL(rows *sql.Rows, err error) ([]DataJob, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []DataJob{}
+	for rows.Next() {
+		job, err := scanDataJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (c *SQLiteUserRepository) DeleteDataJob(jobID string) error {
+	_, err := c.db.Exec(`DELETE FROM data_jobs WHERE job_id = ?`, jobID)
+	return err
+}
+
+func (c *SQLiteUserRepository) CreateServiceClient(client ServiceClient) error {
+	result, err := c.db.Exec(`INSERT INTO service_clients (client_id, secret_hash, scopes, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (client_id) DO NOTHING`,
+		client.ClientID, client.SecretHash, strings.Join(client.Scopes, " "), unixNano(client.CreatedAt))
+	if err != nil {
+		return err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return serviceClientAlreadyExists
+	}
+	return nil
+}
+
+// scanServiceClient reads a client. Scopes are stored space separated, as in
+// tokens.
+func scanServiceClient(row sqlScanner) (ServiceClient, error) {
+	client := ServiceClient{}
+	var scopes string
+	var createdAt int64
+	err := row.Scan(&client.ClientID, &client.SecretHash, &scopes, &createdAt)
+	if err != nil {
+		return ServiceClient{}, err
+	}
+	client.Scopes = strings.Fields(scopes)
+	client.CreatedAt = fromUnixNano(createdAt)
+	return client, nil
+}
+
+func (c *SQLiteUserRepository) GetServiceClient(clientID string) (ServiceClient, error) {
+	client, err := scanServiceClient(c.db.QueryRow(`SELECT client_id, secret_hash, scopes, created_at FROM service_clients WHERE client_id = ?`, clientID))
+	if err == sql.ErrNoRows {
+		return ServiceClient{}, serviceClientNotFound
+	}
+	if err != nil {
+		return ServiceClient{}, err
+	}
+	return client, nil
+}
+
+func (c *SQLiteUserRepository) ListServiceClients() ([]ServiceClient, error) {
+	rows, err := c.db.Query(`SELECT client_id, secret_hash, scopes, created_at FROM service_clients ORDER BY client_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []ServiceClient{}
+	for rows.Next() {
+		client, err := scanServiceClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+func (c *SQLiteUserRepository) DeleteServiceClient(clientID string) error {
+	result, err := c.db.Exec(`DELETE FROM service_clients WHERE client_id = ?`, clientID)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return serviceClientNotFound
+	}
+	return nil
+}
+
+const apiKeyColumns = `key_id, user_id, name, secret_hash, scopes, rate_limit, expires_at, last_used_at, created_at`
+
+// scanAPIKey reads a key. Scopes are stored space separated and a key never
+// used has a last_used_at of 0.
+func scanAPIKey(row sqlScanner) (APIKey, error) {
+	key := APIKey{}
+	var scopes string
+	var expiresAt, lastUsedAt, createdAt int64
+	err := row.Scan(&key.KeyID, &key.UserID, &key.Name, &key.SecretHash, &scopes, &key.RateLimit, &expiresAt, &lastUsedAt, &createdAt)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.ExpiresAt = fromUnixNano(expiresAt)
+	if lastUsedAt != 0 {
+		t := fromUnixNano(lastUsedAt)
+		key.LastUsedAt = &t
+	}
+	key.CreatedAt = fromUnixNano(createdAt)
+	return key, nil
+}
+
+func putAPIKeySQL(q sqlExecer, key APIKey) error {
+	var lastUsedAt int64
+	if key.LastUsedAt != nil {
+		lastUsedAt = unixNano(*key.LastUsedAt)
+	}
+	_, err := q.Exec(`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key_id) DO UPDATE SET name = excluded.name, scopes = excluded.scopes, rate_limit = excluded.rate_limit,
+			expires_at = excluded.expires_at, last_used_at = excluded.last_used_at`,
+		key.KeyID, key.UserID, key.Name, key.SecretHash, strings.Join(key.Scopes, " "), key.RateLimit,
+		unixNano(key.ExpiresAt), lastUsedAt, unixNano(key.CreatedAt))
+	return err
+}
+
+func apiKeySQL(q sqlQuerier, keyID string) (APIKey, error) {
+	key, err := scanAPIKey(q.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_id = ?`, keyID))
+	if err == sql.ErrNoRows {
+		return APIKey{}, apiKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+func (c *SQLiteUserRepository) CreateAPIKey(key APIKey) error {
+	return putAPIKeySQL(c.db, key)
+}
+
+func (c *SQLiteUserRepository) GetAPIKey(keyID string) (APIKey, error) {
+	return apiKeySQL(c.db, keyID)
+}
+
+func (c *SQLiteUserRepository) UpdateAPIKey(keyID string, update func(key APIKey) (APIKey, error)) (APIKey, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return APIKey{}, err
+	}
+	defer tx.Rollback()
+
+	key, err := apiKeySQL(tx, keyID)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key, err = update(key)
+	if err != nil {
+		return APIKey{}, err
+	}
+	err = putAPIKeySQL(tx, key)
+	if err != nil {
+		return APIKey{}, err
+	}
+	return key, tx.Commit()
+}
+
+func (c *SQLiteUserRepository) UserAPIKeys(userID uint64) ([]APIKey, error) {
+	rows, err := c.db.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (c *SQLiteUserRepository) DeleteAPIKey(keyID string) error {
+	result, err := c.db.Exec(`DELETE FROM api_keys WHERE key_id = ?`, keyID)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return apiKeyNotFound
+	}
+	return nil
+}
+
+const oidcClientColumns = `client_id, name, secret_hash, redirect_uris, auth_method, created_at`
+
+// scanOIDCClient reads a client. Redirect URIs are stored space separated;
+// valid ones contain no spaces.
+func scanOIDCClient(row sqlScanner) (OIDCClient, error) {
+	client := OIDCClient{}
+	var redirectURIs string
+	var createdAt int64
+	err := row.Scan(&client.ClientID, &client.Name, &client.SecretHash, &redirectURIs, &client.TokenEndpointAuthMethod, &createdAt)
+	if err != nil {
+		return OIDCClient{}, err
+	}
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	client.CreatedAt = fromUnixNano(createdAt)
+	return client, nil
+}
+
+func (c *SQLiteUserRepository) CreateOIDCClient(client OIDCClient) error {
+	_, err := c.db.Exec(`INSERT INTO oidc_clients (`+oidcClientColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		client.ClientID, client.Name, client.SecretHash, strings.Join(client.RedirectURIs, " "), client.TokenEndpointAuthMethod,
+		unixNano(client.CreatedAt))
+	return err
+}
+
+func (c *SQLiteUserRepository) GetOIDCClient(clientID string) (OIDCClient, error) {
+	client, err := scanOIDCClient(c.db.QueryRow(`SELECT `+oidcClientColumns+` FROM oidc_clients WHERE client_id = ?`, clientID))
+	if err == sql.ErrNoRows {
+		return OIDCClient{}, oidcClientNotFound
+	}
+	if err != nil {
+		return OIDCClient{}, err
+	}
+	return client, nil
+}
+
+func (c *SQLiteUserRepository) ListOIDCClients() ([]OIDCClient, error) {
+	rows, err := c.db.Query(`SELECT ` + oidcClientColumns + ` FROM oidc_clients ORDER BY client_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []OIDCClient{}
+	for rows.Next() {
+		client, err := scanOIDCClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+func (c *SQLiteUserRepository) DeleteOIDCClient(clientID string) error {
+	result, err := c.db.Exec(`DELETE FROM oidc_clients WHERE client_id = ?`, clientID)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return oidcClientNotFound
+	}
+	return nil
+}
+
+// CreateAuthCode also drops expired codes, which are never taken.
+func (c *SQLiteUserRepository) CreateAuthCode(hash string, code AuthCode) error {
+	_, err := c.db.Exec(`DELETE FROM auth_codes WHERE expires_at <= ?`, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`INSERT INTO auth_codes (hash, client_id, redirect_uri, user_name, scopes, nonce, code_challenge, auth_time, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		hash, code.ClientID, code.RedirectURI, code.Username, strings.Join(code.Scopes, " "), code.Nonce, code.CodeChallenge,
+		unixNano(code.AuthTime), unixNano(code.ExpiresAt))
+	return err
+}
+
+func (c *SQLiteUserRepository) TakeAuthCode(hash string) (AuthCode, error) {
+	code := AuthCode{}
+	var scopes string
+	var authTime, expiresAt int64
+	err := c.db.QueryRow(`DELETE FROM auth_codes WHERE hash = ?
+		RETURNING client_id, redirect_uri, user_name, scopes, nonce, code_challenge, auth_time, expires_at`, hash).
+		Scan(&code.ClientID, &code.RedirectURI, &code.Username, &scopes, &code.Nonce, &code.CodeChallenge, &authTime, &expiresAt)
+	if err == sql.ErrNoRows {
+		return AuthCode{}, authCodeNotFound
+	}
+	if err != nil {
+		return AuthCode{}, err
+	}
+	code.Scopes = strings.Fields(scopes)
+	code.AuthTime = fromUnixNano(authTime)
+	code.ExpiresAt = fromUnixNano(expiresAt)
+	return code, nil
+}
@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var totpNotEnrolled = errors.New("two-factor authentication is not enrolled")
+var totpAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+var wrongCode = errors.New("wrong code")
+
+// TOTP parameters of RFC 6238 as understood by authenticator apps.
+const (
+	totpPeriod      = 30 * time.Second
+	totpDigits      = 6
+	totpSecretSize  = 20
+	totpSkew        = 1
+	recoveryCodes   = 10
+	recoveryCodeLen = 10
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPOptions configures two-factor authentication.
+type TOTPOptions struct {
+	Issuer       string        `yaml:"issuer" usage:"issuer shown by authenticator apps"`
+	ChallengeTTL time.Duration `yaml:"challenge_ttl" usage:"time to enter the code after the password"`
+}
+
+// TOTP is the second factor of a user. It only guards logins once Confirmed.
+// LastStep is the time step of the last accepted code, which can not be used
+// again. RecoveryCodes are sha256 hashes; a used code is removed.
+type TOTP struct {
+	Secret        []byte
+	Confirmed     bool
+	LastStep      uint64
+	RecoveryCodes []string
+}
+
+// TOTPEnrollment is shown to the user once, when the secret is created.
+type TOTPEnrollment struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func totpStep(t time.Time) uint64 {
+	return uint64(t.Unix() / int64(totpPeriod/time.Second))
+}
+
+// totpCode computes the HOTP value of RFC 4226 for step.
+func totpCode(secret []byte, step uint64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], step)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+// checkCode accepts a code of the current step or of totpSkew steps around it
+// that is newer than the last accepted one, and records its step.
+func (c *TOTP) checkCode(code string, now time.Time) bool {
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= c.LastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(c.Secret, step)), []byte(code)) == 1 {
+			c.LastStep = step
+			return true
+		}
+	}
+	return false
+}
+
+// useRecoveryCode removes code from the unused recovery codes if it is one.
+func (c *TOTP) useRecoveryCode(code string) bool {
+	hash := hashRecoveryCode(code)
+	for i, stored := range c.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			c.RecoveryCodes = append(c.RecoveryCodes[:i:i], c.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// hashRecoveryCode ignores case, spaces and dashes so that a code can be typed
+// as it was shown.
+func hashRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, recoveryCodeLen)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	code := base32NoPadding.EncodeToString(buf)[:recoveryCodeLen]
+	return code[:recoveryCodeLen/2] + "-" + code[recoveryCodeLen/2:], nil
+}
+
+func (c TOTPOptions) uri(username string, secret []byte) string {
+	label := url.PathEscape(c.Issuer) + ":" + url.PathEscape(username)
+	query := url.Values{}
+	query.Set("secret", base32NoPadding.EncodeToString(secret))
+	query.Set("issuer", c.Issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod/time.Second)))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// enrollTOTP creates a new unconfirmed secret and recovery codes for username,
+// replacing an unconfirmed one. It fails if two-factor authentication is
+// already enabled.
+func (c *UserService) enrollTOTP(username string) (TOTPEnrollment, error) {
+	secret := make([]byte, totpSecretSize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	enrollment := TOTPEnrollment{
+		Secret: base32NoPadding.EncodeToString(secret),
+		URI:    c.totp.uri(username, secret),
+	}
+	totp := TOTP{Secret: secret}
+	for i := 0; i < recoveryCodes; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return TOTPEnrollment{}, err
+		}
+		enrollment.RecoveryCodes = append(enrollment.RecoveryCodes, code)
+		totp.RecoveryCodes = append(totp.RecoveryCodes, hashRecoveryCode(code))
+	}
+
+	_, err = c.repository.UpdateTOTP(username, func(current TOTP, found bool) (TOTP, error) {
+		if found && current.Confirmed {
+			return TOTP{}, totpAlreadyEnabled
+		}
+		return totp, nil
+	})
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	return enrollment, nil
+}
+
+// confirmTOTP enables two-factor authentication once the user proves the
+// authenticator app produces the right codes.
+func (c *UserService) confirmTOTP(username string, code string) error {
+	now := c.clock.Now()
+	_, err := c.repository.UpdateTOTP(username, func(totp TOTP, found bool) (TOTP, error) {
+		if !found {
+			return TOTP{}, totpNotEnrolled
+		}
+		if totp.Confirmed {
+			return TOTP{}, totpAlreadyEnabled
+		}
+		if !totp.checkCode(code, now) {
+			return TOTP{}, wrongCode
+		}
+		totp.Confirmed = true
+		return totp, nil
+	})
+	if err != nil {
+		return err
+	}
+	c.audit(AuditEvent{Time: now, Kind: auditTOTPEnabled, Username: username})
+	return nil
+}
+
+// disableTOTP removes the second factor given a current code or a recovery code.
+func (c *UserService) disableTOTP(username string, code string) error {
+	err := c.checkTOTP(username, code)
+	if err != nil {
+		return err
+	}
+	err = c.repository.DeleteTOTP(username)
+	if err != nil {
+		return err
+	}
+	c.audit(AuditEvent{Time: c.clock.Now(), Kind: auditTOTPDisabled, Username: username})
+	return nil
+}
+
+// totpRequired reports whether logins of username need a second step.
+func (c *UserService) totpRequired(username string) (bool, error) {
+	totp, err := c.repository.GetTOTP(username)
+	if err == totpNotEnrolled {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.Confirmed, nil
+}
+
+// completeTOTP is the second step of a login. Wrong codes count as failed
+// logins of the username and the client address.
+func (c *UserService) completeTOTP(username string, code string, ip string) (User, error) {
+	now := c.clock.Now()
+	userDBModel, err := c.repository.GetUser(username)
+	if err != nil {
+		return User{}, err
+	}
+	userKey, ipKey := userAttemptsKey(userDBModel.UserID), ipAttemptsKey(ip)
+
+	err = c.checkAttempts(userKey, c.userPolicy, now)
+	if err == nil {
+		err = c.checkAttempts(ipKey, c.ipPolicy, now)
+	}
+	if err != nil {
+		if _, ok := err.(*tooManyAttempts); ok {
+			c.audit(AuditEvent{Time: now, Kind: auditLoginThrottled, Username: username, IP: ip})
+		}
+		return User{}, err
+	}
+
+	err = c.checkTOTP(username, code)
+	if err == wrongCode {
+		c.audit(AuditEvent{Time: now, Kind: auditTOTPFailed, Username: username, IP: ip})
+		failErr := c.recordFailure(userKey, c.userPolicy, now, AuditEvent{Time: now, Kind: auditLocked, Username: username})
+		if failErr == nil {
+			failErr = c.recordFailure(ipKey, c.ipPolicy, now, AuditEvent{Time: now, Kind: auditLocked, IP: ip})
+		}
+		if failErr != nil {
+			return User{}, failErr
+		}
+		return User{}, wrongCode
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	if userDBModel.Disabled {
+		return User{}, userDisabled
+	}
+	err = c.repository.DeleteAttempts(userKey)
+	if err != nil {
+		return User{}, err
+	}
+	return User{
+		UserID:       userDBModel.UserID,
+		UserName:     userDBModel.UserName,
+		TokenVersion: userDBModel.TokenVersion,
+	}, nil
+}
+
+// checkTOTP accepts a current code or uses up a recovery code of an enabled
+// second factor.
+func (c *UserService) checkTOTP(username string, code string) error {
+	now := c.clock.Now()
+	recoveryCodeUsed := false
+	_, err := c.repository.UpdateTOTP(username, func(totp TOTP, found bool) (TOTP, error) {
+		if !found || !totp.Confirmed {
+			return TOTP{}, totpNotEnrolled
+		}
+		if totp.checkCode(code, now) {
+			return totp, nil
+		}
+		if totp.useRecoveryCode(code) {
+			recoveryCodeUsed = true
+			return totp, nil
+		}
+		return TOTP{}, wrongCode
+	})
+	if err != nil {
+		return err
+	}
+	if recoveryCodeUsed {
+		c.audit(AuditEvent{Time: now, Kind: auditRecoveryCodeUsed, Username: username})
+	}
+	return nil
+}
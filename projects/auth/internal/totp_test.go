@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCheckCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111109, 0)
+	step := totpStep(now)
+
+	for offset, valid := range map[int]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		totp := TOTP{Secret: secret}
+		code := totpCode(secret, uint64(int(step)+offset))
+		if totp.checkCode(code, now) != valid {
+			t.Errorf("step %+d: got %v, want %v", offset, !valid, valid)
+		}
+		if valid && totp.LastStep != uint64(int(step)+offset) {
+			t.Errorf("step %+d: got last step %d", offset, totp.LastStep)
+		}
+	}
+
+	// RFC 6238 test vector for SHA1 at 1111111109, truncated to six digits.
+	if code := totpCode(secret, step); code != "081804" {
+		t.Fatalf("got code %s, want 081804", code)
+	}
+}
+
+func TestTOTPReplay(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1_000_000_020, 0)
+	step := totpStep(now)
+	totp := TOTP{Secret: secret}
+
+	if !totp.checkCode(totpCode(secret, step), now) {
+		t.Fatal("current code rejected")
+	}
+	if totp.checkCode(totpCode(secret, step), now) {
+		t.Fatal("a code was accepted twice")
+	}
+	// A code of an earlier step is still within the skew but older than the
+	// last accepted one.
+	if totp.checkCode(totpCode(secret, step-1), now) {
+		t.Fatal("an older code was accepted after a newer one")
+	}
+	if !totp.checkCode(totpCode(secret, step+1), now) {
+		t.Fatal("the next code rejected")
+	}
+	if totp.LastStep != step+1 {
+		t.Fatalf("got last step %d, want %d", totp.LastStep, step+1)
+	}
+}
+
+// enableTOTP enrolls and confirms the second factor of username and returns
+// its secret and recovery codes.
+func enableTOTP(t *testing.T, userService *UserService, username string) ([]byte, []string) {
+	t.Helper()
+	enrollment, err := userService.enrollTOTP(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := base32NoPadding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = userService.confirmTOTP(username, totpCode(secret, totpStep(userService.clock.Now())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret, enrollment.RecoveryCodes
+}
+
+func TestTOTPRecoveryCodes(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	userService := newTestUserService(clock)
+	_, err := userService.createUser("alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, codes := enableTOTP(t, userService, "alice")
+	if len(codes) != recoveryCodes {
+		t.Fatalf("got %d recovery codes", len(codes))
+	}
+
+	// Codes are accepted however they are typed, once.
+	typed := strings.ToLower(strings.Replace(codes[3], "-", " ", 1))
+	err = userService.checkTOTP("alice", typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = userService.checkTOTP("alice", codes[3])
+	if err != wrongCode {
+		t.Fatalf("used recovery code: got %v, want %v", err, wrongCode)
+	}
+	err = userService.checkTOTP("alice", codes[4])
+	if err != nil {
+		t.Fatalf("another recovery code: got %v", err)
+	}
+	totp, err := userService.repository.GetTOTP("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(totp.RecoveryCodes) != len(codes)-2 {
+		t.Fatalf("got %d unused recovery codes, want %d", len(totp.RecoveryCodes), len(codes)-2)
+	}
+
+	events, err := userService.auditLog(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := 0
+	for _, event := range events {
+		if event.Kind == auditRecoveryCodeUsed {
+			used++
+		}
+	}
+	if used != 2 {
+		t.Fatalf("got %d recovery code audit events, want 2", used)
+	}
+}
+
+// TestTOTPChallenge logs alice in with a password and a code through the
+// handlers.
+func TestTOTPChallenge(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	userService := newTestUserService(clock)
+	server := NewHttpServer("", userService, []byte("secret"), nil, zap.NewNop().Sugar())
+	_, err := userService.createUser("alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := enableTOTP(t, userService, "alice")
+	password := "correct horse"
+
+	challenge := func() string {
+		t.Helper()
+		rw := serve(server.server.Handler, http.MethodPost, "/auth_user", `{"username": "alice", "password": "`+password+`"}`)
+		var response authUserResponse
+		err := json.Unmarshal(rw.Body.Bytes(), &response)
+		if rw.Code != 200 || err != nil || !response.TOTPRequired || response.Challenge == "" || response.Token != "" {
+			t.Fatalf("auth user: got %d %s", rw.Code, rw.Body)
+		}
+		return response.Challenge
+	}
+	// complete returns the status of /auth_totp and the token on success.
+	complete := func(challenge string, code string) (int, string) {
+		t.Helper()
+		rw := serve(server.server.Handler, http.MethodPost, "/auth_totp", `{"challenge": "`+challenge+`", "code": "`+code+`"}`)
+		if rw.Code != 200 {
+			return rw.Code, ""
+		}
+		var response authUserResponse
+		err := json.Unmarshal(rw.Body.Bytes(), &response)
+		if err != nil || response.Token == "" {
+			t.Fatalf("auth totp: got %s", rw.Body)
+		}
+		return rw.Code, response.Token
+	}
+	code := func() string {
+		return totpCode(secret, totpStep(clock.Now()))
+	}
+
+	// The code confirming the enrollment was used up.
+	if status, _ := complete(challenge(), code()); status != 400 {
+		t.Fatalf("the confirmation code again: got %d, want 400", status)
+	}
+	clock.advance(totpPeriod)
+	status, token := complete(challenge(), code())
+	if status != 200 {
+		t.Fatalf("a valid code: got %d", status)
+	}
+	if _, err := server.checkAuth(token); err != nil {
+		t.Fatalf("the token does not work: %v", err)
+	}
+
+	// A challenge is good for totp.challenge_ttl.
+	clock.advance(totpPeriod)
+	expiring := challenge()
+	clock.advance(time.Minute + time.Second)
+	if status, _ := complete(expiring, code()); status != http.StatusUnauthorized {
+		t.Fatalf("an expired challenge: got %d, want 401", status)
+	}
+	if status, _ := complete(challenge(), code()); status != 200 {
+		t.Fatalf("a fresh challenge: got %d", status)
+	}
+
+	// Changing the password invalidates a pending challenge.
+	clock.advance(totpPeriod)
+	pending := challenge()
+	password = "battery staple"
+	_, err = userService.changePassword("alice", "correct horse", password, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := complete(pending, code()); status != http.StatusUnauthorized {
+		t.Fatalf("a challenge from before the password change: got %d, want 401", status)
+	}
+	if status, _ := complete(challenge(), code()); status != 200 {
+		t.Fatalf("a challenge after the password change: got %d", status)
+	}
+
+	// A challenge is not an access token.
+	if _, err := server.checkAuth(challenge()); err == nil {
+		t.Fatal("a challenge was accepted as an access token")
+	}
+}
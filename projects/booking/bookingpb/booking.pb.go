@@ -0,0 +1,1099 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.29.3
+// source: booking.proto
+
+package bookingpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Booking struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	CarId           uint64                 `protobuf:"varint,1,opt,name=car_id,json=carId,proto3" json:"car_id,omitempty"`
+	UserId          uint64                 `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	BookingId       uint64                 `protobuf:"varint,3,opt,name=booking_id,json=bookingId,proto3" json:"booking_id,omitempty"`
+	FromDay         uint64                 `protobuf:"varint,4,opt,name=from_day,json=fromDay,proto3" json:"from_day,omitempty"`
+	ToDay           uint64                 `protobuf:"varint,5,opt,name=to_day,json=toDay,proto3" json:"to_day,omitempty"`
+	FromMinute      uint64                 `protobuf:"varint,6,opt,name=from_minute,json=fromMinute,proto3" json:"from_minute,omitempty"`
+	ToMinute        uint64                 `protobuf:"varint,7,opt,name=to_minute,json=toMinute,proto3" json:"to_minute,omitempty"`
+	PickupLocation  string                 `protobuf:"bytes,8,opt,name=pickup_location,json=pickupLocation,proto3" json:"pickup_location,omitempty"`
+	ReturnLocation  string                 `protobuf:"bytes,9,opt,name=return_location,json=returnLocation,proto3" json:"return_location,omitempty"`
+	OneWaySurcharge uint64                 `protobuf:"varint,10,opt,name=one_way_surcharge,json=oneWaySurcharge,proto3" json:"one_way_surcharge,omitempty"`
+	// status is upcoming, active or completed.
+	Status        string `protobuf:"bytes,11,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Booking) Reset() {
+	*x = Booking{}
+	mi := &file_booking_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Booking) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Booking) ProtoMessage() {}
+
+func (x *Booking) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Booking.ProtoReflect.Descriptor instead.
+func (*Booking) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Booking) GetCarId() uint64 {
+	if x != nil {
+		return x.CarId
+	}
+	return 0
+}
+
+func (x *Booking) GetUserId() uint64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *Booking) GetBookingId() uint64 {
+	if x != nil {
+		return x.BookingId
+	}
+	return 0
+}
+
+func (x *Booking) GetFromDay() uint64 {
+	if x != nil {
+		return x.FromDay
+	}
+	return 0
+}
+
+func (x *Booking) GetToDay() uint64 {
+	if x != nil {
+		return x.ToDay
+	}
+	return 0
+}
+
+func (x *Booking) GetFromMinute() uint64 {
+	if x != nil {
+		return x.FromMinute
+	}
+	return 0
+}
+
+func (x *Booking) GetToMinute() uint64 {
+	if x != nil {
+		return x.ToMinute
+	}
+	return 0
+}
+
+func (x *Booking) GetPickupLocation() string {
+	if x != nil {
+		return x.PickupLocation
+	}
+	return ""
+}
+
+func (x *Booking) GetReturnLocation() string {
+	if x != nil {
+		return x.ReturnLocation
+	}
+	return ""
+}
+
+func (x *Booking) GetOneWaySurcharge() uint64 {
+	if x != nil {
+		return x.OneWaySurcharge
+	}
+	return 0
+}
+
+func (x *Booking) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+// CreateBookingRequest names the interval like the REST API: from and to take
+// precedence over the minute fields, which take precedence over the days.
+type CreateBookingRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	CarId          uint64                 `protobuf:"varint,1,opt,name=car_id,json=carId,proto3" json:"car_id,omitempty"`
+	FromDay        uint64                 `protobuf:"varint,2,opt,name=from_day,json=fromDay,proto3" json:"from_day,omitempty"`
+	ToDay          uint64                 `protobuf:"varint,3,opt,name=to_day,json=toDay,proto3" json:"to_day,omitempty"`
+	FromMinute     uint64                 `protobuf:"varint,4,opt,name=from_minute,json=fromMinute,proto3" json:"from_minute,omitempty"`
+	ToMinute       uint64                 `protobuf:"varint,5,opt,name=to_minute,json=toMinute,proto3" json:"to_minute,omitempty"`
+	From           *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=from,proto3" json:"from,omitempty"`
+	To             *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=to,proto3" json:"to,omitempty"`
+	PickupLocation string                 `protobuf:"bytes,8,opt,name=pickup_location,json=pickupLocation,proto3" json:"pickup_location,omitempty"`
+	ReturnLocation string                 `protobuf:"bytes,9,opt,name=return_location,json=returnLocation,proto3" json:"return_location,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *CreateBookingRequest) Reset() {
+	*x = CreateBookingRequest{}
+	mi := &file_booking_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateBookingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateBookingRequest) ProtoMessage() {}
+
+func (x *CreateBookingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateBookingRequest.ProtoReflect.Descriptor instead.
+func (*CreateBookingRequest) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CreateBookingRequest) GetCarId() uint64 {
+	if x != nil {
+		return x.CarId
+	}
+	return 0
+}
+
+func (x *CreateBookingRequest) GetFromDay() uint64 {
+	if x != nil {
+		return x.FromDay
+	}
+	return 0
+}
+
+func (x *CreateBookingRequest) GetToDay() uint64 {
+	if x != nil {
+		return x.ToDay
+	}
+	return 0
+}
+
+func (x *CreateBookingRequest) GetFromMinute() uint64 {
+	if x != nil {
+		return x.FromMinute
+	}
+	return 0
+}
+
+func (x *CreateBookingRequest) GetToMinute() uint64 {
+	if x != nil {
+		return x.ToMinute
+	}
+	return 0
+}
+
+func (x *CreateBookingRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *CreateBookingRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+func (x *CreateBookingRequest) GetPickupLocation() string {
+	if x != nil {
+		return x.PickupLocation
+	}
+	return ""
+}
+
+func (x *CreateBookingRequest) GetReturnLocation() string {
+	if x != nil {
+		return x.ReturnLocation
+	}
+	return ""
+}
+
+type GetBookingRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BookingId     uint64                 `protobuf:"varint,1,opt,name=booking_id,json=bookingId,proto3" json:"booking_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBookingRequest) Reset() {
+	*x = GetBookingRequest{}
+	mi := &file_booking_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBookingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBookingRequest) ProtoMessage() {}
+
+func (x *GetBookingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBookingRequest.ProtoReflect.Descriptor instead.
+func (*GetBookingRequest) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetBookingRequest) GetBookingId() uint64 {
+	if x != nil {
+		return x.BookingId
+	}
+	return 0
+}
+
+// MyBookingsRequest pages through the bookings by id: the next page starts at
+// the next_cursor of the previous one, the first has none. status keeps
+// upcoming, active or completed bookings; from and to keep those overlapping
+// the times, either of which may be left out.
+type MyBookingsRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Cursor *uint64                `protobuf:"varint,1,opt,name=cursor,proto3,oneof" json:"cursor,omitempty"`
+	// limit is at most 100, which it also defaults to.
+	Limit         int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	Status        string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	From          *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=from,proto3" json:"from,omitempty"`
+	To            *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=to,proto3" json:"to,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MyBookingsRequest) Reset() {
+	*x = MyBookingsRequest{}
+	mi := &file_booking_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MyBookingsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MyBookingsRequest) ProtoMessage() {}
+
+func (x *MyBookingsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MyBookingsRequest.ProtoReflect.Descriptor instead.
+func (*MyBookingsRequest) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MyBookingsRequest) GetCursor() uint64 {
+	if x != nil && x.Cursor != nil {
+		return *x.Cursor
+	}
+	return 0
+}
+
+func (x *MyBookingsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *MyBookingsRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *MyBookingsRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *MyBookingsRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+type BookingPage struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Bookings []*Booking             `protobuf:"bytes,1,rep,name=bookings,proto3" json:"bookings,omitempty"`
+	// next_cursor is unset on the last page.
+	NextCursor    *uint64 `protobuf:"varint,2,opt,name=next_cursor,json=nextCursor,proto3,oneof" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BookingPage) Reset() {
+	*x = BookingPage{}
+	mi := &file_booking_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BookingPage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BookingPage) ProtoMessage() {}
+
+func (x *BookingPage) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BookingPage.ProtoReflect.Descriptor instead.
+func (*BookingPage) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BookingPage) GetBookings() []*Booking {
+	if x != nil {
+		return x.Bookings
+	}
+	return nil
+}
+
+func (x *BookingPage) GetNextCursor() uint64 {
+	if x != nil && x.NextCursor != nil {
+		return *x.NextCursor
+	}
+	return 0
+}
+
+// CheckCarRequest names the interval like CreateBookingRequest.
+type CheckCarRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	CarId          uint64                 `protobuf:"varint,1,opt,name=car_id,json=carId,proto3" json:"car_id,omitempty"`
+	FromDay        uint64                 `protobuf:"varint,2,opt,name=from_day,json=fromDay,proto3" json:"from_day,omitempty"`
+	ToDay          uint64                 `protobuf:"varint,3,opt,name=to_day,json=toDay,proto3" json:"to_day,omitempty"`
+	FromMinute     uint64                 `protobuf:"varint,4,opt,name=from_minute,json=fromMinute,proto3" json:"from_minute,omitempty"`
+	ToMinute       uint64                 `protobuf:"varint,5,opt,name=to_minute,json=toMinute,proto3" json:"to_minute,omitempty"`
+	From           *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=from,proto3" json:"from,omitempty"`
+	To             *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=to,proto3" json:"to,omitempty"`
+	PickupLocation string                 `protobuf:"bytes,8,opt,name=pickup_location,json=pickupLocation,proto3" json:"pickup_location,omitempty"`
+	ReturnLocation string                 `protobuf:"bytes,9,opt,name=return_location,json=returnLocation,proto3" json:"return_location,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *CheckCarRequest) Reset() {
+	*x = CheckCarRequest{}
+	mi := &file_booking_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckCarRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckCarRequest) ProtoMessage() {}
+
+func (x *CheckCarRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckCarRequest.ProtoReflect.Descriptor instead.
+func (*CheckCarRequest) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CheckCarRequest) GetCarId() uint64 {
+	if x != nil {
+		return x.CarId
+	}
+	return 0
+}
+
+func (x *CheckCarRequest) GetFromDay() uint64 {
+	if x != nil {
+		return x.FromDay
+	}
+	return 0
+}
+
+func (x *CheckCarRequest) GetToDay() uint64 {
+	if x != nil {
+		return x.ToDay
+	}
+	return 0
+}
+
+func (x *CheckCarRequest) GetFromMinute() uint64 {
+	if x != nil {
+		return x.FromMinute
+	}
+	return 0
+}
+
+func (x *CheckCarRequest) GetToMinute() uint64 {
+	if x != nil {
+		return x.ToMinute
+	}
+	return 0
+}
+
+func (x *CheckCarRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *CheckCarRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+func (x *CheckCarRequest) GetPickupLocation() string {
+	if x != nil {
+		return x.PickupLocation
+	}
+	return ""
+}
+
+func (x *CheckCarRequest) GetReturnLocation() string {
+	if x != nil {
+		return x.ReturnLocation
+	}
+	return ""
+}
+
+type CheckCarResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IsFree        bool                   `protobuf:"varint,1,opt,name=is_free,json=isFree,proto3" json:"is_free,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckCarResponse) Reset() {
+	*x = CheckCarResponse{}
+	mi := &file_booking_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckCarResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckCarResponse) ProtoMessage() {}
+
+func (x *CheckCarResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckCarResponse.ProtoReflect.Descriptor instead.
+func (*CheckCarResponse) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CheckCarResponse) GetIsFree() bool {
+	if x != nil {
+		return x.IsFree
+	}
+	return false
+}
+
+type AvailabilityChange struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	IsFree bool                   `protobuf:"varint,1,opt,name=is_free,json=isFree,proto3" json:"is_free,omitempty"`
+	// time is when the service saw the change.
+	Time          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AvailabilityChange) Reset() {
+	*x = AvailabilityChange{}
+	mi := &file_booking_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AvailabilityChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AvailabilityChange) ProtoMessage() {}
+
+func (x *AvailabilityChange) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AvailabilityChange.ProtoReflect.Descriptor instead.
+func (*AvailabilityChange) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AvailabilityChange) GetIsFree() bool {
+	if x != nil {
+		return x.IsFree
+	}
+	return false
+}
+
+func (x *AvailabilityChange) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+type CarBookingsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CarId         uint64                 `protobuf:"varint,1,opt,name=car_id,json=carId,proto3" json:"car_id,omitempty"`
+	FromMinute    uint64                 `protobuf:"varint,2,opt,name=from_minute,json=fromMinute,proto3" json:"from_minute,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CarBookingsRequest) Reset() {
+	*x = CarBookingsRequest{}
+	mi := &file_booking_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CarBookingsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CarBookingsRequest) ProtoMessage() {}
+
+func (x *CarBookingsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CarBookingsRequest.ProtoReflect.Descriptor instead.
+func (*CarBookingsRequest) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CarBookingsRequest) GetCarId() uint64 {
+	if x != nil {
+		return x.CarId
+	}
+	return 0
+}
+
+func (x *CarBookingsRequest) GetFromMinute() uint64 {
+	if x != nil {
+		return x.FromMinute
+	}
+	return 0
+}
+
+type BookingList struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bookings      []*Booking             `protobuf:"bytes,1,rep,name=bookings,proto3" json:"bookings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BookingList) Reset() {
+	*x = BookingList{}
+	mi := &file_booking_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BookingList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BookingList) ProtoMessage() {}
+
+func (x *BookingList) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BookingList.ProtoReflect.Descriptor instead.
+func (*BookingList) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *BookingList) GetBookings() []*Booking {
+	if x != nil {
+		return x.Bookings
+	}
+	return nil
+}
+
+type SetTurnaroundRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CarId         uint64                 `protobuf:"varint,1,opt,name=car_id,json=carId,proto3" json:"car_id,omitempty"`
+	Minutes       uint64                 `protobuf:"varint,2,opt,name=minutes,proto3" json:"minutes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetTurnaroundRequest) Reset() {
+	*x = SetTurnaroundRequest{}
+	mi := &file_booking_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetTurnaroundRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetTurnaroundRequest) ProtoMessage() {}
+
+func (x *SetTurnaroundRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetTurnaroundRequest.ProtoReflect.Descriptor instead.
+func (*SetTurnaroundRequest) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SetTurnaroundRequest) GetCarId() uint64 {
+	if x != nil {
+		return x.CarId
+	}
+	return 0
+}
+
+func (x *SetTurnaroundRequest) GetMinutes() uint64 {
+	if x != nil {
+		return x.Minutes
+	}
+	return 0
+}
+
+type SetTurnaroundResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetTurnaroundResponse) Reset() {
+	*x = SetTurnaroundResponse{}
+	mi := &file_booking_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetTurnaroundResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetTurnaroundResponse) ProtoMessage() {}
+
+func (x *SetTurnaroundResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetTurnaroundResponse.ProtoReflect.Descriptor instead.
+func (*SetTurnaroundResponse) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{11}
+}
+
+type UserRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// user_id is required.
+	UserId        *uint64 `protobuf:"varint,1,opt,name=user_id,json=userId,proto3,oneof" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserRequest) Reset() {
+	*x = UserRequest{}
+	mi := &file_booking_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserRequest) ProtoMessage() {}
+
+func (x *UserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserRequest.ProtoReflect.Descriptor instead.
+func (*UserRequest) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *UserRequest) GetUserId() uint64 {
+	if x != nil && x.UserId != nil {
+		return *x.UserId
+	}
+	return 0
+}
+
+type EraseUserResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Erased        int64                  `protobuf:"varint,1,opt,name=erased,proto3" json:"erased,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EraseUserResponse) Reset() {
+	*x = EraseUserResponse{}
+	mi := &file_booking_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EraseUserResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EraseUserResponse) ProtoMessage() {}
+
+func (x *EraseUserResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EraseUserResponse.ProtoReflect.Descriptor instead.
+func (*EraseUserResponse) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *EraseUserResponse) GetErased() int64 {
+	if x != nil {
+		return x.Erased
+	}
+	return 0
+}
+
+var File_booking_proto protoreflect.FileDescriptor
+
+const file_booking_proto_rawDesc = "" +
+	"\n" +
+	"\rbooking.proto\x12\n" +
+	"booking.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xde\x02\n" +
+	"\aBooking\x12\x15\n" +
+	"\x06car_id\x18\x01 \x01(\x04R\x05carId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\x04R\x06userId\x12\x1d\n" +
+	"\n" +
+	"booking_id\x18\x03 \x01(\x04R\tbookingId\x12\x19\n" +
+	"\bfrom_day\x18\x04 \x01(\x04R\afromDay\x12\x15\n" +
+	"\x06to_day\x18\x05 \x01(\x04R\x05toDay\x12\x1f\n" +
+	"\vfrom_minute\x18\x06 \x01(\x04R\n" +
+	"fromMinute\x12\x1b\n" +
+	"\tto_minute\x18\a \x01(\x04R\btoMinute\x12'\n" +
+	"\x0fpickup_location\x18\b \x01(\tR\x0epickupLocation\x12'\n" +
+	"\x0freturn_location\x18\t \x01(\tR\x0ereturnLocation\x12*\n" +
+	"\x11one_way_surcharge\x18\n" +
+	" \x01(\x04R\x0foneWaySurcharge\x12\x16\n" +
+	"\x06status\x18\v \x01(\tR\x06status\"\xcb\x02\n" +
+	"\x14CreateBookingRequest\x12\x15\n" +
+	"\x06car_id\x18\x01 \x01(\x04R\x05carId\x12\x19\n" +
+	"\bfrom_day\x18\x02 \x01(\x04R\afromDay\x12\x15\n" +
+	"\x06to_day\x18\x03 \x01(\x04R\x05toDay\x12\x1f\n" +
+	"\vfrom_minute\x18\x04 \x01(\x04R\n" +
+	"fromMinute\x12\x1b\n" +
+	"\tto_minute\x18\x05 \x01(\x04R\btoMinute\x12.\n" +
+	"\x04from\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\x02to\x12'\n" +
+	"\x0fpickup_location\x18\b \x01(\tR\x0epickupLocation\x12'\n" +
+	"\x0freturn_location\x18\t \x01(\tR\x0ereturnLocation\"2\n" +
+	"\x11GetBookingRequest\x12\x1d\n" +
+	"\n" +
+	"booking_id\x18\x01 \x01(\x04R\tbookingId\"\xc5\x01\n" +
+	"\x11MyBookingsRequest\x12\x1b\n" +
+	"\x06cursor\x18\x01 \x01(\x04H\x00R\x06cursor\x88\x01\x01\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12.\n" +
+	"\x04from\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x02toB\t\n" +
+	"\a_cursor\"t\n" +
+	"\vBookingPage\x12/\n" +
+	"\bbookings\x18\x01 \x03(\v2\x13.booking.v1.BookingR\bbookings\x12$\n" +
+	"\vnext_cursor\x18\x02 \x01(\x04H\x00R\n" +
+	"nextCursor\x88\x01\x01B\x0e\n" +
+	"\f_next_cursor\"\xc6\x02\n" +
+	"\x0fCheckCarRequest\x12\x15\n" +
+	"\x06car_id\x18\x01 \x01(\x04R\x05carId\x12\x19\n" +
+	"\bfrom_day\x18\x02 \x01(\x04R\afromDay\x12\x15\n" +
+	"\x06to_day\x18\x03 \x01(\x04R\x05toDay\x12\x1f\n" +
+	"\vfrom_minute\x18\x04 \x01(\x04R\n" +
+	"fromMinute\x12\x1b\n" +
+	"\tto_minute\x18\x05 \x01(\x04R\btoMinute\x12.\n" +
+	"\x04from\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\x02to\x12'\n" +
+	"\x0fpickup_location\x18\b \x01(\tR\x0epickupLocation\x12'\n" +
+	"\x0freturn_location\x18\t \x01(\tR\x0ereturnLocation\"+\n" +
+	"\x10CheckCarResponse\x12\x17\n" +
+	"\ais_free\x18\x01 \x01(\bR\x06isFree\"]\n" +
+	"\x12AvailabilityChange\x12\x17\n" +
+	"\ais_free\x18\x01 \x01(\bR\x06isFree\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\"L\n" +
+	"\x12CarBookingsRequest\x12\x15\n" +
+	"\x06car_id\x18\x01 \x01(\x04R\x05carId\x12\x1f\n" +
+	"\vfrom_minute\x18\x02 \x01(\x04R\n" +
+	"fromMinute\">\n" +
+	"\vBookingList\x12/\n" +
+	"\bbookings\x18\x01 \x03(\v2\x13.booking.v1.BookingR\bbookings\"G\n" +
+	"\x14SetTurnaroundRequest\x12\x15\n" +
+	"\x06car_id\x18\x01 \x01(\x04R\x05carId\x12\x18\n" +
+	"\aminutes\x18\x02 \x01(\x04R\aminutes\"\x17\n" +
+	"\x15SetTurnaroundResponse\"7\n" +
+	"\vUserRequest\x12\x1c\n" +
+	"\auser_id\x18\x01 \x01(\x04H\x00R\x06userId\x88\x01\x01B\n" +
+	"\n" +
+	"\b_user_id\"+\n" +
+	"\x11EraseUserResponse\x12\x16\n" +
+	"\x06erased\x18\x01 \x01(\x03R\x06erased2\xa0\x05\n" +
+	"\x0eBookingService\x12F\n" +
+	"\rCreateBooking\x12 .booking.v1.CreateBookingRequest\x1a\x13.booking.v1.Booking\x12@\n" +
+	"\n" +
+	"GetBooking\x12\x1d.booking.v1.GetBookingRequest\x1a\x13.booking.v1.Booking\x12D\n" +
+	"\n" +
+	"MyBookings\x12\x1d.booking.v1.MyBookingsRequest\x1a\x17.booking.v1.BookingPage\x12E\n" +
+	"\bCheckCar\x12\x1b.booking.v1.CheckCarRequest\x1a\x1c.booking.v1.CheckCarResponse\x12R\n" +
+	"\x11WatchAvailability\x12\x1b.booking.v1.CheckCarRequest\x1a\x1e.booking.v1.AvailabilityChange0\x01\x12F\n" +
+	"\vCarBookings\x12\x1e.booking.v1.CarBookingsRequest\x1a\x17.booking.v1.BookingList\x12T\n" +
+	"\rSetTurnaround\x12 .booking.v1.SetTurnaroundRequest\x1a!.booking.v1.SetTurnaroundResponse\x12@\n" +
+	"\fUserBookings\x12\x17.booking.v1.UserRequest\x1a\x17.booking.v1.BookingList\x12C\n" +
+	"\tEraseUser\x12\x17.booking.v1.UserRequest\x1a\x1d.booking.v1.EraseUserResponseB/Z-distributed-rental/projects/booking/bookingpbb\x06proto3"
+
+var (
+	file_booking_proto_rawDescOnce sync.Once
+	file_booking_proto_rawDescData []byte
+)
+
+func file_booking_proto_rawDescGZIP() []byte {
+	file_booking_proto_rawDescOnce.Do(func() {
+		file_booking_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_booking_proto_rawDesc), len(file_booking_proto_rawDesc)))
+	})
+	return file_booking_proto_rawDescData
+}
+
+var file_booking_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_booking_proto_goTypes = []any{
+	(*Booking)(nil),               // 0: booking.v1.Booking
+	(*CreateBookingRequest)(nil),  // 1: booking.v1.CreateBookingRequest
+	(*GetBookingRequest)(nil),     // 2: booking.v1.GetBookingRequest
+	(*MyBookingsRequest)(nil),     // 3: booking.v1.MyBookingsRequest
+	(*BookingPage)(nil),           // 4: booking.v1.BookingPage
+	(*CheckCarRequest)(nil),       // 5: booking.v1.CheckCarRequest
+	(*CheckCarResponse)(nil),      // 6: booking.v1.CheckCarResponse
+	(*AvailabilityChange)(nil),    // 7: booking.v1.AvailabilityChange
+	(*CarBookingsRequest)(nil),    // 8: booking.v1.CarBookingsRequest
+	(*BookingList)(nil),           // 9: booking.v1.BookingList
+	(*SetTurnaroundRequest)(nil),  // 10: booking.v1.SetTurnaroundRequest
+	(*SetTurnaroundResponse)(nil), // 11: booking.v1.SetTurnaroundResponse
+	(*UserRequest)(nil),           // 12: booking.v1.UserRequest
+	(*EraseUserResponse)(nil),     // 13: booking.v1.EraseUserResponse
+	(*timestamppb.Timestamp)(nil), // 14: google.protobuf.Timestamp
+}
+var file_booking_proto_depIdxs = []int32{
+	14, // 0: booking.v1.CreateBookingRequest.from:type_name -> google.protobuf.Timestamp
+	14, // 1: booking.v1.CreateBookingRequest.to:type_name -> google.protobuf.Timestamp
+	14, // 2: booking.v1.MyBookingsRequest.from:type_name -> google.protobuf.Timestamp
+	14, // 3: booking.v1.MyBookingsRequest.to:type_name -> google.protobuf.Timestamp
+	0,  // 4: booking.v1.BookingPage.bookings:type_name -> booking.v1.Booking
+	14, // 5: booking.v1.CheckCarRequest.from:type_name -> google.protobuf.Timestamp
+	14, // 6: booking.v1.CheckCarRequest.to:type_name -> google.protobuf.Timestamp
+	14, // 7: booking.v1.AvailabilityChange.time:type_name -> google.protobuf.Timestamp
+	0,  // 8: booking.v1.BookingList.bookings:type_name -> booking.v1.Booking
+	1,  // 9: booking.v1.BookingService.CreateBooking:input_type -> booking.v1.CreateBookingRequest
+	2,  // 10: booking.v1.BookingService.GetBooking:input_type -> booking.v1.GetBookingRequest
+	3,  // 11: booking.v1.BookingService.MyBookings:input_type -> booking.v1.MyBookingsRequest
+	5,  // 12: booking.v1.BookingService.CheckCar:input_type -> booking.v1.CheckCarRequest
+	5,  // 13: booking.v1.BookingService.WatchAvailability:input_type -> booking.v1.CheckCarRequest
+	8,  // 14: booking.v1.BookingService.CarBookings:input_type -> booking.v1.CarBookingsRequest
+	10, // 15: booking.v1.BookingService.SetTurnaround:input_type -> booking.v1.SetTurnaroundRequest
+	12, // 16: booking.v1.BookingService.UserBookings:input_type -> booking.v1.UserRequest
+	12, // 17: booking.v1.BookingService.EraseUser:input_type -> booking.v1.UserRequest
+	0,  // 18: booking.v1.BookingService.CreateBooking:output_type -> booking.v1.Booking
+	0,  // 19: booking.v1.BookingService.GetBooking:output_type -> booking.v1.Booking
+	4,  // 20: booking.v1.BookingService.MyBookings:output_type -> booking.v1.BookingPage
+	6,  // 21: booking.v1.BookingService.CheckCar:output_type -> booking.v1.CheckCarResponse
+	7,  // 22: booking.v1.BookingService.WatchAvailability:output_type -> booking.v1.AvailabilityChange
+	9,  // 23: booking.v1.BookingService.CarBookings:output_type -> booking.v1.BookingList
+	11, // 24: booking.v1.BookingService.SetTurnaround:output_type -> booking.v1.SetTurnaroundResponse
+	9,  // 25: booking.v1.BookingService.UserBookings:output_type -> booking.v1.BookingList
+	13, // 26: booking.v1.BookingService.EraseUser:output_type -> booking.v1.EraseUserResponse
+	18, // [18:27] is the sub-list for method output_type
+	9,  // [9:18] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_booking_proto_init() }
+func file_booking_proto_init() {
+	if File_booking_proto != nil {
+		return
+	}
+	file_booking_proto_msgTypes[3].OneofWrappers = []any{}
+	file_booking_proto_msgTypes[4].OneofWrappers = []any{}
+	file_booking_proto_msgTypes[12].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_booking_proto_rawDesc), len(file_booking_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_booking_proto_goTypes,
+		DependencyIndexes: file_booking_proto_depIdxs,
+		MessageInfos:      file_booking_proto_msgTypes,
+	}.Build()
+	File_booking_proto = out.File
+	file_booking_proto_goTypes = nil
+	file_booking_proto_depIdxs = nil
+}
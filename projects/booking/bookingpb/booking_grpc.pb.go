@@ -0,0 +1,473 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.29.3
+// source: booking.proto
+
+package bookingpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	BookingService_CreateBooking_FullMethodName     = "/booking.v1.BookingService/CreateBooking"
+	BookingService_GetBooking_FullMethodName        = "/booking.v1.BookingService/GetBooking"
+	BookingService_MyBookings_FullMethodName        = "/booking.v1.BookingService/MyBookings"
+	BookingService_CheckCar_FullMethodName          = "/booking.v1.BookingService/CheckCar"
+	BookingService_WatchAvailability_FullMethodName = "/booking.v1.BookingService/WatchAvailability"
+	BookingService_CarBookings_FullMethodName       = "/booking.v1.BookingService/CarBookings"
+	BookingService_SetTurnaround_FullMethodName     = "/booking.v1.BookingService/SetTurnaround"
+	BookingService_UserBookings_FullMethodName      = "/booking.v1.BookingService/UserBookings"
+	BookingService_EraseUser_FullMethodName         = "/booking.v1.BookingService/EraseUser"
+)
+
+// BookingServiceClient is the client API for BookingService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// BookingService is the gRPC API of the booking service. Every RPC behaves
+// like the REST v1 route named in its comment and takes the same credentials,
+// sent as metadata: x-auth or x-api-key for users, authorization with a
+// bearer service token for other services and x-admin-token for the admin.
+type BookingServiceClient interface {
+	// CreateBooking books a car for the caller, like POST /v1/bookings.
+	CreateBooking(ctx context.Context, in *CreateBookingRequest, opts ...grpc.CallOption) (*Booking, error)
+	// GetBooking returns a booking of the caller, or any booking to the admin,
+	// like GET /v1/bookings/{booking_id}.
+	GetBooking(ctx context.Context, in *GetBookingRequest, opts ...grpc.CallOption) (*Booking, error)
+	// MyBookings lists the bookings of the caller a page at a time, like
+	// GET /v1/my_bookings.
+	MyBookings(ctx context.Context, in *MyBookingsRequest, opts ...grpc.CallOption) (*BookingPage, error)
+	// CheckCar reports whether a car is free for an interval, like
+	// GET /v1/cars/{car_id}/availability.
+	CheckCar(ctx context.Context, in *CheckCarRequest, opts ...grpc.CallOption) (*CheckCarResponse, error)
+	// WatchAvailability sends whether a car is free for an interval at once
+	// and again every time that changes, until the caller cancels the call.
+	WatchAvailability(ctx context.Context, in *CheckCarRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AvailabilityChange], error)
+	// CarBookings lists the bookings of a car that end after from_minute, like
+	// GET /v1/cars/{car_id}/bookings.
+	CarBookings(ctx context.Context, in *CarBookingsRequest, opts ...grpc.CallOption) (*BookingList, error)
+	// SetTurnaround sets the minutes a car needs between two bookings, like
+	// PUT /v1/cars/{car_id}/turnaround.
+	SetTurnaround(ctx context.Context, in *SetTurnaroundRequest, opts ...grpc.CallOption) (*SetTurnaroundResponse, error)
+	// UserBookings lists every booking of a user, like
+	// GET /v1/admin/users/{user_id}/bookings.
+	UserBookings(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*BookingList, error)
+	// EraseUser detaches the bookings of a user from them, like
+	// POST /v1/admin/users/{user_id}/erase.
+	EraseUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*EraseUserResponse, error)
+}
+
+type bookingServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBookingServiceClient(cc grpc.ClientConnInterface) BookingServiceClient {
+	return &bookingServiceClient{cc}
+}
+
+func (c *bookingServiceClient) CreateBooking(ctx context.Context, in *CreateBookingRequest, opts ...grpc.CallOption) (*Booking, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Booking)
+	err := c.cc.Invoke(ctx, BookingService_CreateBooking_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookingServiceClient) GetBooking(ctx context.Context, in *GetBookingRequest, opts ...grpc.CallOption) (*Booking, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Booking)
+	err := c.cc.Invoke(ctx, BookingService_GetBooking_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookingServiceClient) MyBookings(ctx context.Context, in *MyBookingsRequest, opts ...grpc.CallOption) (*BookingPage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BookingPage)
+	err := c.cc.Invoke(ctx, BookingService_MyBookings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookingServiceClient) CheckCar(ctx context.Context, in *CheckCarRequest, opts ...grpc.CallOption) (*CheckCarResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckCarResponse)
+	err := c.cc.Invoke(ctx, BookingService_CheckCar_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookingServiceClient) WatchAvailability(ctx context.Context, in *CheckCarRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AvailabilityChange], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &BookingService_ServiceDesc.Streams[0], BookingService_WatchAvailability_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CheckCarRequest, AvailabilityChange]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BookingService_WatchAvailabilityClient = grpc.ServerStreamingClient[AvailabilityChange]
+
+func (c *bookingServiceClient) CarBookings(ctx context.Context, in *CarBookingsRequest, opts ...grpc.CallOption) (*BookingList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BookingList)
+	err := c.cc.Invoke(ctx, BookingService_CarBookings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookingServiceClient) SetTurnaround(ctx context.Context, in *SetTurnaroundRequest, opts ...grpc.CallOption) (*SetTurnaroundResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetTurnaroundResponse)
+	err := c.cc.Invoke(ctx, BookingService_SetTurnaround_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookingServiceClient) UserBookings(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*BookingList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BookingList)
+	err := c.cc.Invoke(ctx, BookingService_UserBookings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookingServiceClient) EraseUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*EraseUserResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EraseUserResponse)
+	err := c.cc.Invoke(ctx, BookingService_EraseUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BookingServiceServer is the server API for BookingService service.
+// All implementations must embed UnimplementedBookingServiceServer
+// for forward compatibility.
+//
+// BookingService is the gRPC API of the booking service. Every RPC behaves
+// like the REST v1 route named in its comment and takes the same credentials,
+// sent as metadata: x-auth or x-api-key for users, authorization with a
+// bearer service token for other services and x-admin-token for the admin.
+type BookingServiceServer interface {
+	// CreateBooking books a car for the caller, like POST /v1/bookings.
+	CreateBooking(context.Context, *CreateBookingRequest) (*Booking, error)
+	// GetBooking returns a booking of the caller, or any booking to the admin,
+	// like GET /v1/bookings/{booking_id}.
+	GetBooking(context.Context, *GetBookingRequest) (*Booking, error)
+	// MyBookings lists the bookings of the caller a page at a time, like
+	// GET /v1/my_bookings.
+	MyBookings(context.Context, *MyBookingsRequest) (*BookingPage, error)
+	// CheckCar reports whether a car is free for an interval, like
+	// GET /v1/cars/{car_id}/availability.
+	CheckCar(context.Context, *CheckCarRequest) (*CheckCarResponse, error)
+	// WatchAvailability sends whether a car is free for an interval at once
+	// and again every time that changes, until the caller cancels the call.
+	WatchAvailability(*CheckCarRequest, grpc.ServerStreamingServer[AvailabilityChange]) error
+	// CarBookings lists the bookings of a car that end after from_minute, like
+	// GET /v1/cars/{car_id}/bookings.
+	CarBookings(context.Context, *CarBookingsRequest) (*BookingList, error)
+	// SetTurnaround sets the minutes a car needs between two bookings, like
+	// PUT /v1/cars/{car_id}/turnaround.
+	SetTurnaround(context.Context, *SetTurnaroundRequest) (*SetTurnaroundResponse, error)
+	// UserBookings lists every booking of a user, like
+	// GET /v1/admin/users/{user_id}/bookings.
+	UserBookings(context.Context, *UserRequest) (*BookingList, error)
+	// EraseUser detaches the bookings of a user from them, like
+	// POST /v1/admin/users/{user_id}/erase.
+	EraseUser(context.Context, *UserRequest) (*EraseUserResponse, error)
+	mustEmbedUnimplementedBookingServiceServer()
+}
+
+// UnimplementedBookingServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBookingServiceServer struct{}
+
+func (UnimplementedBookingServiceServer) CreateBooking(context.Context, *CreateBookingRequest) (*Booking, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateBooking not implemented")
+}
+func (UnimplementedBookingServiceServer) GetBooking(context.Context, *GetBookingRequest) (*Booking, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetBooking not implemented")
+}
+func (UnimplementedBookingServiceServer) MyBookings(context.Context, *MyBookingsRequest) (*BookingPage, error) {
+	return nil, status.Error(codes.Unimplemented, "method MyBookings not implemented")
+}
+func (UnimplementedBookingServiceServer) CheckCar(context.Context, *CheckCarRequest) (*CheckCarResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method CheckCar not implemented")
+}
+func (UnimplementedBookingServiceServer) WatchAvailability(*CheckCarRequest, grpc.ServerStreamingServer[AvailabilityChange]) error {
+	return status.Error(codes.Unimplemented, "method WatchAvailability not implemented")
+}
+func (UnimplementedBookingServiceServer) CarBookings(context.Context, *CarBookingsRequest) (*BookingList, error) {
+	return nil, status.Error(codes.Unimplemented, "method CarBookings not implemented")
+}
+func (UnimplementedBookingServiceServer) SetTurnaround(context.Context, *SetTurnaroundRequest) (*SetTurnaroundResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetTurnaround not implemented")
+}
+func (UnimplementedBookingServiceServer) UserBookings(context.Context, *UserRequest) (*BookingList, error) {
+	return nil, status.Error(codes.Unimplemented, "method UserBookings not implemented")
+}
+func (UnimplementedBookingServiceServer) EraseUser(context.Context, *UserRequest) (*EraseUserResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method EraseUser not implemented")
+}
+func (UnimplementedBookingServiceServer) mustEmbedUnimplementedBookingServiceServer() {}
+func (UnimplementedBookingServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeBookingServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BookingServiceServer will
+// result in compilation errors.
+type UnsafeBookingServiceServer interface {
+	mustEmbedUnimplementedBookingServiceServer()
+}
+
+func RegisterBookingServiceServer(s grpc.ServiceRegistrar, srv BookingServiceServer) {
+	// If the following call panics, it indicates UnimplementedBookingServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&BookingService_ServiceDesc, srv)
+}
+
+func _BookingService_CreateBooking_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateBookingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookingServiceServer).CreateBooking(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookingService_CreateBooking_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookingServiceServer).CreateBooking(ctx, req.(*CreateBookingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookingService_GetBooking_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBookingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookingServiceServer).GetBooking(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookingService_GetBooking_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookingServiceServer).GetBooking(ctx, req.(*GetBookingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookingService_MyBookings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MyBookingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookingServiceServer).MyBookings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookingService_MyBookings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookingServiceServer).MyBookings(ctx, req.(*MyBookingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookingService_CheckCar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckCarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookingServiceServer).CheckCar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookingService_CheckCar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookingServiceServer).CheckCar(ctx, req.(*CheckCarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookingService_WatchAvailability_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CheckCarRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BookingServiceServer).WatchAvailability(m, &grpc.GenericServerStream[CheckCarRequest, AvailabilityChange]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BookingService_WatchAvailabilityServer = grpc.ServerStreamingServer[AvailabilityChange]
+
+func _BookingService_CarBookings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CarBookingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookingServiceServer).CarBookings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookingService_CarBookings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookingServiceServer).CarBookings(ctx, req.(*CarBookingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookingService_SetTurnaround_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetTurnaroundRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookingServiceServer).SetTurnaround(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookingService_SetTurnaround_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookingServiceServer).SetTurnaround(ctx, req.(*SetTurnaroundRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookingService_UserBookings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookingServiceServer).UserBookings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookingService_UserBookings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookingServiceServer).UserBookings(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookingService_EraseUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookingServiceServer).EraseUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookingService_EraseUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookingServiceServer).EraseUser(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// BookingService_ServiceDesc is the grpc.ServiceDesc for BookingService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var BookingService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "booking.v1.BookingService",
+	HandlerType: (*BookingServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateBooking",
+			Handler:    _BookingService_CreateBooking_Handler,
+		},
+		{
+			MethodName: "GetBooking",
+			Handler:    _BookingService_GetBooking_Handler,
+		},
+		{
+			MethodName: "MyBookings",
+			Handler:    _BookingService_MyBookings_Handler,
+		},
+		{
+			MethodName: "CheckCar",
+			Handler:    _BookingService_CheckCar_Handler,
+		},
+		{
+			MethodName: "CarBookings",
+			Handler:    _BookingService_CarBookings_Handler,
+		},
+		{
+			MethodName: "SetTurnaround",
+			Handler:    _BookingService_SetTurnaround_Handler,
+		},
+		{
+			MethodName: "UserBookings",
+			Handler:    _BookingService_UserBookings_Handler,
+		},
+		{
+			MethodName: "EraseUser",
+			Handler:    _BookingService_EraseUser_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchAvailability",
+			Handler:       _BookingService_WatchAvailability_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "booking.proto",
+}
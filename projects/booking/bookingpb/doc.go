@@ -0,0 +1,6 @@
+// Package bookingpb holds the messages and the gRPC client and server stubs of
+// the booking API, generated from booking.proto. Other services call the
+// booking service over gRPC with NewBookingServiceClient.
+package bookingpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative booking.proto
@@ -0,0 +1,121 @@
+// Package client is the HTTP client other services use to read bookings from the booking service.
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+type Booking struct {
+	CarID          uint64 `json:"car_id"`
+	UserID         uint64 `json:"user_id"`
+	BookingID      uint64 `json:"booking_id"`
+	FromMinute     uint64 `json:"from_minute"`
+	ToMinute       uint64 `json:"to_minute"`
+	PickupLocation string `json:"pickup_location"`
+	ReturnLocation string `json:"return_location"`
+}
+
+type Client struct {
+	addr       string
+	scheme     string
+	httpClient *http.Client
+}
+
+// New creates a client for the booking service listening on addr (host:port).
+func New(addr string) *Client {
+	return &Client{
+		addr:       addr,
+		scheme:     "http",
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// SetTimeout limits how long a single call may take.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.httpClient.Timeout = timeout
+}
+
+// SetTLS makes calls over HTTPS with config, which also holds the client
+// certificate for mutual TLS. A nil config keeps plain HTTP.
+func (c *Client) SetTLS(config *tls.Config) {
+	if config == nil {
+		return
+	}
+	c.scheme = "https"
+	c.httpClient.Transport = &http.Transport{TLSClientConfig: config}
+}
+
+// CarBookings returns the bookings of the car that end after fromMinute. token is
+// a service token with the booking:read scope.
+func (c *Client) CarBookings(token string, carID uint64, fromMinute uint64) ([]Booking, error) {
+	var response struct {
+		Bookings []Booking `json:"bookings"`
+	}
+	err := c.call("/car_bookings", "Authorization", "Bearer "+token, map[string]uint64{"car_id": carID, "from_minute": fromMinute}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response.Bookings, nil
+}
+
+// ExportUser returns every booking of the user as the JSON object
+// {"bookings": [...]}, for data exports. adminToken is shared by the services.
+func (c *Client) ExportUser(adminToken []byte, userID uint64) (json.RawMessage, error) {
+	var response json.RawMessage
+	err := c.call("/admin/user_bookings", "X-Admin-Token", string(adminToken), map[string]uint64{"user_id": userID}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// EraseUser detaches the bookings of the user from them and returns how many
+// there were.
+func (c *Client) EraseUser(adminToken []byte, userID uint64) (int, error) {
+	var response struct {
+		Erased int `json:"erased"`
+	}
+	err := c.call("/admin/erase_user", "X-Admin-Token", string(adminToken), map[string]uint64{"user_id": userID}, &response)
+	if err != nil {
+		return 0, err
+	}
+	return response.Erased, nil
+}
+
+// call posts request with token in the header named header.
+func (c *Client) call(path string, header string, token string, request interface{}, response interface{}) error {
+	requestBytes, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.scheme+"://"+c.addr+path, bytes.NewReader(requestBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(header, token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("booking request %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("booking request %s: error reading body: %w", path, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("booking request %s: status %d: %s", path, resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return json.Unmarshal(body, response)
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"distributed-rental/pkg/backup"
+	"distributed-rental/pkg/config"
+	"distributed-rental/pkg/eligibility"
+	"distributed-rental/pkg/migrate"
+	"distributed-rental/pkg/openapi"
+	auth "distributed-rental/projects/auth/client"
 	"distributed-rental/projects/booking/internal"
-	"flag"
-	"github.com/dgraph-io/badger/v3"
-	"go.uber.org/zap"
+	fleet "distributed-rental/projects/fleet/client"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -14,39 +20,128 @@ import (
 )
 
 func main() {
-	addrF := flag.String("addr", "localhost:3002", "addr to listen on")
-	jwtSecretPath := flag.String("jwt-secret-path", "/etc/jwt-secret", "path to jwt secret")
-
-	flag.Parse()
+	cfg := defaultConfig()
+	err := config.Load(&cfg, "booking", os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.OpenAPI != "" {
+		err = openapi.WriteFile(cfg.OpenAPI, internal.OpenAPI())
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	db, err := badger.Open(badger.DefaultOptions("~/var/booking_db"))
+	logger, err := cfg.Log.Logger()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	logger.Sugar().Infow("effective config", "config", config.Redacted(&cfg))
+
+	var repository internal.BookingRepository
+	switch cfg.Storage.Backend {
+	case "badger":
+		db, err := cfg.Badger.Open()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+
+		_, err = migrate.Run(db, internal.BadgerMigrations, migrate.Options{DryRun: cfg.MigrateDryRun, Logger: logger.Sugar()})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if cfg.MigrateDryRun {
+			return
+		}
+
+		if cfg.Admin.Addr != "" {
+			adminServer, err := backup.Serve(cfg.Admin.Addr, db, cfg.Admin.TokenPath, logger.Sugar())
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer adminServer.Close()
+		}
+
+		repository, err = internal.NewBadgerBookingRepository(db, cfg.Badger.SequenceBandwidth)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "sqlite":
+		sqliteRepository, err := internal.NewSQLiteBookingRepository(cfg.Storage.SQLitePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		repository = sqliteRepository
+	case "memory":
+		repository = internal.NewMemoryBookingRepository()
+	}
+	defer repository.Close()
 
-	logger, err := zap.NewProduction()
+	jwtSecret, err := config.ReadSecret(cfg.JWTSecret, cfg.JWTSecretPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	jwtSecret, err := ioutil.ReadFile(*jwtSecretPath)
+	adminToken, err := ioutil.ReadFile(cfg.Admin.TokenPath)
+	if os.IsNotExist(err) {
+		logger.Sugar().Warnf("no admin token at %s, admin endpoints are disabled", cfg.Admin.TokenPath)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	driverRules, err := eligibility.ParseRules(cfg.DriverRules)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	bookingIDSequence, err := db.GetSequence([]byte("booking_id_sequence"), 100_000)
+	serverTLS, err := cfg.TLS.ServerConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	clientTLS, err := cfg.TLS.ClientConfig()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	var carCatalog internal.CarCatalog
+	if cfg.FleetAddr != "" {
+		fleetClient := fleet.New(cfg.FleetAddr)
+		fleetClient.SetTimeout(cfg.ClientTimeout)
+		fleetClient.SetTLS(clientTLS)
+		carCatalog = fleetClient
+	}
+
 	bookingService := &internal.BookingService{
-		DB:                db,
-		BookingIDSequence: bookingIDSequence,
+		Repository:        repository,
 		Logger:            logger,
+		DefaultTurnaround: cfg.TurnaroundMinutes,
+		OneWaySurcharge:   cfg.OneWaySurcharge,
+		Fleet:             carCatalog,
+		Eligibility:       driverRules,
+	}
+
+	httpServer := internal.NewHttpServer(cfg.HTTP.Addr, bookingService, jwtSecret, logger.Sugar())
+	httpServer.SetTimeouts(cfg.HTTP.ReadTimeout, cfg.HTTP.WriteTimeout, cfg.HTTP.IdleTimeout)
+	httpServer.SetTLS(serverTLS)
+	httpServer.SetAdminToken(bytes.TrimSpace(adminToken))
+	if cfg.AuthAddr != "" {
+		authClient := auth.New(cfg.AuthAddr)
+		authClient.SetTimeout(cfg.ClientTimeout)
+		authClient.SetTLS(clientTLS)
+		authClient.SetCacheTTL(cfg.TokenCacheTTL)
+		httpServer.SetTokenVerifier(authClient)
+		httpServer.SetKeyVerifier(authClient)
+		bookingService.Drivers = authClient
 	}
 
-	httpServer := internal.NewHttpServer(*addrF, bookingService, jwtSecret, logger.Sugar())
+	limiter, err := cfg.RateLimit.Limiter(logger.Sugar())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer limiter.Close()
+	httpServer.SetRateLimit(limiter)
 
 	go func() {
 		err := httpServer.ListenAndServe()
@@ -55,9 +150,32 @@ func main() {
 		}
 	}()
 
-	signals := make(chan os.Signal)
+	var grpcServer *internal.GrpcServer
+	if cfg.GRPC.Addr != "" {
+		grpcServer = internal.NewGrpcServer(cfg.GRPC.Addr, httpServer)
+		grpcServer.SetWatchInterval(cfg.GRPC.WatchInterval)
+		go func() {
+			err := grpcServer.ListenAndServe()
+			if err != nil {
+				logger.Sugar().Errorf("error closing grpc server: %v", err)
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGTERM, syscall.SIGSTOP)
 
 	<-signals
-	httpServer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	err = httpServer.Shutdown(ctx)
+	if err != nil {
+		logger.Sugar().Errorf("error shutting down server: %v", err)
+	}
+	if grpcServer != nil {
+		err = grpcServer.Shutdown(ctx)
+		if err != nil {
+			logger.Sugar().Errorf("error shutting down grpc server: %v", err)
+		}
+	}
 }
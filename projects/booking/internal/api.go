@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"distributed-rental/pkg/openapi"
+	"net/http"
+)
+
+var apiInfo = openapi.Info{
+	Title:       "booking",
+	Description: "Bookings of cars and their availability.",
+	Version:     "1",
+}
+
+var (
+	securityUserOrKey      = []string{openapi.SecurityUser, openapi.SecurityAPIKey}
+	securityService        = []string{openapi.SecurityService}
+	securityAdmin          = []string{openapi.SecurityAdmin}
+	securityUserKeyOrAdmin = []string{openapi.SecurityUser, openapi.SecurityAPIKey, openapi.SecurityAdmin}
+)
+
+// operations are the v1 routes of the booking API, registered by
+// NewHttpServer and described at /openapi.json.
+func (c *HttpServer) operations() []openapi.Operation {
+	return []openapi.Operation{
+		{Method: http.MethodPost, Path: "/v1/bookings", ID: "createBooking", Summary: "Book a car for the caller; from and to take precedence over the minute and day fields",
+			Security: securityUserOrKey, Request: createBookingRequest{}, Response: createBookingResponse{}, Status: http.StatusCreated, Handler: c.createBooking},
+		{Method: http.MethodGet, Path: "/v1/bookings/{booking_id}", ID: "getBooking", Summary: "Get a booking of the caller, or any booking for the admin",
+			Security: securityUserKeyOrAdmin, Request: bookingIDRequest{}, Response: Booking{}, Handler: c.getBooking},
+		{Method: http.MethodGet, Path: "/v1/my_bookings", ID: "myBookings", Summary: "List the bookings of the caller by id, a page at a time, optionally by status and time",
+			Security: securityUserOrKey, Request: myBookingsRequest{}, Response: myBookingsResponse{}, Handler: c.myBookings},
+		{Method: http.MethodGet, Path: "/v1/cars/{car_id}/availability", ID: "checkCar", Summary: "Check whether a car is free for an interval",
+			Security: securityUserOrKey, Request: checkCarRequest{}, Response: checkCarResponse{}, Handler: c.checkCar},
+		{Method: http.MethodGet, Path: "/v1/cars/{car_id}/bookings", ID: "carBookings", Summary: "List the bookings of a car from from_minute on",
+			Security: securityService, Request: carBookingsRequest{}, Response: carBookingsResponse{}, Handler: c.carBookings},
+		{Method: http.MethodPut, Path: "/v1/cars/{car_id}/turnaround", ID: "setTurnaround", Summary: "Set the minutes a car needs between two bookings",
+			Security: securityService, Request: setTurnaroundRequest{}, Handler: c.setTurnaround},
+		{Method: http.MethodGet, Path: "/v1/admin/users/{user_id}/bookings", ID: "userBookings", Summary: "List the bookings of a user",
+			Security: securityAdmin, Request: userIDRequest{}, Response: carBookingsResponse{}, Handler: c.userBookings},
+		{Method: http.MethodPost, Path: "/v1/admin/users/{user_id}/erase", ID: "eraseUser", Summary: "Erase the bookings of a user",
+			Security: securityAdmin, Request: userIDRequest{}, Response: eraseUserResponse{}, Handler: c.eraseUser},
+	}
+}
+
+// OpenAPI describes the v1 routes of the booking API.
+func OpenAPI() *openapi.Document {
+	return openapi.Build(apiInfo, (&HttpServer{}).operations())
+}
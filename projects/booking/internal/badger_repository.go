@@ -0,0 +1,312 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"math"
+	"strconv"
+)
+
+// BadgerBookingRepository keeps bookings under "<car_id>_<from>_<to>" keys so
+// that one prefix scan returns all bookings of a car. Index entries under
+// "!bid/<booking_id>" and "!user/<user_id>/<booking_id>" hold the key of the
+// booking.
+type BadgerBookingRepository struct {
+	db                *badger.DB
+	bookingIDSequence *badger.Sequence
+}
+
+// NewBadgerBookingRepository leases booking ids from the sequence sequenceBandwidth at a time.
+func NewBadgerBookingRepository(db *badger.DB, sequenceBandwidth uint64) (*BadgerBookingRepository, error) {
+	bookingIDSequence, err := db.GetSequence([]byte("booking_id_sequence"), sequenceBandwidth)
+	if err != nil {
+		return nil, err
+	}
+	return &BadgerBookingRepository{
+		db:                db,
+		bookingIDSequence: bookingIDSequence,
+	}, nil
+}
+
+func getKey(carID, from, to uint64) []byte {
+	return []byte(fmt.Sprintf("%d_%d_%d", carID, from, to))
+}
+
+func carPrefix(carID uint64) []byte {
+	return []byte(fmt.Sprintf("%d_", carID))
+}
+
+// carLockKey guards the bookings of a car. Badger only detects conflicts on keys
+// a transaction read, and the prefix scan of a car's bookings does not cover
+// a key another transaction inserts meanwhile. createBooking reads and writes
+// this key, so of two concurrent bookings of the car one fails to commit.
+func carLockKey(carID uint64) []byte {
+	return []byte(fmt.Sprintf("car_lock_%d", carID))
+}
+
+func turnaroundKey(carID uint64) []byte {
+	return []byte(fmt.Sprintf("turnaround_%d", carID))
+}
+
+var bookingIDPrefix = []byte("!bid/")
+
+// bookingIDKey and userBookingKey sort like the ids, so that the indexes
+// iterate in id order.
+func bookingIDKey(bookingID uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", bookingIDPrefix, bookingID))
+}
+
+func userBookingsPrefix(userID uint64) []byte {
+	return []byte(fmt.Sprintf("!user/%020d/", userID))
+}
+
+func userBookingKey(userID, bookingID uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", userBookingsPrefix(userID), bookingID))
+}
+
+// bookingIndex returns the index entries of the booking stored under key.
+func bookingIndex(key []byte, booking BookingDBModel) map[string][]byte {
+	return map[string][]byte{
+		string(bookingIDKey(booking.BookingID)):                   key,
+		string(userBookingKey(booking.UserID, booking.BookingID)): key,
+	}
+}
+
+func (c *BadgerBookingRepository) NextBookingID() (uint64, error) {
+	return c.bookingIDSequence.Next()
+}
+
+func (c *BadgerBookingRepository) CarBookings(carID uint64) ([]BookingDBModel, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	return c.carBookings(tx, carID)
+}
+
+func (c *BadgerBookingRepository) GetBooking(bookingID uint64) (BookingDBModel, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	item, err := tx.Get(bookingIDKey(bookingID))
+	if err == badger.ErrKeyNotFound {
+		return BookingDBModel{}, bookingNotFound
+	}
+	if err != nil {
+		return BookingDBModel{}, err
+	}
+	key, err := item.ValueCopy(nil)
+	if err != nil {
+		return BookingDBModel{}, err
+	}
+	return getBooking(tx, key)
+}
+
+func getBooking(tx *badger.Txn, key []byte) (BookingDBModel, error) {
+	item, err := tx.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return BookingDBModel{}, bookingNotFound
+	}
+	if err != nil {
+		return BookingDBModel{}, err
+	}
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return BookingDBModel{}, err
+	}
+	return decodeBooking(value)
+}
+
+func (c *BadgerBookingRepository) UserBookings(userID uint64) ([]BookingDBModel, error) {
+	return c.ListUserBookings(userID, 0, math.MaxInt, func(BookingDBModel) bool { return true })
+}
+
+func (c *BadgerBookingRepository) ListUserBookings(userID uint64, from uint64, limit int, match func(booking BookingDBModel) bool) ([]BookingDBModel, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	bookings := []BookingDBModel{}
+	err := c.eachUserBooking(tx, userID, from, func(indexKey, key []byte) (bool, error) {
+		booking, err := getBooking(tx, key)
+		if err != nil {
+			return false, err
+		}
+		if match(booking) {
+			bookings = append(bookings, booking)
+		}
+		return len(bookings) < limit, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bookings, nil
+}
+
+func (c *BadgerBookingRepository) ReassignUser(userID uint64, newUserID uint64) (int, error) {
+	moved := 0
+	err := c.db.Update(func(tx *badger.Txn) error {
+		indexKeys := map[string][]byte{}
+		err := c.eachUserBooking(tx, userID, 0, func(indexKey, key []byte) (bool, error) {
+			indexKeys[string(indexKey)] = key
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		for indexKey, key := range indexKeys {
+			booking, err := getBooking(tx, key)
+			if err != nil {
+				return err
+			}
+			booking.UserID = newUserID
+			err = tx.Delete([]byte(indexKey))
+			if err != nil {
+				return err
+			}
+			err = tx.Set(key, encodeBooking(booking))
+			if err != nil {
+				return err
+			}
+			err = tx.Set(userBookingKey(newUserID, booking.BookingID), key)
+			if err != nil {
+				return err
+			}
+		}
+		moved = len(indexKeys)
+		return nil
+	})
+	return moved, err
+}
+
+// CreateBooking retries when a concurrent booking of the same car commits first,
+// so that check sees it.
+func (c *BadgerBookingRepository) CreateBooking(booking BookingDBModel, check func(existing []BookingDBModel) error) error {
+	for {
+		err := c.createBooking(booking, check)
+		if err == badger.ErrConflict {
+			continue
+		}
+		return err
+	}
+}
+
+func (c *BadgerBookingRepository) createBooking(booking BookingDBModel, check func(existing []BookingDBModel) error) error {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	lockKey := carLockKey(booking.CarID)
+	_, err := tx.Get(lockKey)
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+	existing, err := c.carBookings(tx, booking.CarID)
+	if err != nil {
+		return err
+	}
+	err = check(existing)
+	if err != nil {
+		return err
+	}
+	key := getKey(booking.CarID, booking.FromMinute, booking.ToMinute)
+	_, err = tx.Get(key)
+	if err == nil {
+		return bookingAlreadyExists
+	}
+	if err != badger.ErrKeyNotFound {
+		return err
+	}
+	err = tx.Set(lockKey, key)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Set(key, encodeBooking(booking))
+	if err != nil {
+		return err
+	}
+	for indexKey, value := range bookingIndex(key, booking) {
+		err = tx.Set([]byte(indexKey), value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (c *BadgerBookingRepository) Turnaround(carID uint64) (uint64, bool, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	item, err := tx.Get(turnaroundKey(carID))
+	if err == badger.ErrKeyNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return 0, false, err
+	}
+	minutes, err := strconv.ParseUint(string(value), 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return minutes, true, nil
+}
+
+func (c *BadgerBookingRepository) SetTurnaround(carID uint64, minutes uint64) error {
+	return c.db.Update(func(tx *badger.Txn) error {
+		return tx.Set(turnaroundKey(carID), []byte(strconv.FormatUint(minutes, 10)))
+	})
+}
+
+// Close releases the unused part of the id sequence. The DB itself belongs to the caller.
+func (c *BadgerBookingRepository) Close() error {
+	return c.bookingIDSequence.Release()
+}
+
+func (c *BadgerBookingRepository) carBookings(tx *badger.Txn, carID uint64) ([]BookingDBModel, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = carPrefix(carID)
+	it := tx.NewIterator(opts)
+	defer it.Close()
+
+	bookings := []BookingDBModel{}
+	for it.Rewind(); it.Valid(); it.Next() {
+		value, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		booking, err := decodeBooking(value)
+		if err != nil {
+			return nil, err
+		}
+		if booking.CarID != carID {
+			continue
+		}
+		bookings = append(bookings, booking)
+	}
+	return bookings, nil
+}
+
+// eachUserBooking calls fn with the index entry and the key of every booking
+// of the user with an id from from on, in id order, while fn returns true.
+func (c *BadgerBookingRepository) eachUserBooking(tx *badger.Txn, userID uint64, from uint64, fn func(indexKey, key []byte) (bool, error)) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = userBookingsPrefix(userID)
+	it := tx.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(userBookingKey(userID, from)); it.Valid(); it.Next() {
+		key, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		more, err := fn(it.Item().KeyCopy(nil), key)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
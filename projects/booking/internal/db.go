@@ -1,112 +1,484 @@
 package internal
 
 import (
-	"encoding/json"
+	"distributed-rental/pkg/eligibility"
+	"distributed-rental/pkg/interval"
+	fleet "distributed-rental/projects/fleet/client"
 	"errors"
-	"fmt"
-	"github.com/dgraph-io/badger/v3"
 	"go.uber.org/zap"
+	"math"
+	"time"
 )
 
 type BookingService struct {
-	DB                *badger.DB
-	BookingIDSequence *badger.Sequence
-	Logger            *zap.Logger
+	Repository BookingRepository
+	Logger     *zap.Logger
+	// DefaultTurnaround is the cleaning buffer in minutes used for cars without their own setting.
+	DefaultTurnaround uint64
+	// OneWaySurcharge is added to bookings returned at a different location than picked up.
+	OneWaySurcharge uint64
+	// Fleet validates car ids and locations; nil disables the checks.
+	Fleet CarCatalog
+	// Drivers looks renters up for the Eligibility rules of the car classes;
+	// nil, or a nil Fleet, disables the checks.
+	Drivers     DriverRegistry
+	Eligibility eligibility.Rules
+
+	watchers carWatchers
 }
 
 type Booking struct {
-	CarID     uint64 `json:"car_id,omitempty"`
-	UserID    uint64 `json:"user_id,omitempty"`
-	BookingID uint64 `json:"booking_id,omitempty"`
-	From      uint64 `json:"from_day,omitempty"`
-	To        uint64 `json:"to_day,omitempty"`
+	CarID           uint64 `json:"car_id,omitempty"`
+	UserID          uint64 `json:"user_id,omitempty"`
+	BookingID       uint64 `json:"booking_id,omitempty"`
+	From            uint64 `json:"from_day,omitempty"`
+	To              uint64 `json:"to_day,omitempty"`
+	FromMinute      uint64 `json:"from_minute,omitempty"`
+	ToMinute        uint64 `json:"to_minute,omitempty"`
+	PickupLocation  string `json:"pickup_location,omitempty"`
+	ReturnLocation  string `json:"return_location,omitempty"`
+	OneWaySurcharge uint64 `json:"one_way_surcharge,omitempty"`
+	// Status is upcoming, active or completed.
+	Status string `json:"status,omitempty"`
 }
 
 type BookingDBModel struct {
-	CarID     uint64 `json:"car_id,omitempty"`
-	UserID    uint64 `json:"user_id,omitempty"`
-	BookingID uint64 `json:"booking_id,omitempty"`
-	From      uint64 `json:"from_day,omitempty"`
-	To        uint64 `json:"to_day,omitempty"`
+	CarID           uint64 `json:"car_id,omitempty"`
+	UserID          uint64 `json:"user_id,omitempty"`
+	BookingID       uint64 `json:"booking_id,omitempty"`
+	From            uint64 `json:"from_day,omitempty"`
+	To              uint64 `json:"to_day,omitempty"`
+	FromMinute      uint64 `json:"from_minute,omitempty"`
+	ToMinute        uint64 `json:"to_minute,omitempty"`
+	PickupLocation  string `json:"pickup_location,omitempty"`
+	ReturnLocation  string `json:"return_location,omitempty"`
+	OneWaySurcharge uint64 `json:"one_way_surcharge,omitempty"`
+}
+
+// span returns the booked minutes. Records written before minute
+// resolution only carry inclusive day numbers.
+func (c BookingDBModel) span() interval.Interval {
+	if c.ToMinute != 0 {
+		return interval.Interval{From: c.FromMinute, To: c.ToMinute}
+	}
+	return interval.FromDays(c.From, c.To)
+}
+
+// Statuses of a booking, by where the current minute falls relative to it.
+const (
+	statusUpcoming  = "upcoming"
+	statusActive    = "active"
+	statusCompleted = "completed"
+)
+
+func (c BookingDBModel) status(now uint64) string {
+	span := c.span()
+	if now < span.From {
+		return statusUpcoming
+	}
+	if now < span.To {
+		return statusActive
+	}
+	return statusCompleted
 }
 
+// booking shows the booking as of minute now.
+func (c BookingDBModel) booking(now uint64) Booking {
+	span := c.span()
+	return Booking{
+		CarID:           c.CarID,
+		UserID:          c.UserID,
+		BookingID:       c.BookingID,
+		From:            span.FromDay(),
+		To:              span.ToDay(),
+		FromMinute:      span.From,
+		ToMinute:        span.To,
+		PickupLocation:  c.PickupLocation,
+		ReturnLocation:  c.ReturnLocation,
+		OneWaySurcharge: c.OneWaySurcharge,
+		Status:          c.status(now),
+	}
+}
+
+// erasedUserID owns the bookings of erased users. They keep their car, times
+// and surcharge for accounting but no longer lead to a person.
+const erasedUserID = math.MaxInt64
+
 var bookingAlreadyExists = errors.New("booking already exists")
+var unknownCar = errors.New("unknown car")
+var carRetired = errors.New("car is retired")
+var unknownLocation = errors.New("unknown location")
+var locationClosed = errors.New("location is closed at the requested time")
+var carInMaintenance = errors.New("car is under maintenance")
+var bookingNotFound = errors.New("booking not found")
+var notBookingOwner = errors.New("booking belongs to another user")
+var unknownStatus = errors.New("status must be upcoming, active or completed")
 
-func getKey(carID, from, to uint64) []byte {
-	return []byte(fmt.Sprintf("%d_%d_%d", carID, from, to))
+// CarCatalog looks cars and branches up in the fleet service.
+type CarCatalog interface {
+	GetCar(carID uint64) (fleet.Car, error)
+	GetLocation(code string) (fleet.Location, error)
+	MaintenanceWindows(carID uint64, span interval.Interval) ([]fleet.MaintenanceWindow, error)
 }
 
-func (c *BookingService) createBooking(userID uint64, carID uint64, from, to uint64) (Booking, error) {
-	tx := c.DB.NewTransaction(true)
-	defer tx.Discard()
+// DriverRegistry looks up the renter holding an access token in the auth service.
+type DriverRegistry interface {
+	Driver(token string) (eligibility.Driver, error)
+}
+
+// Route is where a rental picks the car up and drops it off. An empty Pickup
+// accepts the car wherever it is; an empty Return means a round trip.
+type Route struct {
+	Pickup string
+	Return string
+}
 
-	bookingID, err := c.BookingIDSequence.Next()
+func (c Route) dropoff() string {
+	if c.Return == "" {
+		return c.Pickup
+	}
+	return c.Return
+}
+
+func (c Route) oneWay() bool {
+	return c.Pickup != "" && c.dropoff() != c.Pickup
+}
+
+// createBooking books the car for the user holding token, who must be
+// eligible to drive its class.
+func (c *BookingService) createBooking(userID uint64, token string, carID uint64, span interval.Interval, route Route) (Booking, error) {
+	car, err := c.checkRental(carID, span, route)
 	if err != nil {
 		return Booking{}, err
 	}
 
+	err = c.checkDriver(token, car, span)
+	if err != nil {
+		return Booking{}, err
+	}
+
+	turnaround, err := c.turnaround(carID)
+	if err != nil {
+		return Booking{}, err
+	}
+
+	bookingID, err := c.Repository.NextBookingID()
+	if err != nil {
+		return Booking{}, err
+	}
+
+	var surcharge uint64
+	if route.oneWay() {
+		surcharge = c.OneWaySurcharge
+	}
+
 	booking := Booking{
-		UserID:    userID,
-		CarID:     carID,
-		BookingID: bookingID,
-		From:      from,
-		To:        to,
+		UserID:          userID,
+		CarID:           carID,
+		BookingID:       bookingID,
+		From:            span.FromDay(),
+		To:              span.ToDay(),
+		FromMinute:      span.From,
+		ToMinute:        span.To,
+		PickupLocation:  route.Pickup,
+		ReturnLocation:  route.dropoff(),
+		OneWaySurcharge: surcharge,
 	}
 
 	bookingDBModel := BookingDBModel{
-		BookingID: bookingID,
-		UserID:    userID,
-		CarID:     carID,
-		From:      from,
-		To:        to,
-	}
-
-	carIDBts := getKey(carID, from, to)
-	if c.IsCarFree(carID, from, to) {
-		userBts, err := json.Marshal(&bookingDBModel)
-		if err != nil {
-			return Booking{}, err
+		BookingID:       bookingID,
+		UserID:          userID,
+		CarID:           carID,
+		From:            booking.From,
+		To:              booking.To,
+		FromMinute:      span.From,
+		ToMinute:        span.To,
+		PickupLocation:  booking.PickupLocation,
+		ReturnLocation:  booking.ReturnLocation,
+		OneWaySurcharge: surcharge,
+	}
+
+	err = c.Repository.CreateBooking(bookingDBModel, func(existing []BookingDBModel) error {
+		if !carIsFree(existing, span, route, car.HomeLocation, turnaround) {
+			return bookingAlreadyExists
 		}
-		err = tx.Set(carIDBts, userBts)
-		if err != nil {
-			return Booking{}, err
+		return nil
+	})
+	if err != nil {
+		return Booking{}, err
+	}
+	c.watchers.notify(carID)
+
+	booking.Status = bookingDBModel.status(interval.FloorMinute(time.Now()))
+	return booking, nil
+}
+
+// carBookings returns the bookings of the car that end after fromMinute.
+func (c *BookingService) carBookings(carID uint64, fromMinute uint64) ([]Booking, error) {
+	bookingDBModels, err := c.Repository.CarBookings(carID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := interval.FloorMinute(time.Now())
+	bookings := []Booking{}
+	for _, bookingDBModel := range bookingDBModels {
+		if bookingDBModel.span().To <= fromMinute {
+			continue
 		}
+		bookings = append(bookings, bookingDBModel.booking(now))
+	}
+	return bookings, nil
+}
+
+// userBookings returns every booking of the user, for data exports.
+func (c *BookingService) userBookings(userID uint64) ([]Booking, error) {
+	bookingDBModels, err := c.Repository.UserBookings(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := interval.FloorMinute(time.Now())
+	bookings := []Booking{}
+	for _, bookingDBModel := range bookingDBModels {
+		bookings = append(bookings, bookingDBModel.booking(now))
+	}
+	return bookings, nil
+}
+
+// getBooking returns the booking with id bookingID, whoever made it.
+func (c *BookingService) getBooking(bookingID uint64) (Booking, error) {
+	bookingDBModel, err := c.Repository.GetBooking(bookingID)
+	if err != nil {
+		return Booking{}, err
+	}
+	return bookingDBModel.booking(interval.FloorMinute(time.Now())), nil
+}
+
+// userBooking returns the booking of the user with id bookingID, or
+// notBookingOwner if another user made it.
+func (c *BookingService) userBooking(userID uint64, bookingID uint64) (Booking, error) {
+	booking, err := c.getBooking(bookingID)
+	if err != nil {
+		return Booking{}, err
+	}
+	if booking.UserID != userID {
+		return Booking{}, notBookingOwner
+	}
+	return booking, nil
+}
+
+// bookingFilter selects the bookings listed by listUserBookings: those with
+// status, unless it is empty, that share a minute with span.
+type bookingFilter struct {
+	status string
+	span   interval.Interval
+}
 
-		err = tx.Commit()
-		if err != nil {
-			return Booking{}, err
+// listUserBookings returns up to limit bookings of the user that match filter,
+// ordered by id, and the cursor of the next page: the id of the last booking
+// returned, or nil if there are no more. With after set only bookings with
+// greater ids are returned. Statuses are as of now.
+func (c *BookingService) listUserBookings(userID uint64, after *uint64, limit int, filter bookingFilter) ([]Booking, *uint64, error) {
+	switch filter.status {
+	case "", statusUpcoming, statusActive, statusCompleted:
+	default:
+		return nil, nil, unknownStatus
+	}
+	if !filter.span.Valid() {
+		return nil, nil, interval.ErrInvalid
+	}
+	var from uint64
+	if after != nil {
+		if *after == math.MaxUint64 {
+			return []Booking{}, nil, nil
 		}
+		from = *after + 1
+	}
+
+	now := interval.FloorMinute(time.Now())
+	bookingDBModels, err := c.Repository.ListUserBookings(userID, from, limit+1, func(booking BookingDBModel) bool {
+		return (filter.status == "" || booking.status(now) == filter.status) && booking.span().Overlaps(filter.span)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *uint64
+	if len(bookingDBModels) > limit {
+		bookingDBModels = bookingDBModels[:limit]
+		lastBookingID := bookingDBModels[limit-1].BookingID
+		next = &lastBookingID
+	}
+	bookings := make([]Booking, 0, len(bookingDBModels))
+	for _, bookingDBModel := range bookingDBModels {
+		bookings = append(bookings, bookingDBModel.booking(now))
+	}
+	return bookings, next, nil
+}
+
+// eraseUser hands the bookings of the user over to erasedUserID and returns
+// how many there were. Erasing twice is harmless.
+func (c *BookingService) eraseUser(userID uint64) (int, error) {
+	return c.Repository.ReassignUser(userID, erasedUserID)
+}
+
+// checkRental validates the request against the fleet catalog: the car must
+// exist, be in service and have no maintenance scheduled during span, and both
+// branches must be open at pickup and return time. It returns the car, which
+// is empty without a fleet catalog.
+func (c *BookingService) checkRental(carID uint64, span interval.Interval, route Route) (fleet.Car, error) {
+	if !span.Valid() {
+		return fleet.Car{}, interval.ErrInvalid
+	}
+	if c.Fleet == nil {
+		return fleet.Car{}, nil
+	}
+
+	car, err := c.Fleet.GetCar(carID)
+	if err == fleet.ErrCarNotFound {
+		return fleet.Car{}, unknownCar
+	}
+	if err != nil {
+		return fleet.Car{}, err
+	}
+	if car.Status == fleet.StatusRetired {
+		return fleet.Car{}, carRetired
+	}
+
+	err = c.checkLocation(route.Pickup, span.From)
+	if err != nil {
+		return fleet.Car{}, err
+	}
+	err = c.checkLocation(route.dropoff(), span.To)
+	if err != nil {
+		return fleet.Car{}, err
+	}
+
+	windows, err := c.Fleet.MaintenanceWindows(carID, span)
+	if err != nil {
+		return fleet.Car{}, err
+	}
+	if len(windows) > 0 {
+		return fleet.Car{}, carInMaintenance
+	}
+	return car, nil
+}
+
+// checkDriver returns *eligibility.Ineligible if the user holding token may
+// not drive car during span.
+func (c *BookingService) checkDriver(token string, car fleet.Car, span interval.Interval) error {
+	if c.Drivers == nil || c.Fleet == nil || len(c.Eligibility) == 0 {
+		return nil
+	}
+	driver, err := c.Drivers.Driver(token)
+	if err != nil {
+		return err
+	}
+	return c.Eligibility.Check(car.Class, driver, span)
+}
+
+func (c *BookingService) checkLocation(code string, minute uint64) error {
+	if code == "" {
+		return nil
+	}
+	location, err := c.Fleet.GetLocation(code)
+	if err == fleet.ErrLocationNotFound {
+		return unknownLocation
+	}
+	if err != nil {
+		return err
+	}
+	if !location.IsOpenAt(minute) {
+		return locationClosed
+	}
+	return nil
+}
+
+func (c *BookingService) setTurnaround(carID uint64, minutes uint64) error {
+	err := c.Repository.SetTurnaround(carID, minutes)
+	if err != nil {
+		return err
+	}
+	c.watchers.notify(carID)
+	return nil
+}
+
+// watchCar returns a channel that receives when a booking of the car is made
+// or its turnaround is changed through this instance, and the function that
+// stops the watch.
+func (c *BookingService) watchCar(carID uint64) (<-chan struct{}, func()) {
+	return c.watchers.watch(carID)
+}
+
+func (c *BookingService) turnaround(carID uint64) (uint64, error) {
+	minutes, ok, err := c.Repository.Turnaround(carID)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return c.DefaultTurnaround, nil
+	}
+	return minutes, nil
+}
 
-		return booking, err
+// IsCarFree reports whether the car has no booking intersecting the half-open
+// interval span, including the turnaround buffer between rentals, and will be
+// at the requested pickup location when the rental starts. Maintenance windows
+// from the fleet catalog count as occupied.
+func (c *BookingService) IsCarFree(carID uint64, span interval.Interval, route Route) (bool, error) {
+	car, err := c.checkRental(carID, span, route)
+	if err == carInMaintenance {
+		return false, nil
 	}
-	return Booking{}, bookingAlreadyExists
+	if err != nil {
+		return false, err
+	}
+
+	turnaround, err := c.turnaround(carID)
+	if err != nil {
+		return false, err
+	}
+
+	existing, err := c.Repository.CarBookings(carID)
+	if err != nil {
+		return false, err
+	}
+
+	return carIsFree(existing, span, route, car.HomeLocation, turnaround), nil
 }
 
-func (c *BookingService) IsCarFree(carID uint64, from, to uint64) bool {
-	tx := c.DB.NewTransaction(true)
-	defer tx.Discard()
-	it := tx.NewIterator(badger.DefaultIteratorOptions)
-	defer it.Close()
-	for it.Rewind(); it.Valid(); it.Next() {
-		item := it.Item()
-		value, err := item.ValueCopy(nil)
-		if err != nil {
-			return true
+// carIsFree checks span against the existing bookings of one car. The car is
+// expected at the return location of the last booking before span, or at home
+// if there is none, and the next booking must start where this one ends.
+// Bookings without locations match any route.
+func carIsFree(bookings []BookingDBModel, span interval.Interval, route Route, home string, turnaround uint64) bool {
+	var previous, next *BookingDBModel
+	for i := range bookings {
+		booking := &bookings[i]
+		existing := booking.span()
+		if existing.Pad(turnaround).Overlaps(span.Pad(turnaround)) {
+			return false
 		}
-		booking := &BookingDBModel{}
-		err = json.Unmarshal(value, booking)
-		if err != nil {
-			return true
+		if existing.To <= span.From && (previous == nil || existing.To > previous.span().To) {
+			previous = booking
 		}
-		if booking.CarID != carID {
-			continue
+		if existing.From >= span.To && (next == nil || existing.From < next.span().From) {
+			next = booking
 		}
-		if booking.From >= from && booking.From <= to {
-			return false
+	}
+
+	if route.Pickup != "" {
+		location := home
+		if previous != nil && previous.ReturnLocation != "" {
+			location = previous.ReturnLocation
 		}
-		if booking.To >= from && booking.To <= to {
+		if location != "" && location != route.Pickup {
 			return false
 		}
 	}
+	if route.dropoff() != "" && next != nil && next.PickupLocation != "" && next.PickupLocation != route.dropoff() {
+		return false
+	}
 	return true
 }
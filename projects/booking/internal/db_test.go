@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"distributed-rental/pkg/interval"
+	"go.uber.org/zap"
+	"testing"
+)
+
+// TestCarIsFree checks spans of car 1 against a booking from A to B in
+// [100, 200) and one from C to C in [400, 500).
+func TestCarIsFree(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		turnaround uint64
+		span       interval.Interval
+		route      Route
+		want       bool
+	}{
+		{name: "back to back after", span: interval.Interval{From: 200, To: 300}, want: true},
+		{name: "back to back before", span: interval.Interval{From: 50, To: 100}, want: true},
+		{name: "whole gap", span: interval.Interval{From: 200, To: 400}, want: true},
+		{name: "one minute over the end", span: interval.Interval{From: 199, To: 300}, want: false},
+		{name: "one minute over the start", span: interval.Interval{From: 50, To: 101}, want: false},
+		{name: "nested", span: interval.Interval{From: 120, To: 180}, want: false},
+		{name: "containing", span: interval.Interval{From: 50, To: 600}, want: false},
+		{name: "same", span: interval.Interval{From: 100, To: 200}, want: false},
+		{name: "other car's time", span: interval.Interval{From: 1000, To: 1100}, want: true},
+
+		{name: "inside turnaround after", turnaround: 30, span: interval.Interval{From: 200, To: 300}, want: false},
+		{name: "after turnaround", turnaround: 30, span: interval.Interval{From: 230, To: 300}, want: true},
+		{name: "turnaround before the next", turnaround: 30, span: interval.Interval{From: 230, To: 370}, want: true},
+		{name: "inside turnaround before the next", turnaround: 30, span: interval.Interval{From: 230, To: 371}, want: false},
+		{name: "turnaround before the first", turnaround: 30, span: interval.Interval{From: 0, To: 70}, want: true},
+		{name: "inside turnaround before the first", turnaround: 30, span: interval.Interval{From: 0, To: 71}, want: false},
+		{name: "gap shorter than turnaround", turnaround: 150, span: interval.Interval{From: 350, To: 360}, want: false},
+
+		{name: "pickup where returned", span: interval.Interval{From: 200, To: 300}, route: Route{Pickup: "B", Return: "C"}, want: true},
+		{name: "pickup elsewhere", span: interval.Interval{From: 200, To: 300}, route: Route{Pickup: "A", Return: "C"}, want: false},
+		{name: "return elsewhere", span: interval.Interval{From: 200, To: 300}, route: Route{Pickup: "B", Return: "D"}, want: false},
+		{name: "round trip away from the next pickup", span: interval.Interval{From: 200, To: 300}, route: Route{Pickup: "B"}, want: false},
+		{name: "after the last", span: interval.Interval{From: 600, To: 700}, route: Route{Pickup: "C", Return: "E"}, want: true},
+		{name: "before the first", span: interval.Interval{From: 0, To: 50}, route: Route{Pickup: "X", Return: "A"}, want: true},
+		{name: "before the first elsewhere", span: interval.Interval{From: 0, To: 50}, route: Route{Pickup: "X"}, want: false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			repository := NewMemoryBookingRepository()
+			for _, booking := range []BookingDBModel{
+				{BookingID: 1, CarID: 1, FromMinute: 100, ToMinute: 200, PickupLocation: "A", ReturnLocation: "B"},
+				{BookingID: 2, CarID: 1, FromMinute: 400, ToMinute: 500, PickupLocation: "C", ReturnLocation: "C"},
+				{BookingID: 3, CarID: 2, FromMinute: 1000, ToMinute: 1100},
+			} {
+				err := repository.CreateBooking(booking, func([]BookingDBModel) error { return nil })
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := repository.SetTurnaround(1, test.turnaround)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The default only applies to cars without their own turnaround.
+			bookingService := &BookingService{Repository: repository, Logger: zap.NewNop(), DefaultTurnaround: 1000}
+
+			free, err := bookingService.IsCarFree(1, test.span, test.route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if free != test.want {
+				t.Fatalf("IsCarFree(%v, %+v) = %v, want %v", test.span, test.route, free, test.want)
+			}
+		})
+	}
+}
+
+func TestCarIsFreeDefaultTurnaround(t *testing.T) {
+	repository := NewMemoryBookingRepository()
+	err := repository.CreateBooking(BookingDBModel{BookingID: 1, CarID: 1, FromMinute: 100, ToMinute: 200}, func([]BookingDBModel) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookingService := &BookingService{Repository: repository, Logger: zap.NewNop(), DefaultTurnaround: 30}
+	for span, want := range map[interval.Interval]bool{
+		{From: 229, To: 300}: false,
+		{From: 230, To: 300}: true,
+	} {
+		free, err := bookingService.IsCarFree(1, span, Route{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if free != want {
+			t.Errorf("IsCarFree(%v) = %v, want %v", span, free, want)
+		}
+	}
+
+	_, err = bookingService.IsCarFree(1, interval.Interval{From: 300, To: 300}, Route{})
+	if err != interval.ErrInvalid {
+		t.Fatalf("empty span: got %v, want %v", err, interval.ErrInvalid)
+	}
+}
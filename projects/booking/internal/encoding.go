@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"distributed-rental/pkg/interval"
+	"distributed-rental/pkg/record"
+	"encoding/json"
+	"fmt"
+)
+
+// bookingSchemaVersion is what encodeBooking writes. Version 0 is the original
+// JSON layout, which drops zero fields and predates minute resolution.
+const bookingSchemaVersion = 1
+
+// Field numbers of the version 1 booking record. Never reuse a number.
+const (
+	bookingCarIDField           = 1
+	bookingUserIDField          = 2
+	bookingIDField              = 3
+	bookingFromDayField         = 4
+	bookingToDayField           = 5
+	bookingFromMinuteField      = 6
+	bookingToMinuteField        = 7
+	bookingPickupLocationField  = 8
+	bookingReturnLocationField  = 9
+	bookingOneWaySurchargeField = 10
+)
+
+func encodeBooking(booking BookingDBModel) []byte {
+	e := record.Encoder{}
+	e.Uint64(bookingCarIDField, booking.CarID)
+	e.Uint64(bookingUserIDField, booking.UserID)
+	e.Uint64(bookingIDField, booking.BookingID)
+	e.Uint64(bookingFromDayField, booking.From)
+	e.Uint64(bookingToDayField, booking.To)
+	e.Uint64(bookingFromMinuteField, booking.FromMinute)
+	e.Uint64(bookingToMinuteField, booking.ToMinute)
+	e.String(bookingPickupLocationField, booking.PickupLocation)
+	e.String(bookingReturnLocationField, booking.ReturnLocation)
+	e.Uint64(bookingOneWaySurchargeField, booking.OneWaySurcharge)
+	return record.Seal(bookingSchemaVersion, e.Bytes())
+}
+
+// decodeBooking reads a stored booking of any known schema version and
+// upgrades it to the current model.
+func decodeBooking(data []byte) (BookingDBModel, error) {
+	version, payload, err := record.Open(data)
+	if err != nil {
+		return BookingDBModel{}, err
+	}
+
+	booking := BookingDBModel{}
+	switch version {
+	case 0:
+		err = json.Unmarshal(payload, &booking)
+		if err != nil {
+			return BookingDBModel{}, err
+		}
+		if booking.ToMinute == 0 {
+			span := interval.FromDays(booking.From, booking.To)
+			booking.FromMinute, booking.ToMinute = span.From, span.To
+		}
+	case 1:
+		err = record.Walk(payload, func(f record.Field) error {
+			switch f.Number {
+			case bookingCarIDField:
+				booking.CarID = f.Varint
+			case bookingUserIDField:
+				booking.UserID = f.Varint
+			case bookingIDField:
+				booking.BookingID = f.Varint
+			case bookingFromDayField:
+				booking.From = f.Varint
+			case bookingToDayField:
+				booking.To = f.Varint
+			case bookingFromMinuteField:
+				booking.FromMinute = f.Varint
+			case bookingToMinuteField:
+				booking.ToMinute = f.Varint
+			case bookingPickupLocationField:
+				booking.PickupLocation = f.String()
+			case bookingReturnLocationField:
+				booking.ReturnLocation = f.String()
+			case bookingOneWaySurchargeField:
+				booking.OneWaySurcharge = f.Varint
+			}
+			return nil
+		})
+		if err != nil {
+			return BookingDBModel{}, err
+		}
+	default:
+		return BookingDBModel{}, fmt.Errorf("booking record has unknown schema version %d", version)
+	}
+	return booking, nil
+}
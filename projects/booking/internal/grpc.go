@@ -0,0 +1,329 @@
+package internal
+
+import (
+	"context"
+	"distributed-rental/pkg/apikey"
+	"distributed-rental/pkg/interval"
+	"distributed-rental/pkg/ratelimit"
+	"distributed-rental/pkg/rpc"
+	"distributed-rental/pkg/servicetoken"
+	"distributed-rental/projects/booking/bookingpb"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"net/http"
+	"time"
+)
+
+// GrpcServer serves the booking API over gRPC next to an HttpServer, with the
+// same credentials, rate limiter and TLS.
+type GrpcServer struct {
+	bookingpb.UnimplementedBookingServiceServer
+
+	addr           string
+	server         *grpc.Server
+	httpServer     *HttpServer
+	bookingService *BookingService
+	logger         *zap.SugaredLogger
+	watchInterval  time.Duration
+	closing        chan struct{}
+}
+
+// NewGrpcServer creates a gRPC server for the service of httpServer. Call it
+// once httpServer has its TLS config and rate limiter.
+func NewGrpcServer(addr string, httpServer *HttpServer) *GrpcServer {
+	grpcServer := &GrpcServer{
+		addr:           addr,
+		httpServer:     httpServer,
+		bookingService: httpServer.bookingService,
+		logger:         httpServer.logger,
+		watchInterval:  30 * time.Second,
+		closing:        make(chan struct{}),
+	}
+
+	guard := &rpc.Guard{
+		Authenticate: grpcServer.authenticate,
+		Limiter:      httpServer.limiter,
+		Key:          ratelimit.UserOrIP(httpServer.jwtSigningKey),
+		Logger:       httpServer.logger,
+	}
+	options := []grpc.ServerOption{grpc.UnaryInterceptor(guard.Unary()), grpc.StreamInterceptor(guard.Stream())}
+	if httpServer.server.TLSConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(httpServer.server.TLSConfig)))
+	}
+	grpcServer.server = grpc.NewServer(options...)
+	bookingpb.RegisterBookingServiceServer(grpcServer.server, grpcServer)
+	return grpcServer
+}
+
+// SetWatchInterval sets how often WatchAvailability checks the car again for
+// changes made elsewhere: through other instances or in the fleet service.
+func (c *GrpcServer) SetWatchInterval(interval time.Duration) {
+	c.watchInterval = interval
+}
+
+func (c *GrpcServer) ListenAndServe() error {
+	listener, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	return c.server.Serve(listener)
+}
+
+// Shutdown ends the availability streams, stops accepting connections and
+// waits for running calls until ctx is done, then closes them.
+func (c *GrpcServer) Shutdown(ctx context.Context) error {
+	close(c.closing)
+	stopped := make(chan struct{})
+	go func() {
+		c.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		c.server.Stop()
+		return ctx.Err()
+	}
+}
+
+type grpcUserKey struct{}
+
+// grpcUser is the caller of a user RPC and the credential to look the driver
+// up with, or the admin on the RPCs that also take the admin token.
+type grpcUser struct {
+	UserAuthObject
+	credential string
+	admin      bool
+}
+
+// authenticate lets each RPC take the credentials of its HTTP route.
+func (c *GrpcServer) authenticate(ctx context.Context, method string, r *http.Request) (context.Context, error) {
+	switch method {
+	case bookingpb.BookingService_CreateBooking_FullMethodName:
+		return c.authUser(ctx, r, servicetoken.ScopeBookingWrite)
+	case bookingpb.BookingService_GetBooking_FullMethodName:
+		if c.httpServer.checkAdmin(r) {
+			return context.WithValue(ctx, grpcUserKey{}, grpcUser{admin: true}), nil
+		}
+		return c.authUser(ctx, r, servicetoken.ScopeBookingRead)
+	case bookingpb.BookingService_MyBookings_FullMethodName, bookingpb.BookingService_CheckCar_FullMethodName, bookingpb.BookingService_WatchAvailability_FullMethodName:
+		return c.authUser(ctx, r, servicetoken.ScopeBookingRead)
+	case bookingpb.BookingService_CarBookings_FullMethodName:
+		return c.authService(ctx, r, servicetoken.ScopeBookingRead)
+	case bookingpb.BookingService_SetTurnaround_FullMethodName:
+		return c.authService(ctx, r, servicetoken.ScopeBookingWrite)
+	case bookingpb.BookingService_UserBookings_FullMethodName, bookingpb.BookingService_EraseUser_FullMethodName:
+		if !c.httpServer.checkAdmin(r) {
+			return nil, rpc.Error(http.StatusUnauthorized, errors.New("wrong admin token"))
+		}
+		return ctx, nil
+	}
+	return nil, status.Errorf(codes.Unimplemented, "unknown method %s", method)
+}
+
+func (c *GrpcServer) authUser(ctx context.Context, r *http.Request, scope string) (context.Context, error) {
+	userAuth, credential, err := c.httpServer.checkUser(r, scope)
+	if err != nil {
+		return nil, rpc.Error(apikey.Status(err), err)
+	}
+	return context.WithValue(ctx, grpcUserKey{}, grpcUser{UserAuthObject: userAuth, credential: credential}), nil
+}
+
+func (c *GrpcServer) authService(ctx context.Context, r *http.Request, scope string) (context.Context, error) {
+	_, err := c.httpServer.checkService(r, scope)
+	if err != nil {
+		return nil, rpc.Error(servicetoken.Status(err), err)
+	}
+	return ctx, nil
+}
+
+// error answers an RPC the booking service failed, logging what the caller
+// is not shown.
+func (c *GrpcServer) error(name string, err error) error {
+	httpStatus := errorStatus(err)
+	if httpStatus == http.StatusInternalServerError {
+		c.logger.Errorf("%s error: %v", name, err)
+	}
+	return rpc.Error(httpStatus, err)
+}
+
+func (c *GrpcServer) CreateBooking(ctx context.Context, request *bookingpb.CreateBookingRequest) (*bookingpb.Booking, error) {
+	c.logger.Infof("got grpc request for create booking")
+	user := ctx.Value(grpcUserKey{}).(grpcUser)
+
+	span := requestInterval(request.FromDay, request.ToDay, request.FromMinute, request.ToMinute, requestTime(request.From), requestTime(request.To))
+	route := Route{Pickup: request.PickupLocation, Return: request.ReturnLocation}
+	booking, err := c.bookingService.createBooking(user.UserID, user.credential, request.CarId, span, route)
+	if err != nil {
+		return nil, c.error("create booking", err)
+	}
+	return bookingMessage(booking), nil
+}
+
+func (c *GrpcServer) GetBooking(ctx context.Context, request *bookingpb.GetBookingRequest) (*bookingpb.Booking, error) {
+	c.logger.Infof("got grpc request for get booking")
+	user := ctx.Value(grpcUserKey{}).(grpcUser)
+
+	var booking Booking
+	var err error
+	if user.admin {
+		booking, err = c.bookingService.getBooking(request.BookingId)
+	} else {
+		booking, err = c.bookingService.userBooking(user.UserID, request.BookingId)
+	}
+	if err != nil {
+		return nil, c.error("get booking", err)
+	}
+	return bookingMessage(booking), nil
+}
+
+func (c *GrpcServer) MyBookings(ctx context.Context, request *bookingpb.MyBookingsRequest) (*bookingpb.BookingPage, error) {
+	c.logger.Infof("got grpc request for my bookings")
+	user := ctx.Value(grpcUserKey{}).(grpcUser)
+
+	limit := int(request.Limit)
+	if limit <= 0 || limit > defaultMyBookingsLimit {
+		limit = defaultMyBookingsLimit
+	}
+	filter := bookingFilter{status: request.Status, span: requestRange(requestTime(request.From), requestTime(request.To))}
+	bookings, next, err := c.bookingService.listUserBookings(user.UserID, request.Cursor, limit, filter)
+	if err != nil {
+		return nil, c.error("my bookings", err)
+	}
+	return &bookingpb.BookingPage{Bookings: bookingList(bookings).Bookings, NextCursor: next}, nil
+}
+
+func (c *GrpcServer) CheckCar(ctx context.Context, request *bookingpb.CheckCarRequest) (*bookingpb.CheckCarResponse, error) {
+	c.logger.Infof("got grpc request for check car")
+	span, route := checkCarInterval(request)
+	isFree, err := c.bookingService.IsCarFree(request.CarId, span, route)
+	if err != nil {
+		return nil, c.error("check car", err)
+	}
+	return &bookingpb.CheckCarResponse{IsFree: isFree}, nil
+}
+
+// WatchAvailability sends whether the car is free now and again whenever
+// that changes. Bookings made through this instance are seen at once; those
+// made through other instances and maintenance scheduled in the fleet service
+// are seen at the next check, every watch interval.
+func (c *GrpcServer) WatchAvailability(request *bookingpb.CheckCarRequest, stream bookingpb.BookingService_WatchAvailabilityServer) error {
+	c.logger.Infof("got grpc request for watch availability")
+	span, route := checkCarInterval(request)
+
+	changed, stop := c.bookingService.watchCar(request.CarId)
+	defer stop()
+	ticker := time.NewTicker(c.watchInterval)
+	defer ticker.Stop()
+
+	sent, wasFree := false, false
+	for {
+		isFree, err := c.bookingService.IsCarFree(request.CarId, span, route)
+		if err != nil {
+			return c.error("watch availability", err)
+		}
+		if !sent || isFree != wasFree {
+			err = stream.Send(&bookingpb.AvailabilityChange{IsFree: isFree, Time: timestamppb.Now()})
+			if err != nil {
+				return err
+			}
+			sent, wasFree = true, isFree
+		}
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return nil
+		case <-c.closing:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+func (c *GrpcServer) CarBookings(ctx context.Context, request *bookingpb.CarBookingsRequest) (*bookingpb.BookingList, error) {
+	c.logger.Infof("got grpc request for car bookings")
+	bookings, err := c.bookingService.carBookings(request.CarId, request.FromMinute)
+	if err != nil {
+		return nil, c.error("car bookings", err)
+	}
+	return bookingList(bookings), nil
+}
+
+func (c *GrpcServer) SetTurnaround(ctx context.Context, request *bookingpb.SetTurnaroundRequest) (*bookingpb.SetTurnaroundResponse, error) {
+	c.logger.Infof("got grpc request for set turnaround")
+	err := c.bookingService.setTurnaround(request.CarId, request.Minutes)
+	if err != nil {
+		return nil, c.error("set turnaround", err)
+	}
+	return &bookingpb.SetTurnaroundResponse{}, nil
+}
+
+func (c *GrpcServer) UserBookings(ctx context.Context, request *bookingpb.UserRequest) (*bookingpb.BookingList, error) {
+	c.logger.Infof("got grpc request for user bookings")
+	if request.UserId == nil {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	bookings, err := c.bookingService.userBookings(*request.UserId)
+	if err != nil {
+		return nil, c.error("user bookings", err)
+	}
+	return bookingList(bookings), nil
+}
+
+func (c *GrpcServer) EraseUser(ctx context.Context, request *bookingpb.UserRequest) (*bookingpb.EraseUserResponse, error) {
+	c.logger.Infof("got grpc request for erase user")
+	if request.UserId == nil {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	erased, err := c.bookingService.eraseUser(*request.UserId)
+	if err != nil {
+		return nil, c.error("erase user", err)
+	}
+	return &bookingpb.EraseUserResponse{Erased: int64(erased)}, nil
+}
+
+func checkCarInterval(request *bookingpb.CheckCarRequest) (interval.Interval, Route) {
+	span := requestInterval(request.FromDay, request.ToDay, request.FromMinute, request.ToMinute, requestTime(request.From), requestTime(request.To))
+	return span, Route{Pickup: request.PickupLocation, Return: request.ReturnLocation}
+}
+
+// requestTime is the time of an optional timestamp field, nil if unset.
+func requestTime(timestamp *timestamppb.Timestamp) *time.Time {
+	if timestamp == nil {
+		return nil
+	}
+	t := timestamp.AsTime()
+	return &t
+}
+
+func bookingMessage(booking Booking) *bookingpb.Booking {
+	return &bookingpb.Booking{
+		CarId:           booking.CarID,
+		UserId:          booking.UserID,
+		BookingId:       booking.BookingID,
+		FromDay:         booking.From,
+		ToDay:           booking.To,
+		FromMinute:      booking.FromMinute,
+		ToMinute:        booking.ToMinute,
+		PickupLocation:  booking.PickupLocation,
+		ReturnLocation:  booking.ReturnLocation,
+		OneWaySurcharge: booking.OneWaySurcharge,
+		Status:          booking.Status,
+	}
+}
+
+func bookingList(bookings []Booking) *bookingpb.BookingList {
+	list := &bookingpb.BookingList{}
+	for _, booking := range bookings {
+		list.Bookings = append(list.Bookings, bookingMessage(booking))
+	}
+	return list
+}
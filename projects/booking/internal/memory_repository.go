@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// MemoryBookingRepository keeps bookings in process memory. It is meant for
+// tests and local runs; everything is lost on restart.
+type MemoryBookingRepository struct {
+	mu            sync.Mutex
+	lastBookingID uint64
+	bookings      map[uint64][]BookingDBModel
+	turnarounds   map[uint64]uint64
+}
+
+func NewMemoryBookingRepository() *MemoryBookingRepository {
+	return &MemoryBookingRepository{
+		bookings:    map[uint64][]BookingDBModel{},
+		turnarounds: map[uint64]uint64{},
+	}
+}
+
+func (c *MemoryBookingRepository) NextBookingID() (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastBookingID++
+	return c.lastBookingID, nil
+}
+
+func (c *MemoryBookingRepository) CarBookings(carID uint64) ([]BookingDBModel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]BookingDBModel{}, c.bookings[carID]...), nil
+}
+
+func (c *MemoryBookingRepository) GetBooking(bookingID uint64) (BookingDBModel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, carBookings := range c.bookings {
+		for _, booking := range carBookings {
+			if booking.BookingID == bookingID {
+				return booking, nil
+			}
+		}
+	}
+	return BookingDBModel{}, bookingNotFound
+}
+
+func (c *MemoryBookingRepository) UserBookings(userID uint64) ([]BookingDBModel, error) {
+	return c.ListUserBookings(userID, 0, math.MaxInt, func(BookingDBModel) bool { return true })
+}
+
+func (c *MemoryBookingRepository) ListUserBookings(userID uint64, from uint64, limit int, match func(booking BookingDBModel) bool) ([]BookingDBModel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bookings := []BookingDBModel{}
+	for _, carBookings := range c.bookings {
+		for _, booking := range carBookings {
+			if booking.UserID == userID && booking.BookingID >= from && match(booking) {
+				bookings = append(bookings, booking)
+			}
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].BookingID < bookings[j].BookingID })
+	if len(bookings) > limit {
+		bookings = bookings[:limit]
+	}
+	return bookings, nil
+}
+
+func (c *MemoryBookingRepository) ReassignUser(userID uint64, newUserID uint64) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	moved := 0
+	for _, carBookings := range c.bookings {
+		for i := range carBookings {
+			if carBookings[i].UserID == userID {
+				carBookings[i].UserID = newUserID
+				moved++
+			}
+		}
+	}
+	return moved, nil
+}
+
+func (c *MemoryBookingRepository) CreateBooking(booking BookingDBModel, check func(existing []BookingDBModel) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := check(append([]BookingDBModel{}, c.bookings[booking.CarID]...))
+	if err != nil {
+		return err
+	}
+	c.bookings[booking.CarID] = append(c.bookings[booking.CarID], booking)
+	return nil
+}
+
+func (c *MemoryBookingRepository) Turnaround(carID uint64) (uint64, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	minutes, ok := c.turnarounds[carID]
+	return minutes, ok, nil
+}
+
+func (c *MemoryBookingRepository) SetTurnaround(carID uint64, minutes uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.turnarounds[carID] = minutes
+	return nil
+}
+
+func (c *MemoryBookingRepository) Close() error {
+	return nil
+}
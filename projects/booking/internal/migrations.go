@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"bytes"
+	"distributed-rental/pkg/migrate"
+	"regexp"
+)
+
+// bookingKeyPattern matches "<car_id>_<from>_<to>" booking keys.
+var bookingKeyPattern = regexp.MustCompile(`^\d+_\d+_\d+$`)
+
+// BadgerMigrations upgrade the badger key layout and records in order. Append
+// new migrations with the next version; never change or reorder old ones.
+var BadgerMigrations = []migrate.Migration{
+	{
+		Version: 1,
+		Name:    "encode bookings as binary records",
+		Rewrite: func(key, value []byte) ([]byte, []byte, bool, error) {
+			if !bookingKeyPattern.Match(key) || len(value) == 0 || value[0] != '{' {
+				return nil, nil, false, nil
+			}
+			booking, err := decodeBooking(value)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			return key, encodeBooking(booking), true, nil
+		},
+	},
+	{
+		// Bookings made before minute resolution are keyed by day numbers,
+		// which collide with minute keys of the same digits.
+		Version: 2,
+		Name:    "key bookings by minutes",
+		Rewrite: func(key, value []byte) ([]byte, []byte, bool, error) {
+			if !bookingKeyPattern.Match(key) {
+				return nil, nil, false, nil
+			}
+			booking, err := decodeBooking(value)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			newKey := getKey(booking.CarID, booking.FromMinute, booking.ToMinute)
+			if bytes.Equal(newKey, key) {
+				return nil, nil, false, nil
+			}
+			return newKey, value, true, nil
+		},
+	},
+	{
+		Version: 3,
+		Name:    "index bookings by booking_id and user_id",
+		Derive: func(key, value []byte) ([]migrate.Record, error) {
+			if !bookingKeyPattern.Match(key) {
+				return nil, nil
+			}
+			booking, err := decodeBooking(value)
+			if err != nil {
+				return nil, err
+			}
+			records := []migrate.Record{}
+			for indexKey, value := range bookingIndex(key, booking) {
+				records = append(records, migrate.Record{Key: []byte(indexKey), Value: value})
+			}
+			return records, nil
+		},
+	},
+}
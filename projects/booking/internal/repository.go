@@ -0,0 +1,28 @@
+package internal
+
+// BookingRepository is the storage behind BookingService.
+type BookingRepository interface {
+	// NextBookingID returns a booking id that has not been issued before.
+	NextBookingID() (uint64, error)
+	// CarBookings returns every stored booking of the car.
+	CarBookings(carID uint64) ([]BookingDBModel, error)
+	// GetBooking returns bookingNotFound for unknown ids.
+	GetBooking(bookingID uint64) (BookingDBModel, error)
+	// UserBookings returns every stored booking of the user, ordered by id.
+	UserBookings(userID uint64) ([]BookingDBModel, error)
+	// ListUserBookings returns up to limit bookings of the user with ids from
+	// from on, ordered by id, that match accepts.
+	ListUserBookings(userID uint64, from uint64, limit int, match func(booking BookingDBModel) bool) ([]BookingDBModel, error)
+	// ReassignUser moves every booking of userID to newUserID and returns how
+	// many it moved.
+	ReassignUser(userID uint64, newUserID uint64) (int, error)
+	// CreateBooking stores booking unless check rejects it. check receives the
+	// car's current bookings and runs in the same transaction as the write,
+	// serialized with other writes to the car, so two overlapping bookings can
+	// not both be accepted even when made at the same time.
+	CreateBooking(booking BookingDBModel, check func(existing []BookingDBModel) error) error
+	// Turnaround returns the car's own turnaround buffer; ok is false if none is set.
+	Turnaround(carID uint64) (minutes uint64, ok bool, err error)
+	SetTurnaround(carID uint64, minutes uint64) error
+	Close() error
+}
@@ -0,0 +1,332 @@
+package internal
+
+import (
+	"distributed-rental/pkg/interval"
+	"github.com/dgraph-io/badger/v3"
+	"math"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// repositories opens an empty repository of every backend.
+var repositories = map[string]func(t *testing.T) BookingRepository{
+	"memory": func(t *testing.T) BookingRepository {
+		return NewMemoryBookingRepository()
+	},
+	"sqlite": func(t *testing.T) BookingRepository {
+		repository, err := NewSQLiteBookingRepository(filepath.Join(t.TempDir(), "booking.sqlite"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { repository.Close() })
+		return repository
+	},
+	"badger": func(t *testing.T) BookingRepository {
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		repository, err := NewBadgerBookingRepository(db, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			repository.Close()
+			db.Close()
+		})
+		return repository
+	},
+}
+
+// forEachRepository runs test against every backend, so that they all keep
+// the BookingRepository contract.
+func forEachRepository(t *testing.T, test func(t *testing.T, repository BookingRepository)) {
+	for name, open := range repositories {
+		t.Run(name, func(t *testing.T) {
+			test(t, open(t))
+		})
+	}
+}
+
+func testBooking(bookingID, userID, carID, from, to uint64) BookingDBModel {
+	span := interval.Interval{From: from, To: to}
+	return BookingDBModel{
+		BookingID:  bookingID,
+		UserID:     userID,
+		CarID:      carID,
+		From:       span.FromDay(),
+		To:         span.ToDay(),
+		FromMinute: from,
+		ToMinute:   to,
+	}
+}
+
+// rejectOverlap is the check of createBooking without locations and turnaround.
+func rejectOverlap(booking BookingDBModel) func(existing []BookingDBModel) error {
+	return func(existing []BookingDBModel) error {
+		if !carIsFree(existing, booking.span(), Route{}, "", 0) {
+			return bookingAlreadyExists
+		}
+		return nil
+	}
+}
+
+func create(t *testing.T, repository BookingRepository, booking BookingDBModel) {
+	t.Helper()
+	err := repository.CreateBooking(booking, rejectOverlap(booking))
+	if err != nil {
+		t.Fatalf("create booking %d: %v", booking.BookingID, err)
+	}
+}
+
+func bookingIDs(bookings []BookingDBModel) []uint64 {
+	ids := []uint64{}
+	for _, booking := range bookings {
+		ids = append(ids, booking.BookingID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRepositoryNextBookingID(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository BookingRepository) {
+		seen := map[uint64]bool{}
+		for i := 0; i < 25; i++ {
+			bookingID, err := repository.NextBookingID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen[bookingID] {
+				t.Fatalf("booking id %d issued twice", bookingID)
+			}
+			seen[bookingID] = true
+		}
+	})
+}
+
+func TestRepositoryCreateBooking(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository BookingRepository) {
+		create(t, repository, testBooking(1, 7, 42, 100, 200))
+		create(t, repository, testBooking(2, 7, 42, 200, 300))
+		create(t, repository, testBooking(3, 8, 43, 100, 200))
+
+		err := repository.CreateBooking(testBooking(4, 8, 42, 150, 250), rejectOverlap(testBooking(4, 8, 42, 150, 250)))
+		if err != bookingAlreadyExists {
+			t.Fatalf("overlapping booking: got %v, want %v", err, bookingAlreadyExists)
+		}
+
+		bookings, err := repository.CarBookings(42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bookings) != 2 {
+			t.Fatalf("car 42 has %d bookings, want 2", len(bookings))
+		}
+		booking, err := repository.GetBooking(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if booking != testBooking(2, 7, 42, 200, 300) {
+			t.Fatalf("got %+v", booking)
+		}
+		_, err = repository.GetBooking(4)
+		if err != bookingNotFound {
+			t.Fatalf("rejected booking: got %v, want %v", err, bookingNotFound)
+		}
+		_, err = repository.GetBooking(math.MaxUint64)
+		if err != bookingNotFound {
+			t.Fatalf("unknown booking: got %v, want %v", err, bookingNotFound)
+		}
+	})
+}
+
+// TestRepositoryConcurrentOverlap makes two overlapping bookings of each car,
+// with the same interval for even cars, at the same time: exactly one of them
+// has to be accepted.
+func TestRepositoryConcurrentOverlap(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository BookingRepository) {
+		const cars = 50
+		var wg sync.WaitGroup
+		errs := make(chan error, 2*cars)
+		for carID := uint64(1); carID <= cars; carID++ {
+			for _, booking := range []BookingDBModel{
+				testBooking(carID*2, 1, carID, 100, 200),
+				testBooking(carID*2+1, 2, carID, 100+carID%2*50, 200+carID%2*50),
+			} {
+				wg.Add(1)
+				go func(booking BookingDBModel) {
+					defer wg.Done()
+					err := repository.CreateBooking(booking, rejectOverlap(booking))
+					if err != nil && err != bookingAlreadyExists {
+						errs <- err
+					}
+				}(booking)
+			}
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+
+		for carID := uint64(1); carID <= cars; carID++ {
+			bookings, err := repository.CarBookings(carID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bookings) != 1 {
+				t.Fatalf("car %d has %d bookings, want 1", carID, len(bookings))
+			}
+		}
+	})
+}
+
+func TestRepositoryUserBookings(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository BookingRepository) {
+		create(t, repository, testBooking(5, 7, 1, 100, 200))
+		create(t, repository, testBooking(2, 7, 2, 100, 200))
+		create(t, repository, testBooking(9, 8, 3, 100, 200))
+		create(t, repository, testBooking(4, 7, 3, 300, 400))
+
+		bookings, err := repository.UserBookings(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := bookingIDs(bookings); !equalIDs(ids, []uint64{2, 4, 5}) {
+			t.Fatalf("user bookings: got %v", ids)
+		}
+
+		all := func(BookingDBModel) bool { return true }
+		bookings, err = repository.ListUserBookings(7, 3, 1, all)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := bookingIDs(bookings); !equalIDs(ids, []uint64{4}) {
+			t.Fatalf("page from 3: got %v", ids)
+		}
+		onCar1 := func(booking BookingDBModel) bool { return booking.CarID == 1 }
+		bookings, err = repository.ListUserBookings(7, 0, 10, onCar1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := bookingIDs(bookings); !equalIDs(ids, []uint64{5}) {
+			t.Fatalf("matching bookings: got %v", ids)
+		}
+		bookings, err = repository.ListUserBookings(7, math.MaxUint64, 10, all)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bookings) != 0 {
+			t.Fatalf("page from the last id: got %v", bookingIDs(bookings))
+		}
+
+		moved, err := repository.ReassignUser(7, erasedUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if moved != 3 {
+			t.Fatalf("moved %d bookings, want 3", moved)
+		}
+		bookings, err = repository.UserBookings(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bookings) != 0 {
+			t.Fatalf("erased user still has bookings %v", bookingIDs(bookings))
+		}
+		bookings, err = repository.UserBookings(erasedUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := bookingIDs(bookings); !equalIDs(ids, []uint64{2, 4, 5}) {
+			t.Fatalf("reassigned bookings: got %v", ids)
+		}
+		booking, err := repository.GetBooking(5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if booking.UserID != erasedUserID {
+			t.Fatalf("booking 5 belongs to %d", booking.UserID)
+		}
+
+		moved, err = repository.ReassignUser(7, erasedUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if moved != 0 {
+			t.Fatalf("second erase moved %d bookings", moved)
+		}
+	})
+}
+
+func TestRepositoryTurnaround(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository BookingRepository) {
+		_, ok, err := repository.Turnaround(42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Fatal("turnaround set before SetTurnaround")
+		}
+		for _, minutes := range []uint64{30, 0} {
+			err = repository.SetTurnaround(42, minutes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok, err := repository.Turnaround(42)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || got != minutes {
+				t.Fatalf("turnaround: got %d, %v, want %d", got, ok, minutes)
+			}
+		}
+	})
+}
+
+// TestRepositoryLargeIDs looks up ids that do not fit into an int64, which
+// SQLite can not store.
+func TestRepositoryLargeIDs(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository BookingRepository) {
+		bookings, err := repository.CarBookings(math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bookings) != 0 {
+			t.Fatalf("car with the largest id has bookings %v", bookingIDs(bookings))
+		}
+		bookings, err = repository.UserBookings(math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bookings) != 0 {
+			t.Fatalf("user with the largest id has bookings %v", bookingIDs(bookings))
+		}
+		moved, err := repository.ReassignUser(math.MaxUint64, erasedUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if moved != 0 {
+			t.Fatalf("moved %d bookings of an unknown user", moved)
+		}
+		_, ok, err := repository.Turnaround(math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Fatal("turnaround set for the largest car id")
+		}
+	})
+}
@@ -1,12 +1,25 @@
 package internal
 
 import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"distributed-rental/pkg/apikey"
+	"distributed-rental/pkg/eligibility"
+	"distributed-rental/pkg/interval"
+	"distributed-rental/pkg/openapi"
+	"distributed-rental/pkg/ratelimit"
+	"distributed-rental/pkg/rest"
+	"distributed-rental/pkg/servicetoken"
+	"distributed-rental/pkg/usertoken"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt"
 	"go.uber.org/zap"
-	"io/ioutil"
+	"math"
 	"net/http"
+	"time"
 )
 
 type HttpServer struct {
@@ -14,6 +27,10 @@ type HttpServer struct {
 	bookingService *BookingService
 	logger         *zap.SugaredLogger
 	jwtSigningKey  []byte
+	tokenVerifier  TokenVerifier
+	keyVerifier    KeyVerifier
+	limiter        *ratelimit.Limiter
+	adminToken     []byte
 }
 
 func NewHttpServer(addr string, bookingService *BookingService, jwtSecret []byte, logger *zap.SugaredLogger) *HttpServer {
@@ -31,6 +48,15 @@ func NewHttpServer(addr string, bookingService *BookingService, jwtSecret []byte
 	mux := http.NewServeMux()
 	mux.HandleFunc("/create_booking", httpServer.createBooking)
 	mux.HandleFunc("/check_car", httpServer.checkCar)
+	mux.HandleFunc("/set_turnaround", httpServer.setTurnaround)
+	mux.HandleFunc("/car_bookings", httpServer.carBookings)
+	mux.HandleFunc("/admin/user_bookings", httpServer.userBookings)
+	mux.HandleFunc("/admin/erase_user", httpServer.eraseUser)
+	mux.HandleFunc("GET /bookings/{booking_id}", httpServer.getBooking)
+	mux.HandleFunc("GET /my_bookings", httpServer.myBookings)
+
+	openapi.Register(mux, httpServer.operations())
+	mux.HandleFunc("GET /openapi.json", openapi.Handler(OpenAPI()))
 
 	httpServer.server.Handler = mux
 
@@ -38,30 +64,106 @@ func NewHttpServer(addr string, bookingService *BookingService, jwtSecret []byte
 }
 
 type createBookingRequest struct {
-	CarID uint64 `json:"car_id"`
-	From  uint64 `json:"from_day"`
-	To    uint64 `json:"to_day"`
+	CarID          uint64     `json:"car_id"`
+	From           uint64     `json:"from_day"`
+	To             uint64     `json:"to_day"`
+	FromMinute     uint64     `json:"from_minute"`
+	ToMinute       uint64     `json:"to_minute"`
+	FromTime       *time.Time `json:"from"`
+	ToTime         *time.Time `json:"to"`
+	PickupLocation string     `json:"pickup_location"`
+	ReturnLocation string     `json:"return_location"`
 }
 
 type createBookingResponse struct {
-	UserID    uint64 `json:"user_id"`
-	CarID     uint64 `json:"car_id"`
-	BookingID uint64 `json:"booking_id"`
-	From      uint64 `json:"from_day"`
-	To        uint64 `json:"to_day"`
+	UserID          uint64 `json:"user_id"`
+	CarID           uint64 `json:"car_id"`
+	BookingID       uint64 `json:"booking_id"`
+	From            uint64 `json:"from_day"`
+	To              uint64 `json:"to_day"`
+	FromMinute      uint64 `json:"from_minute"`
+	ToMinute        uint64 `json:"to_minute"`
+	PickupLocation  string `json:"pickup_location,omitempty"`
+	ReturnLocation  string `json:"return_location,omitempty"`
+	OneWaySurcharge uint64 `json:"one_way_surcharge"`
 }
 
 type checkCarRequest struct {
-	CarID uint64 `json:"car_id"`
-	From  uint64 `json:"from_day"`
-	To    uint64 `json:"to_day"`
+	CarID          uint64     `json:"car_id"`
+	From           uint64     `json:"from_day"`
+	To             uint64     `json:"to_day"`
+	FromMinute     uint64     `json:"from_minute"`
+	ToMinute       uint64     `json:"to_minute"`
+	FromTime       *time.Time `json:"from"`
+	ToTime         *time.Time `json:"to"`
+	PickupLocation string     `json:"pickup_location"`
+	ReturnLocation string     `json:"return_location"`
+}
+
+type carBookingsRequest struct {
+	CarID      uint64 `json:"car_id"`
+	FromMinute uint64 `json:"from_minute"`
+}
+
+type carBookingsResponse struct {
+	Bookings []Booking `json:"bookings"`
+}
+
+type setTurnaroundRequest struct {
+	CarID   uint64 `json:"car_id"`
+	Minutes uint64 `json:"minutes"`
+}
+
+// requestInterval returns the requested minutes. RFC 3339 times take
+// precedence, then minute fields; otherwise the legacy inclusive day range is
+// used. A request with only one of from and to gets an empty interval, which
+// is rejected as invalid.
+func requestInterval(fromDay, toDay, fromMinute, toMinute uint64, from, to *time.Time) interval.Interval {
+	if from != nil || to != nil {
+		if from == nil || to == nil {
+			return interval.Interval{}
+		}
+		return interval.FromTimes(*from, *to)
+	}
+	if toMinute != 0 {
+		return interval.Interval{From: fromMinute, To: toMinute}
+	}
+	return interval.FromDays(fromDay, toDay)
+}
+
+// isBadRequest reports whether err was caused by the request rather than the service.
+func isBadRequest(err error) bool {
+	switch err {
+	case interval.ErrInvalid, unknownStatus, unknownCar, carRetired, unknownLocation, locationClosed, carInMaintenance:
+		return true
+	}
+	return false
+}
+
+// errorStatus is the HTTP status answering a request the booking service
+// failed with err. The gRPC API maps it on to a status code.
+func errorStatus(err error) int {
+	if err == bookingAlreadyExists || isBadRequest(err) {
+		return http.StatusBadRequest
+	}
+	if err == bookingNotFound {
+		return http.StatusNotFound
+	}
+	if _, ok := err.(*eligibility.Ineligible); ok || err == notBookingOwner {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
 }
 
 type checkCarResponse struct {
 	IsFree bool `json:"is_free"`
 }
 
+// ListenAndServe serves HTTPS if SetTLS was given a config, HTTP otherwise.
 func (c *HttpServer) ListenAndServe() error {
+	if c.server.TLSConfig != nil {
+		return c.server.ListenAndServeTLS("", "")
+	}
 	return c.server.ListenAndServe()
 }
 
@@ -69,49 +171,103 @@ func (c *HttpServer) Close() error {
 	return c.server.Close()
 }
 
+// Shutdown stops accepting connections and waits for running requests until ctx is done.
+func (c *HttpServer) Shutdown(ctx context.Context) error {
+	return c.server.Shutdown(ctx)
+}
+
+func (c *HttpServer) SetTimeouts(read, write, idle time.Duration) {
+	c.server.ReadTimeout = read
+	c.server.WriteTimeout = write
+	c.server.IdleTimeout = idle
+}
+
+// SetTLS serves HTTPS with config. A nil config keeps plain HTTP.
+func (c *HttpServer) SetTLS(config *tls.Config) {
+	c.server.TLSConfig = config
+}
+
+// TokenVerifier asks the auth service whether a token was revoked.
+type TokenVerifier interface {
+	VerifyToken(token string) error
+}
+
+// SetTokenVerifier makes checkAuth reject tokens the verifier reports as
+// revoked; without one any correctly signed token is accepted.
+func (c *HttpServer) SetTokenVerifier(verifier TokenVerifier) {
+	c.tokenVerifier = verifier
+}
+
+// KeyVerifier asks the auth service whether an API key is valid and whom it
+// acts for.
+type KeyVerifier interface {
+	CheckAPIKey(key string) (apikey.Info, error)
+}
+
+// SetKeyVerifier makes the user endpoints accept API keys in X-API-Key in
+// place of an access token; without one API keys are rejected.
+func (c *HttpServer) SetKeyVerifier(verifier KeyVerifier) {
+	c.keyVerifier = verifier
+}
+
+// SetAdminToken enables the /admin endpoints for requests carrying token in
+// the X-Admin-Token header. The auth service uses them to export and erase
+// the data of a user.
+func (c *HttpServer) SetAdminToken(token []byte) {
+	c.adminToken = token
+}
+
+// SetRateLimit puts the limiter in front of every route, counting requests per
+// user_id or client IP. Requests with an API key are also held to the limit
+// of the key.
+func (c *HttpServer) SetRateLimit(limiter *ratelimit.Limiter) {
+	c.limiter = limiter
+	c.server.Handler = limiter.Handler(c.server.Handler, ratelimit.UserOrIP(c.jwtSigningKey))
+}
+
 func (c *HttpServer) createBooking(rw http.ResponseWriter, r *http.Request) {
 	c.logger.Infof("got request for create booking")
-	token := r.Header.Get("X-Auth")
-	userAuth, err := c.checkAuth(token)
-	if err != nil {
-		c.logger.Errorf("auth error: %v", err)
-		http.Error(rw, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		rw.WriteHeader(500)
-		c.logger.Errorf("create booking error: error reading body %v", err)
+	userAuth, token, ok := c.authUser(rw, r, servicetoken.ScopeBookingWrite)
+	if !ok {
 		return
 	}
 
 	var createBookingRequest createBookingRequest
-	err = json.Unmarshal(body, &createBookingRequest)
+	err := rest.Decode(r, &createBookingRequest)
 	if err != nil {
 		rw.WriteHeader(400)
 		c.logger.Errorf("create booking error: error unmarshalling request body %v", err)
 		return
 	}
 
-	booking, err := c.bookingService.createBooking(userAuth.UserID, createBookingRequest.CarID, createBookingRequest.From, createBookingRequest.To)
+	span := requestInterval(createBookingRequest.From, createBookingRequest.To, createBookingRequest.FromMinute, createBookingRequest.ToMinute, createBookingRequest.FromTime, createBookingRequest.ToTime)
+	route := Route{Pickup: createBookingRequest.PickupLocation, Return: createBookingRequest.ReturnLocation}
+	booking, err := c.bookingService.createBooking(userAuth.UserID, token, createBookingRequest.CarID, span, route)
 	if err != nil {
 		if err == bookingAlreadyExists {
 			c.logger.Errorf("create booking error: booking with car_id %v already exists", createBookingRequest.CarID)
-			http.Error(rw, "booking already exists", 400)
+		}
+		if status := errorStatus(err); status != 500 {
+			http.Error(rw, err.Error(), status)
 			return
 		}
 
+		c.logger.Errorf("create booking error: %v", err)
 		rw.WriteHeader(500)
 		return
 	}
 
 	createBookingResponse := createBookingResponse{
-		UserID:    userAuth.UserID,
-		CarID:     booking.CarID,
-		BookingID: booking.BookingID,
-		From:      booking.From,
-		To:        booking.To,
+		UserID:          userAuth.UserID,
+		CarID:           booking.CarID,
+		BookingID:       booking.BookingID,
+		From:            booking.From,
+		To:              booking.To,
+		FromMinute:      booking.FromMinute,
+		ToMinute:        booking.ToMinute,
+		PickupLocation:  booking.PickupLocation,
+		ReturnLocation:  booking.ReturnLocation,
+		OneWaySurcharge: booking.OneWaySurcharge,
 	}
 
 	responseBytes, err := json.Marshal(&createBookingResponse)
@@ -126,31 +282,164 @@ func (c *HttpServer) createBooking(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (c *HttpServer) checkCar(rw http.ResponseWriter, r *http.Request) {
-	c.logger.Infof("got request for check car")
-	token := r.Header.Get("X-Auth")
-	_, err := c.checkAuth(token)
+type bookingIDRequest struct {
+	BookingID uint64 `json:"booking_id"`
+}
+
+// getBooking shows a booking to the user who made it or to the admin. Other
+// users get 403.
+func (c *HttpServer) getBooking(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for get booking")
+	admin := c.checkAdmin(r)
+	var userAuth UserAuthObject
+	if !admin {
+		var ok bool
+		userAuth, _, ok = c.authUser(rw, r, servicetoken.ScopeBookingRead)
+		if !ok {
+			return
+		}
+	}
+
+	var bookingIDRequest bookingIDRequest
+	err := rest.Decode(r, &bookingIDRequest)
 	if err != nil {
-		c.logger.Errorf("auth error: %v", err)
-		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		rw.WriteHeader(400)
 		return
 	}
 
-	body, err := ioutil.ReadAll(r.Body)
+	var booking Booking
+	if admin {
+		booking, err = c.bookingService.getBooking(bookingIDRequest.BookingID)
+	} else {
+		booking, err = c.bookingService.userBooking(userAuth.UserID, bookingIDRequest.BookingID)
+	}
 	if err != nil {
+		if status := errorStatus(err); status != 500 {
+			http.Error(rw, err.Error(), status)
+			return
+		}
+		c.logger.Errorf("get booking error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&booking)
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("get booking error: error writing response %v", err)
+	}
+}
+
+// myBookingsRequest pages through the bookings of the caller by id: the next
+// page starts at the next_cursor of the previous one, the first has none.
+// Status keeps upcoming, active or completed bookings; from and to keep those
+// overlapping the times, either of which may be left out.
+type myBookingsRequest struct {
+	Cursor *uint64    `json:"cursor"`
+	Limit  int        `json:"limit"`
+	Status string     `json:"status"`
+	From   *time.Time `json:"from"`
+	To     *time.Time `json:"to"`
+}
+
+type myBookingsResponse struct {
+	Bookings []Booking `json:"bookings"`
+	// NextCursor is null on the last page.
+	NextCursor *uint64 `json:"next_cursor"`
+}
+
+const defaultMyBookingsLimit = 100
+
+// requestRange returns the minutes between the times from and to, running
+// from the epoch or to the end of time where one is left out. A to not after
+// from gets an empty interval, which is rejected as invalid.
+func requestRange(from, to *time.Time) interval.Interval {
+	if from != nil && to != nil && !to.After(*from) {
+		return interval.Interval{}
+	}
+	span := interval.Interval{To: math.MaxUint64}
+	if from != nil {
+		span.From = interval.FloorMinute(*from)
+	}
+	if to != nil {
+		span.To = interval.CeilMinute(*to)
+	}
+	return span
+}
+
+// myBookings lists the bookings of the authenticated user a page at a time.
+func (c *HttpServer) myBookings(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for my bookings")
+	userAuth, _, ok := c.authUser(rw, r, servicetoken.ScopeBookingRead)
+	if !ok {
+		return
+	}
+
+	myBookingsRequest := myBookingsRequest{Limit: defaultMyBookingsLimit}
+	err := rest.Decode(r, &myBookingsRequest)
+	if err != nil {
+		rw.WriteHeader(400)
+		return
+	}
+	if myBookingsRequest.Limit <= 0 || myBookingsRequest.Limit > defaultMyBookingsLimit {
+		myBookingsRequest.Limit = defaultMyBookingsLimit
+	}
+
+	filter := bookingFilter{status: myBookingsRequest.Status, span: requestRange(myBookingsRequest.From, myBookingsRequest.To)}
+	bookings, next, err := c.bookingService.listUserBookings(userAuth.UserID, myBookingsRequest.Cursor, myBookingsRequest.Limit, filter)
+	if isBadRequest(err) {
+		http.Error(rw, err.Error(), 400)
+		return
+	}
+	if err != nil {
+		c.logger.Errorf("my bookings error: %v", err)
 		rw.WriteHeader(500)
-		c.logger.Errorf("create booking error: error reading body %v", err)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&myBookingsResponse{Bookings: bookings, NextCursor: next})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("my bookings error: error writing response %v", err)
+	}
+}
+
+func (c *HttpServer) checkCar(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for check car")
+	_, _, ok := c.authUser(rw, r, servicetoken.ScopeBookingRead)
+	if !ok {
 		return
 	}
 
 	var checkCarRequest checkCarRequest
-	err = json.Unmarshal(body, &checkCarRequest)
+	err := rest.Decode(r, &checkCarRequest)
 	if err != nil {
 		rw.WriteHeader(400)
 		return
 	}
 
-	isFree := c.bookingService.IsCarFree(checkCarRequest.CarID, checkCarRequest.From, checkCarRequest.To)
+	span := requestInterval(checkCarRequest.From, checkCarRequest.To, checkCarRequest.FromMinute, checkCarRequest.ToMinute, checkCarRequest.FromTime, checkCarRequest.ToTime)
+	route := Route{Pickup: checkCarRequest.PickupLocation, Return: checkCarRequest.ReturnLocation}
+	isFree, err := c.bookingService.IsCarFree(checkCarRequest.CarID, span, route)
+	if isBadRequest(err) {
+		http.Error(rw, err.Error(), 400)
+		return
+	}
+	if err != nil {
+		c.logger.Errorf("check car error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
 
 	checkCarResponse := checkCarResponse{
 		IsFree: isFree,
@@ -168,15 +457,226 @@ func (c *HttpServer) checkCar(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// carBookings lists the bookings of a car that end after from_minute. The fleet
+// service uses it to report conflicts with maintenance windows.
+func (c *HttpServer) carBookings(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for car bookings")
+	_, err := c.checkService(r, servicetoken.ScopeBookingRead)
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), servicetoken.Status(err))
+		return
+	}
+
+	var carBookingsRequest carBookingsRequest
+	err = rest.Decode(r, &carBookingsRequest)
+	if err != nil {
+		rw.WriteHeader(400)
+		return
+	}
+
+	bookings, err := c.bookingService.carBookings(carBookingsRequest.CarID, carBookingsRequest.FromMinute)
+	if err != nil {
+		c.logger.Errorf("car bookings error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&carBookingsResponse{Bookings: bookings})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("car bookings error: error writing response %v", err)
+	}
+}
+
+func (c *HttpServer) setTurnaround(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for set turnaround")
+	_, err := c.checkService(r, servicetoken.ScopeBookingWrite)
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), servicetoken.Status(err))
+		return
+	}
+
+	var setTurnaroundRequest setTurnaroundRequest
+	err = rest.Decode(r, &setTurnaroundRequest)
+	if err != nil {
+		rw.WriteHeader(400)
+		return
+	}
+
+	err = c.bookingService.setTurnaround(setTurnaroundRequest.CarID, setTurnaroundRequest.Minutes)
+	if isBadRequest(err) {
+		http.Error(rw, err.Error(), 400)
+		return
+	}
+	if err != nil {
+		c.logger.Errorf("set turnaround error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+}
+
+func (c *HttpServer) checkAdmin(r *http.Request) bool {
+	if len(c.adminToken) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), c.adminToken) == 1
+}
+
+// checkService authenticates a call from another service by a service token
+// granting scope. With mutual TLS the caller must also present a certificate
+// issued to the client the token names.
+func (c *HttpServer) checkService(r *http.Request, scope string) (servicetoken.Claims, error) {
+	mutual := c.server.TLSConfig != nil && c.server.TLSConfig.ClientCAs != nil
+	return servicetoken.Check(servicetoken.Key(c.jwtSigningKey), r, scope, mutual)
+}
+
+type userIDRequest struct {
+	UserID *uint64 `json:"user_id"`
+}
+
+type eraseUserResponse struct {
+	Erased int `json:"erased"`
+}
+
+// readUserID reads the user_id of an admin request, answering the request
+// itself if that fails.
+func (c *HttpServer) readUserID(rw http.ResponseWriter, r *http.Request, name string) (uint64, bool) {
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	var userIDRequest userIDRequest
+	err := rest.Decode(r, &userIDRequest)
+	if err != nil || userIDRequest.UserID == nil {
+		http.Error(rw, "user_id is required", 400)
+		return 0, false
+	}
+	return *userIDRequest.UserID, true
+}
+
+// userBookings lists every booking of a user for a data export.
+func (c *HttpServer) userBookings(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for user bookings")
+	userID, ok := c.readUserID(rw, r, "user bookings")
+	if !ok {
+		return
+	}
+
+	bookings, err := c.bookingService.userBookings(userID)
+	if err != nil {
+		c.logger.Errorf("user bookings error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&carBookingsResponse{Bookings: bookings})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("user bookings error: error writing response %v", err)
+	}
+}
+
+// eraseUser detaches the bookings of a user from them, keeping the bookings.
+func (c *HttpServer) eraseUser(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for erase user")
+	userID, ok := c.readUserID(rw, r, "erase user")
+	if !ok {
+		return
+	}
+
+	erased, err := c.bookingService.eraseUser(userID)
+	if err != nil {
+		c.logger.Errorf("erase user error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&eraseUserResponse{Erased: erased})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("erase user error: error writing response %v", err)
+	}
+}
+
+// authUser authenticates a user request with checkUser. It returns the user
+// and the credential to look the driver up with, or writes the error response
+// and returns false.
+func (c *HttpServer) authUser(rw http.ResponseWriter, r *http.Request, scope string) (UserAuthObject, string, bool) {
+	userAuth, credential, err := c.checkUser(r, scope)
+	if exceeded, ok := err.(*ratelimit.Exceeded); ok {
+		ratelimit.Reject(rw, exceeded.Wait)
+		return UserAuthObject{}, "", false
+	}
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), apikey.Status(err))
+		return UserAuthObject{}, "", false
+	}
+	return userAuth, credential, true
+}
+
+// checkUser authenticates a user request by its X-Auth access token or, in its
+// place, an API key in X-API-Key, which must have scope and is held to its own
+// rate limit. It returns the user and the credential to look the driver up
+// with. Errors are answered with apikey.Status, except *ratelimit.Exceeded.
+func (c *HttpServer) checkUser(r *http.Request, scope string) (UserAuthObject, string, error) {
+	key := r.Header.Get(apikey.Header)
+	if key == "" {
+		token := r.Header.Get("X-Auth")
+		userAuth, err := c.checkAuth(token)
+		if err != nil {
+			return UserAuthObject{}, "", err
+		}
+		return userAuth, token, nil
+	}
+
+	if c.keyVerifier == nil {
+		return UserAuthObject{}, "", errors.New("api keys are not accepted without the auth service")
+	}
+	info, err := c.keyVerifier.CheckAPIKey(key)
+	if err == nil && !info.HasScope(scope) {
+		err = &apikey.InsufficientScope{Scope: scope}
+	}
+	if err != nil {
+		return UserAuthObject{}, "", err
+	}
+	if c.limiter != nil && info.RateLimit != "" {
+		limit, err := ratelimit.ParseLimit(info.RateLimit)
+		if err != nil {
+			c.logger.Errorf("api key %s rate limit error: %v", info.KeyID, err)
+		} else if wait := c.limiter.Take("apikey:"+info.KeyID, limit); wait > 0 {
+			return UserAuthObject{}, "", &ratelimit.Exceeded{Wait: wait}
+		}
+	}
+	return UserAuthObject{info.Username, info.UserID}, key, nil
+}
+
 type UserAuthObject struct {
 	Username string
 	UserID   uint64
 }
 
 func (c *HttpServer) checkAuth(token string) (UserAuthObject, error) {
-	tokenObj, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		return c.jwtSigningKey, nil
-	})
+	tokenObj, err := jwt.Parse(token, usertoken.Keyfunc(c.jwtSigningKey))
 	if err != nil {
 		return UserAuthObject{}, fmt.Errorf("error casting user id from token: %w", err)
 	}
@@ -186,8 +686,21 @@ func (c *HttpServer) checkAuth(token string) (UserAuthObject, error) {
 		return UserAuthObject{}, fmt.Errorf("token %s verification error: error casting claims to map claims", token)
 	}
 	c.logger.Infof("claims %v", claims)
-	username := claims["username"].(string)
-	userID := claims["user_id"].(float64)
+	username, ok := claims["username"].(string)
+	if !ok {
+		return UserAuthObject{}, errors.New("token has no username")
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return UserAuthObject{}, errors.New("token has no user_id")
+	}
+
+	if c.tokenVerifier != nil {
+		err = c.tokenVerifier.VerifyToken(token)
+		if err != nil {
+			return UserAuthObject{}, err
+		}
+	}
 
 	return UserAuthObject{
 		username,
@@ -0,0 +1,438 @@
+package internal
+
+import (
+	"distributed-rental/pkg/apikey"
+	"distributed-rental/pkg/eligibility"
+	"distributed-rental/pkg/interval"
+	"distributed-rental/pkg/openapi/openapitest"
+	"distributed-rental/pkg/ratelimit"
+	"distributed-rental/pkg/servicetoken"
+	booking "distributed-rental/projects/booking/client"
+	fleet "distributed-rental/projects/fleet/client"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckAuth(t *testing.T) {
+	jwtSecret := []byte("secret")
+	server := NewHttpServer("", &BookingService{Repository: NewMemoryBookingRepository(), Logger: zap.NewNop()}, jwtSecret, zap.NewNop().Sugar())
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	userAuth, err := server.checkAuth(sign(jwt.MapClaims{"username": "alice", "user_id": 7}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userAuth.Username != "alice" || userAuth.UserID != 7 {
+		t.Fatalf("got %+v", userAuth)
+	}
+	for name, claims := range map[string]jwt.MapClaims{
+		"no username":     {"user_id": 7},
+		"no user_id":      {"username": "alice"},
+		"username number": {"username": 1, "user_id": 7},
+		"user_id string":  {"username": "alice", "user_id": "7"},
+	} {
+		_, err := server.checkAuth(sign(claims))
+		if err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+// TestOpenAPI fails when openapi.json was not regenerated after a change of
+// the v1 routes, or when the router does not serve them as documented.
+func TestOpenAPI(t *testing.T) {
+	openapitest.CheckFile(t, "../openapi.json", OpenAPI())
+	server := NewHttpServer("", &BookingService{Repository: NewMemoryBookingRepository(), Logger: zap.NewNop()}, []byte("secret"), zap.NewNop().Sugar())
+	openapitest.CheckRoutes(t, server.server.Handler.(*http.ServeMux), OpenAPI())
+}
+
+// newBookingsTest returns a server whose admin token is "admin" and whose user
+// 7 has the bookings 1 (completed), 2 (active), 3 and 5 (upcoming); booking 4
+// is of user 8. It also returns the minute the bookings are relative to and a
+// function signing access tokens.
+func newBookingsTest(t *testing.T) (*HttpServer, uint64, func(userID uint64) string) {
+	t.Helper()
+	jwtSecret := []byte("secret")
+	repository := NewMemoryBookingRepository()
+	server := NewHttpServer("", &BookingService{Repository: repository, Logger: zap.NewNop()}, jwtSecret, zap.NewNop().Sugar())
+	server.SetAdminToken([]byte("admin"))
+
+	now := interval.FloorMinute(time.Now())
+	for _, booking := range []BookingDBModel{
+		testBooking(1, 7, 1, now-3000, now-2000),
+		testBooking(2, 7, 2, now-10, now+10),
+		testBooking(3, 7, 1, now+1000, now+2000),
+		testBooking(4, 8, 3, now+1000, now+2000),
+		testBooking(5, 7, 3, now+5000, now+6000),
+	} {
+		create(t, repository, booking)
+	}
+
+	return server, now, func(userID uint64) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": fmt.Sprint("user", userID), "user_id": userID}).SignedString(jwtSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+}
+
+func get(server *HttpServer, target string, headers map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+	rw := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rw, r)
+	return rw
+}
+
+func TestGetBooking(t *testing.T) {
+	server, _, sign := newBookingsTest(t)
+	for _, prefix := range []string{"/v1", ""} {
+		for name, test := range map[string]struct {
+			bookingID uint64
+			headers   map[string]string
+			status    int
+			userID    uint64
+		}{
+			"owner":         {bookingID: 1, headers: map[string]string{"X-Auth": sign(7)}, status: 200, userID: 7},
+			"other user":    {bookingID: 1, headers: map[string]string{"X-Auth": sign(8)}, status: 403},
+			"admin":         {bookingID: 4, headers: map[string]string{"X-Admin-Token": "admin"}, status: 200, userID: 8},
+			"wrong admin":   {bookingID: 4, headers: map[string]string{"X-Admin-Token": "nimda"}, status: 401},
+			"no token":      {bookingID: 1, status: 401},
+			"unknown":       {bookingID: 99, headers: map[string]string{"X-Auth": sign(7)}, status: 404},
+			"unknown admin": {bookingID: 99, headers: map[string]string{"X-Admin-Token": "admin"}, status: 404},
+		} {
+			rw := get(server, fmt.Sprintf("%s/bookings/%d", prefix, test.bookingID), test.headers)
+			if rw.Code != test.status {
+				t.Errorf("%s%s: got %d %s, want %d", prefix, name, rw.Code, rw.Body, test.status)
+				continue
+			}
+			if test.status != 200 {
+				continue
+			}
+			var booking Booking
+			err := json.Unmarshal(rw.Body.Bytes(), &booking)
+			if err != nil || booking.BookingID != test.bookingID || booking.UserID != test.userID {
+				t.Errorf("%s%s: got %s, %v", prefix, name, rw.Body, err)
+			}
+		}
+	}
+}
+
+func TestMyBookings(t *testing.T) {
+	server, now, sign := newBookingsTest(t)
+	at := func(minute uint64) string {
+		return url.QueryEscape(time.Unix(int64(minute)*60, 0).UTC().Format(time.RFC3339))
+	}
+	for _, prefix := range []string{"/v1", ""} {
+		for query, test := range map[string]struct {
+			bookings []uint64
+			next     uint64
+			status   int
+		}{
+			"":                                 {bookings: []uint64{1, 2, 3, 5}},
+			"limit=2":                          {bookings: []uint64{1, 2}, next: 2},
+			"limit=2&cursor=2":                 {bookings: []uint64{3, 5}},
+			"cursor=5":                         {bookings: []uint64{}},
+			"status=completed":                 {bookings: []uint64{1}},
+			"status=active":                    {bookings: []uint64{2}},
+			"status=upcoming":                  {bookings: []uint64{3, 5}},
+			"status=upcoming&limit=1":          {bookings: []uint64{3}, next: 3},
+			"status=upcoming&limit=1&cursor=3": {bookings: []uint64{5}},
+			"status=cancelled":                 {status: 400},
+			"from=" + at(now+500) + "&to=" + at(now+2500): {bookings: []uint64{3}},
+			"from=" + at(now+2000):                        {bookings: []uint64{5}},
+			"to=" + at(now-10):                            {bookings: []uint64{1}},
+			"to=" + at(now-9) + "&status=active":          {bookings: []uint64{2}},
+			"from=" + at(now+10) + "&to=" + at(now+10):    {status: 400},
+			"limit=bogus":                                 {status: 400},
+		} {
+			rw := get(server, prefix+"/my_bookings?"+query, map[string]string{"X-Auth": sign(7)})
+			if test.status == 0 {
+				test.status = 200
+			}
+			if rw.Code != test.status {
+				t.Errorf("%s %s: got %d %s, want %d", prefix, query, rw.Code, rw.Body, test.status)
+				continue
+			}
+			if test.status != 200 {
+				continue
+			}
+			var response myBookingsResponse
+			err := json.Unmarshal(rw.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []uint64{}
+			for _, booking := range response.Bookings {
+				if booking.UserID != 7 {
+					t.Errorf("%s %s: got booking %+v of another user", prefix, query, booking)
+				}
+				got = append(got, booking.BookingID)
+			}
+			var next uint64
+			if response.NextCursor != nil {
+				next = *response.NextCursor
+			}
+			if !equalIDs(got, test.bookings) || next != test.next {
+				t.Errorf("%s %s: got %v next %d, want %v next %d", prefix, query, got, next, test.bookings, test.next)
+			}
+		}
+	}
+
+	rw := get(server, "/v1/my_bookings", nil)
+	if rw.Code != 401 {
+		t.Fatalf("no token: got %d", rw.Code)
+	}
+	// Booking 4 is the only one of user 8.
+	rw = get(server, "/my_bookings", map[string]string{"X-Auth": sign(8)})
+	if rw.Code != 200 || !strings.Contains(rw.Body.String(), `"booking_id":4`) || strings.Contains(rw.Body.String(), `"booking_id":1`) {
+		t.Fatalf("user 8: got %d %s", rw.Code, rw.Body)
+	}
+}
+
+// TestServiceAuth calls the endpoints of other services with service tokens
+// of different scopes, and with a user's access token in their place.
+func TestServiceAuth(t *testing.T) {
+	server, _, sign := newBookingsTest(t)
+	serviceToken := func(scopes ...string) string {
+		token, err := servicetoken.Issue(servicetoken.Key([]byte("secret")), "fleet", scopes, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+
+	for _, test := range []struct {
+		name          string
+		authorization string
+		carBookings   int
+		setTurnaround int
+	}{
+		{"no token", "", http.StatusUnauthorized, http.StatusUnauthorized},
+		{"user token", "Bearer " + sign(7), http.StatusUnauthorized, http.StatusUnauthorized},
+		{"booking:read", serviceToken(servicetoken.ScopeBookingRead), http.StatusOK, http.StatusForbidden},
+		{"booking:write", serviceToken(servicetoken.ScopeBookingWrite), http.StatusForbidden, http.StatusOK},
+		{"lease scopes", serviceToken(servicetoken.ScopeLeaseRead, servicetoken.ScopeLeaseWrite), http.StatusForbidden, http.StatusForbidden},
+	} {
+		for target, status := range map[string]int{
+			"/car_bookings":   test.carBookings,
+			"/set_turnaround": test.setTurnaround,
+		} {
+			r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"car_id": 1, "from_minute": 0, "minutes": 30}`))
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			rw := httptest.NewRecorder()
+			server.server.Handler.ServeHTTP(rw, r)
+			if rw.Code != status {
+				t.Errorf("%s %s: got %d %s, want %d", test.name, target, rw.Code, rw.Body, status)
+			}
+		}
+	}
+}
+
+type testKeyVerifier map[string]apikey.Info
+
+func (c testKeyVerifier) CheckAPIKey(key string) (apikey.Info, error) {
+	info, ok := c[key]
+	if !ok {
+		return apikey.Info{}, apikey.ErrInvalidKey
+	}
+	return info, nil
+}
+
+// TestAPIKeyAuth calls the user endpoints with API keys in place of access
+// tokens, which act for their user within their scopes and rate limit.
+func TestAPIKeyAuth(t *testing.T) {
+	server, _, _ := newBookingsTest(t)
+	server.SetKeyVerifier(testKeyVerifier{
+		"rk_read_secret":    {KeyID: "read", UserID: 7, Username: "user7", Scopes: []string{servicetoken.ScopeBookingRead}},
+		"rk_lease_secret":   {KeyID: "lease", UserID: 7, Username: "user7", Scopes: []string{servicetoken.ScopeLeaseRead, servicetoken.ScopeLeaseWrite}},
+		"rk_limited_secret": {KeyID: "limited", UserID: 7, Username: "user7", Scopes: []string{servicetoken.ScopeBookingRead}, RateLimit: "1/m"},
+	})
+	server.SetRateLimit(ratelimit.New(ratelimit.Rules{}, ratelimit.NewMemoryStore(), zap.NewNop().Sugar()))
+	key := func(key string) map[string]string {
+		return map[string]string{apikey.Header: key}
+	}
+
+	if rw := get(server, "/v1/bookings/2", key("rk_read_secret")); rw.Code != 200 {
+		t.Fatalf("read key: got %d %s", rw.Code, rw.Body)
+	}
+	// The key acts for user 7, who does not own booking 4.
+	if rw := get(server, "/v1/bookings/4", key("rk_read_secret")); rw.Code != http.StatusForbidden {
+		t.Fatalf("booking of another user: got %d, want 403", rw.Code)
+	}
+	if rw := get(server, "/v1/bookings/2", key("rk_lease_secret")); rw.Code != http.StatusForbidden {
+		t.Fatalf("key without booking:read: got %d, want 403", rw.Code)
+	}
+	if rw := get(server, "/v1/bookings/2", key("rk_unknown_secret")); rw.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown key: got %d, want 401", rw.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/bookings", strings.NewReader(`{"car_id": 1, "from_minute": 0, "to_minute": 60}`))
+	r.Header.Set(apikey.Header, "rk_read_secret")
+	rw := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rw, r)
+	if rw.Code != http.StatusForbidden {
+		t.Fatalf("create with a read key: got %d %s, want 403", rw.Code, rw.Body)
+	}
+
+	if rw := get(server, "/v1/bookings/2", key("rk_limited_secret")); rw.Code != 200 {
+		t.Fatalf("limited key: got %d", rw.Code)
+	}
+	if rw := get(server, "/v1/bookings/2", key("rk_limited_secret")); rw.Code != http.StatusTooManyRequests || rw.Header().Get("Retry-After") == "" {
+		t.Fatalf("limited key again: got %d, want 429", rw.Code)
+	}
+	if rw := get(server, "/v1/bookings/2", key("rk_read_secret")); rw.Code != 200 {
+		t.Fatalf("other key after the limit: got %d", rw.Code)
+	}
+}
+
+// testCatalog has the cars of the fleet and no branches or maintenance.
+type testCatalog map[uint64]fleet.Car
+
+func (c testCatalog) GetCar(carID uint64) (fleet.Car, error) {
+	car, ok := c[carID]
+	if !ok {
+		return fleet.Car{}, fleet.ErrCarNotFound
+	}
+	return car, nil
+}
+
+func (c testCatalog) GetLocation(code string) (fleet.Location, error) {
+	return fleet.Location{}, fleet.ErrLocationNotFound
+}
+
+func (c testCatalog) MaintenanceWindows(carID uint64, span interval.Interval) ([]fleet.MaintenanceWindow, error) {
+	return nil, nil
+}
+
+// testDrivers maps access tokens to their drivers.
+type testDrivers map[string]eligibility.Driver
+
+func (c testDrivers) Driver(token string) (eligibility.Driver, error) {
+	return c[token], nil
+}
+
+func TestCreateBookingEligibility(t *testing.T) {
+	jwtSecret := []byte("secret")
+	drivers := testDrivers{}
+	bookingService := &BookingService{
+		Repository:  NewMemoryBookingRepository(),
+		Logger:      zap.NewNop(),
+		Fleet:       testCatalog{1: {CarID: 1, Class: "economy"}},
+		Drivers:     drivers,
+		Eligibility: eligibility.Rules{eligibility.AnyClass: {MinAge: 21}},
+	}
+	server := NewHttpServer("", bookingService, jwtSecret, zap.NewNop().Sugar())
+	from := time.Date(2026, 6, 1, 10, 0, 0, 0, time.UTC)
+	license := eligibility.License{Number: "77 12 345678", Country: "RU", ExpiresOn: "2026-06-10", Status: eligibility.StatusVerified}
+
+	for userID, test := range []struct {
+		name   string
+		driver eligibility.Driver
+		status int
+		reason string
+	}{
+		{"eligible", eligibility.Driver{DateOfBirth: "1990-01-01", License: license}, http.StatusCreated, ""},
+		{"no license", eligibility.Driver{DateOfBirth: "1990-01-01"}, http.StatusForbidden, "license is not on record"},
+		{"expired license", eligibility.Driver{DateOfBirth: "1990-01-01", License: eligibility.License{Number: license.Number, ExpiresOn: "2026-01-01"}}, http.StatusForbidden, "expires before the rental ends"},
+		{"too young", eligibility.Driver{DateOfBirth: "2010-01-01", License: license}, http.StatusForbidden, "at least 21 years old"},
+	} {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": test.name, "user_id": userID + 1}).SignedString(jwtSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		drivers[token] = test.driver
+		// Each driver tries a day of its own, so that only eligibility decides.
+		start := from.AddDate(0, 0, userID)
+		body := fmt.Sprintf(`{"car_id": 1, "from": %q, "to": %q}`, start.Format(time.RFC3339), start.Add(2*time.Hour).Format(time.RFC3339))
+		r := httptest.NewRequest(http.MethodPost, "/v1/bookings", strings.NewReader(body))
+		r.Header.Set("X-Auth", token)
+		rw := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(rw, r)
+		if rw.Code != test.status || !strings.Contains(rw.Body.String(), test.reason) {
+			t.Errorf("%s: got %d %s, want %d %q", test.name, rw.Code, rw.Body, test.status, test.reason)
+		}
+	}
+}
+
+// TestEraseUser erases user 7 through the client the auth service runs
+// erasures with.
+func TestEraseUser(t *testing.T) {
+	server, now, sign := newBookingsTest(t)
+	httpServer := httptest.NewServer(server.server.Handler)
+	defer httpServer.Close()
+	client := booking.New(strings.TrimPrefix(httpServer.URL, "http://"))
+
+	before, err := server.bookingService.Repository.UserBookings(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, err := client.ExportUser([]byte("admin"), 7)
+	if err != nil || !strings.Contains(string(exported), `"booking_id":5`) || strings.Contains(string(exported), `"booking_id":4`) {
+		t.Fatalf("export: got %s, %v", exported, err)
+	}
+	_, err = client.EraseUser([]byte("guess"), 7)
+	if err == nil {
+		t.Fatal("erased with a wrong admin token")
+	}
+
+	erased, err := client.EraseUser([]byte("admin"), 7)
+	if err != nil || erased != len(before) {
+		t.Fatalf("erase: got %d, %v, want %d", erased, err, len(before))
+	}
+	left, err := server.bookingService.Repository.UserBookings(7)
+	if err != nil || len(left) != 0 {
+		t.Fatalf("bookings left: %+v, %v", left, err)
+	}
+	// The bookings stay for accounting, with everything but their user.
+	after, err := server.bookingService.Repository.UserBookings(erasedUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("got %d bookings of the erased user, want %d", len(after), len(before))
+	}
+	for i := range before {
+		want := before[i]
+		want.UserID = erasedUserID
+		if after[i] != want {
+			t.Errorf("got %+v, want %+v", after[i], want)
+		}
+	}
+	if rw := get(server, "/v1/my_bookings", map[string]string{"X-Auth": sign(7)}); rw.Code != 200 || strings.Contains(rw.Body.String(), "booking_id") {
+		t.Fatalf("bookings of user 7: got %d %s", rw.Code, rw.Body)
+	}
+	if rw := get(server, "/v1/my_bookings", map[string]string{"X-Auth": sign(8)}); !strings.Contains(rw.Body.String(), `"booking_id":4`) {
+		t.Fatalf("bookings of user 8: got %d %s", rw.Code, rw.Body)
+	}
+	// The erased car times stay taken.
+	free, err := server.bookingService.IsCarFree(3, interval.Interval{From: now + 5000, To: now + 5100}, Route{})
+	if err != nil || free {
+		t.Fatalf("car 3 during an erased booking: free %v, %v", free, err)
+	}
+
+	// Erasing again finds nothing, so that the auth service may retry.
+	erased, err = client.EraseUser([]byte("admin"), 7)
+	if err != nil || erased != 0 {
+		t.Fatalf("erase again: got %d, %v", erased, err)
+	}
+}
@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"database/sql"
+	"distributed-rental/pkg/interval"
+	"errors"
+	"math"
+	_ "modernc.org/sqlite"
+)
+
+const bookingSchema = `
+CREATE TABLE IF NOT EXISTS bookings (
+	booking_id        INTEGER PRIMARY KEY,
+	car_id            INTEGER NOT NULL,
+	user_id           INTEGER NOT NULL,
+	from_day          INTEGER NOT NULL,
+	to_day            INTEGER NOT NULL,
+	from_minute       INTEGER NOT NULL,
+	to_minute         INTEGER NOT NULL,
+	pickup_location   TEXT NOT NULL DEFAULT '',
+	return_location   TEXT NOT NULL DEFAULT '',
+	one_way_surcharge INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS bookings_car_id ON bookings (car_id);
+CREATE INDEX IF NOT EXISTS bookings_user_id ON bookings (user_id);
+CREATE TABLE IF NOT EXISTS turnarounds (
+	car_id  INTEGER PRIMARY KEY,
+	minutes INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS sequences (
+	name  TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+`
+
+var errIDRange = errors.New("value does not fit into an SQLite integer")
+
+// SQLiteBookingRepository stores bookings in an embedded SQLite database.
+//
+// SQLite stores integers as int64 and database/sql rejects larger uint64
+// arguments, so ids above math.MaxInt64 are never stored: lookups by them find
+// nothing, and writes fail with unknownCar for such cars, interval.ErrInvalid
+// for such minutes and errIDRange for other values.
+type SQLiteBookingRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteBookingRepository opens (and if needed creates) the database at path.
+func NewSQLiteBookingRepository(path string) (*SQLiteBookingRepository, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time; a single connection turns concurrent
+	// CreateBooking calls into a queue instead of SQLITE_BUSY errors.
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(bookingSchema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteBookingRepository{db: db}, nil
+}
+
+func (c *SQLiteBookingRepository) NextBookingID() (uint64, error) {
+	var bookingID uint64
+	err := c.db.QueryRow(`INSERT INTO sequences (name, value) VALUES ('booking_id', 1)
+		ON CONFLICT (name) DO UPDATE SET value = value + 1
+		RETURNING value`).Scan(&bookingID)
+	return bookingID, err
+}
+
+func (c *SQLiteBookingRepository) CarBookings(carID uint64) ([]BookingDBModel, error) {
+	if carID > math.MaxInt64 {
+		return []BookingDBModel{}, nil
+	}
+	return carBookingsSQL(c.db, carID)
+}
+
+func (c *SQLiteBookingRepository) GetBooking(bookingID uint64) (BookingDBModel, error) {
+	if bookingID > math.MaxInt64 {
+		return BookingDBModel{}, bookingNotFound
+	}
+	bookings, err := bookingsSQL(c.db, `WHERE booking_id = ?`, bookingID)
+	if err != nil {
+		return BookingDBModel{}, err
+	}
+	if len(bookings) == 0 {
+		return BookingDBModel{}, bookingNotFound
+	}
+	return bookings[0], nil
+}
+
+func (c *SQLiteBookingRepository) UserBookings(userID uint64) ([]BookingDBModel, error) {
+	if userID > math.MaxInt64 {
+		return []BookingDBModel{}, nil
+	}
+	return bookingsSQL(c.db, `WHERE user_id = ? ORDER BY booking_id`, userID)
+}
+
+// ListUserBookings filters the bookings of the user from from on in Go, as
+// match can not be put into SQL.
+func (c *SQLiteBookingRepository) ListUserBookings(userID uint64, from uint64, limit int, match func(booking BookingDBModel) bool) ([]BookingDBModel, error) {
+	if from > math.MaxInt64 {
+		return []BookingDBModel{}, nil
+	}
+	bookings, err := bookingsSQL(c.db, `WHERE user_id = ? AND booking_id >= ? ORDER BY booking_id`, userID, from)
+	if err != nil {
+		return nil, err
+	}
+	matching := []BookingDBModel{}
+	for _, booking := range bookings {
+		if len(matching) == limit {
+			break
+		}
+		if match(booking) {
+			matching = append(matching, booking)
+		}
+	}
+	return matching, nil
+}
+
+func (c *SQLiteBookingRepository) ReassignUser(userID uint64, newUserID uint64) (int, error) {
+	if newUserID > math.MaxInt64 {
+		return 0, errIDRange
+	}
+	if userID > math.MaxInt64 {
+		return 0, nil
+	}
+	result, err := c.db.Exec(`UPDATE bookings SET user_id = ? WHERE user_id = ?`, newUserID, userID)
+	if err != nil {
+		return 0, err
+	}
+	moved, err := result.RowsAffected()
+	return int(moved), err
+}
+
+func (c *SQLiteBookingRepository) CreateBooking(booking BookingDBModel, check func(existing []BookingDBModel) error) error {
+	if booking.CarID > math.MaxInt64 {
+		return unknownCar
+	}
+	if booking.ToMinute > math.MaxInt64 {
+		return interval.ErrInvalid
+	}
+	if booking.UserID > math.MaxInt64 || booking.BookingID > math.MaxInt64 {
+		return errIDRange
+	}
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	existing, err := carBookingsSQL(tx, booking.CarID)
+	if err != nil {
+		return err
+	}
+	err = check(existing)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO bookings
+		(booking_id, car_id, user_id, from_day, to_day, from_minute, to_minute, pickup_location, return_location, one_way_surcharge)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		booking.BookingID, booking.CarID, booking.UserID, booking.From, booking.To, booking.FromMinute, booking.ToMinute,
+		booking.PickupLocation, booking.ReturnLocation, booking.OneWaySurcharge)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (c *SQLiteBookingRepository) Turnaround(carID uint64) (uint64, bool, error) {
+	if carID > math.MaxInt64 {
+		return 0, false, nil
+	}
+	var minutes uint64
+	err := c.db.QueryRow(`SELECT minutes FROM turnarounds WHERE car_id = ?`, carID).Scan(&minutes)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return minutes, true, nil
+}
+
+func (c *SQLiteBookingRepository) SetTurnaround(carID uint64, minutes uint64) error {
+	if carID > math.MaxInt64 {
+		return unknownCar
+	}
+	if minutes > math.MaxInt64 {
+		return errIDRange
+	}
+	_, err := c.db.Exec(`INSERT INTO turnarounds (car_id, minutes) VALUES (?, ?)
+		ON CONFLICT (car_id) DO UPDATE SET minutes = excluded.minutes`, carID, minutes)
+	return err
+}
+
+func (c *SQLiteBookingRepository) Close() error {
+	return c.db.Close()
+}
+
+type sqlQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func carBookingsSQL(q sqlQuerier, carID uint64) ([]BookingDBModel, error) {
+	return bookingsSQL(q, `WHERE car_id = ? ORDER BY from_minute`, carID)
+}
+
+// bookingsSQL returns the bookings selected by where.
+func bookingsSQL(q sqlQuerier, where string, args ...interface{}) ([]BookingDBModel, error) {
+	rows, err := q.Query(`SELECT booking_id, car_id, user_id, from_day, to_day, from_minute, to_minute,
+		pickup_location, return_location, one_way_surcharge
+		FROM bookings `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookings := []BookingDBModel{}
+	for rows.Next() {
+		booking := BookingDBModel{}
+		err = rows.Scan(&booking.BookingID, &booking.CarID, &booking.UserID, &booking.From, &booking.To,
+			&booking.FromMinute, &booking.ToMinute, &booking.PickupLocation, &booking.ReturnLocation, &booking.OneWaySurcharge)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, booking)
+	}
+	return bookings, rows.Err()
+}
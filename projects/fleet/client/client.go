@@ -0,0 +1,175 @@
+// Package client is the HTTP client other services use to look cars up in the fleet catalog.
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"distributed-rental/pkg/interval"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	StatusActive  = "active"
+	StatusRetired = "retired"
+)
+
+var ErrCarNotFound = errors.New("car not found")
+var ErrLocationNotFound = errors.New("location not found")
+
+var errNotFound = errors.New("not found")
+
+type Car struct {
+	CarID        uint64 `json:"car_id"`
+	Make         string `json:"make"`
+	Model        string `json:"model"`
+	Class        string `json:"class"`
+	Seats        uint32 `json:"seats"`
+	Transmission string `json:"transmission"`
+	FuelType     string `json:"fuel_type"`
+	Plate        string `json:"plate"`
+	HomeLocation string `json:"home_location"`
+	Status       string `json:"status"`
+}
+
+// Location is a rental branch. See IsOpenAt for how opening hours are interpreted.
+type Location struct {
+	Code             string `json:"code"`
+	Name             string `json:"name"`
+	Address          string `json:"address"`
+	OpensAt          uint32 `json:"opens_at"`
+	ClosesAt         uint32 `json:"closes_at"`
+	UTCOffsetMinutes int32  `json:"utc_offset_minutes"`
+}
+
+// IsOpenAt reports whether the branch is open at the given minute since the
+// Unix epoch. Opening and closing minutes are both inclusive, so a car can be
+// returned right at closing time.
+func (l Location) IsOpenAt(minute uint64) bool {
+	if l.OpensAt == l.ClosesAt {
+		return true
+	}
+	// The arithmetic stays in uint64 so that minutes past MaxInt64 work too.
+	offset := int64(l.UTCOffsetMinutes) % minutesPerDay
+	if offset < 0 {
+		offset += minutesPerDay
+	}
+	local := (minute%minutesPerDay + uint64(offset)) % minutesPerDay
+	opens, closes := uint64(l.OpensAt), uint64(l.ClosesAt)
+	if opens < closes {
+		return local >= opens && local <= closes
+	}
+	return local >= opens || local <= closes
+}
+
+const minutesPerDay = 24 * 60
+
+// MaintenanceWindow takes a car out of service, see the fleet service for the
+// meaning of the repeat fields.
+type MaintenanceWindow struct {
+	WindowID     uint64 `json:"window_id"`
+	CarID        uint64 `json:"car_id"`
+	Reason       string `json:"reason"`
+	FromMinute   uint64 `json:"from_minute"`
+	ToMinute     uint64 `json:"to_minute"`
+	EveryMinutes uint64 `json:"every_minutes"`
+	UntilMinute  uint64 `json:"until_minute"`
+}
+
+type Client struct {
+	addr       string
+	scheme     string
+	httpClient *http.Client
+}
+
+// New creates a client for the fleet service listening on addr (host:port).
+func New(addr string) *Client {
+	return &Client{
+		addr:       addr,
+		scheme:     "http",
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// SetTimeout limits how long a single call may take.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.httpClient.Timeout = timeout
+}
+
+// SetTLS makes calls over HTTPS with config, which also holds the client
+// certificate for mutual TLS. A nil config keeps plain HTTP.
+func (c *Client) SetTLS(config *tls.Config) {
+	if config == nil {
+		return
+	}
+	c.scheme = "https"
+	c.httpClient.Transport = &http.Transport{TLSClientConfig: config}
+}
+
+func (c *Client) GetCar(carID uint64) (Car, error) {
+	var car Car
+	err := c.call("/get_car", map[string]uint64{"car_id": carID}, &car)
+	if err == errNotFound {
+		return Car{}, ErrCarNotFound
+	}
+	if err != nil {
+		return Car{}, err
+	}
+	return car, nil
+}
+
+func (c *Client) GetLocation(code string) (Location, error) {
+	var location Location
+	err := c.call("/get_location", map[string]string{"code": code}, &location)
+	if err == errNotFound {
+		return Location{}, ErrLocationNotFound
+	}
+	if err != nil {
+		return Location{}, err
+	}
+	return location, nil
+}
+
+// MaintenanceWindows returns the car's maintenance windows that have an occurrence in span.
+func (c *Client) MaintenanceWindows(carID uint64, span interval.Interval) ([]MaintenanceWindow, error) {
+	var response struct {
+		Windows []MaintenanceWindow `json:"windows"`
+	}
+	request := map[string]uint64{"car_id": carID, "from_minute": span.From, "to_minute": span.To}
+	err := c.call("/list_maintenance", request, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response.Windows, nil
+}
+
+func (c *Client) call(path string, request interface{}, response interface{}) error {
+	requestBytes, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Post(c.scheme+"://"+c.addr+path, "application/json", bytes.NewReader(requestBytes))
+	if err != nil {
+		return fmt.Errorf("fleet request %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("fleet request %s: error reading body: %w", path, err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fleet request %s: status %d: %s", path, resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return json.Unmarshal(body, response)
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLocationIsOpenAt(t *testing.T) {
+	day := Location{OpensAt: 8 * 60, ClosesAt: 20 * 60}
+	night := Location{OpensAt: 22 * 60, ClosesAt: 6 * 60}
+	moscow := Location{OpensAt: 8 * 60, ClosesAt: 20 * 60, UTCOffsetMinutes: 180}
+	honolulu := Location{OpensAt: 8 * 60, ClosesAt: 20 * 60, UTCOffsetMinutes: -600}
+	// MaxUint64 falls on 12:15 UTC; cast to int64 it used to be -1, 23:59.
+	for _, test := range []struct {
+		name     string
+		location Location
+		minute   uint64
+		open     bool
+	}{
+		{"always open", Location{}, 3 * 60, true},
+		{"before opening", day, 8*60 - 1, false},
+		{"at opening", day, 8 * 60, true},
+		{"at closing", day, 20 * 60, true},
+		{"after closing", day, 20*60 + 1, false},
+		{"overnight late", night, 23 * 60, true},
+		{"overnight early", night, 5 * 60, true},
+		{"overnight day", night, 12 * 60, false},
+		{"positive offset", moscow, 5 * 60, true},
+		{"positive offset closed", moscow, 17*60 + 1, false},
+		{"negative offset", honolulu, 18 * 60, true},
+		{"negative offset previous day", honolulu, 60, true},
+		{"negative offset closed", honolulu, 7 * 60, false},
+		{"past MaxInt64", day, (math.MaxInt64/minutesPerDay+1)*minutesPerDay + 12*60, true},
+		{"past MaxInt64 closed", day, (math.MaxInt64/minutesPerDay+1)*minutesPerDay + 21*60, false},
+		{"MaxUint64", day, math.MaxUint64, true},
+		{"MaxUint64 closed", night, math.MaxUint64, false},
+		{"MaxUint64 positive offset", moscow, math.MaxUint64, true},
+		{"MaxUint64 negative offset", honolulu, math.MaxUint64, false},
+	} {
+		if got := test.location.IsOpenAt(test.minute); got != test.open {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.open)
+		}
+	}
+}
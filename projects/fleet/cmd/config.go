@@ -0,0 +1,55 @@
+package main
+
+import (
+	"distributed-rental/pkg/config"
+	"time"
+)
+
+type Config struct {
+	HTTP             config.HTTP      `yaml:"http"`
+	TLS              config.TLS       `yaml:"tls"`
+	JWTSecretPath    string           `yaml:"jwt_secret_path" usage:"path to jwt secret"`
+	JWTSecret        string           `yaml:"jwt_secret" secret:"true" usage:"jwt secret, takes precedence over jwt_secret_path"`
+	AuthAddr         string           `yaml:"auth_addr" usage:"auth service addr used to reject tokens revoked by a password change, empty disables the check"`
+	TokenCacheTTL    time.Duration    `yaml:"token_cache_ttl" usage:"how long a token checked with the auth service is trusted"`
+	BookingAddr      string           `yaml:"booking_addr" usage:"booking service addr used to report maintenance conflicts, empty disables it"`
+	LeaseAddr        string           `yaml:"lease_addr" usage:"lease service addr used to report maintenance conflicts, empty disables it"`
+	ClientTimeout    time.Duration    `yaml:"client_timeout" usage:"timeout of calls to other services"`
+	ClientID         string           `yaml:"client_id" usage:"service client id of fleet in the auth service"`
+	ClientSecretPath string           `yaml:"client_secret_path" usage:"path to the service client secret, without it maintenance conflicts are not reported"`
+	ClientSecret     string           `yaml:"client_secret" secret:"true" usage:"service client secret, takes precedence over client_secret_path"`
+	Badger           config.Badger    `yaml:"badger"`
+	Admin            config.Admin     `yaml:"admin"`
+	RateLimit        config.RateLimit `yaml:"rate_limit"`
+	Log              config.Log       `yaml:"log"`
+	MigrateDryRun    bool             `yaml:"-" flag:"migrate-dry-run" usage:"report what pending badger migrations would change and exit"`
+	OpenAPI          string           `yaml:"-" flag:"openapi" usage:"write the OpenAPI document of the REST API v1 to this file and exit"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		HTTP:             config.DefaultHTTP("localhost:3003"),
+		JWTSecretPath:    "/etc/jwt-secret",
+		AuthAddr:         "localhost:3000",
+		TokenCacheTTL:    10 * time.Second,
+		BookingAddr:      "localhost:3002",
+		LeaseAddr:        "localhost:3001",
+		ClientTimeout:    5 * time.Second,
+		ClientID:         "fleet",
+		ClientSecretPath: "/etc/fleet-client-secret",
+		Badger:           config.DefaultBadger("/var/fleet_db"),
+		Admin:            config.DefaultAdmin(),
+		RateLimit:        config.RateLimit{Routes: "/list_cars=10/s:20,GET /v1/cars=10/s:20", Store: "memory", SQLitePath: "/var/fleet_ratelimit.sqlite"},
+		Log:              config.DefaultLog(),
+	}
+}
+
+func (c *Config) Validate() error {
+	for _, section := range []config.Validator{c.HTTP, c.TLS, c.Badger, c.RateLimit, c.Log} {
+		err := section.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"distributed-rental/pkg/backup"
+	"distributed-rental/pkg/config"
+	"distributed-rental/pkg/migrate"
+	"distributed-rental/pkg/openapi"
+	"distributed-rental/pkg/servicetoken"
+	auth "distributed-rental/projects/auth/client"
+	booking "distributed-rental/projects/booking/client"
+	"distributed-rental/projects/fleet/internal"
+	lease "distributed-rental/projects/lease/client"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	cfg := defaultConfig()
+	err := config.Load(&cfg, "fleet", os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.OpenAPI != "" {
+		err = openapi.WriteFile(cfg.OpenAPI, internal.OpenAPI())
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	logger, err := cfg.Log.Logger()
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger.Sugar().Infow("effective config", "config", config.Redacted(&cfg))
+
+	db, err := cfg.Badger.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = migrate.Run(db, internal.BadgerMigrations, migrate.Options{DryRun: cfg.MigrateDryRun, Logger: logger.Sugar()})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.MigrateDryRun {
+		return
+	}
+
+	if cfg.Admin.Addr != "" {
+		adminServer, err := backup.Serve(cfg.Admin.Addr, db, cfg.Admin.TokenPath, logger.Sugar())
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer adminServer.Close()
+	}
+
+	jwtSecret, err := config.ReadSecret(cfg.JWTSecret, cfg.JWTSecretPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Cars, branches and maintenance windows are changed with the admin token
+	// or a service token granting fleet:write.
+	adminToken, err := os.ReadFile(cfg.Admin.TokenPath)
+	if os.IsNotExist(err) {
+		logger.Sugar().Warnf("no admin token at %s, only service tokens can change the catalog", cfg.Admin.TokenPath)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	carIDSequence, err := db.GetSequence([]byte("car_id_sequence"), cfg.Badger.SequenceBandwidth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	maintenanceIDSequence, err := db.GetSequence([]byte("maintenance_id_sequence"), cfg.Badger.SequenceBandwidth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	serverTLS, err := cfg.TLS.ServerConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	clientTLS, err := cfg.TLS.ClientConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var authClient *auth.Client
+	if cfg.AuthAddr != "" {
+		authClient = auth.New(cfg.AuthAddr)
+		authClient.SetTimeout(cfg.ClientTimeout)
+		authClient.SetTLS(clientTLS)
+		authClient.SetCacheTTL(cfg.TokenCacheTTL)
+	}
+
+	// Maintenance conflicts are read from booking and lease with a service
+	// token, which fleet gets from auth with its client secret.
+	var serviceTokens internal.TokenSource
+	clientSecret, err := config.ReadSecret(cfg.ClientSecret, cfg.ClientSecretPath)
+	switch {
+	case os.IsNotExist(err):
+		logger.Sugar().Warnf("no client secret at %s, maintenance conflicts are not reported", cfg.ClientSecretPath)
+	case err != nil:
+		log.Fatal(err)
+	case authClient == nil:
+		logger.Sugar().Warnf("no auth_addr to get service tokens from, maintenance conflicts are not reported")
+	default:
+		serviceTokens = authClient.ServiceTokens(cfg.ClientID, string(bytes.TrimSpace(clientSecret)), servicetoken.ScopeBookingRead, servicetoken.ScopeLeaseRead)
+	}
+
+	var bookings internal.BookingLister
+	if cfg.BookingAddr != "" && serviceTokens != nil {
+		bookingClient := booking.New(cfg.BookingAddr)
+		bookingClient.SetTimeout(cfg.ClientTimeout)
+		bookingClient.SetTLS(clientTLS)
+		bookings = bookingClient
+	}
+	var leases internal.LeaseLister
+	if cfg.LeaseAddr != "" && serviceTokens != nil {
+		leaseClient := lease.New(cfg.LeaseAddr)
+		leaseClient.SetTimeout(cfg.ClientTimeout)
+		leaseClient.SetTLS(clientTLS)
+		leases = leaseClient
+	}
+
+	fleetService := internal.NewFleetService(db, carIDSequence, maintenanceIDSequence, logger.Sugar(), bookings, leases, serviceTokens)
+
+	httpServer := internal.NewHttpServer(cfg.HTTP.Addr, fleetService, jwtSecret, logger.Sugar())
+	httpServer.SetTimeouts(cfg.HTTP.ReadTimeout, cfg.HTTP.WriteTimeout, cfg.HTTP.IdleTimeout)
+	httpServer.SetTLS(serverTLS)
+	httpServer.SetAdminToken(bytes.TrimSpace(adminToken))
+	if authClient != nil {
+		httpServer.SetTokenVerifier(authClient)
+	}
+
+	limiter, err := cfg.RateLimit.Limiter(logger.Sugar())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer limiter.Close()
+	httpServer.SetRateLimit(limiter)
+
+	go func() {
+		err := httpServer.ListenAndServe()
+		if err != http.ErrServerClosed {
+			logger.Sugar().Errorf("error closing server: %v", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGSTOP)
+
+	<-signals
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	err = httpServer.Shutdown(ctx)
+	if err != nil {
+		logger.Sugar().Errorf("error shutting down server: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"distributed-rental/pkg/openapi"
+	"net/http"
+)
+
+var apiInfo = openapi.Info{
+	Title:       "fleet",
+	Description: "The catalog of cars, rental branches and maintenance windows.",
+	Version:     "1",
+}
+
+var securityManager = []string{openapi.SecurityAdmin, openapi.SecurityService}
+
+// operations are the v1 routes of the fleet API, registered by NewHttpServer
+// and described at /openapi.json.
+func (c *HttpServer) operations() []openapi.Operation {
+	return []openapi.Operation{
+		{Method: http.MethodPost, Path: "/v1/cars", ID: "createCar", Summary: "Add a car to the catalog",
+			Security: securityManager, Request: Car{}, Response: Car{}, Status: http.StatusCreated, Handler: c.createCar},
+		{Method: http.MethodGet, Path: "/v1/cars", ID: "listCars", Summary: "List cars; from_minute and to_minute leave out cars under maintenance then",
+			Request: listCarsRequest{}, Response: listCarsResponse{}, Handler: c.listCars},
+		{Method: http.MethodGet, Path: "/v1/cars/{car_id}", ID: "getCar", Summary: "Get a car",
+			Request: carIDRequest{}, Response: Car{}, Handler: c.getCar},
+		{Method: http.MethodPut, Path: "/v1/cars/{car_id}", ID: "updateCar", Summary: "Replace a car",
+			Security: securityManager, Request: Car{}, Response: Car{}, Handler: c.updateCar},
+		{Method: http.MethodDelete, Path: "/v1/cars/{car_id}", ID: "deleteCar", Summary: "Remove a car from the catalog",
+			Security: securityManager, Request: carIDRequest{}, Handler: c.deleteCar},
+		{Method: http.MethodPost, Path: "/v1/cars/{car_id}/maintenance", ID: "createMaintenance", Summary: "Schedule a maintenance window and get the bookings and leases it conflicts with",
+			Security: securityManager, Request: MaintenanceWindow{}, Response: createMaintenanceResponse{}, Status: http.StatusCreated, Handler: c.createMaintenance},
+		{Method: http.MethodGet, Path: "/v1/cars/{car_id}/maintenance", ID: "listMaintenance", Summary: "List the maintenance windows of a car that have an occurrence in an interval",
+			Request: listMaintenanceRequest{}, Response: listMaintenanceResponse{}, Handler: c.listMaintenance},
+		{Method: http.MethodDelete, Path: "/v1/cars/{car_id}/maintenance/{window_id}", ID: "deleteMaintenance", Summary: "Delete a maintenance window",
+			Security: securityManager, Request: deleteMaintenanceRequest{}, Handler: c.deleteMaintenance},
+		{Method: http.MethodPost, Path: "/v1/locations", ID: "createLocation", Summary: "Add a rental branch",
+			Security: securityManager, Request: Location{}, Response: Location{}, Status: http.StatusCreated, Handler: c.createLocation},
+		{Method: http.MethodGet, Path: "/v1/locations", ID: "listLocations", Summary: "List the rental branches",
+			Response: listLocationsResponse{}, Handler: c.listLocations},
+		{Method: http.MethodGet, Path: "/v1/locations/{code}", ID: "getLocation", Summary: "Get a rental branch",
+			Request: locationCodeRequest{}, Response: Location{}, Handler: c.getLocation},
+	}
+}
+
+// OpenAPI describes the v1 routes of the fleet API.
+func OpenAPI() *openapi.Document {
+	return openapi.Build(apiInfo, (&HttpServer{}).operations())
+}
@@ -0,0 +1,487 @@
+package internal
+
+import (
+	"distributed-rental/pkg/interval"
+	"encoding/json"
+	"errors"
+	"fmt"
+	badger "github.com/dgraph-io/badger/v3"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+)
+
+const (
+	StatusActive  = "active"
+	StatusRetired = "retired"
+)
+
+var carNotFound = errors.New("car not found")
+var plateAlreadyExists = errors.New("car with this plate already exists")
+var invalidCar = errors.New("invalid car")
+var locationNotFound = errors.New("location not found")
+var locationAlreadyExists = errors.New("location already exists")
+var invalidLocation = errors.New("invalid location")
+
+var transmissions = map[string]bool{"manual": true, "automatic": true}
+var fuelTypes = map[string]bool{"petrol": true, "diesel": true, "electric": true, "hybrid": true}
+var statuses = map[string]bool{StatusActive: true, StatusRetired: true}
+
+type FleetService struct {
+	db                    *badger.DB
+	carIDSequence         *badger.Sequence
+	maintenanceIDSequence *badger.Sequence
+	logger                *zap.SugaredLogger
+	bookings              BookingLister
+	leases                LeaseLister
+	serviceTokens         TokenSource
+}
+
+// NewFleetService creates a fleet service. bookings and leases are used to
+// report maintenance conflicts; either may be nil to skip that service.
+// serviceTokens authenticates fleet to them and may be nil if both are.
+func NewFleetService(db *badger.DB, carIDSequence *badger.Sequence, maintenanceIDSequence *badger.Sequence, logger *zap.SugaredLogger, bookings BookingLister, leases LeaseLister, serviceTokens TokenSource) *FleetService {
+	return &FleetService{
+		db:                    db,
+		carIDSequence:         carIDSequence,
+		maintenanceIDSequence: maintenanceIDSequence,
+		logger:                logger,
+		bookings:              bookings,
+		leases:                leases,
+		serviceTokens:         serviceTokens,
+	}
+}
+
+type Car struct {
+	CarID        uint64 `json:"car_id"`
+	Make         string `json:"make"`
+	Model        string `json:"model"`
+	Class        string `json:"class"`
+	Seats        uint32 `json:"seats"`
+	Transmission string `json:"transmission"`
+	FuelType     string `json:"fuel_type"`
+	Plate        string `json:"plate"`
+	HomeLocation string `json:"home_location"`
+	Status       string `json:"status"`
+}
+
+type CarDBModel struct {
+	CarID        uint64 `json:"car_id,omitempty"`
+	Make         string `json:"make,omitempty"`
+	Model        string `json:"model,omitempty"`
+	Class        string `json:"class,omitempty"`
+	Seats        uint32 `json:"seats,omitempty"`
+	Transmission string `json:"transmission,omitempty"`
+	FuelType     string `json:"fuel_type,omitempty"`
+	Plate        string `json:"plate,omitempty"`
+	HomeLocation string `json:"home_location,omitempty"`
+	Status       string `json:"status,omitempty"`
+}
+
+// Location is a branch where cars are picked up and returned. Opening hours
+// are minutes of the local day; OpensAt == ClosesAt means open around the clock
+// and ClosesAt < OpensAt means the branch closes after midnight.
+type Location struct {
+	Code             string `json:"code"`
+	Name             string `json:"name"`
+	Address          string `json:"address"`
+	OpensAt          uint32 `json:"opens_at"`
+	ClosesAt         uint32 `json:"closes_at"`
+	UTCOffsetMinutes int32  `json:"utc_offset_minutes"`
+}
+
+type LocationDBModel struct {
+	Code             string `json:"code,omitempty"`
+	Name             string `json:"name,omitempty"`
+	Address          string `json:"address,omitempty"`
+	OpensAt          uint32 `json:"opens_at,omitempty"`
+	ClosesAt         uint32 `json:"closes_at,omitempty"`
+	UTCOffsetMinutes int32  `json:"utc_offset_minutes,omitempty"`
+}
+
+func locationKey(code string) []byte {
+	return []byte("location_" + code)
+}
+
+func carKey(carID uint64) []byte {
+	return []byte(fmt.Sprintf("car_%d", carID))
+}
+
+func plateKey(plate string) []byte {
+	return []byte("plate_" + strings.ToUpper(plate))
+}
+
+func validateCar(car Car) error {
+	if car.Make == "" || car.Model == "" || car.Plate == "" {
+		return fmt.Errorf("%w: make, model and plate are required", invalidCar)
+	}
+	if !transmissions[car.Transmission] {
+		return fmt.Errorf("%w: unknown transmission %q", invalidCar, car.Transmission)
+	}
+	if !fuelTypes[car.FuelType] {
+		return fmt.Errorf("%w: unknown fuel type %q", invalidCar, car.FuelType)
+	}
+	if !statuses[car.Status] {
+		return fmt.Errorf("%w: unknown status %q", invalidCar, car.Status)
+	}
+	return nil
+}
+
+func validateLocation(location Location) error {
+	if location.Code == "" || location.Name == "" {
+		return fmt.Errorf("%w: code and name are required", invalidLocation)
+	}
+	if location.OpensAt >= 24*60 || location.ClosesAt >= 24*60 {
+		return fmt.Errorf("%w: opening hours must be minutes of the day", invalidLocation)
+	}
+	return nil
+}
+
+// checkHomeLocation makes sure a car is not assigned to a branch that does not exist.
+func (c *FleetService) checkHomeLocation(tx *badger.Txn, car Car) error {
+	if car.HomeLocation == "" {
+		return nil
+	}
+	_, err := tx.Get(locationKey(car.HomeLocation))
+	if err == badger.ErrKeyNotFound {
+		return fmt.Errorf("%w: unknown home location %q", invalidCar, car.HomeLocation)
+	}
+	return err
+}
+
+func (c *FleetService) createCar(car Car) (Car, error) {
+	if car.Status == "" {
+		car.Status = StatusActive
+	}
+	err := validateCar(car)
+	if err != nil {
+		return Car{}, err
+	}
+
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	err = c.checkHomeLocation(tx, car)
+	if err != nil {
+		return Car{}, err
+	}
+
+	_, err = tx.Get(plateKey(car.Plate))
+	if err == nil {
+		return Car{}, plateAlreadyExists
+	}
+	if err != badger.ErrKeyNotFound {
+		return Car{}, err
+	}
+
+	carID, err := c.carIDSequence.Next()
+	if err != nil {
+		return Car{}, err
+	}
+	// car_id 0 is what clients send when they omit the field, so it is never issued.
+	if carID == 0 {
+		carID, err = c.carIDSequence.Next()
+		if err != nil {
+			return Car{}, err
+		}
+	}
+	car.CarID = carID
+
+	err = c.putCar(tx, car)
+	if err != nil {
+		return Car{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Car{}, err
+	}
+
+	return car, nil
+}
+
+func (c *FleetService) getCar(carID uint64) (Car, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	return c.readCar(tx, carID)
+}
+
+// updateCar replaces the stored car with the given one, keeping the plate index in sync.
+func (c *FleetService) updateCar(car Car) (Car, error) {
+	err := validateCar(car)
+	if err != nil {
+		return Car{}, err
+	}
+
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	existing, err := c.readCar(tx, car.CarID)
+	if err != nil {
+		return Car{}, err
+	}
+
+	err = c.checkHomeLocation(tx, car)
+	if err != nil {
+		return Car{}, err
+	}
+
+	if !strings.EqualFold(existing.Plate, car.Plate) {
+		_, err = tx.Get(plateKey(car.Plate))
+		if err == nil {
+			return Car{}, plateAlreadyExists
+		}
+		if err != badger.ErrKeyNotFound {
+			return Car{}, err
+		}
+		err = tx.Delete(plateKey(existing.Plate))
+		if err != nil {
+			return Car{}, err
+		}
+	}
+
+	err = c.putCar(tx, car)
+	if err != nil {
+		return Car{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Car{}, err
+	}
+
+	return car, nil
+}
+
+func (c *FleetService) deleteCar(carID uint64) error {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	existing, err := c.readCar(tx, carID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Delete(carKey(carID))
+	if err != nil {
+		return err
+	}
+	err = tx.Delete(plateKey(existing.Plate))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// listCars returns all cars matching the non-empty filter fields. With a valid
+// span, cars with maintenance scheduled during it are left out.
+func (c *FleetService) listCars(class string, status string, homeLocation string, span interval.Interval) ([]Car, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = []byte("car_")
+	it := tx.NewIterator(opts)
+	defer it.Close()
+
+	cars := []Car{}
+	for it.Rewind(); it.Valid(); it.Next() {
+		// The car id sequence shares the prefix.
+		_, err := strconv.ParseUint(strings.TrimPrefix(string(it.Item().Key()), "car_"), 10, 64)
+		if err != nil {
+			continue
+		}
+		value, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		carDBModel := CarDBModel{}
+		err = json.Unmarshal(value, &carDBModel)
+		if err != nil {
+			return nil, err
+		}
+		car := carFromDBModel(carDBModel)
+		if class != "" && car.Class != class {
+			continue
+		}
+		if status != "" && car.Status != status {
+			continue
+		}
+		if homeLocation != "" && car.HomeLocation != homeLocation {
+			continue
+		}
+		if span.Valid() {
+			windows, err := c.maintenanceWindows(tx, car.CarID, span)
+			if err != nil {
+				return nil, err
+			}
+			if len(windows) > 0 {
+				continue
+			}
+		}
+		cars = append(cars, car)
+	}
+	return cars, nil
+}
+
+func (c *FleetService) readCar(tx *badger.Txn, carID uint64) (Car, error) {
+	item, err := tx.Get(carKey(carID))
+	if err == badger.ErrKeyNotFound {
+		return Car{}, carNotFound
+	}
+	if err != nil {
+		return Car{}, err
+	}
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return Car{}, err
+	}
+	carDBModel := CarDBModel{}
+	err = json.Unmarshal(value, &carDBModel)
+	if err != nil {
+		return Car{}, err
+	}
+	return carFromDBModel(carDBModel), nil
+}
+
+func (c *FleetService) putCar(tx *badger.Txn, car Car) error {
+	carDBModel := CarDBModel{
+		CarID:        car.CarID,
+		Make:         car.Make,
+		Model:        car.Model,
+		Class:        car.Class,
+		Seats:        car.Seats,
+		Transmission: car.Transmission,
+		FuelType:     car.FuelType,
+		Plate:        car.Plate,
+		HomeLocation: car.HomeLocation,
+		Status:       car.Status,
+	}
+	carBts, err := json.Marshal(&carDBModel)
+	if err != nil {
+		return err
+	}
+	err = tx.Set(carKey(car.CarID), carBts)
+	if err != nil {
+		return err
+	}
+	return tx.Set(plateKey(car.Plate), carKey(car.CarID))
+}
+
+func carFromDBModel(m CarDBModel) Car {
+	return Car{
+		CarID:        m.CarID,
+		Make:         m.Make,
+		Model:        m.Model,
+		Class:        m.Class,
+		Seats:        m.Seats,
+		Transmission: m.Transmission,
+		FuelType:     m.FuelType,
+		Plate:        m.Plate,
+		HomeLocation: m.HomeLocation,
+		Status:       m.Status,
+	}
+}
+
+func (c *FleetService) createLocation(location Location) (Location, error) {
+	err := validateLocation(location)
+	if err != nil {
+		return Location{}, err
+	}
+
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	_, err = tx.Get(locationKey(location.Code))
+	if err == nil {
+		return Location{}, locationAlreadyExists
+	}
+	if err != badger.ErrKeyNotFound {
+		return Location{}, err
+	}
+
+	locationDBModel := LocationDBModel{
+		Code:             location.Code,
+		Name:             location.Name,
+		Address:          location.Address,
+		OpensAt:          location.OpensAt,
+		ClosesAt:         location.ClosesAt,
+		UTCOffsetMinutes: location.UTCOffsetMinutes,
+	}
+	locationBts, err := json.Marshal(&locationDBModel)
+	if err != nil {
+		return Location{}, err
+	}
+	err = tx.Set(locationKey(location.Code), locationBts)
+	if err != nil {
+		return Location{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Location{}, err
+	}
+
+	return location, nil
+}
+
+func (c *FleetService) getLocation(code string) (Location, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	item, err := tx.Get(locationKey(code))
+	if err == badger.ErrKeyNotFound {
+		return Location{}, locationNotFound
+	}
+	if err != nil {
+		return Location{}, err
+	}
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return Location{}, err
+	}
+	locationDBModel := LocationDBModel{}
+	err = json.Unmarshal(value, &locationDBModel)
+	if err != nil {
+		return Location{}, err
+	}
+	return locationFromDBModel(locationDBModel), nil
+}
+
+func (c *FleetService) listLocations() ([]Location, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = []byte("location_")
+	it := tx.NewIterator(opts)
+	defer it.Close()
+
+	locations := []Location{}
+	for it.Rewind(); it.Valid(); it.Next() {
+		value, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		locationDBModel := LocationDBModel{}
+		err = json.Unmarshal(value, &locationDBModel)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, locationFromDBModel(locationDBModel))
+	}
+	return locations, nil
+}
+
+func locationFromDBModel(m LocationDBModel) Location {
+	return Location{
+		Code:             m.Code,
+		Name:             m.Name,
+		Address:          m.Address,
+		OpensAt:          m.OpensAt,
+		ClosesAt:         m.ClosesAt,
+		UTCOffsetMinutes: m.UTCOffsetMinutes,
+	}
+}
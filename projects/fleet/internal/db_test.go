@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"distributed-rental/pkg/interval"
+	"testing"
+)
+
+func TestListCars(t *testing.T) {
+	fleetService := newTestFleetService(t)
+	_, err := fleetService.createLocation(Location{Code: "center", Name: "Center"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cars := []Car{}
+	for _, car := range []Car{
+		{Make: "Lada", Model: "Niva", Class: "suv", Plate: "A001AA", Transmission: "manual", FuelType: "petrol", HomeLocation: "center"},
+		{Make: "Skoda", Model: "Octavia", Class: "economy", Plate: "A002AA", Transmission: "automatic", FuelType: "petrol"},
+		{Make: "Lada", Model: "Vesta", Class: "economy", Plate: "A003AA", Transmission: "manual", FuelType: "petrol", Status: StatusRetired},
+	} {
+		car, err := fleetService.createCar(car)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cars = append(cars, car)
+	}
+	_, _, err = fleetService.createMaintenance(MaintenanceWindow{CarID: cars[1].CarID, Reason: "tyres", FromMinute: 100, ToMinute: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		class, status, homeLocation string
+		span                        interval.Interval
+		want                        []Car
+	}{
+		{want: cars},
+		{class: "economy", want: []Car{cars[1], cars[2]}},
+		{status: StatusActive, want: []Car{cars[0], cars[1]}},
+		{homeLocation: "center", want: []Car{cars[0]}},
+		{class: "economy", status: StatusActive, want: []Car{cars[1]}},
+		{span: interval.Interval{From: 150, To: 300}, want: []Car{cars[0], cars[2]}},
+		{span: interval.Interval{From: 200, To: 300}, want: cars},
+	} {
+		got, err := fleetService.listCars(test.class, test.status, test.homeLocation, test.span)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("listCars(%q, %q, %q, %v) = %+v, want %+v", test.class, test.status, test.homeLocation, test.span, got, test.want)
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Fatalf("listCars(%q, %q, %q, %v) = %+v, want %+v", test.class, test.status, test.homeLocation, test.span, got, test.want)
+			}
+		}
+	}
+}
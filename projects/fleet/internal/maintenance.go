@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"distributed-rental/pkg/interval"
+	booking "distributed-rental/projects/booking/client"
+	lease "distributed-rental/projects/lease/client"
+	"encoding/json"
+	"errors"
+	"fmt"
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+var maintenanceNotFound = errors.New("maintenance window not found")
+var invalidMaintenance = errors.New("invalid maintenance window")
+
+// BookingLister reads a car's bookings from the booking service.
+type BookingLister interface {
+	CarBookings(token string, carID uint64, fromMinute uint64) ([]booking.Booking, error)
+}
+
+// LeaseLister reads a car's leases from the lease service.
+type LeaseLister interface {
+	CarLeases(token string, carID uint64, fromMinute uint64) ([]lease.Lease, error)
+}
+
+// TokenSource hands out the service token fleet calls the other services with.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// MaintenanceWindow takes a car out of service for [FromMinute, ToMinute).
+// With EveryMinutes set the window repeats with that period until UntilMinute,
+// or forever if UntilMinute is zero.
+type MaintenanceWindow struct {
+	WindowID     uint64 `json:"window_id"`
+	CarID        uint64 `json:"car_id"`
+	Reason       string `json:"reason"`
+	FromMinute   uint64 `json:"from_minute"`
+	ToMinute     uint64 `json:"to_minute"`
+	EveryMinutes uint64 `json:"every_minutes,omitempty"`
+	UntilMinute  uint64 `json:"until_minute,omitempty"`
+}
+
+type MaintenanceWindowDBModel struct {
+	WindowID     uint64 `json:"window_id,omitempty"`
+	CarID        uint64 `json:"car_id,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	FromMinute   uint64 `json:"from_minute,omitempty"`
+	ToMinute     uint64 `json:"to_minute,omitempty"`
+	EveryMinutes uint64 `json:"every_minutes,omitempty"`
+	UntilMinute  uint64 `json:"until_minute,omitempty"`
+}
+
+func (c MaintenanceWindow) schedule() interval.Recurring {
+	return interval.Recurring{
+		First:  interval.Interval{From: c.FromMinute, To: c.ToMinute},
+		Period: c.EveryMinutes,
+		Until:  c.UntilMinute,
+	}
+}
+
+// Conflict is an existing rental that overlaps a new maintenance window.
+type Conflict struct {
+	Service    string `json:"service"`
+	RentalID   uint64 `json:"rental_id"`
+	UserID     uint64 `json:"user_id"`
+	FromMinute uint64 `json:"from_minute"`
+	ToMinute   uint64 `json:"to_minute"`
+}
+
+func maintenancePrefix(carID uint64) []byte {
+	return []byte(fmt.Sprintf("maintenance_%d_", carID))
+}
+
+func maintenanceKey(carID uint64, windowID uint64) []byte {
+	return []byte(fmt.Sprintf("maintenance_%d_%d", carID, windowID))
+}
+
+func validateMaintenance(window MaintenanceWindow) error {
+	if window.Reason == "" {
+		return fmt.Errorf("%w: reason is required", invalidMaintenance)
+	}
+	if window.FromMinute >= window.ToMinute {
+		return fmt.Errorf("%w: %v", invalidMaintenance, interval.ErrInvalid)
+	}
+	if window.EveryMinutes != 0 && window.EveryMinutes < window.ToMinute-window.FromMinute {
+		return fmt.Errorf("%w: repeat period is shorter than the window", invalidMaintenance)
+	}
+	return nil
+}
+
+// createMaintenance stores the window and reports the existing bookings and
+// leases it overlaps. Those rentals are left in place for the fleet manager
+// to resolve. The rental services are asked with fleet's own service token.
+func (c *FleetService) createMaintenance(window MaintenanceWindow) (MaintenanceWindow, []Conflict, error) {
+	err := validateMaintenance(window)
+	if err != nil {
+		return MaintenanceWindow{}, nil, err
+	}
+
+	_, err = c.getCar(window.CarID)
+	if err != nil {
+		return MaintenanceWindow{}, nil, err
+	}
+
+	conflicts, err := c.maintenanceConflicts(window)
+	if err != nil {
+		return MaintenanceWindow{}, nil, err
+	}
+
+	windowID, err := c.maintenanceIDSequence.Next()
+	if err != nil {
+		return MaintenanceWindow{}, nil, err
+	}
+	window.WindowID = windowID
+
+	windowDBModel := MaintenanceWindowDBModel{
+		WindowID:     window.WindowID,
+		CarID:        window.CarID,
+		Reason:       window.Reason,
+		FromMinute:   window.FromMinute,
+		ToMinute:     window.ToMinute,
+		EveryMinutes: window.EveryMinutes,
+		UntilMinute:  window.UntilMinute,
+	}
+	windowBts, err := json.Marshal(&windowDBModel)
+	if err != nil {
+		return MaintenanceWindow{}, nil, err
+	}
+	err = c.db.Update(func(tx *badger.Txn) error {
+		return tx.Set(maintenanceKey(window.CarID, window.WindowID), windowBts)
+	})
+	if err != nil {
+		return MaintenanceWindow{}, nil, err
+	}
+
+	return window, conflicts, nil
+}
+
+func (c *FleetService) maintenanceConflicts(window MaintenanceWindow) ([]Conflict, error) {
+	schedule := window.schedule()
+	conflicts := []Conflict{}
+	if c.bookings == nil && c.leases == nil {
+		return conflicts, nil
+	}
+
+	token, err := c.serviceTokens.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.bookings != nil {
+		bookings, err := c.bookings.CarBookings(token, window.CarID, window.FromMinute)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bookings {
+			if schedule.Overlaps(interval.Interval{From: b.FromMinute, To: b.ToMinute}) {
+				conflicts = append(conflicts, Conflict{
+					Service:    "booking",
+					RentalID:   b.BookingID,
+					UserID:     b.UserID,
+					FromMinute: b.FromMinute,
+					ToMinute:   b.ToMinute,
+				})
+			}
+		}
+	}
+
+	if c.leases != nil {
+		leases, err := c.leases.CarLeases(token, window.CarID, window.FromMinute)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range leases {
+			if schedule.Overlaps(interval.Interval{From: l.FromMinute, To: l.ToMinute}) {
+				conflicts = append(conflicts, Conflict{
+					Service:    "lease",
+					RentalID:   l.LeaseID,
+					UserID:     l.UserID,
+					FromMinute: l.FromMinute,
+					ToMinute:   l.ToMinute,
+				})
+			}
+		}
+	}
+
+	return conflicts, nil
+}
+
+func (c *FleetService) deleteMaintenance(carID uint64, windowID uint64) error {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	_, err := tx.Get(maintenanceKey(carID, windowID))
+	if err == badger.ErrKeyNotFound {
+		return maintenanceNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Delete(maintenanceKey(carID, windowID))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// listMaintenance returns the car's windows that have an occurrence in span.
+// An invalid (zero) span returns every window of the car.
+func (c *FleetService) listMaintenance(carID uint64, span interval.Interval) ([]MaintenanceWindow, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	return c.maintenanceWindows(tx, carID, span)
+}
+
+func (c *FleetService) maintenanceWindows(tx *badger.Txn, carID uint64, span interval.Interval) ([]MaintenanceWindow, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = maintenancePrefix(carID)
+	it := tx.NewIterator(opts)
+	defer it.Close()
+
+	windows := []MaintenanceWindow{}
+	for it.Rewind(); it.Valid(); it.Next() {
+		value, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		windowDBModel := MaintenanceWindowDBModel{}
+		err = json.Unmarshal(value, &windowDBModel)
+		if err != nil {
+			return nil, err
+		}
+		window := MaintenanceWindow{
+			WindowID:     windowDBModel.WindowID,
+			CarID:        windowDBModel.CarID,
+			Reason:       windowDBModel.Reason,
+			FromMinute:   windowDBModel.FromMinute,
+			ToMinute:     windowDBModel.ToMinute,
+			EveryMinutes: windowDBModel.EveryMinutes,
+			UntilMinute:  windowDBModel.UntilMinute,
+		}
+		if span.Valid() && !window.schedule().Overlaps(span) {
+			continue
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"distributed-rental/pkg/interval"
+	booking "distributed-rental/projects/booking/client"
+	lease "distributed-rental/projects/lease/client"
+	"errors"
+	"testing"
+)
+
+const week = 7 * interval.MinutesPerDay
+
+type testRentals struct {
+	bookings []booking.Booking
+	leases   []lease.Lease
+	err      error
+	calls    []string
+}
+
+func (c *testRentals) CarBookings(token string, carID uint64, fromMinute uint64) ([]booking.Booking, error) {
+	c.calls = append(c.calls, "bookings "+token)
+	return c.bookings, c.err
+}
+
+func (c *testRentals) CarLeases(token string, carID uint64, fromMinute uint64) ([]lease.Lease, error) {
+	c.calls = append(c.calls, "leases "+token)
+	return c.leases, c.err
+}
+
+type testTokens struct{}
+
+func (testTokens) Token() (string, error) {
+	return "service token", nil
+}
+
+func TestValidateMaintenance(t *testing.T) {
+	for name, test := range map[string]struct {
+		window MaintenanceWindow
+		valid  bool
+	}{
+		"once":                {MaintenanceWindow{Reason: "tyres", FromMinute: 100, ToMinute: 200}, true},
+		"weekly":              {MaintenanceWindow{Reason: "wash", FromMinute: 100, ToMinute: 200, EveryMinutes: week}, true},
+		"weekly until":        {MaintenanceWindow{Reason: "wash", FromMinute: 100, ToMinute: 200, EveryMinutes: week, UntilMinute: 4 * week}, true},
+		"back to back":        {MaintenanceWindow{Reason: "wash", FromMinute: 100, ToMinute: 200, EveryMinutes: 100}, true},
+		"no reason":           {MaintenanceWindow{FromMinute: 100, ToMinute: 200}, false},
+		"empty":               {MaintenanceWindow{Reason: "tyres", FromMinute: 100, ToMinute: 100}, false},
+		"inverted":            {MaintenanceWindow{Reason: "tyres", FromMinute: 200, ToMinute: 100}, false},
+		"period under window": {MaintenanceWindow{Reason: "wash", FromMinute: 100, ToMinute: 200, EveryMinutes: 99}, false},
+	} {
+		err := validateMaintenance(test.window)
+		if test.valid && err != nil {
+			t.Errorf("%s: got %v", name, err)
+		}
+		if !test.valid && !errors.Is(err, invalidMaintenance) {
+			t.Errorf("%s: got %v, want %v", name, err, invalidMaintenance)
+		}
+	}
+}
+
+// TestMaintenanceConflicts creates a weekly window of car 1 in [1000, 1100)
+// and checks which rentals it reports.
+func TestMaintenanceConflicts(t *testing.T) {
+	for name, test := range map[string]struct {
+		until     uint64
+		bookings  []booking.Booking
+		leases    []lease.Lease
+		conflicts []uint64
+	}{
+		"first occurrence": {
+			bookings:  []booking.Booking{{BookingID: 1, FromMinute: 900, ToMinute: 1000}, {BookingID: 2, FromMinute: 1050, ToMinute: 1060}},
+			leases:    []lease.Lease{{LeaseID: 3, FromMinute: 1099, ToMinute: 1200}},
+			conflicts: []uint64{2, 3},
+		},
+		"between occurrences": {
+			bookings: []booking.Booking{{BookingID: 1, FromMinute: 1100, ToMinute: week + 1000}},
+		},
+		"later occurrences": {
+			bookings:  []booking.Booking{{BookingID: 1, FromMinute: week + 1090, ToMinute: week + 1200}},
+			leases:    []lease.Lease{{LeaseID: 2, FromMinute: 50*week + 900, ToMinute: 50*week + 1001}},
+			conflicts: []uint64{1, 2},
+		},
+		"spanning occurrences": {
+			leases:    []lease.Lease{{LeaseID: 1, FromMinute: 1100, ToMinute: 3 * week}},
+			conflicts: []uint64{1},
+		},
+		"after until": {
+			until:     2*week + 1000,
+			bookings:  []booking.Booking{{BookingID: 1, FromMinute: week + 1000, ToMinute: week + 1001}, {BookingID: 2, FromMinute: 2*week + 1000, ToMinute: 2*week + 1100}},
+			conflicts: []uint64{1},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fleetService := newTestFleetService(t)
+			rentals := &testRentals{bookings: test.bookings, leases: test.leases}
+			fleetService.bookings, fleetService.leases, fleetService.serviceTokens = rentals, rentals, testTokens{}
+			car, err := fleetService.createCar(Car{Make: "Lada", Model: "Niva", Plate: "A001AA", Transmission: "manual", FuelType: "petrol"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			window := MaintenanceWindow{CarID: car.CarID, Reason: "wash", FromMinute: 1000, ToMinute: 1100, EveryMinutes: week, UntilMinute: test.until}
+			window, conflicts, err := fleetService.createMaintenance(window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []uint64{}
+			for _, conflict := range conflicts {
+				got = append(got, conflict.RentalID)
+			}
+			if len(got) != len(test.conflicts) {
+				t.Fatalf("got conflicts %v, want %v", got, test.conflicts)
+			}
+			for i := range got {
+				if got[i] != test.conflicts[i] {
+					t.Fatalf("got conflicts %v, want %v", got, test.conflicts)
+				}
+			}
+			if len(rentals.calls) != 2 || rentals.calls[0] != "bookings service token" || rentals.calls[1] != "leases service token" {
+				t.Fatalf("got calls %q", rentals.calls)
+			}
+
+			// The window is stored whether or not it conflicts.
+			windows, err := fleetService.listMaintenance(car.CarID, interval.Interval{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(windows) != 1 || windows[0] != window {
+				t.Fatalf("got windows %+v, want %+v", windows, window)
+			}
+		})
+	}
+}
+
+func TestMaintenanceConflictsFailure(t *testing.T) {
+	fleetService := newTestFleetService(t)
+	rentals := &testRentals{err: errors.New("booking is down")}
+	fleetService.bookings, fleetService.serviceTokens = rentals, testTokens{}
+	car, err := fleetService.createCar(Car{Make: "Lada", Model: "Niva", Plate: "A001AA", Transmission: "manual", FuelType: "petrol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = fleetService.createMaintenance(MaintenanceWindow{CarID: car.CarID, Reason: "wash", FromMinute: 1000, ToMinute: 1100})
+	if err != rentals.err {
+		t.Fatalf("got %v, want %v", err, rentals.err)
+	}
+	windows, err := fleetService.listMaintenance(car.CarID, interval.Interval{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 0 {
+		t.Fatalf("a window was stored without checking conflicts: %+v", windows)
+	}
+
+	_, _, err = fleetService.createMaintenance(MaintenanceWindow{CarID: car.CarID + 1, Reason: "wash", FromMinute: 1000, ToMinute: 1100})
+	if err != carNotFound {
+		t.Fatalf("unknown car: got %v, want %v", err, carNotFound)
+	}
+}
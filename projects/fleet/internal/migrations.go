@@ -0,0 +1,10 @@
+package internal
+
+import (
+	"distributed-rental/pkg/migrate"
+)
+
+// BadgerMigrations upgrade the badger key layout and records in order. There
+// are none yet; running the empty list still refuses databases written by a
+// newer binary.
+var BadgerMigrations []migrate.Migration
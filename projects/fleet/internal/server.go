@@ -0,0 +1,482 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"distributed-rental/pkg/interval"
+	"distributed-rental/pkg/openapi"
+	"distributed-rental/pkg/ratelimit"
+	"distributed-rental/pkg/rest"
+	"distributed-rental/pkg/servicetoken"
+	"distributed-rental/pkg/usertoken"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+type HttpServer struct {
+	server        *http.Server
+	fleetService  *FleetService
+	logger        *zap.SugaredLogger
+	jwtSigningKey []byte
+	tokenVerifier TokenVerifier
+	adminToken    []byte
+}
+
+var notFleetManager = errors.New("only fleet managers can change the catalog")
+
+func NewHttpServer(addr string, fleetService *FleetService, jwtSecret []byte, logger *zap.SugaredLogger) *HttpServer {
+	srv := &http.Server{
+		Addr: addr,
+	}
+
+	httpServer := HttpServer{
+		server:        srv,
+		fleetService:  fleetService,
+		logger:        logger,
+		jwtSigningKey: jwtSecret,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/create_car", httpServer.createCar)
+	mux.HandleFunc("/get_car", httpServer.getCar)
+	mux.HandleFunc("/update_car", httpServer.updateCar)
+	mux.HandleFunc("/delete_car", httpServer.deleteCar)
+	mux.HandleFunc("/list_cars", httpServer.listCars)
+	mux.HandleFunc("/create_location", httpServer.createLocation)
+	mux.HandleFunc("/get_location", httpServer.getLocation)
+	mux.HandleFunc("/list_locations", httpServer.listLocations)
+	mux.HandleFunc("/create_maintenance", httpServer.createMaintenance)
+	mux.HandleFunc("/delete_maintenance", httpServer.deleteMaintenance)
+	mux.HandleFunc("/list_maintenance", httpServer.listMaintenance)
+
+	openapi.Register(mux, httpServer.operations())
+	mux.HandleFunc("GET /openapi.json", openapi.Handler(OpenAPI()))
+
+	httpServer.server.Handler = mux
+
+	return &httpServer
+}
+
+type carIDRequest struct {
+	CarID uint64 `json:"car_id"`
+}
+
+type listCarsRequest struct {
+	Class        string `json:"class"`
+	Status       string `json:"status"`
+	HomeLocation string `json:"home_location"`
+	// FromMinute and ToMinute, when set, leave out cars under maintenance at that time.
+	FromMinute uint64 `json:"from_minute"`
+	ToMinute   uint64 `json:"to_minute"`
+}
+
+type listCarsResponse struct {
+	Cars []Car `json:"cars"`
+}
+
+type locationCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type listLocationsResponse struct {
+	Locations []Location `json:"locations"`
+}
+
+type createMaintenanceResponse struct {
+	Window    MaintenanceWindow `json:"window"`
+	Conflicts []Conflict        `json:"conflicts"`
+}
+
+type deleteMaintenanceRequest struct {
+	CarID    uint64 `json:"car_id"`
+	WindowID uint64 `json:"window_id"`
+}
+
+type listMaintenanceRequest struct {
+	CarID      uint64 `json:"car_id"`
+	FromMinute uint64 `json:"from_minute"`
+	ToMinute   uint64 `json:"to_minute"`
+}
+
+type listMaintenanceResponse struct {
+	Windows []MaintenanceWindow `json:"windows"`
+}
+
+// ListenAndServe serves HTTPS if SetTLS was given a config, HTTP otherwise.
+func (c *HttpServer) ListenAndServe() error {
+	if c.server.TLSConfig != nil {
+		return c.server.ListenAndServeTLS("", "")
+	}
+	return c.server.ListenAndServe()
+}
+
+func (c *HttpServer) Close() error {
+	return c.server.Close()
+}
+
+// Shutdown stops accepting connections and waits for running requests until ctx is done.
+func (c *HttpServer) Shutdown(ctx context.Context) error {
+	return c.server.Shutdown(ctx)
+}
+
+func (c *HttpServer) SetTimeouts(read, write, idle time.Duration) {
+	c.server.ReadTimeout = read
+	c.server.WriteTimeout = write
+	c.server.IdleTimeout = idle
+}
+
+// SetTLS serves HTTPS with config. A nil config keeps plain HTTP.
+func (c *HttpServer) SetTLS(config *tls.Config) {
+	c.server.TLSConfig = config
+}
+
+// TokenVerifier asks the auth service whether a token was revoked.
+type TokenVerifier interface {
+	VerifyToken(token string) error
+}
+
+// SetTokenVerifier makes checkAuth reject tokens the verifier reports as
+// revoked; without one any correctly signed token is accepted.
+func (c *HttpServer) SetTokenVerifier(verifier TokenVerifier) {
+	c.tokenVerifier = verifier
+}
+
+// SetAdminToken lets requests carrying token in the X-Admin-Token header
+// change the catalog.
+func (c *HttpServer) SetAdminToken(token []byte) {
+	c.adminToken = token
+}
+
+// SetRateLimit puts the limiter in front of every route, counting requests per
+// user_id or client IP.
+func (c *HttpServer) SetRateLimit(limiter *ratelimit.Limiter) {
+	c.server.Handler = limiter.Handler(c.server.Handler, ratelimit.UserOrIP(c.jwtSigningKey))
+}
+
+func (c *HttpServer) createCar(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for create car")
+	if !c.authManager(rw, r) {
+		return
+	}
+
+	var car Car
+	if !c.readRequest(rw, r, &car, "create car") {
+		return
+	}
+
+	car, err := c.fleetService.createCar(car)
+	if err != nil {
+		c.writeError(rw, err, "create car")
+		return
+	}
+
+	c.writeResponse(rw, &car, "create car")
+}
+
+func (c *HttpServer) getCar(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for get car")
+
+	var carIDRequest carIDRequest
+	if !c.readRequest(rw, r, &carIDRequest, "get car") {
+		return
+	}
+
+	car, err := c.fleetService.getCar(carIDRequest.CarID)
+	if err != nil {
+		c.writeError(rw, err, "get car")
+		return
+	}
+
+	c.writeResponse(rw, &car, "get car")
+}
+
+func (c *HttpServer) updateCar(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for update car")
+	if !c.authManager(rw, r) {
+		return
+	}
+
+	var car Car
+	if !c.readRequest(rw, r, &car, "update car") {
+		return
+	}
+
+	car, err := c.fleetService.updateCar(car)
+	if err != nil {
+		c.writeError(rw, err, "update car")
+		return
+	}
+
+	c.writeResponse(rw, &car, "update car")
+}
+
+func (c *HttpServer) deleteCar(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for delete car")
+	if !c.authManager(rw, r) {
+		return
+	}
+
+	var carIDRequest carIDRequest
+	if !c.readRequest(rw, r, &carIDRequest, "delete car") {
+		return
+	}
+
+	err := c.fleetService.deleteCar(carIDRequest.CarID)
+	if err != nil {
+		c.writeError(rw, err, "delete car")
+		return
+	}
+	rw.WriteHeader(200)
+}
+
+func (c *HttpServer) listCars(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for list cars")
+
+	var listCarsRequest listCarsRequest
+	if !c.readRequest(rw, r, &listCarsRequest, "list cars") {
+		return
+	}
+
+	span := interval.Interval{From: listCarsRequest.FromMinute, To: listCarsRequest.ToMinute}
+	cars, err := c.fleetService.listCars(listCarsRequest.Class, listCarsRequest.Status, listCarsRequest.HomeLocation, span)
+	if err != nil {
+		c.writeError(rw, err, "list cars")
+		return
+	}
+
+	c.writeResponse(rw, &listCarsResponse{Cars: cars}, "list cars")
+}
+
+func (c *HttpServer) createLocation(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for create location")
+	if !c.authManager(rw, r) {
+		return
+	}
+
+	var location Location
+	if !c.readRequest(rw, r, &location, "create location") {
+		return
+	}
+
+	location, err := c.fleetService.createLocation(location)
+	if err != nil {
+		c.writeError(rw, err, "create location")
+		return
+	}
+
+	c.writeResponse(rw, &location, "create location")
+}
+
+func (c *HttpServer) getLocation(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for get location")
+
+	var locationCodeRequest locationCodeRequest
+	if !c.readRequest(rw, r, &locationCodeRequest, "get location") {
+		return
+	}
+
+	location, err := c.fleetService.getLocation(locationCodeRequest.Code)
+	if err != nil {
+		c.writeError(rw, err, "get location")
+		return
+	}
+
+	c.writeResponse(rw, &location, "get location")
+}
+
+func (c *HttpServer) listLocations(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for list locations")
+
+	locations, err := c.fleetService.listLocations()
+	if err != nil {
+		c.writeError(rw, err, "list locations")
+		return
+	}
+
+	c.writeResponse(rw, &listLocationsResponse{Locations: locations}, "list locations")
+}
+
+func (c *HttpServer) createMaintenance(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for create maintenance")
+	if !c.authManager(rw, r) {
+		return
+	}
+
+	var window MaintenanceWindow
+	if !c.readRequest(rw, r, &window, "create maintenance") {
+		return
+	}
+
+	window, conflicts, err := c.fleetService.createMaintenance(window)
+	if err != nil {
+		c.writeError(rw, err, "create maintenance")
+		return
+	}
+	if len(conflicts) > 0 {
+		c.logger.Infof("maintenance window %d of car %d conflicts with %d rentals", window.WindowID, window.CarID, len(conflicts))
+	}
+
+	c.writeResponse(rw, &createMaintenanceResponse{Window: window, Conflicts: conflicts}, "create maintenance")
+}
+
+func (c *HttpServer) deleteMaintenance(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for delete maintenance")
+	if !c.authManager(rw, r) {
+		return
+	}
+
+	var deleteMaintenanceRequest deleteMaintenanceRequest
+	if !c.readRequest(rw, r, &deleteMaintenanceRequest, "delete maintenance") {
+		return
+	}
+
+	err := c.fleetService.deleteMaintenance(deleteMaintenanceRequest.CarID, deleteMaintenanceRequest.WindowID)
+	if err != nil {
+		c.writeError(rw, err, "delete maintenance")
+		return
+	}
+	rw.WriteHeader(200)
+}
+
+// listMaintenance returns the windows of a car, limited to the ones active
+// during [from_minute, to_minute) when that range is given.
+func (c *HttpServer) listMaintenance(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for list maintenance")
+
+	var listMaintenanceRequest listMaintenanceRequest
+	if !c.readRequest(rw, r, &listMaintenanceRequest, "list maintenance") {
+		return
+	}
+
+	span := interval.Interval{From: listMaintenanceRequest.FromMinute, To: listMaintenanceRequest.ToMinute}
+	windows, err := c.fleetService.listMaintenance(listMaintenanceRequest.CarID, span)
+	if err != nil {
+		c.writeError(rw, err, "list maintenance")
+		return
+	}
+
+	c.writeResponse(rw, &listMaintenanceResponse{Windows: windows}, "list maintenance")
+}
+
+// readRequest decodes the JSON body, query and path parameters into v. An
+// empty request leaves v untouched.
+func (c *HttpServer) readRequest(rw http.ResponseWriter, r *http.Request, v interface{}, op string) bool {
+	err := rest.Decode(r, v)
+	if err != nil {
+		rw.WriteHeader(400)
+		c.logger.Errorf("%s error: error decoding request %v", op, err)
+		return false
+	}
+	return true
+}
+
+func (c *HttpServer) writeError(rw http.ResponseWriter, err error, op string) {
+	c.logger.Errorf("%s error: %v", op, err)
+	switch {
+	case err == carNotFound, err == locationNotFound, err == maintenanceNotFound:
+		http.Error(rw, err.Error(), 404)
+	case err == plateAlreadyExists, err == locationAlreadyExists, errors.Is(err, invalidCar), errors.Is(err, invalidLocation), errors.Is(err, invalidMaintenance):
+		http.Error(rw, err.Error(), 400)
+	default:
+		rw.WriteHeader(500)
+	}
+}
+
+func (c *HttpServer) writeResponse(rw http.ResponseWriter, v interface{}, op string) {
+	responseBytes, err := json.Marshal(v)
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("%s error: error writing response %v", op, err)
+	}
+}
+
+func (c *HttpServer) checkAdmin(r *http.Request) bool {
+	if len(c.adminToken) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), c.adminToken) == 1
+}
+
+// checkService authenticates a call from another service by a service token
+// granting scope. With mutual TLS the caller must also present a certificate
+// issued to the client the token names.
+func (c *HttpServer) checkService(r *http.Request, scope string) (servicetoken.Claims, error) {
+	mutual := c.server.TLSConfig != nil && c.server.TLSConfig.ClientCAs != nil
+	return servicetoken.Check(servicetoken.Key(c.jwtSigningKey), r, scope, mutual)
+}
+
+// authManager lets fleet managers change cars, branches and maintenance
+// windows: requests with the admin token or a service token granting
+// fleet:write. A user token is not enough and gets 403; a request without
+// valid credentials gets 401. It answers the request when it returns false.
+func (c *HttpServer) authManager(rw http.ResponseWriter, r *http.Request) bool {
+	if c.checkAdmin(r) {
+		return true
+	}
+	if servicetoken.Bearer(r) != "" {
+		_, err := c.checkService(r, servicetoken.ScopeFleetWrite)
+		if err != nil {
+			c.logger.Errorf("auth error: %v", err)
+			http.Error(rw, err.Error(), servicetoken.Status(err))
+			return false
+		}
+		return true
+	}
+	_, err := c.checkAuth(r.Header.Get("X-Auth"))
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+	http.Error(rw, notFleetManager.Error(), http.StatusForbidden)
+	return false
+}
+
+type UserAuthObject struct {
+	Username string
+	UserID   uint64
+}
+
+func (c *HttpServer) checkAuth(token string) (UserAuthObject, error) {
+	tokenObj, err := jwt.Parse(token, usertoken.Keyfunc(c.jwtSigningKey))
+	if err != nil {
+		return UserAuthObject{}, fmt.Errorf("error casting user id from token: %w", err)
+	}
+
+	claims, ok := tokenObj.Claims.(jwt.MapClaims)
+	if !ok {
+		return UserAuthObject{}, fmt.Errorf("token %s verification error: error casting claims to map claims", token)
+	}
+	c.logger.Infof("claims %v", claims)
+	username, ok := claims["username"].(string)
+	if !ok {
+		return UserAuthObject{}, errors.New("token has no username")
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return UserAuthObject{}, errors.New("token has no user_id")
+	}
+
+	if c.tokenVerifier != nil {
+		err = c.tokenVerifier.VerifyToken(token)
+		if err != nil {
+			return UserAuthObject{}, err
+		}
+	}
+
+	return UserAuthObject{
+		username,
+		uint64(userID),
+	}, nil
+}
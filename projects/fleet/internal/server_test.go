@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"distributed-rental/pkg/interval"
+	"distributed-rental/pkg/openapi/openapitest"
+	"distributed-rental/pkg/servicetoken"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestFleetService opens a fleet in memory without rental services.
+func newTestFleetService(t *testing.T) *FleetService {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	carIDSequence, err := db.GetSequence([]byte("car_id_sequence"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maintenanceIDSequence, err := db.GetSequence([]byte("maintenance_id_sequence"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		carIDSequence.Release()
+		maintenanceIDSequence.Release()
+		db.Close()
+	})
+	return NewFleetService(db, carIDSequence, maintenanceIDSequence, zap.NewNop().Sugar(), nil, nil, nil)
+}
+
+// TestOpenAPI fails when openapi.json was not regenerated after a change of
+// the v1 routes, or when the router does not serve them as documented.
+func TestOpenAPI(t *testing.T) {
+	openapitest.CheckFile(t, "../openapi.json", OpenAPI())
+	server := NewHttpServer("", newTestFleetService(t), []byte("secret"), zap.NewNop().Sugar())
+	openapitest.CheckRoutes(t, server.server.Handler.(*http.ServeMux), OpenAPI())
+}
+
+// managerRoutes change the catalog. %d is replaced with the id of an
+// existing car and %w with the id of its maintenance window.
+var managerRoutes = []struct {
+	method, target, body string
+}{
+	{http.MethodPost, "/create_car", `{"make":"Lada","model":"Niva","plate":"P%d","transmission":"manual","fuel_type":"petrol"}`},
+	{http.MethodPost, "/update_car", `{"car_id":%d,"make":"Lada","model":"Niva","plate":"A001AA","transmission":"manual","fuel_type":"petrol","status":"retired"}`},
+	{http.MethodPost, "/delete_car", `{"car_id":%d}`},
+	{http.MethodPost, "/create_location", `{"code":"c%d","name":"Center"}`},
+	{http.MethodPost, "/v1/cars", `{"make":"Lada","model":"Niva","plate":"V%d","transmission":"manual","fuel_type":"petrol"}`},
+	{http.MethodPut, "/v1/cars/%d", `{"make":"Lada","model":"Niva","plate":"A001AA","transmission":"manual","fuel_type":"petrol","status":"retired"}`},
+	{http.MethodDelete, "/v1/cars/%d", ``},
+	{http.MethodPost, "/v1/locations", `{"code":"v%d","name":"Center"}`},
+	{http.MethodPost, "/create_maintenance", `{"car_id":%d,"reason":"tyres","from_minute":100,"to_minute":200}`},
+	{http.MethodPost, "/delete_maintenance", `{"car_id":%d,"window_id":%w}`},
+	{http.MethodPost, "/v1/cars/%d/maintenance", `{"reason":"tyres","from_minute":100,"to_minute":200}`},
+	{http.MethodDelete, "/v1/cars/%d/maintenance/%w", ``},
+}
+
+func TestManagerAuth(t *testing.T) {
+	jwtSecret := []byte("secret")
+	userToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": "alice", "user_id": 7}).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceToken := func(scopes ...string) string {
+		token, err := servicetoken.Issue(servicetoken.Key(jwtSecret), "ops", scopes, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	for _, test := range []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"no credentials", nil, http.StatusUnauthorized},
+		{"user token", map[string]string{"X-Auth": userToken}, http.StatusForbidden},
+		{"user token as service token", map[string]string{"Authorization": "Bearer " + userToken}, http.StatusUnauthorized},
+		{"wrong admin token", map[string]string{"X-Admin-Token": "guess", "X-Auth": userToken}, http.StatusForbidden},
+		{"service token without fleet:write", map[string]string{"Authorization": "Bearer " + serviceToken(servicetoken.ScopeBookingRead)}, http.StatusForbidden},
+		{"service token", map[string]string{"Authorization": "Bearer " + serviceToken(servicetoken.ScopeFleetWrite)}, http.StatusOK},
+		{"admin token", map[string]string{"X-Admin-Token": "admin"}, http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fleetService := newTestFleetService(t)
+			server := NewHttpServer("", fleetService, jwtSecret, zap.NewNop().Sugar())
+			server.SetAdminToken([]byte("admin"))
+			for _, route := range managerRoutes {
+				car, err := fleetService.createCar(Car{Make: "Lada", Model: "Niva", Plate: "A001AA", Transmission: "manual", FuelType: "petrol"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				window, _, err := fleetService.createMaintenance(MaintenanceWindow{CarID: car.CarID, Reason: "wash", FromMinute: 1000, ToMinute: 1100})
+				if err != nil {
+					t.Fatal(err)
+				}
+				replacer := strings.NewReplacer("%d", fmt.Sprint(car.CarID), "%w", fmt.Sprint(window.WindowID))
+				target := replacer.Replace(route.target)
+				r := httptest.NewRequest(route.method, target, strings.NewReader(replacer.Replace(route.body)))
+				for name, value := range test.headers {
+					r.Header.Set(name, value)
+				}
+				rw := httptest.NewRecorder()
+				server.server.Handler.ServeHTTP(rw, r)
+				// Creating with the v1 API answers 201.
+				allowed := rw.Code == test.status || test.status == http.StatusOK && rw.Code == http.StatusCreated
+				if !allowed {
+					t.Errorf("%s %s: got %d %s, want %d", route.method, target, rw.Code, rw.Body, test.status)
+				}
+
+				// Rejected requests change nothing.
+				if test.status != http.StatusOK {
+					got, err := fleetService.getCar(car.CarID)
+					if err != nil || got != car {
+						t.Errorf("%s %s: car changed to %+v, %v", route.method, target, got, err)
+					}
+					windows, err := fleetService.listMaintenance(car.CarID, interval.Interval{})
+					if err != nil || len(windows) != 1 || windows[0] != window {
+						t.Errorf("%s %s: maintenance changed to %+v, %v", route.method, target, windows, err)
+					}
+				}
+				err = fleetService.deleteMaintenance(car.CarID, window.WindowID)
+				if err != nil && err != maintenanceNotFound {
+					t.Fatal(err)
+				}
+				err = fleetService.deleteCar(car.CarID)
+				if err != nil && err != carNotFound {
+					t.Fatal(err)
+				}
+			}
+			if test.status != http.StatusOK {
+				cars, err := fleetService.listCars("", "", "", interval.Interval{})
+				locations, err2 := fleetService.listLocations()
+				if err != nil || err2 != nil || len(cars) != 0 || len(locations) != 0 {
+					t.Errorf("rejected requests created %+v and %+v", cars, locations)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Package client is the HTTP client other services use to read leases from the lease service.
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+type Lease struct {
+	CarID          uint64 `json:"car_id"`
+	UserID         uint64 `json:"user_id"`
+	LeaseID        uint64 `json:"lease_id"`
+	FromMinute     uint64 `json:"from_minute"`
+	ToMinute       uint64 `json:"to_minute"`
+	PickupLocation string `json:"pickup_location"`
+	ReturnLocation string `json:"return_location"`
+}
+
+type Client struct {
+	addr       string
+	scheme     string
+	httpClient *http.Client
+}
+
+// New creates a client for the lease service listening on addr (host:port).
+func New(addr string) *Client {
+	return &Client{
+		addr:       addr,
+		scheme:     "http",
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// SetTimeout limits how long a single call may take.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.httpClient.Timeout = timeout
+}
+
+// SetTLS makes calls over HTTPS with config, which also holds the client
+// certificate for mutual TLS. A nil config keeps plain HTTP.
+func (c *Client) SetTLS(config *tls.Config) {
+	if config == nil {
+		return
+	}
+	c.scheme = "https"
+	c.httpClient.Transport = &http.Transport{TLSClientConfig: config}
+}
+
+// CarLeases returns the leases of the car that end after fromMinute. token is
+// a service token with the lease:read scope.
+func (c *Client) CarLeases(token string, carID uint64, fromMinute uint64) ([]Lease, error) {
+	var response struct {
+		Leases []Lease `json:"leases"`
+	}
+	err := c.call("/car_leases", "Authorization", "Bearer "+token, map[string]uint64{"car_id": carID, "from_minute": fromMinute}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response.Leases, nil
+}
+
+// ExportUser returns every lease of the user as the JSON object
+// {"leases": [...]}, for data exports. adminToken is shared by the services.
+func (c *Client) ExportUser(adminToken []byte, userID uint64) (json.RawMessage, error) {
+	var response json.RawMessage
+	err := c.call("/admin/user_leases", "X-Admin-Token", string(adminToken), map[string]uint64{"user_id": userID}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// EraseUser detaches the leases of the user from them and returns how many
+// there were.
+func (c *Client) EraseUser(adminToken []byte, userID uint64) (int, error) {
+	var response struct {
+		Erased int `json:"erased"`
+	}
+	err := c.call("/admin/erase_user", "X-Admin-Token", string(adminToken), map[string]uint64{"user_id": userID}, &response)
+	if err != nil {
+		return 0, err
+	}
+	return response.Erased, nil
+}
+
+// call posts request with token in the header named header.
+func (c *Client) call(path string, header string, token string, request interface{}, response interface{}) error {
+	requestBytes, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.scheme+"://"+c.addr+path, bytes.NewReader(requestBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(header, token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("lease request %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("lease request %s: error reading body: %w", path, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("lease request %s: status %d: %s", path, resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return json.Unmarshal(body, response)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"distributed-rental/pkg/config"
+	"distributed-rental/pkg/eligibility"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Config struct {
+	HTTP              config.HTTP      `yaml:"http"`
+	GRPC              config.GRPC      `yaml:"grpc"`
+	TLS               config.TLS       `yaml:"tls"`
+	JWTSecretPath     string           `yaml:"jwt_secret_path" usage:"path to jwt secret"`
+	JWTSecret         string           `yaml:"jwt_secret" secret:"true" usage:"jwt secret, takes precedence over jwt_secret_path"`
+	AuthAddr          string           `yaml:"auth_addr" usage:"auth service addr used to reject tokens revoked by a password change, empty disables the check"`
+	TokenCacheTTL     time.Duration    `yaml:"token_cache_ttl" usage:"how long a token or api key checked with the auth service is trusted"`
+	FleetAddr         string           `yaml:"fleet_addr" usage:"fleet service addr used to validate car ids, empty disables the check"`
+	ClientTimeout     time.Duration    `yaml:"client_timeout" usage:"timeout of calls to other services"`
+	DriverRules       string           `yaml:"driver_rules" usage:"comma separated <class>=<min age>[:verified] driver eligibility rules, * for other classes, empty disables the checks"`
+	OneWaySurcharge   uint64           `yaml:"one_way_surcharge" usage:"surcharge added to rentals returned at a different location"`
+	TurnaroundMinutes uint64           `yaml:"turnaround_minutes" usage:"default cleaning buffer between leases of the same car"`
+	Storage           config.Storage   `yaml:"storage"`
+	Badger            config.Badger    `yaml:"badger"`
+	Admin             config.Admin     `yaml:"admin"`
+	RateLimit         config.RateLimit `yaml:"rate_limit"`
+	Log               config.Log       `yaml:"log"`
+	MigrateDryRun     bool             `yaml:"-" flag:"migrate-dry-run" usage:"report what pending badger migrations would change and exit"`
+	OpenAPI           string           `yaml:"-" flag:"openapi" usage:"write the OpenAPI document of the REST API v1 to this file and exit"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		HTTP:          config.DefaultHTTP("localhost:3001"),
+		GRPC:          config.DefaultGRPC("localhost:4001"),
+		JWTSecretPath: "/etc/jwt-secret",
+		AuthAddr:      "localhost:3000",
+		TokenCacheTTL: 10 * time.Second,
+		FleetAddr:     "localhost:3003",
+		ClientTimeout: 5 * time.Second,
+		Storage:       config.Storage{Backend: "badger", SQLitePath: "/var/lease_db.sqlite"},
+		Badger:        config.DefaultBadger("/var/lease_db"),
+		Admin:         config.DefaultAdmin(),
+		RateLimit:     config.RateLimit{Routes: "/check_lease=10/s:20,/create_lease=2/s:10,GET /v1/cars/{car_id}/availability=10/s:20,POST /v1/leases=2/s:10,/lease.v1.LeaseService/CheckCar=10/s:20,/lease.v1.LeaseService/CreateLease=2/s:10", Store: "memory", SQLitePath: "/var/lease_ratelimit.sqlite"},
+		Log:           config.DefaultLog(),
+	}
+}
+
+func (c *Config) Validate() error {
+	for _, section := range []config.Validator{c.HTTP, c.GRPC, c.TLS, c.Storage, c.Badger, c.RateLimit, c.Log} {
+		err := section.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	err := c.Storage.CheckBadger(c.Badger)
+	if err != nil {
+		return err
+	}
+	_, err = eligibility.ParseRules(c.DriverRules)
+	if err != nil {
+		return fmt.Errorf("driver_rules: %w", err)
+	}
+	if c.DriverRules != "" && (c.AuthAddr == "" || c.FleetAddr == "") {
+		return errors.New("driver_rules need auth_addr and fleet_addr")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"distributed-rental/pkg/openapi"
+	"net/http"
+)
+
+var apiInfo = openapi.Info{
+	Title:       "lease",
+	Description: "Leases of cars and their availability.",
+	Version:     "1",
+}
+
+var (
+	securityUserOrKey = []string{openapi.SecurityUser, openapi.SecurityAPIKey}
+	securityService   = []string{openapi.SecurityService}
+	securityAdmin     = []string{openapi.SecurityAdmin}
+)
+
+// operations are the v1 routes of the lease API, registered by
+// NewHttpServer and described at /openapi.json.
+func (c *HttpServer) operations() []openapi.Operation {
+	return []openapi.Operation{
+		{Method: http.MethodPost, Path: "/v1/leases", ID: "createLease", Summary: "Lease a car to the caller; from and to take precedence over the minute and day fields",
+			Security: securityUserOrKey, Request: createLeaseRequest{}, Response: createLeaseResponse{}, Status: http.StatusCreated, Handler: c.createLease},
+		{Method: http.MethodGet, Path: "/v1/leases/{lease_id}", ID: "getLease", Summary: "Get a lease of the caller",
+			Security: securityUserOrKey, Request: leaseIDRequest{}, Response: Lease{}, Handler: c.getLease},
+		{Method: http.MethodGet, Path: "/v1/cars/{car_id}/availability", ID: "checkCar", Summary: "Check whether a car is free for an interval",
+			Security: securityUserOrKey, Request: CheckCarRequest{}, Response: CheckCarResponse{}, Handler: c.checkCar},
+		{Method: http.MethodGet, Path: "/v1/cars/{car_id}/leases", ID: "carLeases", Summary: "List the leases of a car from from_minute on",
+			Security: securityService, Request: carLeasesRequest{}, Response: carLeasesResponse{}, Handler: c.carLeases},
+		{Method: http.MethodPut, Path: "/v1/cars/{car_id}/turnaround", ID: "setTurnaround", Summary: "Set the minutes a car needs between two leases",
+			Security: securityService, Request: setTurnaroundRequest{}, Handler: c.setTurnaround},
+		{Method: http.MethodGet, Path: "/v1/admin/users/{user_id}/leases", ID: "userLeases", Summary: "List the leases of a user",
+			Security: securityAdmin, Request: userIDRequest{}, Response: carLeasesResponse{}, Handler: c.userLeases},
+		{Method: http.MethodPost, Path: "/v1/admin/users/{user_id}/erase", ID: "eraseUser", Summary: "Erase the leases of a user",
+			Security: securityAdmin, Request: userIDRequest{}, Response: eraseUserResponse{}, Handler: c.eraseUser},
+	}
+}
+
+// OpenAPI describes the v1 routes of the lease API.
+func OpenAPI() *openapi.Document {
+	return openapi.Build(apiInfo, (&HttpServer{}).operations())
+}
@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"sort"
+	"strconv"
+)
+
+// BadgerLeaseRepository keeps leases under "<car_id>_<from>_<to>" keys so
+// that one prefix scan returns all leases of a car.
+type BadgerLeaseRepository struct {
+	db              *badger.DB
+	leaseIDSequence *badger.Sequence
+}
+
+// NewBadgerLeaseRepository leases lease ids from the sequence sequenceBandwidth at a time.
+func NewBadgerLeaseRepository(db *badger.DB, sequenceBandwidth uint64) (*BadgerLeaseRepository, error) {
+	leaseIDSequence, err := db.GetSequence([]byte("lease_id_sequence"), sequenceBandwidth)
+	if err != nil {
+		return nil, err
+	}
+	return &BadgerLeaseRepository{
+		db:              db,
+		leaseIDSequence: leaseIDSequence,
+	}, nil
+}
+
+func getKey(carID, from, to uint64) []byte {
+	return []byte(fmt.Sprintf("%d_%d_%d", carID, from, to))
+}
+
+func carPrefix(carID uint64) []byte {
+	return []byte(fmt.Sprintf("%d_", carID))
+}
+
+// carLockKey guards the leases of a car. Badger only detects conflicts on keys
+// a transaction read, and the prefix scan of a car's leases does not cover
+// a key another transaction inserts meanwhile. createLease reads and writes
+// this key, so of two concurrent leases of the car one fails to commit.
+func carLockKey(carID uint64) []byte {
+	return []byte(fmt.Sprintf("car_lock_%d", carID))
+}
+
+func turnaroundKey(carID uint64) []byte {
+	return []byte(fmt.Sprintf("turnaround_%d", carID))
+}
+
+func (c *BadgerLeaseRepository) NextLeaseID() (uint64, error) {
+	return c.leaseIDSequence.Next()
+}
+
+func (c *BadgerLeaseRepository) CarLeases(carID uint64) ([]LeaseDBModel, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	return c.carLeases(tx, carID)
+}
+
+// UserLeases scans every lease, as they are keyed by car.
+func (c *BadgerLeaseRepository) UserLeases(userID uint64) ([]LeaseDBModel, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	leases := []LeaseDBModel{}
+	err := c.eachLease(tx, func(key []byte, lease LeaseDBModel) error {
+		if lease.UserID == userID {
+			leases = append(leases, lease)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].LeaseID < leases[j].LeaseID })
+	return leases, nil
+}
+
+func (c *BadgerLeaseRepository) ReassignUser(userID uint64, newUserID uint64) (int, error) {
+	moved := 0
+	err := c.db.Update(func(tx *badger.Txn) error {
+		moved = 0
+		updates := map[string][]byte{}
+		err := c.eachLease(tx, func(key []byte, lease LeaseDBModel) error {
+			if lease.UserID == userID {
+				lease.UserID = newUserID
+				updates[string(key)] = encodeLease(lease)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for key, value := range updates {
+			err = tx.Set([]byte(key), value)
+			if err != nil {
+				return err
+			}
+		}
+		moved = len(updates)
+		return nil
+	})
+	return moved, err
+}
+
+// CreateLease retries when a concurrent lease of the same car commits first,
+// so that check sees it.
+func (c *BadgerLeaseRepository) CreateLease(lease LeaseDBModel, check func(existing []LeaseDBModel) error) error {
+	for {
+		err := c.createLease(lease, check)
+		if err == badger.ErrConflict {
+			continue
+		}
+		return err
+	}
+}
+
+func (c *BadgerLeaseRepository) createLease(lease LeaseDBModel, check func(existing []LeaseDBModel) error) error {
+	tx := c.db.NewTransaction(true)
+	defer tx.Discard()
+
+	lockKey := carLockKey(lease.CarID)
+	_, err := tx.Get(lockKey)
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+	existing, err := c.carLeases(tx, lease.CarID)
+	if err != nil {
+		return err
+	}
+	err = check(existing)
+	if err != nil {
+		return err
+	}
+	key := getKey(lease.CarID, lease.FromMinute, lease.ToMinute)
+	_, err = tx.Get(key)
+	if err == nil {
+		return leaseAlreadyExists
+	}
+	if err != badger.ErrKeyNotFound {
+		return err
+	}
+	err = tx.Set(lockKey, key)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Set(key, encodeLease(lease))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (c *BadgerLeaseRepository) Turnaround(carID uint64) (uint64, bool, error) {
+	tx := c.db.NewTransaction(false)
+	defer tx.Discard()
+
+	item, err := tx.Get(turnaroundKey(carID))
+	if err == badger.ErrKeyNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return 0, false, err
+	}
+	minutes, err := strconv.ParseUint(string(value), 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return minutes, true, nil
+}
+
+func (c *BadgerLeaseRepository) SetTurnaround(carID uint64, minutes uint64) error {
+	return c.db.Update(func(tx *badger.Txn) error {
+		return tx.Set(turnaroundKey(carID), []byte(strconv.FormatUint(minutes, 10)))
+	})
+}
+
+// Close releases the unused part of the id sequence. The DB itself belongs to the caller.
+func (c *BadgerLeaseRepository) Close() error {
+	return c.leaseIDSequence.Release()
+}
+
+func (c *BadgerLeaseRepository) carLeases(tx *badger.Txn, carID uint64) ([]LeaseDBModel, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = carPrefix(carID)
+	it := tx.NewIterator(opts)
+	defer it.Close()
+
+	leases := []LeaseDBModel{}
+	for it.Rewind(); it.Valid(); it.Next() {
+		value, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		lease, err := decodeLease(value)
+		if err != nil {
+			return nil, err
+		}
+		if lease.CarID != carID {
+			continue
+		}
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+// eachLease calls fn for every lease, skipping turnarounds and other keys.
+func (c *BadgerLeaseRepository) eachLease(tx *badger.Txn, fn func(key []byte, lease LeaseDBModel) error) error {
+	it := tx.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		key := it.Item().KeyCopy(nil)
+		if !leaseKeyPattern.Match(key) {
+			continue
+		}
+		value, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		lease, err := decodeLease(value)
+		if err != nil {
+			return err
+		}
+		err = fn(key, lease)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
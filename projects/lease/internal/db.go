@@ -1,123 +1,416 @@
 package internal
 
 import (
-	"encoding/json"
+	"distributed-rental/pkg/eligibility"
+	"distributed-rental/pkg/interval"
+	fleet "distributed-rental/projects/fleet/client"
 	"errors"
-	"fmt"
-	badger "github.com/dgraph-io/badger/v3"
 	"go.uber.org/zap"
-	"strconv"
-	"strings"
+	"math"
 )
 
+// erasedUserID owns the leases of erased users. They keep their car, times
+// and surcharge for accounting but no longer lead to a person.
+const erasedUserID = math.MaxInt64
+
 var leaseAlreadyExists = errors.New("lease already exists")
 var wrongPassword = errors.New("wrong password")
+var unknownCar = errors.New("unknown car")
+var carRetired = errors.New("car is retired")
+var unknownLocation = errors.New("unknown location")
+var locationClosed = errors.New("location is closed at the requested time")
+var carInMaintenance = errors.New("car is under maintenance")
+var leaseNotFound = errors.New("lease not found")
+
+// CarCatalog looks cars and branches up in the fleet service.
+type CarCatalog interface {
+	GetCar(carID uint64) (fleet.Car, error)
+	GetLocation(code string) (fleet.Location, error)
+	MaintenanceWindows(carID uint64, span interval.Interval) ([]fleet.MaintenanceWindow, error)
+}
+
+// DriverRegistry looks up the renter holding an access token in the auth service.
+type DriverRegistry interface {
+	Driver(token string) (eligibility.Driver, error)
+}
+
+// Route is where a lease picks the car up and drops it off. An empty Pickup
+// accepts the car wherever it is; an empty Return means a round trip.
+type Route struct {
+	Pickup string
+	Return string
+}
+
+func (c Route) dropoff() string {
+	if c.Return == "" {
+		return c.Pickup
+	}
+	return c.Return
+}
+
+func (c Route) oneWay() bool {
+	return c.Pickup != "" && c.dropoff() != c.Pickup
+}
 
 type LeaseService struct {
-	db              *badger.DB
-	leaseIDSequence *badger.Sequence
-	logger          *zap.SugaredLogger
+	repository        LeaseRepository
+	logger            *zap.SugaredLogger
+	defaultTurnaround uint64
+	oneWaySurcharge   uint64
+	fleet             CarCatalog
+	drivers           DriverRegistry
+	eligibility       eligibility.Rules
+	watchers          carWatchers
 }
 
-func NewLeaseService(db *badger.DB, leaseIDSequence *badger.Sequence) *LeaseService {
+// NewLeaseService creates a lease service. defaultTurnaround is the cleaning
+// buffer in minutes used for cars without their own setting, oneWaySurcharge
+// is added to leases returned at a different location. A nil fleet disables
+// car and location validation.
+func NewLeaseService(repository LeaseRepository, logger *zap.SugaredLogger, defaultTurnaround uint64, oneWaySurcharge uint64, fleet CarCatalog) *LeaseService {
 	return &LeaseService{
-		db:              db,
-		leaseIDSequence: leaseIDSequence,
+		repository:        repository,
+		logger:            logger,
+		defaultTurnaround: defaultTurnaround,
+		oneWaySurcharge:   oneWaySurcharge,
+		fleet:             fleet,
 	}
 }
 
+// SetEligibility makes createLease check the renter against the rules of the
+// car class. It needs a fleet catalog to know the class.
+func (c *LeaseService) SetEligibility(drivers DriverRegistry, rules eligibility.Rules) {
+	c.drivers = drivers
+	c.eligibility = rules
+}
+
 type Lease struct {
-	CarID   uint64 `json:"car_id,omitempty"`
-	UserID  uint64 `json:"user_id,omitempty"`
-	LeaseID uint64 `json:"lease_id,omitempty"`
-	From    uint64 `json:"from_day"`
-	To      uint64 `json:"to_day"`
+	CarID           uint64 `json:"car_id,omitempty"`
+	UserID          uint64 `json:"user_id,omitempty"`
+	LeaseID         uint64 `json:"lease_id,omitempty"`
+	From            uint64 `json:"from_day"`
+	To              uint64 `json:"to_day"`
+	FromMinute      uint64 `json:"from_minute"`
+	ToMinute        uint64 `json:"to_minute"`
+	PickupLocation  string `json:"pickup_location,omitempty"`
+	ReturnLocation  string `json:"return_location,omitempty"`
+	OneWaySurcharge uint64 `json:"one_way_surcharge"`
 }
 
 type LeaseDBModel struct {
-	LeaseID uint64 `json:"lease_id,omitempty"`
-	CarID   uint64 `json:"car_id,omitempty"`
-	UserID  uint64 `json:"user_id,omitempty"`
-	From    uint64 `json:"from_day,omitempty"`
-	To      uint64 `json:"to_day,omitempty"`
+	LeaseID         uint64 `json:"lease_id,omitempty"`
+	CarID           uint64 `json:"car_id,omitempty"`
+	UserID          uint64 `json:"user_id,omitempty"`
+	From            uint64 `json:"from_day,omitempty"`
+	To              uint64 `json:"to_day,omitempty"`
+	FromMinute      uint64 `json:"from_minute,omitempty"`
+	ToMinute        uint64 `json:"to_minute,omitempty"`
+	PickupLocation  string `json:"pickup_location,omitempty"`
+	ReturnLocation  string `json:"return_location,omitempty"`
+	OneWaySurcharge uint64 `json:"one_way_surcharge,omitempty"`
 }
 
-func (c *LeaseService) createLease(userID uint64, carID uint64, from, to uint64) (Lease, error) {
-	tx := c.db.NewTransaction(true)
-	defer tx.Discard()
+// span returns the leased minutes. Records written before minute
+// resolution only carry inclusive day numbers.
+func (c LeaseDBModel) span() interval.Interval {
+	if c.ToMinute != 0 {
+		return interval.Interval{From: c.FromMinute, To: c.ToMinute}
+	}
+	return interval.FromDays(c.From, c.To)
+}
+
+func (c LeaseDBModel) lease() Lease {
+	span := c.span()
+	return Lease{
+		CarID:           c.CarID,
+		UserID:          c.UserID,
+		LeaseID:         c.LeaseID,
+		From:            span.FromDay(),
+		To:              span.ToDay(),
+		FromMinute:      span.From,
+		ToMinute:        span.To,
+		PickupLocation:  c.PickupLocation,
+		ReturnLocation:  c.ReturnLocation,
+		OneWaySurcharge: c.OneWaySurcharge,
+	}
+}
+
+// createLease leases the car to the user holding token, who must be eligible
+// to drive its class.
+func (c *LeaseService) createLease(userID uint64, token string, carID uint64, span interval.Interval, route Route) (Lease, error) {
+	car, err := c.checkRental(carID, span, route)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	err = c.checkDriver(token, car, span)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	turnaround, err := c.turnaround(carID)
+	if err != nil {
+		return Lease{}, err
+	}
 
-	leaseID, err := c.leaseIDSequence.Next()
+	leaseID, err := c.repository.NextLeaseID()
 	if err != nil {
 		return Lease{}, err
 	}
 
+	var surcharge uint64
+	if route.oneWay() {
+		surcharge = c.oneWaySurcharge
+	}
+
 	lease := Lease{
-		UserID:  userID,
-		CarID:   carID,
-		LeaseID: leaseID,
-		From:    from,
-		To:      to,
+		UserID:          userID,
+		CarID:           carID,
+		LeaseID:         leaseID,
+		From:            span.FromDay(),
+		To:              span.ToDay(),
+		FromMinute:      span.From,
+		ToMinute:        span.To,
+		PickupLocation:  route.Pickup,
+		ReturnLocation:  route.dropoff(),
+		OneWaySurcharge: surcharge,
 	}
 
 	leaseDBModel := LeaseDBModel{
-		LeaseID: leaseID,
-		UserID:  userID,
-		CarID:   carID,
-		From:    from,
-		To:      to,
+		LeaseID:         leaseID,
+		UserID:          userID,
+		CarID:           carID,
+		From:            lease.From,
+		To:              lease.To,
+		FromMinute:      span.From,
+		ToMinute:        span.To,
+		PickupLocation:  lease.PickupLocation,
+		ReturnLocation:  lease.ReturnLocation,
+		OneWaySurcharge: surcharge,
 	}
 
-	key := fmt.Sprintf("%d_%d_%d", carID, from, to)
+	err = c.repository.CreateLease(leaseDBModel, func(existing []LeaseDBModel) error {
+		if !carIsFree(existing, span, route, car.HomeLocation, turnaround) {
+			return leaseAlreadyExists
+		}
+		return nil
+	})
+	if err != nil {
+		return Lease{}, err
+	}
+	c.watchers.notify(carID)
 
-	if c.IsCarFree(carID, from, to) {
-		leaseBts, err := json.Marshal(&leaseDBModel)
-		if err != nil {
-			return Lease{}, err
+	return lease, nil
+}
+
+// carLeases returns the leases of the car that end after fromMinute.
+func (c *LeaseService) carLeases(carID uint64, fromMinute uint64) ([]Lease, error) {
+	leaseDBModels, err := c.repository.CarLeases(carID)
+	if err != nil {
+		return nil, err
+	}
+
+	leases := []Lease{}
+	for _, leaseDBModel := range leaseDBModels {
+		if leaseDBModel.span().To <= fromMinute {
+			continue
 		}
-		err = tx.Set([]byte(key), leaseBts)
-		if err != nil {
-			return Lease{}, err
+		leases = append(leases, leaseDBModel.lease())
+	}
+	return leases, nil
+}
+
+// userLeases returns every lease of the user, for data exports.
+func (c *LeaseService) userLeases(userID uint64) ([]Lease, error) {
+	leaseDBModels, err := c.repository.UserLeases(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	leases := []Lease{}
+	for _, leaseDBModel := range leaseDBModels {
+		leases = append(leases, leaseDBModel.lease())
+	}
+	return leases, nil
+}
+
+// userLease returns the lease of the user with id leaseID. Leases of other users
+// are reported as not found.
+func (c *LeaseService) userLease(userID uint64, leaseID uint64) (Lease, error) {
+	leases, err := c.userLeases(userID)
+	if err != nil {
+		return Lease{}, err
+	}
+	for _, lease := range leases {
+		if lease.LeaseID == leaseID {
+			return lease, nil
 		}
+	}
+	return Lease{}, leaseNotFound
+}
+
+// eraseUser hands the leases of the user over to erasedUserID and returns
+// how many there were. Erasing twice is harmless.
+func (c *LeaseService) eraseUser(userID uint64) (int, error) {
+	return c.repository.ReassignUser(userID, erasedUserID)
+}
 
-		err = tx.Commit()
-		if err != nil {
-			return Lease{}, err
+// checkRental validates the request against the fleet catalog: the car must
+// exist, be in service and have no maintenance scheduled during span, and both
+// branches must be open at pickup and return time. It returns the car, which
+// is empty without a fleet catalog.
+func (c *LeaseService) checkRental(carID uint64, span interval.Interval, route Route) (fleet.Car, error) {
+	if !span.Valid() {
+		return fleet.Car{}, interval.ErrInvalid
+	}
+	if c.fleet == nil {
+		return fleet.Car{}, nil
+	}
+
+	car, err := c.fleet.GetCar(carID)
+	if err == fleet.ErrCarNotFound {
+		return fleet.Car{}, unknownCar
+	}
+	if err != nil {
+		return fleet.Car{}, err
+	}
+	if car.Status == fleet.StatusRetired {
+		return fleet.Car{}, carRetired
+	}
+
+	err = c.checkLocation(route.Pickup, span.From)
+	if err != nil {
+		return fleet.Car{}, err
+	}
+	err = c.checkLocation(route.dropoff(), span.To)
+	if err != nil {
+		return fleet.Car{}, err
+	}
+
+	windows, err := c.fleet.MaintenanceWindows(carID, span)
+	if err != nil {
+		return fleet.Car{}, err
+	}
+	if len(windows) > 0 {
+		return fleet.Car{}, carInMaintenance
+	}
+	return car, nil
+}
+
+// checkDriver returns *eligibility.Ineligible if the user holding token may
+// not drive car during span.
+func (c *LeaseService) checkDriver(token string, car fleet.Car, span interval.Interval) error {
+	if c.drivers == nil || c.fleet == nil || len(c.eligibility) == 0 {
+		return nil
+	}
+	driver, err := c.drivers.Driver(token)
+	if err != nil {
+		return err
+	}
+	return c.eligibility.Check(car.Class, driver, span)
+}
+
+func (c *LeaseService) checkLocation(code string, minute uint64) error {
+	if code == "" {
+		return nil
+	}
+	location, err := c.fleet.GetLocation(code)
+	if err == fleet.ErrLocationNotFound {
+		return unknownLocation
+	}
+	if err != nil {
+		return err
+	}
+	if !location.IsOpenAt(minute) {
+		return locationClosed
+	}
+	return nil
+}
+
+func (c *LeaseService) setTurnaround(carID uint64, minutes uint64) error {
+	err := c.repository.SetTurnaround(carID, minutes)
+	if err != nil {
+		return err
+	}
+	c.watchers.notify(carID)
+	return nil
+}
+
+// watchCar returns a channel that receives when a lease of the car is made or
+// its turnaround is changed through this instance, and the function that
+// stops the watch.
+func (c *LeaseService) watchCar(carID uint64) (<-chan struct{}, func()) {
+	return c.watchers.watch(carID)
+}
+
+func (c *LeaseService) turnaround(carID uint64) (uint64, error) {
+	minutes, ok, err := c.repository.Turnaround(carID)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return c.defaultTurnaround, nil
+	}
+	return minutes, nil
+}
+
+// IsCarFree reports whether the car has no lease intersecting the half-open
+// interval span, including the turnaround buffer between rentals, and will be
+// at the requested pickup location when the lease starts. Maintenance windows
+// from the fleet catalog count as occupied.
+func (c *LeaseService) IsCarFree(carID uint64, span interval.Interval, route Route) (bool, error) {
+	car, err := c.checkRental(carID, span, route)
+	if err == carInMaintenance {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	turnaround, err := c.turnaround(carID)
+	if err != nil {
+		return false, err
+	}
+
+	existing, err := c.repository.CarLeases(carID)
+	if err != nil {
+		return false, err
+	}
+
+	return carIsFree(existing, span, route, car.HomeLocation, turnaround), nil
+}
+
+// carIsFree checks span against the existing leases of one car. The car is
+// expected at the return location of the last lease before span, or at home
+// if there is none, and the next lease must start where this one ends.
+// Leases without locations match any route.
+func carIsFree(leases []LeaseDBModel, span interval.Interval, route Route, home string, turnaround uint64) bool {
+	var previous, next *LeaseDBModel
+	for i := range leases {
+		lease := &leases[i]
+		existing := lease.span()
+		if existing.Pad(turnaround).Overlaps(span.Pad(turnaround)) {
+			return false
+		}
+		if existing.To <= span.From && (previous == nil || existing.To > previous.span().To) {
+			previous = lease
+		}
+		if existing.From >= span.To && (next == nil || existing.From < next.span().From) {
+			next = lease
 		}
+	}
 
-		return lease, nil
-	}
-	if err == nil {
-		return Lease{}, leaseAlreadyExists
-	}
-	// err != nil and err != ErrKeyNotFound
-	return Lease{}, err
-}
-
-func (c LeaseService) IsCarFree(carID uint64, from, to uint64) bool {
-	carIDStr := strconv.FormatUint(carID, 10)
-	tx := c.db.NewTransaction(true)
-	defer tx.Discard()
-	it := tx.NewIterator(badger.DefaultIteratorOptions)
-	defer it.Close()
-	for it.Rewind(); it.Valid(); it.Next() {
-		item := it.Item()
-		if strings.HasPrefix(string(item.Key()), carIDStr) {
-			value, err := item.ValueCopy(nil)
-			if err != nil {
-				return true
-			}
-			lease := &LeaseDBModel{}
-			err = json.Unmarshal(value, lease)
-			if err != nil {
-				return true
-			}
-			if lease.From >= from && lease.From <= to {
-				return false
-			}
-			if lease.To >= from && lease.To <= to {
-				return false
-			}
+	if route.Pickup != "" {
+		location := home
+		if previous != nil && previous.ReturnLocation != "" {
+			location = previous.ReturnLocation
+		}
+		if location != "" && location != route.Pickup {
+			return false
 		}
 	}
+	if route.dropoff() != "" && next != nil && next.PickupLocation != "" && next.PickupLocation != route.dropoff() {
+		return false
+	}
 	return true
 }
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"distributed-rental/pkg/eligibility"
+	"distributed-rental/pkg/interval"
+	fleet "distributed-rental/projects/fleet/client"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// TestCarIsFree checks spans of car 1 against a lease from A to B in
+// [100, 200) and one from C to C in [400, 500).
+func TestCarIsFree(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		turnaround uint64
+		span       interval.Interval
+		route      Route
+		want       bool
+	}{
+		{name: "back to back after", span: interval.Interval{From: 200, To: 300}, want: true},
+		{name: "back to back before", span: interval.Interval{From: 50, To: 100}, want: true},
+		{name: "whole gap", span: interval.Interval{From: 200, To: 400}, want: true},
+		{name: "one minute over the end", span: interval.Interval{From: 199, To: 300}, want: false},
+		{name: "one minute over the start", span: interval.Interval{From: 50, To: 101}, want: false},
+		{name: "nested", span: interval.Interval{From: 120, To: 180}, want: false},
+		{name: "containing", span: interval.Interval{From: 50, To: 600}, want: false},
+		{name: "same", span: interval.Interval{From: 100, To: 200}, want: false},
+		{name: "other car's time", span: interval.Interval{From: 1000, To: 1100}, want: true},
+
+		{name: "inside turnaround after", turnaround: 30, span: interval.Interval{From: 200, To: 300}, want: false},
+		{name: "after turnaround", turnaround: 30, span: interval.Interval{From: 230, To: 300}, want: true},
+		{name: "turnaround before the next", turnaround: 30, span: interval.Interval{From: 230, To: 370}, want: true},
+		{name: "inside turnaround before the next", turnaround: 30, span: interval.Interval{From: 230, To: 371}, want: false},
+		{name: "turnaround before the first", turnaround: 30, span: interval.Interval{From: 0, To: 70}, want: true},
+		{name: "inside turnaround before the first", turnaround: 30, span: interval.Interval{From: 0, To: 71}, want: false},
+		{name: "gap shorter than turnaround", turnaround: 150, span: interval.Interval{From: 350, To: 360}, want: false},
+
+		{name: "pickup where returned", span: interval.Interval{From: 200, To: 300}, route: Route{Pickup: "B", Return: "C"}, want: true},
+		{name: "pickup elsewhere", span: interval.Interval{From: 200, To: 300}, route: Route{Pickup: "A", Return: "C"}, want: false},
+		{name: "return elsewhere", span: interval.Interval{From: 200, To: 300}, route: Route{Pickup: "B", Return: "D"}, want: false},
+		{name: "round trip away from the next pickup", span: interval.Interval{From: 200, To: 300}, route: Route{Pickup: "B"}, want: false},
+		{name: "after the last", span: interval.Interval{From: 600, To: 700}, route: Route{Pickup: "C", Return: "E"}, want: true},
+		{name: "before the first", span: interval.Interval{From: 0, To: 50}, route: Route{Pickup: "X", Return: "A"}, want: true},
+		{name: "before the first elsewhere", span: interval.Interval{From: 0, To: 50}, route: Route{Pickup: "X"}, want: false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			repository := NewMemoryLeaseRepository()
+			for _, lease := range []LeaseDBModel{
+				{LeaseID: 1, CarID: 1, FromMinute: 100, ToMinute: 200, PickupLocation: "A", ReturnLocation: "B"},
+				{LeaseID: 2, CarID: 1, FromMinute: 400, ToMinute: 500, PickupLocation: "C", ReturnLocation: "C"},
+				{LeaseID: 3, CarID: 2, FromMinute: 1000, ToMinute: 1100},
+			} {
+				err := repository.CreateLease(lease, func([]LeaseDBModel) error { return nil })
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := repository.SetTurnaround(1, test.turnaround)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The default only applies to cars without their own turnaround.
+			leaseService := NewLeaseService(repository, zap.NewNop().Sugar(), 1000, 0, nil)
+
+			free, err := leaseService.IsCarFree(1, test.span, test.route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if free != test.want {
+				t.Fatalf("IsCarFree(%v, %+v) = %v, want %v", test.span, test.route, free, test.want)
+			}
+		})
+	}
+}
+
+func TestCarIsFreeDefaultTurnaround(t *testing.T) {
+	repository := NewMemoryLeaseRepository()
+	err := repository.CreateLease(LeaseDBModel{LeaseID: 1, CarID: 1, FromMinute: 100, ToMinute: 200}, func([]LeaseDBModel) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaseService := NewLeaseService(repository, zap.NewNop().Sugar(), 30, 0, nil)
+	for span, want := range map[interval.Interval]bool{
+		{From: 229, To: 300}: false,
+		{From: 230, To: 300}: true,
+	} {
+		free, err := leaseService.IsCarFree(1, span, Route{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if free != want {
+			t.Errorf("IsCarFree(%v) = %v, want %v", span, free, want)
+		}
+	}
+
+	_, err = leaseService.IsCarFree(1, interval.Interval{From: 300, To: 300}, Route{})
+	if err != interval.ErrInvalid {
+		t.Fatalf("empty span: got %v, want %v", err, interval.ErrInvalid)
+	}
+}
+
+// testCatalog has the cars of the fleet and no branches or maintenance.
+type testCatalog map[uint64]fleet.Car
+
+func (c testCatalog) GetCar(carID uint64) (fleet.Car, error) {
+	car, ok := c[carID]
+	if !ok {
+		return fleet.Car{}, fleet.ErrCarNotFound
+	}
+	return car, nil
+}
+
+func (c testCatalog) GetLocation(code string) (fleet.Location, error) {
+	return fleet.Location{}, fleet.ErrLocationNotFound
+}
+
+func (c testCatalog) MaintenanceWindows(carID uint64, span interval.Interval) ([]fleet.MaintenanceWindow, error) {
+	return nil, nil
+}
+
+// testDrivers maps access tokens to their drivers.
+type testDrivers map[string]eligibility.Driver
+
+func (c testDrivers) Driver(token string) (eligibility.Driver, error) {
+	return c[token], nil
+}
+
+func TestCreateLeaseEligibility(t *testing.T) {
+	license := eligibility.License{Number: "77 12 345678", Country: "RU", ExpiresOn: "2026-06-10", Status: eligibility.StatusVerified}
+	leaseService := NewLeaseService(NewMemoryLeaseRepository(), zap.NewNop().Sugar(), 0, 0, testCatalog{1: {CarID: 1, Class: "premium"}})
+	leaseService.SetEligibility(testDrivers{
+		"adult":      {DateOfBirth: "1990-01-01", License: license},
+		"unlicensed": {DateOfBirth: "1990-01-01"},
+		"expired":    {DateOfBirth: "1990-01-01", License: eligibility.License{Number: license.Number, ExpiresOn: "2026-05-31", Status: eligibility.StatusVerified}},
+		"unverified": {DateOfBirth: "1990-01-01", License: eligibility.License{Number: license.Number, ExpiresOn: license.ExpiresOn, Status: eligibility.StatusUnverified}},
+	}, eligibility.Rules{"premium": {MinAge: 25, Verified: true}})
+	from := uint64(time.Date(2026, 6, 1, 10, 0, 0, 0, time.UTC).Unix() / 60)
+
+	for token, valid := range map[string]bool{"unlicensed": false, "expired": false, "unverified": false, "adult": true} {
+		_, err := leaseService.createLease(1, token, 1, interval.Interval{From: from, To: from + 120}, Route{})
+		if _, ineligible := err.(*eligibility.Ineligible); valid != (err == nil) || err != nil && !ineligible {
+			t.Errorf("%s: got %v", token, err)
+		}
+	}
+}
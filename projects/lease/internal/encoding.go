@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"distributed-rental/pkg/interval"
+	"distributed-rental/pkg/record"
+	"encoding/json"
+	"fmt"
+)
+
+// leaseSchemaVersion is what encodeLease writes. Version 0 is the original
+// JSON layout, which drops zero fields and predates minute resolution.
+const leaseSchemaVersion = 1
+
+// Field numbers of the version 1 lease record. Never reuse a number.
+const (
+	leaseCarIDField           = 1
+	leaseUserIDField          = 2
+	leaseIDField              = 3
+	leaseFromDayField         = 4
+	leaseToDayField           = 5
+	leaseFromMinuteField      = 6
+	leaseToMinuteField        = 7
+	leasePickupLocationField  = 8
+	leaseReturnLocationField  = 9
+	leaseOneWaySurchargeField = 10
+)
+
+func encodeLease(lease LeaseDBModel) []byte {
+	e := record.Encoder{}
+	e.Uint64(leaseCarIDField, lease.CarID)
+	e.Uint64(leaseUserIDField, lease.UserID)
+	e.Uint64(leaseIDField, lease.LeaseID)
+	e.Uint64(leaseFromDayField, lease.From)
+	e.Uint64(leaseToDayField, lease.To)
+	e.Uint64(leaseFromMinuteField, lease.FromMinute)
+	e.Uint64(leaseToMinuteField, lease.ToMinute)
+	e.String(leasePickupLocationField, lease.PickupLocation)
+	e.String(leaseReturnLocationField, lease.ReturnLocation)
+	e.Uint64(leaseOneWaySurchargeField, lease.OneWaySurcharge)
+	return record.Seal(leaseSchemaVersion, e.Bytes())
+}
+
+// decodeLease reads a stored lease of any known schema version and
+// upgrades it to the current model.
+func decodeLease(data []byte) (LeaseDBModel, error) {
+	version, payload, err := record.Open(data)
+	if err != nil {
+		return LeaseDBModel{}, err
+	}
+
+	lease := LeaseDBModel{}
+	switch version {
+	case 0:
+		err = json.Unmarshal(payload, &lease)
+		if err != nil {
+			return LeaseDBModel{}, err
+		}
+		if lease.ToMinute == 0 {
+			span := interval.FromDays(lease.From, lease.To)
+			lease.FromMinute, lease.ToMinute = span.From, span.To
+		}
+	case 1:
+		err = record.Walk(payload, func(f record.Field) error {
+			switch f.Number {
+			case leaseCarIDField:
+				lease.CarID = f.Varint
+			case leaseUserIDField:
+				lease.UserID = f.Varint
+			case leaseIDField:
+				lease.LeaseID = f.Varint
+			case leaseFromDayField:
+				lease.From = f.Varint
+			case leaseToDayField:
+				lease.To = f.Varint
+			case leaseFromMinuteField:
+				lease.FromMinute = f.Varint
+			case leaseToMinuteField:
+				lease.ToMinute = f.Varint
+			case leasePickupLocationField:
+				lease.PickupLocation = f.String()
+			case leaseReturnLocationField:
+				lease.ReturnLocation = f.String()
+			case leaseOneWaySurchargeField:
+				lease.OneWaySurcharge = f.Varint
+			}
+			return nil
+		})
+		if err != nil {
+			return LeaseDBModel{}, err
+		}
+	default:
+		return LeaseDBModel{}, fmt.Errorf("lease record has unknown schema version %d", version)
+	}
+	return lease, nil
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var testLeaseRecord = LeaseDBModel{
+	CarID:           42,
+	UserID:          7,
+	LeaseID:         1001,
+	From:            20380,
+	To:              20382,
+	FromMinute:      29347200,
+	ToMinute:        29351520,
+	PickupLocation:  "airport",
+	ReturnLocation:  "downtown",
+	OneWaySurcharge: 1500,
+}
+
+func TestEncodeLease(t *testing.T) {
+	for _, lease := range []LeaseDBModel{testLeaseRecord, {}} {
+		got, err := decodeLease(encodeLease(lease))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != lease {
+			t.Fatalf("got %+v, want %+v", got, lease)
+		}
+	}
+
+	// Legacy JSON records only have days, which are upgraded to minutes.
+	got, err := decodeLease([]byte(`{"car_id":42,"from_day":1,"to_day":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FromMinute != 1440 || got.ToMinute != 3*1440 {
+		t.Fatalf("legacy record: got %+v", got)
+	}
+}
+
+// BenchmarkEncode compares the record envelope with the JSON it replaced.
+func BenchmarkEncode(b *testing.B) {
+	b.Run("record", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			encodeLease(testLeaseRecord)
+		}
+	})
+	b.Run("json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, err := json.Marshal(testLeaseRecord)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDecode(b *testing.B) {
+	b.Run("record", func(b *testing.B) {
+		data := encodeLease(testLeaseRecord)
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, err := decodeLease(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("json", func(b *testing.B) {
+		data, err := json.Marshal(testLeaseRecord)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var lease LeaseDBModel
+			err := json.Unmarshal(data, &lease)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,300 @@
+package internal
+
+import (
+	"context"
+	"distributed-rental/pkg/apikey"
+	"distributed-rental/pkg/interval"
+	"distributed-rental/pkg/ratelimit"
+	"distributed-rental/pkg/rpc"
+	"distributed-rental/pkg/servicetoken"
+	"distributed-rental/projects/lease/leasepb"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"net/http"
+	"time"
+)
+
+// GrpcServer serves the lease API over gRPC next to an HttpServer, with the
+// same credentials, rate limiter and TLS.
+type GrpcServer struct {
+	leasepb.UnimplementedLeaseServiceServer
+
+	addr          string
+	server        *grpc.Server
+	httpServer    *HttpServer
+	leaseService  *LeaseService
+	logger        *zap.SugaredLogger
+	watchInterval time.Duration
+	closing       chan struct{}
+}
+
+// NewGrpcServer creates a gRPC server for the service of httpServer. Call it
+// once httpServer has its TLS config and rate limiter.
+func NewGrpcServer(addr string, httpServer *HttpServer) *GrpcServer {
+	grpcServer := &GrpcServer{
+		addr:          addr,
+		httpServer:    httpServer,
+		leaseService:  httpServer.leaseService,
+		logger:        httpServer.logger,
+		watchInterval: 30 * time.Second,
+		closing:       make(chan struct{}),
+	}
+
+	guard := &rpc.Guard{
+		Authenticate: grpcServer.authenticate,
+		Limiter:      httpServer.limiter,
+		Key:          ratelimit.UserOrIP(httpServer.jwtSigningKey),
+		Logger:       httpServer.logger,
+	}
+	options := []grpc.ServerOption{grpc.UnaryInterceptor(guard.Unary()), grpc.StreamInterceptor(guard.Stream())}
+	if httpServer.server.TLSConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(httpServer.server.TLSConfig)))
+	}
+	grpcServer.server = grpc.NewServer(options...)
+	leasepb.RegisterLeaseServiceServer(grpcServer.server, grpcServer)
+	return grpcServer
+}
+
+// SetWatchInterval sets how often WatchAvailability checks the car again for
+// changes made elsewhere: through other instances or in the fleet service.
+func (c *GrpcServer) SetWatchInterval(interval time.Duration) {
+	c.watchInterval = interval
+}
+
+func (c *GrpcServer) ListenAndServe() error {
+	listener, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	return c.server.Serve(listener)
+}
+
+// Shutdown ends the availability streams, stops accepting connections and
+// waits for running calls until ctx is done, then closes them.
+func (c *GrpcServer) Shutdown(ctx context.Context) error {
+	close(c.closing)
+	stopped := make(chan struct{})
+	go func() {
+		c.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		c.server.Stop()
+		return ctx.Err()
+	}
+}
+
+type grpcUserKey struct{}
+
+// grpcUser is the caller of a user RPC and the credential to look the driver
+// up with.
+type grpcUser struct {
+	UserAuthObject
+	credential string
+}
+
+// authenticate lets each RPC take the credentials of its HTTP route.
+func (c *GrpcServer) authenticate(ctx context.Context, method string, r *http.Request) (context.Context, error) {
+	switch method {
+	case leasepb.LeaseService_CreateLease_FullMethodName:
+		return c.authUser(ctx, r, servicetoken.ScopeLeaseWrite)
+	case leasepb.LeaseService_GetLease_FullMethodName, leasepb.LeaseService_CheckCar_FullMethodName, leasepb.LeaseService_WatchAvailability_FullMethodName:
+		return c.authUser(ctx, r, servicetoken.ScopeLeaseRead)
+	case leasepb.LeaseService_CarLeases_FullMethodName:
+		return c.authService(ctx, r, servicetoken.ScopeLeaseRead)
+	case leasepb.LeaseService_SetTurnaround_FullMethodName:
+		return c.authService(ctx, r, servicetoken.ScopeLeaseWrite)
+	case leasepb.LeaseService_UserLeases_FullMethodName, leasepb.LeaseService_EraseUser_FullMethodName:
+		if !c.httpServer.checkAdmin(r) {
+			return nil, rpc.Error(http.StatusUnauthorized, errors.New("wrong admin token"))
+		}
+		return ctx, nil
+	}
+	return nil, status.Errorf(codes.Unimplemented, "unknown method %s", method)
+}
+
+func (c *GrpcServer) authUser(ctx context.Context, r *http.Request, scope string) (context.Context, error) {
+	userAuth, credential, err := c.httpServer.checkUser(r, scope)
+	if err != nil {
+		return nil, rpc.Error(apikey.Status(err), err)
+	}
+	return context.WithValue(ctx, grpcUserKey{}, grpcUser{userAuth, credential}), nil
+}
+
+func (c *GrpcServer) authService(ctx context.Context, r *http.Request, scope string) (context.Context, error) {
+	_, err := c.httpServer.checkService(r, scope)
+	if err != nil {
+		return nil, rpc.Error(servicetoken.Status(err), err)
+	}
+	return ctx, nil
+}
+
+// error answers an RPC the lease service failed, logging what the caller
+// is not shown.
+func (c *GrpcServer) error(name string, err error) error {
+	httpStatus := errorStatus(err)
+	if httpStatus == http.StatusInternalServerError {
+		c.logger.Errorf("%s error: %v", name, err)
+	}
+	return rpc.Error(httpStatus, err)
+}
+
+func (c *GrpcServer) CreateLease(ctx context.Context, request *leasepb.CreateLeaseRequest) (*leasepb.Lease, error) {
+	c.logger.Infof("got grpc request for create lease")
+	user := ctx.Value(grpcUserKey{}).(grpcUser)
+
+	span := requestInterval(request.FromDay, request.ToDay, request.FromMinute, request.ToMinute, requestTime(request.From), requestTime(request.To))
+	route := Route{Pickup: request.PickupLocation, Return: request.ReturnLocation}
+	lease, err := c.leaseService.createLease(user.UserID, user.credential, request.CarId, span, route)
+	if err != nil {
+		return nil, c.error("create lease", err)
+	}
+	return leaseMessage(lease), nil
+}
+
+func (c *GrpcServer) GetLease(ctx context.Context, request *leasepb.GetLeaseRequest) (*leasepb.Lease, error) {
+	c.logger.Infof("got grpc request for get lease")
+	user := ctx.Value(grpcUserKey{}).(grpcUser)
+
+	lease, err := c.leaseService.userLease(user.UserID, request.LeaseId)
+	if err != nil {
+		return nil, c.error("get lease", err)
+	}
+	return leaseMessage(lease), nil
+}
+
+func (c *GrpcServer) CheckCar(ctx context.Context, request *leasepb.CheckCarRequest) (*leasepb.CheckCarResponse, error) {
+	c.logger.Infof("got grpc request for check car")
+	span, route := checkCarInterval(request)
+	isFree, err := c.leaseService.IsCarFree(request.CarId, span, route)
+	if err != nil {
+		return nil, c.error("check car", err)
+	}
+	return &leasepb.CheckCarResponse{IsFree: isFree}, nil
+}
+
+// WatchAvailability sends whether the car is free now and again whenever
+// that changes. Leases made through this instance are seen at once; those
+// made through other instances and maintenance scheduled in the fleet service
+// are seen at the next check, every watch interval.
+func (c *GrpcServer) WatchAvailability(request *leasepb.CheckCarRequest, stream leasepb.LeaseService_WatchAvailabilityServer) error {
+	c.logger.Infof("got grpc request for watch availability")
+	span, route := checkCarInterval(request)
+
+	changed, stop := c.leaseService.watchCar(request.CarId)
+	defer stop()
+	ticker := time.NewTicker(c.watchInterval)
+	defer ticker.Stop()
+
+	sent, wasFree := false, false
+	for {
+		isFree, err := c.leaseService.IsCarFree(request.CarId, span, route)
+		if err != nil {
+			return c.error("watch availability", err)
+		}
+		if !sent || isFree != wasFree {
+			err = stream.Send(&leasepb.AvailabilityChange{IsFree: isFree, Time: timestamppb.Now()})
+			if err != nil {
+				return err
+			}
+			sent, wasFree = true, isFree
+		}
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return nil
+		case <-c.closing:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+func (c *GrpcServer) CarLeases(ctx context.Context, request *leasepb.CarLeasesRequest) (*leasepb.LeaseList, error) {
+	c.logger.Infof("got grpc request for car leases")
+	leases, err := c.leaseService.carLeases(request.CarId, request.FromMinute)
+	if err != nil {
+		return nil, c.error("car leases", err)
+	}
+	return leaseList(leases), nil
+}
+
+func (c *GrpcServer) SetTurnaround(ctx context.Context, request *leasepb.SetTurnaroundRequest) (*leasepb.SetTurnaroundResponse, error) {
+	c.logger.Infof("got grpc request for set turnaround")
+	err := c.leaseService.setTurnaround(request.CarId, request.Minutes)
+	if err != nil {
+		return nil, c.error("set turnaround", err)
+	}
+	return &leasepb.SetTurnaroundResponse{}, nil
+}
+
+func (c *GrpcServer) UserLeases(ctx context.Context, request *leasepb.UserRequest) (*leasepb.LeaseList, error) {
+	c.logger.Infof("got grpc request for user leases")
+	if request.UserId == nil {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	leases, err := c.leaseService.userLeases(*request.UserId)
+	if err != nil {
+		return nil, c.error("user leases", err)
+	}
+	return leaseList(leases), nil
+}
+
+func (c *GrpcServer) EraseUser(ctx context.Context, request *leasepb.UserRequest) (*leasepb.EraseUserResponse, error) {
+	c.logger.Infof("got grpc request for erase user")
+	if request.UserId == nil {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	erased, err := c.leaseService.eraseUser(*request.UserId)
+	if err != nil {
+		return nil, c.error("erase user", err)
+	}
+	return &leasepb.EraseUserResponse{Erased: int64(erased)}, nil
+}
+
+func checkCarInterval(request *leasepb.CheckCarRequest) (interval.Interval, Route) {
+	span := requestInterval(request.FromDay, request.ToDay, request.FromMinute, request.ToMinute, requestTime(request.From), requestTime(request.To))
+	return span, Route{Pickup: request.PickupLocation, Return: request.ReturnLocation}
+}
+
+// requestTime is the time of an optional timestamp field, nil if unset.
+func requestTime(timestamp *timestamppb.Timestamp) *time.Time {
+	if timestamp == nil {
+		return nil
+	}
+	t := timestamp.AsTime()
+	return &t
+}
+
+func leaseMessage(lease Lease) *leasepb.Lease {
+	return &leasepb.Lease{
+		CarId:           lease.CarID,
+		UserId:          lease.UserID,
+		LeaseId:         lease.LeaseID,
+		FromDay:         lease.From,
+		ToDay:           lease.To,
+		FromMinute:      lease.FromMinute,
+		ToMinute:        lease.ToMinute,
+		PickupLocation:  lease.PickupLocation,
+		ReturnLocation:  lease.ReturnLocation,
+		OneWaySurcharge: lease.OneWaySurcharge,
+	}
+}
+
+func leaseList(leases []Lease) *leasepb.LeaseList {
+	list := &leasepb.LeaseList{}
+	for _, lease := range leases {
+		list.Leases = append(list.Leases, leaseMessage(lease))
+	}
+	return list
+}
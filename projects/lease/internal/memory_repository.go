@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryLeaseRepository keeps leases in process memory. It is meant for
+// tests and local runs; everything is lost on restart.
+type MemoryLeaseRepository struct {
+	mu          sync.Mutex
+	lastLeaseID uint64
+	leases      map[uint64][]LeaseDBModel
+	turnarounds map[uint64]uint64
+}
+
+func NewMemoryLeaseRepository() *MemoryLeaseRepository {
+	return &MemoryLeaseRepository{
+		leases:      map[uint64][]LeaseDBModel{},
+		turnarounds: map[uint64]uint64{},
+	}
+}
+
+func (c *MemoryLeaseRepository) NextLeaseID() (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastLeaseID++
+	return c.lastLeaseID, nil
+}
+
+func (c *MemoryLeaseRepository) CarLeases(carID uint64) ([]LeaseDBModel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]LeaseDBModel{}, c.leases[carID]...), nil
+}
+
+func (c *MemoryLeaseRepository) UserLeases(userID uint64) ([]LeaseDBModel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	leases := []LeaseDBModel{}
+	for _, carLeases := range c.leases {
+		for _, lease := range carLeases {
+			if lease.UserID == userID {
+				leases = append(leases, lease)
+			}
+		}
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].LeaseID < leases[j].LeaseID })
+	return leases, nil
+}
+
+func (c *MemoryLeaseRepository) ReassignUser(userID uint64, newUserID uint64) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	moved := 0
+	for _, carLeases := range c.leases {
+		for i := range carLeases {
+			if carLeases[i].UserID == userID {
+				carLeases[i].UserID = newUserID
+				moved++
+			}
+		}
+	}
+	return moved, nil
+}
+
+func (c *MemoryLeaseRepository) CreateLease(lease LeaseDBModel, check func(existing []LeaseDBModel) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := check(append([]LeaseDBModel{}, c.leases[lease.CarID]...))
+	if err != nil {
+		return err
+	}
+	c.leases[lease.CarID] = append(c.leases[lease.CarID], lease)
+	return nil
+}
+
+func (c *MemoryLeaseRepository) Turnaround(carID uint64) (uint64, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	minutes, ok := c.turnarounds[carID]
+	return minutes, ok, nil
+}
+
+func (c *MemoryLeaseRepository) SetTurnaround(carID uint64, minutes uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.turnarounds[carID] = minutes
+	return nil
+}
+
+func (c *MemoryLeaseRepository) Close() error {
+	return nil
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"bytes"
+	"distributed-rental/pkg/migrate"
+	"regexp"
+)
+
+// leaseKeyPattern matches "<car_id>_<from>_<to>" lease keys.
+var leaseKeyPattern = regexp.MustCompile(`^\d+_\d+_\d+$`)
+
+// BadgerMigrations upgrade the badger key layout and records in order. Append
+// new migrations with the next version; never change or reorder old ones.
+var BadgerMigrations = []migrate.Migration{
+	{
+		Version: 1,
+		Name:    "encode leases as binary records",
+		Rewrite: func(key, value []byte) ([]byte, []byte, bool, error) {
+			if !leaseKeyPattern.Match(key) || len(value) == 0 || value[0] != '{' {
+				return nil, nil, false, nil
+			}
+			lease, err := decodeLease(value)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			return key, encodeLease(lease), true, nil
+		},
+	},
+	{
+		// Leases made before minute resolution are keyed by day numbers,
+		// which collide with minute keys of the same digits.
+		Version: 2,
+		Name:    "key leases by minutes",
+		Rewrite: func(key, value []byte) ([]byte, []byte, bool, error) {
+			if !leaseKeyPattern.Match(key) {
+				return nil, nil, false, nil
+			}
+			lease, err := decodeLease(value)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			newKey := getKey(lease.CarID, lease.FromMinute, lease.ToMinute)
+			if bytes.Equal(newKey, key) {
+				return nil, nil, false, nil
+			}
+			return newKey, value, true, nil
+		},
+	},
+}
@@ -0,0 +1,23 @@
+package internal
+
+// LeaseRepository is the storage behind LeaseService.
+type LeaseRepository interface {
+	// NextLeaseID returns a lease id that has not been issued before.
+	NextLeaseID() (uint64, error)
+	// CarLeases returns every stored lease of the car.
+	CarLeases(carID uint64) ([]LeaseDBModel, error)
+	// UserLeases returns every stored lease of the user.
+	UserLeases(userID uint64) ([]LeaseDBModel, error)
+	// ReassignUser moves every lease of userID to newUserID and returns how
+	// many it moved.
+	ReassignUser(userID uint64, newUserID uint64) (int, error)
+	// CreateLease stores lease unless check rejects it. check receives the
+	// car's current leases and runs in the same transaction as the write,
+	// serialized with other writes to the car, so two overlapping leases can
+	// not both be accepted even when made at the same time.
+	CreateLease(lease LeaseDBModel, check func(existing []LeaseDBModel) error) error
+	// Turnaround returns the car's own turnaround buffer; ok is false if none is set.
+	Turnaround(carID uint64) (minutes uint64, ok bool, err error)
+	SetTurnaround(carID uint64, minutes uint64) error
+	Close() error
+}
@@ -0,0 +1,286 @@
+package internal
+
+import (
+	"distributed-rental/pkg/interval"
+	"github.com/dgraph-io/badger/v3"
+	"math"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// repositories opens an empty repository of every backend.
+var repositories = map[string]func(t *testing.T) LeaseRepository{
+	"memory": func(t *testing.T) LeaseRepository {
+		return NewMemoryLeaseRepository()
+	},
+	"sqlite": func(t *testing.T) LeaseRepository {
+		repository, err := NewSQLiteLeaseRepository(filepath.Join(t.TempDir(), "lease.sqlite"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { repository.Close() })
+		return repository
+	},
+	"badger": func(t *testing.T) LeaseRepository {
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		repository, err := NewBadgerLeaseRepository(db, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			repository.Close()
+			db.Close()
+		})
+		return repository
+	},
+}
+
+// forEachRepository runs test against every backend, so that they all keep
+// the LeaseRepository contract.
+func forEachRepository(t *testing.T, test func(t *testing.T, repository LeaseRepository)) {
+	for name, open := range repositories {
+		t.Run(name, func(t *testing.T) {
+			test(t, open(t))
+		})
+	}
+}
+
+func testLease(leaseID, userID, carID, from, to uint64) LeaseDBModel {
+	span := interval.Interval{From: from, To: to}
+	return LeaseDBModel{
+		LeaseID:    leaseID,
+		UserID:     userID,
+		CarID:      carID,
+		From:       span.FromDay(),
+		To:         span.ToDay(),
+		FromMinute: from,
+		ToMinute:   to,
+	}
+}
+
+// rejectOverlap is the check of createLease without locations and turnaround.
+func rejectOverlap(lease LeaseDBModel) func(existing []LeaseDBModel) error {
+	return func(existing []LeaseDBModel) error {
+		if !carIsFree(existing, lease.span(), Route{}, "", 0) {
+			return leaseAlreadyExists
+		}
+		return nil
+	}
+}
+
+func create(t *testing.T, repository LeaseRepository, lease LeaseDBModel) {
+	t.Helper()
+	err := repository.CreateLease(lease, rejectOverlap(lease))
+	if err != nil {
+		t.Fatalf("create lease %d: %v", lease.LeaseID, err)
+	}
+}
+
+func leaseIDs(leases []LeaseDBModel) []uint64 {
+	ids := []uint64{}
+	for _, lease := range leases {
+		ids = append(ids, lease.LeaseID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRepositoryNextLeaseID(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository LeaseRepository) {
+		seen := map[uint64]bool{}
+		for i := 0; i < 25; i++ {
+			leaseID, err := repository.NextLeaseID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen[leaseID] {
+				t.Fatalf("lease id %d issued twice", leaseID)
+			}
+			seen[leaseID] = true
+		}
+	})
+}
+
+func TestRepositoryCreateLease(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository LeaseRepository) {
+		create(t, repository, testLease(1, 7, 42, 100, 200))
+		create(t, repository, testLease(2, 7, 42, 200, 300))
+		create(t, repository, testLease(3, 8, 43, 100, 200))
+
+		err := repository.CreateLease(testLease(4, 8, 42, 150, 250), rejectOverlap(testLease(4, 8, 42, 150, 250)))
+		if err != leaseAlreadyExists {
+			t.Fatalf("overlapping lease: got %v, want %v", err, leaseAlreadyExists)
+		}
+
+		leases, err := repository.CarLeases(42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(leases) != 2 {
+			t.Fatalf("car 42 has %d leases, want 2", len(leases))
+		}
+	})
+}
+
+// TestRepositoryConcurrentOverlap makes two overlapping leases of each car,
+// with the same interval for even cars, at the same time: exactly one of them
+// has to be accepted.
+func TestRepositoryConcurrentOverlap(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository LeaseRepository) {
+		const cars = 50
+		var wg sync.WaitGroup
+		errs := make(chan error, 2*cars)
+		for carID := uint64(1); carID <= cars; carID++ {
+			for _, lease := range []LeaseDBModel{
+				testLease(carID*2, 1, carID, 100, 200),
+				testLease(carID*2+1, 2, carID, 100+carID%2*50, 200+carID%2*50),
+			} {
+				wg.Add(1)
+				go func(lease LeaseDBModel) {
+					defer wg.Done()
+					err := repository.CreateLease(lease, rejectOverlap(lease))
+					if err != nil && err != leaseAlreadyExists {
+						errs <- err
+					}
+				}(lease)
+			}
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+
+		for carID := uint64(1); carID <= cars; carID++ {
+			leases, err := repository.CarLeases(carID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(leases) != 1 {
+				t.Fatalf("car %d has %d leases, want 1", carID, len(leases))
+			}
+		}
+	})
+}
+
+func TestRepositoryUserLeases(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository LeaseRepository) {
+		create(t, repository, testLease(5, 7, 1, 100, 200))
+		create(t, repository, testLease(2, 7, 2, 100, 200))
+		create(t, repository, testLease(9, 8, 3, 100, 200))
+		create(t, repository, testLease(4, 7, 3, 300, 400))
+
+		leases, err := repository.UserLeases(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := leaseIDs(leases); !equalIDs(ids, []uint64{2, 4, 5}) {
+			t.Fatalf("user leases: got %v", ids)
+		}
+
+		moved, err := repository.ReassignUser(7, erasedUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if moved != 3 {
+			t.Fatalf("moved %d leases, want 3", moved)
+		}
+		leases, err = repository.UserLeases(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(leases) != 0 {
+			t.Fatalf("erased user still has leases %v", leaseIDs(leases))
+		}
+		leases, err = repository.UserLeases(erasedUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := leaseIDs(leases); !equalIDs(ids, []uint64{2, 4, 5}) {
+			t.Fatalf("reassigned leases: got %v", ids)
+		}
+
+		moved, err = repository.ReassignUser(7, erasedUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if moved != 0 {
+			t.Fatalf("second erase moved %d leases", moved)
+		}
+	})
+}
+
+func TestRepositoryTurnaround(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository LeaseRepository) {
+		_, ok, err := repository.Turnaround(42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Fatal("turnaround set before SetTurnaround")
+		}
+		for _, minutes := range []uint64{30, 0} {
+			err = repository.SetTurnaround(42, minutes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok, err := repository.Turnaround(42)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || got != minutes {
+				t.Fatalf("turnaround: got %d, %v, want %d", got, ok, minutes)
+			}
+		}
+	})
+}
+
+// TestRepositoryLargeIDs looks up ids that do not fit into an int64, which
+// SQLite can not store.
+func TestRepositoryLargeIDs(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository LeaseRepository) {
+		leases, err := repository.CarLeases(math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(leases) != 0 {
+			t.Fatalf("car with the largest id has leases %v", leaseIDs(leases))
+		}
+		leases, err = repository.UserLeases(math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(leases) != 0 {
+			t.Fatalf("user with the largest id has leases %v", leaseIDs(leases))
+		}
+		moved, err := repository.ReassignUser(math.MaxUint64, erasedUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if moved != 0 {
+			t.Fatalf("moved %d leases of an unknown user", moved)
+		}
+		_, ok, err := repository.Turnaround(math.MaxUint64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Fatal("turnaround set for the largest car id")
+		}
+	})
+}
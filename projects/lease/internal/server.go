@@ -1,23 +1,39 @@
 package internal
 
 import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"distributed-rental/pkg/apikey"
+	"distributed-rental/pkg/eligibility"
+	"distributed-rental/pkg/interval"
+	"distributed-rental/pkg/openapi"
+	"distributed-rental/pkg/ratelimit"
+	"distributed-rental/pkg/rest"
+	"distributed-rental/pkg/servicetoken"
+	"distributed-rental/pkg/usertoken"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt"
 	"go.uber.org/zap"
-	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 type HttpServer struct {
-	server        http.Server
+	server        *http.Server
 	leaseService  *LeaseService
 	logger        *zap.SugaredLogger
 	jwtSigningKey []byte
+	tokenVerifier TokenVerifier
+	keyVerifier   KeyVerifier
+	limiter       *ratelimit.Limiter
+	adminToken    []byte
 }
 
 func NewHttpServer(addr string, leaseService *LeaseService, logger *zap.SugaredLogger, jwtSecret []byte) *HttpServer {
-	srv := http.Server{
+	srv := &http.Server{
 		Addr: addr,
 	}
 
@@ -31,39 +47,175 @@ func NewHttpServer(addr string, leaseService *LeaseService, logger *zap.SugaredL
 	mux := http.NewServeMux()
 	mux.HandleFunc("/create_lease", httpServer.createLease)
 	mux.HandleFunc("/check_lease", httpServer.checkCar)
+	mux.HandleFunc("/set_turnaround", httpServer.setTurnaround)
+	mux.HandleFunc("/car_leases", httpServer.carLeases)
+	mux.HandleFunc("/admin/user_leases", httpServer.userLeases)
+	mux.HandleFunc("/admin/erase_user", httpServer.eraseUser)
+
+	openapi.Register(mux, httpServer.operations())
+	mux.HandleFunc("GET /openapi.json", openapi.Handler(OpenAPI()))
 	httpServer.server.Handler = mux
 
 	return &httpServer
 }
 
 type createLeaseRequest struct {
-	CarID uint64 `json:"car_id"`
-	From  uint64 `json:"from_day"`
-	To    uint64 `json:"to_day"`
+	CarID          uint64     `json:"car_id"`
+	From           uint64     `json:"from_day"`
+	To             uint64     `json:"to_day"`
+	FromMinute     uint64     `json:"from_minute"`
+	ToMinute       uint64     `json:"to_minute"`
+	FromTime       *time.Time `json:"from"`
+	ToTime         *time.Time `json:"to"`
+	PickupLocation string     `json:"pickup_location"`
+	ReturnLocation string     `json:"return_location"`
 }
 
 type createLeaseResponse struct {
-	UserID  uint64 `json:"user_id"`
-	CarID   uint64 `json:"car_id"`
-	LeaseID uint64 `json:"lease_id"`
-	From    uint64 `json:"from_day"`
-	To      uint64 `json:"to_day"`
+	UserID          uint64 `json:"user_id"`
+	CarID           uint64 `json:"car_id"`
+	LeaseID         uint64 `json:"lease_id"`
+	From            uint64 `json:"from_day"`
+	To              uint64 `json:"to_day"`
+	FromMinute      uint64 `json:"from_minute"`
+	ToMinute        uint64 `json:"to_minute"`
+	PickupLocation  string `json:"pickup_location,omitempty"`
+	ReturnLocation  string `json:"return_location,omitempty"`
+	OneWaySurcharge uint64 `json:"one_way_surcharge"`
 }
 
 type CheckCarRequest struct {
-	CarID uint64 `json:"car_id"`
-	From  uint64 `json:"from_day"`
-	To    uint64 `json:"to_day"`
+	CarID          uint64     `json:"car_id"`
+	From           uint64     `json:"from_day"`
+	To             uint64     `json:"to_day"`
+	FromMinute     uint64     `json:"from_minute"`
+	ToMinute       uint64     `json:"to_minute"`
+	FromTime       *time.Time `json:"from"`
+	ToTime         *time.Time `json:"to"`
+	PickupLocation string     `json:"pickup_location"`
+	ReturnLocation string     `json:"return_location"`
+}
+
+type carLeasesRequest struct {
+	CarID      uint64 `json:"car_id"`
+	FromMinute uint64 `json:"from_minute"`
+}
+
+type carLeasesResponse struct {
+	Leases []Lease `json:"leases"`
+}
+
+type setTurnaroundRequest struct {
+	CarID   uint64 `json:"car_id"`
+	Minutes uint64 `json:"minutes"`
+}
+
+// requestInterval returns the requested minutes. RFC 3339 times take
+// precedence, then minute fields; otherwise the legacy inclusive day range is
+// used. A request with only one of from and to gets an empty interval, which
+// is rejected as invalid.
+func requestInterval(fromDay, toDay, fromMinute, toMinute uint64, from, to *time.Time) interval.Interval {
+	if from != nil || to != nil {
+		if from == nil || to == nil {
+			return interval.Interval{}
+		}
+		return interval.FromTimes(*from, *to)
+	}
+	if toMinute != 0 {
+		return interval.Interval{From: fromMinute, To: toMinute}
+	}
+	return interval.FromDays(fromDay, toDay)
+}
+
+// isBadRequest reports whether err was caused by the request rather than the service.
+func isBadRequest(err error) bool {
+	switch err {
+	case interval.ErrInvalid, unknownCar, carRetired, unknownLocation, locationClosed, carInMaintenance:
+		return true
+	}
+	return false
+}
+
+// errorStatus is the HTTP status answering a request the lease service failed
+// with err. The gRPC API maps it on to a status code.
+func errorStatus(err error) int {
+	if err == leaseAlreadyExists || isBadRequest(err) {
+		return http.StatusBadRequest
+	}
+	if err == leaseNotFound {
+		return http.StatusNotFound
+	}
+	if _, ok := err.(*eligibility.Ineligible); ok {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
 }
 
 type CheckCarResponse struct {
 	IsFree bool `json:"is_free"`
 }
 
+// ListenAndServe serves HTTPS if SetTLS was given a config, HTTP otherwise.
 func (c *HttpServer) ListenAndServe() error {
+	if c.server.TLSConfig != nil {
+		return c.server.ListenAndServeTLS("", "")
+	}
 	return c.server.ListenAndServe()
 }
 
+// authUser authenticates a user request with checkUser. It returns the user
+// and the credential to look the driver up with, or writes the error response
+// and returns false.
+func (c *HttpServer) authUser(rw http.ResponseWriter, r *http.Request, scope string) (UserAuthObject, string, bool) {
+	userAuth, credential, err := c.checkUser(r, scope)
+	if exceeded, ok := err.(*ratelimit.Exceeded); ok {
+		ratelimit.Reject(rw, exceeded.Wait)
+		return UserAuthObject{}, "", false
+	}
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), apikey.Status(err))
+		return UserAuthObject{}, "", false
+	}
+	return userAuth, credential, true
+}
+
+// checkUser authenticates a user request by its X-Auth access token or, in its
+// place, an API key in X-API-Key, which must have scope and is held to its own
+// rate limit. It returns the user and the credential to look the driver up
+// with. Errors are answered with apikey.Status, except *ratelimit.Exceeded.
+func (c *HttpServer) checkUser(r *http.Request, scope string) (UserAuthObject, string, error) {
+	key := r.Header.Get(apikey.Header)
+	if key == "" {
+		token := r.Header.Get("X-Auth")
+		userAuth, err := c.checkAuth(token)
+		if err != nil {
+			return UserAuthObject{}, "", err
+		}
+		return userAuth, token, nil
+	}
+
+	if c.keyVerifier == nil {
+		return UserAuthObject{}, "", errors.New("api keys are not accepted without the auth service")
+	}
+	info, err := c.keyVerifier.CheckAPIKey(key)
+	if err == nil && !info.HasScope(scope) {
+		err = &apikey.InsufficientScope{Scope: scope}
+	}
+	if err != nil {
+		return UserAuthObject{}, "", err
+	}
+	if c.limiter != nil && info.RateLimit != "" {
+		limit, err := ratelimit.ParseLimit(info.RateLimit)
+		if err != nil {
+			c.logger.Errorf("api key %s rate limit error: %v", info.KeyID, err)
+		} else if wait := c.limiter.Take("apikey:"+info.KeyID, limit); wait > 0 {
+			return UserAuthObject{}, "", &ratelimit.Exceeded{Wait: wait}
+		}
+	}
+	return UserAuthObject{info.Username, info.UserID}, key, nil
+}
+
 type UserAuthObject struct {
 	Username string
 	UserID   uint64
@@ -73,51 +225,105 @@ func (c *HttpServer) Close() error {
 	return c.server.Close()
 }
 
+// Shutdown stops accepting connections and waits for running requests until ctx is done.
+func (c *HttpServer) Shutdown(ctx context.Context) error {
+	return c.server.Shutdown(ctx)
+}
+
+func (c *HttpServer) SetTimeouts(read, write, idle time.Duration) {
+	c.server.ReadTimeout = read
+	c.server.WriteTimeout = write
+	c.server.IdleTimeout = idle
+}
+
+// SetTLS serves HTTPS with config. A nil config keeps plain HTTP.
+func (c *HttpServer) SetTLS(config *tls.Config) {
+	c.server.TLSConfig = config
+}
+
+// TokenVerifier asks the auth service whether a token was revoked.
+type TokenVerifier interface {
+	VerifyToken(token string) error
+}
+
+// SetTokenVerifier makes checkAuth reject tokens the verifier reports as
+// revoked; without one any correctly signed token is accepted.
+func (c *HttpServer) SetTokenVerifier(verifier TokenVerifier) {
+	c.tokenVerifier = verifier
+}
+
+// KeyVerifier asks the auth service whether an API key is valid and whom it
+// acts for.
+type KeyVerifier interface {
+	CheckAPIKey(key string) (apikey.Info, error)
+}
+
+// SetKeyVerifier makes the user endpoints accept API keys in X-API-Key in
+// place of an access token; without one API keys are rejected.
+func (c *HttpServer) SetKeyVerifier(verifier KeyVerifier) {
+	c.keyVerifier = verifier
+}
+
+// SetAdminToken enables the /admin endpoints for requests carrying token in
+// the X-Admin-Token header. The auth service uses them to export and erase
+// the data of a user.
+func (c *HttpServer) SetAdminToken(token []byte) {
+	c.adminToken = token
+}
+
+// SetRateLimit puts the limiter in front of every route, counting requests per
+// user_id or client IP. Requests with an API key are also held to the limit
+// of the key.
+func (c *HttpServer) SetRateLimit(limiter *ratelimit.Limiter) {
+	c.limiter = limiter
+	c.server.Handler = limiter.Handler(c.server.Handler, ratelimit.UserOrIP(c.jwtSigningKey))
+}
+
 func (c *HttpServer) createLease(rw http.ResponseWriter, r *http.Request) {
 	c.logger.Infof("got request for create lease")
-	token := r.Header.Get("X-Auth")
-	userAuth, err := c.checkAuth(token)
-	if err != nil {
-		c.logger.Errorf("auth error: %v", err)
-		http.Error(rw, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		rw.WriteHeader(500)
-		c.logger.Errorf("create lease error: error reading body %v", err)
+	userAuth, token, ok := c.authUser(rw, r, servicetoken.ScopeLeaseWrite)
+	if !ok {
 		return
 	}
 
 	var createLeaseRequest createLeaseRequest
-	err = json.Unmarshal(body, &createLeaseRequest)
+	err := rest.Decode(r, &createLeaseRequest)
 	if err != nil {
-		rw.WriteHeader(500)
+		rw.WriteHeader(400)
 		c.logger.Errorf("create lease error: error unmarshalling request body %v", err)
 		return
 	}
 
 	c.logger.Infof("create lease request %+v", createLeaseRequest)
 
-	lease, err := c.leaseService.createLease(userAuth.UserID, createLeaseRequest.CarID, createLeaseRequest.From, createLeaseRequest.To)
+	span := requestInterval(createLeaseRequest.From, createLeaseRequest.To, createLeaseRequest.FromMinute, createLeaseRequest.ToMinute, createLeaseRequest.FromTime, createLeaseRequest.ToTime)
+	route := Route{Pickup: createLeaseRequest.PickupLocation, Return: createLeaseRequest.ReturnLocation}
+	lease, err := c.leaseService.createLease(userAuth.UserID, token, createLeaseRequest.CarID, span, route)
 	if err != nil {
 		if err == leaseAlreadyExists {
 			c.logger.Errorf("create lease error: lease with car_id %v already exists", createLeaseRequest.CarID)
-			http.Error(rw, "lease already exists", 400)
+		}
+		if status := errorStatus(err); status != 500 {
+			http.Error(rw, err.Error(), status)
 			return
 		}
 
+		c.logger.Errorf("create lease error: %v", err)
 		rw.WriteHeader(500)
 		return
 	}
 
 	createLeaseResponse := createLeaseResponse{
-		UserID:  lease.UserID,
-		CarID:   lease.CarID,
-		LeaseID: lease.LeaseID,
-		From:    lease.From,
-		To:      lease.To,
+		UserID:          lease.UserID,
+		CarID:           lease.CarID,
+		LeaseID:         lease.LeaseID,
+		From:            lease.From,
+		To:              lease.To,
+		FromMinute:      lease.FromMinute,
+		ToMinute:        lease.ToMinute,
+		PickupLocation:  lease.PickupLocation,
+		ReturnLocation:  lease.ReturnLocation,
+		OneWaySurcharge: lease.OneWaySurcharge,
 	}
 
 	responseBytes, err := json.Marshal(&createLeaseResponse)
@@ -132,10 +338,50 @@ func (c *HttpServer) createLease(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type leaseIDRequest struct {
+	LeaseID uint64 `json:"lease_id"`
+}
+
+// getLease shows a lease of the authenticated user.
+func (c *HttpServer) getLease(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for get lease")
+	userAuth, _, ok := c.authUser(rw, r, servicetoken.ScopeLeaseRead)
+	if !ok {
+		return
+	}
+
+	var leaseIDRequest leaseIDRequest
+	err := rest.Decode(r, &leaseIDRequest)
+	if err != nil {
+		rw.WriteHeader(400)
+		return
+	}
+
+	lease, err := c.leaseService.userLease(userAuth.UserID, leaseIDRequest.LeaseID)
+	if err == leaseNotFound {
+		http.Error(rw, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.logger.Errorf("get lease error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&lease)
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("get lease error: error writing response %v", err)
+	}
+}
+
 func (c *HttpServer) checkAuth(token string) (UserAuthObject, error) {
-	tokenObj, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		return c.jwtSigningKey, nil
-	})
+	tokenObj, err := jwt.Parse(token, usertoken.Keyfunc(c.jwtSigningKey))
 	if err != nil {
 		return UserAuthObject{}, fmt.Errorf("error casting user id from token: %w", err)
 	}
@@ -145,8 +391,21 @@ func (c *HttpServer) checkAuth(token string) (UserAuthObject, error) {
 		return UserAuthObject{}, fmt.Errorf("token %s verification error: error casting claims to map claims", token)
 	}
 	c.logger.Infof("claims %v", claims)
-	username := claims["username"].(string)
-	userID := claims["user_id"].(float64)
+	username, ok := claims["username"].(string)
+	if !ok {
+		return UserAuthObject{}, errors.New("token has no username")
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return UserAuthObject{}, errors.New("token has no user_id")
+	}
+
+	if c.tokenVerifier != nil {
+		err = c.tokenVerifier.VerifyToken(token)
+		if err != nil {
+			return UserAuthObject{}, err
+		}
+	}
 
 	return UserAuthObject{
 		username,
@@ -157,22 +416,26 @@ func (c *HttpServer) checkAuth(token string) (UserAuthObject, error) {
 func (c *HttpServer) checkCar(rw http.ResponseWriter, r *http.Request) {
 	c.logger.Infof("got request for check car")
 
-	body, err := ioutil.ReadAll(r.Body)
+	var checkCarRequest CheckCarRequest
+	err := rest.Decode(r, &checkCarRequest)
 	if err != nil {
-		rw.WriteHeader(500)
-		c.logger.Errorf("check lease error: error reading body %v", err)
+		rw.WriteHeader(400)
 		return
 	}
 
-	var checkCarRequest CheckCarRequest
-	err = json.Unmarshal(body, &checkCarRequest)
+	span := requestInterval(checkCarRequest.From, checkCarRequest.To, checkCarRequest.FromMinute, checkCarRequest.ToMinute, checkCarRequest.FromTime, checkCarRequest.ToTime)
+	route := Route{Pickup: checkCarRequest.PickupLocation, Return: checkCarRequest.ReturnLocation}
+	isFree, err := c.leaseService.IsCarFree(checkCarRequest.CarID, span, route)
+	if isBadRequest(err) {
+		http.Error(rw, err.Error(), 400)
+		return
+	}
 	if err != nil {
-		rw.WriteHeader(400)
+		c.logger.Errorf("check lease error: %v", err)
+		rw.WriteHeader(500)
 		return
 	}
 
-	isFree := c.leaseService.IsCarFree(checkCarRequest.CarID, checkCarRequest.From, checkCarRequest.To)
-
 	checkCarResponse := CheckCarResponse{
 		IsFree: isFree,
 	}
@@ -188,3 +451,163 @@ func (c *HttpServer) checkCar(rw http.ResponseWriter, r *http.Request) {
 		c.logger.Errorf("check book error: error writing response %v", err)
 	}
 }
+
+// carLeases lists the leases of a car that end after from_minute. The fleet
+// service uses it to report conflicts with maintenance windows.
+func (c *HttpServer) carLeases(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for car leases")
+	_, err := c.checkService(r, servicetoken.ScopeLeaseRead)
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), servicetoken.Status(err))
+		return
+	}
+
+	var carLeasesRequest carLeasesRequest
+	err = rest.Decode(r, &carLeasesRequest)
+	if err != nil {
+		rw.WriteHeader(400)
+		return
+	}
+
+	leases, err := c.leaseService.carLeases(carLeasesRequest.CarID, carLeasesRequest.FromMinute)
+	if err != nil {
+		c.logger.Errorf("car leases error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&carLeasesResponse{Leases: leases})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("car leases error: error writing response %v", err)
+	}
+}
+
+func (c *HttpServer) setTurnaround(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for set turnaround")
+	_, err := c.checkService(r, servicetoken.ScopeLeaseWrite)
+	if err != nil {
+		c.logger.Errorf("auth error: %v", err)
+		http.Error(rw, err.Error(), servicetoken.Status(err))
+		return
+	}
+
+	var setTurnaroundRequest setTurnaroundRequest
+	err = rest.Decode(r, &setTurnaroundRequest)
+	if err != nil {
+		rw.WriteHeader(400)
+		return
+	}
+
+	err = c.leaseService.setTurnaround(setTurnaroundRequest.CarID, setTurnaroundRequest.Minutes)
+	if isBadRequest(err) {
+		http.Error(rw, err.Error(), 400)
+		return
+	}
+	if err != nil {
+		c.logger.Errorf("set turnaround error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+}
+
+func (c *HttpServer) checkAdmin(r *http.Request) bool {
+	if len(c.adminToken) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), c.adminToken) == 1
+}
+
+// checkService authenticates a call from another service by a service token
+// granting scope. With mutual TLS the caller must also present a certificate
+// issued to the client the token names.
+func (c *HttpServer) checkService(r *http.Request, scope string) (servicetoken.Claims, error) {
+	mutual := c.server.TLSConfig != nil && c.server.TLSConfig.ClientCAs != nil
+	return servicetoken.Check(servicetoken.Key(c.jwtSigningKey), r, scope, mutual)
+}
+
+type userIDRequest struct {
+	UserID *uint64 `json:"user_id"`
+}
+
+type eraseUserResponse struct {
+	Erased int `json:"erased"`
+}
+
+// readUserID reads the user_id of an admin request, answering the request
+// itself if that fails.
+func (c *HttpServer) readUserID(rw http.ResponseWriter, r *http.Request, name string) (uint64, bool) {
+	if !c.checkAdmin(r) {
+		http.Error(rw, "wrong admin token", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	var userIDRequest userIDRequest
+	err := rest.Decode(r, &userIDRequest)
+	if err != nil || userIDRequest.UserID == nil {
+		http.Error(rw, "user_id is required", 400)
+		return 0, false
+	}
+	return *userIDRequest.UserID, true
+}
+
+// userLeases lists every lease of a user for a data export.
+func (c *HttpServer) userLeases(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for user leases")
+	userID, ok := c.readUserID(rw, r, "user leases")
+	if !ok {
+		return
+	}
+
+	leases, err := c.leaseService.userLeases(userID)
+	if err != nil {
+		c.logger.Errorf("user leases error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&carLeasesResponse{Leases: leases})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("user leases error: error writing response %v", err)
+	}
+}
+
+// eraseUser detaches the leases of a user from them, keeping the leases.
+func (c *HttpServer) eraseUser(rw http.ResponseWriter, r *http.Request) {
+	c.logger.Infof("got request for erase user")
+	userID, ok := c.readUserID(rw, r, "erase user")
+	if !ok {
+		return
+	}
+
+	erased, err := c.leaseService.eraseUser(userID)
+	if err != nil {
+		c.logger.Errorf("erase user error: %v", err)
+		rw.WriteHeader(500)
+		return
+	}
+
+	responseBytes, err := json.Marshal(&eraseUserResponse{Erased: erased})
+	if err != nil {
+		rw.WriteHeader(500)
+		return
+	}
+	rw.WriteHeader(200)
+	_, err = rw.Write(responseBytes)
+	if err != nil {
+		c.logger.Errorf("erase user error: error writing response %v", err)
+	}
+}
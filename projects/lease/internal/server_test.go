@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"distributed-rental/pkg/openapi/openapitest"
+	lease "distributed-rental/projects/lease/client"
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckAuth(t *testing.T) {
+	jwtSecret := []byte("secret")
+	server := NewHttpServer("", NewLeaseService(NewMemoryLeaseRepository(), zap.NewNop().Sugar(), 0, 0, nil), zap.NewNop().Sugar(), jwtSecret)
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	userAuth, err := server.checkAuth(sign(jwt.MapClaims{"username": "alice", "user_id": 7}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userAuth.Username != "alice" || userAuth.UserID != 7 {
+		t.Fatalf("got %+v", userAuth)
+	}
+	for name, claims := range map[string]jwt.MapClaims{
+		"no username":     {"user_id": 7},
+		"no user_id":      {"username": "alice"},
+		"username number": {"username": 1, "user_id": 7},
+		"user_id string":  {"username": "alice", "user_id": "7"},
+	} {
+		_, err := server.checkAuth(sign(claims))
+		if err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+// TestOpenAPI fails when openapi.json was not regenerated after a change of
+// the v1 routes, or when the router does not serve them as documented.
+func TestOpenAPI(t *testing.T) {
+	openapitest.CheckFile(t, "../openapi.json", OpenAPI())
+	server := NewHttpServer("", NewLeaseService(NewMemoryLeaseRepository(), zap.NewNop().Sugar(), 0, 0, nil), zap.NewNop().Sugar(), []byte("secret"))
+	openapitest.CheckRoutes(t, server.server.Handler.(*http.ServeMux), OpenAPI())
+}
+
+// TestEraseUser erases user 7 through the client the auth service runs
+// erasures with.
+func TestEraseUser(t *testing.T) {
+	repository := NewMemoryLeaseRepository()
+	for _, leaseDBModel := range []LeaseDBModel{
+		testLease(1, 7, 1, 100, 200),
+		testLease(2, 8, 1, 300, 400),
+		testLease(3, 7, 2, 100, 200),
+	} {
+		create(t, repository, leaseDBModel)
+	}
+	server := NewHttpServer("", NewLeaseService(repository, zap.NewNop().Sugar(), 0, 0, nil), zap.NewNop().Sugar(), []byte("secret"))
+	server.SetAdminToken([]byte("admin"))
+	httpServer := httptest.NewServer(server.server.Handler)
+	defer httpServer.Close()
+	client := lease.New(strings.TrimPrefix(httpServer.URL, "http://"))
+
+	if _, err := client.EraseUser([]byte("guess"), 7); err == nil {
+		t.Fatal("erased with a wrong admin token")
+	}
+	erased, err := client.EraseUser([]byte("admin"), 7)
+	if err != nil || erased != 2 {
+		t.Fatalf("erase: got %d, %v, want 2", erased, err)
+	}
+	leases, err := repository.UserLeases(erasedUserID)
+	if err != nil || len(leases) != 2 || leases[0] != testLease(1, erasedUserID, 1, 100, 200) || leases[1] != testLease(3, erasedUserID, 2, 100, 200) {
+		t.Fatalf("leases of the erased user: got %+v, %v", leases, err)
+	}
+	leases, err = repository.UserLeases(8)
+	if err != nil || len(leases) != 1 {
+		t.Fatalf("leases of user 8: got %+v, %v", leases, err)
+	}
+	erased, err = client.EraseUser([]byte("admin"), 7)
+	if err != nil || erased != 0 {
+		t.Fatalf("erase again: got %d, %v", erased, err)
+	}
+}
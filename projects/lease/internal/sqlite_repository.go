@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"database/sql"
+	"distributed-rental/pkg/interval"
+	"errors"
+	"math"
+	_ "modernc.org/sqlite"
+)
+
+const leaseSchema = `
+CREATE TABLE IF NOT EXISTS leases (
+	lease_id        INTEGER PRIMARY KEY,
+	car_id            INTEGER NOT NULL,
+	user_id           INTEGER NOT NULL,
+	from_day          INTEGER NOT NULL,
+	to_day            INTEGER NOT NULL,
+	from_minute       INTEGER NOT NULL,
+	to_minute         INTEGER NOT NULL,
+	pickup_location   TEXT NOT NULL DEFAULT '',
+	return_location   TEXT NOT NULL DEFAULT '',
+	one_way_surcharge INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS leases_car_id ON leases (car_id);
+CREATE INDEX IF NOT EXISTS leases_user_id ON leases (user_id);
+CREATE TABLE IF NOT EXISTS turnarounds (
+	car_id  INTEGER PRIMARY KEY,
+	minutes INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS sequences (
+	name  TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+`
+
+var errIDRange = errors.New("value does not fit into an SQLite integer")
+
+// SQLiteLeaseRepository stores leases in an embedded SQLite database.
+//
+// SQLite stores integers as int64 and database/sql rejects larger uint64
+// arguments, so ids above math.MaxInt64 are never stored: lookups by them find
+// nothing, and writes fail with unknownCar for such cars, interval.ErrInvalid
+// for such minutes and errIDRange for other values.
+type SQLiteLeaseRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteLeaseRepository opens (and if needed creates) the database at path.
+func NewSQLiteLeaseRepository(path string) (*SQLiteLeaseRepository, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time; a single connection turns concurrent
+	// CreateLease calls into a queue instead of SQLITE_BUSY errors.
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(leaseSchema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteLeaseRepository{db: db}, nil
+}
+
+func (c *SQLiteLeaseRepository) NextLeaseID() (uint64, error) {
+	var leaseID uint64
+	err := c.db.QueryRow(`INSERT INTO sequences (name, value) VALUES ('lease_id', 1)
+		ON CONFLICT (name) DO UPDATE SET value = value + 1
+		RETURNING value`).Scan(&leaseID)
+	return leaseID, err
+}
+
+func (c *SQLiteLeaseRepository) CarLeases(carID uint64) ([]LeaseDBModel, error) {
+	if carID > math.MaxInt64 {
+		return []LeaseDBModel{}, nil
+	}
+	return carLeasesSQL(c.db, carID)
+}
+
+func (c *SQLiteLeaseRepository) UserLeases(userID uint64) ([]LeaseDBModel, error) {
+	if userID > math.MaxInt64 {
+		return []LeaseDBModel{}, nil
+	}
+	return leasesSQL(c.db, `WHERE user_id = ? ORDER BY lease_id`, userID)
+}
+
+func (c *SQLiteLeaseRepository) ReassignUser(userID uint64, newUserID uint64) (int, error) {
+	if newUserID > math.MaxInt64 {
+		return 0, errIDRange
+	}
+	if userID > math.MaxInt64 {
+		return 0, nil
+	}
+	result, err := c.db.Exec(`UPDATE leases SET user_id = ? WHERE user_id = ?`, newUserID, userID)
+	if err != nil {
+		return 0, err
+	}
+	moved, err := result.RowsAffected()
+	return int(moved), err
+}
+
+func (c *SQLiteLeaseRepository) CreateLease(lease LeaseDBModel, check func(existing []LeaseDBModel) error) error {
+	if lease.CarID > math.MaxInt64 {
+		return unknownCar
+	}
+	if lease.ToMinute > math.MaxInt64 {
+		return interval.ErrInvalid
+	}
+	if lease.UserID > math.MaxInt64 || lease.LeaseID > math.MaxInt64 {
+		return errIDRange
+	}
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	existing, err := carLeasesSQL(tx, lease.CarID)
+	if err != nil {
+		return err
+	}
+	err = check(existing)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO leases
+		(lease_id, car_id, user_id, from_day, to_day, from_minute, to_minute, pickup_location, return_location, one_way_surcharge)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		lease.LeaseID, lease.CarID, lease.UserID, lease.From, lease.To, lease.FromMinute, lease.ToMinute,
+		lease.PickupLocation, lease.ReturnLocation, lease.OneWaySurcharge)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (c *SQLiteLeaseRepository) Turnaround(carID uint64) (uint64, bool, error) {
+	if carID > math.MaxInt64 {
+		return 0, false, nil
+	}
+	var minutes uint64
+	err := c.db.QueryRow(`SELECT minutes FROM turnarounds WHERE car_id = ?`, carID).Scan(&minutes)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return minutes, true, nil
+}
+
+func (c *SQLiteLeaseRepository) SetTurnaround(carID uint64, minutes uint64) error {
+	if carID > math.MaxInt64 {
+		return unknownCar
+	}
+	if minutes > math.MaxInt64 {
+		return errIDRange
+	}
+	_, err := c.db.Exec(`INSERT INTO turnarounds (car_id, minutes) VALUES (?, ?)
+		ON CONFLICT (car_id) DO UPDATE SET minutes = excluded.minutes`, carID, minutes)
+	return err
+}
+
+func (c *SQLiteLeaseRepository) Close() error {
+	return c.db.Close()
+}
+
+type sqlQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func carLeasesSQL(q sqlQuerier, carID uint64) ([]LeaseDBModel, error) {
+	return leasesSQL(q, `WHERE car_id = ? ORDER BY from_minute`, carID)
+}
+
+// leasesSQL returns the leases selected by where.
+func leasesSQL(q sqlQuerier, where string, args ...interface{}) ([]LeaseDBModel, error) {
+	rows, err := q.Query(`SELECT lease_id, car_id, user_id, from_day, to_day, from_minute, to_minute,
+		pickup_location, return_location, one_way_surcharge
+		FROM leases `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	leases := []LeaseDBModel{}
+	for rows.Next() {
+		lease := LeaseDBModel{}
+		err = rows.Scan(&lease.LeaseID, &lease.CarID, &lease.UserID, &lease.From, &lease.To,
+			&lease.FromMinute, &lease.ToMinute, &lease.PickupLocation, &lease.ReturnLocation, &lease.OneWaySurcharge)
+		if err != nil {
+			return nil, err
+		}
+		leases = append(leases, lease)
+	}
+	return leases, rows.Err()
+}
@@ -0,0 +1,46 @@
+package internal
+
+import "sync"
+
+// carWatchers wakes the watchers of a car when its leases or turnaround
+// change in this instance. The zero value is ready to use.
+type carWatchers struct {
+	mu       sync.Mutex
+	watchers map[uint64]map[chan struct{}]struct{}
+}
+
+// watch returns a channel that receives after every change of the car, with
+// changes coming faster than they are read merged into one, and the function
+// that stops the watch.
+func (c *carWatchers) watch(carID uint64) (<-chan struct{}, func()) {
+	changed := make(chan struct{}, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.watchers == nil {
+		c.watchers = map[uint64]map[chan struct{}]struct{}{}
+	}
+	if c.watchers[carID] == nil {
+		c.watchers[carID] = map[chan struct{}]struct{}{}
+	}
+	c.watchers[carID][changed] = struct{}{}
+
+	return changed, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.watchers[carID], changed)
+		if len(c.watchers[carID]) == 0 {
+			delete(c.watchers, carID)
+		}
+	}
+}
+
+func (c *carWatchers) notify(carID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for changed := range c.watchers[carID] {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
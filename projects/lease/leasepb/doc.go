@@ -0,0 +1,6 @@
+// Package leasepb holds the messages and the gRPC client and server stubs of
+// the lease API, generated from lease.proto. Other services call the
+// lease service over gRPC with NewLeaseServiceClient.
+package leasepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative lease.proto
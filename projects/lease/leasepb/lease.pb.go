@@ -0,0 +1,929 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.29.3
+// source: lease.proto
+
+package leasepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Lease struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	CarId           uint64                 `protobuf:"varint,1,opt,name=car_id,json=carId,proto3" json:"car_id,omitempty"`
+	UserId          uint64                 `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	LeaseId         uint64                 `protobuf:"varint,3,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`
+	FromDay         uint64                 `protobuf:"varint,4,opt,name=from_day,json=fromDay,proto3" json:"from_day,omitempty"`
+	ToDay           uint64                 `protobuf:"varint,5,opt,name=to_day,json=toDay,proto3" json:"to_day,omitempty"`
+	FromMinute      uint64                 `protobuf:"varint,6,opt,name=from_minute,json=fromMinute,proto3" json:"from_minute,omitempty"`
+	ToMinute        uint64                 `protobuf:"varint,7,opt,name=to_minute,json=toMinute,proto3" json:"to_minute,omitempty"`
+	PickupLocation  string                 `protobuf:"bytes,8,opt,name=pickup_location,json=pickupLocation,proto3" json:"pickup_location,omitempty"`
+	ReturnLocation  string                 `protobuf:"bytes,9,opt,name=return_location,json=returnLocation,proto3" json:"return_location,omitempty"`
+	OneWaySurcharge uint64                 `protobuf:"varint,10,opt,name=one_way_surcharge,json=oneWaySurcharge,proto3" json:"one_way_surcharge,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Lease) Reset() {
+	*x = Lease{}
+	mi := &file_lease_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Lease) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Lease) ProtoMessage() {}
+
+func (x *Lease) ProtoReflect() protoreflect.Message {
+	mi := &file_lease_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Lease.ProtoReflect.Descriptor instead.
+func (*Lease) Descriptor() ([]byte, []int) {
+	return file_lease_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Lease) GetCarId() uint64 {
+	if x != nil {
+		return x.CarId
+	}
+	return 0
+}
+
+func (x *Lease) GetUserId() uint64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *Lease) GetLeaseId() uint64 {
+	if x != nil {
+		return x.LeaseId
+	}
+	return 0
+}
+
+func (x *Lease) GetFromDay() uint64 {
+	if x != nil {
+		return x.FromDay
+	}
+	return 0
+}
+
+func (x *Lease) GetToDay() uint64 {
+	if x != nil {
+		return x.ToDay
+	}
+	return 0
+}
+
+func (x *Lease) GetFromMinute() uint64 {
+	if x != nil {
+		return x.FromMinute
+	}
+	return 0
+}
+
+func (x *Lease) GetToMinute() uint64 {
+	if x != nil {
+		return x.ToMinute
+	}
+	return 0
+}
+
+func (x *Lease) GetPickupLocation() string {
+	if x != nil {
+		return x.PickupLocation
+	}
+	return ""
+}
+
+func (x *Lease) GetReturnLocation() string {
+	if x != nil {
+		return x.ReturnLocation
+	}
+	return ""
+}
+
+func (x *Lease) GetOneWaySurcharge() uint64 {
+	if x != nil {
+		return x.OneWaySurcharge
+	}
+	return 0
+}
+
+// CreateLeaseRequest names the interval like the REST API: from and to take
+// precedence over the minute fields, which take precedence over the days.
+type CreateLeaseRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	CarId          uint64                 `protobuf:"varint,1,opt,name=car_id,json=carId,proto3" json:"car_id,omitempty"`
+	FromDay        uint64                 `protobuf:"varint,2,opt,name=from_day,json=fromDay,proto3" json:"from_day,omitempty"`
+	ToDay          uint64                 `protobuf:"varint,3,opt,name=to_day,json=toDay,proto3" json:"to_day,omitempty"`
+	FromMinute     uint64                 `protobuf:"varint,4,opt,name=from_minute,json=fromMinute,proto3" json:"from_minute,omitempty"`
+	ToMinute       uint64                 `protobuf:"varint,5,opt,name=to_minute,json=toMinute,proto3" json:"to_minute,omitempty"`
+	From           *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=from,proto3" json:"from,omitempty"`
+	To             *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=to,proto3" json:"to,omitempty"`
+	PickupLocation string                 `protobuf:"bytes,8,opt,name=pickup_location,json=pickupLocation,proto3" json:"pickup_location,omitempty"`
+	ReturnLocation string                 `protobuf:"bytes,9,opt,name=return_location,json=returnLocation,proto3" json:"return_location,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *CreateLeaseRequest) Reset() {
+	*x = CreateLeaseRequest{}
+	mi := &file_lease_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateLeaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateLeaseRequest) ProtoMessage() {}
+
+func (x *CreateLeaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lease_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateLeaseRequest.ProtoReflect.Descriptor instead.
+func (*CreateLeaseRequest) Descriptor() ([]byte, []int) {
+	return file_lease_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CreateLeaseRequest) GetCarId() uint64 {
+	if x != nil {
+		return x.CarId
+	}
+	return 0
+}
+
+func (x *CreateLeaseRequest) GetFromDay() uint64 {
+	if x != nil {
+		return x.FromDay
+	}
+	return 0
+}
+
+func (x *CreateLeaseRequest) GetToDay() uint64 {
+	if x != nil {
+		return x.ToDay
+	}
+	return 0
+}
+
+func (x *CreateLeaseRequest) GetFromMinute() uint64 {
+	if x != nil {
+		return x.FromMinute
+	}
+	return 0
+}
+
+func (x *CreateLeaseRequest) GetToMinute() uint64 {
+	if x != nil {
+		return x.ToMinute
+	}
+	return 0
+}
+
+func (x *CreateLeaseRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *CreateLeaseRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+func (x *CreateLeaseRequest) GetPickupLocation() string {
+	if x != nil {
+		return x.PickupLocation
+	}
+	return ""
+}
+
+func (x *CreateLeaseRequest) GetReturnLocation() string {
+	if x != nil {
+		return x.ReturnLocation
+	}
+	return ""
+}
+
+type GetLeaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	LeaseId       uint64                 `protobuf:"varint,1,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLeaseRequest) Reset() {
+	*x = GetLeaseRequest{}
+	mi := &file_lease_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLeaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLeaseRequest) ProtoMessage() {}
+
+func (x *GetLeaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lease_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLeaseRequest.ProtoReflect.Descriptor instead.
+func (*GetLeaseRequest) Descriptor() ([]byte, []int) {
+	return file_lease_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetLeaseRequest) GetLeaseId() uint64 {
+	if x != nil {
+		return x.LeaseId
+	}
+	return 0
+}
+
+// CheckCarRequest names the interval like CreateLeaseRequest.
+type CheckCarRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	CarId          uint64                 `protobuf:"varint,1,opt,name=car_id,json=carId,proto3" json:"car_id,omitempty"`
+	FromDay        uint64                 `protobuf:"varint,2,opt,name=from_day,json=fromDay,proto3" json:"from_day,omitempty"`
+	ToDay          uint64                 `protobuf:"varint,3,opt,name=to_day,json=toDay,proto3" json:"to_day,omitempty"`
+	FromMinute     uint64                 `protobuf:"varint,4,opt,name=from_minute,json=fromMinute,proto3" json:"from_minute,omitempty"`
+	ToMinute       uint64                 `protobuf:"varint,5,opt,name=to_minute,json=toMinute,proto3" json:"to_minute,omitempty"`
+	From           *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=from,proto3" json:"from,omitempty"`
+	To             *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=to,proto3" json:"to,omitempty"`
+	PickupLocation string                 `protobuf:"bytes,8,opt,name=pickup_location,json=pickupLocation,proto3" json:"pickup_location,omitempty"`
+	ReturnLocation string                 `protobuf:"bytes,9,opt,name=return_location,json=returnLocation,proto3" json:"return_location,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *CheckCarRequest) Reset() {
+	*x = CheckCarRequest{}
+	mi := &file_lease_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckCarRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckCarRequest) ProtoMessage() {}
+
+func (x *CheckCarRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lease_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckCarRequest.ProtoReflect.Descriptor instead.
+func (*CheckCarRequest) Descriptor() ([]byte, []int) {
+	return file_lease_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CheckCarRequest) GetCarId() uint64 {
+	if x != nil {
+		return x.CarId
+	}
+	return 0
+}
+
+func (x *CheckCarRequest) GetFromDay() uint64 {
+	if x != nil {
+		return x.FromDay
+	}
+	return 0
+}
+
+func (x *CheckCarRequest) GetToDay() uint64 {
+	if x != nil {
+		return x.ToDay
+	}
+	return 0
+}
+
+func (x *CheckCarRequest) GetFromMinute() uint64 {
+	if x != nil {
+		return x.FromMinute
+	}
+	return 0
+}
+
+func (x *CheckCarRequest) GetToMinute() uint64 {
+	if x != nil {
+		return x.ToMinute
+	}
+	return 0
+}
+
+func (x *CheckCarRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *CheckCarRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+func (x *CheckCarRequest) GetPickupLocation() string {
+	if x != nil {
+		return x.PickupLocation
+	}
+	return ""
+}
+
+func (x *CheckCarRequest) GetReturnLocation() string {
+	if x != nil {
+		return x.ReturnLocation
+	}
+	return ""
+}
+
+type CheckCarResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IsFree        bool                   `protobuf:"varint,1,opt,name=is_free,json=isFree,proto3" json:"is_free,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckCarResponse) Reset() {
+	*x = CheckCarResponse{}
+	mi := &file_lease_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckCarResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckCarResponse) ProtoMessage() {}
+
+func (x *CheckCarResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lease_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckCarResponse.ProtoReflect.Descriptor instead.
+func (*CheckCarResponse) Descriptor() ([]byte, []int) {
+	return file_lease_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CheckCarResponse) GetIsFree() bool {
+	if x != nil {
+		return x.IsFree
+	}
+	return false
+}
+
+type AvailabilityChange struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	IsFree bool                   `protobuf:"varint,1,opt,name=is_free,json=isFree,proto3" json:"is_free,omitempty"`
+	// time is when the service saw the change.
+	Time          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AvailabilityChange) Reset() {
+	*x = AvailabilityChange{}
+	mi := &file_lease_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AvailabilityChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AvailabilityChange) ProtoMessage() {}
+
+func (x *AvailabilityChange) ProtoReflect() protoreflect.Message {
+	mi := &file_lease_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AvailabilityChange.ProtoReflect.Descriptor instead.
+func (*AvailabilityChange) Descriptor() ([]byte, []int) {
+	return file_lease_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *AvailabilityChange) GetIsFree() bool {
+	if x != nil {
+		return x.IsFree
+	}
+	return false
+}
+
+func (x *AvailabilityChange) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+type CarLeasesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CarId         uint64                 `protobuf:"varint,1,opt,name=car_id,json=carId,proto3" json:"car_id,omitempty"`
+	FromMinute    uint64                 `protobuf:"varint,2,opt,name=from_minute,json=fromMinute,proto3" json:"from_minute,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CarLeasesRequest) Reset() {
+	*x = CarLeasesRequest{}
+	mi := &file_lease_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CarLeasesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CarLeasesRequest) ProtoMessage() {}
+
+func (x *CarLeasesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lease_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CarLeasesRequest.ProtoReflect.Descriptor instead.
+func (*CarLeasesRequest) Descriptor() ([]byte, []int) {
+	return file_lease_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CarLeasesRequest) GetCarId() uint64 {
+	if x != nil {
+		return x.CarId
+	}
+	return 0
+}
+
+func (x *CarLeasesRequest) GetFromMinute() uint64 {
+	if x != nil {
+		return x.FromMinute
+	}
+	return 0
+}
+
+type LeaseList struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Leases        []*Lease               `protobuf:"bytes,1,rep,name=leases,proto3" json:"leases,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LeaseList) Reset() {
+	*x = LeaseList{}
+	mi := &file_lease_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LeaseList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LeaseList) ProtoMessage() {}
+
+func (x *LeaseList) ProtoReflect() protoreflect.Message {
+	mi := &file_lease_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LeaseList.ProtoReflect.Descriptor instead.
+func (*LeaseList) Descriptor() ([]byte, []int) {
+	return file_lease_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *LeaseList) GetLeases() []*Lease {
+	if x != nil {
+		return x.Leases
+	}
+	return nil
+}
+
+type SetTurnaroundRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CarId         uint64                 `protobuf:"varint,1,opt,name=car_id,json=carId,proto3" json:"car_id,omitempty"`
+	Minutes       uint64                 `protobuf:"varint,2,opt,name=minutes,proto3" json:"minutes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetTurnaroundRequest) Reset() {
+	*x = SetTurnaroundRequest{}
+	mi := &file_lease_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetTurnaroundRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetTurnaroundRequest) ProtoMessage() {}
+
+func (x *SetTurnaroundRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lease_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetTurnaroundRequest.ProtoReflect.Descriptor instead.
+func (*SetTurnaroundRequest) Descriptor() ([]byte, []int) {
+	return file_lease_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SetTurnaroundRequest) GetCarId() uint64 {
+	if x != nil {
+		return x.CarId
+	}
+	return 0
+}
+
+func (x *SetTurnaroundRequest) GetMinutes() uint64 {
+	if x != nil {
+		return x.Minutes
+	}
+	return 0
+}
+
+type SetTurnaroundResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetTurnaroundResponse) Reset() {
+	*x = SetTurnaroundResponse{}
+	mi := &file_lease_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetTurnaroundResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetTurnaroundResponse) ProtoMessage() {}
+
+func (x *SetTurnaroundResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lease_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetTurnaroundResponse.ProtoReflect.Descriptor instead.
+func (*SetTurnaroundResponse) Descriptor() ([]byte, []int) {
+	return file_lease_proto_rawDescGZIP(), []int{9}
+}
+
+type UserRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// user_id is required.
+	UserId        *uint64 `protobuf:"varint,1,opt,name=user_id,json=userId,proto3,oneof" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserRequest) Reset() {
+	*x = UserRequest{}
+	mi := &file_lease_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserRequest) ProtoMessage() {}
+
+func (x *UserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lease_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserRequest.ProtoReflect.Descriptor instead.
+func (*UserRequest) Descriptor() ([]byte, []int) {
+	return file_lease_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *UserRequest) GetUserId() uint64 {
+	if x != nil && x.UserId != nil {
+		return *x.UserId
+	}
+	return 0
+}
+
+type EraseUserResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Erased        int64                  `protobuf:"varint,1,opt,name=erased,proto3" json:"erased,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EraseUserResponse) Reset() {
+	*x = EraseUserResponse{}
+	mi := &file_lease_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EraseUserResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EraseUserResponse) ProtoMessage() {}
+
+func (x *EraseUserResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lease_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EraseUserResponse.ProtoReflect.Descriptor instead.
+func (*EraseUserResponse) Descriptor() ([]byte, []int) {
+	return file_lease_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *EraseUserResponse) GetErased() int64 {
+	if x != nil {
+		return x.Erased
+	}
+	return 0
+}
+
+var File_lease_proto protoreflect.FileDescriptor
+
+const file_lease_proto_rawDesc = "" +
+	"\n" +
+	"\vlease.proto\x12\blease.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xc0\x02\n" +
+	"\x05Lease\x12\x15\n" +
+	"\x06car_id\x18\x01 \x01(\x04R\x05carId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\x04R\x06userId\x12\x19\n" +
+	"\blease_id\x18\x03 \x01(\x04R\aleaseId\x12\x19\n" +
+	"\bfrom_day\x18\x04 \x01(\x04R\afromDay\x12\x15\n" +
+	"\x06to_day\x18\x05 \x01(\x04R\x05toDay\x12\x1f\n" +
+	"\vfrom_minute\x18\x06 \x01(\x04R\n" +
+	"fromMinute\x12\x1b\n" +
+	"\tto_minute\x18\a \x01(\x04R\btoMinute\x12'\n" +
+	"\x0fpickup_location\x18\b \x01(\tR\x0epickupLocation\x12'\n" +
+	"\x0freturn_location\x18\t \x01(\tR\x0ereturnLocation\x12*\n" +
+	"\x11one_way_surcharge\x18\n" +
+	" \x01(\x04R\x0foneWaySurcharge\"\xc9\x02\n" +
+	"\x12CreateLeaseRequest\x12\x15\n" +
+	"\x06car_id\x18\x01 \x01(\x04R\x05carId\x12\x19\n" +
+	"\bfrom_day\x18\x02 \x01(\x04R\afromDay\x12\x15\n" +
+	"\x06to_day\x18\x03 \x01(\x04R\x05toDay\x12\x1f\n" +
+	"\vfrom_minute\x18\x04 \x01(\x04R\n" +
+	"fromMinute\x12\x1b\n" +
+	"\tto_minute\x18\x05 \x01(\x04R\btoMinute\x12.\n" +
+	"\x04from\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\x02to\x12'\n" +
+	"\x0fpickup_location\x18\b \x01(\tR\x0epickupLocation\x12'\n" +
+	"\x0freturn_location\x18\t \x01(\tR\x0ereturnLocation\",\n" +
+	"\x0fGetLeaseRequest\x12\x19\n" +
+	"\blease_id\x18\x01 \x01(\x04R\aleaseId\"\xc6\x02\n" +
+	"\x0fCheckCarRequest\x12\x15\n" +
+	"\x06car_id\x18\x01 \x01(\x04R\x05carId\x12\x19\n" +
+	"\bfrom_day\x18\x02 \x01(\x04R\afromDay\x12\x15\n" +
+	"\x06to_day\x18\x03 \x01(\x04R\x05toDay\x12\x1f\n" +
+	"\vfrom_minute\x18\x04 \x01(\x04R\n" +
+	"fromMinute\x12\x1b\n" +
+	"\tto_minute\x18\x05 \x01(\x04R\btoMinute\x12.\n" +
+	"\x04from\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\x02to\x12'\n" +
+	"\x0fpickup_location\x18\b \x01(\tR\x0epickupLocation\x12'\n" +
+	"\x0freturn_location\x18\t \x01(\tR\x0ereturnLocation\"+\n" +
+	"\x10CheckCarResponse\x12\x17\n" +
+	"\ais_free\x18\x01 \x01(\bR\x06isFree\"]\n" +
+	"\x12AvailabilityChange\x12\x17\n" +
+	"\ais_free\x18\x01 \x01(\bR\x06isFree\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\"J\n" +
+	"\x10CarLeasesRequest\x12\x15\n" +
+	"\x06car_id\x18\x01 \x01(\x04R\x05carId\x12\x1f\n" +
+	"\vfrom_minute\x18\x02 \x01(\x04R\n" +
+	"fromMinute\"4\n" +
+	"\tLeaseList\x12'\n" +
+	"\x06leases\x18\x01 \x03(\v2\x0f.lease.v1.LeaseR\x06leases\"G\n" +
+	"\x14SetTurnaroundRequest\x12\x15\n" +
+	"\x06car_id\x18\x01 \x01(\x04R\x05carId\x12\x18\n" +
+	"\aminutes\x18\x02 \x01(\x04R\aminutes\"\x17\n" +
+	"\x15SetTurnaroundResponse\"7\n" +
+	"\vUserRequest\x12\x1c\n" +
+	"\auser_id\x18\x01 \x01(\x04H\x00R\x06userId\x88\x01\x01B\n" +
+	"\n" +
+	"\b_user_id\"+\n" +
+	"\x11EraseUserResponse\x12\x16\n" +
+	"\x06erased\x18\x01 \x01(\x03R\x06erased2\xa2\x04\n" +
+	"\fLeaseService\x12<\n" +
+	"\vCreateLease\x12\x1c.lease.v1.CreateLeaseRequest\x1a\x0f.lease.v1.Lease\x126\n" +
+	"\bGetLease\x12\x19.lease.v1.GetLeaseRequest\x1a\x0f.lease.v1.Lease\x12A\n" +
+	"\bCheckCar\x12\x19.lease.v1.CheckCarRequest\x1a\x1a.lease.v1.CheckCarResponse\x12N\n" +
+	"\x11WatchAvailability\x12\x19.lease.v1.CheckCarRequest\x1a\x1c.lease.v1.AvailabilityChange0\x01\x12<\n" +
+	"\tCarLeases\x12\x1a.lease.v1.CarLeasesRequest\x1a\x13.lease.v1.LeaseList\x12P\n" +
+	"\rSetTurnaround\x12\x1e.lease.v1.SetTurnaroundRequest\x1a\x1f.lease.v1.SetTurnaroundResponse\x128\n" +
+	"\n" +
+	"UserLeases\x12\x15.lease.v1.UserRequest\x1a\x13.lease.v1.LeaseList\x12?\n" +
+	"\tEraseUser\x12\x15.lease.v1.UserRequest\x1a\x1b.lease.v1.EraseUserResponseB+Z)distributed-rental/projects/lease/leasepbb\x06proto3"
+
+var (
+	file_lease_proto_rawDescOnce sync.Once
+	file_lease_proto_rawDescData []byte
+)
+
+func file_lease_proto_rawDescGZIP() []byte {
+	file_lease_proto_rawDescOnce.Do(func() {
+		file_lease_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_lease_proto_rawDesc), len(file_lease_proto_rawDesc)))
+	})
+	return file_lease_proto_rawDescData
+}
+
+var file_lease_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_lease_proto_goTypes = []any{
+	(*Lease)(nil),                 // 0: lease.v1.Lease
+	(*CreateLeaseRequest)(nil),    // 1: lease.v1.CreateLeaseRequest
+	(*GetLeaseRequest)(nil),       // 2: lease.v1.GetLeaseRequest
+	(*CheckCarRequest)(nil),       // 3: lease.v1.CheckCarRequest
+	(*CheckCarResponse)(nil),      // 4: lease.v1.CheckCarResponse
+	(*AvailabilityChange)(nil),    // 5: lease.v1.AvailabilityChange
+	(*CarLeasesRequest)(nil),      // 6: lease.v1.CarLeasesRequest
+	(*LeaseList)(nil),             // 7: lease.v1.LeaseList
+	(*SetTurnaroundRequest)(nil),  // 8: lease.v1.SetTurnaroundRequest
+	(*SetTurnaroundResponse)(nil), // 9: lease.v1.SetTurnaroundResponse
+	(*UserRequest)(nil),           // 10: lease.v1.UserRequest
+	(*EraseUserResponse)(nil),     // 11: lease.v1.EraseUserResponse
+	(*timestamppb.Timestamp)(nil), // 12: google.protobuf.Timestamp
+}
+var file_lease_proto_depIdxs = []int32{
+	12, // 0: lease.v1.CreateLeaseRequest.from:type_name -> google.protobuf.Timestamp
+	12, // 1: lease.v1.CreateLeaseRequest.to:type_name -> google.protobuf.Timestamp
+	12, // 2: lease.v1.CheckCarRequest.from:type_name -> google.protobuf.Timestamp
+	12, // 3: lease.v1.CheckCarRequest.to:type_name -> google.protobuf.Timestamp
+	12, // 4: lease.v1.AvailabilityChange.time:type_name -> google.protobuf.Timestamp
+	0,  // 5: lease.v1.LeaseList.leases:type_name -> lease.v1.Lease
+	1,  // 6: lease.v1.LeaseService.CreateLease:input_type -> lease.v1.CreateLeaseRequest
+	2,  // 7: lease.v1.LeaseService.GetLease:input_type -> lease.v1.GetLeaseRequest
+	3,  // 8: lease.v1.LeaseService.CheckCar:input_type -> lease.v1.CheckCarRequest
+	3,  // 9: lease.v1.LeaseService.WatchAvailability:input_type -> lease.v1.CheckCarRequest
+	6,  // 10: lease.v1.LeaseService.CarLeases:input_type -> lease.v1.CarLeasesRequest
+	8,  // 11: lease.v1.LeaseService.SetTurnaround:input_type -> lease.v1.SetTurnaroundRequest
+	10, // 12: lease.v1.LeaseService.UserLeases:input_type -> lease.v1.UserRequest
+	10, // 13: lease.v1.LeaseService.EraseUser:input_type -> lease.v1.UserRequest
+	0,  // 14: lease.v1.LeaseService.CreateLease:output_type -> lease.v1.Lease
+	0,  // 15: lease.v1.LeaseService.GetLease:output_type -> lease.v1.Lease
+	4,  // 16: lease.v1.LeaseService.CheckCar:output_type -> lease.v1.CheckCarResponse
+	5,  // 17: lease.v1.LeaseService.WatchAvailability:output_type -> lease.v1.AvailabilityChange
+	7,  // 18: lease.v1.LeaseService.CarLeases:output_type -> lease.v1.LeaseList
+	9,  // 19: lease.v1.LeaseService.SetTurnaround:output_type -> lease.v1.SetTurnaroundResponse
+	7,  // 20: lease.v1.LeaseService.UserLeases:output_type -> lease.v1.LeaseList
+	11, // 21: lease.v1.LeaseService.EraseUser:output_type -> lease.v1.EraseUserResponse
+	14, // [14:22] is the sub-list for method output_type
+	6,  // [6:14] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_lease_proto_init() }
+func file_lease_proto_init() {
+	if File_lease_proto != nil {
+		return
+	}
+	file_lease_proto_msgTypes[10].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_lease_proto_rawDesc), len(file_lease_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_lease_proto_goTypes,
+		DependencyIndexes: file_lease_proto_depIdxs,
+		MessageInfos:      file_lease_proto_msgTypes,
+	}.Build()
+	File_lease_proto = out.File
+	file_lease_proto_goTypes = nil
+	file_lease_proto_depIdxs = nil
+}
@@ -0,0 +1,431 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.29.3
+// source: lease.proto
+
+package leasepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	LeaseService_CreateLease_FullMethodName       = "/lease.v1.LeaseService/CreateLease"
+	LeaseService_GetLease_FullMethodName          = "/lease.v1.LeaseService/GetLease"
+	LeaseService_CheckCar_FullMethodName          = "/lease.v1.LeaseService/CheckCar"
+	LeaseService_WatchAvailability_FullMethodName = "/lease.v1.LeaseService/WatchAvailability"
+	LeaseService_CarLeases_FullMethodName         = "/lease.v1.LeaseService/CarLeases"
+	LeaseService_SetTurnaround_FullMethodName     = "/lease.v1.LeaseService/SetTurnaround"
+	LeaseService_UserLeases_FullMethodName        = "/lease.v1.LeaseService/UserLeases"
+	LeaseService_EraseUser_FullMethodName         = "/lease.v1.LeaseService/EraseUser"
+)
+
+// LeaseServiceClient is the client API for LeaseService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// LeaseService is the gRPC API of the lease service. Every RPC behaves
+// like the REST v1 route named in its comment and takes the same credentials,
+// sent as metadata: x-auth or x-api-key for users, authorization with a
+// bearer service token for other services and x-admin-token for the admin.
+type LeaseServiceClient interface {
+	// CreateLease leases a car to the caller, like POST /v1/leases.
+	CreateLease(ctx context.Context, in *CreateLeaseRequest, opts ...grpc.CallOption) (*Lease, error)
+	// GetLease returns a lease of the caller, like
+	// GET /v1/leases/{lease_id}.
+	GetLease(ctx context.Context, in *GetLeaseRequest, opts ...grpc.CallOption) (*Lease, error)
+	// CheckCar reports whether a car is free for an interval, like
+	// GET /v1/cars/{car_id}/availability.
+	CheckCar(ctx context.Context, in *CheckCarRequest, opts ...grpc.CallOption) (*CheckCarResponse, error)
+	// WatchAvailability sends whether a car is free for an interval at once
+	// and again every time that changes, until the caller cancels the call.
+	WatchAvailability(ctx context.Context, in *CheckCarRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AvailabilityChange], error)
+	// CarLeases lists the leases of a car that end after from_minute, like
+	// GET /v1/cars/{car_id}/leases.
+	CarLeases(ctx context.Context, in *CarLeasesRequest, opts ...grpc.CallOption) (*LeaseList, error)
+	// SetTurnaround sets the minutes a car needs between two leases, like
+	// PUT /v1/cars/{car_id}/turnaround.
+	SetTurnaround(ctx context.Context, in *SetTurnaroundRequest, opts ...grpc.CallOption) (*SetTurnaroundResponse, error)
+	// UserLeases lists every lease of a user, like
+	// GET /v1/admin/users/{user_id}/leases.
+	UserLeases(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*LeaseList, error)
+	// EraseUser detaches the leases of a user from them, like
+	// POST /v1/admin/users/{user_id}/erase.
+	EraseUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*EraseUserResponse, error)
+}
+
+type leaseServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLeaseServiceClient(cc grpc.ClientConnInterface) LeaseServiceClient {
+	return &leaseServiceClient{cc}
+}
+
+func (c *leaseServiceClient) CreateLease(ctx context.Context, in *CreateLeaseRequest, opts ...grpc.CallOption) (*Lease, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Lease)
+	err := c.cc.Invoke(ctx, LeaseService_CreateLease_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *leaseServiceClient) GetLease(ctx context.Context, in *GetLeaseRequest, opts ...grpc.CallOption) (*Lease, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Lease)
+	err := c.cc.Invoke(ctx, LeaseService_GetLease_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *leaseServiceClient) CheckCar(ctx context.Context, in *CheckCarRequest, opts ...grpc.CallOption) (*CheckCarResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckCarResponse)
+	err := c.cc.Invoke(ctx, LeaseService_CheckCar_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *leaseServiceClient) WatchAvailability(ctx context.Context, in *CheckCarRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AvailabilityChange], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LeaseService_ServiceDesc.Streams[0], LeaseService_WatchAvailability_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CheckCarRequest, AvailabilityChange]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LeaseService_WatchAvailabilityClient = grpc.ServerStreamingClient[AvailabilityChange]
+
+func (c *leaseServiceClient) CarLeases(ctx context.Context, in *CarLeasesRequest, opts ...grpc.CallOption) (*LeaseList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LeaseList)
+	err := c.cc.Invoke(ctx, LeaseService_CarLeases_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *leaseServiceClient) SetTurnaround(ctx context.Context, in *SetTurnaroundRequest, opts ...grpc.CallOption) (*SetTurnaroundResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetTurnaroundResponse)
+	err := c.cc.Invoke(ctx, LeaseService_SetTurnaround_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *leaseServiceClient) UserLeases(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*LeaseList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LeaseList)
+	err := c.cc.Invoke(ctx, LeaseService_UserLeases_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *leaseServiceClient) EraseUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*EraseUserResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EraseUserResponse)
+	err := c.cc.Invoke(ctx, LeaseService_EraseUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LeaseServiceServer is the server API for LeaseService service.
+// All implementations must embed UnimplementedLeaseServiceServer
+// for forward compatibility.
+//
+// LeaseService is the gRPC API of the lease service. Every RPC behaves
+// like the REST v1 route named in its comment and takes the same credentials,
+// sent as metadata: x-auth or x-api-key for users, authorization with a
+// bearer service token for other services and x-admin-token for the admin.
+type LeaseServiceServer interface {
+	// CreateLease leases a car to the caller, like POST /v1/leases.
+	CreateLease(context.Context, *CreateLeaseRequest) (*Lease, error)
+	// GetLease returns a lease of the caller, like
+	// GET /v1/leases/{lease_id}.
+	GetLease(context.Context, *GetLeaseRequest) (*Lease, error)
+	// CheckCar reports whether a car is free for an interval, like
+	// GET /v1/cars/{car_id}/availability.
+	CheckCar(context.Context, *CheckCarRequest) (*CheckCarResponse, error)
+	// WatchAvailability sends whether a car is free for an interval at once
+	// and again every time that changes, until the caller cancels the call.
+	WatchAvailability(*CheckCarRequest, grpc.ServerStreamingServer[AvailabilityChange]) error
+	// CarLeases lists the leases of a car that end after from_minute, like
+	// GET /v1/cars/{car_id}/leases.
+	CarLeases(context.Context, *CarLeasesRequest) (*LeaseList, error)
+	// SetTurnaround sets the minutes a car needs between two leases, like
+	// PUT /v1/cars/{car_id}/turnaround.
+	SetTurnaround(context.Context, *SetTurnaroundRequest) (*SetTurnaroundResponse, error)
+	// UserLeases lists every lease of a user, like
+	// GET /v1/admin/users/{user_id}/leases.
+	UserLeases(context.Context, *UserRequest) (*LeaseList, error)
+	// EraseUser detaches the leases of a user from them, like
+	// POST /v1/admin/users/{user_id}/erase.
+	EraseUser(context.Context, *UserRequest) (*EraseUserResponse, error)
+	mustEmbedUnimplementedLeaseServiceServer()
+}
+
+// UnimplementedLeaseServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedLeaseServiceServer struct{}
+
+func (UnimplementedLeaseServiceServer) CreateLease(context.Context, *CreateLeaseRequest) (*Lease, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateLease not implemented")
+}
+func (UnimplementedLeaseServiceServer) GetLease(context.Context, *GetLeaseRequest) (*Lease, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetLease not implemented")
+}
+func (UnimplementedLeaseServiceServer) CheckCar(context.Context, *CheckCarRequest) (*CheckCarResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method CheckCar not implemented")
+}
+func (UnimplementedLeaseServiceServer) WatchAvailability(*CheckCarRequest, grpc.ServerStreamingServer[AvailabilityChange]) error {
+	return status.Error(codes.Unimplemented, "method WatchAvailability not implemented")
+}
+func (UnimplementedLeaseServiceServer) CarLeases(context.Context, *CarLeasesRequest) (*LeaseList, error) {
+	return nil, status.Error(codes.Unimplemented, "method CarLeases not implemented")
+}
+func (UnimplementedLeaseServiceServer) SetTurnaround(context.Context, *SetTurnaroundRequest) (*SetTurnaroundResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetTurnaround not implemented")
+}
+func (UnimplementedLeaseServiceServer) UserLeases(context.Context, *UserRequest) (*LeaseList, error) {
+	return nil, status.Error(codes.Unimplemented, "method UserLeases not implemented")
+}
+func (UnimplementedLeaseServiceServer) EraseUser(context.Context, *UserRequest) (*EraseUserResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method EraseUser not implemented")
+}
+func (UnimplementedLeaseServiceServer) mustEmbedUnimplementedLeaseServiceServer() {}
+func (UnimplementedLeaseServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeLeaseServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LeaseServiceServer will
+// result in compilation errors.
+type UnsafeLeaseServiceServer interface {
+	mustEmbedUnimplementedLeaseServiceServer()
+}
+
+func RegisterLeaseServiceServer(s grpc.ServiceRegistrar, srv LeaseServiceServer) {
+	// If the following call panics, it indicates UnimplementedLeaseServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&LeaseService_ServiceDesc, srv)
+}
+
+func _LeaseService_CreateLease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateLeaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LeaseServiceServer).CreateLease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LeaseService_CreateLease_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LeaseServiceServer).CreateLease(ctx, req.(*CreateLeaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LeaseService_GetLease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLeaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LeaseServiceServer).GetLease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LeaseService_GetLease_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LeaseServiceServer).GetLease(ctx, req.(*GetLeaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LeaseService_CheckCar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckCarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LeaseServiceServer).CheckCar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LeaseService_CheckCar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LeaseServiceServer).CheckCar(ctx, req.(*CheckCarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LeaseService_WatchAvailability_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CheckCarRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LeaseServiceServer).WatchAvailability(m, &grpc.GenericServerStream[CheckCarRequest, AvailabilityChange]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LeaseService_WatchAvailabilityServer = grpc.ServerStreamingServer[AvailabilityChange]
+
+func _LeaseService_CarLeases_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CarLeasesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LeaseServiceServer).CarLeases(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LeaseService_CarLeases_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LeaseServiceServer).CarLeases(ctx, req.(*CarLeasesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LeaseService_SetTurnaround_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetTurnaroundRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LeaseServiceServer).SetTurnaround(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LeaseService_SetTurnaround_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LeaseServiceServer).SetTurnaround(ctx, req.(*SetTurnaroundRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LeaseService_UserLeases_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LeaseServiceServer).UserLeases(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LeaseService_UserLeases_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LeaseServiceServer).UserLeases(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LeaseService_EraseUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LeaseServiceServer).EraseUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LeaseService_EraseUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LeaseServiceServer).EraseUser(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// LeaseService_ServiceDesc is the grpc.ServiceDesc for LeaseService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LeaseService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "lease.v1.LeaseService",
+	HandlerType: (*LeaseServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateLease",
+			Handler:    _LeaseService_CreateLease_Handler,
+		},
+		{
+			MethodName: "GetLease",
+			Handler:    _LeaseService_GetLease_Handler,
+		},
+		{
+			MethodName: "CheckCar",
+			Handler:    _LeaseService_CheckCar_Handler,
+		},
+		{
+			MethodName: "CarLeases",
+			Handler:    _LeaseService_CarLeases_Handler,
+		},
+		{
+			MethodName: "SetTurnaround",
+			Handler:    _LeaseService_SetTurnaround_Handler,
+		},
+		{
+			MethodName: "UserLeases",
+			Handler:    _LeaseService_UserLeases_Handler,
+		},
+		{
+			MethodName: "EraseUser",
+			Handler:    _LeaseService_EraseUser_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchAvailability",
+			Handler:       _LeaseService_WatchAvailability_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "lease.proto",
+}
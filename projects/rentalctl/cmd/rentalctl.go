@@ -0,0 +1,330 @@
+package main
+
+import (
+	"distributed-rental/pkg/backup"
+	"distributed-rental/pkg/encryption"
+	"distributed-rental/pkg/mtls"
+	"distributed-rental/pkg/openapi"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const usage = `usage: rentalctl <command> [flags]
+
+commands:
+  backup      pull a full or incremental backup from a running service
+  verify      check checksums and load a backup chain into memory
+  restore     restore a backup chain into an empty database directory
+  list        print the backups in a directory
+  rotate-key  re-encrypt the key registry of a stopped database with a new key
+  reencrypt   copy a stopped database into an empty directory with a different key
+  gen-ca      create the local CA that signs the certificates of the services
+  gen-cert    create a certificate of a service for mutual TLS, signed by the local CA
+  gen-client  generate the Go client of a service from its OpenAPI document`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "backup":
+		err = runBackup(os.Args[2:])
+	case "verify":
+		err = runVerify(os.Args[2:])
+	case "restore":
+		err = runRestore(os.Args[2:])
+	case "list":
+		err = runList(os.Args[2:])
+	case "rotate-key":
+		err = runRotateKey(os.Args[2:])
+	case "reencrypt":
+		err = runReencrypt(os.Args[2:])
+	case "gen-ca":
+		err = runGenCA(os.Args[2:])
+	case "gen-cert":
+		err = runGenCert(os.Args[2:])
+	case "gen-client":
+		err = runGenClient(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runBackup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	serviceF := flags.String("service", "", "service name, used in file names: auth, booking, lease or fleet")
+	addrF := flags.String("addr", "", "admin addr of the service")
+	tokenPathF := flags.String("admin-token-path", "/etc/admin-token", "path to the admin token")
+	dirF := flags.String("dir", "", "backup directory")
+	fullF := flags.Bool("full", false, "take a full backup instead of an incremental one")
+	flags.Parse(args)
+
+	if *serviceF == "" || *addrF == "" || *dirF == "" {
+		return fmt.Errorf("backup needs -service, -addr and -dir")
+	}
+	token, err := ioutil.ReadFile(*tokenPathF)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(*dirF, 0o700)
+	if err != nil {
+		return err
+	}
+
+	entry, err := backup.Take(*addrF, []byte(strings.TrimSpace(string(token))), *serviceF, *dirF, *fullF)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: versions %d..%d, %d bytes\n", entry.File, entry.Since, entry.Version, entry.Size)
+	return nil
+}
+
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	dirF := flags.String("dir", "", "backup directory")
+	atF := flags.String("at", "", "verify the chain restoring this RFC 3339 time, default latest")
+	flags.Parse(args)
+
+	at, err := parseTime(*atF)
+	if err != nil {
+		return err
+	}
+	chain, err := backup.Verify(*dirF, at)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("ok: %d backups in chain, up to version %d\n", len(chain), chain[len(chain)-1].Version)
+	return nil
+}
+
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	dirF := flags.String("dir", "", "backup directory")
+	targetF := flags.String("target", "", "empty directory to restore the database into")
+	atF := flags.String("at", "", "restore the last backup taken at or before this RFC 3339 time, default latest")
+	keyPathF := flags.String("key-path", "", "encryption key of the restored database, empty leaves it unencrypted")
+	flags.Parse(args)
+
+	if *dirF == "" || *targetF == "" {
+		return fmt.Errorf("restore needs -dir and -target")
+	}
+	at, err := parseTime(*atF)
+	if err != nil {
+		return err
+	}
+	key, err := encryption.LoadKey("", *keyPathF)
+	if err != nil {
+		return err
+	}
+	chain, err := backup.Restore(*dirF, *targetF, at, key)
+	if err != nil {
+		return err
+	}
+	last := chain[len(chain)-1]
+	fmt.Printf("restored %d backups into %s, state as of %s\n", len(chain), *targetF, last.CreatedAt.Format(time.RFC3339))
+	return nil
+}
+
+func runList(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	dirF := flags.String("dir", "", "backup directory")
+	flags.Parse(args)
+
+	manifest, err := backup.ReadManifest(*dirF)
+	if err != nil {
+		return err
+	}
+	for _, entry := range manifest.Entries {
+		fmt.Printf("%s  %s  versions %d..%d  %d bytes\n", entry.CreatedAt.Format(time.RFC3339), entry.File, entry.Since, entry.Version, entry.Size)
+	}
+	return nil
+}
+
+func runRotateKey(args []string) error {
+	flags := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+	dirF := flags.String("dir", "", "badger directory of the stopped service")
+	oldKeyPathF := flags.String("old-key-path", "", "current encryption key, empty if the registry is unencrypted")
+	newKeyPathF := flags.String("new-key-path", "", "new encryption key")
+	flags.Parse(args)
+
+	if *dirF == "" || *newKeyPathF == "" {
+		return fmt.Errorf("rotate-key needs -dir and -new-key-path")
+	}
+	oldKey, err := encryption.LoadKey("", *oldKeyPathF)
+	if err != nil {
+		return err
+	}
+	newKey, err := encryption.LoadKey("", *newKeyPathF)
+	if err != nil {
+		return err
+	}
+	err = encryption.RotateKey(*dirF, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rotated the encryption key of %s\n", *dirF)
+	return nil
+}
+
+func runReencrypt(args []string) error {
+	flags := flag.NewFlagSet("reencrypt", flag.ExitOnError)
+	srcF := flags.String("src", "", "badger directory of the stopped service")
+	dstF := flags.String("dst", "", "empty directory for the re-encrypted copy")
+	srcKeyPathF := flags.String("src-key-path", "", "encryption key of src, empty if it is unencrypted")
+	dstKeyPathF := flags.String("dst-key-path", "", "encryption key of dst, empty to decrypt")
+	flags.Parse(args)
+
+	if *srcF == "" || *dstF == "" {
+		return fmt.Errorf("reencrypt needs -src and -dst")
+	}
+	srcKey, err := encryption.LoadKey("", *srcKeyPathF)
+	if err != nil {
+		return err
+	}
+	dstKey, err := encryption.LoadKey("", *dstKeyPathF)
+	if err != nil {
+		return err
+	}
+	err = encryption.Reencrypt(*srcF, *dstF, srcKey, dstKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("copied %s into %s\n", *srcF, *dstF)
+	return nil
+}
+
+func runGenCA(args []string) error {
+	flags := flag.NewFlagSet("gen-ca", flag.ExitOnError)
+	nameF := flags.String("name", "distributed-rental CA", "common name of the CA")
+	certPathF := flags.String("cert-path", "ca.crt", "where to write the CA certificate")
+	keyPathF := flags.String("key-path", "ca.key", "where to write the CA key")
+	validForF := flags.Duration("valid-for", 10*365*24*time.Hour, "how long the CA is valid")
+	flags.Parse(args)
+
+	cert, key, err := mtls.NewCA(*nameF, *validForF)
+	if err != nil {
+		return err
+	}
+	err = writeKeyPair(*certPathF, cert, *keyPathF, key)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote CA %s and its key %s\n", *certPathF, *keyPathF)
+	return nil
+}
+
+func runGenCert(args []string) error {
+	flags := flag.NewFlagSet("gen-cert", flag.ExitOnError)
+	nameF := flags.String("name", "", "service name, the common name of the certificate and the client id its tokens must name: auth, booking, lease or fleet")
+	hostsF := flags.String("hosts", "localhost,127.0.0.1", "comma separated DNS names and IP addresses the service is reached at")
+	caCertPathF := flags.String("ca-cert-path", "ca.crt", "CA certificate")
+	caKeyPathF := flags.String("ca-key-path", "ca.key", "CA key")
+	certPathF := flags.String("cert-path", "", "where to write the certificate, default <name>.crt")
+	keyPathF := flags.String("key-path", "", "where to write the key, default <name>.key")
+	validForF := flags.Duration("valid-for", 365*24*time.Hour, "how long the certificate is valid")
+	flags.Parse(args)
+
+	if *nameF == "" {
+		return fmt.Errorf("gen-cert needs -name")
+	}
+	if *certPathF == "" {
+		*certPathF = *nameF + ".crt"
+	}
+	if *keyPathF == "" {
+		*keyPathF = *nameF + ".key"
+	}
+	caCert, err := ioutil.ReadFile(*caCertPathF)
+	if err != nil {
+		return err
+	}
+	caKey, err := ioutil.ReadFile(*caKeyPathF)
+	if err != nil {
+		return err
+	}
+	var hosts []string
+	for _, host := range strings.Split(*hostsF, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	cert, key, err := mtls.NewCert(caCert, caKey, *nameF, hosts, *validForF)
+	if err != nil {
+		return err
+	}
+	err = writeKeyPair(*certPathF, cert, *keyPathF, key)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote certificate %s and its key %s for %s\n", *certPathF, *keyPathF, *nameF)
+	return nil
+}
+
+// writeKeyPair refuses to overwrite, so that a CA or key in use is not lost.
+func writeKeyPair(certPath string, cert []byte, keyPath string, key []byte) error {
+	for _, path := range []string{certPath, keyPath} {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		}
+	}
+	err := ioutil.WriteFile(certPath, cert, 0o644)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyPath, key, 0o600)
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Now(), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// runGenClient writes the client of pkg/sdk/<service> from the document the
+// service wrote with -openapi. It is run by go generate.
+func runGenClient(args []string) error {
+	flags := flag.NewFlagSet("gen-client", flag.ExitOnError)
+	specF := flags.String("spec", "", "OpenAPI document of the service")
+	packageF := flags.String("package", "", "package name of the client")
+	outF := flags.String("out", "client.go", "where to write the client")
+	flags.Parse(args)
+
+	if *specF == "" || *packageF == "" {
+		return fmt.Errorf("gen-client needs -spec and -package")
+	}
+	data, err := ioutil.ReadFile(*specF)
+	if err != nil {
+		return err
+	}
+	var document openapi.Document
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *specF, err)
+	}
+	// Name the document from the module root, as go generate runs in the
+	// package of the client.
+	name := filepath.ToSlash(filepath.Clean(*specF))
+	for strings.HasPrefix(name, "../") {
+		name = strings.TrimPrefix(name, "../")
+	}
+	source, err := openapi.GenerateClient(&document, *packageF, name)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*outF, source, 0o644)
+}